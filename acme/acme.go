@@ -0,0 +1,773 @@
+// Package acme implements an ACME (RFC 8555) server in front of a CFSSL
+// signer, so that ACME clients such as certbot, Caddy or cert-manager can
+// obtain certificates from a CFSSL CA. It supports the http-01 and dns-01
+// challenges. Accounts, orders and authorizations are kept in memory, and
+// are lost when the server restarts: the server must run as a single
+// instance, since an account or order created on one instance is unknown
+// to the others. Issued certificates are recorded in the certificate
+// database of the signer, if it has one.
+package acme
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// The statuses of ACME objects (RFC 8555 section 7.1.6).
+const (
+	statusPending     = "pending"
+	statusReady       = "ready"
+	statusProcessing  = "processing"
+	statusValid       = "valid"
+	statusInvalid     = "invalid"
+	statusDeactivated = "deactivated"
+)
+
+const (
+	// orderLifetime is how long an order and its authorizations can be
+	// completed for.
+	orderLifetime = 7 * 24 * time.Hour
+	// maxNonces bounds the number of outstanding nonces; the oldest are
+	// forgotten first.
+	maxNonces = 10000
+	// maxRequestSize bounds the size of a request body.
+	maxRequestSize = 64 * 1024
+)
+
+type account struct {
+	ID         string
+	Status     string
+	Contact    []string
+	Key        interface{}
+	Thumbprint string
+	Orders     []string
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	ID             string
+	Account        string
+	Status         string
+	Expires        time.Time
+	Identifiers    []identifier
+	Authorizations []*authorization
+	Certificate    []byte
+	Error          *problem
+}
+
+type authorization struct {
+	ID         string
+	Account    string
+	Identifier identifier
+	Wildcard   bool
+	Status     string
+	Expires    time.Time
+	Challenges []*challenge
+}
+
+type challenge struct {
+	ID        string
+	Type      string
+	Token     string
+	Status    string
+	Validated time.Time
+	Error     *problem
+	authz     *authorization
+}
+
+// A Server is an ACME server issuing certificates with a signer. It is
+// an http.Handler serving the ACME resources under its prefix, with the
+// directory at the prefix itself and at prefix + "directory".
+type Server struct {
+	signer  signer.Signer
+	profile string
+	prefix  string
+
+	mu         sync.Mutex
+	nonces     map[string]bool
+	nonceQueue []string
+	accounts   map[string]*account
+	byKey      map[string]*account
+	orders     map[string]*order
+	authzs     map[string]*authorization
+	challenges map[string]*challenge
+
+	// httpPort is the port http-01 challenges are fetched from, and
+	// lookupTXT resolves dns-01 challenges.
+	httpPort  int
+	client    *http.Client
+	lookupTXT func(name string) ([]string, error)
+}
+
+// NewServer returns an ACME server served under prefix, such as
+// "/acme/", that issues certificates with s under the signing profile
+// named profile, or the default profile if profile is empty. ACME clients
+// only prove control of the names they ask for, so the profile may
+// neither require authentication nor issue CA certificates.
+func NewServer(s signer.Signer, profile, prefix string) (*Server, error) {
+	p, err := signer.Profile(s, profile)
+	if err != nil {
+		return nil, err
+	}
+	if p.Provider != nil {
+		return nil, errors.New("acme: the signing profile requires authentication")
+	}
+	if p.CAConstraint.IsCA {
+		return nil, errors.New("acme: the signing profile issues CA certificates")
+	}
+
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Server{
+		signer:     s,
+		profile:    profile,
+		prefix:     prefix,
+		nonces:     map[string]bool{},
+		accounts:   map[string]*account{},
+		byKey:      map[string]*account{},
+		orders:     map[string]*order{},
+		authzs:     map[string]*authorization{},
+		challenges: map[string]*challenge{},
+		httpPort:   80,
+		client: &http.Client{
+			Timeout:       10 * time.Second,
+			CheckRedirect: checkRedirect,
+		},
+		lookupTXT: defaultLookupTXT,
+	}, nil
+}
+
+// newID returns a random identifier for an object or a nonce.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// baseURL returns the URL of the prefix, as seen by the client.
+func (s *Server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.prefix
+}
+
+// newNonce returns a fresh nonce for the client to sign its next request
+// with.
+func (s *Server) newNonce() string {
+	nonce := b64.EncodeToString([]byte(newID()))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[nonce] = true
+	s.nonceQueue = append(s.nonceQueue, nonce)
+	if len(s.nonceQueue) > maxNonces {
+		delete(s.nonces, s.nonceQueue[0])
+		s.nonceQueue = s.nonceQueue[1:]
+	}
+	return nonce
+}
+
+// useNonce consumes nonce, reporting whether it was outstanding.
+func (s *Server) useNonce(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.nonces[nonce] {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return true
+}
+
+// ServeHTTP routes the ACME requests to their resource.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Link", fmt.Sprintf("<%sdirectory>;rel=\"index\"", base))
+
+	path := strings.TrimPrefix(r.URL.Path, s.prefix)
+	switch path {
+	case "", "directory":
+		s.directory(w, r, base)
+		return
+	case "new-nonce":
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	if r.Method != "POST" {
+		writeProblem(w, newProblem("malformed", http.StatusMethodNotAllowed, "only POST is permitted"))
+		return
+	}
+	req, prob := s.authenticate(r, base)
+	if prob != nil {
+		writeProblem(w, prob)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "new-account":
+		s.newAccount(w, req, base)
+	case req.account == nil:
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "requests must be signed with an account key ID"))
+	case path == "new-order":
+		s.newOrder(w, req, base)
+	case len(parts) == 2 && parts[0] == "account":
+		s.updateAccount(w, req, base, parts[1])
+	case len(parts) == 3 && parts[0] == "account" && parts[2] == "orders":
+		s.accountOrders(w, req, base, parts[1])
+	case len(parts) == 2 && parts[0] == "order":
+		s.getOrder(w, req, base, parts[1])
+	case len(parts) == 3 && parts[0] == "order" && parts[2] == "finalize":
+		s.finalize(w, req, base, parts[1])
+	case len(parts) == 2 && parts[0] == "authz":
+		s.getAuthorization(w, req, base, parts[1])
+	case len(parts) == 2 && parts[0] == "chall":
+		s.respondChallenge(w, req, base, parts[1])
+	case len(parts) == 2 && parts[0] == "cert":
+		s.getCertificate(w, req, parts[1])
+	default:
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "no such resource"))
+	}
+}
+
+func (s *Server) directory(w http.ResponseWriter, r *http.Request, base string) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeProblem(w, newProblem("malformed", http.StatusMethodNotAllowed, "only GET is permitted"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"newNonce":   base + "new-nonce",
+		"newAccount": base + "new-account",
+		"newOrder":   base + "new-order",
+	})
+}
+
+// A request is an authenticated ACME request. account is nil for the
+// requests signed with a JWK, which only create or look up accounts.
+type request struct {
+	url     string
+	payload []byte
+	key     interface{}
+	account *account
+}
+
+// postAsGet reports whether the request is a POST-as-GET request, with
+// an empty payload.
+func (req *request) postAsGet() bool {
+	return len(req.payload) == 0
+}
+
+// authenticate verifies the JWS of a POST request: its nonce, its URL
+// and its signature, by the key of the account it names or the key it
+// carries.
+func (s *Server) authenticate(r *http.Request, base string) (*request, *problem) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return nil, newProblem("malformed", http.StatusUnsupportedMediaType, "content type must be application/jose+json")
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "failed to read the request: %v", err)
+	}
+	if len(body) > maxRequestSize {
+		return nil, newProblem("malformed", http.StatusRequestEntityTooLarge, "request is too large")
+	}
+	msg, header, payload, err := parseJWS(body)
+	if err != nil {
+		return nil, newProblem("malformed", http.StatusBadRequest, "%v", err)
+	}
+
+	req := &request{url: base + strings.TrimPrefix(r.URL.Path, s.prefix), payload: payload}
+	if header.URL != req.url {
+		return nil, newProblem("unauthorized", http.StatusUnauthorized, "request URL %q does not match %q", header.URL, req.url)
+	}
+
+	if header.JWK != nil {
+		if req.key, err = header.JWK.publicKey(); err != nil {
+			return nil, newProblem("badPublicKey", http.StatusBadRequest, "%v", err)
+		}
+	} else {
+		id := strings.TrimPrefix(header.KID, base+"account/")
+		s.mu.Lock()
+		req.account = s.accounts[id]
+		status := ""
+		if req.account != nil {
+			status = req.account.Status
+		}
+		s.mu.Unlock()
+		if id == header.KID || req.account == nil {
+			return nil, newProblem("accountDoesNotExist", http.StatusBadRequest, "no account %q", header.KID)
+		}
+		if status != statusValid {
+			return nil, newProblem("unauthorized", http.StatusUnauthorized, "account is %s", status)
+		}
+		req.key = req.account.Key
+	}
+
+	if err = msg.verify(header.Alg, req.key); err != nil {
+		if _, ok := err.(algorithmError); ok {
+			return nil, newProblem("badSignatureAlgorithm", http.StatusBadRequest, "%v", err)
+		}
+		return nil, newProblem("malformed", http.StatusBadRequest, "%v", err)
+	}
+	// The nonce is only consumed once the request is known to come from
+	// the holder of the key.
+	if !s.useNonce(header.Nonce) {
+		return nil, newProblem("badNonce", http.StatusBadRequest, "invalid or reused nonce")
+	}
+	return req, nil
+}
+
+func (s *Server) newAccount(w http.ResponseWriter, req *request, base string) {
+	if req.account != nil {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "new accounts must be requested with a jwk"))
+		return
+	}
+	var payload struct {
+		Contact              []string        `json:"contact"`
+		TermsOfServiceAgreed bool            `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool            `json:"onlyReturnExisting"`
+		ExternalAccount      json.RawMessage `json:"externalAccountBinding"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "invalid account request: %v", err))
+		return
+	}
+	if prob := checkContacts(payload.Contact); prob != nil {
+		writeProblem(w, prob)
+		return
+	}
+	tp, err := thumbprint(req.key)
+	if err != nil {
+		writeProblem(w, newProblem("badPublicKey", http.StatusBadRequest, "%v", err))
+		return
+	}
+
+	s.mu.Lock()
+	acct, exists := s.byKey[tp]
+	if !exists && !payload.OnlyReturnExisting {
+		acct = &account{ID: newID(), Status: statusValid, Contact: payload.Contact, Key: req.key, Thumbprint: tp}
+		s.accounts[acct.ID] = acct
+		s.byKey[tp] = acct
+	}
+	s.mu.Unlock()
+
+	switch {
+	case acct == nil:
+		writeProblem(w, newProblem("accountDoesNotExist", http.StatusBadRequest, "no account exists with this key"))
+		return
+	case exists && acct.Status != statusValid:
+		writeProblem(w, newProblem("unauthorized", http.StatusUnauthorized, "account is %s", acct.Status))
+		return
+	}
+
+	w.Header().Set("Location", base+"account/"+acct.ID)
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+		log.Infof("acme: created account %s", acct.ID)
+	}
+	writeJSON(w, status, s.accountJSON(acct, base))
+}
+
+// checkContacts accepts the mailto: contacts of an account.
+func checkContacts(contacts []string) *problem {
+	for _, contact := range contacts {
+		if !strings.HasPrefix(contact, "mailto:") || len(contact) == len("mailto:") {
+			return newProblem("unsupportedContact", http.StatusBadRequest, "unsupported contact %q", contact)
+		}
+	}
+	return nil
+}
+
+func (s *Server) accountJSON(acct *account, base string) interface{} {
+	return map[string]interface{}{
+		"status":  acct.Status,
+		"contact": acct.Contact,
+		"orders":  base + "account/" + acct.ID + "/orders",
+	}
+}
+
+func (s *Server) updateAccount(w http.ResponseWriter, req *request, base, id string) {
+	acct := req.account
+	if id != acct.ID {
+		writeProblem(w, newProblem("unauthorized", http.StatusUnauthorized, "requests can only update their own account"))
+		return
+	}
+	if !req.postAsGet() {
+		var payload struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		if err := json.Unmarshal(req.payload, &payload); err != nil {
+			writeProblem(w, newProblem("malformed", http.StatusBadRequest, "invalid account update: %v", err))
+			return
+		}
+		if payload.Status != "" && payload.Status != statusDeactivated {
+			writeProblem(w, newProblem("malformed", http.StatusBadRequest, "accounts can only be deactivated"))
+			return
+		}
+		if prob := checkContacts(payload.Contact); prob != nil {
+			writeProblem(w, prob)
+			return
+		}
+		s.mu.Lock()
+		if payload.Contact != nil {
+			acct.Contact = payload.Contact
+		}
+		if payload.Status == statusDeactivated {
+			acct.Status = statusDeactivated
+		}
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.accountJSON(acct, base))
+}
+
+func (s *Server) accountOrders(w http.ResponseWriter, req *request, base, id string) {
+	if id != req.account.ID {
+		writeProblem(w, newProblem("unauthorized", http.StatusUnauthorized, "requests can only list their own orders"))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := []string{}
+	for _, id := range req.account.Orders {
+		if o, ok := s.orders[id]; ok {
+			urls = append(urls, base+"order/"+o.ID)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"orders": urls})
+}
+
+// pruneExpired forgets the orders, and their authorizations, that
+// expired a while ago. The caller must hold s.mu.
+func (s *Server) pruneExpired(now time.Time) {
+	for id, o := range s.orders {
+		if now.Sub(o.Expires) < orderLifetime {
+			continue
+		}
+		delete(s.orders, id)
+		for _, authz := range o.Authorizations {
+			delete(s.authzs, authz.ID)
+			for _, chall := range authz.Challenges {
+				delete(s.challenges, chall.ID)
+			}
+		}
+		if acct, ok := s.accounts[o.Account]; ok {
+			for i, orderID := range acct.Orders {
+				if orderID == id {
+					acct.Orders = append(acct.Orders[:i], acct.Orders[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, req *request, base string) {
+	var payload struct {
+		Identifiers []identifier `json:"identifiers"`
+		NotBefore   time.Time    `json:"notBefore"`
+		NotAfter    time.Time    `json:"notAfter"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "invalid order: %v", err))
+		return
+	}
+	if len(payload.Identifiers) == 0 {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "an order needs at least one identifier"))
+		return
+	}
+	// Clients could otherwise get certificates valid for any period,
+	// whatever the expiry of the profile.
+	if !payload.NotBefore.IsZero() || !payload.NotAfter.IsZero() {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest,
+			"notBefore and notAfter are not supported: the validity of certificates is set by the server"))
+		return
+	}
+
+	now := time.Now()
+	o := &order{
+		ID:      newID(),
+		Account: req.account.ID,
+		Status:  statusPending,
+		Expires: now.Add(orderLifetime),
+	}
+	seen := map[string]bool{}
+	for _, id := range payload.Identifiers {
+		value, err := checkIdentifier(id)
+		if err != nil {
+			writeProblem(w, newProblem("rejectedIdentifier", http.StatusBadRequest, "%v", err))
+			return
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		o.Identifiers = append(o.Identifiers, identifier{Type: "dns", Value: value})
+
+		authz := &authorization{
+			ID:         newID(),
+			Account:    req.account.ID,
+			Identifier: identifier{Type: "dns", Value: strings.TrimPrefix(value, "*.")},
+			Wildcard:   strings.HasPrefix(value, "*."),
+			Status:     statusPending,
+			Expires:    o.Expires,
+		}
+		types := []string{"http-01", "dns-01"}
+		if authz.Wildcard {
+			// Wildcard names can only be proved with DNS (RFC 8555
+			// section 7.1.3).
+			types = types[1:]
+		}
+		for _, typ := range types {
+			authz.Challenges = append(authz.Challenges, &challenge{
+				ID:     newID(),
+				Type:   typ,
+				Token:  b64.EncodeToString([]byte(newID())),
+				Status: statusPending,
+				authz:  authz,
+			})
+		}
+		o.Authorizations = append(o.Authorizations, authz)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneExpired(now)
+	s.orders[o.ID] = o
+	req.account.Orders = append(req.account.Orders, o.ID)
+	for _, authz := range o.Authorizations {
+		s.authzs[authz.ID] = authz
+		for _, chall := range authz.Challenges {
+			s.challenges[chall.ID] = chall
+		}
+	}
+
+	w.Header().Set("Location", base+"order/"+o.ID)
+	writeJSON(w, http.StatusCreated, s.orderJSON(o, base))
+}
+
+// checkIdentifier returns the normalized value of a DNS identifier,
+// which may be a wildcard name.
+func checkIdentifier(id identifier) (string, error) {
+	if id.Type != "dns" {
+		return "", fmt.Errorf("unsupported identifier type %q", id.Type)
+	}
+	value := strings.ToLower(strings.TrimSuffix(id.Value, "."))
+	name := strings.TrimPrefix(value, "*.")
+	labels := strings.Split(name, ".")
+	if len(value) > 253 || len(labels) < 2 {
+		return "", fmt.Errorf("invalid DNS name %q", id.Value)
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' ||
+			strings.Trim(label, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return "", fmt.Errorf("invalid DNS name %q", id.Value)
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", fmt.Errorf("invalid DNS name %q", id.Value)
+	}
+	return value, nil
+}
+
+// updateStatus moves a pending order to ready once all its
+// authorizations are valid, or to invalid if one of them failed or it
+// expired. The caller must hold s.mu.
+func (o *order) updateStatus(now time.Time) {
+	if o.Status != statusPending && o.Status != statusReady {
+		return
+	}
+	if now.After(o.Expires) {
+		o.Status = statusInvalid
+		return
+	}
+	ready := true
+	for _, authz := range o.Authorizations {
+		switch authz.Status {
+		case statusInvalid, statusDeactivated:
+			o.Status = statusInvalid
+			return
+		case statusValid:
+		default:
+			ready = false
+		}
+	}
+	if ready {
+		o.Status = statusReady
+	}
+}
+
+func (s *Server) orderJSON(o *order, base string) interface{} {
+	o.updateStatus(time.Now())
+	var authzs []string
+	for _, authz := range o.Authorizations {
+		authzs = append(authzs, base+"authz/"+authz.ID)
+	}
+	res := map[string]interface{}{
+		"status":         o.Status,
+		"expires":        o.Expires.UTC().Format(time.RFC3339),
+		"identifiers":    o.Identifiers,
+		"authorizations": authzs,
+		"finalize":       base + "order/" + o.ID + "/finalize",
+	}
+	if o.Certificate != nil {
+		res["certificate"] = base + "cert/" + o.ID
+	}
+	if o.Error != nil {
+		res["error"] = o.Error
+	}
+	return res
+}
+
+// lookupOrder returns the order id of the account of req, writing a
+// problem if there is none.
+func (s *Server) lookupOrder(w http.ResponseWriter, req *request, id string) *order {
+	o, ok := s.orders[id]
+	if !ok || o.Account != req.account.ID {
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "no such order"))
+		return nil
+	}
+	return o
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, req *request, base, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.lookupOrder(w, req, id); o != nil {
+		writeJSON(w, http.StatusOK, s.orderJSON(o, base))
+	}
+}
+
+func (s *Server) authzJSON(authz *authorization, base string) interface{} {
+	if authz.Status == statusPending && time.Now().After(authz.Expires) {
+		authz.Status = statusInvalid
+	}
+	var challs []interface{}
+	for _, chall := range authz.Challenges {
+		challs = append(challs, challengeJSON(chall, base))
+	}
+	res := map[string]interface{}{
+		"status":     authz.Status,
+		"expires":    authz.Expires.UTC().Format(time.RFC3339),
+		"identifier": authz.Identifier,
+		"challenges": challs,
+	}
+	if authz.Wildcard {
+		res["wildcard"] = true
+	}
+	return res
+}
+
+func challengeJSON(chall *challenge, base string) interface{} {
+	res := map[string]interface{}{
+		"type":   chall.Type,
+		"url":    base + "chall/" + chall.ID,
+		"token":  chall.Token,
+		"status": chall.Status,
+	}
+	if !chall.Validated.IsZero() {
+		res["validated"] = chall.Validated.UTC().Format(time.RFC3339)
+	}
+	if chall.Error != nil {
+		res["error"] = chall.Error
+	}
+	return res
+}
+
+func (s *Server) getAuthorization(w http.ResponseWriter, req *request, base, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	authz, ok := s.authzs[id]
+	if !ok || authz.Account != req.account.ID {
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "no such authorization"))
+		return
+	}
+	if !req.postAsGet() {
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(req.payload, &payload); err != nil || payload.Status != statusDeactivated {
+			writeProblem(w, newProblem("malformed", http.StatusBadRequest, "authorizations can only be deactivated"))
+			return
+		}
+		if authz.Status == statusPending || authz.Status == statusValid {
+			authz.Status = statusDeactivated
+		}
+	}
+	writeJSON(w, http.StatusOK, s.authzJSON(authz, base))
+}
+
+func (s *Server) respondChallenge(w http.ResponseWriter, req *request, base, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chall, ok := s.challenges[id]
+	if !ok || chall.authz.Account != req.account.ID {
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "no such challenge"))
+		return
+	}
+	// An empty object asks for the challenge to be validated, and an
+	// empty payload only fetches it.
+	if !req.postAsGet() && chall.Status == statusPending && chall.authz.Status == statusPending {
+		chall.Status = statusProcessing
+		go s.validate(chall, keyAuthorization(chall.Token, req.account.Thumbprint))
+	}
+	w.Header().Add("Link", fmt.Sprintf("<%sauthz/%s>;rel=\"up\"", base, chall.authz.ID))
+	writeJSON(w, http.StatusOK, challengeJSON(chall, base))
+}
+
+func (s *Server) getCertificate(w http.ResponseWriter, req *request, id string) {
+	s.mu.Lock()
+	var chain []byte
+	o := s.lookupOrder(w, req, id)
+	if o != nil {
+		chain = o.Certificate
+	}
+	s.mu.Unlock()
+	if o == nil {
+		return
+	}
+	if chain == nil {
+		writeProblem(w, newProblem("malformed", http.StatusNotFound, "the order has no certificate"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chain)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("acme: failed to write response: %v", err)
+	}
+}
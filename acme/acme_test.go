@@ -0,0 +1,448 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+)
+
+// newTestSigner returns a local signer with a fresh self-signed CA.
+func newTestSigner(t *testing.T) signer.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ACME test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig([]byte(`{"signing": {"default": {"usages": ["digital signature", "server auth"], "expiry": "1h"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := local.NewSigner(key, ca, signer.DefaultSigAlgo(key), cfg.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// A testClient is a minimal ACME client.
+type testClient struct {
+	t     *testing.T
+	base  string
+	key   *ecdsa.PrivateKey
+	kid   string
+	nonce string
+}
+
+// post sends a request signed by the account key, with its JWK if the
+// client has no account yet. A nil payload makes a POST-as-GET request.
+func (c *testClient) post(url string, payload interface{}) (*http.Response, []byte) {
+	if c.nonce == "" {
+		resp, err := http.Head(c.base + "new-nonce")
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		resp.Body.Close()
+		c.nonce = resp.Header.Get("Replay-Nonce")
+	}
+
+	header := map[string]interface{}{"alg": "ES256", "nonce": c.nonce, "url": url}
+	if c.kid != "" {
+		header["kid"] = c.kid
+	} else {
+		header["jwk"] = jsonWebKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64.EncodeToString(padded(c.key.X, 32)),
+			Y:   b64.EncodeToString(padded(c.key.Y, 32)),
+		}
+	}
+	protected, err := json.Marshal(header)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var encodedPayload string
+	if payload != nil {
+		p, err := json.Marshal(payload)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		encodedPayload = b64.EncodeToString(p)
+	}
+	msg := jwsMessage{Protected: b64.EncodeToString(protected), Payload: encodedPayload}
+	digest := sha256.Sum256([]byte(msg.Protected + "." + msg.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg.Signature = b64.EncodeToString(append(padded(r, 32), padded(s, 32)...))
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	resp, err := http.Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.nonce = resp.Header.Get("Replay-Nonce")
+	return resp, respBody
+}
+
+// postJSON posts and decodes the response, failing unless it has the
+// expected status.
+func (c *testClient) postJSON(url string, payload interface{}, status int, v interface{}) *http.Response {
+	resp, body := c.post(url, payload)
+	if resp.StatusCode != status {
+		c.t.Fatalf("POST %s: expected status %d, got %d: %s", url, status, resp.StatusCode, body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			c.t.Fatalf("POST %s: %v", url, err)
+		}
+	}
+	return resp
+}
+
+// expectProblem posts and checks the ACME error type of the response.
+func (c *testClient) expectProblem(url string, payload interface{}, kind string) {
+	resp, body := c.post(url, payload)
+	var prob problem
+	if err := json.Unmarshal(body, &prob); err != nil || prob.Type != "urn:ietf:params:acme:error:"+kind {
+		c.t.Fatalf("POST %s: expected a %s problem, got status %d: %s", url, kind, resp.StatusCode, body)
+	}
+}
+
+type testOrder struct {
+	Status         string       `json:"status"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate"`
+}
+
+type testAuthz struct {
+	Status     string     `json:"status"`
+	Identifier identifier `json:"identifier"`
+	Wildcard   bool       `json:"wildcard"`
+	Challenges []struct {
+		Type   string `json:"type"`
+		URL    string `json:"url"`
+		Token  string `json:"token"`
+		Status string `json:"status"`
+	} `json:"challenges"`
+}
+
+func newCSR(t *testing.T, names ...string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// newTestServer returns an ACME server in front of a fresh test signer.
+func newTestServer(t *testing.T) *Server {
+	srv, err := NewServer(newTestSigner(t), "", "/acme/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func TestNewServerProfile(t *testing.T) {
+	s := newTestSigner(t)
+	cfg, err := config.LoadConfig([]byte(`{
+		"signing": {
+			"profiles": {
+				"authenticated": {"usages": ["server auth"], "expiry": "1h", "auth_key": "key"},
+				"ca": {"usages": ["cert sign"], "expiry": "1h", "ca_constraint": {"is_ca": true}}
+			},
+			"default": {"usages": ["server auth"], "expiry": "1h"}
+		},
+		"auth_keys": {"key": {"type": "standard", "key": "0123456789ABCDEF0123456789ABCDEF"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPolicy(cfg.Signing)
+
+	if _, err = NewServer(s, "", "/acme/"); err != nil {
+		t.Fatalf("expected the default profile to be accepted: %v", err)
+	}
+	for _, profile := range []string{"authenticated", "ca"} {
+		if _, err = NewServer(s, profile, "/acme/"); err == nil {
+			t.Errorf("expected the %s profile to be refused", profile)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	var via []*http.Request
+	for _, test := range []struct {
+		url string
+		ok  bool
+	}{
+		{"http://www.example.com/.well-known/acme-challenge/token", true},
+		{"https://www.example.com/.well-known/acme-challenge/token", true},
+		{"https://www.example.com:443/token", true},
+		{"http://www.example.com:80/token", true},
+		{"http://www.example.com:8080/token", false},
+		{"https://10.0.0.1:22/token", false},
+		{"ftp://www.example.com/token", false},
+	} {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if err := checkRedirect(req, via); (err == nil) != test.ok {
+			t.Errorf("%s: unexpected outcome %v", test.url, err)
+		}
+		via = append(via, req)
+	}
+
+	req := httptest.NewRequest("GET", "http://www.example.com/token", nil)
+	if err := checkRedirect(req, make([]*http.Request, maxRedirects)); err == nil {
+		t.Error("expected a redirect past the limit to be refused")
+	}
+}
+
+func TestIssuance(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// The http-01 challenges are answered by a server every name
+	// resolves to, and the dns-01 ones by a fake resolver.
+	httpTokens := map[string]string{}
+	challengeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(httpTokens[strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")]))
+	}))
+	defer challengeServer.Close()
+	_, port, _ := net.SplitHostPort(challengeServer.Listener.Addr().String())
+	srv.httpPort, _ = net.LookupPort("tcp", port)
+	srv.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, challengeServer.Listener.Addr().String())
+		},
+	}}
+	txtRecords := map[string][]string{}
+	srv.lookupTXT = func(name string) ([]string, error) {
+		if records, ok := txtRecords[name]; ok {
+			return records, nil
+		}
+		return nil, errors.New("no such name")
+	}
+
+	resp, err := http.Get(ts.URL + "/acme/directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var directory map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&directory)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := ts.URL + "/acme/"
+	if directory["newAccount"] != base+"new-account" || directory["newOrder"] != base+"new-order" {
+		t.Fatalf("unexpected directory %v", directory)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &testClient{t: t, base: base, key: key}
+	client.expectProblem(directory["newAccount"], map[string]interface{}{"onlyReturnExisting": true}, "accountDoesNotExist")
+	resp = client.postJSON(directory["newAccount"], map[string]interface{}{
+		"termsOfServiceAgreed": true,
+		"contact":              []string{"mailto:admin@example.com"},
+	}, http.StatusCreated, nil)
+	client.kid = resp.Header.Get("Location")
+	if !strings.HasPrefix(client.kid, base+"account/") {
+		t.Fatalf("unexpected account URL %q", client.kid)
+	}
+	// A nonce can only be used once.
+	nonce := client.nonce
+	client.postJSON(client.kid, nil, http.StatusOK, nil)
+	client.nonce = nonce
+	client.expectProblem(client.kid, nil, "badNonce")
+
+	client.expectProblem(directory["newOrder"], map[string]interface{}{
+		"identifiers": []identifier{{Type: "dns", Value: "not a name"}},
+	}, "rejectedIdentifier")
+	// The validity of the certificates comes from the signing profile.
+	client.expectProblem(directory["newOrder"], map[string]interface{}{
+		"identifiers": []identifier{{Type: "dns", Value: "www.example.com"}},
+		"notAfter":    time.Now().Add(100 * 365 * 24 * time.Hour).Format(time.RFC3339),
+	}, "malformed")
+
+	var o testOrder
+	resp = client.postJSON(directory["newOrder"], map[string]interface{}{
+		"identifiers": []identifier{{Type: "dns", Value: "www.example.com"}, {Type: "dns", Value: "*.example.com"}},
+	}, http.StatusCreated, &o)
+	orderURL := resp.Header.Get("Location")
+	if o.Status != statusPending || len(o.Authorizations) != 2 {
+		t.Fatalf("unexpected order %+v", o)
+	}
+	client.expectProblem(o.Finalize, map[string]string{"csr": b64.EncodeToString(newCSR(t, "www.example.com", "*.example.com"))}, "orderNotReady")
+
+	thumb, err := thumbprint(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, authzURL := range o.Authorizations {
+		var authz testAuthz
+		client.postJSON(authzURL, nil, http.StatusOK, &authz)
+		want := "http-01"
+		if authz.Wildcard {
+			want = "dns-01"
+			if len(authz.Challenges) != 1 {
+				t.Fatalf("expected wildcard names to only offer dns-01, got %+v", authz.Challenges)
+			}
+		}
+		for _, chall := range authz.Challenges {
+			if chall.Type != want {
+				continue
+			}
+			keyAuth := keyAuthorization(chall.Token, thumb)
+			if want == "http-01" {
+				httpTokens[chall.Token] = keyAuth
+			} else {
+				digest := sha256.Sum256([]byte(keyAuth))
+				txtRecords["_acme-challenge."+authz.Identifier.Value] = []string{b64.EncodeToString(digest[:])}
+			}
+			client.postJSON(chall.URL, map[string]interface{}{}, http.StatusOK, nil)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for o.Status != statusReady {
+		if o.Status != statusPending || time.Now().After(deadline) {
+			t.Fatalf("expected the order to become ready, got %+v", o)
+		}
+		time.Sleep(10 * time.Millisecond)
+		client.postJSON(orderURL, nil, http.StatusOK, &o)
+	}
+
+	client.expectProblem(o.Finalize, map[string]string{"csr": b64.EncodeToString(newCSR(t, "www.example.com"))}, "badCSR")
+	client.postJSON(o.Finalize, map[string]string{"csr": b64.EncodeToString(newCSR(t, "www.example.com", "*.example.com"))}, http.StatusOK, &o)
+	if o.Status != statusValid || o.Certificate == "" {
+		t.Fatalf("expected the order to be valid, got %+v", o)
+	}
+
+	resp, body := client.post(o.Certificate, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/pem-certificate-chain" {
+		t.Fatalf("unexpected certificate response %d: %s", resp.StatusCode, body)
+	}
+	chain, err := helpers.ParseCertificatesPEM(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected the certificate and the CA, got %d certificates", len(chain))
+	}
+	names := chain[0].DNSNames
+	sort.Strings(names)
+	if strings.Join(names, ",") != "*.example.com,www.example.com" {
+		t.Fatalf("unexpected certificate names %v", names)
+	}
+	if err = chain[0].CheckSignatureFrom(chain[1]); err != nil {
+		t.Fatalf("expected the certificate to be signed by the CA: %v", err)
+	}
+
+	// Another account can't see the order.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &testClient{t: t, base: base, key: otherKey}
+	resp = other.postJSON(directory["newAccount"], map[string]interface{}{"termsOfServiceAgreed": true}, http.StatusCreated, nil)
+	other.kid = resp.Header.Get("Location")
+	resp, _ = other.post(orderURL, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected another account's order to be hidden, got status %d", resp.StatusCode)
+	}
+}
+
+func TestFailedChallenge(t *testing.T) {
+	srv := newTestServer(t)
+	srv.lookupTXT = func(name string) ([]string, error) {
+		return []string{"wrong"}, nil
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := ts.URL + "/acme/"
+	client := &testClient{t: t, base: base, key: key}
+	resp := client.postJSON(base+"new-account", map[string]interface{}{"termsOfServiceAgreed": true}, http.StatusCreated, nil)
+	client.kid = resp.Header.Get("Location")
+
+	var o testOrder
+	resp = client.postJSON(base+"new-order", map[string]interface{}{
+		"identifiers": []identifier{{Type: "dns", Value: "*.example.com"}},
+	}, http.StatusCreated, &o)
+	orderURL := resp.Header.Get("Location")
+	var authz testAuthz
+	client.postJSON(o.Authorizations[0], nil, http.StatusOK, &authz)
+	client.postJSON(authz.Challenges[0].URL, map[string]interface{}{}, http.StatusOK, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for o.Status == statusPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		client.postJSON(orderURL, nil, http.StatusOK, &o)
+	}
+	if o.Status != statusInvalid {
+		t.Fatalf("expected the order to be invalid, got %+v", o)
+	}
+}
@@ -0,0 +1,127 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/info"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// AccountLabel is the certdb label under which the ID of the ACME account
+// that ordered a certificate is recorded.
+const AccountLabel = "acme_account"
+
+// csrNames returns the sorted, deduplicated names a CSR asks for, or a
+// problem if it asks for anything but DNS names.
+func csrNames(csr *x509.CertificateRequest) ([]string, *problem) {
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, newProblem("badCSR", http.StatusBadRequest, "the CSR may only ask for DNS names")
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range append([]string{csr.Subject.CommonName}, csr.DNSNames...) {
+		name = strings.ToLower(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Server) finalize(w http.ResponseWriter, req *request, base, id string) {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, newProblem("malformed", http.StatusBadRequest, "invalid finalize request: %v", err))
+		return
+	}
+	der, err := b64.DecodeString(payload.CSR)
+	if err != nil {
+		writeProblem(w, newProblem("badCSR", http.StatusBadRequest, "invalid CSR encoding: %v", err))
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		writeProblem(w, newProblem("badCSR", http.StatusBadRequest, "invalid CSR: %v", err))
+		return
+	}
+	names, prob := csrNames(csr)
+	if prob != nil {
+		writeProblem(w, prob)
+		return
+	}
+
+	s.mu.Lock()
+	o := s.lookupOrder(w, req, id)
+	if o == nil {
+		s.mu.Unlock()
+		return
+	}
+	o.updateStatus(time.Now())
+	if o.Status != statusReady {
+		s.mu.Unlock()
+		writeProblem(w, newProblem("orderNotReady", http.StatusForbidden, "the order is %s", o.Status))
+		return
+	}
+	var hosts []string
+	for _, id := range o.Identifiers {
+		hosts = append(hosts, id.Value)
+	}
+	sort.Strings(hosts)
+	if strings.Join(hosts, ",") != strings.Join(names, ",") {
+		s.mu.Unlock()
+		writeProblem(w, newProblem("badCSR", http.StatusBadRequest, "the CSR must ask for exactly the identifiers of the order"))
+		return
+	}
+	o.Status = statusProcessing
+	s.mu.Unlock()
+
+	cert, err := s.signer.Sign(signer.SignRequest{
+		Request: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})),
+		Hosts:   hosts,
+		Profile: s.profile,
+		Labels:  map[string]string{AccountLabel: req.account.ID},
+	})
+	if err != nil {
+		log.Errorf("acme: failed to sign the certificate of order %s: %v", id, err)
+		s.mu.Lock()
+		o.Status = statusInvalid
+		o.Error = newProblem("serverInternal", http.StatusInternalServerError, "failed to sign the certificate")
+		s.mu.Unlock()
+		writeProblem(w, newProblem("serverInternal", http.StatusInternalServerError, "failed to sign the certificate"))
+		return
+	}
+
+	// The chain served to the client carries the CA certificate after
+	// the certificate.
+	chain := append([]byte{}, cert...)
+	if resp, err := s.signer.Info(info.Req{Profile: s.profile}); err != nil {
+		log.Warningf("acme: failed to get the CA certificate: %v", err)
+	} else if resp.Certificate != "" {
+		chain = append(chain, resp.Certificate...)
+		if !strings.HasSuffix(resp.Certificate, "\n") {
+			chain = append(chain, '\n')
+		}
+	}
+	log.Infof("acme: issued the certificate of order %s for %s", id, strings.Join(hosts, ", "))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o.Certificate = chain
+	o.Status = statusValid
+	w.Header().Set("Location", base+"order/"+o.ID)
+	writeJSON(w, http.StatusOK, s.orderJSON(o, base))
+}
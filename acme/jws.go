@@ -0,0 +1,206 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// b64 is the unpadded base64url encoding JOSE uses throughout.
+var b64 = base64.RawURLEncoding
+
+// A jsonWebKey is a public key as a JSON Web Key (RFC 7517). Only the
+// RSA and EC keys ACME clients sign their requests with are supported.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// curves maps the JWK names of the supported curves to the curves.
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// publicKey decodes the key.
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %v", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %v", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits long")
+		}
+		return pub, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC point: %v", err)
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC point: %v", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// thumbprint returns the JWK thumbprint (RFC 7638) of pub, which
+// identifies an account key and makes up the key authorizations of its
+// challenges.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	var canonical string
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()), b64.EncodeToString(pub.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			pub.Curve.Params().Name, b64.EncodeToString(padded(pub.X, size)), b64.EncodeToString(padded(pub.Y, size)))
+	default:
+		return "", errors.New("unsupported key type")
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64.EncodeToString(sum[:]), nil
+}
+
+// padded returns the big-endian encoding of n on size bytes.
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// A jwsMessage is a JWS in the flattened JSON serialization, the only
+// one ACME allows (RFC 8555 section 6.2).
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// A jwsHeader is the protected header of an ACME request. It carries
+// either the JWK of the signing key, for new accounts, or the account
+// URL as the key ID.
+type jwsHeader struct {
+	Alg   string      `json:"alg"`
+	Nonce string      `json:"nonce"`
+	URL   string      `json:"url"`
+	JWK   *jsonWebKey `json:"jwk"`
+	KID   string      `json:"kid"`
+}
+
+// parseJWS decodes a JWS without verifying its signature, which needs
+// the key the header points to.
+func parseJWS(body []byte) (*jwsMessage, *jwsHeader, []byte, error) {
+	var msg jwsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, nil, nil, fmt.Errorf("request is not a flattened JWS: %v", err)
+	}
+	protected, err := b64.DecodeString(msg.Protected)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid protected header encoding: %v", err)
+	}
+	var header jwsHeader
+	if err = json.Unmarshal(protected, &header); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid protected header: %v", err)
+	}
+	if (header.JWK == nil) == (header.KID == "") {
+		return nil, nil, nil, errors.New("protected header must carry exactly one of jwk and kid")
+	}
+	payload, err := b64.DecodeString(msg.Payload)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid payload encoding: %v", err)
+	}
+	return &msg, &header, payload, nil
+}
+
+// An algorithmError reports a signature algorithm that is unsupported or
+// doesn't match the key.
+type algorithmError string
+
+func (e algorithmError) Error() string {
+	return string(e)
+}
+
+// verify checks the signature of msg with pub under the algorithm alg.
+func (msg *jwsMessage) verify(alg string, pub crypto.PublicKey) error {
+	sig, err := b64.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	signed := []byte(msg.Protected + "." + msg.Payload)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == "ES256" && pub.Curve == elliptic.P256():
+			sum := sha256.Sum256(signed)
+			digest = sum[:]
+		case alg == "ES384" && pub.Curve == elliptic.P384():
+			sum := sha512.Sum384(signed)
+			digest = sum[:]
+		case alg == "ES512" && pub.Curve == elliptic.P521():
+			sum := sha512.Sum512(signed)
+			digest = sum[:]
+		default:
+			return algorithmError(fmt.Sprintf("algorithm %q does not match the key", alg))
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return algorithmError(fmt.Sprintf("unsupported algorithm %q", alg))
+}
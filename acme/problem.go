@@ -0,0 +1,35 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A problem is an ACME error, as a problem document (RFC 7807) whose type
+// is one of the ACME error types of RFC 8555 section 6.7.
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status,omitempty"`
+}
+
+// newProblem returns a problem of the ACME error type kind, such as
+// "malformed", answered with the HTTP status.
+func newProblem(kind string, status int, format string, args ...interface{}) *problem {
+	return &problem{
+		Type:   "urn:ietf:params:acme:error:" + kind,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, prob *problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(prob.Status)
+	if err := json.NewEncoder(w).Encode(prob); err != nil {
+		log.Errorf("acme: failed to write problem: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package acme
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+)
+
+// keyAuthorization returns the key authorization of a challenge token
+// for the account key with the given thumbprint (RFC 8555 section 8.1).
+func keyAuthorization(token, thumbprint string) string {
+	return token + "." + thumbprint
+}
+
+func defaultLookupTXT(name string) ([]string, error) {
+	return net.LookupTXT(name)
+}
+
+// validate checks that the client fulfilled chall, and updates the
+// challenge and its authorization with the outcome.
+func (s *Server) validate(chall *challenge, keyAuth string) {
+	s.mu.Lock()
+	domain := chall.authz.Identifier.Value
+	s.mu.Unlock()
+
+	var err error
+	switch chall.Type {
+	case "http-01":
+		err = s.validateHTTP01(domain, chall.Token, keyAuth)
+	case "dns-01":
+		err = s.validateDNS01(domain, keyAuth)
+	default:
+		err = fmt.Errorf("unsupported challenge type %q", chall.Type)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Infof("acme: %s challenge for %s failed: %v", chall.Type, domain, err)
+		chall.Status = statusInvalid
+		chall.Error = newProblem("incorrectResponse", http.StatusForbidden, "%v", err)
+		if chall.authz.Status == statusPending {
+			chall.authz.Status = statusInvalid
+		}
+		return
+	}
+	log.Infof("acme: %s challenge for %s succeeded", chall.Type, domain)
+	chall.Status = statusValid
+	chall.Validated = time.Now()
+	if chall.authz.Status == statusPending {
+		chall.authz.Status = statusValid
+	}
+}
+
+// validateHTTP01 fetches the key authorization the client provisioned at
+// the well-known URL of the token on domain (RFC 8555 section 8.3).
+func (s *Server) validateHTTP01(domain, token, keyAuth string) error {
+	host := domain
+	if s.httpPort != 80 {
+		host = net.JoinHostPort(domain, strconv.Itoa(s.httpPort))
+	}
+	resp, err := s.client.Get("http://" + host + "/.well-known/acme-challenge/" + token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the challenge URL answered with status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return fmt.Errorf("the challenge URL does not hold the key authorization")
+	}
+	return nil
+}
+
+// maxRedirects bounds the redirects followed by an http-01 validation.
+const maxRedirects = 10
+
+// checkRedirect lets an http-01 validation follow redirects only to http
+// or https URLs on ports 80 and 443, as RFC 8555 section 8.3 expects,
+// and at most maxRedirects of them.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirected to the unsupported scheme %q", req.URL.Scheme)
+	}
+	switch req.URL.Port() {
+	case "", "80", "443":
+		return nil
+	}
+	return errors.New("redirected to a port other than 80 or 443")
+}
+
+// validateDNS01 looks up the digest of the key authorization in the TXT
+// records of the _acme-challenge name of domain (RFC 8555 section 8.4).
+func (s *Server) validateDNS01(domain, keyAuth string) error {
+	digest := sha256.Sum256([]byte(keyAuth))
+	want := b64.EncodeToString(digest[:])
+
+	name := "_acme-challenge." + domain
+	records, err := s.lookupTXT(name)
+	if err != nil {
+		return fmt.Errorf("failed to look up the TXT records of %s: %v", name, err)
+	}
+	for _, record := range records {
+		if record == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record of %s holds the key authorization digest", name)
+}
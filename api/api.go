@@ -39,7 +39,9 @@ func HandleError(w http.ResponseWriter, err error) (code int) {
 	if err == nil {
 		return http.StatusOK
 	}
-	msg := err.Error()
+	message := ErrorMessage(err)
+	msg := message.Message
+	code = message.Code
 	httpCode := http.StatusInternalServerError
 
 	// If it is recognized as HttpError emitted from cfssl,
@@ -48,14 +50,12 @@ func HandleError(w http.ResponseWriter, err error) (code int) {
 	switch err := err.(type) {
 	case *errors.HTTPError:
 		httpCode = err.StatusCode
-		code = err.StatusCode
 	case *errors.Error:
 		httpCode = http.StatusBadRequest
-		code = err.ErrorCode
-		msg = err.Message
 	}
 
 	response := NewErrorResponse(msg, code)
+	response.Errors[0].Class = message.Class
 	jsonMessage, err := json.Marshal(response)
 	if err != nil {
 		log.Errorf("Failed to marshal JSON: %v", err)
@@ -66,9 +66,49 @@ func HandleError(w http.ResponseWriter, err error) (code int) {
 	return code
 }
 
+// RequestIDHeader is the header carrying the ID of an API request. It is
+// optional in requests, and always set in responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the length above which the request ID given by a
+// client is replaced.
+const maxRequestIDLength = 128
+
+// RequestID returns the request ID of r: its RequestIDHeader if short and
+// printable, or else a generated one.
+func RequestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = log.NewRequestID()
+	}
+	return id
+}
+
+// WithRequestID sets the request ID of r in the RequestIDHeader of w, and
+// returns a copy of r whose context carries a logger adding it to all
+// the log lines about r.
+func WithRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := RequestID(r)
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(log.WithRequestID(r.Context(), id))
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
 // ServeHTTP encapsulates the call to underlying Handler to handle the request
 // and return the response with proper HTTP status code
 func (h HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = WithRequestID(w, r)
 	var err error
 	var match bool
 	// Throw 405 when requested with an unsupported verb.
@@ -83,7 +123,7 @@ func (h HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err = errors.NewMethodNotAllowed(r.Method)
 	}
 	status := HandleError(w, err)
-	log.Infof("%s - \"%s %s\" %d", r.RemoteAddr, r.Method, r.URL, status)
+	log.FromContext(r.Context()).Infof("%s - \"%s %s\" %d", r.RemoteAddr, r.Method, r.URL, status)
 }
 
 // readRequestBlob takes a JSON-blob-encoded response body in the form
@@ -161,10 +201,27 @@ func matchKeywords(blob map[string]string, keywords []string) bool {
 }
 
 // ResponseMessage implements the standard for response errors and
-// messages. A message has a code and a string message.
+// messages. A message has a code and a string message. Errors also carry
+// the class of the failure, one of the values of errors.Class.
 type ResponseMessage struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Class   int    `json:"class,omitempty"`
+}
+
+// ErrorMessage describes err like the error of an API response: with the
+// HTTP status of an HTTPError, or the code and message of a CFSSL error,
+// and the class of err.
+func ErrorMessage(err error) ResponseMessage {
+	msg := ResponseMessage{Message: err.Error(), Class: int(errors.ClassOf(err))}
+	switch err := err.(type) {
+	case *errors.HTTPError:
+		msg.Code = err.StatusCode
+	case *errors.Error:
+		msg.Code = err.ErrorCode
+		msg.Message = err.Message
+	}
+	return msg
 }
 
 // Response implements the CloudFlare standard for API
@@ -194,7 +251,7 @@ func NewSuccessResponseWithMessage(result interface{}, message string, code int)
 		Success:  true,
 		Result:   result,
 		Errors:   []ResponseMessage{},
-		Messages: []ResponseMessage{{code, message}},
+		Messages: []ResponseMessage{{Code: code, Message: message}},
 	}
 }
 
@@ -204,7 +261,7 @@ func NewErrorResponse(message string, code int) Response {
 	return Response{
 		Success:  false,
 		Result:   nil,
-		Errors:   []ResponseMessage{{code, message}},
+		Errors:   []ResponseMessage{{Code: code, Message: message}},
 		Messages: []ResponseMessage{},
 	}
 }
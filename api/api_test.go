@@ -3,10 +3,15 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	stderrors "errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
 )
 
 const (
@@ -218,3 +223,63 @@ func TestCleverHandle(t *testing.T) {
 		t.Errorf("Test expected 405, have %d", resp.StatusCode)
 	}
 }
+
+func TestRequestID(t *testing.T) {
+	var id string
+	ts := httptest.NewServer(HTTPHandler{Handler: HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		id = log.RequestID(r.Context())
+		return SendResponse(w, ty)
+	}), Methods: []string{"GET"}})
+	defer ts.Close()
+
+	resp, _ := get(t, ts)
+	if id == "" || resp.Header.Get(RequestIDHeader) != id {
+		t.Fatalf("generated request ID %q not returned, got %q", id, resp.Header.Get(RequestIDHeader))
+	}
+
+	for given, valid := range map[string]bool{"client-id-1": true, "bad id": false, strings.Repeat("a", maxRequestIDLength+1): false} {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(RequestIDHeader, given)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if (id == given) != valid || resp.Header.Get(RequestIDHeader) != id {
+			t.Errorf("request ID %q: got %q", given, id)
+		}
+	}
+}
+
+func TestHandleErrorClass(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+		code   int
+		class  errors.Class
+	}{
+		{errors.New(errors.PolicyError, errors.UnmatchedWhitelist), http.StatusBadRequest, 5500, errors.ClassPolicy},
+		{errors.New(errors.CSRError, errors.ParseFailed), http.StatusBadRequest, 9003, errors.ClassInput},
+		{errors.Wrap(errors.CertStoreError, errors.InsertionFailed, stderrors.New("database is locked")), http.StatusBadRequest, 11100, errors.ClassDB},
+		{errors.NewMethodNotAllowed("GET"), http.StatusMethodNotAllowed, http.StatusMethodNotAllowed, errors.ClassInput},
+		{stderrors.New("out of memory"), http.StatusInternalServerError, 0, errors.ClassUnknown},
+	} {
+		w := httptest.NewRecorder()
+		if code := HandleError(w, test.err); code != test.code {
+			t.Errorf("%v: expected code %d, got %d", test.err, test.code, code)
+		}
+		if w.Code != test.status {
+			t.Errorf("%v: expected status %d, got %d", test.err, test.status, w.Code)
+		}
+		var response Response
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Errors) != 1 || response.Errors[0].Code != test.code || response.Errors[0].Class != int(test.class) {
+			t.Errorf("%v: unexpected errors %+v", test.err, response.Errors)
+		}
+	}
+}
@@ -2,6 +2,9 @@
 package bundle
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/cloudflare/cfssl/api"
@@ -10,6 +13,16 @@ import (
 	"github.com/cloudflare/cfssl/log"
 )
 
+// ChainCacheSize is the number of resolved chains the handler keeps in
+// memory, so that bundling the same leaf certificate again doesn't
+// redo the AIA fetches and ubiquity computation.
+const ChainCacheSize = 1024
+
+// BatchContentType is the media type of the response to a batch
+// request streamed one result per line, as requested by the Accept
+// header.
+const BatchContentType = "application/x-ndjson"
+
 // Handler accepts requests for either remote or uploaded
 // certificates to be bundled, and returns a certificate bundle (or
 // error).
@@ -17,13 +30,25 @@ type Handler struct {
 	bundler *bundler.Bundler
 }
 
+// A BatchResult is the outcome of bundling one certificate of a batch
+// request. Index is the position of the certificate in the request,
+// starting at zero.
+type BatchResult struct {
+	Index  int                  `json:"index"`
+	Bundle *bundler.Bundle      `json:"bundle,omitempty"`
+	Error  *api.ResponseMessage `json:"error,omitempty"`
+}
+
 // NewHandler creates a new bundler that uses the root bundle and
-// intermediate bundle in the trust chain.
-func NewHandler(caBundleFile, intBundleFile string) (http.Handler, error) {
+// intermediate bundle in the trust chain. Resolved chains are cached
+// for up to ChainCacheSize leaf certificates, unless the bundler
+// options set another cache size.
+func NewHandler(caBundleFile, intBundleFile string, opt ...bundler.Option) (http.Handler, error) {
 	var err error
 
 	b := new(Handler)
-	if b.bundler, err = bundler.NewBundler(caBundleFile, intBundleFile); err != nil {
+	opt = append([]bundler.Option{bundler.WithChainCache(ChainCacheSize)}, opt...)
+	if b.bundler, err = bundler.NewBundler(caBundleFile, intBundleFile, opt...); err != nil {
 		return nil, err
 	}
 
@@ -32,37 +57,51 @@ func NewHandler(caBundleFile, intBundleFile string) (http.Handler, error) {
 }
 
 // Handle implements an http.Handler interface for the bundle handler.
+// Besides a single certificate or domain, a request may hold a batch
+// of PEM-encoded certificates in a "certificates" array.
 func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+
+	var batch struct {
+		Certificates []string `json:"certificates"`
+		Flavor       string   `json:"flavor"`
+	}
+	if json.Unmarshal(body, &batch) == nil && batch.Certificates != nil {
+		return h.handleBatch(w, r, batch.Certificates, batch.Flavor)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
 	blob, matched, err := api.ProcessRequestFirstMatchOf(r,
 		[][]string{
 			{"certificate"},
 			{"domain"},
 		})
 	if err != nil {
-		log.Warningf("invalid request: %v", err)
+		log.FromContext(r.Context()).Warningf("invalid request: %v", err)
 		return err
 	}
 
-	flavor := blob["flavor"]
-	bf := bundler.Ubiquitous
-	if flavor != "" {
-		bf = bundler.BundleFlavor(flavor)
+	bf, err := bundleFlavor(blob["flavor"])
+	if err != nil {
+		return err
 	}
-	log.Infof("request for flavor %v", bf)
 
 	var result *bundler.Bundle
 	switch matched[0] {
 	case "domain":
 		bundle, err := h.bundler.BundleFromRemote(blob["domain"], blob["ip"], bf)
 		if err != nil {
-			log.Warningf("couldn't bundle from remote: %v", err)
+			log.FromContext(r.Context()).Warningf("couldn't bundle from remote: %v", err)
 			return err
 		}
 		result = bundle
 	case "certificate":
-		bundle, err := h.bundler.BundleFromPEMorDER([]byte(blob["certificate"]), []byte(blob["private_key"]), bf, "")
+		bundle, err := h.bundleCertificate(blob["certificate"], blob["private_key"], bf)
 		if err != nil {
-			log.Warning("bad PEM certifcate or private key")
 			return err
 		}
 
@@ -86,6 +125,84 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 
 		result = bundle
 	}
-	log.Info("wrote response")
+	log.FromContext(r.Context()).Info("wrote response")
 	return api.SendResponse(w, result)
 }
+
+// bundleFlavor parses the flavor of a request, ubiquitous by default.
+func bundleFlavor(flavor string) (bundler.BundleFlavor, error) {
+	bf := bundler.Ubiquitous
+	if flavor != "" {
+		bf = bundler.BundleFlavor(flavor)
+	}
+	switch bf {
+	case bundler.Ubiquitous, bundler.Optimal, bundler.Force:
+	default:
+		log.Warningf("invalid bundle flavor %q", flavor)
+		return "", errors.NewBadRequestString("flavor must be one of ubiquitous, optimal or force")
+	}
+	log.Infof("request for flavor %v", bf)
+	return bf, nil
+}
+
+func (h *Handler) bundleCertificate(cert, key string, bf bundler.BundleFlavor) (*bundler.Bundle, error) {
+	bundle, err := h.bundler.BundleFromPEMorDER([]byte(cert), []byte(key), bf, "")
+	if err != nil {
+		log.Warning("bad PEM certifcate or private key")
+	}
+	return bundle, err
+}
+
+// handleBatch bundles each of certs. The results are sent in the
+// result array of the response or, if the client accepts
+// BatchContentType, written one JSON object per line as soon as each
+// certificate is bundled. A certificate that fails to bundle doesn't
+// fail the others.
+func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request, certs []string, flavor string) error {
+	bf, err := bundleFlavor(flavor)
+	if err != nil {
+		return err
+	}
+
+	stream := r.Header.Get("Accept") == BatchContentType
+	var enc *json.Encoder
+	flusher, _ := w.(http.Flusher)
+	if stream {
+		w.Header().Set("Content-Type", BatchContentType)
+		enc = json.NewEncoder(w)
+	}
+
+	results := make([]BatchResult, 0, len(certs))
+	var failed int
+	for i, cert := range certs {
+		result := BatchResult{Index: i}
+		bundle, err := h.bundleCertificate(cert, "", bf)
+		if err != nil {
+			result.Error = batchError(err)
+			failed++
+		} else {
+			result.Bundle = bundle
+		}
+
+		if !stream {
+			results = append(results, result)
+		} else if err = enc.Encode(result); err != nil {
+			log.FromContext(r.Context()).Errorf("failed to write bundle result: %v", err)
+			return nil
+		} else if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	log.FromContext(r.Context()).Infof("bundled %d certificates, %d failed", len(certs)-failed, failed)
+
+	if stream {
+		return nil
+	}
+	return api.SendResponse(w, results)
+}
+
+// batchError describes err like the error of an API response.
+func batchError(err error) *api.ResponseMessage {
+	msg := api.ErrorMessage(err)
+	return &msg
+}
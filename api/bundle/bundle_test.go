@@ -2,13 +2,23 @@ package bundle
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/bundler"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/ubiquity"
 )
 
 const (
@@ -211,3 +221,216 @@ func TestBundle(t *testing.T) {
 		}
 	}
 }
+
+// testChainCA is a CA certificate and its key.
+type testChainCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testSerial int64
+
+// newTestChainCert issues a certificate for subject's key, signed by
+// issuer. A nil issuer makes the certificate self-signed.
+func newTestChainCert(t *testing.T, cn string, key *ecdsa.PrivateKey, issuer *testChainCA, isCA bool) *testChainCA {
+	testSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		SubjectKeyId:          []byte(cn),
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{cn}
+	}
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testChainCA{cert: cert, key: key}
+}
+
+func newTestChainKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestBundleFlavor(t *testing.T) {
+	// The intermediate is issued by a new root, which is also
+	// cross-signed by an old root. Optimal bundling picks the shorter
+	// chain to the new root; ubiquitous bundling picks the chain through
+	// the cross-signed certificate, as more platforms trust the old root.
+	oldRoot := newTestChainCert(t, "Old Root", newTestChainKey(t), nil, true)
+	newRoot := newTestChainCert(t, "New Root", newTestChainKey(t), nil, true)
+	cross := newTestChainCert(t, "New Root", newRoot.key, oldRoot, true)
+	inter := newTestChainCert(t, "Intermediate", newTestChainKey(t), newRoot, true)
+	leaf := newTestChainCert(t, "cfssl-leaf.com", newTestChainKey(t), inter, false)
+
+	caPEM := append(helpers.EncodeCertificatePEM(oldRoot.cert), helpers.EncodeCertificatePEM(newRoot.cert)...)
+	intPEM := append(helpers.EncodeCertificatePEM(inter.cert), helpers.EncodeCertificatePEM(cross.cert)...)
+	b, err := bundler.NewBundlerFromPEM(caPEM, intPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modern := ubiquity.Platform{Name: "Modern", Weight: 100, HashAlgo: "SHA2", KeyAlgo: "ECDSA256", KeyStore: ubiquity.CertSet{}}
+	modern.KeyStore.Add(oldRoot.cert)
+	modern.KeyStore.Add(newRoot.cert)
+	legacy := ubiquity.Platform{Name: "Legacy", Weight: 100, HashAlgo: "SHA2", KeyAlgo: "ECDSA256", KeyStore: ubiquity.CertSet{}}
+	legacy.KeyStore.Add(oldRoot.cert)
+	defer func(platforms []ubiquity.Platform) { ubiquity.Platforms = platforms }(ubiquity.Platforms)
+	ubiquity.Platforms = []ubiquity.Platform{modern, legacy}
+
+	ts := httptest.NewServer(api.HTTPHandler{Handler: &Handler{bundler: b}, Methods: []string{"POST"}})
+	defer ts.Close()
+
+	bundleWith := func(flavor string) (*http.Response, *api.Response) {
+		blob, err := json.Marshal(map[string]string{
+			"certificate": string(helpers.EncodeCertificatePEM(leaf.cert)),
+			"flavor":      flavor,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		message := new(api.Response)
+		if err := json.NewDecoder(resp.Body).Decode(message); err != nil {
+			t.Fatal(err)
+		}
+		return resp, message
+	}
+
+	tests := []struct {
+		flavor   string
+		chainLen int
+		root     *x509.Certificate
+	}{
+		{"optimal", 2, newRoot.cert},
+		{"ubiquitous", 3, oldRoot.cert},
+		{"", 3, oldRoot.cert},
+	}
+	for _, test := range tests {
+		resp, message := bundleWith(test.flavor)
+		if resp.StatusCode != http.StatusOK || !message.Success {
+			t.Fatalf("flavor %q: bundling failed: %v", test.flavor, message.Errors)
+		}
+		result := message.Result.(map[string]interface{})
+		chain, err := helpers.ParseCertificatesPEM([]byte(result["bundle"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain) != test.chainLen {
+			t.Errorf("flavor %q: chain has %d certificates, expected %d", test.flavor, len(chain), test.chainLen)
+		}
+		root, err := helpers.ParseCertificatePEM([]byte(result["root"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !root.Equal(test.root) {
+			t.Errorf("flavor %q: chain ends at %q, expected %q", test.flavor, root.Subject.CommonName, test.root.Subject.CommonName)
+		}
+	}
+
+	resp, message := bundleWith("shortest")
+	if resp.StatusCode != http.StatusBadRequest || message.Success {
+		t.Fatalf("expected an unknown flavor to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestBundleBatch(t *testing.T) {
+	root := newTestChainCert(t, "Batch Root", newTestChainKey(t), nil, true)
+	inter := newTestChainCert(t, "Batch Intermediate", newTestChainKey(t), root, true)
+	leaf := newTestChainCert(t, "cfssl-batch.com", newTestChainKey(t), inter, false)
+
+	b, err := bundler.NewBundlerFromPEM(helpers.EncodeCertificatePEM(root.cert), helpers.EncodeCertificatePEM(inter.cert),
+		bundler.WithChainCache(ChainCacheSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(api.HTTPHandler{Handler: &Handler{bundler: b}, Methods: []string{"POST"}})
+	defer ts.Close()
+
+	blob, err := json.Marshal(map[string]interface{}{
+		"certificates": []string{string(helpers.EncodeCertificatePEM(leaf.cert)), "not a certificate"},
+		"flavor":       "optimal",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var message struct {
+		Success bool
+		Result  []struct {
+			Index  int
+			Bundle map[string]interface{}
+			Error  *api.ResponseMessage
+		}
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !message.Success || len(message.Result) != 2 {
+		t.Fatalf("unexpected response %d: %+v", resp.StatusCode, message)
+	}
+	if r := message.Result[0]; r.Index != 0 || r.Error != nil || r.Bundle["root"] == nil {
+		t.Fatalf("expected the first certificate to be bundled, got %+v", r)
+	}
+	if r := message.Result[1]; r.Index != 1 || r.Error == nil || r.Bundle != nil {
+		t.Fatalf("expected the second certificate to fail, got %+v", r)
+	}
+
+	req, err := http.NewRequest("POST", ts.URL, bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", BatchContentType)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != BatchContentType {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	dec := json.NewDecoder(resp.Body)
+	for i := 0; i < 2; i++ {
+		var result struct {
+			Index int
+			Error *api.ResponseMessage
+		}
+		if err = dec.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Index != i || (i == 0) != (result.Error == nil) {
+			t.Fatalf("unexpected streamed result %+v", result)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package certificates implements the HTTP handler looking up the
+// certificates of the certdb by label.
+package certificates
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A Handler accepts requests with a set of labels and returns the
+// certificates carrying all of them.
+type Handler struct {
+	dbAccessor certdb.Accessor
+}
+
+// NewHandler returns a new http.Handler that looks up certificates by
+// label in the certdb.
+func NewHandler(dbAccessor certdb.Accessor) http.Handler {
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			dbAccessor: dbAccessor,
+		},
+		Methods: []string{"POST"},
+	}
+}
+
+// This type is meant to be unmarshalled from JSON
+type jsonCertificatesRequest struct {
+	Labels    map[string]string `json:"labels"`
+	Unexpired bool              `json:"unexpired"`
+}
+
+// Certificate describes a certificate recorded in the certdb.
+type Certificate struct {
+	Serial     string            `json:"serial_number"`
+	AKI        string            `json:"authority_key_id"`
+	CALabel    string            `json:"ca_label,omitempty"`
+	Status     string            `json:"status"`
+	Expiry     time.Time         `json:"expiry"`
+	RevokedAt  *time.Time        `json:"revoked_at,omitempty"`
+	CommonName string            `json:"common_name,omitempty"`
+	SANs       []string          `json:"sans,omitempty"`
+	Profile    string            `json:"profile,omitempty"`
+	Requester  string            `json:"requester,omitempty"`
+	Labels     map[string]string `json:"labels"`
+	PEM        string            `json:"pem"`
+}
+
+func newCertificate(cr certdb.CertificateRecord) Certificate {
+	c := Certificate{
+		Serial:     cr.Serial,
+		AKI:        cr.AKI,
+		CALabel:    cr.CALabel,
+		Status:     cr.Status,
+		Expiry:     cr.Expiry,
+		CommonName: cr.CommonName,
+		Profile:    cr.Profile,
+		Requester:  cr.Requester,
+		Labels:     cr.Labels,
+		PEM:        cr.PEM,
+	}
+	if cr.Status == "revoked" {
+		revokedAt := cr.RevokedAt
+		c.RevokedAt = &revokedAt
+	}
+	if cr.SANs != "" {
+		c.SANs = strings.Split(cr.SANs, ",")
+	}
+	return c
+}
+
+// Handle responds to requests for the certificates carrying the labels
+// given in the "labels" parameter, leaving out expired ones if the
+// "unexpired" parameter is set.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+
+	var req jsonCertificatesRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		return errors.NewBadRequestString("Unable to parse certificates request")
+	}
+
+	if len(req.Labels) == 0 {
+		return errors.NewBadRequestString("labels are required but not provided")
+	}
+	if err = certdb.ValidateLabels(req.Labels); err != nil {
+		return errors.NewBadRequest(err)
+	}
+
+	crs, err := h.dbAccessor.GetCertificatesByLabels(req.Labels)
+	if err != nil {
+		log.FromContext(r.Context()).Errorf("failed to look up certificates by label: %v", err)
+		return err
+	}
+
+	now := time.Now()
+	certs := []Certificate{}
+	for _, cr := range crs {
+		if req.Unexpired && !now.Before(cr.Expiry) {
+			continue
+		}
+		certs = append(certs, newCertificate(cr))
+	}
+
+	return api.SendResponse(w, map[string]interface{}{"certificates": certs})
+}
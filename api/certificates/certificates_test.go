@@ -0,0 +1,110 @@
+package certificates
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+)
+
+const fakeAKI = "fake aki"
+
+func prepDB(t *testing.T) certdb.Accessor {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	dbAccessor := sql.NewAccessor(db)
+
+	for _, cr := range []certdb.CertificateRecord{
+		{Serial: "1", Expiry: time.Now().AddDate(1, 0, 0), SANs: "example.com,www.example.com",
+			Labels: map[string]string{"team": "payments", "env": "prod"}},
+		{Serial: "2", Expiry: time.Now().AddDate(-1, 0, 0),
+			Labels: map[string]string{"team": "payments", "env": "prod"}},
+		{Serial: "3", Expiry: time.Now().AddDate(1, 0, 0),
+			Labels: map[string]string{"team": "payments", "env": "staging"}},
+	} {
+		cr.AKI, cr.Status, cr.PEM = fakeAKI, "good", "fake cert data"
+		if err := dbAccessor.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbAccessor
+}
+
+type certificatesResponse struct {
+	Success bool `json:"success"`
+	Result  struct {
+		Certificates []Certificate `json:"certificates"`
+	} `json:"result"`
+}
+
+func lookup(t *testing.T, dbAccessor certdb.Accessor, req interface{}) (int, certificatesResponse) {
+	ts := httptest.NewServer(NewHandler(dbAccessor))
+	defer ts.Close()
+
+	blob, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body certificatesResponse
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestCertificatesByLabel(t *testing.T) {
+	dbAccessor := prepDB(t)
+
+	for _, tc := range []struct {
+		labels    map[string]string
+		unexpired bool
+		want      int
+	}{
+		{map[string]string{"team": "payments"}, false, 3},
+		{map[string]string{"team": "payments", "env": "prod"}, false, 2},
+		{map[string]string{"team": "payments", "env": "prod"}, true, 1},
+		{map[string]string{"team": "web"}, false, 0},
+	} {
+		status, body := lookup(t, dbAccessor, jsonCertificatesRequest{Labels: tc.labels, Unexpired: tc.unexpired})
+		if status != http.StatusOK || !body.Success {
+			t.Fatalf("lookup of %v failed with status %d", tc.labels, status)
+		}
+		if len(body.Result.Certificates) != tc.want {
+			t.Errorf("want %d certificates with labels %v, got %+v", tc.want, tc.labels, body.Result.Certificates)
+		}
+	}
+
+	_, body := lookup(t, dbAccessor, jsonCertificatesRequest{Labels: map[string]string{"env": "prod"}, Unexpired: true})
+	if len(body.Result.Certificates) != 1 {
+		t.Fatalf("want one unexpired certificate in prod, got %+v", body.Result.Certificates)
+	}
+	cert := body.Result.Certificates[0]
+	if cert.Serial != "1" || cert.Labels["team"] != "payments" || len(cert.SANs) != 2 {
+		t.Errorf("unexpected certificate %+v", cert)
+	}
+}
+
+func TestCertificatesBadRequest(t *testing.T) {
+	dbAccessor := prepDB(t)
+
+	for _, req := range []interface{}{
+		jsonCertificatesRequest{},
+		jsonCertificatesRequest{Labels: map[string]string{"": "empty"}},
+		"not an object",
+	} {
+		if status, _ := lookup(t, dbAccessor, req); status != http.StatusBadRequest {
+			t.Errorf("want status %d for %v, got %d", http.StatusBadRequest, req, status)
+		}
+	}
+}
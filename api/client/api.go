@@ -4,3 +4,20 @@ package client
 type SignResult struct {
 	Certificate []byte `json:"certificate"`
 }
+
+// The statuses of an Order.
+const (
+	OrderPending = "pending"
+	OrderIssued  = "issued"
+	OrderDenied  = "denied"
+)
+
+// An Order is the state of an asynchronous sign request placed with
+// AuthSignAsync: pending, issued with its Certificate, or
+// denied with the error Err.
+type Order struct {
+	ID          string
+	Status      string
+	Certificate []byte
+	Err         error
+}
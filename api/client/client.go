@@ -4,9 +4,11 @@ package client
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	stderr "errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -39,13 +41,24 @@ type server struct {
 type Remote interface {
 	AuthSign(req, id []byte, provider auth.Provider) ([]byte, error)
 	Sign(jsonData []byte) ([]byte, error)
+	AuthSignAsync(req, id []byte, provider auth.Provider) (string, error)
+	PollOrder(id string) (*Order, error)
 	Info(jsonData []byte) (*info.Resp, error)
+	CRL(expiry time.Duration) ([]byte, error)
+	BulkSign(requests io.Reader, result func(BulkSignResult)) error
 	Hosts() []string
 	SetReqModifier(func(*http.Request, []byte))
 	SetRequestTimeout(d time.Duration)
 	SetProxy(func(*http.Request) (*url.URL, error))
 }
 
+// An OCSPSigner has its remote CFSSL instances sign OCSP responses
+// through their ocspsign endpoint. The Remotes returned by NewServer,
+// NewServerTLS and NewGroup are OCSPSigners.
+type OCSPSigner interface {
+	OCSPSign(jsonData []byte) ([]byte, error)
+}
+
 // NewServer sets up a new server target. The address should be of
 // The format [protocol:]name[:port] of the remote CFSSL instance.
 // If no protocol is given http is default. If no port
@@ -132,6 +145,16 @@ func (srv *server) createTransport() *http.Transport {
 
 // post connects to the remote server and returns a Response struct
 func (srv *server) post(url string, jsonData []byte) (*api.Response, error) {
+	return srv.do("POST", url, jsonData)
+}
+
+// get fetches url from the remote server and returns a Response struct.
+func (srv *server) get(url string) (*api.Response, error) {
+	return srv.do("GET", url, nil)
+}
+
+// do sends a request to the remote server and returns a Response struct.
+func (srv *server) do(method, url string, jsonData []byte) (*api.Response, error) {
 	var resp *http.Response
 	var err error
 	client := &http.Client{}
@@ -141,20 +164,27 @@ func (srv *server) post(url string, jsonData []byte) (*api.Response, error) {
 	if srv.RequestTimeout != 0 {
 		client.Timeout = srv.RequestTimeout
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
+	req, err := http.NewRequest(method, url, bytes.NewReader(jsonData))
 	if err != nil {
-		err = fmt.Errorf("failed POST to %s: %v", url, err)
+		err = fmt.Errorf("failed %s to %s: %v", method, url, err)
 		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, err)
 	}
 	req.Close = true
-	req.Header.Set("content-type", "application/json")
+	if jsonData != nil {
+		req.Header.Set("content-type", "application/json")
+	}
 	if srv.reqModifier != nil {
 		srv.reqModifier(req, jsonData)
 	}
 	resp, err = client.Do(req)
 	if err != nil {
-		err = fmt.Errorf("failed POST to %s: %v", url, err)
-		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, err)
+		reason := errors.ClientHTTPError
+		var opErr *net.OpError
+		if stderr.As(err, &opErr) && opErr.Op == "dial" {
+			reason = errors.ServerUnavailable
+		}
+		err = fmt.Errorf("failed %s to %s: %v", method, url, err)
+		return nil, errors.Wrap(errors.APIClientError, reason, err)
 	}
 	defer req.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
@@ -164,7 +194,12 @@ func (srv *server) post(url string, jsonData []byte) (*api.Response, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Errorf("http error with %s", url)
-		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, stderr.New(string(body)))
+		reason := errors.ClientHTTPError
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			reason = errors.ServerUnavailable
+		}
+		return nil, errors.Wrap(errors.APIClientError, reason, serverError(body, string(body)))
 	}
 
 	var response api.Response
@@ -176,7 +211,7 @@ func (srv *server) post(url string, jsonData []byte) (*api.Response, error) {
 
 	if !response.Success || response.Result == nil {
 		if len(response.Errors) > 0 {
-			return nil, errors.Wrap(errors.APIClientError, errors.ServerRequestFailed, stderr.New(response.Errors[0].Message))
+			return nil, errors.Wrap(errors.APIClientError, errors.ServerRequestFailed, serverError(body, response.Errors[0].Message))
 		}
 		return nil, errors.New(errors.APIClientError, errors.ServerRequestFailed)
 	}
@@ -200,10 +235,40 @@ func (srv *server) AuthInfo(req, id []byte, provider auth.Provider) ([]byte, err
 	return srv.authReq(req, id, provider, "info")
 }
 
+// AuthSignAsync fills out an asynchronous authenticated signing request
+// to the server, receiving the ID of the order to poll with PollOrder.
+func (srv *server) AuthSignAsync(req, id []byte, provider auth.Provider) (string, error) {
+	req, err := asyncRequest(req)
+	if err != nil {
+		return "", err
+	}
+	result, err := srv.authResultMap(req, id, provider, "sign")
+	if err != nil {
+		return "", err
+	}
+	return orderID(result)
+}
+
 // authReq is the common logic for AuthSign and AuthInfo -- perform the given
 // request, and return the resultant certificate.
 // The target is either 'sign' or 'info'.
 func (srv *server) authReq(req, ID []byte, provider auth.Provider, target string) ([]byte, error) {
+	result, err := srv.authResultMap(req, ID, provider, target)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := result["certificate"].(string)
+	if !ok {
+		return nil, errors.New(errors.APIClientError, errors.JSONError)
+	}
+
+	return []byte(cert), nil
+}
+
+// authResultMap performs the given authenticated request and returns its
+// result.
+func (srv *server) authResultMap(req, ID []byte, provider auth.Provider, target string) (map[string]interface{}, error) {
 	url := srv.getURL("auth" + target)
 
 	token, err := provider.Token(req)
@@ -232,13 +297,7 @@ func (srv *server) authReq(req, ID []byte, provider auth.Provider, target string
 	if !ok {
 		return nil, errors.New(errors.APIClientError, errors.JSONError)
 	}
-
-	cert, ok := result["certificate"].(string)
-	if !ok {
-		return nil, errors.New(errors.APIClientError, errors.JSONError)
-	}
-
-	return []byte(cert), nil
+	return result, nil
 }
 
 // Sign sends a signature request to the remote CFSSL server,
@@ -248,6 +307,76 @@ func (srv *server) Sign(jsonData []byte) ([]byte, error) {
 	return srv.request(jsonData, "sign")
 }
 
+// PollOrder fetches the order with the given ID from the remote CFSSL
+// server. The certificate is set once the order is issued, and Err once
+// it is denied.
+func (srv *server) PollOrder(id string) (*Order, error) {
+	response, err := srv.get(srv.getURL("order/" + url.PathEscape(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		ID          string               `json:"id"`
+		Status      string               `json:"status"`
+		Certificate string               `json:"certificate"`
+		Error       *api.ResponseMessage `json:"error"`
+	}
+	// The result was decoded generically, so encode it back to decode
+	// it into its actual type.
+	b, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, errors.Wrap(errors.APIClientError, errors.JSONError, err)
+	}
+	if err = json.Unmarshal(b, &result); err != nil {
+		return nil, errors.Wrap(errors.APIClientError, errors.JSONError, err)
+	}
+
+	order := &Order{ID: result.ID, Status: result.Status}
+	if result.Certificate != "" {
+		order.Certificate = []byte(result.Certificate)
+	}
+	if result.Error != nil {
+		order.Err = errors.Wrap(errors.APIClientError, errors.ServerRequestFailed, stderr.New(result.Error.Message))
+	}
+	return order, nil
+}
+
+// serverError returns an error with msg, of the class of the error the
+// server answered with in body, if it gives one, so that a request the
+// server rejected isn't mistaken for the server failing.
+func serverError(body []byte, msg string) error {
+	var response api.Response
+	if json.Unmarshal(body, &response) == nil && len(response.Errors) > 0 && response.Errors[0].Class != 0 {
+		return errors.WithClass(errors.Class(response.Errors[0].Class), stderr.New(msg))
+	}
+	return stderr.New(msg)
+}
+
+// asyncRequest sets the async parameter of a JSON sign request.
+func asyncRequest(jsonData []byte) ([]byte, error) {
+	var req map[string]interface{}
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return nil, errors.Wrap(errors.APIClientError, errors.JSONError, err)
+	}
+	req["async"] = true
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(errors.APIClientError, errors.JSONError, err)
+	}
+	return jsonData, nil
+}
+
+// orderID returns the ID of the order placed by an asynchronous sign
+// request.
+func orderID(result map[string]interface{}) (string, error) {
+	id, _ := result["id"].(string)
+	if id == "" {
+		return "", errors.Wrap(errors.APIClientError, errors.ClientHTTPError, stderr.New("response doesn't contain an order ID"))
+	}
+	return id, nil
+}
+
 // Info sends an info request to the remote CFSSL server, receiving a
 // response or an error in response.
 // It takes the serialized JSON request to send.
@@ -278,6 +407,117 @@ func (srv *server) Info(jsonData []byte) (*info.Resp, error) {
 	return info, nil
 }
 
+// OCSPSign sends an OCSP signing request to the remote CFSSL server,
+// receiving a DER encoded OCSP response or an error in response.
+// It takes the serialized JSON request to send.
+func (srv *server) OCSPSign(jsonData []byte) ([]byte, error) {
+	result, err := srv.getResultMap(jsonData, "ocspsign")
+	if err != nil {
+		return nil, err
+	}
+	b64Resp, _ := result["ocspResponse"].(string)
+	if b64Resp == "" {
+		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, stderr.New("response doesn't contain an OCSP response"))
+	}
+	resp, err := base64.StdEncoding.DecodeString(b64Resp)
+	if err != nil {
+		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, err)
+	}
+	return resp, nil
+}
+
+// CRL fetches a CRL of the revoked certificates in the certificate
+// database of the remote CFSSL server, generated and signed by the server
+// and valid for expiry, or for the server's default if expiry is zero.
+// The CRL is returned DER encoded.
+func (srv *server) CRL(expiry time.Duration) ([]byte, error) {
+	target := srv.getURL("crl")
+	if expiry != 0 {
+		target += "?expiry=" + url.QueryEscape(expiry.String())
+	}
+	response, err := srv.get(target)
+	if err != nil {
+		return nil, err
+	}
+	b64CRL, _ := response.Result.(string)
+	if b64CRL == "" {
+		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, stderr.New("response doesn't contain a CRL"))
+	}
+	crl, err := base64.StdEncoding.DecodeString(b64CRL)
+	if err != nil {
+		return nil, errors.Wrap(errors.APIClientError, errors.ClientHTTPError, err)
+	}
+	return crl, nil
+}
+
+// A BulkSignResult is the outcome of one of the requests sent with
+// BulkSign: the certificate signed for the request at position Index of
+// the stream, or the error the server returned for it.
+type BulkSignResult struct {
+	Index       int
+	Certificate []byte
+	Err         error
+}
+
+// BulkSign streams the JSON encoded sign or authenticated sign requests
+// read from requests, one per line, to the bulk_sign endpoint of the
+// remote CFSSL server, and calls result with the outcome of each of them
+// as the server sends it back. The request modifier, if any, is called
+// with a nil body.
+func (srv *server) BulkSign(requests io.Reader, result func(BulkSignResult)) error {
+	url := srv.getURL("bulk_sign")
+	client := &http.Client{}
+	if srv.TLSConfig != nil {
+		client.Transport = srv.createTransport()
+	}
+	if srv.RequestTimeout != 0 {
+		client.Timeout = srv.RequestTimeout
+	}
+	req, err := http.NewRequest("POST", url, requests)
+	if err != nil {
+		err = fmt.Errorf("failed POST to %s: %v", url, err)
+		return errors.Wrap(errors.APIClientError, errors.ClientHTTPError, err)
+	}
+	req.Header.Set("content-type", "application/x-ndjson")
+	if srv.reqModifier != nil {
+		srv.reqModifier(req, nil)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed POST to %s: %v", url, err)
+		return errors.Wrap(errors.APIClientError, errors.ClientHTTPError, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Errorf("http error with %s", url)
+		return errors.Wrap(errors.APIClientError, errors.ClientHTTPError, stderr.New(string(body)))
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var line struct {
+			Index       int                  `json:"index"`
+			Certificate string               `json:"certificate"`
+			Error       *api.ResponseMessage `json:"error"`
+		}
+		if err = dec.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(errors.APIClientError, errors.JSONError, err)
+		}
+
+		res := BulkSignResult{Index: line.Index}
+		if line.Error != nil {
+			res.Err = errors.Wrap(errors.APIClientError, errors.ServerRequestFailed, stderr.New(line.Error.Message))
+		} else {
+			res.Certificate = []byte(line.Certificate)
+		}
+		result(res)
+	}
+}
+
 func (srv *server) getResultMap(jsonData []byte, target string) (result map[string]interface{}, err error) {
 	url := srv.getURL(target)
 	response, err := srv.post(url, jsonData)
@@ -3,6 +3,7 @@ package client
 import (
 	"crypto/tls"
 	"errors"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -115,6 +116,30 @@ func (g *orderedListGroup) Sign(jsonData []byte) (resp []byte, err error) {
 	return nil, err
 }
 
+func (g *orderedListGroup) AuthSignAsync(req, id []byte, provider auth.Provider) (resp string, err error) {
+	for i := range g.remotes {
+		resp, err = g.remotes[i].AuthSignAsync(req, id, provider)
+		if err == nil {
+			return resp, nil
+		}
+	}
+
+	return "", err
+}
+
+// PollOrder asks each remote in turn, as only the one the order was
+// placed with knows it.
+func (g *orderedListGroup) PollOrder(id string) (order *Order, err error) {
+	for i := range g.remotes {
+		order, err = g.remotes[i].PollOrder(id)
+		if err == nil {
+			return order, nil
+		}
+	}
+
+	return nil, err
+}
+
 func (g *orderedListGroup) Info(jsonData []byte) (resp *info.Resp, err error) {
 	for i := range g.remotes {
 		resp, err = g.remotes[i].Info(jsonData)
@@ -126,6 +151,54 @@ func (g *orderedListGroup) Info(jsonData []byte) (resp *info.Resp, err error) {
 	return nil, err
 }
 
+func (g *orderedListGroup) OCSPSign(jsonData []byte) (resp []byte, err error) {
+	for i := range g.remotes {
+		resp, err = g.remotes[i].OCSPSign(jsonData)
+		if err == nil {
+			return resp, nil
+		}
+	}
+
+	return nil, err
+}
+
+func (g *orderedListGroup) CRL(expiry time.Duration) (resp []byte, err error) {
+	for i := range g.remotes {
+		resp, err = g.remotes[i].CRL(expiry)
+		if err == nil {
+			return resp, nil
+		}
+	}
+
+	return nil, err
+}
+
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// BulkSign tries the remotes in order until one of them can be reached.
+// Once any request has been sent, it sticks with that remote.
+func (g *orderedListGroup) BulkSign(requests io.Reader, result func(BulkSignResult)) (err error) {
+	counted := &countingReader{Reader: requests}
+	for i := range g.remotes {
+		err = g.remotes[i].BulkSign(counted, result)
+		if err == nil || counted.n > 0 {
+			return err
+		}
+	}
+
+	return err
+}
+
 // SetReqModifier does nothing because there is no request modifier for group
 func (g *orderedListGroup) SetReqModifier(mod func(*http.Request, []byte)) {
 	// noop
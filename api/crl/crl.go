@@ -3,9 +3,19 @@ package crl
 
 import (
 	"crypto"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"mime"
 	"net/http"
 	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/cfssl/api"
@@ -16,30 +26,68 @@ import (
 	"github.com/cloudflare/cfssl/log"
 )
 
-// A Handler accepts requests with a serial number parameter
-// and revokes
+// contentType is the media type of a DER encoded CRL (RFC 2585).
+const contentType = "application/pkix-crl"
+
+// A Handler serves a CRL of the revoked certificates in the certificate
+// database.
 type Handler struct {
 	dbAccessor certdb.Accessor
 	ca         *x509.Certificate
 	key        crypto.Signer
+
+	mu     sync.Mutex
+	cached *cachedCRL
 }
 
-// NewHandler returns a new http.Handler that handles a revoke request.
-func NewHandler(dbAccessor certdb.Accessor, caPath string, caKeyPath string) (http.Handler, error) {
+// A cachedCRL is a CRL generated by the handler. It is served again as
+// long as the revoked certificates and requested expiry are unchanged
+// and it is not due for a refresh, by default once it reaches the middle
+// of its validity period, so that clients can rely on its number for
+// conditional requests.
+type cachedCRL struct {
+	der        []byte
+	number     *big.Int
+	revoked    [sha256.Size]byte
+	expiry     time.Duration
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+// etag returns the entity tag of the CRL, derived from its number.
+func (c *cachedCRL) etag(der bool) string {
+	if der {
+		return `"` + c.number.Text(16) + `"`
+	}
+	return `"` + c.number.Text(16) + `-json"`
+}
+
+// revokedDigest summarizes the revoked certificates a CRL is built from.
+func revokedDigest(certs []certdb.CertificateRecord) [sha256.Size]byte {
+	var entries []string
+	for _, cert := range certs {
+		entries = append(entries, fmt.Sprintf("%s %s %d", cert.Serial, cert.AKI, cert.RevokedAt.UnixNano()))
+	}
+	sort.Strings(entries)
+	return sha256.Sum256([]byte(strings.Join(entries, "\n")))
+}
+
+// loadIssuer reads the CA certificate and key signing the CRLs.
+func loadIssuer(caPath string, caKeyPath string) (*x509.Certificate, crypto.Signer, error) {
 	ca, err := helpers.ReadBytes(caPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	caKey, err := helpers.ReadBytes(caKeyPath)
 	if err != nil {
-		return nil, errors.Wrap(errors.PrivateKeyError, errors.ReadFailed, err)
+		return nil, nil, errors.Wrap(errors.PrivateKeyError, errors.ReadFailed, err)
 	}
 
 	// Parse the PEM encoded certificate
 	issuerCert, err := helpers.ParseCertificatePEM(ca)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	strPassword := os.Getenv("CFSSL_CA_PK_PASSWORD")
@@ -52,6 +100,15 @@ func NewHandler(dbAccessor certdb.Accessor, caPath string, caKeyPath string) (ht
 	key, err := helpers.ParsePrivateKeyPEMWithPassword(caKey, password)
 	if err != nil {
 		log.Debugf("malformed private key %v", err)
+		return nil, nil, err
+	}
+	return issuerCert, key, nil
+}
+
+// NewHandler returns a new http.Handler that handles a revoke request.
+func NewHandler(dbAccessor certdb.Accessor, caPath string, caKeyPath string) (http.Handler, error) {
+	issuerCert, key, err := loadIssuer(caPath, caKeyPath)
+	if err != nil {
 		return nil, err
 	}
 
@@ -65,8 +122,11 @@ func NewHandler(dbAccessor certdb.Accessor, caPath string, caKeyPath string) (ht
 	}, nil
 }
 
-// Handle responds to revocation requests. It attempts to revoke
-// a certificate with a given serial number
+// Handle responds to CRL requests. The CRL is DER encoded when the
+// request accepts application/pkix-crl and wrapped in the standard API
+// response otherwise. Either way, the response carries an ETag derived
+// from the CRL number, so that an unchanged CRL can be revalidated with
+// If-None-Match, and may be cached until the CRL's nextUpdate.
 func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 	var newExpiryTime = 7 * helpers.OneDay
 
@@ -77,17 +137,217 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 
 	queryExpiryTime := r.URL.Query().Get("expiry")
 	if queryExpiryTime != "" {
-		log.Infof("requested expiry time of %s", queryExpiryTime)
+		log.FromContext(r.Context()).Infof("requested expiry time of %s", queryExpiryTime)
 		newExpiryTime, err = time.ParseDuration(queryExpiryTime)
 		if err != nil {
 			return err
 		}
 	}
 
-	result, err := crl.NewCRLFromDB(certs, h.ca, h.key, newExpiryTime)
+	result, err := h.crl(certs, newExpiryTime, 0)
 	if err != nil {
 		return err
 	}
 
-	return api.SendResponse(w, result)
+	der := acceptsCRL(r.Header.Get("Accept"))
+	if !writeCacheHeaders(w, r, result, der) {
+		return nil
+	}
+
+	if der {
+		w.Header().Set("Content-Type", contentType)
+		_, err = w.Write(result.der)
+		return err
+	}
+	return api.SendResponse(w, result.der)
+}
+
+// writeCacheHeaders sets the ETag and caching headers of a response
+// carrying the CRL. It answers Not Modified, and returns false, when
+// the request's If-None-Match header matches the CRL.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, result *cachedCRL, der bool) bool {
+	etag := result.etag(der)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept")
+	maxAge := int64(time.Until(result.nextUpdate) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(maxAge, 10))
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+// crl returns the cached CRL if it still describes certs and is younger
+// than refresh, or than half its validity period if refresh is zero. It
+// generates a new one with a higher CRL number otherwise.
+func (h *Handler) crl(certs []certdb.CertificateRecord, expiry, refresh time.Duration) (*cachedCRL, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if refresh == 0 {
+		refresh = expiry / 2
+	}
+
+	now := time.Now()
+	revoked := revokedDigest(certs)
+	if c := h.cached; c != nil && c.revoked == revoked && c.expiry == expiry &&
+		now.Before(c.thisUpdate.Add(refresh)) {
+		return c, nil
+	}
+
+	number := big.NewInt(now.UnixNano())
+	if h.cached != nil && h.cached.number.Cmp(number) >= 0 {
+		number = new(big.Int).Add(h.cached.number, big.NewInt(1))
+	}
+
+	nextUpdate := now.Add(expiry)
+	der, err := crl.NewNumberedCRLFromDB(certs, h.ca, h.key, number, now, nextUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	h.cached = &cachedCRL{
+		der:        der,
+		number:     number,
+		revoked:    revoked,
+		expiry:     expiry,
+		thisUpdate: now,
+		nextUpdate: nextUpdate,
+	}
+	return h.cached, nil
+}
+
+// A DistributionHandler serves the DER encoded CRL of a CA to relying
+// parties, at a path ending in the CA's hex encoded subject key
+// identifier, optionally followed by ".crl". Unlike Handler, it only
+// lists the certificates issued by the CA, and the validity and refresh
+// interval of the CRL are fixed by the server.
+type DistributionHandler struct {
+	crl     Handler
+	ski     string
+	expiry  time.Duration
+	refresh time.Duration
+	// anyPath serves the CRL whatever the request path, for handlers
+	// routed to by their caller.
+	anyPath bool
+}
+
+// NewDistributionHandler returns a new DistributionHandler for the CA.
+// Each CRL is valid for expiry and is regenerated after refresh, or
+// after half of expiry if refresh is zero, as well as whenever the
+// revoked certificates change.
+func NewDistributionHandler(dbAccessor certdb.Accessor, caPath string, caKeyPath string, expiry, refresh time.Duration) (*DistributionHandler, error) {
+	issuerCert, key, err := loadIssuer(caPath, caKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return newDistributionHandler(dbAccessor, issuerCert, key, expiry, refresh)
+}
+
+// NewIssuerHandler returns a DistributionHandler for the CA certificate
+// issuer and its key. Unlike the handler of NewDistributionHandler, it
+// serves the CRL whatever the request path, so that the caller can
+// route requests to the CRLs of several CAs.
+func NewIssuerHandler(dbAccessor certdb.Accessor, issuer *x509.Certificate, key crypto.Signer, expiry, refresh time.Duration) (*DistributionHandler, error) {
+	h, err := newDistributionHandler(dbAccessor, issuer, key, expiry, refresh)
+	if err != nil {
+		return nil, err
+	}
+	h.anyPath = true
+	return h, nil
+}
+
+func newDistributionHandler(dbAccessor certdb.Accessor, issuer *x509.Certificate, key crypto.Signer, expiry, refresh time.Duration) (*DistributionHandler, error) {
+	if expiry <= 0 {
+		return nil, fmt.Errorf("invalid CRL expiry %v", expiry)
+	}
+	if refresh < 0 || refresh > expiry {
+		return nil, fmt.Errorf("CRL refresh interval %v must be between zero and the expiry %v", refresh, expiry)
+	}
+	if len(issuer.SubjectKeyId) == 0 {
+		return nil, fmt.Errorf("CA certificate has no subject key identifier")
+	}
+
+	return &DistributionHandler{
+		crl: Handler{
+			dbAccessor: dbAccessor,
+			ca:         issuer,
+			key:        key,
+		},
+		ski:     hex.EncodeToString(issuer.SubjectKeyId),
+		expiry:  expiry,
+		refresh: refresh,
+	}, nil
+}
+
+// ServeHTTP responds to CRL requests for the CA.
+func (h *DistributionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = api.WithRequestID(w, r)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.anyPath && !strings.EqualFold(strings.TrimSuffix(path.Base(r.URL.Path), ".crl"), h.ski) {
+		http.NotFound(w, r)
+		return
+	}
+
+	certs, err := h.crl.dbAccessor.GetRevokedAndUnexpiredCertificates()
+	if err != nil {
+		log.FromContext(r.Context()).Errorf("failed to read revoked certificates: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var issued []certdb.CertificateRecord
+	for _, cert := range certs {
+		if strings.EqualFold(cert.AKI, h.ski) {
+			issued = append(issued, cert)
+		}
+	}
+
+	result, err := h.crl.crl(issued, h.expiry, h.refresh)
+	if err != nil {
+		log.FromContext(r.Context()).Errorf("failed to generate CRL: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !writeCacheHeaders(w, r, result, true) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(result.der)
+}
+
+// acceptsCRL reports whether an Accept header asks for a DER encoded CRL.
+func acceptsCRL(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil || mediaType != contentType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
 }
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -147,3 +148,177 @@ func TestCRLGenerationWithExpiry(t *testing.T) {
 		t.Fatal("cert was not correctly inserted in CRL, serial was ", cert.SerialNumber)
 	}
 }
+
+func getDERCRL(t *testing.T, url, etag string) *http.Response {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/pkix-crl")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCRLConditionalGet(t *testing.T) {
+	dbAccessor, err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewHandler(dbAccessor, testCaFile, testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp := getDERCRL(t, ts.URL, "")
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/pkix-crl" {
+		t.Errorf("expected content type application/pkix-crl, got %q", ct)
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.HasPrefix(cc, "max-age=") || cc == "max-age=0" {
+		t.Errorf("expected a max-age until the CRL's next update, got %q", cc)
+	}
+	if _, err := x509.ParseRevocationList(body); err != nil {
+		t.Fatalf("expected a DER encoded CRL: %v", err)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+
+	// The revoked certificates are unchanged, so is the CRL number.
+	resp = getDERCRL(t, ts.URL, etag)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected status 304 for an unchanged CRL, got %d", resp.StatusCode)
+	}
+
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial:    "2",
+		AKI:       fakeAKI,
+		Expiry:    time.Now().AddDate(1, 0, 0),
+		PEM:       "another revoked cert",
+		Status:    "revoked",
+		RevokedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp = getDERCRL(t, ts.URL, etag)
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 once a certificate is revoked, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Error("expected the ETag to change with the CRL number")
+	}
+	list, err := x509.ParseRevocationList(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.RevokedCertificateEntries) != 2 {
+		t.Errorf("expected 2 revoked certificates, got %d", len(list.RevokedCertificateEntries))
+	}
+}
+
+func TestDistributionHandler(t *testing.T) {
+	if _, err := NewDistributionHandler(nil, testCaFile, testCaKeyFile, time.Hour, 2*time.Hour); err == nil {
+		t.Fatal("expected a refresh interval longer than the expiry to be rejected")
+	}
+
+	dbAccessor, err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const caSKI = "b7d2f784baa839d5fbac10ce29fd8b96a413ecbd"
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial:    "3",
+		AKI:       caSKI,
+		Expiry:    time.Now().AddDate(1, 0, 0),
+		PEM:       "revoked cert issued by the CA",
+		Status:    "revoked",
+		RevokedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := NewDistributionHandler(dbAccessor, testCaFile, testCaKeyFile, 24*time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/crl/" + caSKI + ".crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/pkix-crl" {
+		t.Errorf("expected content type application/pkix-crl, got %q", ct)
+	}
+	list, err := x509.ParseRevocationList(body)
+	if err != nil {
+		t.Fatalf("expected a DER encoded CRL: %v", err)
+	}
+	if len(list.RevokedCertificateEntries) != 1 || list.RevokedCertificateEntries[0].SerialNumber.Int64() != 3 {
+		t.Fatalf("expected only the certificate issued by the CA to be listed, got %d entries", len(list.RevokedCertificateEntries))
+	}
+	if validity := list.NextUpdate.Sub(list.ThisUpdate); validity != 24*time.Hour {
+		t.Errorf("expected the CRL to be valid for 24h, got %v", validity)
+	}
+
+	resp, err = http.Get(ts.URL + "/crl/" + strings.ToUpper(caSKI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 without the .crl suffix, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/crl/0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404 for another CA, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/crl/"+caSKI, "text/plain", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405 for a POST, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,166 @@
+// Package events implements the HTTP handler streaming the certificate
+// events of the server as server-sent events.
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/events"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// bufferSize is the number of events buffered for each client. A client
+// falling further behind is disconnected.
+const bufferSize = 64
+
+// keepAliveInterval is how often a comment is sent to idle clients, so
+// that proxies don't close their connection.
+const keepAliveInterval = 15 * time.Second
+
+// closing is closed by CloseStreams.
+var (
+	closing   = make(chan struct{})
+	closeOnce sync.Once
+)
+
+// CloseStreams ends the streams of every Handler returned by NewHandler,
+// so that the server can shut down without waiting for their clients to
+// go away. The handlers refuse new streams from then on.
+func CloseStreams() {
+	closeOnce.Do(func() { close(closing) })
+}
+
+// A Handler streams the events published on a bus to the clients that
+// the provider authenticates.
+type Handler struct {
+	bus       *events.Bus
+	provider  auth.Provider
+	keepAlive time.Duration
+	closing   <-chan struct{}
+}
+
+// NewHandler returns a new http.Handler streaming the events published
+// on events.DefaultBus to the clients that provider authenticates.
+func NewHandler(provider auth.Provider) http.Handler {
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			bus:       events.DefaultBus,
+			provider:  provider,
+			keepAlive: keepAliveInterval,
+			closing:   closing,
+		},
+		Methods: []string{"GET"},
+	}
+}
+
+// authenticate checks the token of r with the provider of h. The token
+// is sent base64-encoded in the Authorization header, as "Bearer token",
+// and authenticates the path and query of the request.
+func (h *Handler) authenticate(r *http.Request) error {
+	aReq := &auth.AuthenticatedRequest{
+		Request: []byte(r.URL.RequestURI()),
+		TLS:     r.TLS,
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		if !strings.HasPrefix(header, "Bearer ") {
+			return errors.NewUnauthorizedString("malformed Authorization header")
+		}
+		token, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			return errors.NewUnauthorizedString("malformed token")
+		}
+		aReq.Token = token
+	}
+	if !h.provider.Verify(aReq) {
+		return errors.NewUnauthorizedString("invalid token")
+	}
+	return nil
+}
+
+// eventTypes parses the "type" parameter, a comma-separated list of the
+// types of events to stream. All types are streamed if it is empty.
+func eventTypes(param string) (map[string]bool, error) {
+	if param == "" {
+		return nil, nil
+	}
+	types := map[string]bool{}
+	for _, t := range strings.Split(param, ",") {
+		switch t {
+		case events.CertificateIssued, events.CertificateRevoked, events.OCSPRefreshed:
+			types[t] = true
+		default:
+			return nil, errors.NewBadRequestString(fmt.Sprintf("unknown event type %q", t))
+		}
+	}
+	return types, nil
+}
+
+// Handle streams every event published from now on, or only those of the
+// types listed in the "type" parameter, until the client goes away,
+// falls too far behind or the server shuts down. Each event is sent as a server-sent event whose
+// name is the event type and whose data is the event as JSON.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	if err := h.authenticate(r); err != nil {
+		log.FromContext(r.Context()).Warningf("event stream request refused: %v", err)
+		return err
+	}
+	types, err := eventTypes(r.URL.Query().Get("type"))
+	if err != nil {
+		return err
+	}
+	select {
+	case <-h.closing:
+		return errors.NewServiceUnavailableString("the server is shutting down")
+	default:
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.NewBadRequestString("streaming is not supported")
+	}
+
+	ch, unsubscribe := h.bus.Subscribe(bufferSize)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": streaming cfssl events\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(h.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-h.closing:
+			return nil
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				log.FromContext(r.Context()).Warning("event stream client fell behind, disconnecting it")
+				return nil
+			}
+			if types != nil && !types[e.Type] {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
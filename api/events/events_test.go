@@ -0,0 +1,156 @@
+package events
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/events"
+)
+
+// testAPIKey is the API key the clients of the test servers authenticate
+// with.
+const testAPIKey = "0123456789abcdef"
+
+func newTestServer(t *testing.T, bus *events.Bus, closing <-chan struct{}) *httptest.Server {
+	provider, err := auth.NewAPIKey(testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(&api.HTTPHandler{
+		Handler: &Handler{bus: bus, provider: provider, keepAlive: time.Hour, closing: closing},
+		Methods: []string{"GET"},
+	})
+}
+
+// get requests url with the given API key, if any.
+func get(t *testing.T, url, key string) *http.Response {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+base64.StdEncoding.EncodeToString([]byte(key)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// readEvent reads the next server-sent event, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (name string, e events.Event) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && name != "":
+			return name, e
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	bus := &events.Bus{}
+	ts := newTestServer(t, bus, nil)
+	defer ts.Close()
+
+	resp := get(t, ts.URL+"?type=certificate_revoked,ocsp_refreshed", testAPIKey)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	// The stream starts with a comment once the client is subscribed.
+	body := bufio.NewReader(resp.Body)
+	if _, err := body.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	reason := 1
+	bus.Publish(events.Event{Type: events.CertificateIssued, Serial: "1"})
+	bus.Publish(events.Event{Type: events.CertificateRevoked, Serial: "1", AKI: "aki", Reason: &reason})
+	bus.Publish(events.Event{Type: events.OCSPRefreshed, Serial: "1", AKI: "aki"})
+
+	name, e := readEvent(t, body)
+	if name != events.CertificateRevoked || e.Serial != "1" || e.AKI != "aki" || e.Reason == nil || *e.Reason != 1 {
+		t.Errorf("unexpected event %s %+v", name, e)
+	}
+	name, e = readEvent(t, body)
+	if name != events.OCSPRefreshed || e.ID != 3 {
+		t.Errorf("unexpected event %s %+v", name, e)
+	}
+}
+
+func TestStreamBadRequest(t *testing.T) {
+	ts := newTestServer(t, &events.Bus{}, nil)
+	defer ts.Close()
+
+	resp := get(t, ts.URL+"?type=certificate_renewed", testAPIKey)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d for an unknown event type, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	for _, key := range []string{"", "wrong"} {
+		resp = get(t, ts.URL, key)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status %d for key %q, got %d", http.StatusUnauthorized, key, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for a POST, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestStreamClosing(t *testing.T) {
+	closing := make(chan struct{})
+	ts := newTestServer(t, &events.Bus{}, closing)
+	defer ts.Close()
+
+	resp := get(t, ts.URL, testAPIKey)
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	if _, err := body.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	close(closing)
+	if _, err := ioutil.ReadAll(body); err != nil {
+		t.Fatalf("expected the stream to end, got %v", err)
+	}
+
+	resp = get(t, ts.URL, testAPIKey)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d once closing, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
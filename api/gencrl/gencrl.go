@@ -41,7 +41,7 @@ func gencrlHandler(w http.ResponseWriter, r *http.Request) error {
 	req := &jsonCRLRequest{}
 	err = json.Unmarshal(body, req)
 	if err != nil {
-		log.Error(err)
+		log.FromContext(r.Context()).Error(err)
 	}
 
 	if req.ExpiryTime != "" {
@@ -64,7 +64,7 @@ func gencrlHandler(w http.ResponseWriter, r *http.Request) error {
 
 	cert, err := helpers.ParseCertificatePEM([]byte(req.Certificate))
 	if err != nil {
-		log.Error("error from ParseCertificatePEM", err)
+		log.FromContext(r.Context()).Error("error from ParseCertificatePEM", err)
 		return errors.NewBadRequestString("malformed certificate")
 	}
 
@@ -80,13 +80,13 @@ func gencrlHandler(w http.ResponseWriter, r *http.Request) error {
 
 	key, err := helpers.ParsePrivateKeyPEM([]byte(req.PrivateKey))
 	if err != nil {
-		log.Debugf("malformed private key %v", err)
+		log.FromContext(r.Context()).Debugf("malformed private key %v", err)
 		return errors.NewBadRequestString("malformed Private Key")
 	}
 
 	result, err := cert.CreateCRL(rand.Reader, key, revokedCerts, time.Now(), newExpiryTime)
 	if err != nil {
-		log.Debugf("unable to create CRL: %v", err)
+		log.FromContext(r.Context()).Debugf("unable to create CRL: %v", err)
 		return err
 	}
 
@@ -106,10 +106,10 @@ func computeSum(in []byte) (sum Sum, err error) {
 // key and certificate request on behalf of the client. The format for
 // these requests is documented in the API documentation.
 func (g *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
-	log.Info("request for CSR")
+	log.FromContext(r.Context()).Info("request for CSR")
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Warningf("failed to read request body: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to read request body: %v", err)
 		return errors.NewBadRequest(err)
 	}
 	r.Body.Close()
@@ -118,18 +118,18 @@ func (g *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 	req.KeyRequest = csr.NewKeyRequest()
 	err = json.Unmarshal(body, req)
 	if err != nil {
-		log.Warningf("failed to unmarshal request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to unmarshal request: %v", err)
 		return errors.NewBadRequest(err)
 	}
 
 	if req.CA != nil {
-		log.Warningf("request received with CA section")
+		log.FromContext(r.Context()).Warningf("request received with CA section")
 		return errors.NewBadRequestString("ca section only permitted in initca")
 	}
 
 	csr, key, err := g.generator.ProcessRequest(req)
 	if err != nil {
-		log.Warningf("failed to process CSR: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to process CSR: %v", err)
 		// The validator returns a *cfssl/errors.HttpError
 		return err
 	}
@@ -223,37 +223,37 @@ type genSignRequest struct {
 // key and certificate on behalf of the client. The format for these
 // requests is documented in the API documentation.
 func (cg *CertGeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) error {
-	log.Info("request for CSR")
+	log.FromContext(r.Context()).Info("request for CSR")
 
 	req := new(genSignRequest)
 	req.Request = csr.New()
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Warningf("failed to read request body: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to read request body: %v", err)
 		return errors.NewBadRequest(err)
 	}
 	r.Body.Close()
 
 	err = json.Unmarshal(body, req)
 	if err != nil {
-		log.Warningf("failed to unmarshal request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to unmarshal request: %v", err)
 		return errors.NewBadRequest(err)
 	}
 
 	if req.Request == nil {
-		log.Warning("empty request received")
+		log.FromContext(r.Context()).Warning("empty request received")
 		return errors.NewBadRequestString("missing request section")
 	}
 
 	if req.Request.CA != nil {
-		log.Warningf("request received with CA section")
+		log.FromContext(r.Context()).Warningf("request received with CA section")
 		return errors.NewBadRequestString("ca section only permitted in initca")
 	}
 
 	csr, key, err := cg.generator.ProcessRequest(req.Request)
 	if err != nil {
-		log.Warningf("failed to process CSR: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to process CSR: %v", err)
 		// The validator returns a *cfssl/errors.HttpError
 		return err
 	}
@@ -262,11 +262,12 @@ func (cg *CertGeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) e
 		Request: string(csr),
 		Profile: req.Profile,
 		Label:   req.Label,
+		Logger:  log.FromContext(r.Context()),
 	}
 
 	certBytes, err := cg.signer.Sign(signReq)
 	if err != nil {
-		log.Warningf("failed to sign request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to sign request: %v", err)
 		return err
 	}
 
@@ -24,3 +24,43 @@ func NewHealthCheck() http.Handler {
 		Methods: []string{"GET"},
 	}
 }
+
+// A ReadinessCheck reports whether one of the server's dependencies is
+// ready. Check returns nil when it is.
+type ReadinessCheck struct {
+	Name  string
+	Check func() error
+}
+
+// ReadinessResponse contains the response to the /readyz endpoint.
+// Failed maps the name of each failed check to its error.
+type ReadinessResponse struct {
+	Ready  bool              `json:"ready"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// NewReadinessCheck creates a new handler that runs every check on each
+// request. It responds 200 when all of them pass and 503 Service
+// Unavailable, listing the failed checks, otherwise.
+func NewReadinessCheck(checks ...ReadinessCheck) http.Handler {
+	return api.HTTPHandler{
+		Handler: api.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			response := ReadinessResponse{Ready: true}
+			for _, check := range checks {
+				if err := check.Check(); err != nil {
+					if response.Failed == nil {
+						response.Failed = map[string]string{}
+					}
+					response.Failed[check.Name] = err.Error()
+					response.Ready = false
+				}
+			}
+
+			if !response.Ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return json.NewEncoder(w).Encode(response)
+		}),
+		Methods: []string{"GET"},
+	}
+}
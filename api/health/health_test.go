@@ -0,0 +1,62 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getReadiness(t *testing.T, handler http.Handler) (int, ReadinessResponse) {
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body ReadinessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestReadinessNotReady(t *testing.T) {
+	handler := NewReadinessCheck(
+		ReadinessCheck{Name: "ca_key", Check: func() error { return errors.New("CA key not loaded") }},
+		ReadinessCheck{Name: "config", Check: func() error { return nil }},
+	)
+
+	status, body := getReadiness(t, handler)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", status)
+	}
+	if body.Ready {
+		t.Fatal("expected not ready")
+	}
+	if body.Failed["ca_key"] != "CA key not loaded" {
+		t.Errorf("expected the ca_key check to be reported, got %v", body.Failed)
+	}
+	if _, ok := body.Failed["config"]; ok {
+		t.Errorf("passing check reported as failed: %v", body.Failed)
+	}
+}
+
+func TestReadinessReady(t *testing.T) {
+	handler := NewReadinessCheck(
+		ReadinessCheck{Name: "ca_key", Check: func() error { return nil }},
+		ReadinessCheck{Name: "config", Check: func() error { return nil }},
+	)
+
+	status, body := getReadiness(t, handler)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if !body.Ready || len(body.Failed) != 0 {
+		t.Errorf("expected ready with no failures, got %+v", body)
+	}
+}
@@ -36,14 +36,14 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 	req := new(info.Req)
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Warningf("failed to read request body: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to read request body: %v", err)
 		return errors.NewBadRequest(err)
 	}
 	r.Body.Close()
 
 	err = json.Unmarshal(body, req)
 	if err != nil {
-		log.Warningf("failed to unmarshal request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to unmarshal request: %v", err)
 		return errors.NewBadRequest(err)
 	}
 
@@ -86,31 +86,31 @@ func (h *MultiHandler) Handle(w http.ResponseWriter, r *http.Request) error {
 	req := new(info.Req)
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Warningf("failed to read request body: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to read request body: %v", err)
 		return errors.NewBadRequest(err)
 	}
 	r.Body.Close()
 
 	err = json.Unmarshal(body, req)
 	if err != nil {
-		log.Warningf("failed to unmarshal request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to unmarshal request: %v", err)
 		return errors.NewBadRequest(err)
 	}
 
-	log.Debug("checking label")
+	log.FromContext(r.Context()).Debug("checking label")
 	if req.Label == "" {
 		req.Label = h.defaultLabel
 	}
 
 	if _, ok := h.signers[req.Label]; !ok {
-		log.Warningf("request for invalid endpoint")
+		log.FromContext(r.Context()).Warningf("request for invalid endpoint")
 		return errors.NewBadRequestString("bad label")
 	}
 
-	log.Debug("getting info")
+	log.FromContext(r.Context()).Debug("getting info")
 	resp, err := h.signers[req.Label].Info(*req)
 	if err != nil {
-		log.Infof("error getting certificate: %v", err)
+		log.FromContext(r.Context()).Infof("error getting certificate: %v", err)
 		return err
 	}
 
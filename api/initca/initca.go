@@ -25,10 +25,10 @@ type NewCA struct {
 // identity information for the CA's root key. This endpoint is not
 // suitable for creating intermediate certificates.
 func initialCAHandler(w http.ResponseWriter, r *http.Request) error {
-	log.Info("setting up initial CA handler")
+	log.FromContext(r.Context()).Info("setting up initial CA handler")
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Warningf("failed to read request body: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to read request body: %v", err)
 		return errors.NewBadRequest(err)
 	}
 	r.Body.Close()
@@ -37,13 +37,13 @@ func initialCAHandler(w http.ResponseWriter, r *http.Request) error {
 	req.KeyRequest = csr.NewKeyRequest()
 	err = json.Unmarshal(body, req)
 	if err != nil {
-		log.Warningf("failed to unmarshal request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to unmarshal request: %v", err)
 		return errors.NewBadRequest(err)
 	}
 
 	cert, _, key, err := initca.New(req)
 	if err != nil {
-		log.Warningf("failed to initialise new CA: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to initialise new CA: %v", err)
 		return err
 	}
 
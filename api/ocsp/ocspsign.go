@@ -41,6 +41,8 @@ type jsonSignRequest struct {
 	Reason      int    `json:"reason,omitempty"`
 	RevokedAt   string `json:"revoked_at,omitempty"`
 	IssuerHash  string `json:"issuer_hash,omitempty"`
+	ThisUpdate  string `json:"this_update,omitempty"`
+	NextUpdate  string `json:"next_update,omitempty"`
 }
 
 var nameToHash = map[string]crypto.Hash{
@@ -51,6 +53,15 @@ var nameToHash = map[string]crypto.Hash{
 	"SHA512": crypto.SHA512,
 }
 
+// parseTime parses a time given as a date, like the cli's -revoked-at
+// flag, or in RFC 3339 format.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
 // Handle responds to requests for a ocsp signature. It creates and signs
 // a ocsp response for the provided certificate and status. If the status
 // is revoked then it also adds reason and revoked_at. The response is
@@ -73,7 +84,7 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 
 	cert, err := helpers.ParseCertificatePEM([]byte(req.Certificate))
 	if err != nil {
-		log.Error("Error from ParseCertificatePEM", err)
+		log.FromContext(r.Context()).Error("Error from ParseCertificatePEM", err)
 		return errors.NewBadRequestString("Malformed certificate")
 	}
 
@@ -88,12 +99,26 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 		if req.RevokedAt == "" || req.RevokedAt == "now" {
 			signReq.RevokedAt = time.Now()
 		} else {
-			signReq.RevokedAt, err = time.Parse("2006-01-02", req.RevokedAt)
+			signReq.RevokedAt, err = parseTime(req.RevokedAt)
 			if err != nil {
 				return errors.NewBadRequestString("Malformed revocation time")
 			}
 		}
 	}
+	if req.ThisUpdate != "" {
+		thisUpdate, err := parseTime(req.ThisUpdate)
+		if err != nil {
+			return errors.NewBadRequestString("Malformed this_update time")
+		}
+		signReq.ThisUpdate = &thisUpdate
+	}
+	if req.NextUpdate != "" {
+		nextUpdate, err := parseTime(req.NextUpdate)
+		if err != nil {
+			return errors.NewBadRequestString("Malformed next_update time")
+		}
+		signReq.NextUpdate = &nextUpdate
+	}
 	if req.IssuerHash != "" {
 		issuerHash, ok := nameToHash[req.IssuerHash]
 		if !ok {
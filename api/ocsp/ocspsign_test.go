@@ -2,6 +2,7 @@ package ocsp
 
 import (
 	"bytes"
+	"crypto"
 	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/api/client"
 	"github.com/cloudflare/cfssl/ocsp"
 	goocsp "golang.org/x/crypto/ocsp"
 
@@ -240,3 +242,64 @@ func TestSign(t *testing.T) {
 		}
 	}
 }
+
+func TestRemoteSigner(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/cfssl/ocspsign", newTestHandler(t))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	certPEM, err := ioutil.ReadFile(testCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ocsp.NewRemoteSigner(client.NewServer(ts.URL))
+	revokedAt := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	thisUpdate := time.Now().UTC().Truncate(time.Second)
+	nextUpdate := thisUpdate.Add(time.Hour)
+	der, err := s.Sign(ocsp.SignRequest{
+		Certificate: cert,
+		Status:      "revoked",
+		Reason:      goocsp.KeyCompromise,
+		RevokedAt:   revokedAt,
+		IssuerHash:  crypto.SHA256,
+		ThisUpdate:  &thisUpdate,
+		NextUpdate:  &nextUpdate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := goocsp.ParseResponse(der, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != goocsp.Revoked || resp.RevocationReason != goocsp.KeyCompromise {
+		t.Fatalf("unexpected status %d and reason %d", resp.Status, resp.RevocationReason)
+	}
+	if !resp.RevokedAt.Equal(revokedAt) {
+		t.Fatalf("expected revocation time %v, have %v", revokedAt, resp.RevokedAt)
+	}
+	if !resp.ThisUpdate.Equal(thisUpdate) || !resp.NextUpdate.Equal(nextUpdate) {
+		t.Fatalf("expected updates %v and %v, have %v and %v", thisUpdate, nextUpdate, resp.ThisUpdate, resp.NextUpdate)
+	}
+	if resp.IssuerHash != crypto.SHA256 {
+		t.Fatalf("expected issuer hash %v, have %v", crypto.SHA256, resp.IssuerHash)
+	}
+
+	_, err = s.Sign(ocsp.SignRequest{Certificate: cert, Status: "unknown-status"})
+	if err == nil {
+		t.Fatal("expected the remote to reject an invalid status")
+	}
+
+	// Authenticated remotes don't sign OCSP responses.
+	s = ocsp.NewRemoteSigner(client.NewAuthServer(ts.URL, nil, nil))
+	if _, err = s.Sign(ocsp.SignRequest{Certificate: cert, Status: "good"}); err == nil {
+		t.Fatal("expected a remote that isn't an OCSPSigner to be refused")
+	}
+}
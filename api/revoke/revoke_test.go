@@ -20,6 +20,7 @@ import (
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/events"
 	"github.com/cloudflare/cfssl/ocsp"
 
 	stdocsp "golang.org/x/crypto/ocsp"
@@ -96,11 +97,17 @@ func TestRevocation(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	published, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+
 	resp, body := testRevokeCert(t, dbAccessor, "1", fakeAKI, "5")
 
 	if resp.StatusCode != http.StatusOK {
 		t.Fatal("unexpected HTTP status code; expected OK", string(body))
 	}
+	if e := <-published; e.Type != events.CertificateRevoked || e.Serial != "1" || e.Reason == nil || *e.Reason != 5 {
+		t.Errorf("unexpected revocation event %+v", e)
+	}
 	message := new(api.Response)
 	err = json.Unmarshal(body, message)
 	if err != nil {
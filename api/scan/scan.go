@@ -15,7 +15,7 @@ import (
 // family and scanner, and uses these to perform scans, returning a JSON blob result.
 func scanHandler(w http.ResponseWriter, r *http.Request) error {
 	if err := r.ParseForm(); err != nil {
-		log.Warningf("failed to parse body: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to parse body: %v", err)
 		return errors.NewBadRequest(err)
 	}
 
@@ -38,7 +38,7 @@ func scanHandler(w http.ResponseWriter, r *http.Request) error {
 
 	host := r.Form.Get("host")
 	if host == "" {
-		log.Warningf("no host given")
+		log.FromContext(r.Context()).Warningf("no host given")
 		return errors.NewBadRequestString("no host given")
 	}
 
@@ -61,7 +61,7 @@ func NewHandler(caBundleFile string) (http.Handler, error) {
 // scanInfoHandler is an HTTP handler that returns a JSON blob result describing
 // the possible families and scans to be run.
 func scanInfoHandler(w http.ResponseWriter, r *http.Request) error {
-	log.Info("setting up scaninfo handler")
+	log.FromContext(r.Context()).Info("setting up scaninfo handler")
 	response := api.NewSuccessResponse(scan.Default)
 	enc := json.NewEncoder(w)
 	return enc.Encode(response)
@@ -0,0 +1,163 @@
+package signhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// BulkContentType is the media type of the request and response bodies
+// of the bulk signing endpoint: a stream of JSON objects, one per line.
+const BulkContentType = "application/x-ndjson"
+
+// MaxBulkRequestSize bounds the size of the body of a bulk signing
+// request, all its sign requests included.
+const MaxBulkRequestSize = 16 << 20
+
+// A BulkResult is the outcome of one request of a bulk signing request.
+// Index is the position of the request in the stream, starting at zero.
+type BulkResult struct {
+	Index       int                  `json:"index"`
+	Certificate string               `json:"certificate,omitempty"`
+	Error       *api.ResponseMessage `json:"error,omitempty"`
+}
+
+// A BulkHandler signs a stream of certificate requests, writing each
+// certificate back as soon as it is signed, so that many certificates
+// can be issued over a single HTTP request.
+type BulkHandler struct {
+	signer signer.Signer
+}
+
+// NewBulkHandlerFromSigner returns a BulkHandler signing with s.
+func NewBulkHandlerFromSigner(s signer.Signer) (*BulkHandler, error) {
+	policy := s.Policy()
+	if policy == nil || policy.Default == nil {
+		return nil, errors.New(errors.PolicyError, errors.InvalidPolicy)
+	}
+	return &BulkHandler{signer: s}, nil
+}
+
+// ServeHTTP reads sign requests from the request body, one JSON object
+// per line. Each is either a request for the sign endpoint, for a
+// profile without authentication, or an authenticated request for the
+// authsign endpoint. A BulkResult is written for each of them, in order,
+// one JSON object per line. Failing requests don't stop the stream, but
+// a malformed one ends it.
+func (h *BulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = api.WithRequestID(w, r)
+	if r.Method != "POST" {
+		api.HandleError(w, errors.NewMethodNotAllowed(r.Method))
+		return
+	}
+	defer r.Body.Close()
+
+	// An HTTP/1.x server can't read the request body anymore once it
+	// has started writing the response, so there the requests are all
+	// read first. Over HTTP/2, they are read as they are signed.
+	body := io.Reader(http.MaxBytesReader(w, r.Body, MaxBulkRequestSize))
+	if r.ProtoMajor < 2 {
+		buf, err := ioutil.ReadAll(body)
+		if err != nil {
+			api.HandleError(w, errors.NewBadRequest(err))
+			return
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	// Each result is sent as soon as the certificate is signed, in a
+	// chunk of its own over HTTP/1.1.
+	w.Header().Set("Content-Type", BulkContentType)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	dec := json.NewDecoder(body)
+
+	var signed, failed int
+	for index := 0; ; index++ {
+		var line json.RawMessage
+		err := dec.Decode(&line)
+		if err == io.EOF {
+			break
+		}
+		malformed := err != nil
+
+		result := BulkResult{Index: index}
+		var cert []byte
+		if malformed {
+			err = errors.NewBadRequestString("Unable to parse sign request")
+		} else {
+			cert, err = h.sign(r, line)
+		}
+		if err != nil {
+			result.Error = bulkError(err)
+			failed++
+		} else {
+			result.Certificate = string(cert)
+			signed++
+		}
+
+		if err = enc.Encode(result); err != nil {
+			log.FromContext(r.Context()).Errorf("failed to write bulk signing result: %v", err)
+			return
+		} else if flusher != nil {
+			flusher.Flush()
+		}
+		if malformed {
+			break
+		}
+	}
+
+	log.FromContext(r.Context()).Infof("%s - \"%s %s\" signed %d certificates, %d failed", r.RemoteAddr, r.Method, r.URL, signed, failed)
+}
+
+// sign signs a single request of the stream.
+func (h *BulkHandler) sign(r *http.Request, line json.RawMessage) ([]byte, error) {
+	// Authenticated requests wrap the sign request in a request field.
+	var probe struct {
+		Request json.RawMessage `json:"request"`
+	}
+	if err := json.Unmarshal(line, &probe); err != nil {
+		return nil, errors.NewBadRequestString("Unable to parse sign request")
+	}
+
+	var signReq signer.SignRequest
+	var err error
+	if probe.Request != nil {
+		var aReq auth.AuthenticatedRequest
+		if err = json.Unmarshal(line, &aReq); err != nil {
+			return nil, errors.NewBadRequest(err)
+		}
+		aReq.TLS = r.TLS
+		_, signReq, err = authenticatedSignRequest(h.signer, &aReq)
+	} else {
+		var req jsonSignRequest
+		if err = json.Unmarshal(line, &req); err != nil {
+			return nil, errors.NewBadRequestString("Unable to parse sign request")
+		}
+		signReq, err = unauthenticatedSignRequest(h.signer, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signReq.Logger = log.FromContext(r.Context())
+
+	cert, err := h.signer.Sign(signReq)
+	if err != nil {
+		log.FromContext(r.Context()).Warningf("failed to sign request: %v", err)
+	}
+	return cert, err
+}
+
+// bulkError describes err like the error of an API response.
+func bulkError(err error) *api.ResponseMessage {
+	msg := api.ErrorMessage(err)
+	return &msg
+}
@@ -0,0 +1,172 @@
+package signhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/cfssl/api/client"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer/local"
+)
+
+const bulkAuthKey = "0123456789ABCDEF0123456789ABCDEF"
+
+var bulkConfig = `
+{
+	"signing": {
+		"default": {
+			"usages": ["digital signature", "server auth"],
+			"expiry": "10m"
+		},
+		"profiles": {
+			"authed": {
+				"usages": ["digital signature", "server auth"],
+				"expiry": "10m",
+				"auth_key": "key"
+			}
+		}
+	},
+	"auth_keys": {
+		"key": {"type": "standard", "key": "` + bulkAuthKey + `"}
+	}
+}`
+
+// bulkRequests returns a stream of an unauthenticated request, a request
+// with an invalid CSR, an authenticated request and a request for the
+// authenticated profile without a token.
+func bulkRequests(t *testing.T) []byte {
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := auth.New(bulkAuthKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stream bytes.Buffer
+	enc := json.NewEncoder(&stream)
+	enc.Encode(map[string]string{"certificate_request": string(csrPEM), "hostname": "one.example.com"})
+	enc.Encode(map[string]string{"certificate_request": "not a CSR"})
+
+	authed, _ := json.Marshal(map[string]string{"certificate_request": string(csrPEM), "profile": "authed"})
+	token, err := provider.Token(authed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.Encode(auth.AuthenticatedRequest{Token: token, Request: authed})
+
+	enc.Encode(map[string]string{"certificate_request": string(csrPEM), "profile": "authed"})
+	return stream.Bytes()
+}
+
+func newBulkServer(t *testing.T) *httptest.Server {
+	conf, err := config.LoadConfig([]byte(bulkConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, conf.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewBulkHandlerFromSigner(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/cfssl/bulk_sign", h)
+	return httptest.NewServer(mux)
+}
+
+func TestBulkSign(t *testing.T) {
+	ts := newBulkServer(t)
+	defer ts.Close()
+
+	var results []client.BulkSignResult
+	err := client.NewServer(ts.URL).BulkSign(bytes.NewReader(bulkRequests(t)), func(res client.BulkSignResult) {
+		results = append(results, res)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	for i, res := range results {
+		if res.Index != i {
+			t.Fatalf("result %d has index %d", i, res.Index)
+		}
+		valid := i == 0 || i == 2
+		if valid && res.Err != nil {
+			t.Fatalf("request %d failed: %v", i, res.Err)
+		}
+		if !valid && res.Err == nil {
+			t.Fatalf("request %d should have failed", i)
+		}
+		if valid {
+			if _, err := helpers.ParseCertificatePEM(res.Certificate); err != nil {
+				t.Fatalf("request %d: %v", i, err)
+			}
+		}
+	}
+}
+
+func TestBulkSignMalformed(t *testing.T) {
+	ts := newBulkServer(t)
+	defer ts.Close()
+
+	stream := []byte(`{"certificate_request": "x"}` + "\n{not json\n" + `{"certificate_request": "y"}`)
+	var results []client.BulkSignResult
+	err := client.NewServer(ts.URL).BulkSign(bytes.NewReader(stream), func(res client.BulkSignResult) {
+		results = append(results, res)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The malformed request ends the stream.
+	if len(results) != 2 || results[0].Err == nil || results[1].Err == nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/v1/cfssl/bulk_sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be rejected, got %s", resp.Status)
+	}
+}
+
+func TestBulkSignHTTP1(t *testing.T) {
+	ts := newBulkServer(t)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/v1/cfssl/bulk_sign", BulkContentType, bytes.NewReader(bulkRequests(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// The results are flushed one by one rather than written at once.
+	if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("expected a chunked response, got %v", resp.TransferEncoding)
+	}
+
+	large := bytes.Repeat([]byte(" "), MaxBulkRequestSize+1)
+	resp, err = http.Post(ts.URL+"/api/v1/cfssl/bulk_sign", BulkContentType, bytes.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a request over the size limit to be rejected, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,240 @@
+package signhandler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/bundler"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// The statuses of an Order.
+const (
+	OrderPending = "pending"
+	OrderIssued  = "issued"
+	OrderDenied  = "denied"
+)
+
+// An Order tracks a sign request signed asynchronously. Once issued, it
+// holds the certificate, and its bundle if one was requested; once
+// denied, the error signing failed with. Orders are only kept in the
+// memory of the server they were placed with: they are lost when it
+// restarts, and can't be polled from another server behind the same
+// address.
+type Order struct {
+	ID          string               `json:"id"`
+	Status      string               `json:"status"`
+	Certificate string               `json:"certificate,omitempty"`
+	Bundle      *bundler.Bundle      `json:"bundle,omitempty"`
+	Error       *api.ResponseMessage `json:"error,omitempty"`
+}
+
+// OrderRetention is how long an order can still be polled after it was
+// issued or denied.
+var OrderRetention = 24 * time.Hour
+
+// orderEntry is an order along with the time it was completed.
+type orderEntry struct {
+	order     Order
+	completed time.Time
+}
+
+// The orders placed by the sign and authsign endpoints, and reported by
+// the order endpoint.
+var orders = struct {
+	sync.Mutex
+	entries map[string]*orderEntry
+}{entries: map[string]*orderEntry{}}
+
+// MaxQueuedOrders is how many orders can wait to be signed; orders
+// placed while the queue is full are refused.
+var MaxQueuedOrders = 256
+
+// OrderWorkers is how many orders are signed at once.
+var OrderWorkers = 4
+
+// An orderQueue signs the orders placed with a fixed number of workers,
+// started with the first order.
+type orderQueue struct {
+	start   sync.Once
+	jobs    chan func()
+	workers sync.WaitGroup
+
+	// mu guards closed, and is held for reading while jobs are queued
+	// so that jobs is not closed underneath them.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// queue signs the orders placed by the sign and authsign endpoints.
+var queue = &orderQueue{}
+
+// put queues job, or returns false if the queue is full or drained.
+func (q *orderQueue) put(job func()) bool {
+	q.start.Do(func() {
+		q.jobs = make(chan func(), MaxQueuedOrders)
+		for i := 0; i < OrderWorkers; i++ {
+			q.workers.Add(1)
+			go func() {
+				defer q.workers.Done()
+				for job := range q.jobs {
+					job()
+				}
+			}()
+		}
+	})
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain refuses new jobs and waits up to timeout for the queued ones to
+// complete.
+func (q *orderQueue) drain(timeout time.Duration) error {
+	q.start.Do(func() {})
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		if q.jobs != nil {
+			close(q.jobs)
+		}
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("orders still pending after %s", timeout)
+	}
+}
+
+// DrainOrders stops accepting asynchronous sign requests and waits up to
+// timeout for the orders already placed to be signed, so that the signer
+// and the cert db can then be closed. Orders are kept in memory only, so
+// those still pending when the server stops are lost.
+func DrainOrders(timeout time.Duration) error {
+	return queue.drain(timeout)
+}
+
+// placeOrder records a new pending order, and queues it to be completed
+// with the outcome of sign.
+func placeOrder(sign func(*Order) error) (Order, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Order{}, err
+	}
+	order := Order{ID: hex.EncodeToString(id), Status: OrderPending}
+
+	orders.Lock()
+	now := time.Now()
+	for id, entry := range orders.entries {
+		if entry.order.Status != OrderPending && now.Sub(entry.completed) > OrderRetention {
+			delete(orders.entries, id)
+		}
+	}
+	orders.entries[order.ID] = &orderEntry{order: order}
+	orders.Unlock()
+
+	queued := queue.put(func() {
+		completed := order
+		if err := sign(&completed); err != nil {
+			log.Warningf("order %s denied: %v", order.ID, err)
+			completed = Order{ID: order.ID, Status: OrderDenied, Error: bulkError(err)}
+		} else {
+			log.Infof("order %s issued", order.ID)
+			completed.Status = OrderIssued
+		}
+
+		orders.Lock()
+		orders.entries[order.ID] = &orderEntry{order: completed, completed: time.Now()}
+		orders.Unlock()
+	})
+	if !queued {
+		orders.Lock()
+		delete(orders.entries, order.ID)
+		orders.Unlock()
+		return Order{}, errors.NewServiceUnavailableString("too many pending orders, try again later")
+	}
+	return order, nil
+}
+
+// lookupOrder returns the order with the given ID, if it is known.
+func lookupOrder(id string) (Order, bool) {
+	orders.Lock()
+	defer orders.Unlock()
+	entry, ok := orders.entries[id]
+	if !ok || (entry.order.Status != OrderPending && time.Since(entry.completed) > OrderRetention) {
+		return Order{}, false
+	}
+	return entry.order, true
+}
+
+// signAsync places an order for signReq, signed by s and bundled by b if
+// bundle is set, and responds with the pending order.
+func signAsync(w http.ResponseWriter, s signer.Signer, b *bundler.Bundler, signReq signer.SignRequest, bundle bool) error {
+	if bundle && b == nil {
+		return errors.NewBadRequestString(NoBundlerMessage)
+	}
+
+	order, err := placeOrder(func(order *Order) error {
+		cert, err := s.Sign(signReq)
+		if err != nil {
+			return err
+		}
+		order.Certificate = string(cert)
+		if bundle {
+			order.Bundle, err = b.BundleFromPEMorDER(cert, nil, bundler.Optimal, "")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("placed order %s", order.ID)
+	return api.SendResponse(w, order)
+}
+
+// An OrderHandler reports the orders placed by asynchronous sign
+// requests, at /api/v1/cfssl/order/{id}.
+type OrderHandler struct{}
+
+// NewOrderHandler returns a handler reporting the orders placed by the
+// sign and authsign endpoints.
+func NewOrderHandler() http.Handler {
+	return &api.HTTPHandler{
+		Handler: OrderHandler{},
+		Methods: []string{"GET"},
+	}
+}
+
+// Handle responds with the order whose ID ends the request path.
+func (h OrderHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	order, ok := lookupOrder(path.Base(r.URL.Path))
+	if !ok {
+		return errors.NewNotFoundString("no such order")
+	}
+	return api.SendResponse(w, order)
+}
@@ -0,0 +1,157 @@
+package signhandler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/api/client"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer/local"
+)
+
+func newOrderServer(t *testing.T) *httptest.Server {
+	conf, err := config.LoadConfig([]byte(bulkConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, conf.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signHandler, err := NewHandlerFromSigner(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authHandler, err := NewAuthHandlerFromSigner(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/cfssl/sign", signHandler)
+	mux.Handle("/api/v1/cfssl/authsign", authHandler)
+	mux.Handle("/api/v1/cfssl/order/", NewOrderHandler())
+	return httptest.NewServer(mux)
+}
+
+// waitOrder polls the order with the given ID until it is completed.
+func waitOrder(t *testing.T, remote client.Remote, id string) *client.Order {
+	for i := 0; i < 100; i++ {
+		order, err := remote.PollOrder(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if order.ID != id {
+			t.Fatalf("polled order %s, got %s", id, order.ID)
+		}
+		if order.Status != client.OrderPending {
+			return order
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("order %s is still pending", id)
+	return nil
+}
+
+func TestSignAsync(t *testing.T) {
+	ts := newOrderServer(t)
+	defer ts.Close()
+
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := json.Marshal(map[string]interface{}{"certificate_request": string(csrPEM), "hostname": "async.example.com", "async": true})
+
+	// Unauthenticated requests can't be signed asynchronously.
+	remote := client.NewServer(ts.URL)
+	if _, err = remote.Sign(req); err == nil {
+		t.Fatal("expected an unauthenticated asynchronous request to be refused")
+	}
+	if _, err = remote.PollOrder("unknown"); err == nil {
+		t.Fatal("polled an unknown order")
+	}
+}
+
+func TestAuthSignAsync(t *testing.T) {
+	ts := newOrderServer(t)
+	defer ts.Close()
+
+	csrPEM, err := ioutil.ReadFile(testCSRFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := auth.New(bulkAuthKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := json.Marshal(map[string]string{"certificate_request": string(csrPEM), "profile": "authed"})
+
+	remote := client.NewAuthServer(ts.URL, nil, provider)
+	id, err := remote.AuthSignAsync(req, nil, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := waitOrder(t, remote, id)
+	if order.Status != client.OrderIssued {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	if _, err = helpers.ParseCertificatePEM(order.Certificate); err != nil {
+		t.Fatal(err)
+	}
+
+	// A request failing to sign is denied.
+	req, _ = json.Marshal(map[string]string{"certificate_request": "not a CSR", "profile": "authed"})
+	if id, err = remote.AuthSignAsync(req, nil, provider); err != nil {
+		t.Fatal(err)
+	}
+	order = waitOrder(t, remote, id)
+	if order.Status != client.OrderDenied || order.Err == nil || order.Certificate != nil {
+		t.Fatalf("unexpected order %+v", order)
+	}
+}
+
+func TestOrderQueue(t *testing.T) {
+	defer func(n, workers int) { MaxQueuedOrders, OrderWorkers = n, workers }(MaxQueuedOrders, OrderWorkers)
+	MaxQueuedOrders, OrderWorkers = 1, 1
+
+	q := &orderQueue{}
+	block := make(chan struct{})
+	var signed int32
+	job := func() {
+		<-block
+		atomic.AddInt32(&signed, 1)
+	}
+	// The worker takes the first job and waits, the second one fills
+	// the queue and the third is refused.
+	if !q.put(job) {
+		t.Fatal("expected the first job to be queued")
+	}
+	for i := 0; i < 100 && !q.put(job); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if q.put(job) {
+		t.Fatal("expected a job to be refused when the queue is full")
+	}
+
+	if err := q.drain(10 * time.Millisecond); err == nil {
+		t.Fatal("expected draining to time out while jobs are pending")
+	}
+	close(block)
+	if err := q.drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&signed); n != 2 {
+		t.Fatalf("expected the queued jobs to be completed, %d were", n)
+	}
+	if q.put(func() {}) {
+		t.Fatal("expected a job to be refused once the queue is drained")
+	}
+}
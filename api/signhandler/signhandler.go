@@ -66,14 +66,16 @@ func (h *Handler) SetBundler(caBundleFile, intBundleFile string) (err error) {
 // hostname field in the API
 // TODO: Change the API such that the normal struct can be used.
 type jsonSignRequest struct {
-	Hostname string          `json:"hostname"`
-	Hosts    []string        `json:"hosts"`
-	Request  string          `json:"certificate_request"`
-	Subject  *signer.Subject `json:"subject,omitempty"`
-	Profile  string          `json:"profile"`
-	Label    string          `json:"label"`
-	Serial   *big.Int        `json:"serial,omitempty"`
-	Bundle   bool            `json:"bundle"`
+	Hostname string            `json:"hostname"`
+	Hosts    []string          `json:"hosts"`
+	Request  string            `json:"certificate_request"`
+	Subject  *signer.Subject   `json:"subject,omitempty"`
+	Profile  string            `json:"profile"`
+	Label    string            `json:"label"`
+	Serial   *big.Int          `json:"serial,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Bundle   bool              `json:"bundle"`
+	Async    bool              `json:"async"`
 }
 
 func jsonReqToTrue(js jsonSignRequest) signer.SignRequest {
@@ -93,6 +95,7 @@ func jsonReqToTrue(js jsonSignRequest) signer.SignRequest {
 			Profile: js.Profile,
 			Label:   js.Label,
 			Serial:  js.Serial,
+			Labels:  js.Labels,
 		}
 	}
 
@@ -103,16 +106,37 @@ func jsonReqToTrue(js jsonSignRequest) signer.SignRequest {
 		Profile: js.Profile,
 		Label:   js.Label,
 		Serial:  js.Serial,
+		Labels:  js.Labels,
 	}
 }
 
+// unauthenticatedSignRequest checks that req is for a profile that
+// doesn't require authentication, and returns the request to sign.
+func unauthenticatedSignRequest(s signer.Signer, req jsonSignRequest) (signer.SignRequest, error) {
+	if req.Request == "" {
+		return signer.SignRequest{}, errors.NewBadRequestString("missing parameter 'certificate_request'")
+	}
+
+	profile, err := signer.Profile(s, req.Profile)
+	if err != nil {
+		return signer.SignRequest{}, err
+	}
+
+	if profile.Provider != nil {
+		log.Error("profile requires authentication")
+		return signer.SignRequest{}, errors.NewBadRequestString("authentication required")
+	}
+	return jsonReqToTrue(req), nil
+}
+
 // Handle responds to requests for the CA to sign the certificate request
 // present in the "certificate_request" parameter for the host named
 // in the "hostname" parameter. The certificate should be PEM-encoded. If
 // provided, subject information from the "subject" parameter will be used
-// in place of the subject information from the CSR.
+// in place of the subject information from the CSR. Asynchronous
+// requests are refused: they are only accepted by the AuthHandler.
 func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
-	log.Info("signature request received")
+	log.FromContext(r.Context()).Info("signature request received")
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -127,26 +151,19 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 		return errors.NewBadRequestString("Unable to parse sign request")
 	}
 
-	signReq := jsonReqToTrue(req)
-
-	if req.Request == "" {
-		return errors.NewBadRequestString("missing parameter 'certificate_request'")
+	if req.Async {
+		return errors.NewBadRequestString("asynchronous sign requests must be authenticated")
 	}
 
-	var cert []byte
-	profile, err := signer.Profile(h.signer, req.Profile)
+	signReq, err := unauthenticatedSignRequest(h.signer, req)
 	if err != nil {
 		return err
 	}
+	signReq.Logger = log.FromContext(r.Context())
 
-	if profile.Provider != nil {
-		log.Error("profile requires authentication")
-		return errors.NewBadRequestString("authentication required")
-	}
-
-	cert, err = h.signer.Sign(signReq)
+	cert, err := h.signer.Sign(signReq)
 	if err != nil {
-		log.Warningf("failed to sign request: %v", err)
+		log.FromContext(r.Context()).Warningf("failed to sign request: %v", err)
 		return err
 	}
 
@@ -164,7 +181,7 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 
 		result["bundle"] = bundle
 	}
-	log.Info("wrote response")
+	log.FromContext(r.Context()).Info("wrote response")
 	return api.SendResponse(w, result)
 }
 
@@ -215,69 +232,97 @@ func (h *AuthHandler) SetBundler(caBundleFile, intBundleFile string) (err error)
 	return err
 }
 
-// Handle receives the incoming request, validates it, and processes it.
-func (h *AuthHandler) Handle(w http.ResponseWriter, r *http.Request) error {
-	log.Info("signature request received")
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Errorf("failed to read response body: %v", err)
-		return err
-	}
-	r.Body.Close()
-
-	var aReq auth.AuthenticatedRequest
-	err = json.Unmarshal(body, &aReq)
-	if err != nil {
-		log.Errorf("failed to unmarshal authenticated request: %v", err)
-		return errors.NewBadRequest(err)
-	}
-
+// authenticatedSignRequest verifies the token of aReq for the profile
+// it is for, and returns the sign request it carries and the request to
+// sign.
+func authenticatedSignRequest(s signer.Signer, aReq *auth.AuthenticatedRequest) (jsonSignRequest, signer.SignRequest, error) {
 	var req jsonSignRequest
-	err = json.Unmarshal(aReq.Request, &req)
+	err := json.Unmarshal(aReq.Request, &req)
 	if err != nil {
 		log.Errorf("failed to unmarshal request from authenticated request: %v", err)
-		return errors.NewBadRequestString("Unable to parse authenticated sign request")
+		return req, signer.SignRequest{}, errors.NewBadRequestString("Unable to parse authenticated sign request")
 	}
 
 	// Sanity checks to ensure that we have a valid policy. This
 	// should have been checked in NewAuthHandler.
-	policy := h.signer.Policy()
+	policy := s.Policy()
 	if policy == nil {
 		log.Critical("signer was initialised without a signing policy")
-		return errors.NewBadRequestString("invalid policy")
+		return req, signer.SignRequest{}, errors.NewBadRequestString("invalid policy")
 	}
 
-	profile, err := signer.Profile(h.signer, req.Profile)
+	profile, err := signer.Profile(s, req.Profile)
 	if err != nil {
-		return err
+		return req, signer.SignRequest{}, err
 	}
 
 	if profile.Provider == nil {
 		log.Error("profile has no authentication provider")
-		return errors.NewBadRequestString("no authentication provider")
+		return req, signer.SignRequest{}, errors.NewBadRequestString("no authentication provider")
 	}
 
-	validAuth := false
-	if profile.Provider.Verify(&aReq) {
-		validAuth = true
-	} else if profile.PrevProvider != nil && profile.PrevProvider.Verify(&aReq) {
-		validAuth = true
+	var provider auth.Provider
+	requester := profile.AuthKeyName
+	if profile.Provider.Verify(aReq) {
+		provider = profile.Provider
+	} else if profile.PrevProvider != nil && profile.PrevProvider.Verify(aReq) {
+		provider = profile.PrevProvider
+		requester = profile.PrevAuthKeyName
 	}
-	if !validAuth {
+	if provider == nil {
 		log.Warning("received authenticated request with invalid token")
-		return errors.NewBadRequestString("invalid token")
+		return req, signer.SignRequest{}, errors.NewBadRequestString("invalid token")
 	}
 
 	signReq := jsonReqToTrue(req)
+	signReq.Requester = requester
 
 	if signReq.Request == "" {
-		return errors.NewBadRequestString("missing parameter 'certificate_request'")
+		return req, signer.SignRequest{}, errors.NewBadRequestString("missing parameter 'certificate_request'")
+	}
+
+	// The names are checked on the request as it will be signed, once
+	// the hostname and hosts have been resolved.
+	err = auth.VerifyNames(provider, aReq, signReq.Hosts, []byte(signReq.Request), signReq.Subject != nil)
+	if err != nil {
+		log.Warningf("authenticated request for names its requester can't have: %v", err)
+		return req, signer.SignRequest{}, errors.NewBadRequestString("names not allowed for the requester")
+	}
+	return req, signReq, nil
+}
+
+// Handle receives the incoming request, validates it, and processes it.
+func (h *AuthHandler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.FromContext(r.Context()).Info("signature request received")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.FromContext(r.Context()).Errorf("failed to read response body: %v", err)
+		return err
+	}
+	r.Body.Close()
+
+	var aReq auth.AuthenticatedRequest
+	err = json.Unmarshal(body, &aReq)
+	if err != nil {
+		log.FromContext(r.Context()).Errorf("failed to unmarshal authenticated request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	aReq.TLS = r.TLS
+
+	req, signReq, err := authenticatedSignRequest(h.signer, &aReq)
+	if err != nil {
+		return err
+	}
+	signReq.Logger = log.FromContext(r.Context())
+
+	if req.Async {
+		return signAsync(w, h.signer, h.bundler, signReq, req.Bundle)
 	}
 
 	cert, err := h.signer.Sign(signReq)
 	if err != nil {
-		log.Errorf("signature failed: %v", err)
+		log.FromContext(r.Context()).Errorf("signature failed: %v", err)
 		return err
 	}
 
@@ -295,6 +340,6 @@ func (h *AuthHandler) Handle(w http.ResponseWriter, r *http.Request) error {
 
 		result["bundle"] = bundle
 	}
-	log.Info("wrote response")
+	log.FromContext(r.Context()).Info("wrote response")
 	return api.SendResponse(w, result)
 }
@@ -2,13 +2,24 @@ package signhandler
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certdb/testdb"
@@ -111,3 +122,94 @@ func TestSignerDBPersistence(t *testing.T) {
 		t.Fatal("Expected 1 unexpired certificate in the database after signing 1: len(crs)=", len(crs))
 	}
 }
+
+func TestSPIFFENames(t *testing.T) {
+	bundleKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundleTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "SPIRE CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, bundleTemplate, bundleTemplate, bundleKey.Public(), bundleKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svidKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/web"}},
+	}, bundle, svidKey.Public(), bundleKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svid, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := auth.NewSPIFFE(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bundle.Raw})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, &config.Signing{Default: &config.SigningProfile{
+		Usage:        []string{"digital signature", "client auth"},
+		ExpiryString: "1h",
+		Expiry:       time.Hour,
+		Provider:     provider,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/web"}},
+	}, csrKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+
+	for _, test := range []struct {
+		request map[string]interface{}
+		ok      bool
+	}{
+		{map[string]interface{}{"certificate_request": csrPEM}, true},
+		{map[string]interface{}{"certificate_request": csrPEM, "hostname": "spiffe://example.org/web"}, true},
+		// The hostname takes precedence over the hosts.
+		{map[string]interface{}{"certificate_request": csrPEM, "hosts": []string{"spiffe://example.org/web"},
+			"hostname": "spiffe://example.org/db"}, false},
+		{map[string]interface{}{"certificate_request": csrPEM, "hostname": "web.example.org"}, false},
+		{map[string]interface{}{"certificate_request": csrPEM, "subject": map[string]string{"CN": "web.example.org"}}, false},
+	} {
+		body, _ := json.Marshal(test.request)
+		aReq := &auth.AuthenticatedRequest{
+			Request: body,
+			TLS:     &tls.ConnectionState{PeerCertificates: []*x509.Certificate{svid}},
+		}
+		_, _, err := authenticatedSignRequest(s, aReq)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: expected ok=%v, got %v", test.request, test.ok, err)
+		}
+	}
+}
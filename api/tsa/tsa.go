@@ -0,0 +1,52 @@
+// Package tsa implements the HTTP handler for RFC 3161 time-stamp requests.
+package tsa
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/tsa"
+)
+
+// maxRequestSize bounds the size of a TimeStampReq; real requests are a
+// few hundred bytes at most.
+const maxRequestSize = 1 << 16
+
+// A Handler accepts DER-encoded TimeStampReq messages (RFC 3161 section
+// 3.4, content type application/timestamp-query) and answers them with a
+// DER-encoded TimeStampResp.
+type Handler struct {
+	signer *tsa.Signer
+}
+
+// NewHandler returns a new http.Handler that handles time-stamp requests.
+func NewHandler(s *tsa.Signer) http.Handler {
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			signer: s,
+		},
+		Methods: []string{"POST"},
+	}
+}
+
+// Handle responds to a time-stamp request. Requests the TSA refuses are
+// still answered with a TimeStampResp carrying a rejection status.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+
+	resp, err := h.signer.Respond(body)
+	if err != nil {
+		log.FromContext(r.Context()).Errorf("failed to respond to time-stamp request: %v", err)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	_, err = w.Write(resp)
+	return err
+}
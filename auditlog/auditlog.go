@@ -0,0 +1,211 @@
+// Package auditlog builds a static, Certificate Transparency style log of
+// the certificates recorded in a certificate database: the certificates
+// are the leaves of a Merkle tree hashed as in RFC 6962, and the log is
+// committed to by a signed tree head, so that the inclusion of any
+// certificate can be proven later.
+package auditlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// A Leaf is a certificate in the log.
+type Leaf struct {
+	Serial string `json:"serial_number"`
+	AKI    string `json:"authority_key_identifier"`
+	// Certificate is the DER encoded certificate, the data of the leaf.
+	Certificate []byte `json:"certificate"`
+	LeafHash    []byte `json:"leaf_hash"`
+}
+
+// A TreeHead commits to the contents of a log, like the signed tree head
+// of RFC 6962 section 3.5.
+type TreeHead struct {
+	TreeSize uint64 `json:"tree_size"`
+	// Timestamp is the time the tree head was signed, in milliseconds
+	// since the epoch.
+	Timestamp uint64 `json:"timestamp"`
+	RootHash  []byte `json:"sha256_root_hash"`
+	Signature []byte `json:"tree_head_signature"`
+}
+
+// signedData returns the TreeHeadSignature structure of RFC 6962 section
+// 3.5 that the signature covers.
+func (th *TreeHead) signedData() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0) // version v1
+	buf.WriteByte(1) // signature type tree_hash
+	binary.Write(&buf, binary.BigEndian, th.Timestamp)
+	binary.Write(&buf, binary.BigEndian, th.TreeSize)
+	buf.Write(th.RootHash)
+	return buf.Bytes()
+}
+
+// Sign signs the tree head with key. ECDSA and RSA keys sign a SHA-256
+// digest, RSA with PKCS #1 v1.5; Ed25519 keys sign the data directly.
+func (th *TreeHead) Sign(key crypto.Signer) (err error) {
+	data := th.signedData()
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		th.Signature, err = key.Sign(rand.Reader, data, crypto.Hash(0))
+		return err
+	}
+	digest := sha256.Sum256(data)
+	th.Signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	return err
+}
+
+// Verify checks the signature of the tree head against pub.
+func (th *TreeHead) Verify(pub crypto.PublicKey) error {
+	data := th.signedData()
+	digest := sha256.Sum256(data)
+	var ok bool
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest[:], th.Signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], th.Signature) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, th.Signature)
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if !ok {
+		return errors.New("invalid tree head signature")
+	}
+	return nil
+}
+
+// A Log is the ordered list of leaves of a Merkle tree and its tree head.
+type Log struct {
+	Leaves   []Leaf   `json:"leaves"`
+	TreeHead TreeHead `json:"tree_head"`
+}
+
+// New returns the unsigned log of the certificates in records. Leaves are
+// ordered by the certificates' notBefore, then serial number and
+// authority key identifier.
+func New(records []certdb.CertificateRecord) (*Log, error) {
+	return Extend(nil, records)
+}
+
+// Extend returns the unsigned log that appends the certificates in
+// records that published doesn't hold yet to the leaves of published, a
+// log published before, which may be nil. The published leaves keep
+// their order, so that the new tree extends the published one whatever
+// the order in which certificates were issued or inserted; only the
+// appended leaves are ordered as by New.
+func Extend(published *Log, records []certdb.CertificateRecord) (*Log, error) {
+	l := &Log{Leaves: []Leaf{}}
+	seen := make(map[[2]string]bool)
+	if published != nil {
+		if err := published.check(); err != nil {
+			return nil, fmt.Errorf("published log: %v", err)
+		}
+		for _, leaf := range published.Leaves {
+			l.Leaves = append(l.Leaves, leaf)
+			seen[[2]string{leaf.Serial, leaf.AKI}] = true
+		}
+	}
+
+	type entry struct {
+		leaf      Leaf
+		notBefore time.Time
+	}
+	var entries []entry
+	for _, record := range records {
+		if seen[[2]string{record.Serial, record.AKI}] {
+			continue
+		}
+		cert, err := helpers.ParseCertificatePEM([]byte(record.PEM))
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s from %s: %v", record.Serial, record.AKI, err)
+		}
+		entries = append(entries, entry{
+			leaf: Leaf{
+				Serial:      record.Serial,
+				AKI:         record.AKI,
+				Certificate: cert.Raw,
+				LeafHash:    LeafHash(cert.Raw),
+			},
+			notBefore: cert.NotBefore,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.notBefore.Equal(b.notBefore) {
+			return a.notBefore.Before(b.notBefore)
+		}
+		if a.leaf.Serial != b.leaf.Serial {
+			return a.leaf.Serial < b.leaf.Serial
+		}
+		return a.leaf.AKI < b.leaf.AKI
+	})
+
+	for _, e := range entries {
+		l.Leaves = append(l.Leaves, e.leaf)
+	}
+	l.TreeHead = TreeHead{
+		TreeSize: uint64(len(l.Leaves)),
+		RootHash: RootHash(l.leafHashes()),
+	}
+	return l, nil
+}
+
+func (l *Log) leafHashes() [][]byte {
+	hashes := make([][]byte, len(l.Leaves))
+	for i, leaf := range l.Leaves {
+		hashes[i] = leaf.LeafHash
+	}
+	return hashes
+}
+
+// Sign timestamps and signs the tree head of the log with key.
+func (l *Log) Sign(key crypto.Signer) error {
+	l.TreeHead.Timestamp = uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	return l.TreeHead.Sign(key)
+}
+
+// InclusionProof returns the audit path of the leaf at index.
+func (l *Log) InclusionProof(index int) ([][]byte, error) {
+	return InclusionProof(l.leafHashes(), index)
+}
+
+// Verify checks that the leaf hashes match the certificates, that the
+// tree head matches the leaves, and that it is signed by pub.
+func (l *Log) Verify(pub crypto.PublicKey) error {
+	if err := l.check(); err != nil {
+		return err
+	}
+	return l.TreeHead.Verify(pub)
+}
+
+// check checks that the leaf hashes match the certificates and that the
+// tree head matches the leaves.
+func (l *Log) check() error {
+	for i, leaf := range l.Leaves {
+		if !bytes.Equal(leaf.LeafHash, LeafHash(leaf.Certificate)) {
+			return fmt.Errorf("leaf %d has a wrong leaf hash", i)
+		}
+	}
+	if l.TreeHead.TreeSize != uint64(len(l.Leaves)) {
+		return fmt.Errorf("tree head is for %d leaves, the log has %d", l.TreeHead.TreeSize, len(l.Leaves))
+	}
+	if !bytes.Equal(l.TreeHead.RootHash, RootHash(l.leafHashes())) {
+		return errors.New("tree head root hash does not match the leaves")
+	}
+	return nil
+}
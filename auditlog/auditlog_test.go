@@ -0,0 +1,171 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func TestHashes(t *testing.T) {
+	// Values from the RFC 6962 test vectors of certificate-transparency.
+	if got := hex.EncodeToString(RootHash(nil)); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("unexpected empty tree hash %s", got)
+	}
+	if got := hex.EncodeToString(LeafHash(nil)); got != "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d" {
+		t.Errorf("unexpected empty leaf hash %s", got)
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	var leaves [][]byte
+	for size := 1; size <= 9; size++ {
+		leaves = append(leaves, LeafHash([]byte(fmt.Sprintf("leaf %d", size))))
+		root := RootHash(leaves)
+		for index := range leaves {
+			proof, err := InclusionProof(leaves, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyInclusion(leaves[index], index, size, proof, root); err != nil {
+				t.Errorf("size %d, index %d: %v", size, index, err)
+			}
+
+			if size > 1 {
+				if VerifyInclusion(leaves[(index+1)%size], index, size, proof, root) == nil {
+					t.Errorf("size %d, index %d: proof verifies another leaf", size, index)
+				}
+				if VerifyInclusion(leaves[index], index, size, proof[1:], root) == nil {
+					t.Errorf("size %d, index %d: truncated proof verifies", size, index)
+				}
+			}
+		}
+	}
+
+	if _, err := InclusionProof(leaves, len(leaves)); err == nil {
+		t.Error("expected a proof for a leaf outside of the tree to fail")
+	}
+}
+
+func newRecord(t *testing.T, key *ecdsa.PrivateKey, serial int64, notBefore time.Time) certdb.CertificateRecord {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "auditlog.example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    "aki",
+		PEM:    string(helpers.EncodeCertificatePEM(cert)),
+	}
+}
+
+func TestLog(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	records := []certdb.CertificateRecord{
+		newRecord(t, key, 3, now),
+		newRecord(t, key, 1, now.Add(-2*time.Hour)),
+		newRecord(t, key, 2, now.Add(-time.Hour)),
+	}
+
+	l, err := New(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, leaf := range l.Leaves {
+		if want := fmt.Sprint(i + 1); leaf.Serial != want {
+			t.Errorf("leaf %d has serial %s, expected %s", i, leaf.Serial, want)
+		}
+	}
+	if err := l.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(key.Public()); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := l.InclusionProof(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := LeafHash(l.Leaves[1].Certificate)
+	if err := VerifyInclusion(leaf, 1, int(l.TreeHead.TreeSize), proof, l.TreeHead.RootHash); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Verify(other.Public()) == nil {
+		t.Error("expected the tree head to be rejected with another key")
+	}
+	l.TreeHead.TreeSize--
+	l.Leaves = l.Leaves[:2]
+	if l.Verify(key.Public()) == nil {
+		t.Error("expected a log with a leaf removed to be rejected")
+	}
+}
+
+func TestExtend(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	published, err := New([]certdb.CertificateRecord{
+		newRecord(t, key, 1, now.Add(-time.Hour)),
+		newRecord(t, key, 2, now),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A certificate inserted after the log was published is appended,
+	// even though it was issued before the published ones.
+	records := []certdb.CertificateRecord{
+		newRecord(t, key, 3, now.Add(-2*time.Hour)),
+		newRecord(t, key, 2, now),
+		newRecord(t, key, 1, now.Add(-time.Hour)),
+	}
+	l, err := Extend(published, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"1", "2", "3"} {
+		if l.Leaves[i].Serial != want {
+			t.Fatalf("leaf %d has serial %s, expected %s", i, l.Leaves[i].Serial, want)
+		}
+	}
+	if !bytes.Equal(RootHash(l.leafHashes()[:2]), published.TreeHead.RootHash) {
+		t.Fatal("expected the published tree to be a prefix of the extended one")
+	}
+
+	published.Leaves = published.Leaves[1:]
+	if _, err := Extend(published, records); err == nil {
+		t.Fatal("expected a published log not matching its tree head to be rejected")
+	}
+}
@@ -0,0 +1,110 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Prefixes separating the hashes of leaves from those of interior nodes,
+// as in RFC 6962 section 2.1.
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash returns the Merkle tree hash of a leaf holding data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split returns the largest power of two smaller than n, for n > 1.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// RootHash returns the Merkle tree hash of the tree with the given leaf
+// hashes. The hash of the empty tree is the SHA-256 digest of nothing.
+func RootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		digest := sha256.Sum256(nil)
+		return digest[:]
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(RootHash(leaves[:k]), RootHash(leaves[k:]))
+}
+
+// InclusionProof returns the audit path of the leaf at index in the tree
+// with the given leaf hashes, from the leaf up to the root.
+func InclusionProof(leaves [][]byte, index int) ([][]byte, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d is outside of a tree of size %d", index, len(leaves))
+	}
+	return inclusionProof(leaves, index), nil
+}
+
+func inclusionProof(leaves [][]byte, index int) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if index < k {
+		return append(inclusionProof(leaves[:k], index), RootHash(leaves[k:]))
+	}
+	return append(inclusionProof(leaves[k:], index-k), RootHash(leaves[:k]))
+}
+
+// VerifyInclusion checks that proof shows the leaf with hash leafHash to
+// be at index in the tree of the given size whose hash is root.
+func VerifyInclusion(leafHash []byte, index, size int, proof [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("leaf index %d is outside of a tree of size %d", index, size)
+	}
+
+	// This follows the verification algorithm of RFC 9162 section
+	// 2.1.3.2.
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("inclusion proof is too short")
+	}
+	if !bytes.Equal(r, root) {
+		return errors.New("inclusion proof does not lead to the root hash")
+	}
+	return nil
+}
@@ -2,12 +2,14 @@
 // authentication. This is meant to authenticate a client CFSSL to a
 // remote CFSSL in order to prevent unauthorised use of the signature
 // capabilities. This package provides both the interface and a
-// standard HMAC-based implementation.
+// standard HMAC-based implementation, as well as providers based on
+// API keys, mutual TLS client certificates and JWT bearer tokens.
 package auth
 
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
@@ -24,6 +26,10 @@ type AuthenticatedRequest struct {
 	RemoteAddress []byte `json:"remote_address,omitempty"`
 	Token         []byte `json:"token"`
 	Request       []byte `json:"request"`
+
+	// TLS is the state of the connection the request was received
+	// on, if any. It is filled in by the server, never sent.
+	TLS *tls.ConnectionState `json:"-"`
 }
 
 // A Provider can generate tokens from a request and verify a
@@ -35,6 +41,25 @@ type Provider interface {
 	Verify(aReq *AuthenticatedRequest) bool
 }
 
+// A NameVerifier is a Provider that also restricts the names of the
+// certificates issued for the requests it authenticates, such as the
+// SPIFFE provider.
+type NameVerifier interface {
+	VerifyNames(aReq *AuthenticatedRequest, hosts []string, csrPEM []byte, subjectOverride bool) error
+}
+
+// VerifyNames checks the names of the certificate to be issued for
+// aReq with p, if p is a NameVerifier. It must be given the sign request
+// as the server resolved it: the hosts that override those of the CSR,
+// if any, the CSR, and whether the subject of the CSR is overridden.
+func VerifyNames(p Provider, aReq *AuthenticatedRequest, hosts []string, csrPEM []byte, subjectOverride bool) error {
+	nv, ok := p.(NameVerifier)
+	if !ok {
+		return nil
+	}
+	return nv.VerifyNames(aReq, hosts, csrPEM, subjectOverride)
+}
+
 // Standard implements an HMAC-SHA-256 authentication provider. It may
 // be supplied additional data at creation time that will be used as
 // request || additional-data with the HMAC.
@@ -47,19 +72,9 @@ type Standard struct {
 // and additional data. The additional data will be used when
 // generating a new token.
 func New(key string, ad []byte) (*Standard, error) {
-	if splitKey := strings.SplitN(key, ":", 2); len(splitKey) == 2 {
-		switch splitKey[0] {
-		case "env":
-			key = os.Getenv(splitKey[1])
-		case "file":
-			data, err := ioutil.ReadFile(splitKey[1])
-			if err != nil {
-				return nil, err
-			}
-			key = strings.TrimSpace(string(data))
-		default:
-			return nil, fmt.Errorf("unknown key prefix: %s", splitKey[0])
-		}
+	key, err := loadKey(key)
+	if err != nil {
+		return nil, err
 	}
 
 	keyBytes, err := hex.DecodeString(key)
@@ -70,6 +85,27 @@ func New(key string, ad []byte) (*Standard, error) {
 	return &Standard{keyBytes, ad}, nil
 }
 
+// loadKey resolves a key given as "env:VARIABLE" or "file:path";
+// any other key is returned as is.
+func loadKey(key string) (string, error) {
+	splitKey := strings.SplitN(key, ":", 2)
+	if len(splitKey) != 2 {
+		return key, nil
+	}
+	switch splitKey[0] {
+	case "env":
+		return os.Getenv(splitKey[1]), nil
+	case "file":
+		data, err := ioutil.ReadFile(splitKey[1])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return "", fmt.Errorf("unknown key prefix: %s", splitKey[0])
+	}
+}
+
 // Token generates a new authentication token from the request.
 func (p Standard) Token(req []byte) (token []byte, err error) {
 	h := hmac.New(sha256.New, p.key)
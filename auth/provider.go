@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// NewProvider returns the provider for an auth key of the given type:
+// "standard" for HMAC-SHA-256, "api_key" for static API keys, "mtls"
+// for mutual TLS client certificates, "spiffe" for SPIFFE X.509-SVIDs
+// and "jwt" for JWT bearer tokens. Only JWT clients are created here:
+// a JWT verifier needs an audience and an issuer, given to NewJWT.
+// The additional data is only used by the standard provider.
+func NewProvider(keyType, key string, ad []byte) (Provider, error) {
+	switch keyType {
+	case "standard":
+		return New(key, ad)
+	case "api_key":
+		return NewAPIKey(key)
+	case "mtls":
+		return NewMutualTLS(key)
+	case "spiffe":
+		return NewSPIFFE(key)
+	case "jwt":
+		return NewJWT(key, "", "")
+	default:
+		return nil, fmt.Errorf("unknown authentication type %s", keyType)
+	}
+}
+
+// APIKey implements an authentication provider that expects the
+// request token to be a static API key. Unlike the standard provider,
+// the token does not depend on the request, so each client, or each
+// profile, should be given its own key.
+type APIKey struct {
+	key []byte
+}
+
+// NewAPIKey creates an API key provider from the key, which may be
+// given as "env:VARIABLE" or "file:path".
+func NewAPIKey(key string) (*APIKey, error) {
+	key, err := loadKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("empty API key")
+	}
+	return &APIKey{key: []byte(key)}, nil
+}
+
+// Token returns the API key.
+func (p APIKey) Token(req []byte) (token []byte, err error) {
+	return p.key, nil
+}
+
+// Verify determines whether the request carries the API key.
+func (p APIKey) Verify(ad *AuthenticatedRequest) bool {
+	if ad == nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(p.key, ad.Token) == 1
+}
+
+// MutualTLS implements an authentication provider that accepts
+// requests received over a TLS connection on which the client
+// presented a certificate for client authentication issued by one of
+// its CAs. It generates no tokens: clients authenticate with their
+// TLS certificate.
+type MutualTLS struct {
+	roots *x509.CertPool
+}
+
+// NewMutualTLS creates a mutual TLS provider trusting the PEM-encoded
+// CA certificates in key, which is usually given as "file:path".
+func NewMutualTLS(key string) (*MutualTLS, error) {
+	key, err := loadKey(key)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(key)) {
+		return nil, errors.New("no CA certificates found for mutual TLS")
+	}
+	return &MutualTLS{roots: roots}, nil
+}
+
+// Token returns an empty token.
+func (p MutualTLS) Token(req []byte) (token []byte, err error) {
+	return nil, nil
+}
+
+// Verify determines whether the request was received with a valid
+// client certificate.
+func (p MutualTLS) Verify(ad *AuthenticatedRequest) bool {
+	if ad == nil || ad.TLS == nil || len(ad.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range ad.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := ad.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         p.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+// SPIFFE implements an authentication provider that accepts requests
+// received over a TLS connection on which the client presented a
+// SPIFFE X.509-SVID, such as one issued by SPIRE, and that only ask
+// for certificates naming the SPIFFE ID of that SVID, and no other
+// name. This lets a workload exchange its SVID for a certificate issued
+// by CFSSL.
+type SPIFFE struct {
+	MutualTLS
+}
+
+// NewSPIFFE creates a SPIFFE provider trusting the PEM-encoded trust
+// bundle in key, which is usually given as "file:path".
+func NewSPIFFE(key string) (*SPIFFE, error) {
+	p, err := NewMutualTLS(key)
+	if err != nil {
+		return nil, err
+	}
+	return &SPIFFE{MutualTLS: *p}, nil
+}
+
+// Verify determines whether the request was received with a valid
+// SVID. The names of the request are checked by VerifyNames.
+func (p SPIFFE) Verify(ad *AuthenticatedRequest) bool {
+	if !p.MutualTLS.Verify(ad) {
+		return false
+	}
+	_, ok := SPIFFEID(ad.TLS.PeerCertificates[0])
+	return ok
+}
+
+// subjectAltNameOID is the OID of the subject alternative name
+// extension.
+var subjectAltNameOID = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// VerifyNames checks that the certificate issued for the request names
+// the SPIFFE ID of the SVID the request was received with and nothing
+// else: the hosts, if given, must be that SPIFFE ID alone, otherwise the
+// subject alternative names of the CSR must be, and the subject can't
+// be overridden nor have another common name.
+func (p SPIFFE) VerifyNames(ad *AuthenticatedRequest, hosts []string, csrPEM []byte, subjectOverride bool) error {
+	if ad == nil || ad.TLS == nil || len(ad.TLS.PeerCertificates) == 0 {
+		return errors.New("no SVID")
+	}
+	id, ok := SPIFFEID(ad.TLS.PeerCertificates[0])
+	if !ok {
+		return errors.New("the client certificate is not an SVID")
+	}
+	if subjectOverride {
+		return errors.New("the subject of a certificate for a SPIFFE ID can't be overridden")
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return errors.New("no certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if cn := csr.Subject.CommonName; cn != "" && cn != id {
+		return fmt.Errorf("common name %q is not the SPIFFE ID %s", cn, id)
+	}
+
+	if hosts != nil {
+		if len(hosts) != 1 || hosts[0] != id {
+			return fmt.Errorf("hosts %v are not the SPIFFE ID %s alone", hosts, id)
+		}
+		return nil
+	}
+
+	// The raw extension is checked, rather than the names crypto/x509
+	// parses from it, so that no other kind of name slips through.
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(subjectAltNameOID) {
+			continue
+		}
+		var names []asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &names); err != nil || len(rest) != 0 {
+			return errors.New("malformed subject alternative names")
+		}
+		if len(names) != 1 || names[0].Class != asn1.ClassContextSpecific || names[0].Tag != 6 ||
+			string(names[0].Bytes) != id {
+			return fmt.Errorf("the subject alternative names of the certificate request are not the SPIFFE ID %s alone", id)
+		}
+		return nil
+	}
+	return fmt.Errorf("the certificate request doesn't name the SPIFFE ID %s", id)
+}
+
+// SPIFFEID returns the SPIFFE ID of an X.509-SVID, which must hold
+// exactly one URI, with the spiffe scheme.
+func SPIFFEID(cert *x509.Certificate) (string, bool) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" || cert.URIs[0].Host == "" {
+		return "", false
+	}
+	return cert.URIs[0].String(), true
+}
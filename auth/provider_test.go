@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider("standard", testKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProvider("api_key", "tenant-secret", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewProvider("kerberos", testKey, nil); err == nil {
+		t.Fatal("expected an unknown authentication type to be rejected")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	if _, err := NewAPIKey(""); err == nil {
+		t.Fatal("expected an empty API key to be rejected")
+	}
+
+	p, err := NewAPIKey("tenant-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := p.Token([]byte("request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Verify(&AuthenticatedRequest{Token: token, Request: []byte("another request")}) {
+		t.Fatal("expected the API key to be accepted")
+	}
+	if p.Verify(&AuthenticatedRequest{Token: []byte("other-secret")}) {
+		t.Fatal("expected a wrong API key to be rejected")
+	}
+	if p.Verify(nil) {
+		t.Fatal("expected a nil request to be rejected")
+	}
+}
+
+func newTestCert(t *testing.T, cn string, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if issuer == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+		issuer, issuerKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestMutualTLS(t *testing.T) {
+	if _, err := NewMutualTLS("not a certificate"); err == nil {
+		t.Fatal("expected a key without CA certificates to be rejected")
+	}
+
+	ca, caKey := newTestCert(t, "Tenant CA", nil, nil)
+	client, _ := newTestCert(t, "tenant client", ca, caKey)
+	otherCA, otherCAKey := newTestCert(t, "Other CA", nil, nil)
+	otherClient, _ := newTestCert(t, "other client", otherCA, otherCAKey)
+
+	p, err := NewMutualTLS(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := p.Token(nil); err != nil || token != nil {
+		t.Fatalf("expected an empty token, got %v, %v", token, err)
+	}
+
+	req := &AuthenticatedRequest{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}}
+	if !p.Verify(req) {
+		t.Fatal("expected a client certificate issued by the CA to be accepted")
+	}
+	req.TLS.PeerCertificates = []*x509.Certificate{otherClient}
+	if p.Verify(req) {
+		t.Fatal("expected a client certificate issued by another CA to be rejected")
+	}
+	if p.Verify(&AuthenticatedRequest{}) {
+		t.Fatal("expected a request received without TLS to be rejected")
+	}
+}
+
+func TestSPIFFE(t *testing.T) {
+	bundle, bundleKey := newTestCert(t, "SPIRE CA", nil, nil)
+	svid, _ := newTestCert(t, "", bundle, bundleKey)
+	svid.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/web"}}
+	plain, _ := newTestCert(t, "tenant client", bundle, bundleKey)
+
+	p, err := NewProvider("spiffe", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bundle.Raw})), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr := func(cn string, dnsNames []string, uris ...string) []byte {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl := &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+		for _, uri := range uris {
+			u, err := url.Parse(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tpl.URIs = append(tpl.URIs, u)
+		}
+		der, err := x509.CreateCertificateRequest(rand.Reader, tpl, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	}
+
+	req := &AuthenticatedRequest{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{svid}}}
+	if !p.Verify(req) {
+		t.Fatal("expected a request received with an SVID to be accepted")
+	}
+
+	const id = "spiffe://example.org/web"
+	for _, test := range []struct {
+		hosts           []string
+		csr             []byte
+		subjectOverride bool
+		ok              bool
+	}{
+		{nil, csr("", nil, id), false, true},
+		{nil, csr(id, nil, id), false, true},
+		{[]string{id}, csr("", nil), false, true},
+		{nil, csr("", nil, "spiffe://example.org/db"), false, false},
+		{nil, csr("", nil), false, false},
+		{nil, csr("", []string{"web.example.org"}, id), false, false},
+		{nil, csr("web.example.org", nil, id), false, false},
+		{nil, csr("", nil, id), true, false},
+		{[]string{"spiffe://example.org/db"}, csr("", nil, id), false, false},
+		{[]string{id, "web.example.org"}, csr("", nil, id), false, false},
+		{[]string{}, csr("", nil, id), false, false},
+	} {
+		err := VerifyNames(p, req, test.hosts, test.csr, test.subjectOverride)
+		if (err == nil) != test.ok {
+			t.Errorf("hosts %v, override %v: expected ok=%v, got %v", test.hosts, test.subjectOverride, test.ok, err)
+		}
+	}
+	if VerifyNames(p, req, []string{id}, nil, false) == nil {
+		t.Fatal("expected a request without a CSR to be rejected")
+	}
+
+	req.TLS.PeerCertificates = []*x509.Certificate{plain}
+	if p.Verify(req) {
+		t.Fatal("expected a client certificate that isn't an SVID to be rejected")
+	}
+	if VerifyNames(p, req, []string{id}, csr("", nil, id), false) == nil {
+		t.Fatal("expected names to be rejected without an SVID")
+	}
+}
+
+func signTestJWT(t *testing.T, key *ecdsa.PrivateKey, alg string, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": alg, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(sig[32-len(rb):32], rb)
+	copy(sig[64-len(sb):], sb)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	verifier, err := NewJWT(pubPEM, "cfssl", "https://issuer.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Token(nil); err == nil {
+		t.Fatal("expected a verifying provider to have no token")
+	}
+
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": "https://issuer.example.com", "aud": "cfssl"}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	token := signTestJWT(t, key, "ES256", claims(map[string]interface{}{"sub": "tenant", "exp": now + 60}))
+	client, err := NewJWT(token, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := client.Token([]byte("request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifier.Verify(&AuthenticatedRequest{Token: sent}) {
+		t.Fatal("expected a valid token to be accepted")
+	}
+	listed := signTestJWT(t, key, "ES256", claims(map[string]interface{}{"aud": []string{"other", "cfssl"}, "exp": now + 60}))
+	if !verifier.Verify(&AuthenticatedRequest{Token: []byte(listed)}) {
+		t.Fatal("expected a token listing the audience to be accepted")
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, bad := range map[string]string{
+		"expired":         signTestJWT(t, key, "ES256", claims(map[string]interface{}{"exp": now - 60})),
+		"without expiry":  signTestJWT(t, key, "ES256", claims(map[string]interface{}{"sub": "tenant"})),
+		"not yet valid":   signTestJWT(t, key, "ES256", claims(map[string]interface{}{"exp": now + 120, "nbf": now + 60})),
+		"wrong key":       signTestJWT(t, otherKey, "ES256", claims(map[string]interface{}{"exp": now + 60})),
+		"wrong alg":       signTestJWT(t, key, "HS256", claims(map[string]interface{}{"exp": now + 60})),
+		"wrong audience":  signTestJWT(t, key, "ES256", claims(map[string]interface{}{"aud": "other", "exp": now + 60})),
+		"wrong audiences": signTestJWT(t, key, "ES256", claims(map[string]interface{}{"aud": []string{"other"}, "exp": now + 60})),
+		"wrong issuer":    signTestJWT(t, key, "ES256", claims(map[string]interface{}{"iss": "https://other.example.com", "exp": now + 60})),
+		"without claims":  signTestJWT(t, key, "ES256", map[string]interface{}{"exp": now + 60}),
+		"malformed":       "not.a-token",
+	} {
+		if verifier.Verify(&AuthenticatedRequest{Token: []byte(bad)}) {
+			t.Errorf("expected a %s token to be rejected", name)
+		}
+	}
+
+	if _, err := NewJWT("neither", "", ""); err == nil {
+		t.Fatal("expected a key that is neither a public key nor a token to be rejected")
+	}
+	if _, err := NewJWT(pubPEM, "", "https://issuer.example.com"); err == nil {
+		t.Fatal("expected a verifier without an audience to be rejected")
+	}
+	if _, err := NewJWT(pubPEM, "cfssl", ""); err == nil {
+		t.Fatal("expected a verifier without an issuer to be rejected")
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	goerr "errors"
 	"fmt"
@@ -64,10 +66,14 @@ type Bundler struct {
 	IntermediatePool *x509.CertPool
 	KnownIssuers     map[string]bool
 	opts             options
+	chains           *chainCache
 }
 
 type options struct {
-	keyUsages []x509.ExtKeyUsage
+	keyUsages      []x509.ExtKeyUsage
+	aiaCache       string
+	offline        bool
+	chainCacheSize int
 }
 
 var defaultOptions = options{
@@ -87,6 +93,36 @@ func WithKeyUsages(usages ...x509.ExtKeyUsage) Option {
 	}
 }
 
+// WithAIACache saves the certificates fetched from AIA issuer URLs in
+// dir, and looks them up there before fetching them again. By default,
+// fetched certificates are not cached.
+func WithAIACache(dir string) Option {
+	return func(o *options) {
+		o.aiaCache = dir
+	}
+}
+
+// WithOffline disables all network access when offline is true: AIA
+// issuer URLs are only looked up in the AIA cache, if any, and bundling
+// from a remote server fails.
+func WithOffline(offline bool) Option {
+	return func(o *options) {
+		o.offline = offline
+	}
+}
+
+// WithChainCache keeps the chains resolved for the last size leaf
+// certificates in memory, keyed by the fingerprint of the leaf and the
+// bundle flavor, so that bundling a leaf again doesn't verify its chain,
+// fetch intermediates from AIA issuer URLs and rank the chains by
+// ubiquity again. A cached chain is dropped once one of its
+// certificates expires. By default, chains are not cached.
+func WithChainCache(size int) Option {
+	return func(o *options) {
+		o.chainCacheSize = size
+	}
+}
+
 // NewBundler creates a new Bundler from the files passed in; these
 // files should contain a list of valid root certificates and a list
 // of valid intermediate certificates, respectively.
@@ -104,8 +140,13 @@ func NewBundler(caBundleFile, intBundleFile string, opt ...Option) (*Bundler, er
 	}
 
 	if intBundleFile != "" {
-		log.Debug("Loading Intermediate bundle: ", intBundleFile)
-		intBundle, err = ioutil.ReadFile(intBundleFile)
+		if fi, statErr := os.Stat(intBundleFile); statErr == nil && fi.IsDir() {
+			log.Debug("Loading Intermediate directory: ", intBundleFile)
+			intBundle, err = LoadIntermediatesDir(intBundleFile)
+		} else {
+			log.Debug("Loading Intermediate bundle: ", intBundleFile)
+			intBundle, err = ioutil.ReadFile(intBundleFile)
+		}
 		if err != nil {
 			log.Errorf("intermediate bundle failed to load: %v", err)
 			return nil, errors.Wrap(errors.IntermediatesError, errors.ReadFailed, err)
@@ -129,6 +170,44 @@ func NewBundler(caBundleFile, intBundleFile string, opt ...Option) (*Bundler, er
 
 }
 
+// LoadIntermediatesDir reads the certificates from every *.pem file in dir
+// and returns them as a single PEM bundle, suitable for use as the
+// intermediate bundle of NewBundlerFromPEM. Files that don't hold PEM
+// encoded certificates are skipped with a warning, and a certificate
+// found in several files is only included once.
+func LoadIntermediatesDir(dir string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle bytes.Buffer
+	seen := map[string]bool{}
+	for _, file := range files {
+		certPEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		certs, err := helpers.ParseCertificatesPEM(certPEM)
+		if err != nil || len(certs) == 0 {
+			log.Warningf("skipping %s: no PEM encoded certificates found", file)
+			continue
+		}
+
+		for _, cert := range certs {
+			fingerprint := sha256.Sum256(cert.Raw)
+			if seen[string(fingerprint[:])] {
+				log.Debugf("skipping duplicate intermediate %s in %s", cert.Subject.CommonName, file)
+				continue
+			}
+			seen[string(fingerprint[:])] = true
+			bundle.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		}
+	}
+	return bundle.Bytes(), nil
+}
+
 // NewBundlerFromPEM creates a new Bundler from PEM-encoded root certificates and
 // intermediate certificates.
 // If caBundlePEM is nil, the resulting Bundler can only do "Force" bundle.
@@ -156,6 +235,7 @@ func NewBundlerFromPEM(caBundlePEM, intBundlePEM []byte, opt ...Option) (*Bundle
 		KnownIssuers:     map[string]bool{},
 		IntermediatePool: x509.NewCertPool(),
 		opts:             opts,
+		chains:           newChainCache(opts.chainCacheSize),
 	}
 
 	log.Debug("building certificate pools")
@@ -265,6 +345,11 @@ func (b *Bundler) BundleFromPEMorDER(certsRaw, keyPEM []byte, flavor BundleFlavo
 // port 443. The certificate used by the server in this connection is
 // used to build the bundle, which will necessarily be keyless.
 func (b *Bundler) BundleFromRemote(serverName, ip string, flavor BundleFlavor) (*Bundle, error) {
+	if b.opts.offline {
+		return nil, errors.Wrap(errors.DialError, errors.Unknown,
+			goerr.New("cannot bundle from a remote server while offline"))
+	}
+
 	config := &tls.Config{
 		RootCAs:    b.RootPool,
 		ServerName: serverName,
@@ -363,6 +448,56 @@ func fetchRemoteCertificate(certURL string) (fi *fetchedIntermediate, err error)
 	return
 }
 
+// aiaCacheFile returns the file caching the certificate at certURL.
+func aiaCacheFile(dir, certURL string) string {
+	digest := sha256.Sum256([]byte(certURL))
+	return filepath.Join(dir, hex.EncodeToString(digest[:])+".pem")
+}
+
+// fetchIssuer retrieves the certificate at an AIA issuer URL, from the
+// AIA cache if it holds it, or from the network unless the bundler is
+// offline. Certificates fetched from the network are added to the cache.
+func (b *Bundler) fetchIssuer(certURL string) (*fetchedIntermediate, error) {
+	var cacheFile string
+	if b.opts.aiaCache != "" {
+		cacheFile = aiaCacheFile(b.opts.aiaCache, certURL)
+		certPEM, err := ioutil.ReadFile(cacheFile)
+		if err == nil {
+			crt, err := helpers.ParseCertificatePEM(certPEM)
+			if err == nil {
+				log.Debugf("found certificate for %s in the AIA cache", certURL)
+				return &fetchedIntermediate{Cert: crt, Name: constructCertFileName(crt)}, nil
+			}
+			log.Warningf("ignoring malformed AIA cache entry %s: %v", cacheFile, err)
+		} else if !os.IsNotExist(err) {
+			log.Warningf("failed to read AIA cache entry %s: %v", cacheFile, err)
+		}
+	}
+
+	if b.opts.offline {
+		log.Debugf("offline, not fetching remote certificate: %s", certURL)
+		return nil, fmt.Errorf("%s is not in the AIA cache", certURL)
+	}
+
+	fi, err := fetchRemoteCertificate(certURL)
+	if err != nil || cacheFile == "" {
+		return fi, err
+	}
+
+	// If caching fails, bundling should not fail.
+	if err := os.MkdirAll(b.opts.aiaCache, 0755); err != nil {
+		log.Errorf("failed to create AIA cache directory %s: %v", b.opts.aiaCache, err)
+		return fi, nil
+	}
+	block := pem.Block{Type: "CERTIFICATE", Bytes: fi.Cert.Raw}
+	if err := ioutil.WriteFile(cacheFile, pem.EncodeToMemory(&block), 0644); err != nil {
+		log.Errorf("failed to write AIA cache entry %s: %v", cacheFile, err)
+	} else {
+		log.Debugf("cached certificate for %s in %s", certURL, cacheFile)
+	}
+	return fi, nil
+}
+
 func reverse(certs []*x509.Certificate) []*x509.Certificate {
 	n := len(certs)
 	if n == 0 {
@@ -529,7 +664,7 @@ func (b *Bundler) fetchIntermediates(certs []*x509.Certificate) (err error) {
 				log.Debugf("url %s has been seen", url)
 				continue
 			}
-			crt, err := fetchRemoteCertificate(url)
+			crt, err := b.fetchIssuer(url)
 			if err != nil {
 				continue
 			} else if seen[string(crt.Cert.Signature)] {
@@ -624,45 +759,15 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 			return nil, errors.New(errors.CertificateError, errors.SelfSigned)
 		}
 
-		chains, err := cert.Verify(b.VerifyOptions())
-		if err != nil {
-			log.Debugf("verification failed: %v", err)
-			// If the error was an unknown authority, try to fetch
-			// the intermediate specified in the AIA and add it to
-			// the intermediates bundle.
-			if _, ok := err.(x509.UnknownAuthorityError); !ok {
-				return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
-			}
-
-			log.Debugf("searching for intermediates via AIA issuer")
-			searchErr := b.fetchIntermediates(certs)
-			if searchErr != nil {
-				log.Debugf("search failed: %v", searchErr)
-				return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
-			}
-
-			log.Debugf("verifying new chain")
-			chains, err = cert.Verify(b.VerifyOptions())
-			if err != nil {
-				log.Debugf("failed to verify chain: %v", err)
-				return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
-			}
-			log.Debugf("verify ok")
-		}
-		var matchingChains [][]*x509.Certificate
-		switch flavor {
-		case Optimal:
-			matchingChains = optimalChains(chains)
-		case Ubiquitous:
-			if len(ubiquity.Platforms) == 0 {
-				log.Warning("No metadata, Ubiquitous falls back to Optimal.")
+		chain, ok := b.chains.get(cert, flavor)
+		if !ok {
+			var err error
+			if chain, err = b.resolveChain(certs, flavor); err != nil {
+				return nil, err
 			}
-			matchingChains = ubiquitousChains(chains)
-		default:
-			matchingChains = ubiquitousChains(chains)
+			b.chains.add(cert, flavor, chain)
 		}
-
-		bundle.Chain = matchingChains[0]
+		bundle.Chain = chain
 	}
 
 	statusCode := int(errors.Success)
@@ -732,6 +837,52 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 	return bundle, nil
 }
 
+// resolveChain verifies the leaf certificate certs[0], fetching its
+// missing intermediates from AIA issuer URLs, and returns its best
+// chain for the flavor.
+func (b *Bundler) resolveChain(certs []*x509.Certificate, flavor BundleFlavor) ([]*x509.Certificate, error) {
+	cert := certs[0]
+	chains, err := cert.Verify(b.VerifyOptions())
+	if err != nil {
+		log.Debugf("verification failed: %v", err)
+		// If the error was an unknown authority, try to fetch
+		// the intermediate specified in the AIA and add it to
+		// the intermediates bundle.
+		if _, ok := err.(x509.UnknownAuthorityError); !ok {
+			return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
+		}
+
+		log.Debugf("searching for intermediates via AIA issuer")
+		searchErr := b.fetchIntermediates(certs)
+		if searchErr != nil {
+			log.Debugf("search failed: %v", searchErr)
+			return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
+		}
+
+		log.Debugf("verifying new chain")
+		chains, err = cert.Verify(b.VerifyOptions())
+		if err != nil {
+			log.Debugf("failed to verify chain: %v", err)
+			return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
+		}
+		log.Debugf("verify ok")
+	}
+	var matchingChains [][]*x509.Certificate
+	switch flavor {
+	case Optimal:
+		matchingChains = optimalChains(chains)
+	case Ubiquitous:
+		if len(ubiquity.Platforms) == 0 {
+			log.Warning("No metadata, Ubiquitous falls back to Optimal.")
+		}
+		matchingChains = ubiquitousChains(chains)
+	default:
+		matchingChains = ubiquitousChains(chains)
+	}
+
+	return matchingChains[0], nil
+}
+
 // checkExpiringCerts returns indices of certs that are expiring within 30 days.
 func checkExpiringCerts(chain []*x509.Certificate) (expiringIntermediates []int) {
 	now := time.Now()
@@ -6,6 +6,9 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -922,3 +925,97 @@ func TestBundlerClientAuth(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadIntermediatesDir(t *testing.T) {
+	const dir = "testdata/intermediates-dir"
+
+	bundle, err := LoadIntermediatesDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := helpers.ParseCertificatesPEM(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inter-L1-copy.pem duplicates inter-L1.pem, inter-L1-key.pem holds a
+	// private key and notes.txt isn't a PEM file.
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 distinct intermediates, got %d", len(certs))
+	}
+
+	b, err := NewBundler(testCFSSLRootBundle, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cert := range certs {
+		if !b.KnownIssuers[string(cert.Signature)] {
+			t.Errorf("intermediate %s missing from the bundler", cert.Subject.CommonName)
+		}
+	}
+	if len(b.KnownIssuers) != 3 {
+		t.Errorf("expected the root and 2 intermediates to be known issuers, got %d", len(b.KnownIssuers))
+	}
+}
+
+func TestAIACacheOffline(t *testing.T) {
+	caPEM, err := ioutil.ReadFile(testCAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(ca.Raw)
+	}))
+	defer server.Close()
+	url := server.URL + "/ca.crt"
+
+	cache, err := ioutil.TempDir("", "aia-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	offline, err := NewBundlerFromPEM(caPEM, nil, WithAIACache(cache), WithOffline(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = offline.fetchIssuer(url); err == nil {
+		t.Fatal("expected an offline bundler to miss an empty AIA cache")
+	}
+
+	online, err := NewBundlerFromPEM(caPEM, nil, WithAIACache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		fi, err := online.fetchIssuer(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(fi.Cert.Raw, ca.Raw) {
+			t.Fatal("fetched the wrong certificate")
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected the certificate to be fetched once, got %d fetches", fetches)
+	}
+
+	server.Close()
+	fi, err := offline.fetchIssuer(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fi.Cert.Raw, ca.Raw) {
+		t.Fatal("read the wrong certificate from the AIA cache")
+	}
+
+	if _, err = offline.BundleFromRemote("cloudflare.com", "", Ubiquitous); err == nil {
+		t.Fatal("expected an offline bundler to refuse bundling from a remote server")
+	}
+}
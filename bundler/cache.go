@@ -0,0 +1,107 @@
+package bundler
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/x509"
+	"sync"
+	"time"
+)
+
+// chainKey identifies the chain resolved for a leaf certificate, by
+// the SHA-256 fingerprint of the leaf, for a bundle flavor.
+type chainKey struct {
+	fingerprint [sha256.Size]byte
+	flavor      BundleFlavor
+}
+
+type chainEntry struct {
+	key   chainKey
+	chain []*x509.Certificate
+}
+
+// A chainCache is an LRU cache of the chains resolved for leaf
+// certificates, so that bundling the same leaf again doesn't redo the
+// chain verification, AIA fetches and ubiquity ranking. A nil
+// chainCache caches nothing.
+type chainCache struct {
+	mu      sync.Mutex
+	size    int
+	entries *list.List
+	index   map[chainKey]*list.Element
+}
+
+func newChainCache(size int) *chainCache {
+	if size <= 0 {
+		return nil
+	}
+	return &chainCache{
+		size:    size,
+		entries: list.New(),
+		index:   map[chainKey]*list.Element{},
+	}
+}
+
+func newChainKey(leaf *x509.Certificate, flavor BundleFlavor) chainKey {
+	return chainKey{fingerprint: sha256.Sum256(leaf.Raw), flavor: flavor}
+}
+
+// get returns the chain cached for leaf, unless one of its
+// certificates has expired since.
+func (c *chainCache) get(leaf *x509.Certificate, flavor BundleFlavor) ([]*x509.Certificate, bool) {
+	if c == nil {
+		return nil, false
+	}
+	key := newChainKey(leaf, flavor)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	chain := e.Value.(*chainEntry).chain
+	now := time.Now()
+	for _, cert := range chain {
+		if now.After(cert.NotAfter) {
+			c.entries.Remove(e)
+			delete(c.index, key)
+			return nil, false
+		}
+	}
+	c.entries.MoveToFront(e)
+	return chain, true
+}
+
+// add caches the chain resolved for leaf, evicting the least recently
+// used chain if the cache is full.
+func (c *chainCache) add(leaf *x509.Certificate, flavor BundleFlavor, chain []*x509.Certificate) {
+	if c == nil {
+		return
+	}
+	key := newChainKey(leaf, flavor)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.index[key]; ok {
+		e.Value.(*chainEntry).chain = chain
+		c.entries.MoveToFront(e)
+		return
+	}
+	c.index[key] = c.entries.PushFront(&chainEntry{key: key, chain: chain})
+	if c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.index, oldest.Value.(*chainEntry).key)
+	}
+}
+
+// len returns the number of chains in the cache.
+func (c *chainCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
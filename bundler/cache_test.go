@@ -0,0 +1,129 @@
+package bundler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// newCacheTestCert issues a certificate for key, signed by parent, or
+// a self-signed CA certificate if parent is nil.
+func newCacheTestCert(t *testing.T, cn string, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool, notAfter time.Time) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{cn}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newCacheTestKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestChainCacheEviction(t *testing.T) {
+	rootKey := newCacheTestKey(t)
+	notAfter := time.Now().Add(time.Hour)
+	root := newCacheTestCert(t, "Root", rootKey, nil, nil, true, notAfter)
+	leaves := make([]*x509.Certificate, 3)
+	for i := range leaves {
+		leaves[i] = newCacheTestCert(t, "leaf.com", newCacheTestKey(t), root, rootKey, false, notAfter)
+	}
+
+	c := newChainCache(2)
+	c.add(leaves[0], Optimal, []*x509.Certificate{leaves[0], root})
+	c.add(leaves[1], Optimal, []*x509.Certificate{leaves[1], root})
+	if _, ok := c.get(leaves[0], Ubiquitous); ok {
+		t.Fatal("chains should be cached per flavor")
+	}
+	if _, ok := c.get(leaves[0], Optimal); !ok {
+		t.Fatal("expected the chain of the first leaf to be cached")
+	}
+
+	// The second leaf is now the least recently used.
+	c.add(leaves[2], Optimal, []*x509.Certificate{leaves[2], root})
+	if c.len() != 2 {
+		t.Fatalf("expected 2 cached chains, got %d", c.len())
+	}
+	if _, ok := c.get(leaves[1], Optimal); ok {
+		t.Fatal("expected the chain of the second leaf to be evicted")
+	}
+	if chain, ok := c.get(leaves[2], Optimal); !ok || !chain[0].Equal(leaves[2]) {
+		t.Fatal("expected the chain of the third leaf to be cached")
+	}
+
+	expired := newCacheTestCert(t, "Expired", newCacheTestKey(t), nil, nil, true, time.Now().Add(-time.Minute))
+	c.add(leaves[0], Optimal, []*x509.Certificate{leaves[0], expired})
+	if _, ok := c.get(leaves[0], Optimal); ok {
+		t.Fatal("expected a chain with an expired certificate to be dropped")
+	}
+
+	var nilCache *chainCache
+	nilCache.add(leaves[0], Optimal, []*x509.Certificate{leaves[0], root})
+	if _, ok := nilCache.get(leaves[0], Optimal); ok {
+		t.Fatal("a nil cache shouldn't cache anything")
+	}
+}
+
+func TestBundleWithChainCache(t *testing.T) {
+	rootKey, interKey := newCacheTestKey(t), newCacheTestKey(t)
+	notAfter := time.Now().Add(365 * 24 * time.Hour)
+	root := newCacheTestCert(t, "Root", rootKey, nil, nil, true, notAfter)
+	inter := newCacheTestCert(t, "Intermediate", interKey, root, rootKey, true, notAfter)
+	leaf := newCacheTestCert(t, "leaf.com", newCacheTestKey(t), inter, interKey, false, notAfter)
+
+	b, err := NewBundlerFromPEM(helpers.EncodeCertificatePEM(root), helpers.EncodeCertificatePEM(inter), WithChainCache(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Bundle([]*x509.Certificate{leaf}, nil, Optimal); err != nil {
+		t.Fatal(err)
+	}
+	if b.chains.len() != 1 {
+		t.Fatalf("expected the chain to be cached, got %d chains", b.chains.len())
+	}
+
+	// Once cached, the chain is used without verifying it against the
+	// pools again.
+	b.RootPool, b.IntermediatePool = x509.NewCertPool(), x509.NewCertPool()
+	bundle, err := b.Bundle([]*x509.Certificate{leaf}, nil, Optimal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bundle.Root.Equal(root) || len(bundle.Chain) != 2 || !bundle.Chain[1].Equal(inter) {
+		t.Fatalf("unexpected bundle from the cached chain: %v", bundle.Chain)
+	}
+	if _, err = b.Bundle([]*x509.Certificate{leaf}, nil, Ubiquitous); err == nil {
+		t.Fatal("expected a flavor without a cached chain to be verified")
+	}
+}
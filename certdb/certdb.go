@@ -1,6 +1,8 @@
 package certdb
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -15,6 +17,54 @@ type CertificateRecord struct {
 	Expiry    time.Time `db:"expiry"`
 	RevokedAt time.Time `db:"revoked_at"`
 	PEM       string    `db:"pem"`
+	// CommonName, SANs, Profile and Requester describe the issued
+	// certificate and the request that produced it. SANs holds every
+	// subject alternative name, comma-separated.
+	CommonName string `db:"common_name"`
+	SANs       string `db:"sans"`
+	Profile    string `db:"profile"`
+	Requester  string `db:"requester"`
+	// KeyFingerprint is the hex-encoded SHA-256 digest of the
+	// certificate's DER-encoded SubjectPublicKeyInfo.
+	KeyFingerprint string `db:"key_fingerprint"`
+	// UniqueKeyFingerprint is KeyFingerprint for certificates signed
+	// under a profile rejecting key reuse, and nil otherwise. The
+	// database holds at most one certificate per issuer with a given
+	// UniqueKeyFingerprint.
+	UniqueKeyFingerprint *string `db:"unique_key_fingerprint"`
+	// InvalidityDate is when the key of a revoked certificate is known
+	// or suspected to have been compromised, if that is earlier than
+	// its revocation, and nil otherwise.
+	InvalidityDate *time.Time `db:"invalidity_date"`
+	// Labels are arbitrary names and values attached to the
+	// certificate, such as its team, service or environment. They are
+	// stored apart from the certificate, so only the accessors saying so
+	// fill them in.
+	Labels map[string]string `db:"-"`
+}
+
+// MaxLabelNameLength and MaxLabelValueLength bound the length, in bytes,
+// of the names and values of certificate labels.
+const (
+	MaxLabelNameLength  = 128
+	MaxLabelValueLength = 255
+)
+
+// ValidateLabels checks that the names of labels are not empty and that
+// their names and values are not too long to be stored.
+func ValidateLabels(labels map[string]string) error {
+	for name, value := range labels {
+		if name == "" {
+			return errors.New("label names can't be empty")
+		}
+		if len(name) > MaxLabelNameLength {
+			return fmt.Errorf("label name %q is longer than %d bytes", name, MaxLabelNameLength)
+		}
+		if len(value) > MaxLabelValueLength {
+			return fmt.Errorf("value of label %q is longer than %d bytes", name, MaxLabelValueLength)
+		}
+	}
+	return nil
 }
 
 // OCSPRecord encodes a OCSP response body and its metadata
@@ -26,14 +76,70 @@ type OCSPRecord struct {
 	Expiry time.Time `db:"expiry"`
 }
 
+// A Revocation names a certificate to revoke and the reason code of
+// its revocation, as in RFC 5280.
+type Revocation struct {
+	Serial         string     `db:"serial_number"`
+	AKI            string     `db:"authority_key_identifier"`
+	Reason         int        `db:"reason"`
+	InvalidityDate *time.Time `db:"invalidity_date"`
+}
+
+// A CRLRecord holds the CRL number sequence of the issuer with the given
+// authority key identifier: the number of its last CRL, and the number
+// and thisUpdate time of its last full CRL, on which delta CRLs are
+// based. BaseNumber is 0 until a full CRL is recorded.
+type CRLRecord struct {
+	AKI            string    `db:"authority_key_identifier"`
+	Number         int64     `db:"crl_number"`
+	BaseNumber     int64     `db:"base_crl_number"`
+	BaseThisUpdate time.Time `db:"base_this_update"`
+}
+
+// KeyFingerprintAccessor is implemented by the Accessors able to look up
+// certificates by the fingerprint of their public key.
+type KeyFingerprintAccessor interface {
+	GetCertificatesByKeyFingerprint(fingerprint string) ([]CertificateRecord, error)
+}
+
+// A CertificateFilter selects certificates by the metadata recorded when
+// they were issued. Empty fields match every certificate, and SAN matches
+// the certificates having it among their subject alternative names.
+type CertificateFilter struct {
+	CommonName string
+	SAN        string
+	Profile    string
+	Requester  string
+}
+
+// CertificateFilterAccessor is implemented by the Accessors able to look
+// up certificates with a CertificateFilter.
+type CertificateFilterAccessor interface {
+	GetCertificatesByFilter(filter CertificateFilter) ([]CertificateRecord, error)
+}
+
+// ErrKeyReused is returned by InsertCertificate when the database already
+// holds a certificate from the same issuer with the UniqueKeyFingerprint
+// of the inserted one.
+var ErrKeyReused = errors.New("a certificate for this key has already been recorded")
+
 // Accessor abstracts the CRUD of certdb objects from a DB.
 type Accessor interface {
 	InsertCertificate(cr CertificateRecord) error
 	GetCertificate(serial, aki string) ([]CertificateRecord, error)
+	GetAllCertificates() ([]CertificateRecord, error)
 	GetUnexpiredCertificates() ([]CertificateRecord, error)
 	GetRevokedAndUnexpiredCertificates() ([]CertificateRecord, error)
 	GetRevokedAndUnexpiredCertificatesByLabel(label string) ([]CertificateRecord, error)
+	GetCertificatesByLabels(labels map[string]string) ([]CertificateRecord, error)
+	GetCertificateLabels(serial, aki string) (map[string]string, error)
+	SetCertificateLabels(serial, aki string, labels map[string]string) error
 	RevokeCertificate(serial, aki string, reasonCode int) error
+	RevokeCertificates(revocations []Revocation) error
+	NextSerialNumber(aki string) (int64, error)
+	NextCRLNumber(aki string) (int64, error)
+	GetCRLRecord(aki string) ([]CRLRecord, error)
+	SetBaseCRL(aki string, number int64, thisUpdate time.Time) error
 	InsertOCSP(rr OCSPRecord) error
 	GetOCSP(serial, aki string) ([]OCSPRecord, error)
 	GetUnexpiredOCSPs() ([]OCSPRecord, error)
@@ -4,13 +4,25 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"time"
 
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/log"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
+// mysqlParams are the MySQL session variables the certdb accessor relies
+// on, set unless the data source sets them itself. The accessor writes
+// times in UTC and compares them to CURRENT_TIMESTAMP, and records
+// certificates that were never revoked with a zero revocation time,
+// which the NO_ZERO_DATE mode of MySQL 5.7 and later rejects.
+var mysqlParams = map[string]string{
+	"time_zone": "'+00:00'",
+	"sql_mode":  "'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION'",
+}
+
 // DBConfig contains the database driver name and configuration to be passed to Open
 type DBConfig struct {
 	DriverName     string `json:"driver"`
@@ -53,5 +65,36 @@ func DBFromConfig(path string) (db *sqlx.DB, err error) {
 		return nil, err
 	}
 
-	return sqlx.Open(dbCfg.DriverName, dbCfg.DataSourceName)
+	dataSource := dbCfg.DataSourceName
+	if dbCfg.DriverName == "mysql" {
+		dataSource, err = MySQLDataSource(dataSource)
+		if err != nil {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				errors.New("invalid MySQL data source: "+err.Error()))
+		}
+	}
+
+	return sqlx.Open(dbCfg.DriverName, dataSource)
+}
+
+// MySQLDataSource adds to a MySQL data source the settings the certdb
+// accessor needs: times are parsed, in UTC, and the session variables
+// of mysqlParams are set unless the data source already sets them.
+func MySQLDataSource(dataSource string) (string, error) {
+	cfg, err := mysql.ParseDSN(dataSource)
+	if err != nil {
+		return "", err
+	}
+
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	for param, value := range mysqlParams {
+		if _, ok := cfg.Params[param]; !ok {
+			cfg.Params[param] = value
+		}
+	}
+	return cfg.FormatDSN(), nil
 }
@@ -1,6 +1,7 @@
 package dbconf
 
 import (
+	"strings"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3" // import just to initialize SQLite testing
@@ -34,3 +35,22 @@ func TestDBFromConfig(t *testing.T) {
 		t.Fatal("Expected failure opening unreachable db")
 	}
 }
+
+func TestMySQLDataSource(t *testing.T) {
+	dataSource, err := MySQLDataSource("user:password@tcp(localhost:3306)/certdb?time_zone=%27Europe%2FParis%27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range []string{"parseTime=true", "time_zone=%27Europe%2FParis%27", "sql_mode=%27STRICT_TRANS_TABLES%2CNO_ENGINE_SUBSTITUTION%27"} {
+		if !strings.Contains(dataSource, param) {
+			t.Fatalf("data source %s should contain %s", dataSource, param)
+		}
+	}
+	if strings.Contains(dataSource, "%2B00%3A00") {
+		t.Fatalf("data source %s should keep its time zone", dataSource)
+	}
+
+	if _, err = MySQLDataSource("not a data source"); err == nil {
+		t.Fatal("Expected failure parsing an invalid data source")
+	}
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN common_name varbinary(128) NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN sans varbinary(4096) NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN profile varbinary(128) NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN requester varbinary(128) NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE certificates DROP COLUMN requester;
+ALTER TABLE certificates DROP COLUMN profile;
+ALTER TABLE certificates DROP COLUMN sans;
+ALTER TABLE certificates DROP COLUMN common_name;
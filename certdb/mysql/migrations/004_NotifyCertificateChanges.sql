@@ -0,0 +1,9 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Only PostgreSQL notifies certificate changes, with a trigger. This
+-- migration does nothing here, and keeps the migration versions meaning
+-- the same in every dialect.
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- timestamp columns can't hold times after 2038, and convert times with
+-- the session time zone; datetime columns hold the UTC times written by
+-- cfssl as they are. Run this migration with the time zone the existing
+-- times were written in, which is the server's unless it was set in the
+-- data source. Signed certificates and OCSP responses larger than 4kB
+-- need the wider pem and body columns.
+ALTER TABLE certificates MODIFY expiry datetime NULL DEFAULT NULL;
+ALTER TABLE certificates MODIFY revoked_at datetime NULL DEFAULT NULL;
+ALTER TABLE certificates MODIFY pem mediumblob NOT NULL;
+ALTER TABLE ocsp_responses MODIFY expiry datetime NULL DEFAULT NULL;
+ALTER TABLE ocsp_responses MODIFY body mediumblob NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- The timestamp columns are nullable, without the zero date default they
+-- were created with, which strict mode and NO_ZERO_DATE reject.
+ALTER TABLE ocsp_responses MODIFY body varbinary(4096) NOT NULL;
+ALTER TABLE ocsp_responses MODIFY expiry timestamp NULL DEFAULT NULL;
+ALTER TABLE certificates MODIFY pem varbinary(4096) NOT NULL;
+ALTER TABLE certificates MODIFY revoked_at timestamp NULL DEFAULT NULL;
+ALTER TABLE certificates MODIFY expiry timestamp NULL DEFAULT NULL;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN invalidity_date datetime NULL DEFAULT NULL;
+
+CREATE TABLE crl_numbers (
+  authority_key_identifier varbinary(128) NOT NULL,
+  crl_number               bigint NOT NULL,
+  base_crl_number          bigint NOT NULL,
+  base_this_update         datetime NOT NULL,
+  PRIMARY KEY(authority_key_identifier)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE crl_numbers;
+ALTER TABLE certificates DROP COLUMN invalidity_date;
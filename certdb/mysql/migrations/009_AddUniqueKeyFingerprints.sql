@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN unique_key_fingerprint varbinary(64) NULL DEFAULT NULL;
+CREATE UNIQUE INDEX certificates_unique_key_fingerprint ON certificates (authority_key_identifier, unique_key_fingerprint);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX certificates_unique_key_fingerprint ON certificates;
+ALTER TABLE certificates DROP COLUMN unique_key_fingerprint;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN key_fingerprint bytea NOT NULL DEFAULT '';
+CREATE INDEX certificates_key_fingerprint ON certificates (key_fingerprint);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX certificates_key_fingerprint;
+ALTER TABLE certificates DROP COLUMN key_fingerprint;
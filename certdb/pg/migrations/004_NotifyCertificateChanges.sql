@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_certificate_change() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('cfssl_certificates', json_build_object(
+    'serial', convert_from(NEW.serial_number, 'UTF8'),
+    'aki', convert_from(NEW.authority_key_identifier, 'UTF8'))::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER certificates_notify AFTER INSERT OR UPDATE OF status, reason, revoked_at ON certificates
+  FOR EACH ROW EXECUTE PROCEDURE notify_certificate_change();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TRIGGER certificates_notify ON certificates;
+DROP FUNCTION notify_certificate_change();
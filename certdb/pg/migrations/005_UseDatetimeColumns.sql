@@ -0,0 +1,9 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Only MySQL needs its times moved to datetime columns. This migration
+-- does nothing here, and keeps the migration versions meaning the same
+-- in every dialect.
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE serial_numbers (
+  authority_key_identifier bytea NOT NULL,
+  serial_number            bigint NOT NULL,
+  PRIMARY KEY(authority_key_identifier)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE serial_numbers;
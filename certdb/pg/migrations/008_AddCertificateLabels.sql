@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE certificate_labels (
+  serial_number            bytea NOT NULL,
+  authority_key_identifier bytea NOT NULL,
+  name                     bytea NOT NULL,
+  value                    bytea NOT NULL,
+  PRIMARY KEY(serial_number, authority_key_identifier, name)
+);
+
+CREATE INDEX certificate_labels_name_value ON certificate_labels (name, value);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE certificate_labels;
@@ -3,13 +3,18 @@ package sql
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/cloudflare/cfssl/certdb"
 	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/events"
+	"github.com/cloudflare/cfssl/metrics"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/kisielk/sqlstruct"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Match to sqlx
@@ -19,13 +24,18 @@ func init() {
 
 const (
 	insertSQL = `
-INSERT INTO certificates (serial_number, authority_key_identifier, ca_label, status, reason, expiry, revoked_at, pem)
-	VALUES (:serial_number, :authority_key_identifier, :ca_label, :status, :reason, :expiry, :revoked_at, :pem);`
+INSERT INTO certificates (serial_number, authority_key_identifier, ca_label, status, reason, expiry, revoked_at, pem,
+	common_name, sans, profile, requester, key_fingerprint, unique_key_fingerprint, invalidity_date)
+	VALUES (:serial_number, :authority_key_identifier, :ca_label, :status, :reason, :expiry, :revoked_at, :pem,
+	:common_name, :sans, :profile, :requester, :key_fingerprint, :unique_key_fingerprint, :invalidity_date);`
 
 	selectSQL = `
 SELECT %s FROM certificates
 	WHERE (serial_number = ? AND authority_key_identifier = ?);`
 
+	selectAllSQL = `
+SELECT %s FROM certificates;`
+
 	selectAllUnexpiredSQL = `
 SELECT %s FROM certificates
 	WHERE CURRENT_TIMESTAMP < expiry;`
@@ -34,15 +44,73 @@ SELECT %s FROM certificates
 SELECT %s FROM certificates
 	WHERE CURRENT_TIMESTAMP < expiry AND status='revoked' AND ca_label= ?;`
 
+	selectByKeyFingerprintSQL = `
+SELECT %s FROM certificates
+	WHERE key_fingerprint = ?;`
+
+	selectByFilterSQL = `
+SELECT %s FROM certificates
+	WHERE %s;`
+
+	sanConditionSQL = `(sans = ? OR sans LIKE ? ESCAPE '!' OR sans LIKE ? ESCAPE '!' OR sans LIKE ? ESCAPE '!')`
+
+	selectByLabelsSQL = `
+SELECT %s FROM certificates
+	WHERE %s;`
+
+	labelConditionSQL = `EXISTS (SELECT 1 FROM certificate_labels
+	WHERE certificate_labels.serial_number = certificates.serial_number
+	AND certificate_labels.authority_key_identifier = certificates.authority_key_identifier
+	AND name = ? AND value = ?)`
+
 	selectAllRevokedAndUnexpiredSQL = `
 SELECT %s FROM certificates
 	WHERE CURRENT_TIMESTAMP < expiry AND status='revoked';`
 
 	updateRevokeSQL = `
 UPDATE certificates
-	SET status='revoked', revoked_at=CURRENT_TIMESTAMP, reason=:reason
+	SET status='revoked', revoked_at=CURRENT_TIMESTAMP, reason=:reason, invalidity_date=:invalidity_date
 	WHERE (serial_number = :serial_number AND authority_key_identifier = :authority_key_identifier);`
 
+	countCertificateSQL = `
+SELECT COUNT(*) FROM certificates
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+
+	insertLabelSQL = `
+INSERT INTO certificate_labels (serial_number, authority_key_identifier, name, value)
+	VALUES (?, ?, ?, ?);`
+
+	deleteLabelsSQL = `
+DELETE FROM certificate_labels
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+
+	selectLabelsSQL = `
+SELECT name, value FROM certificate_labels
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+
+	upsertSerialSQL = `
+INSERT INTO serial_numbers (authority_key_identifier, serial_number)
+	VALUES (?, 1)
+	%s;`
+
+	selectSerialSQL = `
+SELECT serial_number FROM serial_numbers
+	WHERE authority_key_identifier = ?;`
+
+	upsertCRLNumberSQL = `
+INSERT INTO crl_numbers (authority_key_identifier, crl_number, base_crl_number, base_this_update)
+	VALUES (?, 1, 0, CURRENT_TIMESTAMP)
+	%s;`
+
+	selectCRLNumberSQL = `
+SELECT %s FROM crl_numbers
+	WHERE authority_key_identifier = ?;`
+
+	updateBaseCRLSQL = `
+UPDATE crl_numbers
+	SET base_crl_number = ?, base_this_update = ?
+	WHERE authority_key_identifier = ?;`
+
 	insertOCSPSQL = `
 INSERT INTO ocsp_responses (serial_number, authority_key_identifier, body, expiry)
   VALUES (:serial_number, :authority_key_identifier, :body, :expiry);`
@@ -73,6 +141,19 @@ func wrapSQLError(err error) error {
 	return nil
 }
 
+// isKeyReused reports whether err violates the unique index on the
+// unique_key_fingerprint column. The index is named after the column in
+// every dialect, and every driver names it in its error message.
+func isKeyReused(err error) bool {
+	return strings.Contains(err.Error(), "unique_key_fingerprint")
+}
+
+// observe starts timing a query for metrics.CertDBQueryDuration. The
+// ObserveDuration method of the timer records its duration.
+func observe(query string) *prometheus.Timer {
+	return prometheus.NewTimer(metrics.CertDBQueryDuration.WithLabelValues(query))
+}
+
 func (d *Accessor) checkDB() error {
 	if d.db == nil {
 		return cferr.Wrap(cferr.CertStoreError, cferr.Unknown,
@@ -92,14 +173,27 @@ func (d *Accessor) SetDB(db *sqlx.DB) {
 	return
 }
 
-// InsertCertificate puts a certdb.CertificateRecord into db.
+// InsertCertificate puts a certdb.CertificateRecord into db, along with
+// its labels. It returns certdb.ErrKeyReused if the issuer already has a
+// certificate with the same UniqueKeyFingerprint.
 func (d *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
+	defer observe("insert_certificate").ObserveDuration()
+
 	err := d.checkDB()
 	if err != nil {
 		return err
 	}
 
-	res, err := d.db.NamedExec(insertSQL, &certdb.CertificateRecord{
+	if err = certdb.ValidateLabels(cr.Labels); err != nil {
+		return cferr.Wrap(cferr.CertStoreError, cferr.InsertionFailed, err)
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return wrapSQLError(err)
+	}
+
+	res, err := tx.NamedExec(insertSQL, &certdb.CertificateRecord{
 		Serial:    cr.Serial,
 		AKI:       cr.AKI,
 		CALabel:   cr.CALabel,
@@ -108,26 +202,76 @@ func (d *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
 		Expiry:    cr.Expiry.UTC(),
 		RevokedAt: cr.RevokedAt.UTC(),
 		PEM:       cr.PEM,
+
+		CommonName: cr.CommonName,
+		SANs:       cr.SANs,
+		Profile:    cr.Profile,
+		Requester:  cr.Requester,
+
+		KeyFingerprint:       cr.KeyFingerprint,
+		UniqueKeyFingerprint: cr.UniqueKeyFingerprint,
+		InvalidityDate:       utc(cr.InvalidityDate),
 	})
 	if err != nil {
+		tx.Rollback()
+		if isKeyReused(err) {
+			return certdb.ErrKeyReused
+		}
 		return wrapSQLError(err)
 	}
 
 	numRowsAffected, err := res.RowsAffected()
 
 	if numRowsAffected == 0 {
+		tx.Rollback()
 		return cferr.Wrap(cferr.CertStoreError, cferr.InsertionFailed, fmt.Errorf("failed to insert the certificate record"))
 	}
 
 	if numRowsAffected != 1 {
+		tx.Rollback()
 		return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
 	}
 
-	return err
+	if err = d.insertLabels(tx, cr.Serial, cr.AKI, cr.Labels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapSQLError(err)
+	}
+	if d.publishesCertificates() {
+		events.Publish(certificateEvent(cr))
+	}
+	return nil
+}
+
+// insertLabels adds labels to the certificate with the given serial
+// number and authority key identifier within tx.
+func (d *Accessor) insertLabels(tx *sqlx.Tx, serial, aki string, labels map[string]string) error {
+	for _, name := range labelNames(labels) {
+		if _, err := tx.Exec(d.db.Rebind(insertLabelSQL), serial, aki, name, labels[name]); err != nil {
+			return wrapSQLError(err)
+		}
+	}
+	return nil
+}
+
+// labelNames returns the names of labels in order, so that queries are
+// built the same way for the same labels.
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // GetCertificate gets a certdb.CertificateRecord indexed by serial.
 func (d *Accessor) GetCertificate(serial, aki string) (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_certificate").ObserveDuration()
+
 	err = d.checkDB()
 	if err != nil {
 		return nil, err
@@ -141,8 +285,28 @@ func (d *Accessor) GetCertificate(serial, aki string) (crs []certdb.CertificateR
 	return crs, nil
 }
 
+// GetAllCertificates gets every certificate from db, expired and revoked
+// ones included.
+func (d *Accessor) GetAllCertificates() (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_all_certificates").ObserveDuration()
+
+	err = d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.db.Select(&crs, fmt.Sprintf(d.db.Rebind(selectAllSQL), sqlstruct.Columns(certdb.CertificateRecord{})))
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	return crs, nil
+}
+
 // GetUnexpiredCertificates gets all unexpired certificate from db.
 func (d *Accessor) GetUnexpiredCertificates() (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_unexpired_certificates").ObserveDuration()
+
 	err = d.checkDB()
 	if err != nil {
 		return nil, err
@@ -158,6 +322,8 @@ func (d *Accessor) GetUnexpiredCertificates() (crs []certdb.CertificateRecord, e
 
 // GetRevokedAndUnexpiredCertificates gets all revoked and unexpired certificate from db (for CRLs).
 func (d *Accessor) GetRevokedAndUnexpiredCertificates() (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_revoked_and_unexpired_certificates").ObserveDuration()
+
 	err = d.checkDB()
 	if err != nil {
 		return nil, err
@@ -173,6 +339,8 @@ func (d *Accessor) GetRevokedAndUnexpiredCertificates() (crs []certdb.Certificat
 
 // GetRevokedAndUnexpiredCertificatesByLabel gets all revoked and unexpired certificate from db (for CRLs) with specified ca_label.
 func (d *Accessor) GetRevokedAndUnexpiredCertificatesByLabel(label string) (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_revoked_and_unexpired_certificates_by_label").ObserveDuration()
+
 	err = d.checkDB()
 	if err != nil {
 		return nil, err
@@ -186,8 +354,177 @@ func (d *Accessor) GetRevokedAndUnexpiredCertificatesByLabel(label string) (crs
 	return crs, nil
 }
 
+// GetCertificatesByKeyFingerprint gets all certificates issued for the public key with the given fingerprint.
+func (d *Accessor) GetCertificatesByKeyFingerprint(fingerprint string) (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_certificates_by_key_fingerprint").ObserveDuration()
+
+	err = d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.db.Select(&crs, fmt.Sprintf(d.db.Rebind(selectByKeyFingerprintSQL), sqlstruct.Columns(certdb.CertificateRecord{})), fingerprint)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	return crs, nil
+}
+
+// GetCertificatesByFilter gets all certificates matching every field set
+// in filter.
+func (d *Accessor) GetCertificatesByFilter(filter certdb.CertificateFilter) (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_certificates_by_filter").ObserveDuration()
+
+	err = d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	for _, field := range []struct{ column, value string }{
+		{"common_name", filter.CommonName},
+		{"profile", filter.Profile},
+		{"requester", filter.Requester},
+	} {
+		if field.value != "" {
+			conditions = append(conditions, field.column+" = ?")
+			args = append(args, field.value)
+		}
+	}
+	if filter.SAN != "" {
+		// sans holds the names comma-separated: match the whole
+		// column, or the name at its start, end or middle.
+		san := likeEscaper.Replace(filter.SAN)
+		conditions = append(conditions, sanConditionSQL)
+		args = append(args, filter.SAN, san+",%", "%,"+san, "%,"+san+",%")
+	}
+
+	query := fmt.Sprintf(selectByFilterSQL, sqlstruct.Columns(certdb.CertificateRecord{}), strings.Join(conditions, " AND "))
+	err = d.db.Select(&crs, d.db.Rebind(query), args...)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	return crs, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, with the escape
+// character of sanConditionSQL.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// GetCertificatesByLabels gets all certificates carrying every one of the
+// given labels, with all their labels filled in. Every certificate
+// matches an empty set of labels.
+func (d *Accessor) GetCertificatesByLabels(labels map[string]string) (crs []certdb.CertificateRecord, err error) {
+	defer observe("get_certificates_by_labels").ObserveDuration()
+
+	err = d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(selectAllSQL, sqlstruct.Columns(certdb.CertificateRecord{}))
+	var args []interface{}
+	if len(labels) > 0 {
+		var conditions []string
+		for _, name := range labelNames(labels) {
+			conditions = append(conditions, labelConditionSQL)
+			args = append(args, name, labels[name])
+		}
+		query = fmt.Sprintf(selectByLabelsSQL, sqlstruct.Columns(certdb.CertificateRecord{}), strings.Join(conditions, " AND "))
+	}
+
+	err = d.db.Select(&crs, d.db.Rebind(query), args...)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	for i := range crs {
+		if crs[i].Labels, err = d.GetCertificateLabels(crs[i].Serial, crs[i].AKI); err != nil {
+			return nil, err
+		}
+	}
+
+	return crs, nil
+}
+
+// labelRow is a row of the certificate_labels table.
+type labelRow struct {
+	Name  string `db:"name"`
+	Value string `db:"value"`
+}
+
+// GetCertificateLabels gets the labels of the certificate with the given
+// serial number and authority key identifier.
+func (d *Accessor) GetCertificateLabels(serial, aki string) (map[string]string, error) {
+	defer observe("get_certificate_labels").ObserveDuration()
+
+	err := d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []labelRow
+	err = d.db.Select(&rows, d.db.Rebind(selectLabelsSQL), serial, aki)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	labels := make(map[string]string, len(rows))
+	for _, row := range rows {
+		labels[row.Name] = row.Value
+	}
+	return labels, nil
+}
+
+// SetCertificateLabels replaces the labels of the certificate with the
+// given serial number and authority key identifier.
+func (d *Accessor) SetCertificateLabels(serial, aki string, labels map[string]string) error {
+	defer observe("set_certificate_labels").ObserveDuration()
+
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	if err = certdb.ValidateLabels(labels); err != nil {
+		return cferr.Wrap(cferr.CertStoreError, cferr.InsertionFailed, err)
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return wrapSQLError(err)
+	}
+
+	var count int
+	if err = tx.Get(&count, d.db.Rebind(countCertificateSQL), serial, aki); err != nil {
+		tx.Rollback()
+		return wrapSQLError(err)
+	}
+	if count == 0 {
+		tx.Rollback()
+		return cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound, fmt.Errorf("failed to set the certificate labels: certificate not found"))
+	}
+
+	if _, err = tx.Exec(d.db.Rebind(deleteLabelsSQL), serial, aki); err != nil {
+		tx.Rollback()
+		return wrapSQLError(err)
+	}
+
+	if err = d.insertLabels(tx, serial, aki, labels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return wrapSQLError(tx.Commit())
+}
+
 // RevokeCertificate updates a certificate with a given serial number and marks it revoked.
 func (d *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
+	defer observe("revoke_certificate").ObserveDuration()
+
 	err := d.checkDB()
 	if err != nil {
 		return err
@@ -212,11 +549,202 @@ func (d *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
 		return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
 	}
 
+	if d.publishesCertificates() {
+		events.Publish(revokedEvent(serial, aki, reasonCode))
+	}
 	return err
 }
 
+// RevokeCertificates marks all the given certificates revoked in a
+// single transaction: if any of them can't be revoked, none is.
+func (d *Accessor) RevokeCertificates(revocations []certdb.Revocation) error {
+	defer observe("revoke_certificates").ObserveDuration()
+
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return wrapSQLError(err)
+	}
+
+	for _, r := range revocations {
+		r.InvalidityDate = utc(r.InvalidityDate)
+		result, err := tx.NamedExec(updateRevokeSQL, &r)
+		if err != nil {
+			tx.Rollback()
+			return wrapSQLError(err)
+		}
+
+		numRowsAffected, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return wrapSQLError(err)
+		}
+
+		if numRowsAffected == 0 {
+			tx.Rollback()
+			return cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound,
+				fmt.Errorf("failed to revoke the certificate with serial %s and AKI %s: certificate not found", r.Serial, r.AKI))
+		}
+
+		if numRowsAffected != 1 {
+			tx.Rollback()
+			return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapSQLError(err)
+	}
+	if d.publishesCertificates() {
+		for _, r := range revocations {
+			events.Publish(revokedEvent(r.Serial, r.AKI, r.Reason))
+		}
+	}
+	return nil
+}
+
+// NextSerialNumber advances the serial number sequence of the issuer
+// with the given authority key identifier and returns its new value.
+// The sequence of a new issuer starts at 1.
+func (d *Accessor) NextSerialNumber(aki string) (int64, error) {
+	defer observe("next_serial_number").ObserveDuration()
+
+	err := d.checkDB()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, wrapSQLError(err)
+	}
+
+	// The upsert starts or advances the sequence in one statement,
+	// and locks the issuer's row until the transaction ends, so
+	// concurrent signers can't draw the same serial number.
+	upsert := fmt.Sprintf(upsertSerialSQL, d.onConflictIncrement("serial_number"))
+	if _, err = tx.Exec(d.db.Rebind(upsert), aki); err != nil {
+		tx.Rollback()
+		return 0, wrapSQLError(err)
+	}
+
+	var serial int64
+	if err = tx.Get(&serial, d.db.Rebind(selectSerialSQL), aki); err != nil {
+		tx.Rollback()
+		return 0, wrapSQLError(err)
+	}
+
+	return serial, wrapSQLError(tx.Commit())
+}
+
+// onConflictIncrement returns the clause that makes an INSERT into a
+// sequence table increment column instead, when the issuer already has
+// a row.
+func (d *Accessor) onConflictIncrement(column string) string {
+	if d.db.DriverName() == "mysql" {
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %[1]s = %[1]s + 1", column)
+	}
+	return fmt.Sprintf("ON CONFLICT (authority_key_identifier) DO UPDATE SET %[1]s = %[1]s + 1", column)
+}
+
+// NextCRLNumber advances the CRL number sequence of the issuer with the
+// given authority key identifier and returns its new value. As with
+// NextSerialNumber, the sequence of a new issuer starts at 1.
+func (d *Accessor) NextCRLNumber(aki string) (int64, error) {
+	defer observe("next_crl_number").ObserveDuration()
+
+	err := d.checkDB()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, wrapSQLError(err)
+	}
+
+	// As in NextSerialNumber, the upsert locks the issuer's row until
+	// the transaction ends, so concurrent CRL generations can't draw
+	// the same number.
+	upsert := fmt.Sprintf(upsertCRLNumberSQL, d.onConflictIncrement("crl_number"))
+	if _, err = tx.Exec(d.db.Rebind(upsert), aki); err != nil {
+		tx.Rollback()
+		return 0, wrapSQLError(err)
+	}
+
+	var number int64
+	if err = tx.Get(&number, d.db.Rebind(fmt.Sprintf(selectCRLNumberSQL, "crl_number")), aki); err != nil {
+		tx.Rollback()
+		return 0, wrapSQLError(err)
+	}
+
+	return number, wrapSQLError(tx.Commit())
+}
+
+// GetCRLRecord returns the CRL number sequence of the issuer with the
+// given authority key identifier, if it has one.
+func (d *Accessor) GetCRLRecord(aki string) (crs []certdb.CRLRecord, err error) {
+	defer observe("get_crl_record").ObserveDuration()
+
+	err = d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.db.Select(&crs, fmt.Sprintf(d.db.Rebind(selectCRLNumberSQL), sqlstruct.Columns(certdb.CRLRecord{})), aki)
+	if err != nil {
+		return nil, wrapSQLError(err)
+	}
+
+	return crs, nil
+}
+
+// SetBaseCRL records the full CRL with the given number and thisUpdate
+// time as the base of the next delta CRLs of the issuer with the given
+// authority key identifier. The number must have been drawn with
+// NextCRLNumber.
+func (d *Accessor) SetBaseCRL(aki string, number int64, thisUpdate time.Time) error {
+	defer observe("set_base_crl").ObserveDuration()
+
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec(d.db.Rebind(updateBaseCRLSQL), number, thisUpdate.UTC(), aki)
+	if err != nil {
+		return wrapSQLError(err)
+	}
+
+	numRowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapSQLError(err)
+	}
+
+	if numRowsAffected == 0 {
+		return cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound, fmt.Errorf("failed to record the base CRL: no CRL number sequence for the issuer"))
+	}
+
+	return nil
+}
+
+// utc returns t in UTC, or nil if t is nil.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
 // InsertOCSP puts a new certdb.OCSPRecord into the db.
 func (d *Accessor) InsertOCSP(rr certdb.OCSPRecord) error {
+	defer observe("insert_ocsp").ObserveDuration()
+
 	err := d.checkDB()
 	if err != nil {
 		return err
@@ -242,11 +770,14 @@ func (d *Accessor) InsertOCSP(rr certdb.OCSPRecord) error {
 		return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
 	}
 
+	events.Publish(events.Event{Type: events.OCSPRefreshed, Serial: rr.Serial, AKI: rr.AKI})
 	return err
 }
 
 // GetOCSP retrieves a certdb.OCSPRecord from db by serial.
 func (d *Accessor) GetOCSP(serial, aki string) (ors []certdb.OCSPRecord, err error) {
+	defer observe("get_ocsp").ObserveDuration()
+
 	err = d.checkDB()
 	if err != nil {
 		return nil, err
@@ -262,6 +793,8 @@ func (d *Accessor) GetOCSP(serial, aki string) (ors []certdb.OCSPRecord, err err
 
 // GetUnexpiredOCSPs retrieves all unexpired certdb.OCSPRecord from db.
 func (d *Accessor) GetUnexpiredOCSPs() (ors []certdb.OCSPRecord, err error) {
+	defer observe("get_unexpired_ocsps").ObserveDuration()
+
 	err = d.checkDB()
 	if err != nil {
 		return nil, err
@@ -277,6 +810,8 @@ func (d *Accessor) GetUnexpiredOCSPs() (ors []certdb.OCSPRecord, err error) {
 
 // UpdateOCSP updates a ocsp response record with a given serial number.
 func (d *Accessor) UpdateOCSP(serial, aki, body string, expiry time.Time) error {
+	defer observe("update_ocsp").ObserveDuration()
+
 	err := d.checkDB()
 	if err != nil {
 		return err
@@ -302,6 +837,7 @@ func (d *Accessor) UpdateOCSP(serial, aki, body string, expiry time.Time) error
 		return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
 	}
 
+	events.Publish(events.Event{Type: events.OCSPRefreshed, Serial: serial, AKI: aki})
 	return err
 }
 
@@ -322,6 +858,8 @@ func (d *Accessor) UpdateOCSP(serial, aki, body string, expiry time.Time) error
 // writers should periodically use Certificate table to update OCSP table
 // to catch up.
 func (d *Accessor) UpsertOCSP(serial, aki, body string, expiry time.Time) error {
+	defer observe("upsert_ocsp").ObserveDuration()
+
 	err := d.checkDB()
 	if err != nil {
 		return err
@@ -348,5 +886,6 @@ func (d *Accessor) UpsertOCSP(serial, aki, body string, expiry time.Time) error
 		return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
 	}
 
+	events.Publish(events.Event{Type: events.OCSPRefreshed, Serial: serial, AKI: aki})
 	return err
 }
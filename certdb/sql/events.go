@@ -0,0 +1,114 @@
+package sql
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/events"
+	"github.com/cloudflare/cfssl/log"
+
+	"github.com/lib/pq"
+)
+
+// NotifyChannel is the PostgreSQL channel on which the trigger added by
+// the NotifyCertificateChanges migration announces certificates that are
+// signed or revoked.
+const NotifyChannel = "cfssl_certificates"
+
+// publishesCertificates reports whether d publishes the certificates it
+// inserts and revokes on events.DefaultBus. On PostgreSQL, the database
+// announces them to every process instead, and RelayCertificateEvents
+// publishes them, so that they are published once.
+func (d *Accessor) publishesCertificates() bool {
+	return d.db.DriverName() != "postgres"
+}
+
+// certificateEvent returns the event publishing the issuance or the
+// revocation of the certificate of cr.
+func certificateEvent(cr certdb.CertificateRecord) events.Event {
+	if cr.Status == "revoked" {
+		return revokedEvent(cr.Serial, cr.AKI, cr.Reason)
+	}
+
+	expiry := cr.Expiry.UTC()
+	e := events.Event{
+		Type:     events.CertificateIssued,
+		Serial:   cr.Serial,
+		AKI:      cr.AKI,
+		Profile:  cr.Profile,
+		NotAfter: &expiry,
+	}
+	if block, _ := pem.Decode([]byte(cr.PEM)); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			e.Subject = cert.Subject.String()
+		}
+	}
+	return e
+}
+
+// revokedEvent returns the event publishing the revocation of a
+// certificate with the given reason code.
+func revokedEvent(serial, aki string, reason int) events.Event {
+	return events.Event{Type: events.CertificateRevoked, Serial: serial, AKI: aki, Reason: &reason}
+}
+
+// RelayCertificateEvents publishes on events.DefaultBus the certificates
+// that the PostgreSQL database at dataSource announces on NotifyChannel
+// as they are signed or revoked, by this process or any other, until
+// stop is closed. Certificates announced while the connection is down
+// are not published. RelayCertificateEvents returns an error if it
+// cannot start listening.
+func RelayCertificateEvents(dataSource string, dbAccessor certdb.Accessor, stop <-chan struct{}) error {
+	listener := pq.NewListener(dataSource, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warningf("certificate event listener: %v", err)
+		}
+	})
+	if err := listener.Listen(NotifyChannel); err != nil {
+		listener.Close()
+		return err
+	}
+	defer listener.Close()
+	log.Infof("Relaying certificate events from %s", NotifyChannel)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnection.
+			if n == nil {
+				continue
+			}
+			if err := relayCertificateEvent(dbAccessor, n.Extra); err != nil {
+				log.Errorf("Unable to publish a certificate event: %v", err)
+			}
+		}
+	}
+}
+
+// relayCertificateEvent publishes the certificate named by a
+// notification payload.
+func relayCertificateEvent(dbAccessor certdb.Accessor, payload string) error {
+	var n struct {
+		Serial string `json:"serial"`
+		AKI    string `json:"aki"`
+	}
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return fmt.Errorf("malformed certificate notification %q: %v", payload, err)
+	}
+
+	crs, err := dbAccessor.GetCertificate(n.Serial, n.AKI)
+	if err != nil {
+		return err
+	}
+	if len(crs) == 0 {
+		return fmt.Errorf("no certificate with serial %s and AKI %s", n.Serial, n.AKI)
+	}
+	events.Publish(certificateEvent(crs[0]))
+	return nil
+}
@@ -2,13 +2,19 @@ package sql
 
 import (
 	"math"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/events"
+	"github.com/cloudflare/cfssl/metrics"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 const (
@@ -42,6 +48,73 @@ func TestSQLite(t *testing.T) {
 	testEverything(ta, t)
 }
 
+func TestSQLiteQueryMetrics(t *testing.T) {
+	db := testdb.SQLiteDB(sqliteDBFile)
+	dba := NewAccessor(db)
+
+	queries := func() uint64 {
+		var m dto.Metric
+		h := metrics.CertDBQueryDuration.WithLabelValues("get_certificate").(prometheus.Metric)
+		if err := h.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	before := queries()
+	if _, err := dba.GetCertificate("1", fakeAKI); err != nil {
+		t.Fatal(err)
+	}
+	if queries() != before+1 {
+		t.Error("certificate query duration not recorded")
+	}
+}
+
+func TestSQLiteEvents(t *testing.T) {
+	db := testdb.SQLiteDB(sqliteDBFile)
+	testdb.Truncate(db)
+	dba := NewAccessor(db)
+
+	published, unsubscribe := events.Subscribe(8)
+	defer unsubscribe()
+
+	expiry := time.Now().Add(time.Hour)
+	for _, serial := range []string{"1", "2"} {
+		cr := certdb.CertificateRecord{PEM: "fake cert data", Serial: serial, AKI: fakeAKI, Status: "good", Expiry: expiry, Profile: "www"}
+		if err := dba.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dba.RevokeCertificates([]certdb.Revocation{{Serial: "1", AKI: fakeAKI, Reason: 1}, {Serial: "2", AKI: fakeAKI, Reason: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dba.UpsertOCSP("1", fakeAKI, "fake ocsp data", expiry); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []struct {
+		typ, serial string
+		reason      int
+	}{
+		{events.CertificateIssued, "1", 0},
+		{events.CertificateIssued, "2", 0},
+		{events.CertificateRevoked, "1", 1},
+		{events.CertificateRevoked, "2", 4},
+		{events.OCSPRefreshed, "1", 0},
+	} {
+		e := <-published
+		if e.Type != want.typ || e.Serial != want.serial || e.AKI != fakeAKI {
+			t.Fatalf("expected a %s event for serial %s, got %+v", want.typ, want.serial, e)
+		}
+		if e.Type == events.CertificateIssued && (e.Profile != "www" || e.NotAfter == nil) {
+			t.Errorf("unexpected issuance event %+v", e)
+		}
+		if e.Type == events.CertificateRevoked && (e.Reason == nil || *e.Reason != want.reason) {
+			t.Errorf("unexpected revocation event %+v", e)
+		}
+	}
+}
+
 // roughlySameTime decides if t1 and t2 are close enough.
 func roughlySameTime(t1, t2 time.Time) bool {
 	// return true if the difference is smaller than 1 sec.
@@ -51,7 +124,13 @@ func roughlySameTime(t1, t2 time.Time) bool {
 func testEverything(ta TestAccessor, t *testing.T) {
 	testInsertCertificateAndGetCertificate(ta, t)
 	testInsertCertificateAndGetUnexpiredCertificate(ta, t)
+	testInsertCertificateWithUniqueKey(ta, t)
+	testGetCertificatesByFilter(ta, t)
 	testUpdateCertificateAndGetCertificate(ta, t)
+	testRevokeCertificates(ta, t)
+	testCertificateLabels(ta, t)
+	testNextSerialNumber(ta, t)
+	testCRLNumbers(ta, t)
 	testInsertOCSPAndGetOCSP(ta, t)
 	testInsertOCSPAndGetUnexpiredOCSP(ta, t)
 	testUpdateOCSPAndGetOCSP(ta, t)
@@ -63,12 +142,18 @@ func testInsertCertificateAndGetCertificate(ta TestAccessor, t *testing.T) {
 
 	expiry := time.Date(2010, time.December, 25, 23, 0, 0, 0, time.UTC)
 	want := certdb.CertificateRecord{
-		PEM:    "fake cert data",
-		Serial: "fake serial",
-		AKI:    fakeAKI,
-		Status: "good",
-		Reason: 0,
-		Expiry: expiry,
+		PEM:        "fake cert data",
+		Serial:     "fake serial",
+		AKI:        fakeAKI,
+		Status:     "good",
+		Reason:     0,
+		Expiry:     expiry,
+		CommonName: "example.com",
+		SANs:       "example.com,127.0.0.1",
+		Profile:    "server",
+		Requester:  "fake requester",
+
+		KeyFingerprint: "fake key fingerprint",
 	}
 
 	if err := ta.Accessor.InsertCertificate(want); err != nil {
@@ -93,6 +178,31 @@ func testInsertCertificateAndGetCertificate(ta TestAccessor, t *testing.T) {
 		t.Errorf("want Certificate %+v, got %+v", want, got)
 	}
 
+	if want.CommonName != got.CommonName || want.SANs != got.SANs ||
+		want.Profile != got.Profile || want.Requester != got.Requester {
+		t.Errorf("want Certificate metadata %+v, got %+v", want, got)
+	}
+
+	fingerprints, ok := ta.Accessor.(certdb.KeyFingerprintAccessor)
+	if !ok {
+		t.Fatal("accessor doesn't look up key fingerprints")
+	}
+	rets, err = fingerprints.GetCertificatesByKeyFingerprint(want.KeyFingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rets) != 1 || rets[0].Serial != want.Serial {
+		t.Errorf("want one certificate with key fingerprint %q, got %+v", want.KeyFingerprint, rets)
+	}
+
+	rets, err = fingerprints.GetCertificatesByKeyFingerprint("unknown key fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rets) != 0 {
+		t.Errorf("should not have certificates for an unknown key fingerprint, got %+v", rets)
+	}
+
 	unexpired, err := ta.Accessor.GetUnexpiredCertificates()
 
 	if err != nil {
@@ -102,6 +212,110 @@ func testInsertCertificateAndGetCertificate(ta TestAccessor, t *testing.T) {
 	if len(unexpired) != 0 {
 		t.Error("should not have unexpired certificate record")
 	}
+
+	all, err := ta.Accessor.GetAllCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Serial != want.Serial {
+		t.Errorf("want the expired certificate among all certificates, got %+v", all)
+	}
+}
+
+func testInsertCertificateWithUniqueKey(ta TestAccessor, t *testing.T) {
+	ta.Truncate()
+
+	fingerprint := "fake key fingerprint"
+	insert := func(serial, aki string, unique bool) error {
+		cr := certdb.CertificateRecord{
+			PEM:            "fake cert data",
+			Serial:         serial,
+			AKI:            aki,
+			Status:         "good",
+			Expiry:         time.Now().Add(time.Hour),
+			KeyFingerprint: fingerprint,
+		}
+		if unique {
+			cr.UniqueKeyFingerprint = &fingerprint
+		}
+		return ta.Accessor.InsertCertificate(cr)
+	}
+
+	// Certificates recorded without a unique key fingerprint never
+	// collide.
+	for _, serial := range []string{"1", "2"} {
+		if err := insert(serial, fakeAKI, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := insert("3", fakeAKI, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := insert("4", fakeAKI, true); err != certdb.ErrKeyReused {
+		t.Fatalf("expected ErrKeyReused, got %v", err)
+	}
+	if err := insert("4", "other_aki", true); err != nil {
+		t.Fatalf("expected the key to be unique per issuer only: %v", err)
+	}
+
+	rets, err := ta.Accessor.GetCertificate("3", fakeAKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rets) != 1 || rets[0].UniqueKeyFingerprint == nil || *rets[0].UniqueKeyFingerprint != fingerprint {
+		t.Errorf("want unique key fingerprint %q, got %+v", fingerprint, rets)
+	}
+}
+
+func testGetCertificatesByFilter(ta TestAccessor, t *testing.T) {
+	ta.Truncate()
+
+	for _, cr := range []certdb.CertificateRecord{
+		{Serial: "1", CommonName: "www.example.com", SANs: "www.example.com,example.com", Profile: "www", Requester: "alice"},
+		{Serial: "2", CommonName: "example.com", SANs: "example.com", Profile: "www", Requester: "bob"},
+		{Serial: "3", CommonName: "mail.example.com", SANs: "mail.example.com,127.0.0.1", Profile: "mail", Requester: "alice"},
+		{Serial: "4", CommonName: "exampleXcom", SANs: "mail.example.com,exampleXcom", Profile: "mail", Requester: "bob"},
+	} {
+		cr.PEM = "fake cert data"
+		cr.AKI = fakeAKI
+		cr.Status = "good"
+		cr.Expiry = time.Now().Add(time.Hour)
+		if err := ta.Accessor.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filters, ok := ta.Accessor.(certdb.CertificateFilterAccessor)
+	if !ok {
+		t.Fatal("accessor doesn't filter certificates")
+	}
+	for _, test := range []struct {
+		filter certdb.CertificateFilter
+		want   []string
+	}{
+		{certdb.CertificateFilter{}, []string{"1", "2", "3", "4"}},
+		{certdb.CertificateFilter{CommonName: "example.com"}, []string{"2"}},
+		{certdb.CertificateFilter{SAN: "example.com"}, []string{"1", "2"}},
+		{certdb.CertificateFilter{SAN: "127.0.0.1"}, []string{"3"}},
+		{certdb.CertificateFilter{SAN: "example_com"}, nil},
+		{certdb.CertificateFilter{Profile: "www"}, []string{"1", "2"}},
+		{certdb.CertificateFilter{Requester: "alice"}, []string{"1", "3"}},
+		{certdb.CertificateFilter{Profile: "mail", Requester: "alice"}, []string{"3"}},
+		{certdb.CertificateFilter{Profile: "mail", SAN: "www.example.com"}, nil},
+	} {
+		crs, err := filters.GetCertificatesByFilter(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, cr := range crs {
+			got = append(got, cr.Serial)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("filter %+v: want certificates %v, got %v", test.filter, test.want, got)
+		}
+	}
 }
 
 func testInsertCertificateAndGetUnexpiredCertificate(ta TestAccessor, t *testing.T) {
@@ -224,6 +438,207 @@ func testUpdateCertificateAndGetCertificate(ta TestAccessor, t *testing.T) {
 	}
 }
 
+func testRevokeCertificates(ta TestAccessor, t *testing.T) {
+	ta.Truncate()
+
+	expiry := time.Now().Add(time.Hour)
+	for _, serial := range []string{"fake serial 4", "fake serial 5"} {
+		cr := certdb.CertificateRecord{
+			PEM:    "fake cert data",
+			Serial: serial,
+			AKI:    fakeAKI,
+			Status: "good",
+			Expiry: expiry,
+		}
+		if err := ta.Accessor.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A missing certificate aborts the whole batch.
+	err := ta.Accessor.RevokeCertificates([]certdb.Revocation{
+		{Serial: "fake serial 4", AKI: fakeAKI, Reason: 1},
+		{Serial: "fake serial 6", AKI: fakeAKI, Reason: 1},
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	rets, err := ta.Accessor.GetRevokedAndUnexpiredCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rets) != 0 {
+		t.Fatalf("no certificate should be revoked, got %+v", rets)
+	}
+
+	invalidityDate := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	err = ta.Accessor.RevokeCertificates([]certdb.Revocation{
+		{Serial: "fake serial 4", AKI: fakeAKI, Reason: 1, InvalidityDate: &invalidityDate},
+		{Serial: "fake serial 5", AKI: fakeAKI, Reason: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rets, err = ta.Accessor.GetRevokedAndUnexpiredCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rets) != 2 {
+		t.Fatalf("should return exactly two records, got %d", len(rets))
+	}
+	for _, got := range rets {
+		if (got.Serial == "fake serial 4" && got.Reason != 1) || (got.Serial == "fake serial 5" && got.Reason != 4) {
+			t.Errorf("wrong revocation reason for %+v", got)
+		}
+		if (got.Serial == "fake serial 4") != (got.InvalidityDate != nil) ||
+			got.InvalidityDate != nil && !got.InvalidityDate.Equal(invalidityDate) {
+			t.Errorf("wrong invalidity date for %+v", got)
+		}
+	}
+}
+
+func testCertificateLabels(ta TestAccessor, t *testing.T) {
+	ta.Truncate()
+
+	expiry := time.Now().Add(time.Hour)
+	for _, cr := range []certdb.CertificateRecord{
+		{Serial: "1", Labels: map[string]string{"team": "pki", "env": "prod"}},
+		{Serial: "2", Labels: map[string]string{"team": "pki", "env": "staging"}},
+		{Serial: "3", Labels: map[string]string{"team": "web", "env": "prod"}},
+		{Serial: "4"},
+	} {
+		cr.AKI, cr.Status, cr.Expiry, cr.PEM = fakeAKI, "good", expiry, "fake cert data"
+		if err := ta.Accessor.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		labels  map[string]string
+		serials []string
+	}{
+		{map[string]string{"team": "pki"}, []string{"1", "2"}},
+		{map[string]string{"team": "pki", "env": "prod"}, []string{"1"}},
+		{map[string]string{"env": "prod"}, []string{"1", "3"}},
+		{map[string]string{"env": "dev"}, nil},
+		{nil, []string{"1", "2", "3", "4"}},
+	} {
+		crs, err := ta.Accessor.GetCertificatesByLabels(tc.labels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var serials []string
+		for _, cr := range crs {
+			serials = append(serials, cr.Serial)
+		}
+		sort.Strings(serials)
+		if !reflect.DeepEqual(serials, tc.serials) {
+			t.Errorf("want certificates %v with labels %v, got %v", tc.serials, tc.labels, serials)
+		}
+		for _, cr := range crs {
+			if cr.Serial == "1" && cr.Labels["env"] != "prod" {
+				t.Errorf("want the labels of certificate 1, got %v", cr.Labels)
+			}
+		}
+	}
+
+	want := map[string]string{"team": "db"}
+	if err := ta.Accessor.SetCertificateLabels("1", fakeAKI, want); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := ta.Accessor.GetCertificateLabels("1", fakeAKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("want labels %v, got %v", want, labels)
+	}
+
+	if err := ta.Accessor.SetCertificateLabels("unknown", fakeAKI, want); err == nil {
+		t.Error("expected setting the labels of an unknown certificate to fail")
+	}
+	if err := ta.Accessor.SetCertificateLabels("1", fakeAKI, map[string]string{"": "empty"}); err == nil {
+		t.Error("expected an empty label name to be rejected")
+	}
+}
+
+func testNextSerialNumber(ta TestAccessor, t *testing.T) {
+	ta.Truncate()
+
+	for _, want := range []struct {
+		aki    string
+		serial int64
+	}{{fakeAKI, 1}, {fakeAKI, 2}, {"other aki", 1}, {fakeAKI, 3}} {
+		serial, err := ta.Accessor.NextSerialNumber(want.aki)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if serial != want.serial {
+			t.Fatalf("want serial %d for %s, got %d", want.serial, want.aki, serial)
+		}
+	}
+
+	// Signers starting a sequence at once all get a serial number.
+	const signers = 4
+	serials := make(chan int64, signers)
+	errs := make(chan error, signers)
+	for i := 0; i < signers; i++ {
+		go func() {
+			serial, err := ta.Accessor.NextSerialNumber("new aki")
+			serials <- serial
+			errs <- err
+		}()
+	}
+	seen := map[int64]bool{}
+	for i := 0; i < signers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		seen[<-serials] = true
+	}
+	for serial := int64(1); serial <= signers; serial++ {
+		if !seen[serial] {
+			t.Fatalf("want serials 1 to %d, got %v", signers, seen)
+		}
+	}
+}
+
+func testCRLNumbers(ta TestAccessor, t *testing.T) {
+	ta.Truncate()
+
+	if crs, err := ta.Accessor.GetCRLRecord(fakeAKI); err != nil || len(crs) != 0 {
+		t.Fatalf("expected no CRL number sequence, got %+v (%v)", crs, err)
+	}
+	if err := ta.Accessor.SetBaseCRL(fakeAKI, 1, time.Now()); err == nil {
+		t.Fatal("expected recording a base CRL without a sequence to fail")
+	}
+
+	for _, want := range []struct {
+		aki    string
+		number int64
+	}{{fakeAKI, 1}, {fakeAKI, 2}, {"other aki", 1}, {fakeAKI, 3}} {
+		number, err := ta.Accessor.NextCRLNumber(want.aki)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if number != want.number {
+			t.Fatalf("want CRL number %d for %s, got %d", want.number, want.aki, number)
+		}
+	}
+
+	thisUpdate := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if err := ta.Accessor.SetBaseCRL(fakeAKI, 2, thisUpdate); err != nil {
+		t.Fatal(err)
+	}
+	crs, err := ta.Accessor.GetCRLRecord(fakeAKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 || crs[0].Number != 3 || crs[0].BaseNumber != 2 || !crs[0].BaseThisUpdate.Equal(thisUpdate) {
+		t.Fatalf("unexpected CRL number sequence %+v", crs)
+	}
+}
+
 func testInsertOCSPAndGetOCSP(ta TestAccessor, t *testing.T) {
 	ta.Truncate()
 
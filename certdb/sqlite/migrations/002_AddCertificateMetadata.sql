@@ -0,0 +1,31 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN common_name blob NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN sans blob NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN profile blob NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN requester blob NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- SQLite can't drop columns, so the certificates table is rebuilt
+-- without the metadata columns.
+CREATE TABLE certificates_down (
+  serial_number            blob NOT NULL,
+  authority_key_identifier blob NOT NULL,
+  ca_label                 blob,
+  status                   blob NOT NULL,
+  reason                   int,
+  expiry                   timestamp,
+  revoked_at               timestamp,
+  pem                      blob NOT NULL,
+  PRIMARY KEY(serial_number, authority_key_identifier)
+);
+
+INSERT INTO certificates_down
+  SELECT serial_number, authority_key_identifier, ca_label, status, reason, expiry, revoked_at, pem
+  FROM certificates;
+
+DROP TABLE certificates;
+ALTER TABLE certificates_down RENAME TO certificates;
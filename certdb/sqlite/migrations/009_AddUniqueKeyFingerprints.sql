@@ -0,0 +1,39 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN unique_key_fingerprint blob;
+CREATE UNIQUE INDEX certificates_unique_key_fingerprint ON certificates (authority_key_identifier, unique_key_fingerprint);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- SQLite can't drop columns, so the certificates table is rebuilt
+-- without unique_key_fingerprint.
+DROP INDEX certificates_unique_key_fingerprint;
+
+CREATE TABLE certificates_down (
+  serial_number            blob NOT NULL,
+  authority_key_identifier blob NOT NULL,
+  ca_label                 blob,
+  status                   blob NOT NULL,
+  reason                   int,
+  expiry                   timestamp,
+  revoked_at               timestamp,
+  pem                      blob NOT NULL,
+  common_name              blob NOT NULL DEFAULT '',
+  sans                     blob NOT NULL DEFAULT '',
+  profile                  blob NOT NULL DEFAULT '',
+  requester                blob NOT NULL DEFAULT '',
+  key_fingerprint          blob NOT NULL DEFAULT '',
+  invalidity_date          timestamp,
+  PRIMARY KEY(serial_number, authority_key_identifier)
+);
+
+INSERT INTO certificates_down
+  SELECT serial_number, authority_key_identifier, ca_label, status, reason, expiry, revoked_at, pem,
+    common_name, sans, profile, requester, key_fingerprint, invalidity_date
+  FROM certificates;
+
+DROP TABLE certificates;
+ALTER TABLE certificates_down RENAME TO certificates;
+CREATE INDEX certificates_key_fingerprint ON certificates (key_fingerprint);
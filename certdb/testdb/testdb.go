@@ -4,6 +4,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+
 	_ "github.com/go-sql-driver/mysql" // register mysql driver
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"           // register postgresql driver
@@ -14,6 +16,9 @@ const (
 	mysqlTruncateTables = `
 TRUNCATE certificates;
 TRUNCATE ocsp_responses;
+TRUNCATE serial_numbers;
+TRUNCATE crl_numbers;
+TRUNCATE certificate_labels;
 `
 
 	pgTruncateTables = `
@@ -37,17 +42,25 @@ SELECT truncate_tables();
 	sqliteTruncateTables = `
 DELETE FROM certificates;
 DELETE FROM ocsp_responses;
+DELETE FROM serial_numbers;
+DELETE FROM crl_numbers;
+DELETE FROM certificate_labels;
 `
 )
 
 // MySQLDB returns a MySQL db instance for certdb testing.
 func MySQLDB() *sqlx.DB {
-	connStr := "root@tcp(localhost:3306)/certdb_development?parseTime=true"
+	connStr := "root@tcp(localhost:3306)/certdb_development"
 
 	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
 		connStr = dbURL
 	}
 
+	connStr, err := dbconf.MySQLDataSource(connStr)
+	if err != nil {
+		panic(err)
+	}
+
 	db, err := sqlx.Open("mysql", connStr)
 	if err != nil {
 		panic(err)
@@ -1,9 +1,13 @@
 package certinfo
 
 import (
+	"bytes"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -13,6 +17,7 @@ import (
 
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
 )
 
 // Certificate represents a JSON description of an X.509 certificate.
@@ -27,8 +32,54 @@ type Certificate struct {
 	AKI                string    `json:"authority_key_id"`
 	SKI                string    `json:"subject_key_id"`
 	RawPEM             string    `json:"pem"`
+	// DERBytes is the size of the DER encoded certificate, and PEMLines
+	// the number of lines of its PEM encoding.
+	DERBytes int `json:"der_bytes"`
+	PEMLines int `json:"pem_lines"`
+	// Large is set when DERBytes exceeds LargeCertificateSize.
+	Large bool `json:"large,omitempty"`
+	// RSAModulusBits and RSAExponent describe the public key of RSA
+	// certificates. The modulus length is the exact bit length of the
+	// modulus, which may be below the nominal key size of a weak key.
+	RSAModulusBits int `json:"rsa_modulus_bits,omitempty"`
+	RSAExponent    int `json:"rsa_exponent,omitempty"`
+	// UnusualExponent is set when RSAExponent isn't 65537.
+	UnusualExponent bool `json:"unusual_exponent,omitempty"`
+	// NotYetValidFor is set when NotBefore is in the future, and holds
+	// how far ahead of the system clock the certificate's validity starts.
+	NotYetValidFor string `json:"not_yet_valid_for,omitempty"`
+	// ExpiredSince is set when NotAfter is in the past, and holds how
+	// long ago, according to the system clock, the certificate expired.
+	ExpiredSince string `json:"expired_since,omitempty"`
+	// DuplicateExtensions lists the OIDs of extensions that appear more
+	// than once in the certificate, which RFC 5280 forbids. Only the first
+	// occurrence of each is reflected in the other fields.
+	DuplicateExtensions []string `json:"duplicate_extensions,omitempty"`
+	// UnhandledCriticalExtensions lists the OIDs of critical extensions
+	// that aren't understood, which cause the certificate to be rejected
+	// during verification.
+	UnhandledCriticalExtensions []string `json:"unhandled_critical_extensions,omitempty"`
+	// KeyUsage and ExtKeyUsage are named as in signing profiles. Extended
+	// key usages without a name are listed by OID.
+	KeyUsage               []string          `json:"key_usage,omitempty"`
+	ExtKeyUsage            []string          `json:"ext_key_usage,omitempty"`
+	BasicConstraints       *BasicConstraints `json:"basic_constraints,omitempty"`
+	AltNames               *AltNames         `json:"alt_names,omitempty"`
+	PolicyOIDs             []string          `json:"policy_oids,omitempty"`
+	NameConstraints        *NameConstraints  `json:"name_constraints,omitempty"`
+	CRLDistributionPoints  []string          `json:"crl_distribution_points,omitempty"`
+	OCSPServers            []string          `json:"ocsp_servers,omitempty"`
+	IssuingCertificateURLs []string          `json:"issuing_certificate_urls,omitempty"`
+	SCTs                   []SCT             `json:"scts,omitempty"`
+	// Extensions lists every extension of the certificate, in order.
+	Extensions []Extension `json:"extensions,omitempty"`
 }
 
+// LargeCertificateSize is the DER size, in bytes, above which a
+// certificate is reported as large. Some embedded TLS stacks can't handle
+// certificates much bigger than this, which are usually bloated with SANs.
+const LargeCertificateSize = 4096
+
 // Name represents a JSON description of a PKIX Name
 type Name struct {
 	CommonName         string        `json:"common_name,omitempty"`
@@ -44,7 +95,9 @@ type Name struct {
 	//ExtraNames         []interface{} `json:"extra_names,omitempty"`
 }
 
-// ParseName parses a new name from a *pkix.Name
+// ParseName parses a new name from a *pkix.Name. Attribute values are
+// taken as decoded by crypto/x509, which converts BMPString (UTF-16),
+// TeletexString (as Latin-1) and UTF8String values to UTF-8 strings.
 func ParseName(name pkix.Name) Name {
 	n := Name{
 		CommonName:         name.CommonName,
@@ -97,12 +150,40 @@ func ParseCertificate(cert *x509.Certificate) *Certificate {
 		SKI:                formatKeyID(cert.SubjectKeyId),
 		SerialNumber:       cert.SerialNumber.String(),
 	}
+	c.setSize(cert.Raw)
+	if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+		c.RSAModulusBits = pub.N.BitLen()
+		c.RSAExponent = pub.E
+		c.UnusualExponent = pub.E != 65537
+	}
 	for _, ip := range cert.IPAddresses {
 		c.SANs = append(c.SANs, ip.String())
 	}
+	c.parseExtensions(cert)
+
+	for _, oid := range cert.UnhandledCriticalExtensions {
+		log.Warningf("certificate has an unhandled critical extension %v", oid)
+		c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, oid.String())
+	}
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) {
+		c.NotYetValidFor = cert.NotBefore.Sub(now).Truncate(time.Second).String()
+	}
+	if now.After(cert.NotAfter) {
+		c.ExpiredSince = now.Sub(cert.NotAfter).Truncate(time.Second).String()
+	}
 	return c
 }
 
+// setSize records the size of der, the DER encoding of the certificate,
+// and of c.RawPEM.
+func (c *Certificate) setSize(der []byte) {
+	c.DERBytes = len(der)
+	c.PEMLines = strings.Count(strings.TrimRight(c.RawPEM, "\n"), "\n") + 1
+	c.Large = c.DERBytes > LargeCertificateSize
+}
+
 // ParseCertificateFile parses x509 certificate file.
 func ParseCertificateFile(certFile string) (*Certificate, error) {
 	certPEM, err := ioutil.ReadFile(certFile)
@@ -113,14 +194,111 @@ func ParseCertificateFile(certFile string) (*Certificate, error) {
 	return ParseCertificatePEM(certPEM)
 }
 
-// ParseCertificatePEM parses an x509 certificate PEM.
+// ParseCertificatePEM parses an x509 certificate PEM. A certificate that
+// crypto/x509 rejects because an extension is repeated is still parsed,
+// ignoring all but the first occurrence of each extension, and the
+// repeated extensions are listed in DuplicateExtensions.
 func ParseCertificatePEM(certPEM []byte) (*Certificate, error) {
 	cert, err := helpers.ParseCertificatePEM(certPEM)
-	if err != nil {
+	if err == nil {
+		return ParseCertificate(cert), nil
+	}
+
+	block, _ := pem.Decode(bytes.TrimSpace(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
 		return nil, err
 	}
+	der, duplicates, dedupErr := removeDuplicateExtensions(block.Bytes)
+	if dedupErr != nil || len(duplicates) == 0 {
+		return nil, err
+	}
+	cert, parseErr := x509.ParseCertificate(der)
+	if parseErr != nil {
+		return nil, err
+	}
+
+	log.Warningf("certificate has duplicate extensions %s", strings.Join(duplicates, ", "))
+	c := ParseCertificate(cert)
+	c.RawPEM = string(pem.EncodeToMemory(block))
+	c.setSize(block.Bytes)
+	c.DuplicateExtensions = duplicates
+	return c, nil
+}
 
-	return ParseCertificate(cert), nil
+// removeDuplicateExtensions returns a copy of the DER encoded certificate
+// in which only the first occurrence of each extension is kept, along with
+// the OIDs of the extensions that were repeated. The signature of the
+// returned certificate no longer matches its contents.
+func removeDuplicateExtensions(der []byte) ([]byte, []string, error) {
+	var cert struct {
+		TBSCertificate     asn1.RawValue
+		SignatureAlgorithm asn1.RawValue
+		SignatureValue     asn1.RawValue
+	}
+	if rest, err := asn1.Unmarshal(der, &cert); err != nil {
+		return nil, nil, err
+	} else if len(rest) != 0 {
+		return nil, nil, errors.New("trailing data after certificate")
+	}
+
+	var fields []asn1.RawValue
+	for rest := cert.TBSCertificate.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	var duplicates []string
+	for i, field := range fields {
+		// Extensions are the [3] EXPLICIT field of the TBSCertificate.
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 3 {
+			continue
+		}
+		var extensions []asn1.RawValue
+		if _, err := asn1.Unmarshal(field.Bytes, &extensions); err != nil {
+			return nil, nil, err
+		}
+
+		seen := map[string]bool{}
+		var kept []asn1.RawValue
+		for _, ext := range extensions {
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Bytes, &oid); err != nil {
+				return nil, nil, err
+			}
+			if seen[oid.String()] {
+				duplicates = append(duplicates, oid.String())
+				continue
+			}
+			seen[oid.String()] = true
+			kept = append(kept, ext)
+		}
+
+		encoded, err := asn1.Marshal(kept)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields[i] = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: encoded}
+	}
+
+	var tbs []byte
+	for _, field := range fields {
+		encoded, err := asn1.Marshal(field)
+		if err != nil {
+			return nil, nil, err
+		}
+		tbs = append(tbs, encoded...)
+	}
+	cert.TBSCertificate = asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: tbs}
+
+	der, err := asn1.Marshal(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return der, duplicates, nil
 }
 
 // ParseCSRPEM uses the helper to parse an x509 CSR PEM.
@@ -6,15 +6,25 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"fmt"
+	"io/ioutil"
 	"math/big"
+	"net"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
 )
 
 const (
@@ -106,7 +116,77 @@ func TestParseSerialNumber(t *testing.T) {
 	}
 }
 
+func TestParseCertificateClockSkew(t *testing.T) {
+	cases := []struct {
+		description      string
+		notBefore        time.Time
+		notAfter         time.Time
+		wantNotYetValid  time.Duration
+		wantExpiredSince time.Duration
+	}{
+		{
+			description: "currently valid",
+			notBefore:   time.Now().Add(-time.Hour),
+			notAfter:    time.Now().Add(time.Hour),
+		},
+		{
+			description:     "future dated",
+			notBefore:       time.Now().Add(2 * time.Hour),
+			notAfter:        time.Now().Add(4 * time.Hour),
+			wantNotYetValid: 2 * time.Hour,
+		},
+		{
+			description:      "expired",
+			notBefore:        time.Now().Add(-4 * time.Hour),
+			notAfter:         time.Now().Add(-3 * time.Hour),
+			wantExpiredSince: 3 * time.Hour,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			certPEM, err := createCertificateWithValidity(tc.notBefore, tc.notAfter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cert, err := ParseCertificatePEM([]byte(certPEM))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkSkew(t, "NotYetValidFor", cert.NotYetValidFor, tc.wantNotYetValid)
+			checkSkew(t, "ExpiredSince", cert.ExpiredSince, tc.wantExpiredSince)
+		})
+	}
+}
+
+// checkSkew verifies that the duration string got is within a minute of
+// want, or empty if want is zero.
+func checkSkew(t *testing.T, field, got string, want time.Duration) {
+	if want == 0 {
+		if got != "" {
+			t.Errorf("expected %s to be empty but was '%s'", field, got)
+		}
+		return
+	}
+
+	d, err := time.ParseDuration(got)
+	if err != nil {
+		t.Errorf("could not parse %s '%s': %s", field, got, err)
+		return
+	}
+
+	if d > want+time.Minute || d < want-time.Minute {
+		t.Errorf("expected %s to be about %s but was %s", field, want, d)
+	}
+}
+
 func createCertificate() (string, error) {
+	return createCertificateWithValidity(time.Now(), time.Now().AddDate(1, 0, 0))
+}
+
+func createCertificateWithValidity(notBefore, notAfter time.Time) (string, error) {
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return "", err
@@ -118,8 +198,8 @@ func createCertificate() (string, error) {
 			Country:      []string{"SE"},
 			Organization: []string{"CFSSL Unit Testing"},
 		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0),
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		BasicConstraintsValid: true,
@@ -147,3 +227,289 @@ func certificateToPEMBlock(cert []byte) (string, error) {
 
 	return buf.String(), nil
 }
+
+func TestParseCertificateFileEncodedSubjects(t *testing.T) {
+	tests := []struct {
+		file string
+		want Name
+	}{
+		{
+			// CN and O are BMPStrings (UTF-16), OU a TeletexString.
+			file: "testdata/bmpstring_subject.pem",
+			want: Name{
+				CommonName:         "東京 Root CA",
+				Country:            "CH",
+				Organization:       "Zürich Zertifikate AG",
+				OrganizationalUnit: "München",
+			},
+		},
+		{
+			file: "testdata/utf8string_subject.pem",
+			want: Name{
+				CommonName:   "Ελληνικά Δοκιμή",
+				Country:      "GR",
+				Organization: "Société Générale",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		cert, err := ParseCertificateFile(test.file)
+		if err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		for _, name := range []Name{cert.Subject, cert.Issuer} {
+			if name.CommonName != test.want.CommonName || name.Country != test.want.Country ||
+				name.Organization != test.want.Organization ||
+				name.OrganizationalUnit != test.want.OrganizationalUnit {
+				t.Errorf("%s: expected %+v, got %+v", test.file, test.want, name)
+			}
+		}
+		for _, value := range cert.Subject.Names {
+			if s, ok := value.(string); !ok || !utf8.ValidString(s) {
+				t.Errorf("%s: name value %v is not a valid UTF-8 string", test.file, value)
+			}
+		}
+	}
+}
+
+func TestParseCertificateFileDuplicateExtensions(t *testing.T) {
+	cert, err := ParseCertificateFile("testdata/duplicate_extensions.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.DuplicateExtensions) != 1 || cert.DuplicateExtensions[0] != "2.5.29.17" {
+		t.Errorf("expected the subjectAltName extension to be flagged as duplicated, got %v", cert.DuplicateExtensions)
+	}
+	if len(cert.SANs) != 1 || cert.SANs[0] != "duplicate.example.com" {
+		t.Errorf("expected the SANs of the first subjectAltName extension, got %v", cert.SANs)
+	}
+	if len(cert.UnhandledCriticalExtensions) != 1 || cert.UnhandledCriticalExtensions[0] != "1.3.6.1.4.1.99999.7" {
+		t.Errorf("expected the unhandled critical extension to be reported, got %v", cert.UnhandledCriticalExtensions)
+	}
+
+	certPEM, err := ioutil.ReadFile("testdata/duplicate_extensions.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.RawPEM != string(certPEM) {
+		t.Error("expected the original certificate PEM to be kept")
+	}
+
+	ok, err := ParseCertificateFile("testdata/utf8string_subject.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok.DuplicateExtensions != nil || ok.UnhandledCriticalExtensions != nil {
+		t.Errorf("unexpected extension problems reported: %v %v", ok.DuplicateExtensions, ok.UnhandledCriticalExtensions)
+	}
+}
+
+func TestParseCertificateSize(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sans := range []int{1, 200} {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(testSerial),
+			Subject:      pkix.Name{CommonName: "size.example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		for i := 0; i < sans; i++ {
+			template.DNSNames = append(template.DNSNames, fmt.Sprintf("host-%03d.size.example.com", i))
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x509Cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert := ParseCertificate(x509Cert)
+		if cert.DERBytes != len(x509Cert.Raw) {
+			t.Errorf("%d SANs: DERBytes is %d, expected %d", sans, cert.DERBytes, len(x509Cert.Raw))
+		}
+		if lines := strings.Split(strings.TrimSpace(cert.RawPEM), "\n"); cert.PEMLines != len(lines) {
+			t.Errorf("%d SANs: PEMLines is %d, expected %d", sans, cert.PEMLines, len(lines))
+		}
+		if large := len(x509Cert.Raw) > LargeCertificateSize; cert.Large != large || large != (sans > 1) {
+			t.Errorf("%d SANs (%d bytes): Large is %v", sans, cert.DERBytes, cert.Large)
+		}
+	}
+
+	dup, err := ParseCertificateFile("testdata/duplicate_extensions.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(dup.RawPEM))
+	if dup.DERBytes != len(block.Bytes) {
+		t.Errorf("DERBytes is %d for the original certificate of %d bytes", dup.DERBytes, len(block.Bytes))
+	}
+}
+
+func TestParseCertificateRSAKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exponent := range []int{65537, 3} {
+		pub := &rsa.PublicKey{N: key.N, E: exponent}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(testSerial),
+			Subject:      pkix.Name{CommonName: "exponent.example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, pub, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x509Cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert := ParseCertificate(x509Cert)
+		if cert.RSAModulusBits != 2048 {
+			t.Errorf("exponent %d: RSAModulusBits is %d, expected 2048", exponent, cert.RSAModulusBits)
+		}
+		if cert.RSAExponent != exponent {
+			t.Errorf("RSAExponent is %d, expected %d", cert.RSAExponent, exponent)
+		}
+		if cert.UnusualExponent != (exponent != 65537) {
+			t.Errorf("exponent %d: UnusualExponent is %v", exponent, cert.UnusualExponent)
+		}
+	}
+}
+
+func TestParseCertificateExtensions(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scts, err := helpers.SerializeSCTList([]ct.SignedCertificateTimestamp{{
+		SCTVersion: ct.V1,
+		LogID:      ct.LogID{KeyID: [32]byte{1, 2, 3}},
+		Timestamp:  1577836800000,
+		Signature: ct.DigitallySigned{Algorithm: cttls.SignatureAndHashAlgorithm{
+			Hash:      cttls.SHA256,
+			Signature: cttls.ECDSA,
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sctExtension, err := asn1.Marshal(scts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	san, err := csr.MarshalGeneralNames([]string{"example.com"}, []string{"user@example.com"}, nil, nil,
+		[]csr.OtherName{{Type: "upn", Value: "user@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, permitted, _ := net.ParseCIDR("10.0.0.0/8")
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: "Extensions CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}},
+		PermittedDNSDomains:   []string{"example.com"},
+		PermittedIPRanges:     []*net.IPNet{permitted},
+		CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+		IssuingCertificateURL: []string{"http://ca.example.com/ca.crt"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: csr.SubjectAltNameOID, Value: san},
+			{Id: sctListOID, Value: sctExtension},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5}, Value: []byte{0xca, 0xfe}},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x509Cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := ParseCertificate(x509Cert)
+
+	if !reflect.DeepEqual(cert.KeyUsage, []string{"digital signature", "cert sign"}) {
+		t.Errorf("unexpected key usage %v", cert.KeyUsage)
+	}
+	if !reflect.DeepEqual(cert.ExtKeyUsage, []string{"server auth", "1.2.3.4"}) {
+		t.Errorf("unexpected extended key usage %v", cert.ExtKeyUsage)
+	}
+	if bc := cert.BasicConstraints; bc == nil || !bc.CA || bc.MaxPathLen == nil || *bc.MaxPathLen != 0 {
+		t.Errorf("unexpected basic constraints %+v", bc)
+	}
+	expectedNames := &AltNames{
+		DNSNames:       []string{"example.com"},
+		EmailAddresses: []string{"user@example.com"},
+		OtherNames:     []csr.OtherName{{Type: "upn", Value: "user@example.com"}},
+	}
+	if !reflect.DeepEqual(cert.AltNames, expectedNames) {
+		t.Errorf("unexpected alt names %+v", cert.AltNames)
+	}
+	if !reflect.DeepEqual(cert.PolicyOIDs, []string{"2.23.140.1.2.1"}) {
+		t.Errorf("unexpected policies %v", cert.PolicyOIDs)
+	}
+	expectedConstraints := &NameConstraints{
+		PermittedDNSDomains: []string{"example.com"},
+		PermittedIPRanges:   []string{"10.0.0.0/8"},
+	}
+	if !reflect.DeepEqual(cert.NameConstraints, expectedConstraints) {
+		t.Errorf("unexpected name constraints %+v", cert.NameConstraints)
+	}
+	if len(cert.CRLDistributionPoints) != 1 || len(cert.OCSPServers) != 1 || len(cert.IssuingCertificateURLs) != 1 {
+		t.Errorf("unexpected CRL distribution points %v or AIA %v, %v",
+			cert.CRLDistributionPoints, cert.OCSPServers, cert.IssuingCertificateURLs)
+	}
+	expectedSCTs := []SCT{{
+		Version:            "V1",
+		LogID:              "AQIDAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+		Timestamp:          time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		HashAlgorithm:      "SHA256",
+		SignatureAlgorithm: "ECDSA",
+	}}
+	if !reflect.DeepEqual(cert.SCTs, expectedSCTs) {
+		t.Errorf("unexpected SCTs %+v", cert.SCTs)
+	}
+
+	if len(cert.Extensions) != len(x509Cert.Extensions) {
+		t.Fatalf("expected %d extensions, got %d", len(x509Cert.Extensions), len(cert.Extensions))
+	}
+	for _, ext := range cert.Extensions {
+		switch ext.OID {
+		case "1.2.3.4.5":
+			if ext.Name != "" || ext.Value != "CA:FE" {
+				t.Errorf("unexpected unknown extension %+v", ext)
+			}
+		case "2.5.29.19":
+			if ext.Name != "basic constraints" || !ext.Critical || ext.Value != "" {
+				t.Errorf("unexpected basic constraints extension %+v", ext)
+			}
+		default:
+			if ext.Value != "" {
+				t.Errorf("extension %s was hex-dumped", ext.OID)
+			}
+		}
+	}
+}
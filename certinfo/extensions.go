@@ -0,0 +1,257 @@
+package certinfo
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// An Extension describes an extension of a certificate. The value of
+// extensions that aren't decoded into other fields of the Certificate is
+// hex-dumped.
+type Extension struct {
+	OID      string `json:"oid"`
+	Name     string `json:"name,omitempty"`
+	Critical bool   `json:"critical"`
+	Value    string `json:"value,omitempty"`
+}
+
+// AltNames describes the subject alternative names of a certificate.
+type AltNames struct {
+	DNSNames       []string        `json:"dns_names,omitempty"`
+	EmailAddresses []string        `json:"email_addresses,omitempty"`
+	IPAddresses    []string        `json:"ip_addresses,omitempty"`
+	URIs           []string        `json:"uris,omitempty"`
+	OtherNames     []csr.OtherName `json:"other_names,omitempty"`
+}
+
+// BasicConstraints describes the basic constraints of a certificate.
+// MaxPathLen is only set for CA certificates limiting their path length.
+type BasicConstraints struct {
+	CA         bool `json:"ca"`
+	MaxPathLen *int `json:"max_path_len,omitempty"`
+}
+
+// NameConstraints describes the name constraints of a CA certificate.
+type NameConstraints struct {
+	Critical                bool     `json:"critical"`
+	PermittedDNSDomains     []string `json:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges,omitempty"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges,omitempty"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses,omitempty"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses,omitempty"`
+	PermittedURIDomains     []string `json:"permitted_uri_domains,omitempty"`
+	ExcludedURIDomains      []string `json:"excluded_uri_domains,omitempty"`
+}
+
+// An SCT describes a signed certificate timestamp embedded in a
+// certificate. LogID is base64-encoded.
+type SCT struct {
+	Version            string    `json:"version"`
+	LogID              string    `json:"log_id"`
+	Timestamp          time.Time `json:"timestamp"`
+	HashAlgorithm      string    `json:"hash_algorithm"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+}
+
+// sctListOID is the OID of the embedded SCT list extension defined in
+// RFC 6962 section 3.3.
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// nameConstraintsOID is the OID of the name constraints extension.
+var nameConstraintsOID = asn1.ObjectIdentifier{2, 5, 29, 30}
+
+// extensionNames names the extensions commonly found in certificates.
+var extensionNames = map[string]string{
+	"2.5.29.14":               "subject key identifier",
+	"2.5.29.15":               "key usage",
+	"2.5.29.17":               "subject alternative name",
+	"2.5.29.18":               "issuer alternative name",
+	"2.5.29.19":               "basic constraints",
+	"2.5.29.30":               "name constraints",
+	"2.5.29.31":               "CRL distribution points",
+	"2.5.29.32":               "certificate policies",
+	"2.5.29.35":               "authority key identifier",
+	"2.5.29.37":               "extended key usage",
+	"1.3.6.1.5.5.7.1.1":       "authority information access",
+	"1.3.6.1.5.5.7.1.24":      "TLS feature",
+	"1.3.6.1.5.5.7.48.1.5":    "OCSP no check",
+	"1.3.6.1.4.1.11129.2.4.2": "signed certificate timestamps",
+	"1.3.6.1.4.1.11129.2.4.3": "precertificate poison",
+}
+
+// decodedExtensions lists the extensions reflected in other fields of a
+// Certificate, whose value isn't hex-dumped. So are the SCTs, unless
+// they can't be parsed.
+var decodedExtensions = map[string]bool{
+	"2.5.29.14":         true,
+	"2.5.29.15":         true,
+	"2.5.29.17":         true,
+	"2.5.29.19":         true,
+	"2.5.29.30":         true,
+	"2.5.29.31":         true,
+	"2.5.29.32":         true,
+	"2.5.29.35":         true,
+	"2.5.29.37":         true,
+	"1.3.6.1.5.5.7.1.1": true,
+}
+
+// keyUsages names the key usages, in the order of their bits, as in
+// signing profiles.
+var keyUsages = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digital signature"},
+	{x509.KeyUsageContentCommitment, "content commitment"},
+	{x509.KeyUsageKeyEncipherment, "key encipherment"},
+	{x509.KeyUsageDataEncipherment, "data encipherment"},
+	{x509.KeyUsageKeyAgreement, "key agreement"},
+	{x509.KeyUsageCertSign, "cert sign"},
+	{x509.KeyUsageCRLSign, "crl sign"},
+	{x509.KeyUsageEncipherOnly, "encipher only"},
+	{x509.KeyUsageDecipherOnly, "decipher only"},
+}
+
+// extKeyUsages names the extended key usages as in signing profiles.
+var extKeyUsages = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "server auth",
+	x509.ExtKeyUsageClientAuth:                     "client auth",
+	x509.ExtKeyUsageCodeSigning:                    "code signing",
+	x509.ExtKeyUsageEmailProtection:                "email protection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsec end system",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsec tunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsec user",
+	x509.ExtKeyUsageTimeStamping:                   "timestamping",
+	x509.ExtKeyUsageOCSPSigning:                    "ocsp signing",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "microsoft sgc",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "netscape sgc",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "microsoft commercial code signing",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "microsoft kernel code signing",
+}
+
+// parseExtensions fills in the fields of c describing the extensions of
+// cert.
+func (c *Certificate) parseExtensions(cert *x509.Certificate) {
+	for _, ku := range keyUsages {
+		if cert.KeyUsage&ku.usage != 0 {
+			c.KeyUsage = append(c.KeyUsage, ku.name)
+		}
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		c.ExtKeyUsage = append(c.ExtKeyUsage, extKeyUsages[eku])
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		c.ExtKeyUsage = append(c.ExtKeyUsage, oid.String())
+	}
+
+	if cert.BasicConstraintsValid {
+		c.BasicConstraints = &BasicConstraints{CA: cert.IsCA}
+		if cert.IsCA && (cert.MaxPathLen > 0 || cert.MaxPathLenZero) {
+			maxPathLen := cert.MaxPathLen
+			c.BasicConstraints.MaxPathLen = &maxPathLen
+		}
+	}
+
+	names := AltNames{
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for _, ip := range cert.IPAddresses {
+		names.IPAddresses = append(names.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names.URIs = append(names.URIs, uri.String())
+	}
+	otherNames, err := csr.OtherNames(cert.Extensions)
+	if err != nil {
+		log.Warningf("failed to parse the otherName SANs of the certificate: %v", err)
+	}
+	names.OtherNames = otherNames
+	if names.DNSNames != nil || names.EmailAddresses != nil || names.IPAddresses != nil ||
+		names.URIs != nil || names.OtherNames != nil {
+		c.AltNames = &names
+	}
+
+	for _, oid := range cert.PolicyIdentifiers {
+		c.PolicyOIDs = append(c.PolicyOIDs, oid.String())
+	}
+
+	c.NameConstraints = parseNameConstraints(cert)
+	c.CRLDistributionPoints = cert.CRLDistributionPoints
+	c.OCSPServers = cert.OCSPServer
+	c.IssuingCertificateURLs = cert.IssuingCertificateURL
+
+	for _, ext := range cert.Extensions {
+		oid := ext.Id.String()
+		e := Extension{OID: oid, Name: extensionNames[oid], Critical: ext.Critical}
+		if ext.Id.Equal(sctListOID) {
+			if c.SCTs, err = parseSCTs(ext.Value); err != nil {
+				log.Warningf("failed to parse the SCTs of the certificate: %v", err)
+				e.Value = formatKeyID(ext.Value)
+			}
+		} else if !decodedExtensions[oid] {
+			e.Value = formatKeyID(ext.Value)
+		}
+		c.Extensions = append(c.Extensions, e)
+	}
+}
+
+// parseNameConstraints returns the name constraints of cert, or nil if
+// it has none.
+func parseNameConstraints(cert *x509.Certificate) *NameConstraints {
+	nc := &NameConstraints{
+		Critical:                cert.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:     cert.PermittedDNSDomains,
+		ExcludedDNSDomains:      cert.ExcludedDNSDomains,
+		PermittedEmailAddresses: cert.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  cert.ExcludedEmailAddresses,
+		PermittedURIDomains:     cert.PermittedURIDomains,
+		ExcludedURIDomains:      cert.ExcludedURIDomains,
+	}
+	for _, ipNet := range cert.PermittedIPRanges {
+		nc.PermittedIPRanges = append(nc.PermittedIPRanges, ipNet.String())
+	}
+	for _, ipNet := range cert.ExcludedIPRanges {
+		nc.ExcludedIPRanges = append(nc.ExcludedIPRanges, ipNet.String())
+	}
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(nameConstraintsOID) {
+			return nc
+		}
+	}
+	return nil
+}
+
+// parseSCTs decodes the value of an embedded SCT list extension, an
+// OCTET STRING holding the TLS encoding of the list.
+func parseSCTs(value []byte) ([]SCT, error) {
+	var serialized []byte
+	if _, err := asn1.Unmarshal(value, &serialized); err != nil {
+		return nil, err
+	}
+	list, err := helpers.DeserializeSCTList(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	var scts []SCT
+	for _, sct := range list {
+		scts = append(scts, SCT{
+			Version:            sct.SCTVersion.String(),
+			LogID:              base64.StdEncoding.EncodeToString(sct.LogID.KeyID[:]),
+			Timestamp:          time.Unix(0, int64(sct.Timestamp)*int64(time.Millisecond)).UTC(),
+			HashAlgorithm:      sct.Signature.Algorithm.Hash.String(),
+			SignatureAlgorithm: sct.Signature.Algorithm.Signature.String(),
+		})
+	}
+	return scts, nil
+}
@@ -2,11 +2,14 @@
 package bundle
 
 import (
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/cloudflare/cfssl/bundler"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/crypto/pkcs7"
 	"github.com/cloudflare/cfssl/ubiquity"
 )
 
@@ -15,18 +18,37 @@ var bundlerUsageText = `cfssl bundle -- create a certificate bundle that contain
 
 Usage of bundle:
 	- Bundle local certificate files
-        cfssl bundle -cert file [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-metadata file] [-key keyfile] [-flavor optimal|ubiquitous|force] [-password password]
+        cfssl bundle -cert file [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-aia-cache dir] [-offline] [-metadata file] [-key keyfile] [-flavor optimal|ubiquitous|force] [-password password] [-format json|p7b|p7b-der]
 	- Bundle certificate from remote server.
-        cfssl bundle -domain domain_name [-ip ip_address] [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-metadata file]
+        cfssl bundle -domain domain_name [-ip ip_address] [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-aia-cache dir] [-metadata file] [-format json|p7b|p7b-der]
+
+The -int-bundle flag also accepts a directory, in which case the
+intermediates are read from all of the *.pem files it contains.
+
+Intermediates missing from the bundles are fetched from the AIA issuer
+URLs of the certificates. With -aia-cache, fetched certificates are saved
+in the given directory and reused on later runs. With -offline, nothing is
+fetched over the network: only the certificates in the AIA cache are used.
+
+With -format p7b, the bundle is written as a PEM-encoded PKCS #7
+structure holding the certificate and its chain, without the root, which
+Windows and many appliances import as a .p7b file. -format p7b-der writes
+the same structure DER-encoded.
 
 Flags:
 `
 
 // flags used by 'cfssl bundle'
-var bundlerFlags = []string{"cert", "key", "ca-bundle", "int-bundle", "flavor", "int-dir", "metadata", "domain", "ip", "password"}
+var bundlerFlags = []string{"cert", "key", "ca-bundle", "int-bundle", "flavor", "int-dir", "aia-cache", "offline", "metadata", "domain", "ip", "password", "format"}
 
 // bundlerMain is the main CLI of bundler functionality.
 func bundlerMain(args []string, c cli.Config) (err error) {
+	switch c.Format {
+	case "", "json", "p7b", "p7b-der":
+	default:
+		return fmt.Errorf("unknown bundle format %q", c.Format)
+	}
+
 	bundler.IntermediateStash = c.IntDir
 	ubiquity.LoadPlatforms(c.Metadata)
 	flavor := bundler.BundleFlavor(c.Flavor)
@@ -36,7 +58,8 @@ func bundlerMain(args []string, c cli.Config) (err error) {
 	if flavor == bundler.Force {
 		b = &bundler.Bundler{}
 	} else {
-		b, err = bundler.NewBundler(c.CABundleFile, c.IntBundleFile)
+		b, err = bundler.NewBundler(c.CABundleFile, c.IntBundleFile,
+			bundler.WithAIACache(c.AIACache), bundler.WithOffline(c.Offline))
 		if err != nil {
 			return
 		}
@@ -76,6 +99,19 @@ func bundlerMain(args []string, c cli.Config) (err error) {
 		return errors.New("Must specify bundle target through -cert or -domain")
 	}
 
+	if c.Format == "p7b" || c.Format == "p7b-der" {
+		var der []byte
+		der, err = pkcs7.MarshalCertificates(bundle.Chain)
+		if err != nil {
+			return
+		}
+		if c.Format == "p7b" {
+			return pem.Encode(os.Stdout, &pem.Block{Type: "PKCS7", Bytes: der})
+		}
+		_, err = os.Stdout.Write(der)
+		return
+	}
+
 	marshaled, err := bundle.MarshalJSON()
 	if err != nil {
 		return
@@ -2,15 +2,21 @@
 package certinfo
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certinfo"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -26,12 +32,47 @@ Usage of certinfo:
         cfssl certinfo -domain domain_name
 	- Data from CA storage
         cfssl certinfo -sn serial (requires -db-config and -aki)
+	- A single field of a certificate, e.g. its expiry date
+        cfssl certinfo -cert file -field notAfter
 
 Flags:
 `
 
 // flags used by 'cfssl certinfo'
-var certinfoFlags = []string{"aki", "cert", "csr", "db-config", "domain", "serial"}
+var certinfoFlags = []string{"aki", "cert", "csr", "db-config", "domain", "field", "serial"}
+
+// certFields maps the names accepted by -field to functions extracting the
+// value of that field from a certificate.
+var certFields = map[string]func(*x509.Certificate) string{
+	"notBefore": func(cert *x509.Certificate) string { return cert.NotBefore.UTC().Format(time.RFC3339) },
+	"notAfter":  func(cert *x509.Certificate) string { return cert.NotAfter.UTC().Format(time.RFC3339) },
+	"subject":   func(cert *x509.Certificate) string { return cert.Subject.String() },
+	"serial":    func(cert *x509.Certificate) string { return cert.SerialNumber.String() },
+	"fingerprint": func(cert *x509.Certificate) string {
+		digest := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(digest[:])
+	},
+}
+
+// certField returns the value of the named field of cert, or an error
+// listing the supported field names if name isn't one of them.
+func certField(cert *certinfo.Certificate, name string) (string, error) {
+	extract, ok := certFields[name]
+	if !ok {
+		var names []string
+		for field := range certFields {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown field %q, supported fields are: %s", name, strings.Join(names, ", "))
+	}
+
+	parsed, err := helpers.ParseCertificatePEM([]byte(cert.RawPEM))
+	if err != nil {
+		return "", err
+	}
+	return extract(parsed), nil
+}
 
 // certinfoMain is the main CLI of certinfo functionality
 func certinfoMain(args []string, c cli.Config) (err error) {
@@ -92,6 +133,18 @@ func certinfoMain(args []string, c cli.Config) (err error) {
 		return errors.New("Must specify certinfo target through -cert, -csr, -domain or -serial + -aki")
 	}
 
+	if c.Field != "" {
+		if cert == nil {
+			return errors.New("-field can only be used with a certificate")
+		}
+		var value string
+		if value, err = certField(cert, c.Field); err != nil {
+			return
+		}
+		fmt.Println(value)
+		return
+	}
+
 	var b []byte
 	if cert != nil {
 		b, err = json.MarshalIndent(cert, "", "  ")
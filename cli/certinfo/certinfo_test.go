@@ -0,0 +1,42 @@
+package certinfo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cfssl/certinfo"
+)
+
+const testCertFile = "../../certinfo/testdata/utf8string_subject.pem"
+
+func TestCertField(t *testing.T) {
+	cert, err := certinfo.ParseCertificateFile(testCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"notBefore":   "2020-01-01T00:00:00Z",
+		"notAfter":    "2050-01-01T00:00:00Z",
+		"subject":     "CN=Ελληνικά Δοκιμή,O=Société Générale,C=GR",
+		"serial":      "1",
+		"fingerprint": "da41e8a190a041cf88f14fb4fd921d05eb64a02189585c9289b335d8dc8beedf",
+	}
+	for name, want := range expected {
+		got, err := certField(cert, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	_, err = certField(cert, "colour")
+	if err == nil {
+		t.Fatal("expected an unknown field to be rejected")
+	}
+	if !strings.Contains(err.Error(), "fingerprint, notAfter, notBefore, serial, subject") {
+		t.Errorf("expected the supported fields to be listed, got %v", err)
+	}
+}
@@ -22,6 +22,17 @@ The commands are defined in the cli subpackages and include
 	ocspsign signs an OCSP response
 
 Use "cfssl [command] -help" to find out more about a command.
+
+The exit status tells the class of failure apart (see errors.Class):
+
+	0	success
+	1	unclassified failure
+	2	invalid flags
+	3	malformed or unreadable input
+	4	rejected by the signing policy
+	5	remote server unreachable or failing
+	6	HSM or key management service failure
+	7	certificate database failure
 */
 
 import (
@@ -33,7 +44,10 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/cloudflare/cfssl/cli/output"
 	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
 )
 
 // Command holds the implementation details of a cfssl command.
@@ -102,7 +116,7 @@ func Start(cmds map[string]*Command) error {
 	if flag.NArg() < 1 {
 		fmt.Fprintf(os.Stderr, "No command is given.\n")
 		flag.Usage()
-		return errors.New("no command was given")
+		return cferr.WithClass(cferr.ClassInput, errors.New("no command was given"))
 	}
 
 	// Clip out the command name and args for the command
@@ -112,10 +126,10 @@ func Start(cmds map[string]*Command) error {
 	if !found {
 		fmt.Fprintf(os.Stderr, "Command %s is not defined.\n", cmdName)
 		flag.Usage()
-		return errors.New("undefined command")
+		return cferr.WithClass(cferr.ClassInput, errors.New("undefined command"))
 	}
-	// always have flag 'loglevel' for each command
-	cmd.Flags = append(cmd.Flags, "loglevel")
+	// always have flags 'loglevel' and 'logformat' for each command
+	cmd.Flags = append(cmd.Flags, "loglevel", "logformat")
 	// The usage of each individual command is re-written to mention
 	// flags defined and referenced only in that command.
 	cfsslFlagSet.Usage = func() {
@@ -131,12 +145,17 @@ func Start(cmds map[string]*Command) error {
 	cfsslFlagSet.Parse(args)
 	args = cfsslFlagSet.Args()
 
+	if err := log.SetFormat(c.LogFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
 	var err error
 	if c.ConfigFile != "" {
 		c.CFG, err = config.LoadFile(c.ConfigFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load config file: %v", err)
-			return errors.New("failed to load config file")
+			return cferr.WithClass(cferr.ClassInput, errors.New("failed to load config file"))
 		}
 	}
 
@@ -178,6 +197,29 @@ func PrintCert(key, csrBytes, cert []byte) {
 	fmt.Printf("%s\n", jsonOut)
 }
 
+// OutputCert writes a cert, key and csr to files named after prefix like
+// cfssljson -bare does: prefix.pem, prefix-key.pem and prefix.csr. They
+// are written as a set with output.WriteFiles. With an empty prefix, they
+// are printed with PrintCert instead.
+func OutputCert(prefix string, key, csrBytes, cert []byte) error {
+	if prefix == "" {
+		PrintCert(key, csrBytes, cert)
+		return nil
+	}
+
+	var files []output.File
+	for _, out := range []output.File{
+		{Filename: prefix + ".pem", Contents: cert, Perms: 0664},
+		{Filename: prefix + "-key.pem", Contents: key, Perms: 0600},
+		{Filename: prefix + ".csr", Contents: csrBytes, Perms: 0644},
+	} {
+		if out.Contents != nil {
+			files = append(files, out)
+		}
+	}
+	return output.WriteFiles(files, false, false)
+}
+
 // PrintOCSPResponse outputs an OCSP response to stdout
 // ocspResponse is base64 encoded
 func PrintOCSPResponse(resp []byte) {
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"flag"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -121,3 +123,40 @@ func TestPopFirstArg(t *testing.T) {
 		t.Fatal("No argument given, should return error")
 	}
 }
+
+func TestOutputCertRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prefix := filepath.Join(dir, "cert")
+
+	if err = OutputCert(prefix, []byte("KEY"), nil, []byte("CERT")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key file can't replace a directory that isn't empty: the
+	// certificate replaced before it is restored, and no temporary file
+	// is left.
+	if err = os.Remove(prefix + "-key.pem"); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(prefix+"-key.pem", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = OutputCert(prefix, []byte("KEY2"), nil, []byte("CERT2")); err == nil {
+		t.Fatal("expected the key file not to replace a directory")
+	}
+	cert, err := ioutil.ReadFile(prefix + ".pem")
+	if err != nil || string(cert) != "CERT" {
+		t.Fatalf("expected the certificate to be restored, got %q, %v", cert, err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected only the certificate and the directory to be left, got %d entries", len(entries))
+	}
+}
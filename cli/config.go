@@ -2,6 +2,7 @@ package cli
 
 import (
 	"flag"
+	"strconv"
 	"time"
 
 	"github.com/cloudflare/cfssl/config"
@@ -36,28 +37,48 @@ type Config struct {
 	CFG               *config.Config
 	Profile           string
 	IsCA              bool
+	MinRSABits        int
 	RenewCA           bool
+	Renew             bool
+	CrossSign         bool
 	IntDir            string
+	AIACache          string
+	Offline           bool
 	Flavor            string
 	Metadata          string
 	Domain            string
+	Host              string
+	MinValidity       time.Duration
+	PollInterval      time.Duration
+	Field             string
 	IP                string
 	Remote            string
 	Label             string
 	AuthKey           string
 	ResponderFile     string
 	ResponderKeyFile  string
+	ResponderLifetime time.Duration
+	TSACertFile       string
+	TSAKeyFile        string
+	TSAPolicy         string
 	Status            string
 	Reason            string
 	RevokedAt         string
+	InvalidityDate    string
 	Interval          time.Duration
+	Listen            bool
+	DisableNonce      bool
+	MaxNonceLength    int
 	List              bool
 	Family            string
 	Timeout           time.Duration
 	Scanner           string
 	CSVFile           string
+	TargetsFile       string
 	NumWorkers        int
+	RateLimit         float64
 	MaxHosts          int
+	MinSCTs           int
 	Responses         string
 	Path              string
 	CRL               string
@@ -68,8 +89,40 @@ type Config struct {
 	CNOverride        string
 	AKI               string
 	DBConfigFile      string
+	AuditLogFile      string
 	CRLExpiration     time.Duration
+	CRLRefresh        time.Duration
+	CRLSignerFile     string
+	CRLSignerKeyFile  string
+	AllowMixedIssuers bool
+	CRLNumber         string
+	Delta             bool
+	OldCertFile       string
+	NewKeyFile        string
+	ParentFile        string
+	ParentKeyFile     string
 	Disable     	  string
+	Metrics           bool
+	ReusePort         bool
+	ShutdownTimeout   time.Duration
+	ACME              bool
+	ACMEProfile       string
+	IdentityFile      string
+	Before            time.Duration
+	Daemon            bool
+	Rekey             bool
+	ReloadPID         int
+	Hook              string
+	BatchFile         string
+	Format            string
+	OutputPrefix      string
+	LogFormat         string
+	PasswordFile      string
+	NoPassword        bool
+	PublishedLog      string
+	Module            string
+	Token             string
+	PIN               string
 }
 
 // registerFlags defines all cfssl command flags and associates their values with variables.
@@ -78,7 +131,7 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.CertFile, "cert", "", "Client certificate that contains the public key")
 	f.StringVar(&c.CSRFile, "csr", "", "Certificate signature request file for new public key")
 	f.StringVar(&c.CAFile, "ca", "", "CA used to sign the new certificate -- accepts '[file:]fname' or 'env:varname'")
-	f.StringVar(&c.CAKeyFile, "ca-key", "", "CA private key -- accepts '[file:]fname' or 'env:varname'")
+	f.StringVar(&c.CAKeyFile, "ca-key", "", "CA private key -- accepts '[file:]fname', 'env:varname' or, for signing, a 'awskms:///key-id' or 'gcpkms:///key-name' key URI")
 	f.StringVar(&c.TLSCertFile, "tls-cert", "", "Other endpoint CA to set up TLS protocol")
 	f.StringVar(&c.TLSKeyFile, "tls-key", "", "Other endpoint CA private key")
 	f.StringVar(&c.MutualTLSCAFile, "mutual-tls-ca", "", "Mutual TLS - require clients be signed by this CA ")
@@ -89,35 +142,56 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.KeyFile, "key", "", "private key for the certificate")
 	f.StringVar(&c.IntermediatesFile, "intermediates", "", "intermediate certs")
 	f.StringVar(&c.CABundleFile, "ca-bundle", "", "path to root certificate store")
-	f.StringVar(&c.IntBundleFile, "int-bundle", "", "path to intermediate certificate store")
+	f.StringVar(&c.IntBundleFile, "int-bundle", "", "path to intermediate certificate store, or to a directory of PEM files holding intermediates")
 	f.StringVar(&c.Address, "address", "127.0.0.1", "Address to bind")
 	f.IntVar(&c.Port, "port", 8888, "Port to bind")
 	f.StringVar(&c.MinTLSVersion, "min-tls-version", "", "Minimum version of TLS to use, defaults to 1.0")
 	f.StringVar(&c.ConfigFile, "config", "", "path to configuration file")
 	f.StringVar(&c.Profile, "profile", "", "signing profile to use")
 	f.BoolVar(&c.IsCA, "initca", false, "initialise new CA")
+	f.IntVar(&c.MinRSABits, "min-rsa-bits", 2048, "minimum size of generated RSA keys, in bits")
 	f.BoolVar(&c.RenewCA, "renewca", false, "re-generate a CA certificate from existing CA certificate/key")
+	f.BoolVar(&c.Renew, "renew", false, "re-sign the certificate given with -cert for its key given with -key")
+	f.BoolVar(&c.CrossSign, "cross-sign", false, "cross-sign the CA certificate given as argument, keeping its subject and key")
 	f.StringVar(&c.IntDir, "int-dir", "", "specify intermediates directory")
+	f.StringVar(&c.AIACache, "aia-cache", "", "directory caching the certificates fetched from AIA issuer URLs")
+	f.BoolVar(&c.Offline, "offline", false, "don't fetch certificates over the network, only from the AIA cache")
 	f.StringVar(&c.Flavor, "flavor", "ubiquitous", "Bundle Flavor: ubiquitous, optimal and force.")
+	f.StringVar(&c.Format, "format", "json", "Output format: json, p7b (PEM-encoded PKCS #7) or p7b-der for bundle; json, json-report, sarif or junit for scan")
 	f.StringVar(&c.Metadata, "metadata", "", "Metadata file for root certificate presence. The content of the file is a json dictionary (k,v): each key k is SHA-1 digest of a root certificate while value v is a list of key store filenames.")
 	f.StringVar(&c.Domain, "domain", "", "remote server domain name")
+	f.StringVar(&c.Host, "host", "", "remote server to watch, as host[:port]")
+	f.DurationVar(&c.MinValidity, "min-validity", 30*helpers.OneDay, "remaining validity below which a watched certificate is reported as expiring (default: 720h)")
+	f.DurationVar(&c.PollInterval, "poll-interval", time.Minute, "interval between polls of a watched certificate")
+	f.StringVar(&c.Field, "field", "", "print only the value of the named certificate field (notBefore, notAfter, subject, serial or fingerprint)")
 	f.StringVar(&c.IP, "ip", "", "remote server ip")
 	f.StringVar(&c.Remote, "remote", "", "remote CFSSL server")
-	f.StringVar(&c.Label, "label", "", "key label to use in remote CFSSL server")
+	f.StringVar(&c.Label, "label", "", "key label to use in remote CFSSL server, or label of the key generated by genkey-pkcs11")
 	f.StringVar(&c.AuthKey, "authkey", "", "key to authenticate requests to remote CFSSL server")
 	f.StringVar(&c.ResponderFile, "responder", "", "Certificate for OCSP responder")
 	f.StringVar(&c.ResponderKeyFile, "responder-key", "", "private key for OCSP responder certificate")
+	f.DurationVar(&c.ResponderLifetime, "responder-lifetime", 0, "without -responder, issue OCSP responder certificates valid for this long from the CA key and rotate them")
+	f.StringVar(&c.TSACertFile, "tsa-cert", "", "Certificate for the RFC 3161 time-stamp authority")
+	f.StringVar(&c.TSAKeyFile, "tsa-key", "", "private key for the time-stamp authority certificate")
+	f.StringVar(&c.TSAPolicy, "tsa-policy", "", "OID of the policy under which time-stamp tokens are issued")
 	f.StringVar(&c.Status, "status", "good", "Status of the certificate: good, revoked, unknown")
 	f.StringVar(&c.Reason, "reason", "0", "Reason code for revocation")
 	f.StringVar(&c.RevokedAt, "revoked-at", "now", "Date of revocation (YYYY-MM-DD)")
+	f.StringVar(&c.InvalidityDate, "invalidity-date", "", "Date the key was compromised, if earlier than the revocation (YYYY-MM-DD or RFC 3339)")
 	f.DurationVar(&c.Interval, "interval", 4*helpers.OneDay, "Interval between OCSP updates (default: 96h)")
+	f.BoolVar(&c.Listen, "listen", false, "keep refreshing OCSP responses as PostgreSQL notifies that certificates are signed or revoked")
+	f.BoolVar(&c.DisableNonce, "disable-nonce", false, "don't echo the nonces of OCSP requests in the responses")
+	f.IntVar(&c.MaxNonceLength, "max-nonce-length", 32, "longest OCSP request nonce, in octets, that is echoed; requests with longer ones are rejected")
 	f.BoolVar(&c.List, "list", false, "list possible scanners")
 	f.StringVar(&c.Family, "family", "", "scanner family regular expression")
 	f.StringVar(&c.Scanner, "scanner", "", "scanner regular expression")
 	f.DurationVar(&c.Timeout, "timeout", 5*time.Minute, "duration (ns, us, ms, s, m, h) to scan each host before timing out")
 	f.StringVar(&c.CSVFile, "csv", "", "file containing CSV of hosts")
+	f.StringVar(&c.TargetsFile, "targets", "", "file listing the hosts or CIDR ranges to scan, one per line")
 	f.IntVar(&c.NumWorkers, "num-workers", 10, "number of workers to use for scan")
+	f.Float64Var(&c.RateLimit, "rate-limit", 0, "maximum number of hosts to start scanning per second, 0 for no limit")
 	f.IntVar(&c.MaxHosts, "max-hosts", 100, "maximum number of hosts to scan")
+	f.IntVar(&c.MinSCTs, "min-scts", 2, "minimum number of SCTs from distinct logs required by the CTInclusion scan")
 	f.StringVar(&c.Responses, "responses", "", "file to load OCSP responses from")
 	f.StringVar(&c.Path, "path", "/", "Path on which the server will listen")
 	f.StringVar(&c.CRL, "crl", "", "CRL URL Override")
@@ -129,9 +203,57 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.CNOverride, "cn", "", "certificate common name (CN)")
 	f.StringVar(&c.AKI, "aki", "", "certificate issuer (authority) key identifier")
 	f.StringVar(&c.DBConfigFile, "db-config", "", "certificate db configuration file")
+	f.StringVar(&c.AuditLogFile, "audit-log", "", "file to append a JSON line to for every issued certificate and every sign request refused by the signing policy")
 	f.DurationVar(&c.CRLExpiration, "expiry", 7*helpers.OneDay, "time from now after which the CRL will expire (default: one week)")
-	f.IntVar(&log.Level, "loglevel", log.LevelInfo, "Log level (0 = DEBUG, 5 = FATAL)")
+	f.DurationVar(&c.CRLRefresh, "crl-refresh", 0, "interval after which the served CRL is regenerated (default: half of -expiry)")
+	f.StringVar(&c.CRLSignerFile, "crl-signer", "", "delegated CRL signing certificate, issued by the CA with the cRLSign key usage")
+	f.StringVar(&c.CRLSignerKeyFile, "crl-signer-key", "", "private key for the delegated CRL signing certificate")
+	f.BoolVar(&c.AllowMixedIssuers, "allow-mixed-issuers", false, "concatenate CRLs from different issuers instead of failing")
+	f.StringVar(&c.CRLNumber, "crl-number", "", "how CRLs are numbered: none, timestamp or sequential (default: none)")
+	f.BoolVar(&c.Delta, "delta", false, "generate a delta CRL of the last full CRL with a sequential number")
+	f.StringVar(&c.OldCertFile, "old-cert", "", "existing CA certificate to re-key")
+	f.StringVar(&c.NewKeyFile, "new-key", "", "new private key for the re-keyed CA certificate")
+	f.StringVar(&c.ParentFile, "parent", "", "parent CA certificate that issued the CA certificate being re-keyed")
+	f.StringVar(&c.ParentKeyFile, "parent-key", "", "private key of the parent CA certificate")
+	f.Var(logLevel{}, "loglevel", "Log level, by number or name (0 = DEBUG, 5 = FATAL)")
+	f.StringVar(&c.LogFormat, "logformat", log.FormatText, "Log format: text, or json for one JSON object per line")
 	f.StringVar(&c.Disable, "disable", "", "endpoints to disable")
+	f.BoolVar(&c.Metrics, "metrics", false, "expose Prometheus metrics on /metrics")
+	f.BoolVar(&c.ReusePort, "reuseport", false, "listen with SO_REUSEPORT, so that another server may listen on the same address")
+	f.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "how long to wait for requests in flight to complete when shutting down")
+	f.BoolVar(&c.ACME, "acme", false, "serve an ACME server issuing through the signer on /acme/")
+	f.StringVar(&c.ACMEProfile, "acme-profile", "", "signing profile of the certificates issued through ACME")
+	f.StringVar(&c.IdentityFile, "identity", "", "transport identity file describing the key, certificate and remote CA")
+	f.DurationVar(&c.Before, "before", helpers.OneDay, "how long before expiry a transport certificate is renewed (default: 24h)")
+	f.BoolVar(&c.Daemon, "daemon", false, "keep running and renew the transport certificate before each expiry")
+	f.BoolVar(&c.Rekey, "rekey", false, "generate a new key for each renewed transport certificate, or for the CSR of gencsr -cert")
+	f.IntVar(&c.ReloadPID, "reload-pid", 0, "process to send SIGHUP to after renewing the transport certificate")
+	f.StringVar(&c.Hook, "hook", "", "shell command to run after renewing the transport certificate")
+	f.StringVar(&c.OutputPrefix, "output-prefix", "", "Write the certificate, key and CSR to prefix.pem, prefix-key.pem and prefix.csr instead of printing them as JSON")
+	f.StringVar(&c.PasswordFile, "password-file", "", "file whose first line is the password of a PKCS #12 file")
+	f.BoolVar(&c.NoPassword, "no-password", false, "export a PKCS #12 file protected by an empty password")
+	f.StringVar(&c.PublishedLog, "published-log", "", "signed certificate log published before, which export-log extends and replaces")
+	f.StringVar(&c.Module, "module", "", "path to the PKCS #11 module of the token")
+	f.StringVar(&c.Token, "token", "", "label of the PKCS #11 token (default: the first token found)")
+	f.StringVar(&c.PIN, "pin", "", "user PIN of the PKCS #11 token, or 'env:varname' to read it from the environment")
+	f.StringVar(&c.BatchFile, "batch", "", "CSV or JSON file listing the serial, AKI and reason of certificates to revoke")
+}
+
+// logLevel is the flag.Value of -loglevel, setting log.Level from a
+// level number or name.
+type logLevel struct{}
+
+func (logLevel) String() string {
+	return strconv.Itoa(log.Level)
+}
+
+func (logLevel) Set(s string) error {
+	l, err := log.ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	log.Level = l
+	return nil
 }
 
 // RootFromConfig returns a universal signer Root structure that can
@@ -0,0 +1,70 @@
+// Package configcmd implements the config command.
+package configcmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/config"
+)
+
+// Usage text of 'cfssl config'
+var configUsageText = `cfssl config -- checks configuration files
+
+Usage of config:
+        cfssl config validate CONFIG
+
+validate rejects the keys of CONFIG that aren't configuration fields,
+which loading the configuration silently ignores, along with invalid
+expiries and usages, and auth keys and remotes missing from their
+sections. Each problem is printed with the line and column where it
+was found. CONFIG may be "-" to read the configuration from stdin.
+
+Flags:
+`
+
+// Flags of 'cfssl config'
+var configFlags = []string{}
+
+// configMain is the main CLI of the config command.
+func configMain(args []string, c cli.Config) error {
+	subcommand, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if subcommand != "validate" {
+		return fmt.Errorf("unknown config subcommand %q", subcommand)
+	}
+
+	file, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("only one configuration file can be validated")
+	}
+
+	data, err := cli.ReadStdin(file)
+	if err != nil {
+		return err
+	}
+	errs := config.Validate(data)
+	for _, err := range errs {
+		// Located errors are printed as file:line:column: message.
+		if verr, ok := err.(*config.ValidationError); ok && verr.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", file, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s is not a valid configuration", file)
+	}
+	fmt.Printf("%s is valid\n", file)
+	return nil
+}
+
+// Command assembles the definition of Command 'config'
+var Command = &cli.Command{UsageText: configUsageText, Flags: configFlags, Main: configMain}
@@ -0,0 +1,26 @@
+package configcmd
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestConfigValidate(t *testing.T) {
+	if err := configMain([]string{"validate", "../../config/testdata/valid_config_auth.json"}, cli.Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"check", "../../config/testdata/valid_config_auth.json"},
+		{"validate"},
+		{"validate", "../../config/testdata/valid_config_auth.json", "../../config/testdata/valid_config.json"},
+		{"validate", "../../config/testdata/missing.json"},
+		{"validate", "../../config/testdata/invalid_usage.json"},
+	} {
+		if err := configMain(args, cli.Config{}); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+}
@@ -2,15 +2,21 @@
 package crl
 
 import (
-	"os"
-
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/cloudflare/cfssl/api/client"
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	certsql "github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/crl"
-	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer/kms"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -18,19 +24,81 @@ import (
 var crlUsageText = `cfssl crl -- generate a new Certificate Revocation List from Database
 
 Usage of crl:
-        cfssl crl
+        cfssl crl -db-config db-config -ca cert -ca-key key [-expiry duration] [-crl-number none|timestamp|sequential] [-delta]
+        cfssl crl -db-config db-config -ca cert -crl-signer cert -crl-signer-key key [-expiry duration] [-crl-number none|timestamp|sequential] [-delta]
+        cfssl crl -remote remote_host [-tls-remote-ca ca] [-mutual-tls-client-cert cert -mutual-tls-client-key key] [-expiry duration]
+
+The CRL lists the revoked and unexpired certificates of the cert db, with
+their reason codes and invalidity dates.
+
+When -crl-signer and -crl-signer-key are given, the CRL is signed with that
+delegated CRL signing certificate (see "cfssl gencrlsigner") instead of the
+CA key. The CA key is not needed in that case. Either key may be a key file
+or a 'awskms:///key-id' or 'gcpkms:///key-name' key URI.
+
+-crl-number chooses how CRLs are numbered: not at all (none, the default),
+with the current time in nanoseconds (timestamp), or with a sequence of
+numbers kept for the CA in the cert db (sequential). CRLs are only numbered
+when the CA certificate carries the cRLSign key usage and a subject key
+identifier, or when they are signed by a delegated CRL signer.
+
+With sequential numbers, each full CRL is recorded in the cert db as the
+base of the delta CRLs generated with -delta, which list the certificates
+revoked since that full CRL was generated. To make up for the clock of the
+cert db differing from the local one, they also list those revoked up to
+five minutes before. Delta CRLs need a full CRL to have been generated with
+sequential numbers first.
+
+With -remote, the CRL is generated and signed by the remote CFSSL server
+instead, from its own cert db and with its own numbering.
 
 Flags:
 `
-var crlFlags = []string{"db-config", "ca", "ca-key", "expiry"}
+var crlFlags = []string{"db-config", "ca", "ca-key", "expiry", "crl-signer", "crl-signer-key", "crl-number", "delta",
+	"remote", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
+
+// The ways CRLs are numbered, as given with -crl-number.
+const (
+	numberNone       = "none"
+	numberTimestamp  = "timestamp"
+	numberSequential = "sequential"
+)
+
+// deltaOverlap is how long before their base full CRL delta CRLs start
+// listing revoked certificates, so that none is missed when revocation
+// times, set by the cert db, are behind the local clock. A certificate
+// listed in both the full and the delta CRL is harmless.
+const deltaOverlap = 5 * time.Minute
 
 func generateCRL(c cli.Config) (crlBytes []byte, err error) {
+	switch c.CRLNumber {
+	case "", numberNone, numberTimestamp, numberSequential:
+	default:
+		return nil, fmt.Errorf("invalid -crl-number %q: must be none, timestamp or sequential", c.CRLNumber)
+	}
+	if c.Delta && c.CRLNumber != numberSequential {
+		return nil, errors.New("delta CRLs need sequential CRL numbers (provide with -crl-number sequential)")
+	}
+
+	if c.Remote != "" {
+		if c.Delta || c.CRLNumber != "" {
+			return nil, errors.New("the remote server numbers its CRLs itself: -crl-number and -delta can't be used with -remote")
+		}
+		return remoteCRL(c)
+	}
+
 	if c.CAFile == "" {
 		log.Error("need CA certificate (provide one with -ca)")
 		return
 	}
 
-	if c.CAKeyFile == "" {
+	delegated := c.CRLSignerFile != "" || c.CRLSignerKeyFile != ""
+	if delegated && (c.CRLSignerFile == "" || c.CRLSignerKeyFile == "") {
+		log.Error("need both a CRL signer certificate and key (provide them with -crl-signer and -crl-signer-key)")
+		return
+	}
+
+	if c.CAKeyFile == "" && !delegated {
 		log.Error("need CA key (provide one with -ca-key)")
 		return
 	}
@@ -53,11 +121,6 @@ func generateCRL(c cli.Config) (crlBytes []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
-	log.Debug("loading CA key: ", c.CAKeyFile)
-	cakey, err := helpers.ReadBytes(c.CAKeyFile)
-	if err != nil {
-		return nil, cferr.Wrap(cferr.CertificateError, cferr.ReadFailed, err)
-	}
 
 	// Parse the PEM encoded certificate
 	issuerCert, err := helpers.ParseCertificatePEM(ca)
@@ -65,30 +128,96 @@ func generateCRL(c cli.Config) (crlBytes []byte, err error) {
 		return nil, err
 	}
 
-	strPassword := os.Getenv("CFSSL_CA_PK_PASSWORD")
-	password := []byte(strPassword)
-	if strPassword == "" {
-		password = nil
-	}
-
-	// Parse the key given
-	key, err := helpers.ParsePrivateKeyPEMWithPassword(cakey, password)
+	// The CRL is issued as of the time the revoked certificates are
+	// read, so that a full CRL recorded as the base of delta CRLs
+	// doesn't miss a certificate revoked while it is generated.
+	now := time.Now()
+	certs, err := dbAccessor.GetRevokedAndUnexpiredCertificates()
 	if err != nil {
-		log.Debugf("malformed private key %v", err)
 		return nil, err
 	}
 
-	certs, err := dbAccessor.GetRevokedAndUnexpiredCertificates()
+	tpl := crl.Template{ThisUpdate: now, NextUpdate: now.Add(c.CRLExpiration)}
+
+	var key crypto.Signer
+	if delegated {
+		log.Debug("loading CRL signer: ", c.CRLSignerFile)
+		signerPEM, err := helpers.ReadBytes(c.CRLSignerFile)
+		if err != nil {
+			return nil, err
+		}
+		if tpl.DelegateCert, err = helpers.ParseCertificatePEM(signerPEM); err != nil {
+			return nil, err
+		}
+
+		log.Debug("loading CRL signer key: ", c.CRLSignerKeyFile)
+		if key, err = kms.LoadSigner(c.CRLSignerKeyFile); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Debug("loading CA key: ", c.CAKeyFile)
+		if key, err = kms.LoadSigner(c.CAKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.CRLNumber {
+	case numberTimestamp:
+		tpl.Number = big.NewInt(now.UnixNano())
+	case numberSequential:
+		if len(issuerCert.SubjectKeyId) == 0 {
+			return nil, errors.New("sequential CRL numbers need a CA certificate with a subject key identifier")
+		}
+		aki := hex.EncodeToString(issuerCert.SubjectKeyId)
+
+		if c.Delta {
+			crs, err := dbAccessor.GetCRLRecord(aki)
+			if err != nil {
+				return nil, err
+			}
+			if len(crs) == 0 || crs[0].BaseNumber == 0 {
+				return nil, errors.New("no full CRL with a sequential number to base a delta CRL on")
+			}
+			tpl.BaseNumber = big.NewInt(crs[0].BaseNumber)
+			certs = crl.RevokedSince(certs, crs[0].BaseThisUpdate.Add(-deltaOverlap))
+		}
+
+		number, err := dbAccessor.NextCRLNumber(aki)
+		if err != nil {
+			return nil, err
+		}
+		tpl.Number = big.NewInt(number)
+
+		crlBytes, err = crl.NewCRLFromTemplate(certs, issuerCert, key, tpl)
+		if err != nil {
+			return nil, err
+		}
+		if !c.Delta {
+			if err = dbAccessor.SetBaseCRL(aki, number, now); err != nil {
+				return nil, err
+			}
+		}
+		return crlBytes, nil
+	}
+
+	return crl.NewCRLFromTemplate(certs, issuerCert, key, tpl)
+}
+
+// remoteCRL fetches a CRL generated by the remote CFSSL server.
+func remoteCRL(c cli.Config) ([]byte, error) {
+	cert, err := helpers.LoadClientCertificate(c.MutualTLSCertFile, c.MutualTLSKeyFile)
 	if err != nil {
 		return nil, err
 	}
-
-	req, err := crl.NewCRLFromDB(certs, issuerCert, key, c.CRLExpiration)
+	remoteCAs, err := helpers.LoadPEMCertPool(c.TLSRemoteCAs)
 	if err != nil {
 		return nil, err
 	}
-
-	return req, nil
+	srv := client.NewServerTLS(c.Remote, helpers.CreateTLSConfig(remoteCAs, cert))
+	if srv == nil {
+		return nil, fmt.Errorf("invalid remote %q", c.Remote)
+	}
+	return srv.CRL(c.CRLExpiration)
 }
 
 func crlMain(args []string, c cli.Config) (err error) {
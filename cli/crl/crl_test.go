@@ -2,13 +2,20 @@ package crl
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	apicrl "github.com/cloudflare/cfssl/api/crl"
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/crl"
 	"github.com/cloudflare/cfssl/helpers"
 )
 
@@ -29,7 +36,7 @@ func prepDB() (err error) {
 		Expiry:    expirationTime,
 		PEM:       "revoked cert",
 		Status:    "revoked",
-		RevokedAt: time.Now(),
+		RevokedAt: time.Now().Add(-time.Hour),
 		Reason:    4,
 	}
 
@@ -89,3 +96,179 @@ func TestRevokeExpiry(t *testing.T) {
 
 	verifyCRL(t, crlBytes, "1", 23*time.Hour+time.Second)
 }
+
+func TestRevokeDelegatedSigner(t *testing.T) {
+	err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM, err := helpers.ReadBytes(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKeyPEM, err := helpers.ReadBytes(testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := helpers.ParsePrivateKeyPEM(caKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signerPEM, signerKeyPEM, err := crl.NewDelegatedSigner(caCert, caKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "cfssl-crl-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	signerFile := filepath.Join(dir, "crl-signer.pem")
+	signerKeyFile := filepath.Join(dir, "crl-signer-key.pem")
+	if err = ioutil.WriteFile(signerFile, signerPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(signerKeyFile, signerKeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	crlBytes, err := generateCRL(cli.Config{
+		CAFile:           testCaFile,
+		CRLSignerFile:    signerFile,
+		CRLSignerKeyFile: signerKeyFile,
+		DBConfigFile:     "../testdata/db-config.json",
+		CRLExpiration:    7 * helpers.OneDay,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyCRL(t, crlBytes, "1", 7*helpers.OneDay+time.Second)
+
+	signerCert, err := helpers.ParseCertificatePEM(signerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedCrl, err := x509.ParseCRL(crlBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = signerCert.CheckCRLSignature(parsedCrl); err != nil {
+		t.Fatalf("CRL was not signed by the delegated signer: %v", err)
+	}
+}
+
+func TestSequentialAndDeltaCRLs(t *testing.T) {
+	err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cli.Config{CAFile: testCaFile, CAKeyFile: testCaKeyFile, DBConfigFile: "../testdata/db-config.json",
+		CRLExpiration: time.Hour, CRLNumber: "sequential", Delta: true}
+	if _, err = generateCRL(c); err == nil {
+		t.Fatal("expected a delta CRL without a full CRL to fail")
+	}
+
+	c.Delta = false
+	for number := int64(1); number <= 2; number++ {
+		crlBytes, err := generateCRL(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := x509.ParseRevocationList(crlBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list.Number.Int64() != number || len(list.RevokedCertificateEntries) != 1 {
+			t.Fatalf("expected CRL number %d listing one certificate, got %v: %+v", number, list.Number, list.RevokedCertificateEntries)
+		}
+		if reason := list.RevokedCertificateEntries[0].ReasonCode; reason != 4 {
+			t.Fatalf("expected reason code 4, got %d", reason)
+		}
+	}
+
+	// Only the certificates revoked since the last full CRL are listed in
+	// a delta CRL.
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial:    "2",
+		AKI:       fakeAKI,
+		Expiry:    time.Now().AddDate(1, 0, 0),
+		PEM:       "revoked cert",
+		Status:    "revoked",
+		RevokedAt: time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial:    "3",
+		AKI:       fakeAKI,
+		Expiry:    time.Now().AddDate(1, 0, 0),
+		PEM:       "revoked cert",
+		Status:    "revoked",
+		RevokedAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Delta = true
+	crlBytes, err := generateCRL(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := x509.ParseRevocationList(crlBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := map[int64]bool{}
+	for _, entry := range list.RevokedCertificateEntries {
+		listed[entry.SerialNumber.Int64()] = true
+	}
+	if list.Number.Int64() != 3 || len(listed) != 2 || !listed[2] || !listed[3] {
+		t.Fatalf("expected delta CRL number 3 listing serials 2 and 3, got %v: %+v", list.Number, list.RevokedCertificateEntries)
+	}
+	var isDelta bool
+	for _, ext := range list.Extensions {
+		isDelta = isDelta || ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 27})
+	}
+	if !isDelta {
+		t.Fatal("expected a delta CRL indicator")
+	}
+
+	c.CRLNumber = "timestamp"
+	if _, err = generateCRL(c); err == nil {
+		t.Fatal("expected a delta CRL without sequential numbers to fail")
+	}
+}
+
+func TestRemoteCRL(t *testing.T) {
+	err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := apicrl.NewHandler(dbAccessor, testCaFile, testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	crlBytes, err := generateCRL(cli.Config{Remote: ts.URL, CRLExpiration: 23 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCRL(t, crlBytes, "1", 23*time.Hour+time.Second)
+
+	if _, err = generateCRL(cli.Config{Remote: ts.URL, CRLNumber: "sequential"}); err == nil {
+		t.Fatal("expected -crl-number with -remote to fail")
+	}
+}
@@ -0,0 +1,159 @@
+// Package exportlog implements the export-log command
+package exportlog
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudflare/cfssl/auditlog"
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer/kms"
+)
+
+var exportlogUsageText = `cfssl export-log -- export the issued certificates as a signed Merkle tree log
+
+Every certificate in the certificate database becomes a leaf of a Merkle
+tree hashed as in RFC 6962, ordered by notBefore. The leaves and a tree
+head signed with -key are printed as JSON; with them, the inclusion of any
+certificate can be proven later.
+
+With -published-log, the log is kept in that file between exports: the
+leaves it holds keep their order, the certificates added to the database
+since are appended to them, and the file is replaced with the new log.
+Each log then extends the one published before, so that the inclusion of
+a certificate proven against an earlier tree head also holds in the later
+ones. The file must have been signed with -key; it is created if missing.
+
+Usage of export-log:
+        cfssl export-log -db-config db-config -key key [-published-log file]
+
+Flags:
+`
+
+var exportlogFlags = []string{"db-config", "key", "published-log"}
+
+// exportLog returns the JSON encoded signed log of the certificates in
+// the database.
+func exportLog(c cli.Config) ([]byte, error) {
+	if c.DBConfigFile == "" {
+		return nil, errors.New("need DB config file (provide with -db-config)")
+	}
+	if c.KeyFile == "" {
+		return nil, errors.New("need a key to sign the tree head (provide with -key)")
+	}
+
+	key, err := loadKey(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbconf.DBFromConfig(c.DBConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	records, err := sql.NewAccessor(db).GetAllCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	published, err := readPublished(c.PublishedLog, key.Public())
+	if err != nil {
+		return nil, err
+	}
+	l, err := auditlog.Extend(published, records)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.Sign(key); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if c.PublishedLog != "" {
+		if err = writePublished(c.PublishedLog, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// readPublished reads the log published before in path and checks that
+// it is signed by pub. It returns nil if path is empty or doesn't exist
+// yet.
+func readPublished(path string, pub crypto.PublicKey) (*auditlog.Log, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var l auditlog.Log
+	if err = json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("published log %s: %v", path, err)
+	}
+	if err = l.Verify(pub); err != nil {
+		return nil, fmt.Errorf("published log %s: %v", path, err)
+	}
+	return &l, nil
+}
+
+// writePublished replaces the published log in path with out, through a
+// temporary file so that the file always holds a complete log.
+func writePublished(path string, out []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(out)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadKey reads a PEM encoded private key, or opens a key held in a key
+// management service if keyFile is a key URI.
+func loadKey(keyFile string) (crypto.Signer, error) {
+	if kms.IsURI(keyFile) {
+		return kms.NewSigner(keyFile)
+	}
+	keyPEM, err := helpers.ReadBytes(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return helpers.ParsePrivateKeyPEM(keyPEM)
+}
+
+func exportlogMain(args []string, c cli.Config) error {
+	out, err := exportLog(c)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// Command assembles the definition of Command 'export-log'
+var Command = &cli.Command{UsageText: exportlogUsageText, Flags: exportlogFlags, Main: exportlogMain}
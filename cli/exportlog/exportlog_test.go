@@ -0,0 +1,143 @@
+package exportlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/auditlog"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const (
+	testDBConfig  = "../testdata/db-config.json"
+	testCaFile    = "../testdata/ca.pem"
+	testCaKeyFile = "../testdata/ca-key.pem"
+)
+
+func TestExportLog(t *testing.T) {
+	accessor := sql.NewAccessor(testdb.SQLiteDB("../../certdb/testdb/certstore_development.db"))
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert := func(serial int64, notBefore time.Time) {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "export-log.example.com"},
+			NotBefore:    notBefore,
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = accessor.InsertCertificate(certdb.CertificateRecord{
+			Serial: cert.SerialNumber.String(),
+			AKI:    "export log aki",
+			Status: "good",
+			Expiry: cert.NotAfter,
+			PEM:    string(helpers.EncodeCertificatePEM(cert)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for serial := int64(1); serial <= 3; serial++ {
+		insert(serial, time.Now().Add(time.Duration(serial)*time.Minute))
+	}
+
+	out, err := exportLog(cli.Config{DBConfigFile: testDBConfig, KeyFile: testCaKeyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l auditlog.Log
+	if err := json.Unmarshal(out, &l); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Leaves) != 3 || l.Leaves[0].Serial != "1" || l.Leaves[2].Serial != "3" {
+		t.Fatalf("unexpected leaves %+v", l.Leaves)
+	}
+
+	caPEM, err := ioutil.ReadFile(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(ca.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := exportLog(cli.Config{DBConfigFile: testDBConfig}); err == nil {
+		t.Fatal("expected an error without a signing key")
+	}
+
+	// With a published log, a certificate issued before the published
+	// ones but inserted after them is appended to the log.
+	dir, err := ioutil.TempDir("", "exportlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := cli.Config{DBConfigFile: testDBConfig, KeyFile: testCaKeyFile, PublishedLog: filepath.Join(dir, "log.json")}
+	if _, err = exportLog(c); err != nil {
+		t.Fatal(err)
+	}
+	insert(4, time.Now().Add(-time.Hour))
+	if _, err = exportLog(c); err != nil {
+		t.Fatal(err)
+	}
+	published, err := ioutil.ReadFile(c.PublishedLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extended auditlog.Log
+	if err := json.Unmarshal(published, &extended); err != nil {
+		t.Fatal(err)
+	}
+	if extended.TreeHead.TreeSize != 4 || extended.Leaves[3].Serial != "4" {
+		t.Fatalf("expected the new certificate to be appended, got %+v", extended.Leaves)
+	}
+	for i := range l.Leaves {
+		if extended.Leaves[i].Serial != l.Leaves[i].Serial {
+			t.Fatalf("expected leaf %d to keep its place, got %+v", i, extended.Leaves)
+		}
+	}
+	if err := extended.Verify(ca.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := filepath.Join(dir, "other-key.pem")
+	if err = ioutil.WriteFile(otherKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	other := cli.Config{DBConfigFile: testDBConfig, KeyFile: otherKey, PublishedLog: c.PublishedLog}
+	if _, err = exportLog(other); err == nil {
+		t.Fatal("expected a log published with another key to be rejected")
+	}
+}
@@ -2,14 +2,19 @@
 package gencert
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"reflect"
 
 	"github.com/cloudflare/cfssl/api/generator"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/cli/genkey"
 	"github.com/cloudflare/cfssl/cli/sign"
 	"github.com/cloudflare/cfssl/csr"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
@@ -29,15 +34,108 @@ Usage of gencert:
     Re-generate a CA cert with the CA key and certificate:
         cfssl gencert -renewca -ca cert -ca-key key
 
+    Renew a cert for its existing key:
+        cfssl gencert -renew -cert cert -key key -ca cert -ca-key key [-config config] [-profile profile] [-hostname hostname]
+        cfssl gencert -renew -cert cert -key key -remote remote_host [-config config] [-profile profile] [-label label] [-hostname hostname]
+
 Arguments:
         CSRJSON:    JSON file containing the request, use '-' for reading JSON from stdin
 
+With -renew, the subject and subject alternative names of the existing
+certificate are requested again with its key, and the certificate is
+signed for the validity period of the signing profile. The key usages
+come from the profile too: a warning is logged if they differ from those
+of the existing certificate. The key isn't written out again.
+
+With -output-prefix, the certificate, key and CSR are written to
+prefix.pem, prefix-key.pem and prefix.csr, as 'cfssljson -bare prefix'
+would, instead of being printed as JSON.
+
 Flags:
 `
 
-var gencertFlags = []string{"initca", "remote", "ca", "ca-key", "config", "cn", "hostname", "profile", "label"}
+var gencertFlags = []string{"initca", "renew", "cert", "key", "remote", "ca", "ca-key", "config", "cn", "hostname", "profile", "label", "output-prefix"}
+
+// renewMain signs a new certificate for the subject, subject alternative
+// names and key of an existing one.
+func renewMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("gencert -renew takes no arguments")
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("gencert -renew requires -cert and -key")
+	}
+
+	certPEM, err := helpers.ReadBytes(c.CertFile)
+	if err != nil {
+		return err
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := helpers.ReadBytes(c.KeyFile)
+	if err != nil {
+		return err
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return err
+	}
+
+	certPub, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+	keyPub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(certPub, keyPub) {
+		return cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch)
+	}
+
+	req := csr.ExtractCertificateRequest(cert)
+	req.CA = nil
+	if c.CNOverride != "" {
+		req.CN = c.CNOverride
+	}
+	csrBytes, err := csr.Generate(key, req)
+	if err != nil {
+		return err
+	}
+
+	s, err := sign.SignerFromConfig(c)
+	if err != nil {
+		return err
+	}
+	newCertPEM, err := s.Sign(signer.SignRequest{
+		Request:     string(csrBytes),
+		Hosts:       signer.SplitHosts(c.Hostname),
+		Profile:     c.Profile,
+		Label:       c.Label,
+		CRLOverride: c.CRL,
+	})
+	if err != nil {
+		return err
+	}
+
+	newCert, err := helpers.ParseCertificatePEM(newCertPEM)
+	if err != nil {
+		return err
+	}
+	if newCert.KeyUsage != cert.KeyUsage || !reflect.DeepEqual(newCert.ExtKeyUsage, cert.ExtKeyUsage) {
+		log.Warningf("the key usages of the renewed certificate differ from those of %s; check the signing profile", c.CertFile)
+	}
+
+	return cli.OutputCert(c.OutputPrefix, nil, csrBytes, newCertPEM)
+}
 
 func gencertMain(args []string, c cli.Config) error {
+	if c.Renew {
+		return renewMain(args, c)
+	}
+
 	if c.RenewCA {
 		log.Infof("re-generate a CA certificate from CA cert and key")
 		cert, err := initca.RenewFromPEM(c.CAFile, c.CAKeyFile)
@@ -45,8 +143,7 @@ func gencertMain(args []string, c cli.Config) error {
 			log.Errorf("%v\n", err)
 			return err
 		}
-		cli.PrintCert(nil, nil, cert)
-		return nil
+		return cli.OutputCert(c.OutputPrefix, nil, nil, cert)
 	}
 
 	csrJSONFile, args, err := cli.PopFirstArgument(args)
@@ -91,7 +188,7 @@ func gencertMain(args []string, c cli.Config) error {
 			}
 
 		}
-		cli.PrintCert(key, csrPEM, cert)
+		return cli.OutputCert(c.OutputPrefix, key, csrPEM, cert)
 
 	default:
 		if req.CA != nil {
@@ -156,9 +253,8 @@ func gencertMain(args []string, c cli.Config) error {
 			log.Warning(generator.CSRNoHostMessage)
 		}
 
-		cli.PrintCert(key, csrBytes, cert)
+		return cli.OutputCert(c.OutputPrefix, key, csrBytes, cert)
 	}
-	return nil
 }
 
 // Command assembles the definition of Command 'gencert'
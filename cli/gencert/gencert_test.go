@@ -1,11 +1,16 @@
 package gencert
 
 import (
+	"bytes"
+	"crypto/x509"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 func TestGencertMain(t *testing.T) {
@@ -215,3 +220,119 @@ func TestBadGencertMain(t *testing.T) {
 	}
 
 }
+
+func TestGencertOutputPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gencert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prefix := filepath.Join(dir, "server")
+	c := cli.Config{
+		CAFile:       "../testdata/ca.pem",
+		CAKeyFile:    "../testdata/ca-key.pem",
+		OutputPrefix: prefix,
+	}
+	if err = gencertMain([]string{"../testdata/csr.json"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile(prefix + ".pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	keyInfo, err := os.Stat(prefix + "-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyInfo.Mode().Perm() != 0600 {
+		t.Fatalf("the key should only be readable by its owner, got %v", keyInfo.Mode())
+	}
+	if _, err = os.Stat(prefix + ".csr"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected only the certificate, key and CSR, got %d files", len(files))
+	}
+}
+
+func TestGencertRenew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gencert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := filepath.Join(dir, "old")
+	c := cli.Config{
+		CAFile:       "../testdata/ca.pem",
+		CAKeyFile:    "../testdata/ca-key.pem",
+		CNOverride:   "cloudflare.com",
+		OutputPrefix: old,
+	}
+	if err = gencertMain([]string{"../testdata/csr.json"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	renewed := filepath.Join(dir, "renewed")
+	c = cli.Config{
+		Renew:        true,
+		CertFile:     old + ".pem",
+		KeyFile:      old + "-key.pem",
+		CAFile:       "../testdata/ca.pem",
+		CAKeyFile:    "../testdata/ca-key.pem",
+		OutputPrefix: renewed,
+	}
+	if err = gencertMain(nil, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(renewed + "-key.pem"); !os.IsNotExist(err) {
+		t.Fatal("the key of a renewed certificate should not be written out again")
+	}
+
+	oldCert := readCert(t, old+".pem")
+	cert := readCert(t, renewed+".pem")
+	if cert.SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+		t.Error("expected the renewed certificate to have a new serial number")
+	}
+	if cert.Subject.String() != oldCert.Subject.String() {
+		t.Errorf("expected subject %s, got %s", oldCert.Subject, cert.Subject)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, oldCert.DNSNames) {
+		t.Errorf("expected DNS names %v, got %v", oldCert.DNSNames, cert.DNSNames)
+	}
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, oldCert.RawSubjectPublicKeyInfo) {
+		t.Error("expected the renewed certificate to keep the public key")
+	}
+
+	// The key must match the certificate.
+	c.KeyFile = "../testdata/ca-key.pem"
+	if err = gencertMain(nil, c); err == nil {
+		t.Fatal("expected renewing with another key to fail")
+	}
+	c.KeyFile = ""
+	if err = gencertMain(nil, c); err == nil {
+		t.Fatal("expected renewing without a key to fail")
+	}
+}
+
+func readCert(t *testing.T, file string) *x509.Certificate {
+	certPEM, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
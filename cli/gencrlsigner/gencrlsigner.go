@@ -0,0 +1,72 @@
+// Package gencrlsigner implements the gencrlsigner command
+package gencrlsigner
+
+import (
+	"errors"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer/kms"
+)
+
+var gencrlsignerUsageText = `cfssl gencrlsigner -- generate a delegated CRL signing key and certificate
+
+The generated certificate is issued by the CA and only carries the cRLSign
+key usage. It can be used to sign CRLs on behalf of the CA with
+"cfssl crl -crl-signer cert.pem -crl-signer-key key.pem".
+
+The CA key may be a key file or a 'awskms:///key-id' or
+'gcpkms:///key-name' key URI.
+
+Usage of gencrlsigner:
+        cfssl gencrlsigner -ca cert -ca-key key
+
+Flags:
+`
+
+var gencrlsignerFlags = []string{"ca", "ca-key"}
+
+func gencrlsignerMain(args []string, c cli.Config) (err error) {
+	if len(args) > 0 {
+		return errors.New("too many arguments are provided, please check with usage")
+	}
+
+	if c.CAFile == "" {
+		log.Error("need CA certificate (provide one with -ca)")
+		return errors.New("need CA certificate (provide one with -ca)")
+	}
+
+	if c.CAKeyFile == "" {
+		log.Error("need CA key (provide one with -ca-key)")
+		return errors.New("need CA key (provide one with -ca-key)")
+	}
+
+	log.Debug("loading CA: ", c.CAFile)
+	ca, err := helpers.ReadBytes(c.CAFile)
+	if err != nil {
+		return
+	}
+	caCert, err := helpers.ParseCertificatePEM(ca)
+	if err != nil {
+		return
+	}
+
+	log.Debug("loading CA key: ", c.CAKeyFile)
+	caKey, err := kms.LoadSigner(c.CAKeyFile)
+	if err != nil {
+		return
+	}
+
+	cert, key, err := crl.NewDelegatedSigner(caCert, caKey, helpers.OneYear)
+	if err != nil {
+		return
+	}
+
+	cli.PrintCert(key, nil, cert)
+	return nil
+}
+
+// Command assembles the definition of Command 'gencrlsigner'
+var Command = &cli.Command{UsageText: gencrlsignerUsageText, Flags: gencrlsignerFlags, Main: gencrlsignerMain}
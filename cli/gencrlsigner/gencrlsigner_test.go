@@ -0,0 +1,21 @@
+package gencrlsigner
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestGencrlsigner(t *testing.T) {
+	err := gencrlsignerMain([]string{}, cli.Config{CAFile: "../testdata/ca.pem", CAKeyFile: "../testdata/ca-key.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGencrlsignerMissingCA(t *testing.T) {
+	err := gencrlsignerMain([]string{}, cli.Config{CAKeyFile: "../testdata/ca-key.pem"})
+	if err == nil {
+		t.Fatal("expected an error without a CA certificate")
+	}
+}
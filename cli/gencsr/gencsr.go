@@ -2,8 +2,13 @@
 package gencsr
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/csr"
@@ -16,16 +21,32 @@ var gencsrUsageText = `cfssl gencsr -- generate a csr from a private key with ex
 Usage of gencsr:
         cfssl gencsr -key private_key_file [-host hostname_override] CSRJSON
         cfssl gencsr -key private_key_file [-host hostname_override] -cert certificate_file
+        cfssl gencsr -rekey [-host hostname_override] -cert certificate_file
 
 Arguments:
         CSRJSON:    JSON file containing the request, use '-' for reading JSON from stdin
 
+With -rekey instead of -key, a CSR reproducing the subject and SANs of the
+certificate is generated with a fresh private key of the same algorithm and
+size as the certificate's, to re-key it. The new key is output along with the
+CSR.
+
 Flags:
 `
 
-var gencsrFlags = []string{"key", "cert"}
+var gencsrFlags = []string{"key", "cert", "rekey"}
 
 func gencsrMain(args []string, c cli.Config) (err error) {
+	if c.Rekey {
+		if c.KeyFile != "" {
+			return errors.New("'-rekey' generates a new private key and can't be used with '-key', please check with usage")
+		}
+		if c.CertFile == "" {
+			return errors.New("certificate file is required through '-cert' to re-key, please check with usage")
+		}
+		return rekeyMain(args, c)
+	}
+
 	if c.KeyFile == "" {
 		return errors.New("private key file is required through '-key', please check with usage")
 	}
@@ -95,5 +116,54 @@ func gencsrMain(args []string, c cli.Config) (err error) {
 	return nil
 }
 
+// rekeyMain generates a CSR for the certificate of -cert with a fresh
+// private key.
+func rekeyMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("no argument is accepted with '-cert', please check with usage")
+	}
+
+	certBytes, err := helpers.ReadBytes(c.CertFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		return err
+	}
+
+	req := csr.ExtractCertificateRequest(cert)
+	req.CA = nil
+	if req.KeyRequest, err = keyRequest(cert.PublicKey); err != nil {
+		return err
+	}
+	if c.Hostname != "" {
+		req.Hosts = signer.SplitHosts(c.Hostname)
+	}
+
+	csrBytes, keyBytes, err := csr.ParseRequest(req)
+	if err != nil {
+		return err
+	}
+
+	cli.PrintCert(keyBytes, csrBytes, nil)
+	return nil
+}
+
+// keyRequest returns a request for a key of the same algorithm and size
+// as pub.
+func keyRequest(pub crypto.PublicKey) (*csr.KeyRequest, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &csr.KeyRequest{A: "rsa", S: pub.N.BitLen()}, nil
+	case *ecdsa.PublicKey:
+		return &csr.KeyRequest{A: "ecdsa", S: pub.Curve.Params().BitSize}, nil
+	case ed25519.PublicKey:
+		return &csr.KeyRequest{A: "ed25519"}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
 // Command assembles the definition of Command 'gencsr'
 var Command = &cli.Command{UsageText: gencsrUsageText, Flags: gencsrFlags, Main: gencsrMain}
@@ -1,13 +1,16 @@
 package gencsr
 
 import (
+	"encoding/asn1"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 const (
@@ -94,6 +97,65 @@ func TestGencsrFromCert(t *testing.T) {
 	}
 }
 
+func TestGencsrRekeyFromCert(t *testing.T) {
+	pipe, err := newStdoutRedirect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gencsrMain([]string{}, cli.Config{CertFile: testCACertFile}); err == nil {
+		t.Fatal("expected an error without -key or -rekey")
+	}
+	if err := gencsrMain([]string{}, cli.Config{CertFile: testCACertFile, KeyFile: testKeyFile, Rekey: true}); err == nil {
+		t.Fatal("expected an error with both -key and -rekey")
+	}
+	if err := gencsrMain([]string{}, cli.Config{CertFile: testCACertFile, Rekey: true}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := pipe.readAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response map[string]string
+	if err = json.Unmarshal(out, &response); err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM([]byte(response["key"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := helpers.ParseCSRPEM([]byte(response["csr"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certBytes, err := ioutil.ReadFile(testCACertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.Subject.String() != cert.Subject.String() {
+		t.Fatalf("expected subject %s, got %s", cert.Subject, csr.Subject)
+	}
+	if !reflect.DeepEqual(csr.PublicKey, key.Public()) {
+		t.Fatal("the CSR isn't for the generated key")
+	}
+	if reflect.DeepEqual(csr.PublicKey, cert.PublicKey) {
+		t.Fatal("the CSR reuses the key of the certificate")
+	}
+	if csr.PublicKeyAlgorithm != cert.PublicKeyAlgorithm {
+		t.Fatalf("expected a %v key, got %v", cert.PublicKeyAlgorithm, csr.PublicKeyAlgorithm)
+	}
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 19}) {
+			t.Fatal("the CSR of a re-keyed CA certificate asks for a CA certificate")
+		}
+	}
+}
+
 func TestGencsrError(t *testing.T) {
 	if err := gencsrMain([]string{"testdata/csr.json"}, cli.Config{}); err == nil {
 		t.Fatal("should have erred.")
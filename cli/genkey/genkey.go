@@ -4,6 +4,7 @@ package genkey
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/csr"
@@ -18,10 +19,14 @@ Usage of genkey:
 Arguments:
         CSRJSON:    JSON file containing the request, use '-' for reading JSON from stdin
 
+With -output-prefix, the key and CSR are written to prefix-key.pem and
+prefix.csr, as 'cfssljson -bare prefix' would, instead of being printed
+as JSON.
+
 Flags:
 `
 
-var genkeyFlags = []string{"initca", "config"}
+var genkeyFlags = []string{"initca", "config", "min-rsa-bits", "output-prefix"}
 
 func genkeyMain(args []string, c cli.Config) (err error) {
 	csrFile, args, err := cli.PopFirstArgument(args)
@@ -45,6 +50,10 @@ func genkeyMain(args []string, c cli.Config) (err error) {
 		return
 	}
 
+	if kr := req.KeyRequest; kr != nil && kr.Algo() == "rsa" && kr.Size() < c.MinRSABits {
+		return fmt.Errorf("RSA key size %d is below the minimum of %d bits (see -min-rsa-bits)", kr.Size(), c.MinRSABits)
+	}
+
 	if c.IsCA {
 		var key, csrPEM, cert []byte
 		cert, csrPEM, key, err = initca.New(&req)
@@ -52,7 +61,7 @@ func genkeyMain(args []string, c cli.Config) (err error) {
 			return
 		}
 
-		cli.PrintCert(key, csrPEM, cert)
+		return cli.OutputCert(c.OutputPrefix, key, csrPEM, cert)
 	} else {
 		if req.CA != nil {
 			err = errors.New("ca section only permitted in initca")
@@ -67,9 +76,8 @@ func genkeyMain(args []string, c cli.Config) (err error) {
 			return
 		}
 
-		cli.PrintCert(key, csrPEM, nil)
+		return cli.OutputCert(c.OutputPrefix, key, csrPEM, nil)
 	}
-	return nil
 }
 
 // Validator does nothing and will never return an error. It exists because creating a
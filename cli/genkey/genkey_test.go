@@ -81,3 +81,28 @@ func TestGenkey(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestGenkeyMinRSABits(t *testing.T) {
+	c := cli.Config{MinRSABits: 2048}
+	if err := genkeyMain([]string{"testdata/rsa1024.json"}, c); err == nil {
+		t.Fatal("expected a 1024-bit RSA key request to be rejected")
+	}
+
+	for _, csrFile := range []string{"testdata/csr.json", "testdata/ecdsa.json"} {
+		pipe, err := newStdoutRedirect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := genkeyMain([]string{csrFile}, c); err != nil {
+			pipe.readAll()
+			t.Fatalf("%s: %v", csrFile, err)
+		}
+		out, err := pipe.readAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkResponse(out); err != nil {
+			t.Fatalf("%s: %v", csrFile, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package genkeypkcs11 implements the genkey-pkcs11 command.
+package genkeypkcs11
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/signer/pkcs11"
+)
+
+var genkeyPKCS11UsageText = `cfssl genkey-pkcs11 -- generate a key in a PKCS #11 token and a CSR for it
+
+Usage of genkey-pkcs11:
+        cfssl genkey-pkcs11 -module lib.so -label label -csr CSRJSON [-token token] [-pin pin]
+
+The key pair is generated inside the token, labelled label, as requested
+by the "key" section of CSRJSON: an RSA or ECDSA key. The private key is
+sensitive and non-extractable, and never leaves the token: the CSR is
+signed by the token. The CSR and the public key are printed as JSON.
+
+The PIN may be given as 'env:varname' to read it from the environment.
+
+Flags:
+`
+
+var genkeyPKCS11Flags = []string{"module", "token", "pin", "label", "csr", "min-rsa-bits"}
+
+// readPIN returns the PIN given with -pin, reading it from the
+// environment if it is given as env:varname.
+func readPIN(pin string) string {
+	if name := strings.TrimPrefix(pin, "env:"); name != pin {
+		return os.Getenv(name)
+	}
+	return pin
+}
+
+func genkeyPKCS11Main(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("no argument is accepted, please check with usage")
+	}
+	if c.Module == "" || c.Label == "" || c.CSRFile == "" {
+		return errors.New("-module, -label and -csr are required")
+	}
+
+	csrFileBytes, err := cli.ReadStdin(c.CSRFile)
+	if err != nil {
+		return err
+	}
+	req := csr.CertificateRequest{
+		KeyRequest: csr.NewKeyRequest(),
+	}
+	if err = json.Unmarshal(csrFileBytes, &req); err != nil {
+		return err
+	}
+	if req.CA != nil {
+		return errors.New("ca section only permitted in initca")
+	}
+	if req.KeyRequest == nil {
+		req.KeyRequest = csr.NewKeyRequest()
+	}
+	if kr := req.KeyRequest; kr.Algo() == "rsa" && kr.Size() < c.MinRSABits {
+		return fmt.Errorf("RSA key size %d is below the minimum of %d bits (see -min-rsa-bits)", kr.Size(), c.MinRSABits)
+	}
+
+	key, err := pkcs11.GenerateKey(&pkcs11.Config{
+		Module: c.Module,
+		Token:  c.Token,
+		PIN:    readPIN(c.PIN),
+		Label:  c.Label,
+	}, req.KeyRequest)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	csrPEM, err := csr.Generate(key, &req)
+	if err != nil {
+		return err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+
+	jsonOut, err := json.Marshal(map[string]string{
+		"csr":        string(csrPEM),
+		"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", jsonOut)
+	return nil
+}
+
+// Command assembles the definition of Command 'genkey-pkcs11'
+var Command = &cli.Command{UsageText: genkeyPKCS11UsageText, Flags: genkeyPKCS11Flags, Main: genkeyPKCS11Main}
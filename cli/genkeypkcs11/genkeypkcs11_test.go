@@ -0,0 +1,59 @@
+package genkeypkcs11
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestGenkeyPKCS11Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genkey-pkcs11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The requests are refused before the module is loaded.
+	for name, req := range map[string]string{
+		"ed25519": `{"CN": "leaf", "key": {"algo": "ed25519"}}`,
+		"rsa1024": `{"CN": "leaf", "key": {"algo": "rsa", "size": 1024}}`,
+		"curve":   `{"CN": "leaf", "key": {"algo": "ecdsa", "size": 255}}`,
+		"ca":      `{"CN": "leaf", "ca": {"expiry": "1h"}}`,
+	} {
+		csrFile := filepath.Join(dir, name+".json")
+		if err := ioutil.WriteFile(csrFile, []byte(req), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c := cli.Config{Module: filepath.Join(dir, "missing.so"), Label: "leaf", CSRFile: csrFile, MinRSABits: 2048}
+		if err := genkeyPKCS11Main(nil, c); err == nil {
+			t.Errorf("%s: expected the request to be refused", name)
+		}
+	}
+
+	for _, c := range []cli.Config{
+		{Label: "leaf", CSRFile: "csr.json"},
+		{Module: "lib.so", CSRFile: "csr.json"},
+		{Module: "lib.so", Label: "leaf"},
+	} {
+		if err := genkeyPKCS11Main(nil, c); err == nil {
+			t.Errorf("expected missing flags to be reported: %+v", c)
+		}
+	}
+	if err := genkeyPKCS11Main([]string{"csr.json"}, cli.Config{Module: "lib.so", Label: "leaf", CSRFile: "csr.json"}); err == nil {
+		t.Error("expected an argument to be refused")
+	}
+}
+
+func TestReadPIN(t *testing.T) {
+	os.Setenv("CFSSL_TEST_PIN", "5678")
+	defer os.Unsetenv("CFSSL_TEST_PIN")
+	if pin := readPIN("env:CFSSL_TEST_PIN"); pin != "5678" {
+		t.Errorf("expected the PIN to be read from the environment, got %q", pin)
+	}
+	if pin := readPIN("1234"); pin != "1234" {
+		t.Errorf("expected the PIN to be used as given, got %q", pin)
+	}
+}
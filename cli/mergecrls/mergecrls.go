@@ -0,0 +1,110 @@
+// Package mergecrls implements the merge-crls command
+package mergecrls
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/crl"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+var mergecrlsUsageText = `cfssl merge-crls -- merge several Certificate Revocation Lists into one
+
+Every CRL is checked against the issuer certificates given with -ca. If all
+of the CRLs have the same issuer, their entries are combined, keeping each
+revocation's time and reason, into a new CRL signed with -ca-key. CRLs with
+different issuers are rejected unless -allow-mixed-issuers is set, in which
+case they are output unchanged as a DER SEQUENCE of CRLs.
+
+Usage of merge-crls:
+        cfssl merge-crls -ca cert [-ca-key key] [-expiry duration] [-allow-mixed-issuers] CRL...
+
+Arguments:
+        CRL:                     A PEM or DER encoded CRL file, use '-' for reading from stdin
+
+Flags:
+`
+
+var mergecrlsFlags = []string{"ca", "ca-key", "expiry", "allow-mixed-issuers"}
+
+func mergecrlsMain(args []string, c cli.Config) (err error) {
+	if len(args) == 0 {
+		return errors.New("no CRLs provided, please check with usage")
+	}
+
+	if c.CAFile == "" {
+		log.Error("need CA certificate (provide one with -ca)")
+		return errors.New("need CA certificate (provide one with -ca)")
+	}
+
+	log.Debug("loading CA: ", c.CAFile)
+	ca, err := helpers.ReadBytes(c.CAFile)
+	if err != nil {
+		return
+	}
+	issuers, err := helpers.ParseCertificatesPEM(ca)
+	if err != nil {
+		return
+	}
+
+	var key crypto.Signer
+	if c.CAKeyFile != "" {
+		log.Debug("loading CA key: ", c.CAKeyFile)
+		cakey, err := helpers.ReadBytes(c.CAKeyFile)
+		if err != nil {
+			return cferr.Wrap(cferr.CertificateError, cferr.ReadFailed, err)
+		}
+
+		strPassword := os.Getenv("CFSSL_CA_PK_PASSWORD")
+		password := []byte(strPassword)
+		if strPassword == "" {
+			password = nil
+		}
+
+		key, err = helpers.ParsePrivateKeyPEMWithPassword(cakey, password)
+		if err != nil {
+			log.Debugf("malformed private key %v", err)
+			return err
+		}
+	}
+
+	var lists []*x509.RevocationList
+	for len(args) > 0 {
+		var file string
+		file, args, err = cli.PopFirstArgument(args)
+		if err != nil {
+			return
+		}
+
+		var crlBytes []byte
+		crlBytes, err = cli.ReadStdin(file)
+		if err != nil {
+			return
+		}
+
+		list, err := crl.ParseCRL(crlBytes)
+		if err != nil {
+			log.Errorf("failed to parse CRL %s: %v", file, err)
+			return err
+		}
+		lists = append(lists, list)
+	}
+
+	merged, err := crl.MergeCRLs(lists, issuers, key, time.Now().Add(c.CRLExpiration), c.AllowMixedIssuers)
+	if err != nil {
+		return
+	}
+
+	cli.PrintCRL(merged)
+	return nil
+}
+
+// Command assembles the definition of Command 'merge-crls'
+var Command = &cli.Command{UsageText: mergecrlsUsageText, Flags: mergecrlsFlags, Main: mergecrlsMain}
@@ -0,0 +1,38 @@
+package mergecrls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestMergecrls(t *testing.T) {
+	c := cli.Config{
+		CAFile:        "testdata/caTwo.pem",
+		CAKeyFile:     "testdata/ca-keyTwo.pem",
+		CRLExpiration: time.Hour,
+	}
+	err := mergecrlsMain([]string{"testdata/first.crl", "testdata/second.crl"}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergecrlsWithoutKey(t *testing.T) {
+	c := cli.Config{CAFile: "testdata/caTwo.pem", CRLExpiration: time.Hour}
+	err := mergecrlsMain([]string{"testdata/first.crl", "testdata/second.crl"}, c)
+	if err == nil {
+		t.Fatal("expected merging CRLs from one issuer without a CA key to fail")
+	}
+}
+
+func TestMergecrlsNoArgs(t *testing.T) {
+	c := cli.Config{CAFile: "testdata/caTwo.pem", CAKeyFile: "testdata/ca-keyTwo.pem"}
+	if err := mergecrlsMain(nil, c); err == nil {
+		t.Fatal("expected an error without any CRLs")
+	}
+	if err := mergecrlsMain([]string{"testdata/first.crl"}, cli.Config{}); err == nil {
+		t.Fatal("expected an error without a CA certificate")
+	}
+}
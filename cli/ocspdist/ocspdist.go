@@ -0,0 +1,307 @@
+// Package ocspdist implements the ocspdist command.
+package ocspdist
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/ocsprefresh"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// Usage text of 'cfssl ocspdist'
+var ocspdistUsageText = `cfssl ocspdist -- pre-generates the OCSP responses of all unexpired
+certificates in the cert db on a schedule, and serves them in bulk to the
+servers stapling them
+
+Usage of ocspdist:
+        cfssl ocspdist -db-config db-config -ca cert -responder cert -responder-key key [-interval 96h] [-address address] [-port port]
+        cfssl ocspdist -db-config db-config -remote remote_host [-tls-remote-ca ca] [-mutual-tls-client-cert cert -mutual-tls-client-key key] [-interval 96h] [-address address] [-port port]
+
+The responses are refreshed as with 'cfssl ocsprefresh' when ocspdist
+starts and then every half -interval, those of Must-Staple certificates
+first. The responses in the cert db are served, as of the last refresh,
+at
+
+        /responses.tar     a tarball holding the DER-encoded response of
+                           each certificate as <aki>/<serial>.der
+        /responses.ndjson  a JSON object per line and certificate, with
+                           its serial, aki, must_staple, expiry and the
+                           base64-encoded DER response
+
+Adding ?must_staple=true restricts either to Must-Staple certificates.
+Both are built once per refresh, carry an ETag and honour If-None-Match
+and If-Modified-Since, so that servers may poll them cheaply. -interval
+must be positive.
+
+Flags:
+`
+
+// Flags of 'cfssl ocspdist'
+var ocspdistFlags = []string{"address", "port", "ca", "responder", "responder-key", "db-config", "interval",
+	"remote", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
+
+// An entry is the OCSP response of a certificate, as listed in the
+// ndjson distribution.
+type entry struct {
+	Serial     string    `json:"serial"`
+	AKI        string    `json:"aki"`
+	MustStaple bool      `json:"must_staple"`
+	Expiry     time.Time `json:"expiry"`
+	Response   []byte    `json:"response"`
+}
+
+// An archiveKey names the archives served by a distribution: the file
+// served at path, holding the responses of all certificates or only of
+// the Must-Staple ones.
+type archiveKey struct {
+	path       string
+	mustStaple bool
+}
+
+// An archive is the content of a file served by a distribution, along
+// with its entity tag.
+type archive struct {
+	body []byte
+	etag string
+}
+
+// A format is the way a distribution serves responses at a path.
+type format struct {
+	contentType string
+	write       func(buf *bytes.Buffer, entries []entry, modified time.Time) error
+}
+
+// formats are the formats of the files served by a distribution, by
+// path.
+var formats = map[string]format{
+	"/responses.tar":    {"application/x-tar", writeTar},
+	"/responses.ndjson": {"application/x-ndjson", writeNDJSON},
+}
+
+// A distribution serves the OCSP responses in the cert db as of its last
+// update, in every format.
+type distribution struct {
+	sync.RWMutex
+	archives map[archiveKey]archive
+	modified time.Time
+}
+
+// update takes a new snapshot of the unexpired OCSP responses in the
+// cert db.
+func (d *distribution) update(dbAccessor certdb.Accessor) error {
+	certs, err := dbAccessor.GetUnexpiredCertificates()
+	if err != nil {
+		return err
+	}
+	mustStaple := map[string]bool{}
+	for _, certRecord := range certs {
+		cert, err := helpers.ParseCertificatePEM([]byte(certRecord.PEM))
+		if err == nil && signer.HasMustStaple(cert) {
+			mustStaple[certRecord.AKI+"/"+certRecord.Serial] = true
+		}
+	}
+
+	records, err := dbAccessor.GetUnexpiredOCSPs()
+	if err != nil {
+		return err
+	}
+	entries := make([]entry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, entry{
+			Serial:     record.Serial,
+			AKI:        record.AKI,
+			MustStaple: mustStaple[record.AKI+"/"+record.Serial],
+			Expiry:     record.Expiry,
+			Response:   []byte(record.Body),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].AKI != entries[j].AKI {
+			return entries[i].AKI < entries[j].AKI
+		}
+		return entries[i].Serial < entries[j].Serial
+	})
+
+	// HTTP dates have a resolution of a second.
+	modified := time.Now().Truncate(time.Second)
+	archives, err := buildArchives(entries, modified)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.archives = archives
+	d.modified = modified
+	return nil
+}
+
+// buildArchives writes entries in every format, once for all
+// certificates and once for the Must-Staple ones.
+func buildArchives(entries []entry, modified time.Time) (map[archiveKey]archive, error) {
+	var mustStaple []entry
+	for _, e := range entries {
+		if e.MustStaple {
+			mustStaple = append(mustStaple, e)
+		}
+	}
+
+	archives := map[archiveKey]archive{}
+	for path, f := range formats {
+		for key, selected := range map[archiveKey][]entry{
+			{path, false}: entries,
+			{path, true}:  mustStaple,
+		} {
+			var buf bytes.Buffer
+			if err := f.write(&buf, selected, modified); err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(buf.Bytes())
+			archives[key] = archive{body: buf.Bytes(), etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+		}
+	}
+	return archives, nil
+}
+
+// writeTar writes entries as a tarball holding a file per response.
+func writeTar(buf *bytes.Buffer, entries []entry, modified time.Time) error {
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:    e.AKI + "/" + e.Serial + ".der",
+			Mode:    0644,
+			Size:    int64(len(e.Response)),
+			ModTime: modified,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.Response); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeNDJSON writes entries as a JSON object per line.
+func writeNDJSON(buf *bytes.Buffer, entries []entry, _ time.Time) error {
+	enc := json.NewEncoder(buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the responses as a tarball or as ndjson.
+func (d *distribution) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, ok := formats[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	d.RLock()
+	a, modified := d.archives[archiveKey{r.URL.Path, r.URL.Query().Get("must_staple") == "true"}], d.modified
+	d.RUnlock()
+
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("ETag", a.etag)
+	http.ServeContent(w, r, r.URL.Path, modified, bytes.NewReader(a.body))
+}
+
+// refresh refreshes the responses of all unexpired certificates and
+// updates d.
+func refresh(s ocsp.Signer, dbAccessor certdb.Accessor, interval time.Duration, d *distribution) error {
+	if err := ocsprefresh.RefreshAll(s, dbAccessor, interval); err != nil {
+		return err
+	}
+	return d.update(dbAccessor)
+}
+
+// ocspdistMain is the main CLI of OCSP distribution functionality.
+func ocspdistMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.DBConfigFile == "" {
+		return errors.New("need DB config file (provide with -db-config)")
+	}
+
+	if c.Remote == "" || c.ResponderKeyFile != "" {
+		if c.ResponderFile == "" {
+			return errors.New("need responder certificate (provide with -responder)")
+		}
+
+		if c.ResponderKeyFile == "" {
+			return errors.New("need responder key (provide with -responder-key)")
+		}
+
+		if c.CAFile == "" {
+			return errors.New("need CA certificate (provide with -ca)")
+		}
+	}
+
+	if c.Interval <= 0 {
+		return errors.New("need a positive refresh interval (provide with -interval)")
+	}
+
+	s, err := ocsprefresh.SignerFromConfig(c)
+	if err != nil {
+		log.Critical("Unable to create OCSP signer: ", err)
+		return err
+	}
+
+	db, err := dbconf.DBFromConfig(c.DBConfigFile)
+	if err != nil {
+		return err
+	}
+	dbAccessor := sql.NewAccessor(db)
+
+	d := &distribution{}
+	if err = refresh(s, dbAccessor, c.Interval, d); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.Interval / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := refresh(s, dbAccessor, c.Interval, d); err != nil {
+				log.Errorf("Unable to refresh OCSP responses: %v", err)
+			}
+		}
+	}()
+
+	addr := fmt.Sprintf("%s:%d", c.Address, c.Port)
+	log.Info("Now listening on ", addr)
+	return http.ListenAndServe(addr, d)
+}
+
+// Command assembles the definition of Command 'ocspdist'
+var Command = &cli.Command{UsageText: ocspdistUsageText, Flags: ocspdistFlags, Main: ocspdistMain}
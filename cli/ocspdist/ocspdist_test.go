@@ -0,0 +1,165 @@
+package ocspdist
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
+	cfocsp "github.com/cloudflare/cfssl/ocsp"
+	"golang.org/x/crypto/ocsp"
+)
+
+func newDistribution(t *testing.T) (*distribution, certdb.CertificateRecord) {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+
+	certPEM, err := ioutil.ReadFile("../../ocsp/testdata/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certRecord := certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Expiry: time.Now().AddDate(1, 0, 0),
+		PEM:    string(certPEM),
+		Status: "good",
+	}
+	dbAccessor := sql.NewAccessor(db)
+	if err = dbAccessor.InsertCertificate(certRecord); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := cfocsp.NewSignerFromFile("../../ocsp/testdata/ca.pem", "../../ocsp/testdata/server.crt",
+		"../../ocsp/testdata/server.key", helpers.OneDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &distribution{}
+	if err = refresh(s, dbAccessor, helpers.OneDay, d); err != nil {
+		t.Fatal(err)
+	}
+	return d, certRecord
+}
+
+func get(h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestDistributionTar(t *testing.T) {
+	d, certRecord := newDistribution(t)
+
+	w := get(d, "/responses.tar", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-tar" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	tr := tar.NewReader(w.Body)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != certRecord.AKI+"/"+certRecord.Serial+".der" {
+		t.Fatalf("unexpected file %s", hdr.Name)
+	}
+	der, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ocsp.ParseResponse(der, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != ocsp.Good {
+		t.Fatal("expected cert status 'good'")
+	}
+	if _, err = tr.Next(); err != io.EOF {
+		t.Fatal("expected a single response")
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	w = get(d, "/responses.tar", http.Header{"If-Modified-Since": {d.modified.UTC().Format(http.TimeFormat)}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected a 304, got %d", w.Code)
+	}
+	w = get(d, "/responses.tar", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected a 304, got %d", w.Code)
+	}
+	if w = get(d, "/responses.tar?must_staple=true", nil); w.Header().Get("ETag") == etag {
+		t.Fatal("expected the Must-Staple tarball to have another ETag")
+	}
+}
+
+func TestInterval(t *testing.T) {
+	c := cli.Config{DBConfigFile: "db-config.json", ResponderFile: "responder.pem", ResponderKeyFile: "responder-key.pem", CAFile: "ca.pem"}
+	if err := ocspdistMain(nil, c); err == nil || !strings.Contains(err.Error(), "interval") {
+		t.Fatalf("expected a zero interval to be rejected, got %v", err)
+	}
+}
+
+func TestDistributionNDJSON(t *testing.T) {
+	d, certRecord := newDistribution(t)
+
+	w := get(d, "/responses.ndjson", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a 200, got %d", w.Code)
+	}
+	var entries []entry
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected a single response, got %d", len(entries))
+	}
+	if e := entries[0]; e.Serial != certRecord.Serial || e.AKI != certRecord.AKI || e.MustStaple {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if _, err := ocsp.ParseResponse(entries[0].Response, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test certificate isn't a Must-Staple certificate.
+	w = get(d, "/responses.ndjson?must_staple=true", nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("expected no responses, got %d: %s", w.Code, w.Body)
+	}
+
+	if w = get(d, "/responses.zip", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected a 404, got %d", w.Code)
+	}
+}
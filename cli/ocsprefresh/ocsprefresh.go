@@ -3,15 +3,23 @@ package ocsprefresh
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/ocsp"
+	ocspConfig "github.com/cloudflare/cfssl/ocsp/config"
+	"github.com/cloudflare/cfssl/ocsp/universal"
+	"github.com/cloudflare/cfssl/signer"
+
+	"github.com/lib/pq"
 )
 
 // Usage text of 'cfssl ocsprefresh'
@@ -19,13 +27,39 @@ var ocsprefreshUsageText = `cfssl ocsprefresh -- refreshes the ocsp_responses ta
 with new OCSP responses for all known unexpired certificates
 
 Usage of ocsprefresh:
-        cfssl ocsprefresh -db-config db-config -ca cert -responder cert -responder-key key [-interval 96h]
+        cfssl ocsprefresh -db-config db-config -ca cert -responder cert -responder-key key [-interval 96h] [-listen]
+        cfssl ocsprefresh -db-config db-config -ca cert -ca-key key -responder-lifetime duration [-interval 96h] -listen
+        cfssl ocsprefresh -db-config db-config -remote remote_host [-tls-remote-ca ca] [-mutual-tls-client-cert cert -mutual-tls-client-key key] [-listen]
+
+The responder key may be a file or the URI of a key held in a key
+management service. With -remote and no -responder-key, the responses
+are signed by the remote CFSSL server through its ocspsign endpoint.
+
+With -responder-lifetime instead of -responder and -responder-key, the
+responses are signed by a delegated responder certificate issued from
+the CA key, with a fresh key and the OCSP signing extended key usage,
+and valid for -responder-lifetime, which must be at least twice
+-interval. The next one is issued once a third of its lifetime is left,
+and no later than -interval before it expires. Each of them is recorded
+in the certificate database under the ocsp-responder profile. As every
+run would issue a new one, -responder-lifetime requires -listen.
+
+With -listen and a PostgreSQL certificate database, ocsprefresh keeps
+running after the refresh: the response of a certificate is regenerated
+as soon as the certificate is signed or revoked, and all responses are
+refreshed again every half -interval.
 
 Flags:
 `
 
 // Flags of 'cfssl ocsprefresh'
-var ocsprefreshFlags = []string{"ca", "responder", "responder-key", "db-config", "interval"}
+var ocsprefreshFlags = []string{"ca", "ca-key", "responder", "responder-key", "responder-lifetime", "db-config", "interval", "listen",
+	"remote", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
+
+// NotifyChannel is the PostgreSQL channel on which the trigger added by
+// migration 004_NotifyCertificateChanges.sql announces certificates
+// that are signed or revoked.
+const NotifyChannel = sql.NotifyChannel
 
 // ocsprefreshMain is the main CLI of OCSP refresh functionality.
 func ocsprefreshMain(args []string, c cli.Config) error {
@@ -33,16 +67,30 @@ func ocsprefreshMain(args []string, c cli.Config) error {
 		return errors.New("need DB config file (provide with -db-config)")
 	}
 
-	if c.ResponderFile == "" {
-		return errors.New("need responder certificate (provide with -responder)")
-	}
+	if c.ResponderFile == "" && c.ResponderLifetime != 0 {
+		if !c.Listen {
+			return errors.New("-responder-lifetime requires -listen, as each run would issue a new responder certificate")
+		}
 
-	if c.ResponderKeyFile == "" {
-		return errors.New("need responder key (provide with -responder-key)")
-	}
+		if c.CAFile == "" {
+			return errors.New("need CA certificate (provide with -ca)")
+		}
 
-	if c.CAFile == "" {
-		return errors.New("need CA certificate (provide with -ca)")
+		if c.CAKeyFile == "" {
+			return errors.New("need CA key to issue responder certificates (provide with -ca-key)")
+		}
+	} else if c.Remote == "" || c.ResponderKeyFile != "" {
+		if c.ResponderFile == "" {
+			return errors.New("need responder certificate (provide with -responder)")
+		}
+
+		if c.ResponderKeyFile == "" {
+			return errors.New("need responder key (provide with -responder-key)")
+		}
+
+		if c.CAFile == "" {
+			return errors.New("need CA certificate (provide with -ca)")
+		}
 	}
 
 	s, err := SignerFromConfig(c)
@@ -51,50 +99,164 @@ func ocsprefreshMain(args []string, c cli.Config) error {
 		return err
 	}
 
+	dbCfg, err := dbconf.LoadFile(c.DBConfigFile)
+	if err != nil {
+		return err
+	}
+	if c.Listen && dbCfg.DriverName != "postgres" {
+		return errors.New("-listen requires a PostgreSQL certificate database")
+	}
+
 	db, err := dbconf.DBFromConfig(c.DBConfigFile)
 	if err != nil {
 		return err
 	}
 
 	dbAccessor := sql.NewAccessor(db)
+	if rs, ok := s.(*ocsp.RotatingSigner); ok {
+		if err = rs.SetDBAccessor(dbAccessor); err != nil {
+			return err
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go rs.AutoRotate(stop)
+	}
+
+	if err = RefreshAll(s, dbAccessor, c.Interval); err != nil {
+		return err
+	}
+
+	if c.Listen {
+		return Listen(dbCfg.DataSourceName, s, dbAccessor, c.Interval)
+	}
+	return nil
+}
+
+// RefreshAll refreshes the OCSP responses of all unexpired certificates,
+// starting with the Must-Staple ones, whose TLS servers can't do without
+// a fresh response.
+func RefreshAll(s ocsp.Signer, dbAccessor certdb.Accessor, interval time.Duration) error {
 	certs, err := dbAccessor.GetUnexpiredCertificates()
 	if err != nil {
 		return err
 	}
-
-	// Set an expiry timestamp for all certificates refreshed in this batch
-	ocspExpiry := time.Now().Add(c.Interval)
+	var mustStaple, others []certdb.CertificateRecord
 	for _, certRecord := range certs {
 		cert, err := helpers.ParseCertificatePEM([]byte(certRecord.PEM))
-		if err != nil {
-			log.Critical("Unable to parse certificate: ", err)
-			return err
+		if err == nil && signer.HasMustStaple(cert) {
+			mustStaple = append(mustStaple, certRecord)
+		} else {
+			others = append(others, certRecord)
 		}
+	}
 
-		req := ocsp.SignRequest{
-			Certificate: cert,
-			Status:      certRecord.Status,
+	// Set an expiry timestamp for all certificates refreshed in this batch
+	ocspExpiry := time.Now().Add(interval)
+	for _, certRecord := range append(mustStaple, others...) {
+		if err = refresh(s, dbAccessor, certRecord, ocspExpiry); err != nil {
+			return err
 		}
+	}
 
-		if certRecord.Status == "revoked" {
-			req.Reason = int(certRecord.Reason)
-			req.RevokedAt = certRecord.RevokedAt
-		}
+	return nil
+}
 
-		resp, err := s.Sign(req)
-		if err != nil {
-			log.Critical("Unable to sign OCSP response: ", err)
-			return err
-		}
+// refresh signs and saves a new OCSP response for the certificate.
+func refresh(s ocsp.Signer, dbAccessor certdb.Accessor, certRecord certdb.CertificateRecord, ocspExpiry time.Time) error {
+	cert, err := helpers.ParseCertificatePEM([]byte(certRecord.PEM))
+	if err != nil {
+		log.Critical("Unable to parse certificate: ", err)
+		return err
+	}
+
+	req := ocsp.SignRequest{
+		Certificate: cert,
+		Status:      certRecord.Status,
+	}
+
+	if certRecord.Status == "revoked" {
+		req.Reason = int(certRecord.Reason)
+		req.RevokedAt = certRecord.RevokedAt
+	}
+
+	resp, err := s.Sign(req)
+	if err != nil {
+		log.Critical("Unable to sign OCSP response: ", err)
+		return err
+	}
+
+	err = dbAccessor.UpsertOCSP(cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId), string(resp), ocspExpiry)
+	if err != nil {
+		log.Critical("Unable to save OCSP response: ", err)
+		return err
+	}
+	return nil
+}
+
+// A notification is the payload of a notification on NotifyChannel.
+type notification struct {
+	Serial string `json:"serial"`
+	AKI    string `json:"aki"`
+}
+
+// refreshNotified refreshes the OCSP response of the certificate named
+// by a notification payload.
+func refreshNotified(s ocsp.Signer, dbAccessor certdb.Accessor, payload string, interval time.Duration) error {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return fmt.Errorf("malformed certificate notification %q: %v", payload, err)
+	}
+
+	certs, err := dbAccessor.GetCertificate(n.Serial, n.AKI)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificate with serial %s and AKI %s", n.Serial, n.AKI)
+	}
+	return refresh(s, dbAccessor, certs[0], time.Now().Add(interval))
+}
 
-		err = dbAccessor.UpsertOCSP(cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId), string(resp), ocspExpiry)
+// Listen refreshes the OCSP response of every certificate announced on
+// NotifyChannel by the PostgreSQL database at dataSource, and all of
+// them every half interval. Notifications sent while the connection is
+// down are lost, so all responses are also refreshed every time it is
+// re-established. Listen only returns if it cannot start listening.
+func Listen(dataSource string, s ocsp.Signer, dbAccessor certdb.Accessor, interval time.Duration) error {
+	listener := pq.NewListener(dataSource, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
 		if err != nil {
-			log.Critical("Unable to save OCSP response: ", err)
-			return err
+			log.Warningf("certificate notification listener: %v", err)
 		}
+	})
+	if err := listener.Listen(NotifyChannel); err != nil {
+		listener.Close()
+		return err
 	}
+	defer listener.Close()
+	log.Infof("Listening for certificate notifications on %s", NotifyChannel)
 
-	return nil
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnection.
+			if n == nil {
+				log.Info("Reconnected to the certificate database, refreshing all OCSP responses")
+				if err := RefreshAll(s, dbAccessor, interval); err != nil {
+					log.Errorf("Unable to refresh OCSP responses: %v", err)
+				}
+				continue
+			}
+			if err := refreshNotified(s, dbAccessor, n.Extra, interval); err != nil {
+				log.Errorf("Unable to refresh the OCSP response of a notified certificate: %v", err)
+			}
+		case <-ticker.C:
+			if err := RefreshAll(s, dbAccessor, interval); err != nil {
+				log.Errorf("Unable to refresh OCSP responses: %v", err)
+			}
+		}
+	}
 }
 
 // SignerFromConfig creates a signer from a cli.Config as a helper for cli and serve
@@ -105,7 +267,28 @@ func SignerFromConfig(c cli.Config) (ocsp.Signer, error) {
 	if k == "" {
 		k = c.KeyFile
 	}
-	return ocsp.NewSignerFromFile(c.CAFile, c.ResponderFile, k, time.Duration(c.Interval))
+	cfg := ocspConfig.Config{
+		CACertFile:        c.CAFile,
+		ResponderCertFile: c.ResponderFile,
+		KeyFile:           k,
+		Interval:          c.Interval,
+	}
+	// Without a responder certificate, delegated ones are issued from
+	// the CA key and rotated.
+	if c.ResponderFile == "" && c.ResponderLifetime != 0 && c.CAKeyFile != "" {
+		k = c.CAKeyFile
+		cfg.KeyFile = k
+		cfg.ResponderLifetime = c.ResponderLifetime
+	}
+	// Without a responder key, the responses are signed by the remote
+	// server, if any.
+	if k == "" {
+		cfg.Remote = c.Remote
+		cfg.RemoteCAFile = c.TLSRemoteCAs
+		cfg.RemoteCertFile = c.MutualTLSCertFile
+		cfg.RemoteKeyFile = c.MutualTLSKeyFile
+	}
+	return universal.NewSignerFromConfig(cfg)
 }
 
 // Command assembles the definition of Command 'ocsprefresh'
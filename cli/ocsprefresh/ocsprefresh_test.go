@@ -10,6 +10,7 @@ import (
 	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/helpers"
+	cfocsp "github.com/cloudflare/cfssl/ocsp"
 	"golang.org/x/crypto/ocsp"
 	"io/ioutil"
 )
@@ -107,3 +108,80 @@ func TestOCSPRefreshMain(t *testing.T) {
 		t.Fatal("Expected cert status 'revoked'")
 	}
 }
+
+func TestRefreshNotified(t *testing.T) {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+
+	certPEM, err := ioutil.ReadFile("../../ocsp/testdata/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certRecord := certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Expiry: time.Now().AddDate(1, 0, 0),
+		PEM:    string(certPEM),
+		Status: "revoked",
+		Reason: ocsp.KeyCompromise,
+	}
+
+	dbAccessor = sql.NewAccessor(db)
+	err = dbAccessor.InsertCertificate(certRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := cfocsp.NewSignerFromFile("../../ocsp/testdata/ca.pem", "../../ocsp/testdata/server.crt",
+		"../../ocsp/testdata/server.key", helpers.OneDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, payload := range []string{
+		"not json",
+		`{"serial": "1", "aki": "` + certRecord.AKI + `"}`,
+	} {
+		if err = refreshNotified(s, dbAccessor, payload, helpers.OneDay); err == nil {
+			t.Fatalf("expected notification %q to be rejected", payload)
+		}
+	}
+
+	payload := `{"serial": "` + certRecord.Serial + `", "aki": "` + certRecord.AKI + `"}`
+	if err = refreshNotified(s, dbAccessor, payload, helpers.OneDay); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := dbAccessor.GetOCSP(certRecord.Serial, certRecord.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatal("Expected one OCSP response")
+	}
+	resp, err := ocsp.ParseResponse([]byte(records[0].Body), nil)
+	if err != nil {
+		t.Fatal("Failed to parse OCSP response")
+	}
+	if resp.Status != ocsp.Revoked {
+		t.Fatal("Expected cert status 'revoked'")
+	}
+}
+
+func TestListenRequiresPostgres(t *testing.T) {
+	err := ocsprefreshMain([]string{}, cli.Config{
+		CAFile:           "../../ocsp/testdata/ca.pem",
+		ResponderFile:    "../../ocsp/testdata/server.crt",
+		ResponderKeyFile: "../../ocsp/testdata/server.key",
+		DBConfigFile:     "../testdata/db-config.json",
+		Interval:         helpers.OneDay,
+		Listen:           true,
+	})
+	if err == nil {
+		t.Fatal("expected -listen to be rejected for a SQLite database")
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/ocsprefresh"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/metrics"
 	"github.com/cloudflare/cfssl/ocsp"
 )
 
@@ -15,13 +23,98 @@ import (
 var ocspServerUsageText = `cfssl ocspserve -- set up an HTTP server that handles OCSP requests from either a file or directly from a database (see RFC 5019)
 
   Usage of ocspserve:
-          cfssl ocspserve [-address address] [-port port] [-responses file] [-db-config db-config]
+          cfssl ocspserve [-address address] [-port port] [-responses file] [-db-config db-config] [-ca cert -responder cert -responder-key key] [-disable-nonce] [-max-nonce-length octets] [-listen] [-metrics]
+          cfssl ocspserve [-address address] [-port port] [-responses file] [-db-config db-config] [-ca cert -ca-key key -responder-lifetime duration] [-disable-nonce] [-max-nonce-length octets] [-listen] [-metrics]
+
+  The -responses file may hold the responses of several issuers, such as
+  a whole hierarchy of intermediates: they are indexed by the key hash of
+  their issuer, so that certificates of different issuers sharing a serial
+  number are told apart. Requests about other issuers get an unauthorized
+  response, and -metrics counts the responses to each issuer under
+  cfssl_ocsp_issuer_requests_total. Nonce echoing re-signs responses for
+  the -ca issuer only, so pass -disable-nonce with such files.
+
+  OCSP requests are answered under -path, either POSTed or, for clients
+  and caches preferring GET, base64-encoded and appended to the path
+  (RFC 6960 appendix A.1). GET paths that don't decode to a request get
+  a 404.
+
+  Requests carrying an OCSP nonce (RFC 8954) are answered with a freshly
+  signed response that echoes the nonce, unless -disable-nonce is given.
+  Nonces longer than -max-nonce-length octets (32 by default) are rejected
+  as malformed. Echoing a nonce takes a responder key: -ca with either
+  -responder and -responder-key, or -ca-key and -responder-lifetime. With
+  only -responses or -db-config, the server can't sign and answers every
+  request with the stored response, without the nonce, and warns about it
+  at startup.
+
+  Sending SIGHUP reloads the -responder certificate and -responder-key;
+  the new certificate must be issued by the same CA with the OCSP signing
+  extended key usage, or the previous ones stay in use.
+
+  With -ca-key and -responder-lifetime instead of -responder and
+  -responder-key, the server issues its own delegated responder
+  certificate from the CA key, with a fresh key and the OCSP signing
+  extended key usage, valid for -responder-lifetime, which must be at
+  least twice -interval. The next one is issued once a third of its
+  lifetime is left, and no later than -interval before it expires, so
+  the CA key isn't used for every response and stapled responses never
+  outlive their responder certificate. The responder certificates are
+  recorded in the -db-config certificate database, which is required,
+  under the ocsp-responder profile.
+
+  With -listen, a PostgreSQL -db-config and the responder flags above, the
+  server also refreshes the stored responses like 'cfssl ocsprefresh -listen'.
 
   Flags:
   `
 
 // Flags used by 'cfssl serve'
-var ocspServerFlags = []string{"address", "port", "responses", "db-config"}
+var ocspServerFlags = []string{"address", "port", "responses", "db-config", "ca", "ca-key", "responder", "responder-key", "responder-lifetime", "interval", "disable-nonce", "max-nonce-length", "listen", "metrics"}
+
+// A resigner signs both the responses of the database and the responses
+// echoing request nonces.
+type resigner interface {
+	ocsp.Signer
+	ocsp.Resigner
+}
+
+// reloadOnHangup reloads the responder certificate and key of s every
+// time the process receives a SIGHUP.
+func reloadOnHangup(s *ocsp.ReloadableSigner) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Info("Reloading the OCSP responder certificate and key")
+		if err := s.Reload(); err != nil {
+			log.Errorf("Unable to reload the OCSP responder certificate and key, keeping the previous ones: %v", err)
+		}
+	}
+}
+
+// listen starts refreshing the responses in the certificate database
+// as it notifies that certificates are signed or revoked.
+func listen(c cli.Config, s ocsp.Signer) error {
+	dbCfg, err := dbconf.LoadFile(c.DBConfigFile)
+	if err != nil {
+		return err
+	}
+	if dbCfg.DriverName != "postgres" {
+		return errors.New("-listen requires a PostgreSQL certificate database")
+	}
+	db, err := dbconf.DBFromConfig(c.DBConfigFile)
+	if err != nil {
+		return err
+	}
+
+	dbAccessor := sql.NewAccessor(db)
+	go func() {
+		if err := ocsprefresh.Listen(dbCfg.DataSourceName, s, dbAccessor, c.Interval); err != nil {
+			log.Errorf("Unable to listen for certificate notifications: %v", err)
+		}
+	}()
+	return nil
+}
 
 // ocspServerMain is the command line entry point to the OCSP responder.
 // It sets up a new HTTP server that responds to OCSP requests.
@@ -50,12 +143,88 @@ func ocspServerMain(args []string, c cli.Config) error {
 		)
 	}
 
+	var s resigner
+	switch {
+	case c.CAFile != "" && c.ResponderFile != "" && c.ResponderKeyFile != "":
+		rs, err := ocsp.NewReloadableSignerFromFile(c.CAFile, c.ResponderFile, c.ResponderKeyFile, c.Interval)
+		if err != nil {
+			log.Critical("Unable to create OCSP signer: ", err)
+			return err
+		}
+		go reloadOnHangup(rs)
+		s = rs
+	case c.CAFile != "" && c.CAKeyFile != "" && c.ResponderLifetime != 0:
+		if c.DBConfigFile == "" {
+			return errors.New("-responder-lifetime requires -db-config, to record the responder certificates")
+		}
+		rs, err := ocsp.NewRotatingSignerFromFile(c.CAFile, c.CAKeyFile, c.Interval, c.ResponderLifetime)
+		if err != nil {
+			log.Critical("Unable to create OCSP signer: ", err)
+			return err
+		}
+		db, err := dbconf.DBFromConfig(c.DBConfigFile)
+		if err != nil {
+			return err
+		}
+		if err = rs.SetDBAccessor(sql.NewAccessor(db)); err != nil {
+			log.Critical("Unable to record the OCSP responder certificate: ", err)
+			return err
+		}
+		go rs.AutoRotate(nil)
+		s = rs
+	}
+
+	if c.Listen && (c.DBConfigFile == "" || s == nil) {
+		return errors.New("-listen requires -db-config, -ca and either -responder and -responder-key or -ca-key and -responder-lifetime")
+	}
+
+	if c.MaxNonceLength < 1 {
+		return errors.New("-max-nonce-length must be at least 1")
+	}
+	responder := ocsp.NewResponder(src, metrics.OCSPStats{})
+	responder.DisableNonce = c.DisableNonce
+	responder.MaxNonceLength = c.MaxNonceLength
+	if s == nil && !c.DisableNonce {
+		log.Warning("OCSP request nonces won't be echoed: that needs -ca with either -responder and -responder-key, or -ca-key and -responder-lifetime (pass -disable-nonce to silence this)")
+	}
+	if s != nil {
+		if !c.DisableNonce {
+			log.Infof("Echoing OCSP request nonces of up to %d octets", c.MaxNonceLength)
+		}
+		responder.Resigner = s
+
+		if c.Listen {
+			if err := listen(c, s); err != nil {
+				return err
+			}
+		}
+	}
+
 	log.Info("Registering OCSP responder handler")
-	http.Handle(c.Path, ocsp.NewResponder(src, nil))
+	handler := ocspHandler(c.Path, responder)
+	if c.Metrics {
+		log.Info("Registering metrics handler on /metrics")
+		serveOCSP, serveMetrics := handler, metrics.Handler()
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/metrics" {
+				serveMetrics.ServeHTTP(w, r)
+				return
+			}
+			serveOCSP.ServeHTTP(w, r)
+		})
+	}
 
 	addr := fmt.Sprintf("%s:%d", c.Address, c.Port)
 	log.Info("Now listening on ", addr)
-	return http.ListenAndServe(addr, nil)
+	return http.ListenAndServe(addr, handler)
+}
+
+// ocspHandler serves the responder under path, stripping path so that
+// only the base64-encoded request remains of the path of GET requests.
+// It is used instead of http.ServeMux, which would clean the "//" the
+// base64 encoding of a request may hold and redirect the client.
+func ocspHandler(path string, responder http.Handler) http.Handler {
+	return http.StripPrefix(strings.TrimSuffix(path, "/"), responder)
 }
 
 // Command assembles the definition of Command 'ocspserve'
@@ -2,6 +2,7 @@
 package ocspsign
 
 import (
+	"errors"
 	"io/ioutil"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/ocsp"
+	ocspConfig "github.com/cloudflare/cfssl/ocsp/config"
+	"github.com/cloudflare/cfssl/ocsp/universal"
 )
 
 // Usage text of 'cfssl ocspsign'
@@ -17,15 +20,26 @@ Returns a base64-encoded OCSP response.
 
 Usage of ocspsign:
         cfssl ocspsign -ca cert -responder cert -responder-key key -cert cert [-status status] [-reason code] [-revoked-at YYYY-MM-DD] [-interval 96h]
+        cfssl ocspsign -remote remote_host [-tls-remote-ca ca] [-mutual-tls-client-cert cert -mutual-tls-client-key key] -cert cert [-status status] [-reason code] [-revoked-at YYYY-MM-DD]
+
+The responder key may be a file or the URI of a key held in a key
+management service. With -remote and no -responder-key, the response
+is signed by the remote CFSSL server through its ocspsign endpoint.
 
 Flags:
 `
 
 // Flags of 'cfssl ocspsign'
-var ocspSignerFlags = []string{"ca", "responder", "responder-key", "reason", "status", "revoked-at", "interval"}
+var ocspSignerFlags = []string{"ca", "responder", "responder-key", "reason", "status", "revoked-at", "interval",
+	"remote", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key"}
 
 // ocspSignerMain is the main CLI of OCSP signer functionality.
 func ocspSignerMain(args []string, c cli.Config) (err error) {
+	// Each run would issue a responder certificate of its own.
+	if c.ResponderLifetime != 0 {
+		return errors.New("-responder-lifetime is only supported by long-running commands")
+	}
+
 	// Read the cert to be revoked from file
 	certBytes, err := ioutil.ReadFile(c.CertFile)
 	if err != nil {
@@ -86,7 +100,28 @@ func SignerFromConfig(c cli.Config) (ocsp.Signer, error) {
 	if k == "" {
 		k = c.KeyFile
 	}
-	return ocsp.NewSignerFromFile(c.CAFile, c.ResponderFile, k, time.Duration(c.Interval))
+	cfg := ocspConfig.Config{
+		CACertFile:        c.CAFile,
+		ResponderCertFile: c.ResponderFile,
+		KeyFile:           k,
+		Interval:          c.Interval,
+	}
+	// Without a responder certificate, delegated ones are issued from
+	// the CA key and rotated.
+	if c.ResponderFile == "" && c.ResponderLifetime != 0 && c.CAKeyFile != "" {
+		k = c.CAKeyFile
+		cfg.KeyFile = k
+		cfg.ResponderLifetime = c.ResponderLifetime
+	}
+	// Without a responder key, the responses are signed by the remote
+	// server, if any.
+	if k == "" {
+		cfg.Remote = c.Remote
+		cfg.RemoteCAFile = c.TLSRemoteCAs
+		cfg.RemoteCertFile = c.MutualTLSCertFile
+		cfg.RemoteKeyFile = c.MutualTLSKeyFile
+	}
+	return universal.NewSignerFromConfig(cfg)
 }
 
 // Command assembles the definition of Command 'ocspsign'
@@ -0,0 +1,149 @@
+// Package output writes the files output by the cfssl commands and by
+// cfssljson, so that a set of files is either written completely or left
+// as it was.
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A File is a file to write, with its contents and permissions.
+type File struct {
+	Filename string
+	Contents []byte
+	Perms    os.FileMode
+}
+
+// writeTemp writes out to a new temporary file next to its file, and
+// returns the name of the temporary file.
+func writeTemp(out File) (string, error) {
+	dir := filepath.Dir(out.Filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(out.Filename)+".*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(out.Contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), out.Perms)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// keep links the existing file filename to a second name, its name plus
+// ".bak" if backup is set or else a temporary name, so that its contents
+// survive it being replaced. It returns the second name, or "" if there
+// is no such file.
+func keep(filename string, backup bool) (string, error) {
+	if _, err := os.Lstat(filename); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	name := filename + ".bak"
+	if !backup {
+		f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.orig")
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		name = f.Name()
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := os.Link(filename, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// WriteFiles writes outs as a set. Each file is first written to a
+// temporary file in its directory, and they are only renamed into place
+// once all have been written, so that an interrupted run can't leave a
+// truncated file behind. If a file can't be renamed into place, the
+// files replaced so far are restored. With noClobber, nothing is written
+// if any of the files exists: the temporary files are linked to their
+// final names, which fails if they are taken, even by a file created
+// since the run started. With backup, the files that are replaced are
+// kept with a ".bak" suffix.
+func WriteFiles(outs []File, noClobber, backup bool) error {
+	temps := make([]string, len(outs))
+	defer func() {
+		for _, tmp := range temps {
+			if tmp != "" {
+				os.Remove(tmp)
+			}
+		}
+	}()
+	for i, out := range outs {
+		tmp, err := writeTemp(out)
+		if err != nil {
+			return err
+		}
+		temps[i] = tmp
+	}
+
+	// kept[i] names the previous contents of the file of outs[i], if
+	// it existed.
+	kept := make([]string, len(outs))
+	for i, out := range outs {
+		var err error
+		if noClobber {
+			// The temporary file is removed once linked.
+			if err = os.Link(temps[i], out.Filename); os.IsExist(err) {
+				err = fmt.Errorf("%s already exists", out.Filename)
+			}
+		} else if kept[i], err = keep(out.Filename, backup); err == nil {
+			err = os.Rename(temps[i], out.Filename)
+			if err == nil {
+				temps[i] = ""
+			}
+		}
+		if err != nil {
+			if kept[i] != "" && !backup {
+				os.Remove(kept[i])
+			}
+			rollback(outs[:i], kept[:i])
+			return err
+		}
+	}
+
+	if !backup {
+		for _, name := range kept {
+			if name != "" {
+				os.Remove(name)
+			}
+		}
+	}
+	return nil
+}
+
+// rollback restores the files of outs from the names they were kept
+// under, or removes them if they didn't exist.
+func rollback(outs []File, kept []string) {
+	for i := len(outs) - 1; i >= 0; i-- {
+		var err error
+		if kept[i] != "" {
+			err = os.Rename(kept[i], outs[i].Filename)
+		} else {
+			err = os.Remove(outs[i].Filename)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore %s: %v\n", outs[i].Filename, err)
+		}
+	}
+}
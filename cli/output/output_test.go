@@ -0,0 +1,93 @@
+package output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "tls", "server-key.pem")
+	outs := []File{
+		{Filename: certFile, Contents: []byte("CERT"), Perms: 0664},
+		{Filename: keyFile, Contents: []byte("KEY"), Perms: 0600},
+	}
+	expectFile := func(name, contents string) {
+		t.Helper()
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != contents {
+			t.Fatalf("expected %s to hold %q, got %q", name, contents, b)
+		}
+	}
+	expectFiles := func(expected ...string) {
+		t.Helper()
+		var names []string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				names = append(names, path)
+			}
+			return err
+		})
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("expected the files %v, got %v", expected, names)
+		}
+	}
+
+	if err = WriteFiles(outs, true, false); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(certFile, "CERT")
+	expectFile(keyFile, "KEY")
+	if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected key file permissions %v", fi.Mode())
+	}
+
+	outs[0].Contents, outs[1].Contents = []byte("CERT2"), []byte("KEY2")
+	if err = WriteFiles(outs, true, false); err == nil {
+		t.Fatal("expected existing files not to be overwritten with no-clobber")
+	}
+	expectFile(certFile, "CERT")
+
+	// A file written before one that already exists is removed again.
+	newFile := filepath.Join(dir, "new.pem")
+	if err = WriteFiles([]File{{Filename: newFile, Contents: []byte("NEW"), Perms: 0644}, outs[1]}, true, false); err == nil {
+		t.Fatal("expected existing files not to be overwritten with no-clobber")
+	}
+	expectFiles(certFile, keyFile)
+
+	if err = WriteFiles(outs, false, true); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(certFile, "CERT2")
+	expectFile(certFile+".bak", "CERT")
+	expectFile(keyFile+".bak", "KEY")
+
+	if err = WriteFiles(outs[:1], false, false); err != nil {
+		t.Fatal(err)
+	}
+	expectFiles(certFile, certFile+".bak", keyFile, keyFile+".bak")
+
+	// A file can't replace a directory that isn't empty: the first file
+	// is restored, and no temporary file is left.
+	blocked := filepath.Join(dir, "blocked")
+	if err = os.MkdirAll(filepath.Join(blocked, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	outs[0].Contents = []byte("CERT3")
+	if err = WriteFiles(append(outs[:1], File{Filename: blocked, Contents: []byte("X"), Perms: 0644}), false, false); err == nil {
+		t.Fatal("expected a file not to replace a directory")
+	}
+	expectFile(certFile, "CERT2")
+	expectFiles(certFile, certFile+".bak", keyFile, keyFile+".bak")
+}
@@ -0,0 +1,172 @@
+// Package p12 implements the p12 command.
+package p12
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/output"
+	"github.com/cloudflare/cfssl/crypto/pkcs12"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// Usage text of 'cfssl p12'
+var p12UsageText = `cfssl p12 -- converts between PEM files and PKCS #12
+
+Usage of p12:
+        cfssl p12 export -cert cert -key key [-ca chain] -password-file file|-no-password [-output-prefix prefix]
+        cfssl p12 import [-password-file file] [-output-prefix prefix] BUNDLE
+
+export encodes the certificate, its private key and the certificates of
+its chain into a PKCS #12 file, written to prefix.p12 or else to stdout.
+The key and certificates are encrypted with AES-256-CBC under a
+PBKDF2-HMAC-SHA256 key, and the file is protected by an HMAC-SHA256, as
+OpenSSL 3 does by default, instead of the legacy RC2 and 3DES
+encryption of earlier versions.
+
+import decodes the PKCS #12 file BUNDLE, which may also use the legacy
+algorithms, and prints the private key and the certificate followed by
+its chain as JSON, or writes them to prefix-key.pem and prefix.pem.
+BUNDLE may be "-" to read the file from stdin.
+
+The password is read from the first line of -password-file. export
+requires one, unless -no-password is given to protect the file with an
+empty password instead. import uses an empty password if no file is
+given.
+
+Flags:
+`
+
+// Flags of 'cfssl p12'
+var p12Flags = []string{"cert", "key", "ca", "password-file", "no-password", "output-prefix"}
+
+// readPassword returns the first line of the password file, or "" if
+// there is none.
+func readPassword(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		data = data[:i]
+	}
+	return string(data), nil
+}
+
+func exportMain(args []string, c cli.Config, password string) error {
+	if len(args) > 0 {
+		return errors.New("p12 export takes no arguments")
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("p12 export requires -cert and -key")
+	}
+	if c.PasswordFile == "" && !c.NoPassword {
+		return errors.New("p12 export requires a password (provide with -password-file, or use -no-password for an empty one)")
+	}
+	if c.PasswordFile != "" && c.NoPassword {
+		return errors.New("-password-file and -no-password can't be used together")
+	}
+
+	certPEM, err := ioutil.ReadFile(c.CertFile)
+	if err != nil {
+		return err
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := ioutil.ReadFile(c.KeyFile)
+	if err != nil {
+		return err
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return err
+	}
+	var caCerts []*x509.Certificate
+	if c.CAFile != "" {
+		chainPEM, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return err
+		}
+		if caCerts, err = helpers.ParseCertificatesPEM(chainPEM); err != nil {
+			return err
+		}
+	}
+
+	pfx, err := pkcs12.Encode(rand.Reader, key, cert, caCerts, password)
+	if err != nil {
+		return err
+	}
+	if c.OutputPrefix != "" {
+		return output.WriteFiles([]output.File{{Filename: c.OutputPrefix + ".p12", Contents: pfx, Perms: 0600}}, false, false)
+	}
+	_, err = os.Stdout.Write(pfx)
+	return err
+}
+
+func importMain(args []string, c cli.Config, password string) error {
+	file, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("only one PKCS #12 file can be imported")
+	}
+
+	pfx, err := cli.ReadStdin(file)
+	if err != nil {
+		return err
+	}
+	key, cert, caCerts, err := pkcs12.Decode(pfx, password)
+	if err != nil {
+		return err
+	}
+
+	var certPEM []byte
+	for _, c := range append([]*x509.Certificate{cert}, caCerts...) {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	var keyPEM []byte
+	if key != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return err
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	return cli.OutputCert(c.OutputPrefix, keyPEM, nil, certPEM)
+}
+
+// p12Main is the main CLI of the p12 command.
+func p12Main(args []string, c cli.Config) error {
+	subcommand, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(c.PasswordFile)
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "export":
+		return exportMain(args, c, password)
+	case "import":
+		return importMain(args, c, password)
+	}
+	return fmt.Errorf("unknown p12 subcommand %q", subcommand)
+}
+
+// Command assembles the definition of Command 'p12'
+var Command = &cli.Command{UsageText: p12UsageText, Flags: p12Flags, Main: p12Main}
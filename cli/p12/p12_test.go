@@ -0,0 +1,80 @@
+package p12
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func TestExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwordFile := filepath.Join(dir, "password")
+	if err = ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := cli.Config{
+		CertFile:     "../testdata/ca.pem",
+		KeyFile:      "../testdata/ca-key.pem",
+		PasswordFile: passwordFile,
+		OutputPrefix: filepath.Join(dir, "bundle"),
+	}
+	if err = p12Main([]string{"export"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.OutputPrefix = filepath.Join(dir, "imported")
+	if err = p12Main([]string{"import", filepath.Join(dir, "bundle.p12")}, c); err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ioutil.ReadFile(filepath.Join(dir, "imported.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := ioutil.ReadFile("../testdata/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := helpers.ParseCertificatePEM(certPEM)
+	originalCert, _ := helpers.ParseCertificatePEM(original)
+	if cert == nil || !cert.Equal(originalCert) {
+		t.Fatal("imported certificate doesn't match the exported one")
+	}
+	keyPEM, err := ioutil.ReadFile(filepath.Join(dir, "imported-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpers.ParsePrivateKeyPEM(keyPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	c.PasswordFile = ""
+	if err = p12Main([]string{"import", filepath.Join(dir, "bundle.p12")}, c); err == nil {
+		t.Fatal("import with the wrong password should fail")
+	}
+
+	c.OutputPrefix = filepath.Join(dir, "empty")
+	if err = p12Main([]string{"export"}, c); err == nil {
+		t.Fatal("export without a password should fail")
+	}
+	c.NoPassword = true
+	if err = p12Main([]string{"export"}, c); err != nil {
+		t.Fatal(err)
+	}
+	c.OutputPrefix = filepath.Join(dir, "imported-empty")
+	if err = p12Main([]string{"import", filepath.Join(dir, "empty.p12")}, c); err != nil {
+		t.Fatal(err)
+	}
+	if err = p12Main([]string{"convert"}, c); err == nil {
+		t.Fatal("unknown subcommand should fail")
+	}
+}
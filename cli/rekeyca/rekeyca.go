@@ -0,0 +1,85 @@
+// Package rekeyca implements the rekey-ca command.
+package rekeyca
+
+import (
+	"errors"
+
+	"github.com/cloudflare/cfssl/cli"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/initca"
+	"github.com/cloudflare/cfssl/log"
+)
+
+var rekeyCAUsageText = `cfssl rekey-ca -- issue an existing intermediate CA's subject under a new key
+
+The new certificate keeps the subject, SANs, key usages, constraints and
+other extensions of the existing certificate, and has a validity period of
+the same length starting now, capped at the parent's expiry. It is signed
+by the parent CA.
+
+Usage of rekey-ca:
+        cfssl rekey-ca -old-cert int.pem -new-key newkey.pem -parent root.pem -parent-key rootkey.pem
+
+Flags:
+`
+
+var rekeyCAFlags = []string{"old-cert", "new-key", "parent", "parent-key"}
+
+func rekeyCAMain(args []string, c cli.Config) (err error) {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.OldCertFile == "" || c.NewKeyFile == "" || c.ParentFile == "" || c.ParentKeyFile == "" {
+		log.Error("need -old-cert, -new-key, -parent and -parent-key")
+		return errors.New("need -old-cert, -new-key, -parent and -parent-key")
+	}
+
+	oldCertPEM, err := helpers.ReadBytes(c.OldCertFile)
+	if err != nil {
+		return
+	}
+	oldCert, err := helpers.ParseCertificatePEM(oldCertPEM)
+	if err != nil {
+		return
+	}
+
+	newKeyPEM, err := helpers.ReadBytes(c.NewKeyFile)
+	if err != nil {
+		return cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed, err)
+	}
+	newKey, err := helpers.ParsePrivateKeyPEM(newKeyPEM)
+	if err != nil {
+		return
+	}
+
+	parentPEM, err := helpers.ReadBytes(c.ParentFile)
+	if err != nil {
+		return
+	}
+	parent, err := helpers.ParseCertificatePEM(parentPEM)
+	if err != nil {
+		return
+	}
+
+	parentKeyPEM, err := helpers.ReadBytes(c.ParentKeyFile)
+	if err != nil {
+		return cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed, err)
+	}
+	parentKey, err := helpers.ParsePrivateKeyPEM(parentKeyPEM)
+	if err != nil {
+		return
+	}
+
+	cert, err := initca.Rekey(oldCert, newKey, parent, parentKey)
+	if err != nil {
+		return
+	}
+
+	cli.PrintCert(nil, nil, cert)
+	return nil
+}
+
+// Command assembles the definition of Command 'rekey-ca'
+var Command = &cli.Command{UsageText: rekeyCAUsageText, Flags: rekeyCAFlags, Main: rekeyCAMain}
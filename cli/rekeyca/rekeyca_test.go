@@ -0,0 +1,26 @@
+package rekeyca
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestRekeyCAMain(t *testing.T) {
+	err := rekeyCAMain([]string{}, cli.Config{
+		OldCertFile:   "../testdata/ca.pem",
+		NewKeyFile:    "../testdata/ca-key.pem",
+		ParentFile:    "../testdata/ca.pem",
+		ParentKeyFile: "../testdata/ca-key.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRekeyCAMainMissingFlags(t *testing.T) {
+	err := rekeyCAMain([]string{}, cli.Config{OldCertFile: "../testdata/ca.pem"})
+	if err == nil {
+		t.Fatal("expected an error when flags are missing")
+	}
+}
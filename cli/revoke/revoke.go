@@ -2,11 +2,21 @@
 package revoke
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/ocsp"
 )
@@ -18,24 +28,39 @@ Usage:
 Revoke a certificate:
 	   cfssl revoke -db-config config_file -serial serial -aki authority_key_id [-reason reason]
 
+Revoke the certificates of a PEM file:
+	   cfssl revoke -db-config config_file -cert cert_file [-reason reason]
+
+Revoke the certificates listed in a batch file:
+	   cfssl revoke -db-config config_file -batch batch_file [-reason reason]
+
 Reason can be an integer code or a string in ReasonFlags in RFC 5280
 
+An invalidity date, when the key of the certificates is known or suspected
+to have been compromised, can be given with -invalidity-date, as a date
+(YYYY-MM-DD) or an RFC 3339 time. It is listed in the CRLs generated with
+'cfssl crl'.
+
+The batch file is either a CSV file of serial,aki[,reason[,invalidity_date]]
+records, or a JSON array of {"serial": ..., "aki": ..., "reason": ...,
+"invalidity_date": ...} objects. Records without a reason or invalidity
+date are revoked with -reason and -invalidity-date. The certificates of
+a PEM or batch file are revoked all at once: if any of them can't be
+revoked, none is.
+
 Flags:
 `
 
-var revokeFlags = []string{"serial", "reason"}
+var revokeFlags = []string{"db-config", "serial", "aki", "cert", "batch", "reason", "invalidity-date"}
 
 func revokeMain(args []string, c cli.Config) error {
 	if len(args) > 0 {
 		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
 	}
 
-	if len(c.Serial) == 0 {
-		return errors.New("serial number is required but not provided")
-	}
-
-	if len(c.AKI) == 0 {
-		return errors.New("authority key id is required but not provided")
+	revocations, err := revocationsFromConfig(c)
+	if err != nil {
+		return err
 	}
 
 	if c.DBConfigFile == "" {
@@ -49,13 +74,202 @@ func revokeMain(args []string, c cli.Config) error {
 
 	dbAccessor := sql.NewAccessor(db)
 
+	if len(revocations) == 1 && revocations[0].InvalidityDate == nil {
+		r := revocations[0]
+		return dbAccessor.RevokeCertificate(r.Serial, r.AKI, r.Reason)
+	}
+	return dbAccessor.RevokeCertificates(revocations)
+}
+
+// revocationsFromConfig lists the certificates to revoke, named either
+// by -serial and -aki, by the certificates of -cert or by the records
+// of -batch.
+func revocationsFromConfig(c cli.Config) ([]certdb.Revocation, error) {
+	sources := 0
+	for _, set := range []bool{c.Serial != "" || c.AKI != "", c.CertFile != "", c.BatchFile != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, errors.New("only one of -serial and -aki, -cert or -batch may be provided")
+	}
+
 	reasonCode, err := ocsp.ReasonStringToCode(c.Reason)
 	if err != nil {
 		log.Error("Invalid reason code: ", err)
-		return err
+		return nil, err
+	}
+
+	invalidityDate, err := parseInvalidityDate(c.InvalidityDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var revocations []certdb.Revocation
+	switch {
+	case c.CertFile != "":
+		revocations, err = revocationsFromCertFile(c.CertFile, reasonCode)
+	case c.BatchFile != "":
+		revocations, err = revocationsFromBatchFile(c.BatchFile, reasonCode)
+	default:
+		revocations, err = revocationFromSerial(c, reasonCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range revocations {
+		if revocations[i].InvalidityDate == nil {
+			revocations[i].InvalidityDate = invalidityDate
+		}
+	}
+	return revocations, nil
+}
+
+// parseInvalidityDate parses an invalidity date given as a date or an
+// RFC 3339 time, or returns nil if s is empty.
+func parseInvalidityDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, fmt.Errorf("invalid invalidity date %q: must be YYYY-MM-DD or an RFC 3339 time", s)
+		}
+	}
+	return &t, nil
+}
+
+// revocationFromSerial names the certificate given by -serial and -aki.
+func revocationFromSerial(c cli.Config, reasonCode int) ([]certdb.Revocation, error) {
+	if len(c.Serial) == 0 {
+		return nil, errors.New("serial number is required but not provided")
+	}
+
+	if len(c.AKI) == 0 {
+		return nil, errors.New("authority key id is required but not provided")
 	}
 
-	return dbAccessor.RevokeCertificate(c.Serial, c.AKI, reasonCode)
+	return []certdb.Revocation{{Serial: c.Serial, AKI: c.AKI, Reason: reasonCode}}, nil
+}
+
+// revocationsFromCertFile names the certificates of a PEM file by their
+// serial number and authority key identifier, as recorded when they
+// were signed.
+func revocationsFromCertFile(certFile string, reasonCode int) ([]certdb.Revocation, error) {
+	certsPEM, err := helpers.ReadBytes(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := helpers.ParseCertificatesPEM(certsPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", certFile)
+	}
+
+	var revocations []certdb.Revocation
+	for _, cert := range certs {
+		if len(cert.AuthorityKeyId) == 0 {
+			return nil, fmt.Errorf("certificate with serial %s has no authority key identifier", cert.SerialNumber)
+		}
+		revocations = append(revocations, certdb.Revocation{
+			Serial: cert.SerialNumber.String(),
+			AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+			Reason: reasonCode,
+		})
+	}
+	return revocations, nil
+}
+
+// A batchRecord is a record of a JSON batch file. The reason is either
+// a reason code or its name.
+type batchRecord struct {
+	Serial         string      `json:"serial"`
+	AKI            string      `json:"aki"`
+	Reason         interface{} `json:"reason"`
+	InvalidityDate string      `json:"invalidity_date"`
+}
+
+// revocationsFromBatchFile reads the records of a CSV or JSON batch
+// file. Records without a reason are given reasonCode.
+func revocationsFromBatchFile(batchFile string, reasonCode int) ([]certdb.Revocation, error) {
+	batch, err := helpers.ReadBytes(batchFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []batchRecord
+	if bytes.HasPrefix(bytes.TrimSpace(batch), []byte("[")) {
+		if err = json.Unmarshal(batch, &records); err != nil {
+			return nil, fmt.Errorf("malformed batch file %s: %v", batchFile, err)
+		}
+	} else if records, err = readCSVBatch(bytes.NewReader(batch)); err != nil {
+		return nil, fmt.Errorf("malformed batch file %s: %v", batchFile, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no certificate listed in %s", batchFile)
+	}
+
+	var revocations []certdb.Revocation
+	for i, record := range records {
+		if record.Serial == "" || record.AKI == "" {
+			return nil, fmt.Errorf("record %d of %s: serial and aki are required", i+1, batchFile)
+		}
+
+		r := certdb.Revocation{Serial: record.Serial, AKI: record.AKI, Reason: reasonCode}
+		if record.Reason != nil {
+			reason := fmt.Sprint(record.Reason)
+			if r.Reason, err = ocsp.ReasonStringToCode(reason); err != nil {
+				return nil, fmt.Errorf("record %d of %s: invalid reason %q", i+1, batchFile, reason)
+			}
+		}
+		if r.InvalidityDate, err = parseInvalidityDate(record.InvalidityDate); err != nil {
+			return nil, fmt.Errorf("record %d of %s: %v", i+1, batchFile, err)
+		}
+		revocations = append(revocations, r)
+	}
+	return revocations, nil
+}
+
+// readCSVBatch reads serial,aki[,reason[,invalidity_date]] records,
+// skipping comments and a header line.
+func readCSVBatch(r io.Reader) ([]batchRecord, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var records []batchRecord
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) == 0 && strings.EqualFold(fields[0], "serial") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("record %v should be serial,aki[,reason[,invalidity_date]]", fields)
+		}
+
+		record := batchRecord{Serial: fields[0], AKI: fields[1]}
+		if len(fields) >= 3 && fields[2] != "" {
+			record.Reason = fields[2]
+		}
+		if len(fields) == 4 {
+			record.InvalidityDate = fields[3]
+		}
+		records = append(records, record)
+	}
 }
 
 // Command assembles the definition of Command 'revoke'
@@ -1,6 +1,10 @@
 package revoke
 
 import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -8,6 +12,7 @@ import (
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
 	"golang.org/x/crypto/ocsp"
 )
 
@@ -127,3 +132,153 @@ func TestRevokeMain(t *testing.T) {
 		t.Fatal("Expected error from missing aki")
 	}
 }
+
+func TestRevokeCert(t *testing.T) {
+	err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile("../testdata/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, aki := cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId)
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial: serial,
+		AKI:    aki,
+		Expiry: time.Now().AddDate(1, 0, 0),
+		PEM:    string(certPEM),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = revokeMain([]string{}, cli.Config{CertFile: "../testdata/ca.pem", Serial: serial, DBConfigFile: "../testdata/db-config.json"})
+	if err == nil {
+		t.Fatal("Expected error from both -cert and -serial")
+	}
+
+	err = revokeMain([]string{}, cli.Config{CertFile: "../testdata/ca.pem", Reason: "keyCompromise", DBConfigFile: "../testdata/db-config.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crs, err := dbAccessor.GetCertificate(serial, aki)
+	if err != nil {
+		t.Fatal("Failed to get certificate")
+	}
+	if len(crs) != 1 {
+		t.Fatal("Failed to get exactly one certificate")
+	}
+	if crs[0].Status != "revoked" || crs[0].Reason != ocsp.KeyCompromise {
+		t.Fatalf("Certificate not revoked for key compromise: %+v", crs[0])
+	}
+}
+
+func TestRevokeBatch(t *testing.T) {
+	err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial: "2",
+		AKI:    fakeAKI,
+		Expiry: time.Now().AddDate(1, 0, 0),
+		PEM:    "unexpired cert",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "cfssl-revoke")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	batches := map[string]string{
+		"missing.csv": "1," + fakeAKI + "\n3," + fakeAKI + "\n",
+		"batch.csv":   "# serial,aki,reason\nserial,aki,reason\n1," + fakeAKI + ",superseded\n2," + fakeAKI + "\n",
+		"batch.json":  `[{"serial": "1", "aki": "` + fakeAKI + `", "reason": 5}, {"serial": "2", "aki": "` + fakeAKI + `"}]`,
+		"bad.json":    `[{"serial": "1", "aki": "` + fakeAKI + `", "reason": "nonsense"}]`,
+	}
+	for name, batch := range batches {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(batch), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"missing.csv", "bad.json"} {
+		err = revokeMain([]string{}, cli.Config{BatchFile: filepath.Join(dir, name), DBConfigFile: "../testdata/db-config.json"})
+		if err == nil {
+			t.Fatalf("Expected error from %s", name)
+		}
+	}
+	// The failed batches must not revoke anything.
+	crs, err := dbAccessor.GetCertificate("1", fakeAKI)
+	if err != nil {
+		t.Fatal("Failed to get certificate")
+	}
+	if len(crs) != 1 || crs[0].Status == "revoked" {
+		t.Fatal("Certificate revoked by a failed batch")
+	}
+
+	tests := []struct {
+		name    string
+		reasons map[string]int
+	}{
+		{"batch.csv", map[string]int{"1": ocsp.Superseded, "2": ocsp.KeyCompromise}},
+		{"batch.json", map[string]int{"1": ocsp.CessationOfOperation, "2": ocsp.KeyCompromise}},
+	}
+	for _, test := range tests {
+		err = revokeMain([]string{}, cli.Config{BatchFile: filepath.Join(dir, test.name), Reason: "1", DBConfigFile: "../testdata/db-config.json"})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		for serial, reason := range test.reasons {
+			crs, err := dbAccessor.GetCertificate(serial, fakeAKI)
+			if err != nil {
+				t.Fatal("Failed to get certificate")
+			}
+			if len(crs) != 1 {
+				t.Fatal("Failed to get exactly one certificate")
+			}
+			if crs[0].Status != "revoked" || crs[0].Reason != reason {
+				t.Fatalf("%s: certificate %s should be revoked with reason %d, got %+v", test.name, serial, reason, crs[0])
+			}
+		}
+	}
+}
+
+func TestRevokeInvalidityDate(t *testing.T) {
+	err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = revokeMain([]string{}, cli.Config{Serial: "1", AKI: fakeAKI, InvalidityDate: "yesterday", DBConfigFile: "../testdata/db-config.json"})
+	if err == nil {
+		t.Fatal("Expected error from a malformed invalidity date")
+	}
+
+	err = revokeMain([]string{}, cli.Config{Serial: "1", AKI: fakeAKI, Reason: "keyCompromise", InvalidityDate: "2020-03-01",
+		DBConfigFile: "../testdata/db-config.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crs, err := dbAccessor.GetCertificate("1", fakeAKI)
+	if err != nil || len(crs) != 1 {
+		t.Fatal("Failed to get exactly one certificate")
+	}
+	want := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if crs[0].Status != "revoked" || crs[0].InvalidityDate == nil || !crs[0].InvalidityDate.Equal(want) {
+		t.Fatalf("certificate should be revoked with invalidity date %v, got %+v", want, crs[0])
+	}
+}
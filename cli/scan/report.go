@@ -0,0 +1,321 @@
+package scan
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/cloudflare/cfssl/scan"
+)
+
+// A hostResult holds the results of the scans of a host, or the error
+// that prevented scanning it.
+type hostResult struct {
+	Host    string
+	Results map[string]scan.FamilyResult
+	Err     error
+}
+
+// A finding is the result of a scanner on a host.
+type finding struct {
+	Family, Scanner string
+	scan.ScannerResult
+}
+
+// findings lists the results of r sorted by family and scanner name.
+func (r hostResult) findings() []finding {
+	var findings []finding
+	for family, results := range r.Results {
+		for scanner, result := range results {
+			findings = append(findings, finding{family, scanner, result})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Family != findings[j].Family {
+			return findings[i].Family < findings[j].Family
+		}
+		return findings[i].Scanner < findings[j].Scanner
+	})
+	return findings
+}
+
+// ruleID names the scanner of f as "Family/Scanner".
+func (f finding) ruleID() string {
+	return f.Family + "/" + f.Scanner
+}
+
+// description returns the description of the scanner of f.
+func (f finding) description() string {
+	if family, ok := scan.Default[f.Family]; ok {
+		if scanner, ok := family.Scanners[f.Scanner]; ok {
+			return scanner.Description
+		}
+	}
+	return f.ruleID()
+}
+
+// message describes the outcome of f, with its output as JSON.
+func (f finding) message() string {
+	msg := fmt.Sprintf("%s: %s", f.description(), f.Grade)
+	if f.Error != "" {
+		msg += " (" + f.Error + ")"
+	}
+	if f.Output != nil {
+		if out, err := json.Marshal(f.Output); err == nil {
+			msg += "\n" + string(out)
+		}
+	}
+	return msg
+}
+
+// sortResults sorts results by host.
+func sortResults(results []hostResult) {
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+}
+
+// The SARIF 2.1.0 log format, as far as it is used by writeSARIF.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+// sarifScanRule is the rule of the results reporting hosts that couldn't
+// be scanned.
+const sarifScanRule = "scan"
+
+// writeSARIF writes results as a SARIF log. Scanners grading a host Bad
+// or failing are reported as errors, and those grading it Warning as
+// warnings; good and skipped scans aren't reported.
+func writeSARIF(w io.Writer, results []hostResult) error {
+	sortResults(results)
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "cfssl scan",
+			InformationURI: "https://github.com/cloudflare/cfssl",
+			Rules:          []sarifRule{{ID: sarifScanRule, ShortDescription: sarifMessage{"The host could be scanned"}}},
+		}},
+		Results: []sarifResult{},
+	}
+
+	rules := map[string]bool{}
+	for _, r := range results {
+		var location sarifLocation
+		location.PhysicalLocation.ArtifactLocation.URI = r.Host
+
+		if r.Err != nil {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    sarifScanRule,
+				Level:     "error",
+				Message:   sarifMessage{r.Err.Error()},
+				Locations: []sarifLocation{location},
+			})
+			continue
+		}
+
+		for _, f := range r.findings() {
+			if !rules[f.ruleID()] {
+				rules[f.ruleID()] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+					ID:               f.ruleID(),
+					ShortDescription: sarifMessage{f.description()},
+				})
+			}
+
+			var level string
+			switch {
+			case f.Error != "" || f.Grade == scan.Bad.String():
+				level = "error"
+			case f.Grade == scan.Warning.String():
+				level = "warning"
+			default:
+				continue
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    f.ruleID(),
+				Level:     level,
+				Message:   sarifMessage{f.message()},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+
+	b, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// The JUnit XML report format, as far as it is used by writeJUnit.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes results as a JUnit XML report, with a test suite per
+// host and a test case per scanner. Scanners grading a host Bad fail,
+// and failing scanners are errors. Warnings pass, with the details in
+// their output.
+func writeJUnit(w io.Writer, results []hostResult) error {
+	sortResults(results)
+	var report junitTestSuites
+	for _, r := range results {
+		suite := junitTestSuite{Name: r.Host}
+		if r.Err != nil {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      "scan",
+				ClassName: r.Host,
+				Error:     &junitMessage{Message: r.Err.Error()},
+			})
+			suite.Errors++
+		}
+
+		for _, f := range r.findings() {
+			tc := junitTestCase{Name: f.Scanner, ClassName: f.Family}
+			switch {
+			case f.Error != "":
+				tc.Error = &junitMessage{Message: f.Error, Text: f.message()}
+				suite.Errors++
+			case f.Grade == scan.Bad.String():
+				tc.Failure = &junitMessage{Message: f.Grade, Text: f.message()}
+				suite.Failures++
+			case f.Grade == scan.Skipped.String():
+				tc.Skipped = &junitMessage{Message: f.Grade}
+				suite.Skipped++
+			default:
+				tc.SystemOut = f.message()
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		report.Suites = append(report.Suites, suite)
+	}
+
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, b)
+	return err
+}
+
+// The JSON report, written by writeJSONReport.
+type jsonReport struct {
+	Hosts   []jsonHostReport `json:"hosts"`
+	Summary jsonSummary      `json:"summary"`
+}
+
+type jsonHostReport struct {
+	Host    string                       `json:"host"`
+	Results map[string]scan.FamilyResult `json:"results,omitempty"`
+	Error   string                       `json:"error,omitempty"`
+}
+
+// jsonSummary counts the hosts scanned, those that couldn't be, and the
+// results of the scanners by grade, with failing scanners counted as
+// errors.
+type jsonSummary struct {
+	Hosts  int            `json:"hosts"`
+	Failed int            `json:"failed"`
+	Grades map[string]int `json:"grades"`
+	Errors int            `json:"errors"`
+}
+
+// writeJSONReport writes results as a single JSON object listing the
+// results of every host, followed by a summary.
+func writeJSONReport(w io.Writer, results []hostResult) error {
+	sortResults(results)
+	report := jsonReport{
+		Hosts:   []jsonHostReport{},
+		Summary: jsonSummary{Hosts: len(results), Grades: map[string]int{}},
+	}
+	for _, r := range results {
+		host := jsonHostReport{Host: r.Host, Results: r.Results}
+		if r.Err != nil {
+			host.Error = r.Err.Error()
+			report.Summary.Failed++
+		}
+		for _, f := range r.findings() {
+			if f.Error != "" {
+				report.Summary.Errors++
+			} else {
+				report.Summary.Grades[f.Grade]++
+			}
+		}
+		report.Hosts = append(report.Hosts, host)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/log"
@@ -15,14 +16,41 @@ import (
 
 var scanUsageText = `cfssl scan -- scan a host for issues
 Usage of scan:
-        cfssl scan [-family regexp] [-scanner regexp] [-timeout duration] [-ip IPAddr] [-num-workers num] [-max-hosts num] [-csv hosts.csv] HOST+
+        cfssl scan [-family regexp] [-scanner regexp] [-timeout duration] [-ip IPAddr] [-num-workers num] [-rate-limit num] [-max-hosts num] [-csv hosts.csv] [-targets hosts.txt] [-min-scts num] [-format json|json-report|sarif|junit] HOST+
         cfssl scan -list
 
 Arguments:
         HOST:    Host(s) to scan (including port)
+
+A HOST, or a line of the -targets file, may also be a CIDR range such as
+10.0.0.0/24 or 10.0.0.0/24:8443, for every address of the range. Blank
+lines and lines starting with # in the -targets file are ignored. At
+most -max-hosts hosts are scanned.
+
+Hosts are scanned by -num-workers workers at once, starting at most
+-rate-limit scans per second if it is set, and each scan gives up after
+-timeout.
+
+With -format json-report, sarif or junit, a single report covering all
+hosts is printed once the scans complete, instead of the results of
+each host as it is scanned. The json-report format lists the results of
+every host followed by a summary counting the hosts that couldn't be
+scanned and the results of the scanners by grade. With sarif, a SARIF
+2.1.0 log, scanners grading a host Bad are reported as errors, and those
+grading it Warning as warnings. With junit, a JUnit XML report, they are
+failures and passing test cases.
+
 Flags:
 `
-var scanFlags = []string{"list", "family", "scanner", "timeout", "ip", "ca-bundle", "num-workers", "csv", "max-hosts"}
+var scanFlags = []string{"list", "family", "scanner", "timeout", "ip", "ca-bundle", "num-workers", "rate-limit", "csv", "targets", "max-hosts", "min-scts", "format"}
+
+// reportWriters write the scan results in the formats other than JSON,
+// which is printed as each host is scanned.
+var reportWriters = map[string]func(io.Writer, []hostResult) error{
+	"json-report": writeJSONReport,
+	"sarif":       writeSARIF,
+	"junit":       writeJUnit,
+}
 
 func printJSON(v interface{}) {
 	b, err := json.MarshalIndent(v, "", "  ")
@@ -36,6 +64,11 @@ type context struct {
 	sync.WaitGroup
 	c     cli.Config
 	hosts chan string
+
+	// results collects the results of all hosts, unless they are
+	// printed as JSON.
+	resultsLock sync.Mutex
+	results     []hostResult
 }
 
 func newContext(c cli.Config, numWorkers int) *context {
@@ -52,6 +85,15 @@ func newContext(c cli.Config, numWorkers int) *context {
 
 func (ctx *context) runWorker() {
 	for host := range ctx.hosts {
+		if reportWriters[ctx.c.Format] != nil {
+			log.Infof("Scanning %s...", host)
+			results, err := scan.Default.RunScans(host, ctx.c.IP, ctx.c.Family, ctx.c.Scanner, ctx.c.Timeout)
+			ctx.resultsLock.Lock()
+			ctx.results = append(ctx.results, hostResult{Host: host, Results: results, Err: err})
+			ctx.resultsLock.Unlock()
+			continue
+		}
+
 		fmt.Printf("Scanning %s...\n", host)
 		results, err := scan.Default.RunScans(host, ctx.c.IP, ctx.c.Family, ctx.c.Scanner, ctx.c.Timeout)
 		fmt.Printf("=== %s ===\n", host)
@@ -88,33 +130,58 @@ func scanMain(args []string, c cli.Config) (err error) {
 	if c.List {
 		printJSON(scan.Default)
 	} else {
+		writeReport := reportWriters[c.Format]
+		if writeReport == nil && c.Format != "" && c.Format != "json" {
+			return fmt.Errorf("unknown scan output format %q", c.Format)
+		}
+
 		if err = scan.LoadRootCAs(c.CABundleFile); err != nil {
 			return
 		}
+		scan.MinSCTs = c.MinSCTs
 
-		if len(args) >= c.MaxHosts {
-			log.Warningf("Only scanning max-hosts=%d out of %d args given", c.MaxHosts, len(args))
-			args = args[:c.MaxHosts]
-		} else if c.CSVFile != "" {
-			args, err = parseCSV(args, c.CSVFile, c.MaxHosts)
-			if err != nil {
+		targets := args
+		if c.CSVFile != "" {
+			if targets, err = parseCSV(targets, c.CSVFile, c.MaxHosts); err != nil {
 				return
 			}
 		}
-
-		ctx := newContext(c, c.NumWorkers)
-		// Execute for each HOST argument given
-		for len(args) > 0 {
-			var host string
-			host, args, err = cli.PopFirstArgument(args)
-			if err != nil {
+		if c.TargetsFile != "" {
+			var fileTargets []string
+			if fileTargets, err = readTargets(c.TargetsFile); err != nil {
 				return
 			}
+			targets = append(targets, fileTargets...)
+		}
+		var hosts []string
+		var truncated bool
+		if hosts, truncated, err = expandTargets(targets, c.MaxHosts); err != nil {
+			return
+		}
+		if truncated {
+			log.Warningf("Only scanning the first max-hosts=%d hosts", c.MaxHosts)
+		}
 
+		var rateLimit <-chan time.Time
+		if c.RateLimit > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / c.RateLimit))
+			defer ticker.Stop()
+			rateLimit = ticker.C
+		}
+
+		ctx := newContext(c, c.NumWorkers)
+		for i, host := range hosts {
+			if rateLimit != nil && i > 0 {
+				<-rateLimit
+			}
 			ctx.hosts <- host
 		}
 		close(ctx.hosts)
 		ctx.Wait()
+
+		if writeReport != nil {
+			return writeReport(os.Stdout, ctx.results)
+		}
 	}
 	return
 }
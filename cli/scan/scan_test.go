@@ -1,9 +1,15 @@
 package scan
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/scan"
 )
 
 var hosts = []string{"www.cloudflare.com", "google.com"}
@@ -19,3 +25,104 @@ func TestScanMain(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func testResults() []hostResult {
+	return []hostResult{
+		{
+			Host: "good.example.com:443",
+			Results: map[string]scan.FamilyResult{
+				"PKI": {
+					"ChainExpiration": {Grade: "Bad", Output: "2020-01-01T00:00:00Z"},
+					"MultipleCerts":   {Grade: "Good"},
+				},
+				"TLSHandshake": {
+					"CipherSuite": {Grade: "Warning", Output: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+				},
+				"Broad": {
+					"IntermediateCAs": {Grade: "Skipped"},
+				},
+			},
+		},
+		{Host: "down.example.com:443", Err: errors.New("connection refused")},
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, testResults()); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log %s", buf.Bytes())
+	}
+
+	var got []string
+	for _, r := range log.Runs[0].Results {
+		got = append(got, r.Locations[0].PhysicalLocation.ArtifactLocation.URI+" "+r.RuleID+" "+r.Level)
+	}
+	expected := []string{
+		"down.example.com:443 scan error",
+		"good.example.com:443 PKI/ChainExpiration error",
+		"good.example.com:443 TLSHandshake/CipherSuite warning",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected results %v, got %v", expected, got)
+	}
+	if len(log.Runs[0].Tool.Driver.Rules) != 5 {
+		t.Fatalf("expected 5 rules, got %+v", log.Runs[0].Tool.Driver.Rules)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, testResults()); err != nil {
+		t.Fatal(err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Suites) != 2 {
+		t.Fatalf("expected 2 test suites, got %s", buf.Bytes())
+	}
+
+	down, good := report.Suites[0], report.Suites[1]
+	if down.Name != "down.example.com:443" || down.Tests != 1 || down.Errors != 1 {
+		t.Fatalf("unexpected test suite %+v", down)
+	}
+	if good.Tests != 4 || good.Failures != 1 || good.Errors != 0 || good.Skipped != 1 {
+		t.Fatalf("unexpected test suite %+v", good)
+	}
+	if tc := good.Cases[1]; tc.ClassName != "PKI" || tc.Name != "ChainExpiration" || tc.Failure == nil {
+		t.Fatalf("unexpected test case %+v", tc)
+	}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, testResults()); err != nil {
+		t.Fatal(err)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Hosts) != 2 || report.Hosts[0].Host != "down.example.com:443" || report.Hosts[0].Error != "connection refused" {
+		t.Fatalf("unexpected hosts in report %s", buf.Bytes())
+	}
+	expected := jsonSummary{
+		Hosts:  2,
+		Failed: 1,
+		Grades: map[string]int{"Bad": 1, "Good": 1, "Warning": 1, "Skipped": 1},
+	}
+	if !reflect.DeepEqual(report.Summary, expected) {
+		t.Fatalf("expected summary %+v, got %+v", expected, report.Summary)
+	}
+}
@@ -0,0 +1,117 @@
+package scan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+)
+
+// readTargets reads the targets listed in file, one per line. Blank lines
+// and lines starting with # are ignored.
+func readTargets(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, s.Err()
+}
+
+// splitCIDR splits a target naming a CIDR range, such as "10.0.0.0/24",
+// "10.0.0.0/24:8443" or "[2001:db8::/120]:8443", into the range and the
+// port, which may be empty. ok is false if the target isn't a range.
+func splitCIDR(target string) (cidr, port string, ok bool) {
+	if strings.HasPrefix(target, "[") {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil || !strings.Contains(host, "/") {
+			return "", "", false
+		}
+		return host, port, true
+	}
+
+	slash := strings.Index(target, "/")
+	if slash < 0 {
+		return "", "", false
+	}
+	if colon := strings.Index(target[slash:], ":"); colon >= 0 {
+		return target[:slash+colon], target[slash+colon+1:], true
+	}
+	return target, "", true
+}
+
+// expandCIDR returns the addresses of the range cidr, with port if it
+// isn't empty, up to max of them. The network and broadcast addresses of
+// IPv4 ranges larger than /31 are left out.
+func expandCIDR(cidr, port string, max int) ([]string, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	ip = ip.Mask(ipNet.Mask)
+
+	ones, bits := ipNet.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	first, last := big.NewInt(0), new(big.Int).Sub(size, big.NewInt(1))
+	if bits == 8*net.IPv4len && bits-ones > 1 {
+		first.SetInt64(1)
+		last.Sub(last, big.NewInt(1))
+	}
+
+	base := new(big.Int).SetBytes(ip)
+	var hosts []string
+	for i := first; i.Cmp(last) <= 0 && len(hosts) < max; i.Add(i, big.NewInt(1)) {
+		b := new(big.Int).Add(base, i).Bytes()
+		addr := make(net.IP, len(ip))
+		copy(addr[len(addr)-len(b):], b)
+		host := addr.String()
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// expandTargets returns the hosts named by targets, with CIDR ranges
+// expanded, up to max of them. truncated is set if there were more.
+func expandTargets(targets []string, max int) (hosts []string, truncated bool, err error) {
+	for _, target := range targets {
+		if len(hosts) >= max {
+			return hosts, true, nil
+		}
+		cidr, port, ok := splitCIDR(target)
+		if !ok {
+			hosts = append(hosts, target)
+			continue
+		}
+		if port != "" && strings.Trim(port, "0123456789") != "" {
+			return nil, false, errors.New("invalid port in scan target " + target)
+		}
+		expanded, err := expandCIDR(cidr, port, max-len(hosts)+1)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid scan target %s: %v", target, err)
+		}
+		if len(hosts)+len(expanded) > max {
+			return append(hosts, expanded[:max-len(hosts)]...), true, nil
+		}
+		hosts = append(hosts, expanded...)
+	}
+	return hosts, false, nil
+}
@@ -0,0 +1,59 @@
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExpandTargets(t *testing.T) {
+	for _, tc := range []struct {
+		targets   []string
+		max       int
+		hosts     []string
+		truncated bool
+	}{
+		{[]string{"example.com", "example.org:8443"}, 10, []string{"example.com", "example.org:8443"}, false},
+		{[]string{"10.0.0.0/30"}, 10, []string{"10.0.0.1", "10.0.0.2"}, false},
+		{[]string{"10.0.0.8/31:8443"}, 10, []string{"10.0.0.8:8443", "10.0.0.9:8443"}, false},
+		{[]string{"10.0.0.1/32"}, 10, []string{"10.0.0.1"}, false},
+		{[]string{"[2001:db8::/127]:443"}, 10, []string{"[2001:db8::]:443", "[2001:db8::1]:443"}, false},
+		{[]string{"2001:db8::fe/127"}, 10, []string{"2001:db8::fe", "2001:db8::ff"}, false},
+		{[]string{"example.com", "10.0.0.0/24"}, 3, []string{"example.com", "10.0.0.1", "10.0.0.2"}, true},
+		{[]string{"10.0.0.0/29", "example.com"}, 7, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "example.com"}, false},
+		{[]string{"10.0.0.0/29", "example.com"}, 2, []string{"10.0.0.1", "10.0.0.2"}, true},
+	} {
+		hosts, truncated, err := expandTargets(tc.targets, tc.max)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.targets, err)
+		}
+		if !reflect.DeepEqual(hosts, tc.hosts) || truncated != tc.truncated {
+			t.Errorf("%v: expected %v (truncated %v), got %v (truncated %v)", tc.targets, tc.hosts, tc.truncated, hosts, truncated)
+		}
+	}
+
+	for _, target := range []string{"10.0.0.0/33", "10.0.0.0/24:https", "example.com/24"} {
+		if _, _, err := expandTargets([]string{target}, 10); err == nil {
+			t.Errorf("expected target %s to be rejected", target)
+		}
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	f, err := ioutil.TempFile("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# web servers\nexample.com\n\n  10.0.0.0/30:8443  \n")
+	f.Close()
+
+	targets, err := readTargets(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"example.com", "10.0.0.0/30:8443"}; !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected targets %v, got %v", expected, targets)
+	}
+}
@@ -0,0 +1,96 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+)
+
+// sdListenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+const sdListenFDsStart = 3
+
+// activatedListener returns the listener passed by systemd socket
+// activation, or nil if the process wasn't started that way. The
+// environment variables describing the sockets are cleared so that child
+// processes don't inherit them.
+func activatedListener() (net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		log.Warningf("%d sockets passed by systemd, only the first is used", n)
+	}
+
+	f := os.NewFile(sdListenFDsStart, "LISTEN_FD_3")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listen returns the listener the server accepts connections on: the one
+// passed by systemd socket activation if any, or else a new one on addr,
+// set up with SO_REUSEPORT if reusePort is true so that another server
+// may already be, or later be, listening on the same address.
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	ln, err := activatedListener()
+	if err != nil {
+		return nil, err
+	}
+	if ln != nil {
+		log.Info("Using the socket passed by systemd")
+		return ln, nil
+	}
+
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// serve serves server on ln, with TLS if useTLS is true, until a signal
+// is received on stop. The server then stops accepting connections and
+// waits up to timeout for the requests in flight to complete.
+func serve(server *http.Server, ln net.Listener, useTLS bool, stop <-chan os.Signal, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		if useTLS {
+			errc <- server.ServeTLS(ln, conf.TLSCertFile, conf.TLSKeyFile)
+		} else {
+			errc <- server.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-stop:
+		log.Infof("Received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Info("Server shut down")
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !mips && !mipsle && !mips64 && !mips64le
+// +build !mips,!mipsle,!mips64,!mips64le
+
+package serve
+
+// soReusePort is SO_REUSEPORT, which the syscall package doesn't define
+// on Linux.
+const soReusePort = 0xf
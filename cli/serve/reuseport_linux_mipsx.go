@@ -0,0 +1,9 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package serve
+
+// soReusePort is SO_REUSEPORT, which the syscall package doesn't define
+// on Linux.
+const soReusePort = 0x200
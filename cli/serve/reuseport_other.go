@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package serve
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl fails: SO_REUSEPORT isn't supported on this platform.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("-reuseport is not supported on this platform")
+}
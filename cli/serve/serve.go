@@ -9,15 +9,20 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 
 	rice "github.com/GeertJohan/go.rice"
+	"github.com/cloudflare/cfssl/acme"
 	"github.com/cloudflare/cfssl/api"
 	"github.com/cloudflare/cfssl/api/bundle"
+	"github.com/cloudflare/cfssl/api/certificates"
 	"github.com/cloudflare/cfssl/api/certinfo"
 	"github.com/cloudflare/cfssl/api/crl"
+	apievents "github.com/cloudflare/cfssl/api/events"
 	"github.com/cloudflare/cfssl/api/gencrl"
 	"github.com/cloudflare/cfssl/api/generator"
 	"github.com/cloudflare/cfssl/api/health"
@@ -27,6 +32,7 @@ import (
 	"github.com/cloudflare/cfssl/api/revoke"
 	"github.com/cloudflare/cfssl/api/scan"
 	"github.com/cloudflare/cfssl/api/signhandler"
+	apitsa "github.com/cloudflare/cfssl/api/tsa"
 	"github.com/cloudflare/cfssl/bundler"
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	certsql "github.com/cloudflare/cfssl/certdb/sql"
@@ -35,8 +41,10 @@ import (
 	"github.com/cloudflare/cfssl/cli/sign"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/metrics"
 	"github.com/cloudflare/cfssl/ocsp"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/tsa"
 	"github.com/cloudflare/cfssl/ubiquity"
 
 	"github.com/jmoiron/sqlx"
@@ -49,23 +57,53 @@ Usage of serve:
         cfssl serve [-address address] [-min-tls-version version] [-ca cert] [-ca-bundle bundle] \
                     [-ca-key key] [-int-bundle bundle] [-int-dir dir] [-port port] \
                     [-metadata file] [-remote remote_host] [-config config] \
-                    [-responder cert] [-responder-key key] \
+                    [-responder cert] [-responder-key key] [-responder-lifetime duration] \
+                    [-tsa-cert cert] [-tsa-key key] [-tsa-policy oid] \
                     [-tls-cert cert] [-tls-key key] [-mutual-tls-ca ca] [-mutual-tls-cn regex] \
                     [-tls-remote-ca ca] [-mutual-tls-client-cert cert] [-mutual-tls-client-key key] \
-                    [-db-config db-config] [-disable endpoint[,endpoint]]
+                    [-db-config db-config] [-audit-log file] [-expiry duration] [-crl-refresh duration] \
+                    [-disable endpoint[,endpoint]] [-metrics] [-reuseport] [-shutdown-timeout duration] \
+                    [-acme] [-acme-profile profile]
+
+On SIGTERM or SIGINT, the server stops accepting connections, waits up to
+-shutdown-timeout for the requests in flight and the orders placed by
+asynchronous sign requests to complete, and closes the cert db. Orders are
+kept in memory only, so those not signed by then are lost. To upgrade the
+server without refusing connections, either start it with systemd socket
+activation, in which case it serves the socket passed by systemd instead
+of listening on -address and -port, or start the new server with
+-reuseport next to the old one, also started with -reuseport, before
+sending SIGTERM to the old one.
+
+Without -responder, -responder-lifetime makes the ocspsign endpoint sign
+with delegated responder certificates it issues from -ca-key and rotates
+before they expire. They are recorded in the cert db, which -db-config
+must give, under the ocsp-responder profile.
+
+With -audit-log, every certificate issued by the local signer and every
+sign request refused by its signing policy is appended to the file as a
+line of JSON. Requests signed by a -remote server are audited there.
+
+With -acme, an ACME (RFC 8555) server on /acme/ issues certificates
+through the signer under -acme-profile, which may neither require an
+auth key nor issue CA certificates. Its accounts and orders are kept in
+memory; the certificates are recorded in the cert db, labelled with
+the account that ordered them.
 
 Flags:
 `
 
 // Flags used by 'cfssl serve'
 var serverFlags = []string{"address", "port", "min-tls-version", "ca", "ca-key", "ca-bundle", "int-bundle", "int-dir",
-	"metadata", "remote", "config", "responder", "responder-key", "tls-key", "tls-cert", "mutual-tls-ca",
-	"mutual-tls-cn", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key", "db-config", "disable"}
+	"metadata", "remote", "config", "responder", "responder-key", "responder-lifetime", "tsa-cert", "tsa-key", "tsa-policy", "tls-key", "tls-cert", "mutual-tls-ca",
+	"mutual-tls-cn", "tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key", "db-config", "audit-log", "expiry", "crl-refresh",
+	"disable", "metrics", "reuseport", "shutdown-timeout", "acme", "acme-profile"}
 
 var (
 	conf       cli.Config
 	s          signer.Signer
 	ocspSigner ocsp.Signer
+	tsaSigner  *tsa.Signer
 	db         *sqlx.DB
 )
 
@@ -116,6 +154,8 @@ var staticBox = &httpBox{
 
 var errBadSigner = errors.New("signer not initialized")
 var errNoCertDBConfigured = errors.New("cert db not configured (missing -db-config)")
+var errMetricsDisabled = errors.New("metrics not enabled (missing -metrics)")
+var errACMEDisabled = errors.New("ACME server not enabled (missing -acme)")
 
 var endpoints = map[string]func() (http.Handler, error){
 	"sign": func() (http.Handler, error) {
@@ -158,6 +198,20 @@ var endpoints = map[string]func() (http.Handler, error){
 		return h, nil
 	},
 
+	"bulk_sign": func() (http.Handler, error) {
+		if s == nil {
+			return nil, errBadSigner
+		}
+		return signhandler.NewBulkHandlerFromSigner(s)
+	},
+
+	"order/": func() (http.Handler, error) {
+		if s == nil {
+			return nil, errBadSigner
+		}
+		return signhandler.NewOrderHandler(), nil
+	},
+
 	"info": func() (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
@@ -177,6 +231,19 @@ var endpoints = map[string]func() (http.Handler, error){
 		return crl.NewHandler(certsql.NewAccessor(db), conf.CAFile, conf.CAKeyFile)
 	},
 
+	"/crl/": func() (http.Handler, error) {
+		if s == nil {
+			return nil, errBadSigner
+		}
+
+		if db == nil {
+			return nil, errNoCertDBConfigured
+		}
+
+		return crl.NewDistributionHandler(certsql.NewAccessor(db), conf.CAFile, conf.CAKeyFile,
+			conf.CRLExpiration, conf.CRLRefresh)
+	},
+
 	"gencrl": func() (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
@@ -226,6 +293,20 @@ var endpoints = map[string]func() (http.Handler, error){
 		return certinfo.NewHandler(), nil
 	},
 
+	"certificates": func() (http.Handler, error) {
+		if db == nil {
+			return nil, errNoCertDBConfigured
+		}
+		return certificates.NewHandler(certsql.NewAccessor(db)), nil
+	},
+
+	"events": func() (http.Handler, error) {
+		if conf.CFG == nil || conf.CFG.EventsProvider == nil {
+			return nil, errors.New("no events_auth_key configured")
+		}
+		return apievents.NewHandler(conf.CFG.EventsProvider), nil
+	},
+
 	"ocspsign": func() (http.Handler, error) {
 		if ocspSigner == nil {
 			return nil, errBadSigner
@@ -233,6 +314,13 @@ var endpoints = map[string]func() (http.Handler, error){
 		return apiocsp.NewHandler(ocspSigner), nil
 	},
 
+	"tsa": func() (http.Handler, error) {
+		if tsaSigner == nil {
+			return nil, errBadSigner
+		}
+		return apitsa.NewHandler(tsaSigner), nil
+	},
+
 	"revoke": func() (http.Handler, error) {
 		if db == nil {
 			return nil, errNoCertDBConfigured
@@ -251,6 +339,60 @@ var endpoints = map[string]func() (http.Handler, error){
 	"health": func() (http.Handler, error) {
 		return health.NewHealthCheck(), nil
 	},
+
+	"/healthz": func() (http.Handler, error) {
+		return health.NewHealthCheck(), nil
+	},
+
+	"/readyz": func() (http.Handler, error) {
+		return health.NewReadinessCheck(readinessChecks()...), nil
+	},
+
+	"/metrics": func() (http.Handler, error) {
+		if !conf.Metrics {
+			return nil, errMetricsDisabled
+		}
+		return metrics.Handler(), nil
+	},
+
+	"/acme/": func() (http.Handler, error) {
+		if !conf.ACME {
+			return nil, errACMEDisabled
+		}
+		if s == nil {
+			return nil, errBadSigner
+		}
+		return acme.NewServer(s, conf.ACMEProfile, "/acme/")
+	},
+}
+
+// readinessChecks returns the checks behind /readyz: the signer (and so
+// the CA key) is loaded, its signing policy is valid, and the cert db
+// answers if one is configured.
+func readinessChecks() []health.ReadinessCheck {
+	return []health.ReadinessCheck{
+		{Name: "ca_key", Check: func() error {
+			if s == nil {
+				return errBadSigner
+			}
+			return nil
+		}},
+		{Name: "config", Check: func() error {
+			if conf.ConfigFile != "" && conf.CFG == nil {
+				return errors.New("configuration file not loaded")
+			}
+			if s != nil && s.Policy() != nil && !s.Policy().Valid() {
+				return errors.New("signing policy is invalid")
+			}
+			return nil
+		}},
+		{Name: "db", Check: func() error {
+			if db == nil {
+				return nil
+			}
+			return db.Ping()
+		}},
+	}
 }
 
 // registerHandlers instantiates various handlers and associate them to corresponding endpoints.
@@ -270,6 +412,9 @@ func registerHandlers() {
 		} else if handler, err := getHandler(); err != nil {
 			log.Warningf("endpoint '%s' is disabled: %v", path, err)
 		} else {
+			if conf.Metrics {
+				handler = metrics.InstrumentHandler(path, handler)
+			}
 			if path, handler, err = wrapHandler(path, handler, err); err != nil {
 				log.Warningf("endpoint '%s' is disabled by wrapper: %v", path, err)
 			} else {
@@ -278,9 +423,23 @@ func registerHandlers() {
 			}
 		}
 	}
+	if conf.Metrics {
+		metrics.SetSignerUp(signerUp)
+	}
 	log.Info("Handler set up complete.")
 }
 
+// signerUp is 1 if the readiness checks of the signer pass, and 0
+// otherwise.
+func signerUp() float64 {
+	for _, check := range readinessChecks() {
+		if check.Name != "db" && check.Check() != nil {
+			return 0
+		}
+	}
+	return 1
+}
+
 // serverMain is the command line entry point to the API server. It sets up a
 // new HTTP server to handle sign, bundle, and validate requests.
 func serverMain(args []string, c cli.Config) error {
@@ -302,6 +461,21 @@ func serverMain(args []string, c cli.Config) error {
 		if err != nil {
 			return err
 		}
+		// On PostgreSQL, the certificates signed and revoked by every
+		// process sharing the cert db are announced by the database.
+		if db.DriverName() == "postgres" {
+			dbCfg, err := dbconf.LoadFile(c.DBConfigFile)
+			if err != nil {
+				return err
+			}
+			stopEvents := make(chan struct{})
+			defer close(stopEvents)
+			go func() {
+				if err := certsql.RelayCertificateEvents(dbCfg.DataSourceName, certsql.NewAccessor(db), stopEvents); err != nil {
+					log.Warningf("couldn't relay certificate events: %v", err)
+				}
+			}()
+		}
 	}
 
 	log.Info("Initializing signer")
@@ -313,6 +487,27 @@ func serverMain(args []string, c cli.Config) error {
 	if ocspSigner, err = ocspsign.SignerFromConfig(c); err != nil {
 		log.Warningf("couldn't initialize ocsp signer: %v", err)
 	}
+	if rs, ok := ocspSigner.(*ocsp.RotatingSigner); ok {
+		// The responder certificates are recorded, and rotated for as
+		// long as the server runs.
+		if db == nil {
+			log.Warning("couldn't initialize ocsp signer: -responder-lifetime requires -db-config")
+			ocspSigner = nil
+		} else if err = rs.SetDBAccessor(certsql.NewAccessor(db)); err != nil {
+			log.Warningf("couldn't record the ocsp responder certificate: %v", err)
+			ocspSigner = nil
+		} else {
+			stopRotation := make(chan struct{})
+			defer close(stopRotation)
+			go rs.AutoRotate(stopRotation)
+		}
+	}
+
+	if c.TSACertFile != "" {
+		if tsaSigner, err = tsa.NewSignerFromFile(c.TSACertFile, c.TSAKeyFile, c.TSAPolicy); err != nil {
+			log.Warningf("couldn't initialize tsa signer: %v", err)
+		}
+	}
 
 	registerHandlers()
 
@@ -322,12 +517,15 @@ func serverMain(args []string, c cli.Config) error {
 	if conf.MinTLSVersion != "" {
 		tlscfg.MinVersion = helpers.StringTLSVersion(conf.MinTLSVersion)
 	}
-
-	if conf.TLSCertFile == "" || conf.TLSKeyFile == "" {
-		log.Info("Now listening on ", addr)
-		return http.ListenAndServe(addr, nil)
+	server := &http.Server{
+		Addr:      addr,
+		TLSConfig: &tlscfg,
 	}
-	if conf.MutualTLSCAFile != "" {
+	// Event streams never end by themselves.
+	server.RegisterOnShutdown(apievents.CloseStreams)
+
+	useTLS := conf.TLSCertFile != "" && conf.TLSKeyFile != ""
+	if useTLS && conf.MutualTLSCAFile != "" {
 		clientPool, err := helpers.LoadPEMCertPool(conf.MutualTLSCAFile)
 		if err != nil {
 			return fmt.Errorf("failed to load mutual TLS CA file: %s", err)
@@ -336,11 +534,6 @@ func serverMain(args []string, c cli.Config) error {
 		tlscfg.ClientAuth = tls.RequireAndVerifyClientCert
 		tlscfg.ClientCAs = clientPool
 
-		server := http.Server{
-			Addr:      addr,
-			TLSConfig: &tlscfg,
-		}
-
 		if conf.MutualTLSCNRegex != "" {
 			log.Debugf(`Requiring CN matches regex "%s" for client connections`, conf.MutualTLSCNRegex)
 			re, err := regexp.Compile(conf.MutualTLSCNRegex)
@@ -359,16 +552,36 @@ func serverMain(args []string, c cli.Config) error {
 				http.Error(w, "Invalid CN", http.StatusForbidden)
 			})
 		}
-		log.Info("Now listening with mutual TLS on https://", addr)
-		return server.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile)
 	}
-	log.Info("Now listening on https://", addr)
-	server := http.Server{
-		Addr:      addr,
-		TLSConfig: &tlscfg,
+
+	ln, err := listen(addr, conf.ReusePort)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !useTLS:
+		log.Info("Now listening on ", ln.Addr())
+	case conf.MutualTLSCAFile != "":
+		log.Info("Now listening with mutual TLS on https://", ln.Addr())
+	default:
+		log.Info("Now listening on https://", ln.Addr())
 	}
-	return server.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile)
 
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(stop)
+	err = serve(server, ln, useTLS, stop, conf.ShutdownTimeout)
+	// The orders placed by asynchronous sign requests are signed before
+	// the cert db they are recorded in is closed.
+	if derr := signhandler.DrainOrders(conf.ShutdownTimeout); derr != nil {
+		log.Warningf("closing the cert db with orders pending: %v", derr)
+	}
+	if db != nil {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
 // Command assembles the definition of Command 'serve'
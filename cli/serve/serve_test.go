@@ -1,10 +1,14 @@
 package serve
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/cloudflare/cfssl/cli"
 )
@@ -35,12 +39,20 @@ func TestServe(t *testing.T) {
 	// Disabled endpoints should return '404 Not Found'
 	expected[v1APIPath("sign")] = http.StatusNotFound
 	expected[v1APIPath("authsign")] = http.StatusNotFound
+	expected[v1APIPath("bulk_sign")] = http.StatusNotFound
+	expected[v1APIPath("order/")] = http.StatusNotFound
 	expected[v1APIPath("newcert")] = http.StatusNotFound
 	expected[v1APIPath("info")] = http.StatusNotFound
 	expected[v1APIPath("ocspsign")] = http.StatusNotFound
 	expected[v1APIPath("crl")] = http.StatusNotFound
 	expected[v1APIPath("gencrl")] = http.StatusNotFound
+	expected["/crl/"] = http.StatusNotFound
 	expected[v1APIPath("revoke")] = http.StatusNotFound
+	expected[v1APIPath("certificates")] = http.StatusNotFound
+	expected[v1APIPath("events")] = http.StatusNotFound
+	expected[v1APIPath("tsa")] = http.StatusNotFound
+	expected["/metrics"] = http.StatusNotFound
+	expected["/acme/"] = http.StatusNotFound
 
 	// Enabled endpoints should return '405 Method Not Allowed'
 	expected[v1APIPath("init_ca")] = http.StatusMethodNotAllowed
@@ -55,6 +67,9 @@ func TestServe(t *testing.T) {
 	expected["/scan"] = http.StatusOK
 	expected["/bundle"] = http.StatusOK
 
+	// Readiness fails without a signer
+	expected["/readyz"] = http.StatusServiceUnavailable
+
 	// Non-existent endpoints should return '404 Not Found'
 	expected["/bad_endpoint"] = http.StatusNotFound
 
@@ -74,3 +89,106 @@ func TestServe(t *testing.T) {
 		t.Fatalf("There should be an error for argument")
 	}
 }
+
+func TestMetricsEndpoint(t *testing.T) {
+	conf.Metrics = true
+	defer func() { conf.Metrics = false }()
+
+	handler, err := endpoints["/metrics"]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Labelled metrics are only exposed once they have a series, so
+	// only the unlabelled ones are always there.
+	for _, name := range []string{
+		"cfssl_sign_duration_seconds",
+		"cfssl_crl_generations_total",
+		"cfssl_ocsp_response_age_seconds",
+		"cfssl_signer_up",
+	} {
+		if !strings.Contains(string(body), "# TYPE "+name+" ") {
+			t.Errorf("metric %s missing from /metrics", name)
+		}
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	ln, err := listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("signed"))
+	})}
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() { errc <- serve(server, ln, false, stop, time.Minute) }()
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			t.Error(err)
+		}
+		respc <- resp
+	}()
+
+	// The request in flight completes before serve returns.
+	<-started
+	stop <- syscall.SIGTERM
+	if err = <-errc; err != nil {
+		t.Fatal(err)
+	}
+	resp := <-respc
+	if resp == nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || string(body) != "signed" {
+		t.Fatalf("expected the request in flight to complete, got %q (%v)", body, err)
+	}
+
+	if _, err = http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Fatal("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	ln, err := listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Skipf("SO_REUSEPORT unavailable: %v", err)
+	}
+	defer ln.Close()
+
+	again, err := listen(ln.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("expected a second listener on %s: %v", ln.Addr(), err)
+	}
+	again.Close()
+
+	if again, err = listen(ln.Addr().String(), false); err == nil {
+		again.Close()
+		t.Fatal("expected listening without SO_REUSEPORT to fail")
+	}
+}
@@ -2,6 +2,7 @@
 package sign
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -10,6 +11,8 @@ import (
 	certsql "github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
 	"github.com/cloudflare/cfssl/signer/universal"
@@ -23,20 +26,28 @@ var signerUsageText = `cfssl sign -- signs a client cert with a host name by a g
 Usage of sign:
         cfssl sign -ca cert -ca-key key [mutual-tls-cert cert] [mutual-tls-key key] [-config config] [-profile profile] [-hostname hostname] [-db-config db-config] CSR [SUBJECT]
         cfssl sign -remote remote_host [mutual-tls-cert cert] [mutual-tls-key key] [-config config] [-profile profile] [-label label] [-hostname hostname] CSR [SUBJECT]
+        cfssl sign -cross-sign -ca cert -ca-key key [-config config] [-profile profile] [-db-config db-config] CACERT
 
 Arguments:
         CSR:        PEM file for certificate request, use '-' for reading PEM from stdin.
+        CACERT:     PEM file for the CA certificate to cross-sign, use '-' for reading PEM from stdin.
 
 Note: CSR can also be supplied via flag values; flag value will take precedence over the argument.
 
 SUBJECT is an optional file containing subject information to use for the certificate instead of the subject information in the CSR.
 
+With -cross-sign, the CA certificate is issued again by the CA given with -ca and -ca-key, keeping its
+subject, key and extensions, so that the certificates it issued also chain to that CA. The serial number,
+issuer, AKI and validity come from the signing profile, which must allow CA certificates.
+
+With -output-prefix, the certificate and CSR are written to prefix.pem and prefix.csr instead of being printed as JSON.
+
 Flags:
 `
 
 // Flags of 'cfssl sign'
 var signerFlags = []string{"hostname", "csr", "ca", "ca-key", "config", "profile", "label", "remote",
-	"mutual-tls-cert", "mutual-tls-key", "db-config"}
+	"mutual-tls-cert", "mutual-tls-key", "db-config", "output-prefix", "cross-sign"}
 
 // SignerFromConfigAndDB takes the Config and creates the appropriate
 // signer.Signer object with a specified db
@@ -89,6 +100,18 @@ func SignerFromConfigAndDB(c cli.Config, db *sqlx.DB) (signer.Signer, error) {
 		s.SetDBAccessor(dbAccessor)
 	}
 
+	if c.AuditLogFile != "" {
+		auditor, ok := s.(signer.Auditor)
+		if !ok {
+			return nil, errors.New("the signer doesn't support audit logs")
+		}
+		hook, err := signer.NewFileAuditHook(c.AuditLogFile)
+		if err != nil {
+			return nil, err
+		}
+		auditor.SetAuditHook(hook)
+	}
+
 	return s, nil
 }
 
@@ -105,9 +128,55 @@ func SignerFromConfig(c cli.Config) (s signer.Signer, err error) {
 	return SignerFromConfigAndDB(c, db)
 }
 
+// crossSigner is implemented by the signers able to cross-sign CA
+// certificates, which hold the CA key.
+type crossSigner interface {
+	CrossSign(ca *x509.Certificate, profile string) ([]byte, error)
+}
+
+// crossSignMain cross-signs the CA certificate given as argument.
+func crossSignMain(args []string, c cli.Config) error {
+	certFile, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("too many arguments are provided, please check with usage")
+	}
+	if c.Remote != "" || c.CAFile == "" || c.CAKeyFile == "" {
+		return cferr.WithClass(cferr.ClassInput, errors.New("cross-signing needs the CA certificate and key (provide them with -ca and -ca-key)"))
+	}
+
+	certPEM, err := cli.ReadStdin(certFile)
+	if err != nil {
+		return err
+	}
+	ca, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+
+	s, err := SignerFromConfig(c)
+	if err != nil {
+		return err
+	}
+	cs, ok := s.(crossSigner)
+	if !ok {
+		return cferr.WithClass(cferr.ClassInput, errors.New("the signing configuration doesn't allow cross-signing with a local CA key"))
+	}
+	cert, err := cs.CrossSign(ca, c.Profile)
+	if err != nil {
+		return err
+	}
+	return cli.OutputCert(c.OutputPrefix, nil, nil, cert)
+}
+
 // signerMain is the main CLI of signer functionality.
 // [TODO: zi] Decide whether to drop the argument list and only use flags to specify all the inputs.
 func signerMain(args []string, c cli.Config) (err error) {
+	if c.CrossSign {
+		return crossSignMain(args, c)
+	}
 	if c.CSRFile == "" {
 		c.CSRFile, args, err = cli.PopFirstArgument(args)
 		if err != nil {
@@ -173,8 +242,7 @@ func signerMain(args []string, c cli.Config) (err error) {
 	if err != nil {
 		return
 	}
-	cli.PrintCert(nil, csr, cert)
-	return
+	return cli.OutputCert(c.OutputPrefix, nil, csr, cert)
 }
 
 // Command assembles the definition of Command 'sign'
@@ -1,11 +1,18 @@
 package sign
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 func TestSignFromConfig(t *testing.T) {
@@ -58,3 +65,73 @@ func TestSignerWithDB(t *testing.T) {
 		t.Fatal("Expected 1 unexpired certificate in the database after signing 1")
 	}
 }
+
+func TestSignerWithAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auditLog := filepath.Join(dir, "audit.log")
+	err = signerMain([]string{"../../testdata/server.csr"}, cli.Config{CAFile: "../../testdata/server.crt",
+		CAKeyFile: "../../testdata/server.key", Hostname: "www.cloudflare.com", AuditLogFile: auditLog})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ioutil.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(records, []byte(`"event":"issue"`)) {
+		t.Fatalf("issued certificate not in the audit log: %s", records)
+	}
+}
+
+func TestCrossSign(t *testing.T) {
+	policy := &config.Config{Signing: &config.Signing{Default: &config.SigningProfile{
+		Usage:        []string{"cert sign", "crl sign"},
+		ExpiryString: "1h",
+		Expiry:       time.Hour,
+		CAConstraint: config.CAConstraint{IsCA: true},
+	}}}
+	prefix := filepath.Join(t.TempDir(), "cross")
+	c := cli.Config{
+		CAFile:       "../../testdata/server.crt",
+		CAKeyFile:    "../../testdata/server.key",
+		CFG:          policy,
+		CrossSign:    true,
+		OutputPrefix: prefix,
+	}
+
+	if err := signerMain([]string{"../../testdata/server.csr"}, c); err == nil {
+		t.Fatal("expected a CSR to be rejected")
+	}
+	if err := signerMain([]string{"../../signer/local/testdata/ca.pem"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM, err := ioutil.ReadFile("../../signer/local/testdata/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crossPEM, err := ioutil.ReadFile(prefix + ".pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := helpers.ParseCertificatePEM(crossPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cross.RawSubject, ca.RawSubject) || !bytes.Equal(cross.RawSubjectPublicKeyInfo, ca.RawSubjectPublicKeyInfo) {
+		t.Fatal("expected the subject and key of the CA certificate to be kept")
+	}
+	if bytes.Equal(cross.RawIssuer, ca.RawIssuer) {
+		t.Fatal("expected the certificate to be issued by the -ca certificate")
+	}
+}
@@ -0,0 +1,161 @@
+// Package transportrefresh implements the transport-refresh command.
+package transportrefresh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/transport"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+var transportRefreshUsageText = `cfssl transport-refresh -- obtain and renew a key and certificate from a remote CA
+
+The key and certificate described by the -identity file, a transport identity
+as used by the transport package, are loaded, generating the key if needed. A
+new certificate is requested from the identity's remote CA when there is none
+or when it expires within -before. The key and certificate files are replaced
+atomically.
+
+With -daemon, the command keeps running and renews the certificate -before
+each expiry, retrying with backoff while the CA is unavailable. With -rekey,
+every renewal also generates a new key. After each renewal, the process
+-reload-pid is sent a SIGHUP and the -hook shell command is run.
+
+Usage of transport-refresh:
+        cfssl transport-refresh -identity file [-before 24h] [-rekey] [-daemon] [-reload-pid pid] [-hook command]
+
+Flags:
+`
+
+var transportRefreshFlags = []string{"identity", "before", "rekey", "daemon", "reload-pid", "hook"}
+
+// hooks notify other processes that the certificate was renewed.
+type hooks struct {
+	pid     int
+	command string
+}
+
+// run sends SIGHUP to the process, if any, then runs the command, if any.
+func (h hooks) run() error {
+	if h.pid != 0 {
+		p, err := os.FindProcess(h.pid)
+		if err == nil {
+			err = p.Signal(syscall.SIGHUP)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to signal process %d: %v", h.pid, err)
+		}
+	}
+
+	if h.command != "" {
+		cmd := exec.Command("/bin/sh", "-c", h.command)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("hook %q failed: %v", h.command, err)
+		}
+	}
+	return nil
+}
+
+func loadIdentity(path string) (*core.Identity, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	id := new(core.Identity)
+	if err = json.Unmarshal(data, id); err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %v", path, err)
+	}
+	if id.Request == nil {
+		return nil, fmt.Errorf("identity file %s has no certificate request", path)
+	}
+	return id, nil
+}
+
+// refresh makes sure the transport has a valid certificate, and reports
+// whether a new one was issued.
+func refresh(tr *transport.Transport) (bool, error) {
+	if !tr.Provider.Ready() {
+		// Load the current certificate, if any, to tell whether it
+		// gets replaced. RefreshKeys deals with any error.
+		tr.Provider.Load()
+	}
+	previous := tr.Provider.Certificate()
+
+	if err := tr.RefreshKeys(); err != nil {
+		return false, err
+	}
+
+	cert := tr.Provider.Certificate()
+	if cert == nil {
+		return false, errors.New("no certificate was issued")
+	}
+	return previous == nil || !bytes.Equal(previous.Raw, cert.Raw), nil
+}
+
+func transportRefreshMain(args []string, c cli.Config) error {
+	if c.IdentityFile == "" {
+		return errors.New("need a transport identity file (provide with -identity)")
+	}
+	id, err := loadIdentity(c.IdentityFile)
+	if err != nil {
+		return err
+	}
+
+	tr, err := transport.New(c.Before, id)
+	if err != nil {
+		return err
+	}
+	if !tr.Provider.Persistent() {
+		return errors.New("the identity doesn't give the paths of the key and certificate")
+	}
+	tr.Rekey = c.Rekey
+	h := hooks{pid: c.ReloadPID, command: c.Hook}
+
+	renewed, err := refresh(tr)
+	if err != nil {
+		return err
+	}
+	if renewed {
+		log.Infof("certificate renewed, expires at %s", tr.Provider.Certificate().NotAfter)
+		if err = h.run(); err != nil {
+			if !c.Daemon {
+				return err
+			}
+			log.Errorf("%v", err)
+		}
+	}
+	if !c.Daemon {
+		return nil
+	}
+
+	certUpdates := make(chan time.Time)
+	errs := make(chan error)
+	go tr.AutoUpdate(certUpdates, errs)
+	for {
+		select {
+		case <-certUpdates:
+			log.Infof("certificate renewed, expires at %s", tr.Provider.Certificate().NotAfter)
+			if err = h.run(); err != nil {
+				log.Errorf("%v", err)
+			}
+		case err = <-errs:
+			log.Warningf("failed to renew the certificate, will retry: %v", err)
+		}
+	}
+}
+
+// Command assembles the definition of Command 'transport-refresh'
+var Command = &cli.Command{UsageText: transportRefreshUsageText, Flags: transportRefreshFlags, Main: transportRefreshMain}
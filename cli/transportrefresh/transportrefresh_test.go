@@ -0,0 +1,53 @@
+package transportrefresh
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport-refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	marker := filepath.Join(dir, "renewed")
+	h := hooks{pid: os.Getpid(), command: "touch " + marker}
+	if err = h.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-hup:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the process to receive a SIGHUP")
+	}
+	if _, err = os.Stat(marker); err != nil {
+		t.Fatalf("expected the hook to run: %v", err)
+	}
+
+	if err = (hooks{command: "exit 1"}).run(); err == nil {
+		t.Fatal("expected a failing hook to be reported")
+	}
+}
+
+func TestTransportRefreshMainErrors(t *testing.T) {
+	if err := transportRefreshMain(nil, cli.Config{}); err == nil {
+		t.Fatal("expected an error without -identity")
+	}
+	if err := transportRefreshMain(nil, cli.Config{IdentityFile: "testdata/missing.json"}); err == nil {
+		t.Fatal("expected an error for a missing identity file")
+	}
+}
@@ -0,0 +1,155 @@
+// Package watchcert implements the watch-cert command
+package watchcert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cfssl/certinfo"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/log"
+)
+
+var watchcertUsageText = `cfssl watch-cert -- watch the certificate of a remote server
+
+The leaf certificate served by -host is fetched every -poll-interval, and an event
+is printed as a line of JSON for every poll. The command exits with an error
+when the certificate differs from the one seen on the previous poll, or when
+it expires within -min-validity. Failing to connect is reported as an "error"
+event and doesn't count as a change.
+
+Usage of watch-cert:
+        cfssl watch-cert -host host[:port] [-poll-interval 1m] [-min-validity 720h]
+
+Flags:
+`
+
+var watchcertFlags = []string{"host", "poll-interval", "min-validity"}
+
+// Kinds of events.
+const (
+	eventChecked  = "checked"
+	eventChanged  = "changed"
+	eventExpiring = "expiring"
+	eventError    = "error"
+)
+
+// An event describes the outcome of one poll.
+type event struct {
+	Time                time.Time  `json:"time"`
+	Host                string     `json:"host"`
+	Event               string     `json:"event"`
+	Fingerprint         string     `json:"fingerprint,omitempty"`
+	PreviousFingerprint string     `json:"previous_fingerprint,omitempty"`
+	Subject             string     `json:"subject,omitempty"`
+	SerialNumber        string     `json:"serial_number,omitempty"`
+	NotAfter            *time.Time `json:"not_after,omitempty"`
+	ExpiresIn           string     `json:"expires_in,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+var (
+	errChanged  = errors.New("certificate changed")
+	errExpiring = errors.New("certificate is about to expire")
+)
+
+// A watcher polls the certificate of a host and remembers the fingerprint
+// of the last one it saw.
+type watcher struct {
+	host        string
+	minValidity time.Duration
+	fetch       func(host string) (*certinfo.Certificate, error)
+	out         io.Writer
+
+	fingerprint string
+}
+
+// poll fetches the certificate once and writes the resulting event. It
+// returns errChanged or errExpiring when the watch should stop; failing to
+// fetch the certificate is reported in the event only.
+func (w *watcher) poll() error {
+	ev := event{Time: time.Now().UTC(), Host: w.host}
+
+	cert, err := w.fetch(w.host)
+	if err == nil {
+		ev.Fingerprint, err = fingerprint(cert)
+	}
+	if err != nil {
+		log.Warningf("failed to fetch the certificate of %s: %v", w.host, err)
+		ev.Event = eventError
+		ev.Error = err.Error()
+		return w.write(ev, nil)
+	}
+
+	notAfter := cert.NotAfter.UTC()
+	ev.Subject = cert.Subject.CommonName
+	ev.SerialNumber = cert.SerialNumber
+	ev.NotAfter = &notAfter
+	expiresIn := notAfter.Sub(ev.Time)
+	ev.ExpiresIn = expiresIn.Truncate(time.Second).String()
+
+	var result error
+	switch {
+	case w.fingerprint != "" && ev.Fingerprint != w.fingerprint:
+		ev.Event = eventChanged
+		ev.PreviousFingerprint = w.fingerprint
+		result = errChanged
+	case expiresIn < w.minValidity:
+		ev.Event = eventExpiring
+		result = errExpiring
+	default:
+		ev.Event = eventChecked
+	}
+	w.fingerprint = ev.Fingerprint
+	return w.write(ev, result)
+}
+
+// write prints ev, and returns result unless that fails.
+func (w *watcher) write(ev event, result error) error {
+	if err := json.NewEncoder(w.out).Encode(ev); err != nil {
+		return err
+	}
+	return result
+}
+
+// fingerprint returns the hex SHA-256 digest of the DER encoding of cert.
+func fingerprint(cert *certinfo.Certificate) (string, error) {
+	block, _ := pem.Decode([]byte(cert.RawPEM))
+	if block == nil {
+		return "", errors.New("no PEM encoded certificate")
+	}
+	digest := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func watchcertMain(args []string, c cli.Config) error {
+	if c.Host == "" {
+		return errors.New("need a host to watch (provide with -host)")
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("invalid poll interval %v, it must be positive", c.PollInterval)
+	}
+
+	w := &watcher{
+		host:        c.Host,
+		minValidity: c.MinValidity,
+		fetch:       certinfo.ParseCertificateDomain,
+		out:         os.Stdout,
+	}
+	for {
+		if err := w.poll(); err != nil {
+			return err
+		}
+		time.Sleep(c.PollInterval)
+	}
+}
+
+// Command assembles the definition of Command 'watch-cert'
+var Command = &cli.Command{UsageText: watchcertUsageText, Flags: watchcertFlags, Main: watchcertMain}
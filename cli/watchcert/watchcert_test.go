@@ -0,0 +1,137 @@
+package watchcert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certinfo"
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func newCert(t *testing.T, serial int64, validity time.Duration) *certinfo.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "watch.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certinfo.ParseCertificate(cert)
+}
+
+// newWatcher returns a watcher whose polls return the given certificates
+// in turn, a nil certificate standing for a connection failure.
+func newWatcher(certs []*certinfo.Certificate, out *bytes.Buffer) *watcher {
+	return &watcher{
+		host:        "watch.example.com:443",
+		minValidity: 24 * time.Hour,
+		out:         out,
+		fetch: func(string) (*certinfo.Certificate, error) {
+			cert := certs[0]
+			certs = certs[1:]
+			if cert == nil {
+				return nil, errors.New("connection refused")
+			}
+			return cert, nil
+		},
+	}
+}
+
+func readEvents(t *testing.T, out *bytes.Buffer) []event {
+	var events []event
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var ev event
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestWatchChange(t *testing.T) {
+	first := newCert(t, 1, 30*24*time.Hour)
+	second := newCert(t, 2, 30*24*time.Hour)
+
+	var out bytes.Buffer
+	w := newWatcher([]*certinfo.Certificate{first, nil, first, second}, &out)
+	for i := 0; i < 3; i++ {
+		if err := w.poll(); err != nil {
+			t.Fatalf("poll %d: %v", i, err)
+		}
+	}
+	if err := w.poll(); err != errChanged {
+		t.Fatalf("expected the new certificate to stop the watch, got %v", err)
+	}
+
+	events := readEvents(t, &out)
+	kinds := []string{eventChecked, eventError, eventChecked, eventChanged}
+	if len(events) != len(kinds) {
+		t.Fatalf("expected %d events, got %d", len(kinds), len(events))
+	}
+	for i, ev := range events {
+		if ev.Event != kinds[i] {
+			t.Errorf("event %d is %q, expected %q", i, ev.Event, kinds[i])
+		}
+		if ev.Host != "watch.example.com:443" {
+			t.Errorf("event %d has host %q", i, ev.Host)
+		}
+	}
+
+	if events[1].Error == "" || events[1].Fingerprint != "" {
+		t.Errorf("unexpected error event %+v", events[1])
+	}
+	if events[0].Fingerprint != events[2].Fingerprint || events[0].SerialNumber != "1" {
+		t.Errorf("unexpected events for the first certificate %+v, %+v", events[0], events[2])
+	}
+	changed := events[3]
+	if changed.PreviousFingerprint != events[0].Fingerprint || changed.Fingerprint == changed.PreviousFingerprint {
+		t.Errorf("unexpected fingerprints in change event %+v", changed)
+	}
+	if changed.SerialNumber != "2" || changed.NotAfter == nil {
+		t.Errorf("change event doesn't describe the new certificate: %+v", changed)
+	}
+}
+
+func TestWatchExpiring(t *testing.T) {
+	var out bytes.Buffer
+	w := newWatcher([]*certinfo.Certificate{newCert(t, 1, time.Hour)}, &out)
+	if err := w.poll(); err != errExpiring {
+		t.Fatalf("expected a certificate expiring within an hour to stop the watch, got %v", err)
+	}
+
+	events := readEvents(t, &out)
+	if len(events) != 1 || events[0].Event != eventExpiring || events[0].ExpiresIn == "" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestWatchcertMainFlags(t *testing.T) {
+	if err := watchcertMain(nil, cli.Config{PollInterval: time.Minute}); err == nil {
+		t.Fatal("expected an error without a host")
+	}
+	if err := watchcertMain(nil, cli.Config{Host: "watch.example.com"}); err == nil {
+		t.Fatal("expected an error without a poll interval")
+	}
+}
@@ -13,6 +13,7 @@ Usage:
 	serve	 starts a HTTP server handling sign and bundle requests
 	version	 prints the current cfssl version
 	genkey   generates a key and an associated CSR
+	genkey-pkcs11 generates a key in a PKCS #11 token and a CSR for it
 	gencert  generates a key and a signed certificate
 	gencsr   generates a certificate request
 	selfsign generates a self-signed certificate
@@ -28,23 +29,34 @@ import (
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/cli/bundle"
 	"github.com/cloudflare/cfssl/cli/certinfo"
+	"github.com/cloudflare/cfssl/cli/configcmd"
 	"github.com/cloudflare/cfssl/cli/crl"
+	"github.com/cloudflare/cfssl/cli/exportlog"
 	"github.com/cloudflare/cfssl/cli/gencert"
 	"github.com/cloudflare/cfssl/cli/gencrl"
+	"github.com/cloudflare/cfssl/cli/gencrlsigner"
 	"github.com/cloudflare/cfssl/cli/gencsr"
 	"github.com/cloudflare/cfssl/cli/genkey"
+	"github.com/cloudflare/cfssl/cli/genkeypkcs11"
 	"github.com/cloudflare/cfssl/cli/info"
+	"github.com/cloudflare/cfssl/cli/mergecrls"
+	"github.com/cloudflare/cfssl/cli/ocspdist"
 	"github.com/cloudflare/cfssl/cli/ocspdump"
 	"github.com/cloudflare/cfssl/cli/ocsprefresh"
 	"github.com/cloudflare/cfssl/cli/ocspserve"
 	"github.com/cloudflare/cfssl/cli/ocspsign"
+	"github.com/cloudflare/cfssl/cli/p12"
 	"github.com/cloudflare/cfssl/cli/printdefault"
+	"github.com/cloudflare/cfssl/cli/rekeyca"
 	"github.com/cloudflare/cfssl/cli/revoke"
 	"github.com/cloudflare/cfssl/cli/scan"
 	"github.com/cloudflare/cfssl/cli/selfsign"
 	"github.com/cloudflare/cfssl/cli/serve"
 	"github.com/cloudflare/cfssl/cli/sign"
+	"github.com/cloudflare/cfssl/cli/transportrefresh"
 	"github.com/cloudflare/cfssl/cli/version"
+	"github.com/cloudflare/cfssl/cli/watchcert"
+	cferr "github.com/cloudflare/cfssl/errors"
 
 	_ "github.com/go-sql-driver/mysql" // import to support MySQL
 	_ "github.com/lib/pq"              // import to support Postgres
@@ -57,31 +69,41 @@ func main() {
 	flag.Usage = nil // this is set to nil for testabilty
 	// Register commands.
 	cmds := map[string]*cli.Command{
-		"bundle":         bundle.Command,
-		"certinfo":       certinfo.Command,
-		"crl":            crl.Command,
-		"sign":           sign.Command,
-		"serve":          serve.Command,
-		"version":        version.Command,
-		"genkey":         genkey.Command,
-		"gencert":        gencert.Command,
-		"gencsr":         gencsr.Command,
-		"gencrl":         gencrl.Command,
-		"ocspdump":       ocspdump.Command,
-		"ocsprefresh":    ocsprefresh.Command,
-		"ocspsign":       ocspsign.Command,
-		"ocspserve":      ocspserve.Command,
-		"selfsign":       selfsign.Command,
-		"scan":           scan.Command,
-		"info":           info.Command,
-		"print-defaults": printdefaults.Command,
-		"revoke":         revoke.Command,
+		"bundle":            bundle.Command,
+		"certinfo":          certinfo.Command,
+		"config":            configcmd.Command,
+		"crl":               crl.Command,
+		"sign":              sign.Command,
+		"serve":             serve.Command,
+		"version":           version.Command,
+		"genkey":            genkey.Command,
+		"genkey-pkcs11":     genkeypkcs11.Command,
+		"gencert":           gencert.Command,
+		"gencsr":            gencsr.Command,
+		"gencrl":            gencrl.Command,
+		"gencrlsigner":      gencrlsigner.Command,
+		"ocspdist":          ocspdist.Command,
+		"ocspdump":          ocspdump.Command,
+		"ocsprefresh":       ocsprefresh.Command,
+		"ocspsign":          ocspsign.Command,
+		"ocspserve":         ocspserve.Command,
+		"p12":               p12.Command,
+		"selfsign":          selfsign.Command,
+		"scan":              scan.Command,
+		"info":              info.Command,
+		"merge-crls":        mergecrls.Command,
+		"print-defaults":    printdefaults.Command,
+		"revoke":            revoke.Command,
+		"rekey-ca":          rekeyca.Command,
+		"watch-cert":        watchcert.Command,
+		"transport-refresh": transportrefresh.Command,
+		"export-log":        exportlog.Command,
 	}
 
-	// If the CLI returns an error, exit with an appropriate status
-	// code.
+	// If the CLI returns an error, exit with the status of its class,
+	// so that scripts can tell failures apart.
 	err := cli.Start(cmds)
 	if err != nil {
-		os.Exit(1)
+		os.Exit(int(cferr.ClassOf(err)))
 	}
 }
@@ -3,14 +3,24 @@
 package main
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/cloudflare/cfssl/cli/output"
 	"github.com/cloudflare/cfssl/cli/version"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 func readFile(filespec string) ([]byte, error) {
@@ -20,12 +30,13 @@ func readFile(filespec string) ([]byte, error) {
 	return ioutil.ReadFile(filespec)
 }
 
-func writeFile(filespec, contents string, perms os.FileMode) {
-	err := ioutil.WriteFile(filespec, []byte(contents), perms)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+// writeFiles writes outs as a set with output.WriteFiles.
+func writeFiles(outs []outputFile, noClobber, backup bool) error {
+	files := make([]output.File, len(outs))
+	for i, out := range outs {
+		files[i] = output.File{Filename: out.Filename, Contents: []byte(out.Contents), Perms: out.Perms}
 	}
+	return output.WriteFiles(files, noClobber, backup)
 }
 
 // ResponseMessage represents the format of a CFSSL output for an error or message
@@ -42,18 +53,313 @@ type Response struct {
 	Messages []ResponseMessage      `json:"messages"`
 }
 
+// An outputFile is a file to write. Type names the kind of output, such
+// as "cert" or "key", or the result field for -map outputs.
 type outputFile struct {
+	Type     string
 	Filename string
 	Contents string
 	IsBinary bool
 	Perms    os.FileMode
 }
 
+// fieldMapping routes result fields to files, each named by appending
+// a suffix to the base name. It is filled from repeated -map flags.
+type fieldMapping struct {
+	fields   []string
+	suffixes map[string]string
+}
+
+func (m *fieldMapping) String() string {
+	var pairs []string
+	for _, field := range m.fields {
+		pairs = append(pairs, field+"="+m.suffixes[field])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set parses a field=suffix pair.
+func (m *fieldMapping) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+		return fmt.Errorf("invalid mapping %q, expected field=suffix", value)
+	}
+	if m.suffixes == nil {
+		m.suffixes = map[string]string{}
+	}
+	if _, ok := m.suffixes[pair[0]]; !ok {
+		m.fields = append(m.fields, pair[0])
+	}
+	m.suffixes[pair[0]] = pair[1]
+	return nil
+}
+
+// parseOutputTemplate compiles the -template flag. Referencing a result
+// field that is missing is an execution error rather than "<no value>".
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Funcs(template.FuncMap{
+		"output": func() string { return "" },
+		"base":   func() string { return "" },
+	}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// applyOutputTemplate sets the file name of every output by executing
+// tmpl on the result map. Within the template, output returns the type of
+// the file being named and base returns the base name argument; they are
+// also available as the .Type and .Base fields, which shadow any result
+// fields of the same name.
+func applyOutputTemplate(outs []outputFile, tmpl *template.Template, input map[string]interface{}, baseName string) error {
+	for i := range outs {
+		outputType := outs[i].Type
+		t, err := tmpl.Clone()
+		if err != nil {
+			return err
+		}
+		t.Funcs(template.FuncMap{
+			"output": func() string { return outputType },
+			"base":   func() string { return baseName },
+		})
+
+		data := make(map[string]interface{}, len(input)+2)
+		for k, v := range input {
+			data[k] = v
+		}
+		data["Type"] = outputType
+		data["Base"] = baseName
+
+		var name strings.Builder
+		if err := t.Execute(&name, data); err != nil {
+			return fmt.Errorf("failed to execute output template for %s: %v", outputType, err)
+		}
+		if strings.TrimSpace(name.String()) == "" {
+			return fmt.Errorf("output template produced an empty file name for %s", outputType)
+		}
+		outs[i].Filename = name.String()
+	}
+	return nil
+}
+
+// prefixOutputDir moves every output into dir.
+func prefixOutputDir(outs []outputFile, dir string) {
+	for i := range outs {
+		outs[i].Filename = filepath.Join(dir, outs[i].Filename)
+	}
+}
+
+// mappedOutputs returns an output file for every mapped field present
+// in input. Fields whose name mentions a key are written with private
+// permissions.
+func mappedOutputs(input map[string]interface{}, baseName string, mapping *fieldMapping) ([]outputFile, error) {
+	var outs []outputFile
+	for _, field := range mapping.fields {
+		contents, ok := input[field]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Field %s not found in input\n", field)
+			continue
+		}
+		s, ok := contents.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %s is not a string", field)
+		}
+		perms := os.FileMode(0644)
+		if strings.Contains(strings.ToLower(field), "key") {
+			perms = 0600
+		}
+		outs = append(outs, outputFile{
+			Type:     field,
+			Filename: baseName + mapping.suffixes[field],
+			Contents: s,
+			Perms:    perms,
+		})
+	}
+	return outs, nil
+}
+
+// splitPEM returns the PEM encoded certificates in chain, one per string.
+func splitPEM(chain string) ([]string, error) {
+	var certs []string
+	rest := []byte(chain)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected %s PEM block in certificate chain", block.Type)
+		}
+		certs = append(certs, string(pem.EncodeToMemory(block)))
+	}
+	return certs, nil
+}
+
+// chainOutputs replaces the certificate output with the leaf, numbered
+// intermediate and chain files of -split-chain, when the certificate or
+// the bundle of the result holds more than one certificate. The chain
+// file holds the intermediates, in order, without the leaf.
+func chainOutputs(outs []outputFile, input map[string]interface{}, baseName string) ([]outputFile, error) {
+	var chains []string
+	for _, field := range []string{"cert", "certificate", "bundle"} {
+		if s, ok := input[field].(string); ok {
+			chains = append(chains, s)
+		}
+	}
+	if result, ok := input["result"].(map[string]interface{}); ok {
+		if bundle, ok := result["bundle"].(map[string]interface{}); ok {
+			if s, ok := bundle["bundle"].(string); ok {
+				chains = append(chains, s)
+			}
+		}
+	}
+
+	var certs []string
+	for _, chain := range chains {
+		var err error
+		if certs, err = splitPEM(chain); err != nil {
+			return nil, err
+		}
+		if len(certs) > 1 {
+			break
+		}
+	}
+	if len(certs) < 2 {
+		return outs, nil
+	}
+
+	chainOuts := []outputFile{{
+		Type:     "cert",
+		Filename: baseName + ".pem",
+		Contents: certs[0],
+		Perms:    0664,
+	}}
+	for i, cert := range certs[1:] {
+		chainOuts = append(chainOuts, outputFile{
+			Type:     fmt.Sprintf("intermediate-%d", i+1),
+			Filename: fmt.Sprintf("%s-intermediate-%d.pem", baseName, i+1),
+			Contents: cert,
+			Perms:    0644,
+		})
+	}
+	chainOuts = append(chainOuts, outputFile{
+		Type:     "chain",
+		Filename: baseName + "-chain.pem",
+		Contents: strings.Join(certs[1:], ""),
+		Perms:    0644,
+	})
+
+	var split []outputFile
+	for _, out := range outs {
+		if out.Type == "cert" {
+			split = append(split, chainOuts...)
+			chainOuts = nil
+		} else {
+			split = append(split, out)
+		}
+	}
+	split = append(split, chainOuts...)
+	return split, nil
+}
+
+// verifyResult checks the certificate and private key of a result
+// before anything is written: the certificate must be valid at now, the
+// key, if there is one, must match it, and if roots is set the
+// certificate must chain to one of them, through the intermediates
+// following it or in the bundle of the result.
+func verifyResult(input map[string]interface{}, roots *x509.CertPool, now time.Time) error {
+	certPEM, _ := input["cert"].(string)
+	if certPEM == "" {
+		certPEM, _ = input["certificate"].(string)
+	}
+	if certPEM == "" {
+		return errors.New("no certificate in the result to verify")
+	}
+	certs, err := helpers.ParseCertificatesPEM([]byte(certPEM))
+	if err != nil {
+		return fmt.Errorf("failed to parse the certificate: %v", err)
+	}
+	if len(certs) == 0 {
+		return errors.New("no certificate in the result to verify")
+	}
+	cert := certs[0]
+
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("the certificate is not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("the certificate expired at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	keyPEM, _ := input["key"].(string)
+	if keyPEM == "" {
+		keyPEM, _ = input["private_key"].(string)
+	}
+	if keyPEM != "" {
+		key, err := helpers.ParsePrivateKeyPEM([]byte(keyPEM))
+		if err != nil {
+			return fmt.Errorf("failed to parse the private key: %v", err)
+		}
+		keyDER, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			return err
+		}
+		certDER, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(keyDER, certDER) {
+			return errors.New("the private key does not match the certificate")
+		}
+	}
+
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		if result, ok := input["result"].(map[string]interface{}); ok {
+			if bundle, ok := result["bundle"].(map[string]interface{}); ok {
+				if s, ok := bundle["bundle"].(string); ok {
+					chain, err := helpers.ParseCertificatesPEM([]byte(s))
+					if err != nil {
+						return fmt.Errorf("failed to parse the bundle: %v", err)
+					}
+					for _, c := range chain {
+						intermediates.AddCert(c)
+					}
+				}
+			}
+		}
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("the certificate does not chain to the CA bundle: %v", err)
+		}
+	}
+	return nil
+}
+
 func main() {
+	var mapping fieldMapping
 	bare := flag.Bool("bare", false, "the response from CFSSL is not wrapped in the API standard response")
 	inFile := flag.String("f", "-", "JSON input")
 	output := flag.Bool("stdout", false, "output the response instead of saving to a file")
 	printVersion := flag.Bool("version", false, "print version and exit")
+	templateText := flag.String("template", "", "Go template deriving each output file name from the result fields; {{.Type}} is the output type and {{.Base}} the base name")
+	outDir := flag.String("outdir", "", "directory to write the output files to")
+	splitChain := flag.Bool("split-chain", false, "write a certificate chain as the leaf, each intermediate and the intermediates chain in separate files")
+	noClobber := flag.Bool("no-clobber", false, "refuse to write any file if one of them already exists")
+	backup := flag.Bool("backup", false, "keep the files that are replaced with a .bak suffix")
+	verify := flag.Bool("verify", false, "check that the certificate is currently valid and matches the private key before writing anything")
+	verifyCA := flag.String("verify-ca", "", "CA bundle the certificate must chain to; implies -verify")
+	flag.Var(&mapping, "map", "write result field to the base name plus suffix, as field=suffix (repeatable); replaces the built-in mappings")
 	flag.Parse()
 
 	if *printVersion {
@@ -61,6 +367,21 @@ func main() {
 		return
 	}
 
+	if *noClobber && *backup {
+		fmt.Fprintf(os.Stderr, "-no-clobber and -backup are mutually exclusive\n")
+		os.Exit(1)
+	}
+
+	var outputTemplate *template.Template
+	if *templateText != "" {
+		var err error
+		outputTemplate, err = parseOutputTemplate(*templateText)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	var baseName string
 	if flag.NArg() == 0 {
 		baseName = "cert"
@@ -105,6 +426,34 @@ func main() {
 		input = response.Result
 	}
 
+	if *verify || *verifyCA != "" {
+		var roots *x509.CertPool
+		if *verifyCA != "" {
+			roots, err = helpers.LoadPEMCertPool(*verifyCA)
+			if err == nil && roots == nil {
+				err = errors.New("the file is empty")
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load the CA bundle: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err = verifyResult(input, roots, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Verification failed, no file was written: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(mapping.fields) > 0 {
+		outs, err = mappedOutputs(input, baseName, &mapping)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		writeTemplatedOutputs(outs, outputTemplate, input, baseName, *outDir, *output, *noClobber, *backup)
+		return
+	}
+
 	if contents, ok := input["cert"]; ok {
 		cert = contents.(string)
 	} else if contents, ok = input["certificate"]; ok {
@@ -112,6 +461,7 @@ func main() {
 	}
 	if cert != "" {
 		outs = append(outs, outputFile{
+			Type:     "cert",
 			Filename: baseName + ".pem",
 			Contents: cert,
 			Perms:    0664,
@@ -125,6 +475,7 @@ func main() {
 	}
 	if key != "" {
 		outs = append(outs, outputFile{
+			Type:     "key",
 			Filename: baseName + "-key.pem",
 			Contents: key,
 			Perms:    0600,
@@ -134,6 +485,7 @@ func main() {
 	if contents, ok := input["encrypted_key"]; ok {
 		encKey := contents.(string)
 		outs = append(outs, outputFile{
+			Type:     "encrypted_key",
 			Filename: baseName + "-key.enc",
 			Contents: encKey,
 			IsBinary: true,
@@ -148,6 +500,7 @@ func main() {
 	}
 	if csr != "" {
 		outs = append(outs, outputFile{
+			Type:     "csr",
 			Filename: baseName + ".csr",
 			Contents: csr,
 			Perms:    0644,
@@ -171,11 +524,13 @@ func main() {
 				os.Exit(1)
 			}
 			outs = append(outs, outputFile{
+				Type:     "bundle",
 				Filename: baseName + "-bundle.pem",
 				Contents: certificateBundle + "\n" + rootCertificate,
 				Perms:    0644,
 			})
 			outs = append(outs, outputFile{
+				Type:     "root",
 				Filename: baseName + "-root.pem",
 				Contents: rootCertificate,
 				Perms:    0644,
@@ -191,6 +546,7 @@ func main() {
 			os.Exit(1)
 		}
 		outs = append(outs, outputFile{
+			Type:     "ocsp_response",
 			Filename: baseName + "-response.der",
 			Contents: string(resp),
 			IsBinary: true,
@@ -198,14 +554,45 @@ func main() {
 		})
 	}
 
+	if *splitChain {
+		outs, err = chainOutputs(outs, input, baseName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	writeTemplatedOutputs(outs, outputTemplate, input, baseName, *outDir, *output, *noClobber, *backup)
+}
+
+// writeTemplatedOutputs names the outputs with tmpl, if set, and moves
+// them into outDir, if set, before writing them.
+func writeTemplatedOutputs(outs []outputFile, tmpl *template.Template, input map[string]interface{}, baseName, outDir string, stdout, noClobber, backup bool) {
+	if tmpl != nil {
+		if err := applyOutputTemplate(outs, tmpl, input, baseName); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if outDir != "" {
+		prefixOutputDir(outs, outDir)
+	}
+	writeOutputs(outs, stdout, noClobber, backup)
+}
+
+func writeOutputs(outs []outputFile, stdout, noClobber, backup bool) {
+	if !stdout {
+		if err := writeFiles(outs, noClobber, backup); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	for _, e := range outs {
-		if *output {
-			if e.IsBinary {
-				e.Contents = base64.StdEncoding.EncodeToString([]byte(e.Contents))
-			}
-			fmt.Fprintf(os.Stdout, "%s\n", e.Contents)
-		} else {
-			writeFile(e.Filename, e.Contents, e.Perms)
+		if e.IsBinary {
+			e.Contents = base64.StdEncoding.EncodeToString([]byte(e.Contents))
 		}
+		fmt.Fprintf(os.Stdout, "%s\n", e.Contents)
 	}
 }
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/cloudflare/cfssl/api"
 	"github.com/cloudflare/cfssl/auth"
@@ -27,11 +31,14 @@ type filter func(string, *signer.SignRequest) bool
 var filters = map[string][]filter{}
 
 type signerStats struct {
-	Counter metrics.Counter
-	Rate    metrics.Meter
+	Counter       metrics.Counter
+	Rate          metrics.Meter
+	Limited       metrics.Counter
+	QuotaExceeded metrics.Counter
 }
 
 var stats struct {
+	sync.Mutex
 	Registry         metrics.Registry
 	Requests         map[string]signerStats
 	TotalRequestRate metrics.Meter
@@ -44,19 +51,30 @@ func initStats() {
 
 	stats.Requests = map[string]signerStats{}
 
-	// signers is defined in ca.go
-	for k := range signers {
-		stats.Requests[k] = signerStats{
-			Counter: metrics.NewRegisteredCounter("requests:"+k, stats.Registry),
-			Rate:    metrics.NewRegisteredMeter("request-rate:"+k, stats.Registry),
-		}
-	}
-
 	stats.TotalRequestRate = metrics.NewRegisteredMeter("total-request-rate", stats.Registry)
 	stats.ErrorPercent = metrics.NewRegisteredGaugeFloat64("error-percent", stats.Registry)
 	stats.ErrorRate = metrics.NewRegisteredMeter("error-rate", stats.Registry)
 }
 
+// registerStats sets up the request metrics of a signer, unless a
+// previous configuration already had a signer with the same label.
+func registerStats(label string) signerStats {
+	stats.Lock()
+	defer stats.Unlock()
+
+	st, ok := stats.Requests[label]
+	if !ok {
+		st = signerStats{
+			Counter:       metrics.NewRegisteredCounter("requests:"+label, stats.Registry),
+			Rate:          metrics.NewRegisteredMeter("request-rate:"+label, stats.Registry),
+			Limited:       metrics.NewRegisteredCounter("rate-limited:"+label, stats.Registry),
+			QuotaExceeded: metrics.NewRegisteredCounter("quota-exceeded:"+label, stats.Registry),
+		}
+		stats.Requests[label] = st
+	}
+	return st
+}
+
 // incError increments the error count and updates the error percentage.
 func incErrors() {
 	stats.ErrorRate.Mark(1)
@@ -94,9 +112,20 @@ func fail(w http.ResponseWriter, req *http.Request, status, code int, msg, ad st
 	jenc.Encode(res)
 }
 
+// tooManyRequests fails a request refused by a rate limit or a quota,
+// telling the client when to retry.
+func tooManyRequests(w http.ResponseWriter, req *http.Request, retry time.Duration, msg, ad string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	fail(w, req, http.StatusTooManyRequests, 1, msg, ad)
+}
+
 func dispatchRequest(w http.ResponseWriter, req *http.Request) {
 	incRequests()
 
+	// Use the same configuration for the whole request, even if the
+	// roots are reloaded in the meantime.
+	cfg := currentConfig()
+
 	if req.Method != "POST" {
 		fail(w, req, http.StatusMethodNotAllowed, 1, "only POST is permitted", "")
 		return
@@ -115,6 +144,7 @@ func dispatchRequest(w http.ResponseWriter, req *http.Request) {
 		fail(w, req, http.StatusBadRequest, 1, err.Error(), "while unmarshaling request body")
 		return
 	}
+	authReq.TLS = req.TLS
 
 	var sigRequest signer.SignRequest
 	err = json.Unmarshal(authReq.Request, &sigRequest)
@@ -127,7 +157,7 @@ func dispatchRequest(w http.ResponseWriter, req *http.Request) {
 		sigRequest.Label = defaultLabel
 	}
 
-	acl := whitelists[sigRequest.Label]
+	acl := cfg.whitelists[sigRequest.Label]
 	if acl != nil {
 		ip, err := whitelist.HTTPRequestLookup(req)
 		if err != nil {
@@ -141,14 +171,15 @@ func dispatchRequest(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	s, ok := signers[sigRequest.Label]
+	s, ok := cfg.signers[sigRequest.Label]
 	if !ok {
 		fail(w, req, http.StatusBadRequest, 1, "bad request", "request is for non-existent label "+sigRequest.Label)
 		return
 	}
 
-	stats.Requests[sigRequest.Label].Counter.Inc(1)
-	stats.Requests[sigRequest.Label].Rate.Mark(1)
+	st := registerStats(sigRequest.Label)
+	st.Counter.Inc(1)
+	st.Rate.Mark(1)
 
 	// Sanity checks to ensure that we have a valid policy. This
 	// should have been checked in NewAuthSignHandler.
@@ -177,24 +208,61 @@ func dispatchRequest(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	validAuth := false
+	var provider auth.Provider
+	authKey := profile.AuthKeyName
 	if profile.Provider.Verify(&authReq) {
-		validAuth = true
+		provider = profile.Provider
 	} else if profile.PrevProvider != nil && profile.PrevProvider.Verify(&authReq) {
-		validAuth = true
+		provider = profile.PrevProvider
+		authKey = profile.PrevAuthKeyName
 	}
-	if !validAuth {
+	if provider == nil {
 		fail(w, req, http.StatusBadRequest, 1, "invalid token", "received authenticated request with invalid token")
 		return
 	}
+	err = auth.VerifyNames(provider, &authReq, sigRequest.Hosts, []byte(sigRequest.Request), sigRequest.Subject != nil)
+	if err != nil {
+		fail(w, req, http.StatusForbidden, 1, "not authorised", "names not allowed for the requester: "+err.Error())
+		return
+	}
+
+	// The rate limits are only charged for authenticated requests, so
+	// that requests without a valid token can't exhaust them.
+	limits := cfg.limits[sigRequest.Label]
+	if ok, retry := allow(limitKey(sigRequest.Label, ""), limits.Rate); !ok {
+		st.Limited.Inc(1)
+		tooManyRequests(w, req, retry, "rate limit exceeded", "for label "+sigRequest.Label)
+		return
+	}
+	if ok, retry := allow(limitKey(sigRequest.Label, authKey), limits.KeyRate); !ok {
+		st.Limited.Inc(1)
+		tooManyRequests(w, req, retry, "rate limit exceeded", "for auth key "+authKey+" of label "+sigRequest.Label)
+		return
+	}
 
 	if sigRequest.Request == "" {
 		fail(w, req, http.StatusBadRequest, 1, "invalid request", "empty request")
 		return
 	}
 
+	rootQuota := limitKey(sigRequest.Label, "")
+	if ok, retry := takeQuota(rootQuota, limits.DailyQuota); !ok {
+		st.QuotaExceeded.Inc(1)
+		tooManyRequests(w, req, retry, "daily quota exceeded", "for label "+sigRequest.Label)
+		return
+	}
+	keyQuota := limitKey(sigRequest.Label, authKey)
+	if ok, retry := takeQuota(keyQuota, limits.KeyDailyQuota); !ok {
+		releaseQuota(rootQuota, limits.DailyQuota)
+		st.QuotaExceeded.Inc(1)
+		tooManyRequests(w, req, retry, "daily quota exceeded", "for auth key "+authKey+" of label "+sigRequest.Label)
+		return
+	}
+
 	cert, err := s.Sign(sigRequest)
 	if err != nil {
+		releaseQuota(rootQuota, limits.DailyQuota)
+		releaseQuota(keyQuota, limits.KeyDailyQuota)
 		fail(w, req, http.StatusBadRequest, 1, "bad request", "signature failed: "+err.Error())
 		return
 	}
@@ -222,6 +290,7 @@ func metricsDisallowed(w http.ResponseWriter, req *http.Request) {
 
 func dumpMetrics(w http.ResponseWriter, req *http.Request) {
 	log.Info("whitelisted requested for metrics endpoint")
+	signers := currentConfig().signers
 	var statsOut = struct {
 		Metrics metrics.Registry `json:"metrics"`
 		Signers []string         `json:"signers"`
@@ -5,13 +5,22 @@ import (
 	"crypto/rsa"
 	"errors"
 	"flag"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/cloudflare/cfssl/api/crl"
 	"github.com/cloudflare/cfssl/api/info"
 	"github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/multiroot/config"
+	"github.com/cloudflare/cfssl/ocsp"
 	"github.com/cloudflare/cfssl/signer"
 	"github.com/cloudflare/cfssl/signer/local"
 	"github.com/cloudflare/cfssl/whitelist"
@@ -30,6 +39,9 @@ func parseSigner(root *config.Root) (signer.Signer, error) {
 			return nil, err
 		}
 		s.SetPolicy(root.Config)
+		if auditHook != nil {
+			s.SetAuditHook(auditHook)
+		}
 		if root.DB != nil {
 			dbAccessor := sql.NewAccessor(root.DB)
 			s.SetDBAccessor(dbAccessor)
@@ -40,47 +52,235 @@ func parseSigner(root *config.Root) (signer.Signer, error) {
 	}
 }
 
+// A caConfig holds the signers loaded from the roots file. It is
+// replaced as a whole when the file is reloaded, and requests keep using
+// the configuration that was current when they arrived.
+type caConfig struct {
+	signers    map[string]signer.Signer
+	whitelists map[string]whitelist.NetACL
+	limits     map[string]config.Limits
+	info       http.Handler
+	// crls and responders serve the CRL and the OCSP responses of the
+	// roots with a certificate database.
+	crls       map[string]http.Handler
+	responders map[string]http.Handler
+}
+
 var (
 	defaultLabel string
-	signers      = map[string]signer.Signer{}
-	whitelists   = map[string]whitelist.NetACL{}
+	// auditHook, if set, is notified of the sign requests of every
+	// root.
+	auditHook signer.AuditHook
+
+	configLock sync.RWMutex
+	current    *caConfig
+)
+
+// loadConfig parses the roots file and sets up its signers.
+func loadConfig(rootFile string) (*caConfig, error) {
+	roots, err := config.Parse(rootFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &caConfig{
+		signers:    map[string]signer.Signer{},
+		whitelists: map[string]whitelist.NetACL{},
+		limits:     map[string]config.Limits{},
+		crls:       map[string]http.Handler{},
+		responders: map[string]http.Handler{},
+	}
+	for label, root := range roots {
+		s, err := parseSigner(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signer %s: %v", label, err)
+		}
+		cfg.signers[label] = s
+		if root.ACL != nil {
+			cfg.whitelists[label] = root.ACL
+		}
+		cfg.limits[label] = root.Limits
+		if root.DB != nil {
+			dbAccessor := sql.NewAccessor(root.DB)
+			// The CRL lists the certificates whose authority key
+			// identifier is the root's subject key identifier.
+			if len(root.Certificate.SubjectKeyId) == 0 {
+				log.Warningf("root %s has no subject key identifier, not serving its CRL", label)
+			} else {
+				cfg.crls[label], err = crl.NewIssuerHandler(dbAccessor, root.Certificate, root.PrivateKey, root.CRLExpiry, root.CRLRefresh)
+				if err != nil {
+					return nil, fmt.Errorf("failed to set up the CRL of %s: %v", label, err)
+				}
+			}
+			responder := ocsp.NewResponder(ocsp.NewDBSource(dbAccessor), nil)
+			cfg.responders[label] = http.StripPrefix(ocspPath+label, responder)
+		}
+		log.Info("loaded signer ", label)
+	}
+
+	cfg.info, err = info.NewMultiHandler(cfg.signers, defaultLabel)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// currentConfig returns the configuration in use.
+func currentConfig() *caConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return current
+}
+
+// setConfig swaps in a new configuration.
+func setConfig(cfg *caConfig) {
+	for label := range cfg.signers {
+		registerStats(label)
+	}
+	configLock.Lock()
+	current = cfg
+	configLock.Unlock()
+}
+
+// reload reads the roots file again and swaps in its signers. If this
+// fails, the previous signers stay in use.
+func reload(rootFile string) error {
+	cfg, err := loadConfig(rootFile)
+	if err != nil {
+		return err
+	}
+	setConfig(cfg)
+	log.Infof("reloaded %d signers from %s", len(cfg.signers), rootFile)
+	return nil
+}
+
+// reloadOnHangup reloads the roots file every time the process receives
+// a SIGHUP.
+func reloadOnHangup(rootFile string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Info("Reloading the root configuration")
+		if err := reload(rootFile); err != nil {
+			log.Errorf("Unable to reload the root configuration, keeping the previous one: %v", err)
+		}
+	}
+}
+
+// watchRoots checks the roots file for changes every interval, and
+// reloads it when its size or modification time changes. The files it
+// refers to are not watched; send a SIGHUP after replacing them.
+func watchRoots(rootFile string, interval time.Duration) {
+	last, err := os.Stat(rootFile)
+	if err != nil {
+		log.Warningf("Unable to watch the root configuration: %v", err)
+	}
+
+	for range time.Tick(interval) {
+		fi, err := os.Stat(rootFile)
+		if err != nil {
+			log.Warningf("Unable to watch the root configuration: %v", err)
+			continue
+		}
+		if last != nil && fi.Size() == last.Size() && fi.ModTime().Equal(last.ModTime()) {
+			continue
+		}
+		last = fi
+
+		log.Info("The root configuration changed, reloading it")
+		if err = reload(rootFile); err != nil {
+			log.Errorf("Unable to reload the root configuration, keeping the previous one: %v", err)
+		}
+	}
+}
+
+// infoHandler serves info requests with the current signers.
+func infoHandler(w http.ResponseWriter, req *http.Request) {
+	currentConfig().info.ServeHTTP(w, req)
+}
+
+// The paths under which the CRL and the OCSP responder of each root are
+// served, followed by its label.
+const (
+	crlPath  = "/crl/"
+	ocspPath = "/ocsp/"
 )
 
+// crlHandler serves the CRL of the root named by the request path,
+// /crl/<label>, optionally followed by ".crl".
+func crlHandler(w http.ResponseWriter, req *http.Request) {
+	label := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, crlPath), ".crl")
+	h, ok := currentConfig().crls[label]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	h.ServeHTTP(w, req)
+}
+
+// ocspHandler serves the OCSP responses of the root named by the request
+// path, /ocsp/<label>/, followed by the base64 encoded request for GET
+// requests.
+func ocspHandler(w http.ResponseWriter, req *http.Request) {
+	label := strings.TrimPrefix(req.URL.Path, ocspPath)
+	if i := strings.Index(label, "/"); i >= 0 {
+		label = label[:i]
+	}
+	h, ok := currentConfig().responders[label]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	h.ServeHTTP(w, req)
+}
+
+// withOCSP routes the OCSP requests to ocspHandler and the others to
+// mux. The OCSP requests bypass mux, which would clean the "//" the
+// base64 encoding of a GET request may hold and redirect the client.
+func withOCSP(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, ocspPath) {
+			ocspHandler(w, req)
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
+
 func main() {
 	flagAddr := flag.String("a", ":8888", "listening address")
 	flagRootFile := flag.String("roots", "", "configuration file specifying root keys")
 	flagDefaultLabel := flag.String("l", "", "specify a default label")
 	flagEndpointCert := flag.String("tls-cert", "", "server certificate")
 	flagEndpointKey := flag.String("tls-key", "", "server private key")
+	flagWatch := flag.Duration("watch", 0, "interval at which to check the roots file for changes and reload it (0 to disable)")
+	flagAuditLog := flag.String("audit-log", "", "file to append a JSON line to for every issued certificate and every sign request refused by a signing policy")
 	flag.Parse()
 
 	if *flagRootFile == "" {
 		log.Fatal("no root file specified")
 	}
 
-	roots, err := config.Parse(*flagRootFile)
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
+	defaultLabel = *flagDefaultLabel
+	initStats()
 
-	for label, root := range roots {
-		s, err := parseSigner(root)
+	if *flagAuditLog != "" {
+		hook, err := signer.NewFileAuditHook(*flagAuditLog)
 		if err != nil {
-			log.Criticalf("%v", err)
+			log.Fatalf("%v", err)
 		}
-		signers[label] = s
-		if root.ACL != nil {
-			whitelists[label] = root.ACL
-		}
-		log.Info("loaded signer ", label)
+		auditHook = hook
 	}
 
-	defaultLabel = *flagDefaultLabel
-	initStats()
-
-	infoHandler, err := info.NewMultiHandler(signers, defaultLabel)
+	cfg, err := loadConfig(*flagRootFile)
 	if err != nil {
-		log.Criticalf("%v", err)
+		log.Fatalf("%v", err)
+	}
+	setConfig(cfg)
+
+	go reloadOnHangup(*flagRootFile)
+	if *flagWatch > 0 {
+		go watchRoots(*flagRootFile, *flagWatch)
 	}
 
 	var localhost = whitelist.NewBasic()
@@ -92,16 +292,18 @@ func main() {
 	}
 
 	http.HandleFunc("/api/v1/cfssl/authsign", dispatchRequest)
-	http.Handle("/api/v1/cfssl/info", infoHandler)
+	http.HandleFunc("/api/v1/cfssl/info", infoHandler)
 	http.Handle("/api/v1/cfssl/metrics", metrics)
+	http.HandleFunc(crlPath, crlHandler)
+	handler := withOCSP(http.DefaultServeMux)
 
 	if *flagEndpointCert == "" && *flagEndpointKey == "" {
 		log.Info("Now listening on ", *flagAddr)
-		log.Fatal(http.ListenAndServe(*flagAddr, nil))
+		log.Fatal(http.ListenAndServe(*flagAddr, handler))
 	} else {
 
 		log.Info("Now listening on https:// ", *flagAddr)
-		log.Fatal(http.ListenAndServeTLS(*flagAddr, *flagEndpointCert, *flagEndpointKey, nil))
+		log.Fatal(http.ListenAndServeTLS(*flagAddr, *flagEndpointCert, *flagEndpointKey, handler))
 	}
 
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"golang.org/x/crypto/ocsp"
+)
+
+const testdata = "../../multiroot/config/testdata/"
+
+// writeRoots writes a roots file with a signer for each label.
+func writeRoots(t *testing.T, path string, labels ...string) {
+	var roots string
+	for _, label := range labels {
+		roots += fmt.Sprintf("[ %s ]\nprivate = file://%s\ncertificate = %s\nconfig = %s\n\n",
+			label, testdata+"server.key", testdata+"server.crt", testdata+"config.json")
+	}
+	if err := ioutil.WriteFile(path, []byte(roots), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multirootca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rootFile := filepath.Join(dir, "roots.conf")
+
+	initStats()
+	writeRoots(t, rootFile, "primary")
+	cfg, err := loadConfig(rootFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setConfig(cfg)
+
+	// A request in flight holds on to the configuration it started with.
+	inFlight := currentConfig()
+
+	writeRoots(t, rootFile, "primary", "backup")
+	if err = reload(rootFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(inFlight.signers) != 1 {
+		t.Fatalf("the previous configuration changed to %d signers", len(inFlight.signers))
+	}
+	reloaded := currentConfig()
+	if reloaded == inFlight || len(reloaded.signers) != 2 || reloaded.signers["backup"] == nil {
+		t.Fatal("the new signers weren't swapped in")
+	}
+	if _, ok := stats.Requests["backup"]; !ok {
+		t.Fatal("no metrics for the new signer")
+	}
+
+	if err = ioutil.WriteFile(rootFile, []byte("[ broken ]\nprivate = file://missing.key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = reload(rootFile); err == nil {
+		t.Fatal("reloaded an invalid root configuration")
+	}
+	if currentConfig() != reloaded {
+		t.Fatal("a failed reload replaced the configuration")
+	}
+}
+
+// writeCA writes a self-signed CA certificate and its key to dir.
+func writeCA(t *testing.T, dir string) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(pub, &spki); err != nil {
+		t.Fatal(err)
+	}
+	// The key hash of OCSP requests, which the certdb matches against
+	// the authority key identifier.
+	ski := sha1.Sum(spki.PublicKey.RightAlign())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "multirootca test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		SubjectKeyId:          ski[:],
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "ca-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, key
+}
+
+func TestRevocationEndpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multirootca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, key := writeCA(t, dir)
+	aki := hex.EncodeToString(ca.SubjectKeyId)
+	const dbFile = "../../certdb/testdb/certstore_development.db"
+	dbAccessor := sql.NewAccessor(testdb.SQLiteDB(dbFile))
+	now := time.Now()
+	err = dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial:    "3",
+		AKI:       aki,
+		Expiry:    now.Add(time.Hour),
+		PEM:       "revoked certificate",
+		Status:    "revoked",
+		RevokedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ocspResponse, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       ocsp.Revoked,
+		SerialNumber: big.NewInt(3),
+		ThisUpdate:   now.Add(-time.Minute),
+		NextUpdate:   now.Add(time.Hour),
+		RevokedAt:    now,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbAccessor.InsertOCSP(certdb.OCSPRecord{Serial: "3", AKI: aki, Body: string(ocspResponse), Expiry: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbConfig := filepath.Join(dir, "db.json")
+	err = ioutil.WriteFile(dbConfig, []byte(`{"driver": "sqlite3", "data_source": "`+dbFile+`"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootFile := filepath.Join(dir, "roots.conf")
+	writeRoots(t, rootFile, "backup")
+	roots, err := ioutil.ReadFile(rootFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots = append(roots, fmt.Sprintf("[ primary ]\nprivate = file://%s\ncertificate = %s\nconfig = %s\ndbconfig = %s\n",
+		filepath.Join(dir, "ca-key.pem"), filepath.Join(dir, "ca.pem"), testdata+"config.json", dbConfig)...)
+	if err = ioutil.WriteFile(rootFile, roots, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initStats()
+	cfg, err := loadConfig(rootFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setConfig(cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(crlPath, crlHandler)
+	ts := httptest.NewServer(withOCSP(mux))
+	defer ts.Close()
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	status, body := get("/crl/primary.crl")
+	if status != http.StatusOK {
+		t.Fatalf("expected the CRL of the primary root, got status %d: %s", status, body)
+	}
+	list, err := x509.ParseRevocationList(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = list.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("expected the CRL to be signed by the root: %v", err)
+	}
+	if len(list.RevokedCertificateEntries) != 1 || list.RevokedCertificateEntries[0].SerialNumber.Int64() != 3 {
+		t.Fatalf("expected the revoked certificate to be listed, got %d entries", len(list.RevokedCertificateEntries))
+	}
+
+	ocspRequest, err := ocsp.CreateRequest(&x509.Certificate{SerialNumber: big.NewInt(3)}, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body = get("/ocsp/primary/" + url.PathEscape(base64.StdEncoding.EncodeToString(ocspRequest)))
+	if status != http.StatusOK || !bytes.Equal(body, ocspResponse) {
+		t.Fatalf("expected the stored OCSP response, got status %d", status)
+	}
+
+	// The backup root has no certificate database.
+	for _, path := range []string{"/crl/backup", "/ocsp/backup/" + base64.StdEncoding.EncodeToString(ocspRequest)} {
+		if status, _ = get(path); status != http.StatusNotFound {
+			t.Errorf("expected %s to be missing, got status %d", path, status)
+		}
+	}
+}
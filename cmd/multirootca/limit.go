@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// A bucket is a token bucket refilled at the rate limit it enforces.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// A quota counts the certificates issued on a UTC day.
+type quota struct {
+	day  time.Time
+	used int
+}
+
+// The limiter state is keyed by root label, or by root label and auth
+// key name, so that it carries over when the roots are reloaded.
+var limiter = struct {
+	sync.Mutex
+	buckets map[string]*bucket
+	quotas  map[string]*quota
+}{
+	buckets: map[string]*bucket{},
+	quotas:  map[string]*quota{},
+}
+
+// now is the clock of the limiter, replaced in tests.
+var now = time.Now
+
+// limitKey names the limiter state of a root, or of one of its auth keys
+// if key isn't empty.
+func limitKey(label, key string) string {
+	if key == "" {
+		return label
+	}
+	return label + "/" + key
+}
+
+// allow takes a token from the bucket name, which holds up to the larger
+// of 1 and rate tokens and is refilled at rate tokens per second. If the
+// bucket is empty, it returns false and how long until the next token.
+func allow(name string, rate float64) (bool, time.Duration) {
+	if rate <= 0 {
+		return true, 0
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	burst := math.Max(1, math.Ceil(rate))
+	t := now()
+	b, ok := limiter.buckets[name]
+	if !ok {
+		b = &bucket{tokens: burst, last: t}
+		limiter.buckets[name] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+t.Sub(b.last).Seconds()*rate)
+	b.last = t
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// takeQuota counts a certificate against the daily quota name of max
+// certificates. If the quota is used up, it returns false and how long
+// until it is reset at midnight UTC.
+func takeQuota(name string, max int) (bool, time.Duration) {
+	if max <= 0 {
+		return true, 0
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	t := now().UTC()
+	day := t.Truncate(24 * time.Hour)
+	q, ok := limiter.quotas[name]
+	if !ok || !q.day.Equal(day) {
+		q = &quota{day: day}
+		limiter.quotas[name] = q
+	}
+
+	if q.used >= max {
+		return false, day.Add(24 * time.Hour).Sub(t)
+	}
+	q.used++
+	return true, 0
+}
+
+// releaseQuota gives back a certificate counted by takeQuota that wasn't
+// issued after all.
+func releaseQuota(name string, max int) {
+	if max <= 0 {
+		return
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if q, ok := limiter.quotas[name]; ok && q.used > 0 {
+		q.used--
+	}
+}
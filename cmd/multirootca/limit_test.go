@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := t0
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	if ok, _ := allow("unlimited", 0); !ok {
+		t.Fatal("a zero rate should not limit requests")
+	}
+
+	// A rate of 2 per second allows a burst of 2 requests.
+	for i := 0; i < 2; i++ {
+		if ok, _ := allow("allow", 2); !ok {
+			t.Fatalf("request %d was limited", i)
+		}
+	}
+	ok, retry := allow("allow", 2)
+	if ok {
+		t.Fatal("the third request wasn't limited")
+	}
+	if retry != 500*time.Millisecond {
+		t.Fatalf("expected to retry in 500ms, got %v", retry)
+	}
+
+	clock = t0.Add(500 * time.Millisecond)
+	if ok, _ = allow("allow", 2); !ok {
+		t.Fatal("the bucket wasn't refilled")
+	}
+	if ok, _ = allow(limitKey("allow", "key"), 2); !ok {
+		t.Fatal("an auth key used the bucket of its root")
+	}
+}
+
+func TestTakeQuota(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := takeQuota("quota", 2); !ok {
+			t.Fatalf("certificate %d exceeded the quota", i)
+		}
+	}
+	ok, retry := takeQuota("quota", 2)
+	if ok {
+		t.Fatal("the quota wasn't enforced")
+	}
+	if retry != time.Hour {
+		t.Fatalf("expected to retry at midnight, got %v", retry)
+	}
+
+	releaseQuota("quota", 2)
+	if ok, _ = takeQuota("quota", 2); !ok {
+		t.Fatal("a released certificate still counted against the quota")
+	}
+
+	clock = clock.Add(time.Hour)
+	if ok, _ = takeQuota("quota", 2); !ok {
+		t.Fatal("the quota wasn't reset at midnight")
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+// An Admission describes one entry of the admission extension
+// (1.3.36.8.3.3) defined by Common PKI and used, for example, by the
+// German healthcare PKI: the professions a certificate holder is admitted
+// to and the authority that registered them.
+type Admission struct {
+	NamingAuthority NamingAuthority  `json:"naming_authority"`
+	ProfessionInfos []ProfessionInfo `json:"profession_infos"`
+}
+
+// A NamingAuthority identifies the authority that defines the meaning of
+// profession items, OIDs and registration numbers. All of its fields are
+// optional.
+type NamingAuthority struct {
+	ID   OID    `json:"id"`
+	URL  string `json:"url"`
+	Text string `json:"text"`
+}
+
+// A ProfessionInfo lists the professions a certificate holder is admitted
+// to, by name and by OID, along with the holder's registration number.
+type ProfessionInfo struct {
+	NamingAuthority    NamingAuthority `json:"naming_authority"`
+	ProfessionItems    []string        `json:"profession_items"`
+	ProfessionOIDs     []OID           `json:"profession_oids"`
+	RegistrationNumber string          `json:"registration_number"`
+}
+
+// maxAdmissionString is the upper bound Common PKI places on the length
+// of the strings in the admission extension.
+const maxAdmissionString = 128
+
+// validAdmission checks that an admission can be encoded: every
+// profession info needs at least one profession item, strings must fit
+// the bounds of the ASN.1 module, and OIDs must be encodable.
+func validAdmission(a Admission) error {
+	if err := validNamingAuthority(a.NamingAuthority); err != nil {
+		return err
+	}
+	if len(a.ProfessionInfos) == 0 {
+		return errors.New("admission has no profession infos")
+	}
+
+	for _, info := range a.ProfessionInfos {
+		if err := validNamingAuthority(info.NamingAuthority); err != nil {
+			return err
+		}
+		if len(info.ProfessionItems) == 0 {
+			return errors.New("profession info has no profession items")
+		}
+		for _, item := range info.ProfessionItems {
+			if err := validDirectoryString(item); err != nil {
+				return fmt.Errorf("invalid profession item %q: %v", item, err)
+			}
+		}
+		for _, oid := range info.ProfessionOIDs {
+			if !validOID(asn1.ObjectIdentifier(oid)) {
+				return fmt.Errorf("invalid profession OID %v", asn1.ObjectIdentifier(oid))
+			}
+		}
+		if info.RegistrationNumber != "" {
+			if len(info.RegistrationNumber) > maxAdmissionString {
+				return errors.New("registration number is longer than 128 characters")
+			}
+			if !isPrintableString(info.RegistrationNumber) {
+				return fmt.Errorf("registration number %q is not a PrintableString", info.RegistrationNumber)
+			}
+		}
+	}
+	return nil
+}
+
+func validNamingAuthority(na NamingAuthority) error {
+	if len(na.ID) != 0 && !validOID(asn1.ObjectIdentifier(na.ID)) {
+		return fmt.Errorf("invalid naming authority OID %v", asn1.ObjectIdentifier(na.ID))
+	}
+	if na.URL != "" {
+		for i := 0; i < len(na.URL); i++ {
+			if na.URL[i] >= utf8.RuneSelf {
+				return fmt.Errorf("naming authority URL %q is not an IA5String", na.URL)
+			}
+		}
+		if u, err := url.Parse(na.URL); err != nil || u.Scheme == "" {
+			return fmt.Errorf("naming authority URL %q is not an absolute URI", na.URL)
+		}
+	}
+	if na.Text != "" {
+		if err := validDirectoryString(na.Text); err != nil {
+			return fmt.Errorf("invalid naming authority text %q: %v", na.Text, err)
+		}
+	}
+	return nil
+}
+
+func validDirectoryString(s string) error {
+	if !utf8.ValidString(s) {
+		return errors.New("not valid UTF-8")
+	}
+	if n := utf8.RuneCountInString(s); n == 0 || n > maxAdmissionString {
+		return errors.New("must be between 1 and 128 characters")
+	}
+	return nil
+}
+
+// validOID reports whether oid can be DER encoded.
+func validOID(oid asn1.ObjectIdentifier) bool {
+	if len(oid) < 2 || oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return false
+	}
+	for _, arc := range oid {
+		if arc < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrintableString reports whether s only uses the PrintableString
+// character set.
+func isPrintableString(s string) bool {
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == ' ', c == '\'', c == '(', c == ')', c == '+', c == ',',
+			c == '-', c == '.', c == '/', c == ':', c == '=', c == '?':
+		default:
+			return false
+		}
+	}
+	return true
+}
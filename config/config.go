@@ -2,13 +2,22 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -35,7 +44,89 @@ import (
 // mechanism.
 type CSRWhitelist struct {
 	Subject, PublicKeyAlgorithm, PublicKey, SignatureAlgorithm bool
-	DNSNames, IPAddresses, EmailAddresses, URIs                bool
+	DNSNames, IPAddresses, EmailAddresses, URIs, OtherNames    bool
+}
+
+// An AccessDescription describes one entry of the subjectInfoAccess
+// extension (RFC 5280 section 4.2.2.2): how and where to reach
+// information about the certificate subject, such as id-ad-caRepository
+// (1.3.6.1.5.5.7.48.5) or id-ad-timeStamping (1.3.6.1.5.5.7.48.3).
+type AccessDescription struct {
+	Method   OID    `json:"method"`
+	Location string `json:"location"`
+}
+
+// IssuerAltName configures the issuerAltName extension (RFC 5280 section
+// 4.2.1.7) of certificates signed with a profile. The extension lists the
+// subject alternative names of the issuing CA if CopyFromCA is set,
+// along with Names. Each name is treated as an IP address, an email
+// address, a URI or a DNS name, as for the hosts of a signing request.
+type IssuerAltName struct {
+	CopyFromCA bool     `json:"copy_from_ca"`
+	Names      []string `json:"names"`
+}
+
+// DefaultPolicyHookTimeout is how long a sign request waits for a policy
+// hook that doesn't set its own timeout.
+const DefaultPolicyHookTimeout = 10 * time.Second
+
+// A PolicyHook is an HTTPS endpoint that decides on the sign requests of
+// a profile before they are signed, for policies the static whitelists
+// of a profile can't express. It is handed the request along with the
+// parsed CSR, and may refuse the request or amend its hosts and subject;
+// see signer.WebhookPolicy. The server certificate is verified against
+// the system roots, or against the certificates of CAFile if set.
+type PolicyHook struct {
+	URL           string `json:"url"`
+	TimeoutString string `json:"timeout"`
+	CAFile        string `json:"ca_file"`
+
+	Timeout time.Duration  `json:"-"`
+	RootCAs *x509.CertPool `json:"-"`
+}
+
+func (h *PolicyHook) populate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("policy hook URL %q is not an https URL", h.URL)
+	}
+
+	h.Timeout = DefaultPolicyHookTimeout
+	if h.TimeoutString != "" {
+		if h.Timeout, err = time.ParseDuration(h.TimeoutString); err != nil {
+			return err
+		}
+		if h.Timeout <= 0 {
+			return errors.New("policy hook timeout must be positive")
+		}
+	}
+
+	if h.CAFile != "" {
+		if h.RootCAs, err = helpers.LoadPEMCertPool(h.CAFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idAD is the arc under which PKIX access methods are defined.
+var idAD = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48}
+
+// validAccessDescription checks that the access method is a PKIX access
+// method and the location an absolute URI.
+func validAccessDescription(ad AccessDescription) error {
+	method := asn1.ObjectIdentifier(ad.Method)
+	if len(method) <= len(idAD) || !asn1.ObjectIdentifier(method[:len(idAD)]).Equal(idAD) {
+		return fmt.Errorf("access method %v is not an id-ad access method", method)
+	}
+	u, err := url.Parse(ad.Location)
+	if err != nil {
+		return fmt.Errorf("invalid access location %q: %v", ad.Location, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("access location %q is not an absolute URI", ad.Location)
+	}
+	return nil
 }
 
 // OID is our own version of asn1's ObjectIdentifier, so we can define a custom
@@ -57,6 +148,112 @@ type CertificatePolicyQualifier struct {
 	Value string
 }
 
+// A ProfileExtension is an extension that every certificate signed with
+// a profile carries, given by its OID, its criticality and its
+// base64-encoded DER value.
+type ProfileExtension struct {
+	ID       OID    `json:"id"`
+	Critical bool   `json:"critical"`
+	Value    string `json:"value"`
+}
+
+// managedExtensions are the extensions the signer derives from the
+// request, the CA or dedicated profile settings, which a profile can't
+// set as raw extensions.
+var managedExtensions = map[string]string{
+	"2.5.29.14": "subject key identifier",
+	"2.5.29.15": "key usage",
+	"2.5.29.17": "subject alternative name",
+	"2.5.29.19": "basic constraints",
+	"2.5.29.35": "authority key identifier",
+	"2.5.29.37": "extended key usage",
+}
+
+// tlsFeatureOID is the TLS Feature extension (RFC 7633) that must_staple
+// adds.
+var tlsFeatureOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// parseExtensions decodes the extensions of a profile, checking that each
+// value is a single DER encoded ASN.1 value and that no extension is
+// given twice or is managed by the signer.
+func parseExtensions(exts []ProfileExtension, mustStaple bool) ([]pkix.Extension, error) {
+	seen := map[string]bool{}
+	var parsed []pkix.Extension
+	for _, ext := range exts {
+		oid := asn1.ObjectIdentifier(ext.ID)
+		if len(oid) == 0 {
+			return nil, errors.New("extension without an id")
+		}
+		if name, ok := managedExtensions[oid.String()]; ok {
+			return nil, fmt.Errorf("the %s extension (%v) cannot be set in extensions", name, oid)
+		}
+		if mustStaple && oid.Equal(tlsFeatureOID) {
+			return nil, fmt.Errorf("extension %v conflicts with must_staple", oid)
+		}
+		if seen[oid.String()] {
+			return nil, fmt.Errorf("extension %v is given more than once", oid)
+		}
+		seen[oid.String()] = true
+
+		value, err := base64.StdEncoding.DecodeString(ext.Value)
+		if err != nil {
+			return nil, fmt.Errorf("extension %v: invalid base64 value: %v", oid, err)
+		}
+		var raw asn1.RawValue
+		if rest, err := asn1.Unmarshal(value, &raw); err != nil {
+			return nil, fmt.Errorf("extension %v: value is not DER encoded: %v", oid, err)
+		} else if len(rest) > 0 {
+			return nil, fmt.Errorf("extension %v: trailing data after the value", oid)
+		}
+		parsed = append(parsed, pkix.Extension{Id: oid, Critical: ext.Critical, Value: value})
+	}
+	return parsed, nil
+}
+
+// DefaultRemoteBackoff is how long a request to a remote is held back
+// before it is first retried, if the remote doesn't set a backoff.
+const DefaultRemoteBackoff = time.Second
+
+// RemoteOptions control how requests are made to a remote of the
+// remotes section: the timeout of each request to a server, how many
+// times a request that no server could take is retried, and the backoff
+// before the first retry, doubled before each further one.
+type RemoteOptions struct {
+	TimeoutString string `json:"timeout"`
+	Retries       int    `json:"retries"`
+	BackoffString string `json:"backoff"`
+
+	Timeout time.Duration `json:"-"`
+	Backoff time.Duration `json:"-"`
+}
+
+func (r *RemoteOptions) populate() error {
+	var err error
+	r.Timeout = 0
+	if r.TimeoutString != "" {
+		if r.Timeout, err = time.ParseDuration(r.TimeoutString); err != nil {
+			return err
+		}
+		if r.Timeout <= 0 {
+			return errors.New("remote timeout must be positive")
+		}
+	}
+
+	if r.Retries < 0 {
+		return errors.New("remote retries must not be negative")
+	}
+	r.Backoff = DefaultRemoteBackoff
+	if r.BackoffString != "" {
+		if r.Backoff, err = time.ParseDuration(r.BackoffString); err != nil {
+			return err
+		}
+		if r.Backoff < 0 {
+			return errors.New("remote backoff must not be negative")
+		}
+	}
+	return nil
+}
+
 // AuthRemote is an authenticated remote signer.
 type AuthRemote struct {
 	RemoteName  string `json:"remote"`
@@ -72,28 +269,133 @@ type CAConstraint struct {
 	MaxPathLenZero bool `json:"max_path_len_zero"`
 }
 
+// NameConstraints lists the name subtrees that the certificates issued
+// by a CA certificate must, or must not, fall within (RFC 5280,
+// 4.2.1.10). IP ranges are given in CIDR notation. The extension is
+// marked critical, as RFC 5280 requires.
+type NameConstraints struct {
+	PermittedDNSDomains     []string `json:"permitted_dns_domains,omitempty" yaml:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains,omitempty" yaml:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges,omitempty" yaml:"permitted_ip_ranges,omitempty"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges,omitempty" yaml:"excluded_ip_ranges,omitempty"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses,omitempty" yaml:"permitted_email_addresses,omitempty"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses,omitempty" yaml:"excluded_email_addresses,omitempty"`
+	PermittedURIDomains     []string `json:"permitted_uri_domains,omitempty" yaml:"permitted_uri_domains,omitempty"`
+	ExcludedURIDomains      []string `json:"excluded_uri_domains,omitempty" yaml:"excluded_uri_domains,omitempty"`
+}
+
+// parseIPRanges parses a list of CIDR ranges.
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name constraint IP range %q: %v", r, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Apply sets the name constraints of template.
+func (nc *NameConstraints) Apply(template *x509.Certificate) error {
+	permittedIPs, err := parseIPRanges(nc.PermittedIPRanges)
+	if err != nil {
+		return err
+	}
+	excludedIPs, err := parseIPRanges(nc.ExcludedIPRanges)
+	if err != nil {
+		return err
+	}
+
+	template.PermittedDNSDomainsCritical = true
+	template.PermittedDNSDomains = nc.PermittedDNSDomains
+	template.ExcludedDNSDomains = nc.ExcludedDNSDomains
+	template.PermittedIPRanges = permittedIPs
+	template.ExcludedIPRanges = excludedIPs
+	template.PermittedEmailAddresses = nc.PermittedEmailAddresses
+	template.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+	template.PermittedURIDomains = nc.PermittedURIDomains
+	template.ExcludedURIDomains = nc.ExcludedURIDomains
+	return nil
+}
+
 // A SigningProfile stores information that the CA needs to store
 // signature policy.
 type SigningProfile struct {
-	Usage               []string     `json:"usages"`
-	IssuerURL           []string     `json:"issuer_urls"`
-	OCSP                string       `json:"ocsp_url"`
-	CRL                 string       `json:"crl_url"`
-	CAConstraint        CAConstraint `json:"ca_constraint"`
-	OCSPNoCheck         bool         `json:"ocsp_no_check"`
-	ExpiryString        string       `json:"expiry"`
-	BackdateString      string       `json:"backdate"`
-	AuthKeyName         string       `json:"auth_key"`
-	CopyExtensions      bool         `json:"copy_extensions"`
-	PrevAuthKeyName     string       `json:"prev_auth_key"` // to suppport key rotation
-	RemoteName          string       `json:"remote"`
-	NotBefore           time.Time    `json:"not_before"`
-	NotAfter            time.Time    `json:"not_after"`
-	NameWhitelistString string       `json:"name_whitelist"`
-	AuthRemote          AuthRemote   `json:"auth_remote"`
-	CTLogServers        []string     `json:"ct_log_servers"`
-	AllowedExtensions   []OID        `json:"allowed_extensions"`
-	CertStore           string       `json:"cert_store"`
+	Usage               []string            `json:"usages"`
+	IssuerURL           []string            `json:"issuer_urls"`
+	OCSP                string              `json:"ocsp_url"`
+	CRL                 string              `json:"crl_url"`
+	CAConstraint        CAConstraint        `json:"ca_constraint"`
+	OCSPNoCheck         bool                `json:"ocsp_no_check"`
+	MustStaple          bool                `json:"must_staple"`
+	RSAPSS              bool                `json:"rsa_pss"`
+	OmitSKI             bool                `json:"omit_ski"`
+	SubjectInfoAccess   []AccessDescription `json:"subject_info_access"`
+	Admissions          []Admission         `json:"admissions"`
+	IssuerAltName       IssuerAltName       `json:"issuer_alt_name"`
+	ExpiryString        string              `json:"expiry"`
+	BackdateString      string              `json:"backdate"`
+	AuthKeyName         string              `json:"auth_key"`
+	CopyExtensions      bool                `json:"copy_extensions"`
+	PrevAuthKeyName     string              `json:"prev_auth_key"` // to suppport key rotation
+	RemoteName          string              `json:"remote"`
+	NotBefore           time.Time           `json:"not_before"`
+	NotAfter            time.Time           `json:"not_after"`
+	NameWhitelistString string              `json:"name_whitelist"`
+	AuthRemote          AuthRemote          `json:"auth_remote"`
+	CTLogServers        []string            `json:"ct_log_servers"`
+	AllowedExtensions   []OID               `json:"allowed_extensions"`
+	CertStore           string              `json:"cert_store"`
+	// RequesterKeys lists the hex-encoded SHA-256 fingerprints of the
+	// DER-encoded SubjectPublicKeyInfo of keys that are allowed to submit
+	// CSRs under this profile. If empty, any requester key is accepted.
+	RequesterKeys []string `json:"requester_keys"`
+	// RejectKeyReuse refuses to sign a request whose public key appears
+	// on a certificate already recorded in the certificate database.
+	RejectKeyReuse bool `json:"reject_key_reuse"`
+	// AuthorityKeyID is a hex-encoded key identifier to use as the
+	// AuthorityKeyId of issued certificates instead of the one derived
+	// from the CA, for cross-signing setups that must name another SKI.
+	AuthorityKeyID string `json:"authority_key_id"`
+	// AllowAuthorityKeyIDOverride lets a sign request choose the
+	// AuthorityKeyId of the certificate, overriding AuthorityKeyID.
+	AllowAuthorityKeyIDOverride bool `json:"allow_authority_key_id_override"`
+	// AllowRequestedSerial lets a sign request choose the serial number
+	// of the certificate instead of the signer generating a random one.
+	AllowRequestedSerial bool `json:"allow_requested_serial"`
+	// SerialStrategy chooses how the serial numbers of certificates
+	// issued under this profile are generated: SerialRandom (the
+	// default), SerialSequential or SerialRequested.
+	SerialStrategy string `json:"serial_strategy"`
+	// StripExtensions lists the OIDs of extensions that certificates
+	// issued under this profile must never carry, whatever the CSR, the
+	// request or the rest of the profile asks for.
+	StripExtensions []OID `json:"strip_extensions"`
+	// AllowedCSRExtensions lists the OIDs of extensions requested in the
+	// CSR that are copied as is into certificates issued under this
+	// profile. Other extensions of the CSR are dropped, unless
+	// CopyExtensions is set.
+	AllowedCSRExtensions []OID `json:"csr_extension_whitelist"`
+	// Extensions are added as is to every certificate issued under this
+	// profile, replacing any extension of the same OID from the CSR or
+	// the request.
+	Extensions []ProfileExtension `json:"extensions"`
+	// AllowedKeyAlgorithms lists the public key algorithms ("rsa",
+	// "ecdsa" or "ed25519") that CSRs may carry under this profile. If
+	// empty, any algorithm is accepted.
+	AllowedKeyAlgorithms []string `json:"allowed_key_algorithms"`
+	// NameConstraints are added to the CA certificates issued under
+	// this profile.
+	NameConstraints *NameConstraints `json:"name_constraints"`
+	// AllowOutlivingCA lets certificates issued under this profile expire
+	// after the CA certificate. By default their expiry is capped at the
+	// CA's.
+	AllowOutlivingCA bool `json:"allow_outliving_ca"`
+	// PolicyHook, if set, is consulted before each certificate is signed
+	// with this profile, and may refuse or amend the request.
+	PolicyHook *PolicyHook `json:"policy_hook"`
 	// LintErrLevel controls preissuance linting for the signing profile.
 	// 0 = no linting is performed [default]
 	// 2..3 = reserved
@@ -116,11 +418,19 @@ type SigningProfile struct {
 	PrevProvider                auth.Provider // to suppport key rotation
 	RemoteProvider              auth.Provider
 	RemoteServer                string
+	RemoteTimeout               time.Duration
+	RemoteRetries               int
+	RemoteBackoff               time.Duration
 	RemoteCAs                   *x509.CertPool
 	ClientCert                  *tls.Certificate
 	CSRWhitelist                *CSRWhitelist
 	NameWhitelist               *regexp.Regexp
 	ExtensionWhitelist          map[string]bool
+	CSRExtensionWhitelist       map[string]bool
+	StrippedExtensions          map[string]bool
+	ExtraExtensions             []pkix.Extension
+	RequesterKeyWhitelist       map[string]bool
+	KeyAlgorithmWhitelist       map[string]bool
 	ClientProvidesSerialNumbers bool
 	// LintRegistry is the collection of lints that should be used if
 	// LintErrLevel is configured. By default all ZLint lints are used. If
@@ -171,6 +481,18 @@ func parseObjectIdentifier(oidString string) (oid asn1.ObjectIdentifier, err err
 
 const timeFormat = "2006-01-02T15:04:05"
 
+// Serial number strategies of a signing profile.
+const (
+	// SerialRandom gives certificates random 159-bit serial numbers.
+	SerialRandom = "random"
+	// SerialSequential numbers the certificates of each CA from 1, with
+	// a sequence kept in the certificate database.
+	SerialSequential = "sequential"
+	// SerialRequested takes the serial number from the sign request,
+	// which must provide one.
+	SerialRequested = "requested"
+)
+
 // populate is used to fill in the fields that are not in JSON
 //
 // First, the ExpiryString parameter is needed to parse
@@ -226,46 +548,97 @@ func (p *SigningProfile) populate(cfg *Config) error {
 				}
 			}
 		}
+
+		for _, ad := range p.SubjectInfoAccess {
+			if err := validAccessDescription(ad); err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+			}
+		}
+
+		for _, a := range p.Admissions {
+			if err := validAdmission(a); err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+			}
+		}
+
+		for _, name := range p.IssuerAltName.Names {
+			if strings.TrimSpace(name) == "" {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					errors.New("empty issuer alternative name"))
+			}
+		}
+
+		if p.AuthorityKeyID != "" {
+			if _, err := ParseKeyIdentifier(p.AuthorityKeyID); err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					fmt.Errorf("invalid authority_key_id %q: %v", p.AuthorityKeyID, err))
+			}
+		}
+
+		// anyExtendedKeyUsage already permits every purpose, so listing
+		// specific purposes next to it is most likely a mistake.
+		if _, eku, _ := p.Usages(); len(eku) > 1 {
+			for _, usage := range eku {
+				if usage == x509.ExtKeyUsageAny {
+					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+						errors.New("the \"any\" extended key usage cannot be combined with other extended key usages"))
+				}
+			}
+		}
+
+		// CA certificates must carry a subject key identifier (RFC 5280
+		// 4.2.1.2), and crypto/x509 adds one to them regardless.
+		if p.OmitSKI && p.CAConstraint.IsCA {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				errors.New("omit_ski cannot be used with CA certificates"))
+		}
+
+		if p.NameConstraints != nil {
+			if !p.CAConstraint.IsCA {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					errors.New("name_constraints can only be used with CA certificates"))
+			}
+			if err = p.NameConstraints.Apply(&x509.Certificate{}); err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+			}
+		}
+
+		// crypto/x509 derives the authority key identifier from the CA,
+		// and the subject key identifier of CA certificates from their
+		// key, so neither can be kept out of the certificate.
+		for _, oid := range p.StripExtensions {
+			switch asn1.ObjectIdentifier(oid).String() {
+			case "2.5.29.35":
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					errors.New("the authority key identifier extension cannot be stripped"))
+			case "2.5.29.14":
+				if p.CAConstraint.IsCA {
+					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+						errors.New("the subject key identifier extension cannot be stripped from CA certificates"))
+				}
+			}
+		}
 	} else if p.RemoteName != "" {
 		log.Debug("match remote in profile to remotes section")
 		if p.AuthRemote.RemoteName != "" {
 			log.Error("profile has both a remote and an auth remote specified")
 			return cferr.New(cferr.PolicyError, cferr.InvalidPolicy)
 		}
-		if remote := cfg.Remotes[p.RemoteName]; remote != "" {
-			if err := p.updateRemote(remote); err != nil {
-				return err
-			}
-		} else {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-				errors.New("failed to find remote in remotes section"))
+		if err := p.setRemote(cfg, p.RemoteName); err != nil {
+			return err
 		}
 	} else {
 		log.Debug("match auth remote in profile to remotes section")
-		if remote := cfg.Remotes[p.AuthRemote.RemoteName]; remote != "" {
-			if err := p.updateRemote(remote); err != nil {
-				return err
-			}
-		} else {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-				errors.New("failed to find remote in remotes section"))
+		if err := p.setRemote(cfg, p.AuthRemote.RemoteName); err != nil {
+			return err
 		}
 	}
 
 	if p.AuthKeyName != "" {
 		log.Debug("match auth key in profile to auth_keys section")
 		if key, ok := cfg.AuthKeys[p.AuthKeyName]; ok {
-			if key.Type == "standard" {
-				p.Provider, err = auth.New(key.Key, nil)
-				if err != nil {
-					log.Debugf("failed to create new standard auth provider: %v", err)
-					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-						errors.New("failed to create new standard auth provider"))
-				}
-			} else {
-				log.Debugf("unknown authentication type %v", key.Type)
-				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-					errors.New("unknown authentication type"))
+			if p.Provider, err = newAuthProvider(key); err != nil {
+				return err
 			}
 		} else {
 			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
@@ -276,17 +649,8 @@ func (p *SigningProfile) populate(cfg *Config) error {
 	if p.PrevAuthKeyName != "" {
 		log.Debug("match previous auth key in profile to auth_keys section")
 		if key, ok := cfg.AuthKeys[p.PrevAuthKeyName]; ok {
-			if key.Type == "standard" {
-				p.PrevProvider, err = auth.New(key.Key, nil)
-				if err != nil {
-					log.Debugf("failed to create new standard auth provider: %v", err)
-					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-						errors.New("failed to create new standard auth provider"))
-				}
-			} else {
-				log.Debugf("unknown authentication type %v", key.Type)
-				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-					errors.New("unknown authentication type"))
+			if p.PrevProvider, err = newAuthProvider(key); err != nil {
+				return err
 			}
 		} else {
 			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
@@ -296,18 +660,9 @@ func (p *SigningProfile) populate(cfg *Config) error {
 
 	if p.AuthRemote.AuthKeyName != "" {
 		log.Debug("match auth remote key in profile to auth_keys section")
-		if key, ok := cfg.AuthKeys[p.AuthRemote.AuthKeyName]; ok == true {
-			if key.Type == "standard" {
-				p.RemoteProvider, err = auth.New(key.Key, nil)
-				if err != nil {
-					log.Debugf("failed to create new standard auth provider: %v", err)
-					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-						errors.New("failed to create new standard auth provider"))
-				}
-			} else {
-				log.Debugf("unknown authentication type %v", key.Type)
-				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-					errors.New("unknown authentication type"))
+		if key, ok := cfg.AuthKeys[p.AuthRemote.AuthKeyName]; ok {
+			if p.RemoteProvider, err = newAuthProvider(key); err != nil {
+				return err
 			}
 		} else {
 			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
@@ -315,6 +670,12 @@ func (p *SigningProfile) populate(cfg *Config) error {
 		}
 	}
 
+	if p.PolicyHook != nil {
+		if err = p.PolicyHook.populate(); err != nil {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
+
 	if p.NameWhitelistString != "" {
 		log.Debug("compiling whitelist regular expression")
 		rule, err := regexp.Compile(p.NameWhitelistString)
@@ -330,6 +691,67 @@ func (p *SigningProfile) populate(cfg *Config) error {
 		p.ExtensionWhitelist[asn1.ObjectIdentifier(oid).String()] = true
 	}
 
+	if len(p.AllowedCSRExtensions) > 0 {
+		p.CSRExtensionWhitelist = map[string]bool{}
+		for _, oid := range p.AllowedCSRExtensions {
+			id := asn1.ObjectIdentifier(oid).String()
+			// The subject alternative name is the one managed extension
+			// a CSR may supply, for names crypto/x509 can't carry.
+			if name, ok := managedExtensions[id]; ok && id != "2.5.29.17" {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					fmt.Errorf("the %s extension (%s) cannot be copied from the CSR", name, id))
+			}
+			p.CSRExtensionWhitelist[id] = true
+		}
+	}
+
+	if len(p.StripExtensions) > 0 {
+		p.StrippedExtensions = map[string]bool{}
+		for _, oid := range p.StripExtensions {
+			p.StrippedExtensions[asn1.ObjectIdentifier(oid).String()] = true
+		}
+	}
+
+	if len(p.Extensions) > 0 {
+		if p.ExtraExtensions, err = parseExtensions(p.Extensions, p.MustStaple); err != nil {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
+
+	if len(p.RequesterKeys) > 0 {
+		p.RequesterKeyWhitelist = map[string]bool{}
+		for _, fp := range p.RequesterKeys {
+			normalized, err := NormalizeKeyFingerprint(fp)
+			if err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					fmt.Errorf("invalid requester key fingerprint %q: %v", fp, err))
+			}
+			p.RequesterKeyWhitelist[normalized] = true
+		}
+	}
+
+	switch p.SerialStrategy {
+	case "", SerialRandom, SerialSequential:
+	case SerialRequested:
+		p.ClientProvidesSerialNumbers = true
+	default:
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			fmt.Errorf("unknown serial strategy %q", p.SerialStrategy))
+	}
+
+	if len(p.AllowedKeyAlgorithms) > 0 {
+		p.KeyAlgorithmWhitelist = map[string]bool{}
+		for _, alg := range p.AllowedKeyAlgorithms {
+			switch name := strings.ToLower(alg); name {
+			case "rsa", "ecdsa", "ed25519":
+				p.KeyAlgorithmWhitelist[name] = true
+			default:
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+					fmt.Errorf("unknown key algorithm %q", alg))
+			}
+		}
+	}
+
 	// By default perform any required preissuance linting with all ZLint lints.
 	p.LintRegistry = lint.GlobalRegistry()
 
@@ -367,6 +789,93 @@ func (p *SigningProfile) populate(cfg *Config) error {
 	return nil
 }
 
+// NormalizeKeyFingerprint converts a public key fingerprint into the
+// canonical form used by RequesterKeyWhitelist: lowercase hex without
+// separators. Colons and spaces are accepted as separators in the input.
+func NormalizeKeyFingerprint(fp string) (string, error) {
+	fp = strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fp))
+	raw, err := hex.DecodeString(fp)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) != sha256.Size {
+		return "", errors.New("fingerprint is not a SHA-256 digest")
+	}
+	return fp, nil
+}
+
+// Bounds on the length of a key identifier accepted by ParseKeyIdentifier:
+// RFC 5280 4.2.1.2 describes 64-bit and 160-bit identifiers, and RFC 7093
+// adds identifiers of up to a full SHA-512 digest.
+const (
+	minKeyIdentifierLength = 8
+	maxKeyIdentifierLength = 64
+)
+
+// ParseKeyIdentifier decodes a hex-encoded key identifier, such as a
+// subject or authority key identifier. Colons and spaces are accepted as
+// separators.
+func ParseKeyIdentifier(id string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < minKeyIdentifierLength || len(raw) > maxKeyIdentifierLength {
+		return nil, fmt.Errorf("key identifier is %d bytes, expected between %d and %d",
+			len(raw), minKeyIdentifierLength, maxKeyIdentifierLength)
+	}
+	return raw, nil
+}
+
+// KeyFingerprint returns the hex-encoded SHA-256 digest of the DER-encoded
+// SubjectPublicKeyInfo of pub, as used by the requester_keys profile option.
+func KeyFingerprint(pub interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// RequesterKeyAllowed reports whether pub is permitted to request
+// certificates under the profile. A profile without requester keys
+// allows every key.
+func (p *SigningProfile) RequesterKeyAllowed(pub interface{}) bool {
+	if len(p.RequesterKeyWhitelist) == 0 {
+		return true
+	}
+	fp, err := KeyFingerprint(pub)
+	if err != nil {
+		return false
+	}
+	return p.RequesterKeyWhitelist[fp]
+}
+
+// KeyAlgorithm returns the name of the algorithm of pub as used in
+// allowed_key_algorithms, or an empty string for an unsupported key.
+func KeyAlgorithm(pub interface{}) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *ecdsa.PublicKey:
+		return "ecdsa"
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+	return ""
+}
+
+// KeyAlgorithmAllowed reports whether the algorithm of pub is permitted
+// under the profile. A profile without allowed key algorithms allows
+// every algorithm.
+func (p *SigningProfile) KeyAlgorithmAllowed(pub interface{}) bool {
+	if len(p.KeyAlgorithmWhitelist) == 0 {
+		return true
+	}
+	return p.KeyAlgorithmWhitelist[KeyAlgorithm(pub)]
+}
+
 // updateRemote takes a signing profile and initializes the remote server object
 // to the hostname:port combination sent by remote.
 func (p *SigningProfile) updateRemote(remote string) error {
@@ -376,6 +885,31 @@ func (p *SigningProfile) updateRemote(remote string) error {
 	return nil
 }
 
+// setRemote points the profile to the remote named name in the remotes
+// section of cfg, with the options given to it in the remote_options
+// section, if any.
+func (p *SigningProfile) setRemote(cfg *Config, name string) error {
+	remote, ok := cfg.Remotes[name]
+	if !ok || remote == "" {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("failed to find remote in remotes section"))
+	}
+	options := RemoteOptions{}
+	if o, ok := cfg.RemoteOptions[name]; ok {
+		options = o
+	}
+	if err := options.populate(); err != nil {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			fmt.Errorf("remote %s: %v", name, err))
+	}
+
+	p.RemoteServer = remote
+	p.RemoteTimeout = options.Timeout
+	p.RemoteRetries = options.Retries
+	p.RemoteBackoff = options.Backoff
+	return nil
+}
+
 // OverrideRemotes takes a signing configuration and updates the remote server object
 // to the hostname:port combination sent by remote
 func (p *Signing) OverrideRemotes(remote string) error {
@@ -563,6 +1097,7 @@ func (p *SigningProfile) hasLocalConfig() bool {
 		!p.NotBefore.IsZero() ||
 		!p.NotAfter.IsZero() ||
 		p.NameWhitelistString != "" ||
+		p.NameConstraints != nil ||
 		len(p.CTLogServers) != 0 {
 		return true
 	}
@@ -596,10 +1131,15 @@ type Signing struct {
 
 // Config stores configuration information for the CA.
 type Config struct {
-	Signing  *Signing           `json:"signing"`
-	OCSP     *ocspConfig.Config `json:"ocsp"`
-	AuthKeys map[string]AuthKey `json:"auth_keys,omitempty"`
-	Remotes  map[string]string  `json:"remotes,omitempty"`
+	Signing       *Signing                 `json:"signing"`
+	OCSP          *ocspConfig.Config       `json:"ocsp"`
+	AuthKeys      map[string]AuthKey       `json:"auth_keys,omitempty"`
+	Remotes       map[string]string        `json:"remotes,omitempty"`
+	RemoteOptions map[string]RemoteOptions `json:"remote_options,omitempty"`
+	// EventsAuthKey names the auth key that clients of the events
+	// endpoint authenticate with; the endpoint is disabled without it.
+	EventsAuthKey  string        `json:"events_auth_key,omitempty"`
+	EventsProvider auth.Provider `json:"-"`
 }
 
 // Valid ensures that Config is a valid configuration. It should be
@@ -667,16 +1207,38 @@ var ExtKeyUsage = map[string]x509.ExtKeyUsage{
 	"netscape sgc":     x509.ExtKeyUsageNetscapeServerGatedCrypto,
 }
 
+// newAuthProvider creates the authentication provider for an auth key.
+func newAuthProvider(key AuthKey) (auth.Provider, error) {
+	var provider auth.Provider
+	var err error
+	if key.Type == "jwt" {
+		provider, err = auth.NewJWT(key.Key, key.Audience, key.Issuer)
+	} else {
+		provider, err = auth.NewProvider(key.Type, key.Key, nil)
+	}
+	if err != nil {
+		log.Debugf("failed to create new %s auth provider: %v", key.Type, err)
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+	}
+	return provider, nil
+}
+
 // An AuthKey contains an entry for a key used for authentication.
 type AuthKey struct {
 	// Type contains information needed to select the appropriate
-	// constructor. For example, "standard" for HMAC-SHA-256,
-	// "standard-ip" for HMAC-SHA-256 incorporating the client's
-	// IP.
+	// constructor: "standard" for HMAC-SHA-256, "api_key" for a
+	// static API key, "mtls" for mutual TLS client certificates,
+	// "spiffe" for SPIFFE X.509-SVIDs or "jwt" for JWT bearer tokens.
 	Type string `json:"type"`
 	// Key contains the key information, such as a hex-encoded
-	// HMAC key.
+	// HMAC key, an API key, the PEM-encoded CAs of mutual TLS
+	// clients, the PEM-encoded SPIFFE trust bundle or the
+	// PEM-encoded public key verifying JWTs.
 	Key string `json:"key"`
+	// Audience and Issuer are the "aud" and "iss" claims that the
+	// JWTs verified with the key must carry.
+	Audience string `json:"audience,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
 }
 
 // DefaultConfig returns a default configuration specifying basic key
@@ -721,6 +1283,24 @@ func LoadConfig(config []byte) (*Config, error) {
 		return nil, errors.New("No \"signing\" field present")
 	}
 
+	for name := range cfg.RemoteOptions {
+		if _, ok := cfg.Remotes[name]; !ok {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				fmt.Errorf("options given for remote %s, which is not in the remotes section", name))
+		}
+	}
+
+	if cfg.EventsAuthKey != "" {
+		key, ok := cfg.AuthKeys[cfg.EventsAuthKey]
+		if !ok {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				errors.New("failed to find events_auth_key in auth_keys section"))
+		}
+		if cfg.EventsProvider, err = newAuthProvider(key); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.Signing.Default == nil {
 		log.Debugf("no default given: using default config")
 		cfg.Signing.Default = DefaultConfig()
@@ -1,10 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"testing"
 	"time"
+
+	"github.com/cloudflare/cfssl/auth"
 )
 
 var expiry = 1 * time.Minute
@@ -621,3 +629,452 @@ func TestDontWantCopyExtension(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+var requesterKeysLocalConfig = `
+{
+	"signing": {
+		"default": {
+			"expiry": "8000h",
+			"requester_keys": [
+				"0F:1E:2D:3C:4B:5A:69:78:87:96:A5:B4:C3:D2:E1:F0:0F:1E:2D:3C:4B:5A:69:78:87:96:A5:B4:C3:D2:E1:F0"
+			]
+		}
+	}
+}`
+
+var invalidRequesterKeysLocalConfig = `
+{
+	"signing": {
+		"default": {
+			"expiry": "8000h",
+			"requester_keys": ["not-a-fingerprint"]
+		}
+	}
+}`
+
+func TestRequesterKeys(t *testing.T) {
+	localConfig, err := LoadConfig([]byte(requesterKeysLocalConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const fp = "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"
+	if !localConfig.Signing.Default.RequesterKeyWhitelist[fp] {
+		t.Fatal("requester key fingerprint was not normalized into the whitelist")
+	}
+
+	if _, err := LoadConfig([]byte(invalidRequesterKeysLocalConfig)); err == nil {
+		t.Fatal("expected an invalid requester key fingerprint to be rejected")
+	}
+}
+
+func TestSubjectInfoAccess(t *testing.T) {
+	valid := `{"signing": {"default": {"usages": ["cert sign"], "expiry": "8h",
+		"subject_info_access": [
+			{"method": "1.3.6.1.5.5.7.48.5", "location": "rsync://repo.example.com/ca/"},
+			{"method": "1.3.6.1.5.5.7.48.3", "location": "http://tsa.example.com/"}
+		]}}}`
+	cfg, err := LoadConfig([]byte(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Signing.Default.SubjectInfoAccess) != 2 {
+		t.Fatalf("expected 2 access descriptions, got %d", len(cfg.Signing.Default.SubjectInfoAccess))
+	}
+
+	for _, ad := range []string{
+		`{"method": "1.2.3.4", "location": "http://tsa.example.com/"}`,
+		`{"method": "1.3.6.1.5.5.7.48", "location": "http://tsa.example.com/"}`,
+		`{"method": "1.3.6.1.5.5.7.48.3", "location": "tsa.example.com"}`,
+		`{"method": "1.3.6.1.5.5.7.48.3", "location": "http://%zz"}`,
+	} {
+		invalid := `{"signing": {"default": {"usages": ["cert sign"], "expiry": "8h",
+			"subject_info_access": [` + ad + `]}}}`
+		if _, err := LoadConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected access description %s to be rejected", ad)
+		}
+	}
+}
+
+func TestAdmissions(t *testing.T) {
+	valid := `{"signing": {"default": {"usages": ["digital signature"], "expiry": "8h",
+		"admissions": [{
+			"naming_authority": {"url": "https://www.gematik.de"},
+			"profession_infos": [{
+				"profession_items": ["Betriebsstätte Arzt"],
+				"profession_oids": ["1.2.276.0.76.4.50"],
+				"registration_number": "1-2-ARZT-1234"
+			}]
+		}]}}}`
+	cfg, err := LoadConfig([]byte(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admissions := cfg.Signing.Default.Admissions
+	if len(admissions) != 1 || len(admissions[0].ProfessionInfos) != 1 {
+		t.Fatalf("unexpected admissions %+v", admissions)
+	}
+	if oids := admissions[0].ProfessionInfos[0].ProfessionOIDs; len(oids) != 1 || asn1.ObjectIdentifier(oids[0]).String() != "1.2.276.0.76.4.50" {
+		t.Errorf("unexpected profession OIDs %v", oids)
+	}
+
+	for _, admission := range []string{
+		`{"profession_infos": []}`,
+		`{"profession_infos": [{"profession_items": []}]}`,
+		`{"profession_infos": [{"profession_items": [""]}]}`,
+		`{"profession_infos": [{"profession_items": ["Arzt"], "profession_oids": ["3.1"]}]}`,
+		`{"profession_infos": [{"profession_items": ["Arzt"], "profession_oids": ["1.40"]}]}`,
+		`{"profession_infos": [{"profession_items": ["Arzt"], "registration_number": "1_2"}]}`,
+		`{"naming_authority": {"url": "www.gematik.de"}, "profession_infos": [{"profession_items": ["Arzt"]}]}`,
+		`{"naming_authority": {"url": "https://gematik.de/ä"}, "profession_infos": [{"profession_items": ["Arzt"]}]}`,
+	} {
+		invalid := `{"signing": {"default": {"usages": ["digital signature"], "expiry": "8h",
+			"admissions": [` + admission + `]}}}`
+		if _, err := LoadConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected admission %s to be rejected", admission)
+		}
+	}
+}
+
+func TestOmitSKIWithCA(t *testing.T) {
+	leaf := `{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "omit_ski": true}}}`
+	if _, err := LoadConfig([]byte(leaf)); err != nil {
+		t.Fatal(err)
+	}
+
+	ca := `{"signing": {"default": {"usages": ["cert sign"], "expiry": "8h", "omit_ski": true,
+		"ca_constraint": {"is_ca": true}}}}`
+	if _, err := LoadConfig([]byte(ca)); err == nil {
+		t.Fatal("expected omit_ski to be rejected for CA certificates")
+	}
+}
+
+func TestAuthorityKeyID(t *testing.T) {
+	for aki, valid := range map[string]bool{
+		"0102030405060708090a0b0c0d0e0f1011121314": true,
+		"01:02:03:04:05:06:07:08":                  true,
+		"01020304":                                 false,
+		"not hex":                                  false,
+	} {
+		cfg := `{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "authority_key_id": "` + aki + `"}}}`
+		_, err := LoadConfig([]byte(cfg))
+		if valid && err != nil {
+			t.Errorf("expected authority_key_id %q to be accepted: %v", aki, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected authority_key_id %q to be rejected", aki)
+		}
+	}
+}
+
+func TestAnyExtKeyUsage(t *testing.T) {
+	anyEKU := `{"signing": {"default": {"usages": ["digital signature", "any"], "expiry": "8h"}}}`
+	if _, err := LoadConfig([]byte(anyEKU)); err != nil {
+		t.Fatal(err)
+	}
+
+	mixed := `{"signing": {"default": {"usages": ["digital signature", "any", "server auth"], "expiry": "8h"}}}`
+	if _, err := LoadConfig([]byte(mixed)); err == nil {
+		t.Fatal("expected the any extended key usage to be rejected alongside other extended key usages")
+	}
+}
+
+func TestStripExtensions(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "strip_extensions": ["2.5.29.17", "2.5.29.31"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stripped := cfg.Signing.Default.StrippedExtensions; len(stripped) != 2 || !stripped["2.5.29.17"] || !stripped["2.5.29.31"] {
+		t.Fatalf("unexpected stripped extensions %v", stripped)
+	}
+
+	for _, cfg := range []string{
+		`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "strip_extensions": ["2.5.29.35"]}}}`,
+		`{"signing": {"default": {"usages": ["cert sign"], "expiry": "8h", "ca_constraint": {"is_ca": true}, "strip_extensions": ["2.5.29.14"]}}}`,
+	} {
+		if _, err := LoadConfig([]byte(cfg)); err == nil {
+			t.Errorf("expected %s to be rejected", cfg)
+		}
+	}
+}
+
+func TestCSRExtensionWhitelist(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "csr_extension_whitelist": ["2.5.29.17", "1.3.6.1.4.1.99999.1"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whitelist := cfg.Signing.Default.CSRExtensionWhitelist; len(whitelist) != 2 || !whitelist["2.5.29.17"] || !whitelist["1.3.6.1.4.1.99999.1"] {
+		t.Fatalf("unexpected CSR extension whitelist %v", whitelist)
+	}
+
+	for _, oid := range []string{"2.5.29.14", "2.5.29.15", "2.5.29.19", "2.5.29.35", "2.5.29.37"} {
+		cfg := `{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "csr_extension_whitelist": ["` + oid + `"]}}}`
+		if _, err := LoadConfig([]byte(cfg)); err == nil {
+			t.Errorf("expected %s to be rejected", cfg)
+		}
+	}
+}
+
+func TestProfileExtensions(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "extensions": [{"id": "1.3.6.1.4.1.99999.1", "critical": true, "value": "BQA="}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exts := cfg.Signing.Default.ExtraExtensions
+	if len(exts) != 1 || exts[0].Id.String() != "1.3.6.1.4.1.99999.1" || !exts[0].Critical || !bytes.Equal(exts[0].Value, []byte{0x05, 0x00}) {
+		t.Fatalf("unexpected extensions %+v", exts)
+	}
+
+	for _, ext := range []string{
+		// Not base64.
+		`{"id": "1.3.6.1.4.1.99999.1", "value": "!"}`,
+		// Not DER.
+		`{"id": "1.3.6.1.4.1.99999.1", "value": "BQ=="}`,
+		// Trailing data.
+		`{"id": "1.3.6.1.4.1.99999.1", "value": "BQAF"}`,
+		// Managed by the signer.
+		`{"id": "2.5.29.19", "value": "MAA="}`,
+		// Given twice.
+		`{"id": "1.3.6.1.4.1.99999.1", "value": "BQA="}, {"id": "1.3.6.1.4.1.99999.1", "value": "BQA="}`,
+	} {
+		cfg := `{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "extensions": [` + ext + `]}}}`
+		if _, err := LoadConfig([]byte(cfg)); err == nil {
+			t.Errorf("expected %s to be rejected", cfg)
+		}
+	}
+
+	mustStaple := `{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "must_staple": true, "extensions": [{"id": "1.3.6.1.5.5.7.1.24", "value": "MAMCAQU="}]}}}`
+	if _, err := LoadConfig([]byte(mustStaple)); err == nil {
+		t.Error("expected a TLS Feature extension to be rejected alongside must_staple")
+	}
+}
+
+func TestAllowedKeyAlgorithms(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "allowed_key_algorithms": ["ECDSA", "ed25519"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := cfg.Signing.Default
+	if allowed := profile.KeyAlgorithmWhitelist; len(allowed) != 2 || !allowed["ecdsa"] || !allowed["ed25519"] {
+		t.Fatalf("unexpected allowed key algorithms %v", allowed)
+	}
+	if !profile.KeyAlgorithmAllowed(&ecdsa.PublicKey{}) {
+		t.Error("expected ECDSA keys to be allowed")
+	}
+	if profile.KeyAlgorithmAllowed(&rsa.PublicKey{}) {
+		t.Error("expected RSA keys to be rejected")
+	}
+	if !(&SigningProfile{}).KeyAlgorithmAllowed(&rsa.PublicKey{}) {
+		t.Error("expected a profile without allowed key algorithms to allow every key")
+	}
+
+	if _, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "allowed_key_algorithms": ["dsa"]}}}`)); err == nil {
+		t.Error("expected an unknown key algorithm to be rejected")
+	}
+}
+
+func TestSerialStrategy(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "serial_strategy": "requested"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Signing.Default.ClientProvidesSerialNumbers {
+		t.Error("expected the requested strategy to require serial numbers from sign requests")
+	}
+
+	if _, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "serial_strategy": "sequential"}}}`)); err != nil {
+		t.Error(err)
+	}
+	if _, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "serial_strategy": "monotonic"}}}`)); err == nil {
+		t.Error("expected an unknown serial strategy to be rejected")
+	}
+}
+
+func TestPolicyHook(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h",
+		"policy_hook": {"url": "https://policy.example.com/decide", "timeout": "2s"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook := cfg.Signing.Default.PolicyHook; hook.Timeout != 2*time.Second || hook.RootCAs != nil {
+		t.Errorf("unexpected policy hook %+v", hook)
+	}
+
+	for _, hook := range []string{
+		`{"url": "http://policy.example.com/decide"}`,
+		`{"url": "https://policy.example.com/decide", "timeout": "-1s"}`,
+		`{"url": "https://policy.example.com/decide", "ca_file": "testdata/missing.pem"}`,
+	} {
+		if _, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "policy_hook": ` + hook + `}}}`)); err == nil {
+			t.Errorf("expected policy hook %s to be rejected", hook)
+		}
+	}
+}
+
+func TestRemotes(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"remote": "ca"},
+		"profiles": {"plain": {"remote": "plain"}}},
+		"remotes": {"ca": "ca1.example.org:8888,ca2.example.org:8888", "plain": "ca1.example.org:8888"},
+		"remote_options": {"ca": {"timeout": "5s", "retries": 3, "backoff": "200ms"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.Signing.Default
+	if p.RemoteServer != "ca1.example.org:8888,ca2.example.org:8888" || p.RemoteTimeout != 5*time.Second ||
+		p.RemoteRetries != 3 || p.RemoteBackoff != 200*time.Millisecond {
+		t.Errorf("unexpected remote %q, timeout %v, retries %d, backoff %v",
+			p.RemoteServer, p.RemoteTimeout, p.RemoteRetries, p.RemoteBackoff)
+	}
+	p = cfg.Signing.Profiles["plain"]
+	if p.RemoteServer != "ca1.example.org:8888" || p.RemoteTimeout != 0 ||
+		p.RemoteRetries != 0 || p.RemoteBackoff != DefaultRemoteBackoff {
+		t.Errorf("unexpected remote %q, timeout %v, retries %d, backoff %v",
+			p.RemoteServer, p.RemoteTimeout, p.RemoteRetries, p.RemoteBackoff)
+	}
+
+	for _, options := range []string{
+		`{"ca": {"timeout": "0s"}}`,
+		`{"ca": {"retries": -1}}`,
+		`{"ca": {"backoff": "soon"}}`,
+		`{"other": {"retries": 1}}`,
+		`{"ca": "ca1.example.org:8888"}`,
+	} {
+		_, err := LoadConfig([]byte(`{"signing": {"default": {"remote": "ca"}},
+			"remotes": {"ca": "ca1.example.org:8888"}, "remote_options": ` + options + `}`))
+		if err == nil {
+			t.Errorf("expected remote options %s to be rejected", options)
+		}
+	}
+}
+
+func TestEventsAuthKey(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"expiry": "1h"}},
+		"auth_keys": {"events": {"type": "api_key", "key": "0123456789abcdef"}},
+		"events_auth_key": "events"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.EventsProvider == nil {
+		t.Fatal("expected an events auth provider")
+	}
+
+	if _, err = LoadConfig([]byte(`{"signing": {"default": {"expiry": "1h"}}, "events_auth_key": "missing"}`)); err == nil {
+		t.Fatal("expected an unknown events auth key to be rejected")
+	}
+}
+
+func TestAuthKeyTypes(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{
+		"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "auth_key": "tenant"}},
+		"auth_keys": {"tenant": {"type": "api_key", "key": "tenant-secret"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Signing.Default.Provider.(*auth.APIKey); !ok {
+		t.Fatalf("expected an API key provider, got %T", cfg.Signing.Default.Provider)
+	}
+
+	_, err = LoadConfig([]byte(`{
+		"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "auth_key": "tenant"}},
+		"auth_keys": {"tenant": {"type": "kerberos", "key": "tenant-secret"}}
+	}`))
+	if err == nil {
+		t.Fatal("expected an unknown authentication type to be rejected")
+	}
+
+	jwtKey := `{"type": "jwt", "key": "file:../testdata/server.crt"`
+	cfg, err = LoadConfig([]byte(`{
+		"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "auth_key": "tenant"}},
+		"auth_keys": {"tenant": ` + jwtKey + `, "audience": "cfssl", "issuer": "https://issuer.example.com"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Signing.Default.Provider.(*auth.JWT); !ok {
+		t.Fatalf("expected a JWT provider, got %T", cfg.Signing.Default.Provider)
+	}
+	_, err = LoadConfig([]byte(`{
+		"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "auth_key": "tenant"}},
+		"auth_keys": {"tenant": ` + jwtKey + `}}
+	}`))
+	if err == nil {
+		t.Fatal("expected a JWT key without an audience and issuer to be rejected")
+	}
+}
+
+func TestNameConstraints(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"usages": ["cert sign"], "expiry": "8h",
+		"ca_constraint": {"is_ca": true}, "name_constraints": {"permitted_dns_domains": [".team.example.com"],
+		"excluded_ip_ranges": ["10.0.0.0/8"]}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template x509.Certificate
+	if err = cfg.Signing.Default.NameConstraints.Apply(&template); err != nil {
+		t.Fatal(err)
+	}
+	if !template.PermittedDNSDomainsCritical || len(template.PermittedDNSDomains) != 1 ||
+		len(template.ExcludedIPRanges) != 1 || template.ExcludedIPRanges[0].String() != "10.0.0.0/8" {
+		t.Fatalf("unexpected name constraints %+v", template)
+	}
+
+	for _, invalid := range []string{
+		`{"signing": {"default": {"usages": ["server auth"], "expiry": "8h", "name_constraints": {"permitted_dns_domains": ["example.com"]}}}}`,
+		`{"signing": {"default": {"usages": ["cert sign"], "expiry": "8h", "ca_constraint": {"is_ca": true}, "name_constraints": {"permitted_ip_ranges": ["10.0.0.1"]}}}}`,
+	} {
+		if _, err := LoadConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, file := range []string{"testdata/valid_config_auth.json", "testdata/valid_config_no_default.json"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := Validate(data); errs != nil {
+			t.Errorf("%s: unexpected errors %v", file, errs)
+		}
+	}
+
+	errs := Validate([]byte(`{
+	"signing": {
+		"default": {
+			"experies": "8h",
+			"usages": ["signing", "bogus"],
+			"expiry": "1x",
+			"auth_remote": {"remote": "ca", "auth_key": "nope"}
+		}
+	},
+	"remotes": {"ca": "127.0.0.1:8888"},
+	"remote_options": {"ca": {"retry": 1}}
+}`))
+	expected := []string{
+		`4:4: signing.default.experies: unknown field "experies"`,
+		`5:26: signing.default.usages[1]: unknown usage "bogus"`,
+		`6:14: signing.default.expiry: invalid duration "1x"`,
+		`7:48: signing.default.auth_remote.auth_key: auth key "nope" is not in the auth_keys section`,
+		`11:28: remote_options.ca.retry: unknown field "retry"`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], err)
+		}
+	}
+
+	for _, data := range []string{
+		`{"signing": {"default": {"expiry": "8h",}}}`,
+		`{"signing": {"default": {"expiry": 8}}}`,
+		`{"signing": {"default": {"usages": ["signing"], "expiry": "8h", "auth_key": "k"}}, "auth_keys": {"k": {"type": "unknown"}}}`,
+	} {
+		if errs = Validate([]byte(data)); len(errs) != 1 {
+			t.Errorf("expected a single error for %s, got %v", data, errs)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	ocspConfig "github.com/cloudflare/cfssl/ocsp/config"
+)
+
+// legacyProfileFields maps signing profile fields used by older
+// configuration files to their current names.
+var legacyProfileFields = map[string]string{
+	"usage":         "usages",
+	"key_usages":    "usages",
+	"ocsp":          "ocsp_url",
+	"crl":           "crl_url",
+	"issuer_url":    "issuer_urls",
+	"auth_key_name": "auth_key",
+	"remote_name":   "remote",
+	"ct_logs":       "ct_log_servers",
+}
+
+// legacyCAConstraintFields lists CA constraint fields that older
+// configuration files set directly on the signing profile rather than
+// in a ca_constraint object.
+var legacyCAConstraintFields = []string{"is_ca", "max_path_len", "max_path_len_zero"}
+
+// Migrate reads a signing configuration written for an older version of
+// CFSSL and rewrites it into the current schema, returning the upgraded
+// JSON. Legacy field names are renamed, profile-level CA constraints are
+// moved into ca_constraint, usages given as a single string or with
+// underscores are normalised, and expiry or backdate values given as a
+// number of seconds are converted to durations. A configuration whose
+// profiles sit at the top level is wrapped in a signing object. Fields
+// that are not part of either schema are reported as an error rather
+// than dropped.
+func Migrate(old []byte) ([]byte, error) {
+	var cfg map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(old))
+	dec.UseNumber()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("failed to unmarshal configuration: "+err.Error()))
+	}
+
+	// Very old configurations held the signing policy at the top level.
+	if _, ok := cfg["signing"]; !ok {
+		signing := map[string]interface{}{}
+		for _, key := range []string{"default", "profiles"} {
+			if v, ok := cfg[key]; ok {
+				signing[key] = v
+				delete(cfg, key)
+			}
+		}
+		if len(signing) > 0 {
+			cfg["signing"] = signing
+		}
+	}
+
+	var unknown []string
+	for key, value := range cfg {
+		switch key {
+		case "signing":
+			signing, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, migrateError("signing: expected an object")
+			}
+			for skey, svalue := range signing {
+				switch skey {
+				case "default":
+					if err := migrateProfile("signing.default", svalue, &unknown); err != nil {
+						return nil, err
+					}
+				case "profiles":
+					profiles, ok := svalue.(map[string]interface{})
+					if !ok {
+						return nil, migrateError("signing.profiles: expected an object")
+					}
+					for name, profile := range profiles {
+						if err := migrateProfile("signing.profiles."+name, profile, &unknown); err != nil {
+							return nil, err
+						}
+					}
+				default:
+					unknown = append(unknown, "signing."+skey)
+				}
+			}
+		case "ocsp":
+			checkFields("ocsp", value, reflect.TypeOf(ocspConfig.Config{}), &unknown)
+		case "auth_keys":
+			keys, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, migrateError("auth_keys: expected an object")
+			}
+			for name, key := range keys {
+				checkFields("auth_keys."+name, key, reflect.TypeOf(AuthKey{}), &unknown)
+			}
+		case "remotes":
+		default:
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, migrateError("unrecognized fields: " + strings.Join(unknown, ", "))
+	}
+
+	return json.MarshalIndent(cfg, "", "  ")
+}
+
+func migrateError(msg string) error {
+	return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("failed to migrate configuration: "+msg))
+}
+
+// migrateProfile rewrites a single signing profile in place.
+func migrateProfile(path string, value interface{}, unknown *[]string) error {
+	profile, ok := value.(map[string]interface{})
+	if !ok {
+		return migrateError(path + ": expected an object")
+	}
+
+	for old, current := range legacyProfileFields {
+		v, ok := profile[old]
+		if !ok {
+			continue
+		}
+		if _, ok := profile[current]; ok {
+			return migrateError(fmt.Sprintf("%s: both %s and %s are set", path, old, current))
+		}
+		profile[current] = v
+		delete(profile, old)
+	}
+
+	for _, field := range legacyCAConstraintFields {
+		v, ok := profile[field]
+		if !ok {
+			continue
+		}
+		constraint, _ := profile["ca_constraint"].(map[string]interface{})
+		if constraint == nil {
+			constraint = map[string]interface{}{}
+			profile["ca_constraint"] = constraint
+		}
+		if _, ok := constraint[field]; !ok {
+			constraint[field] = v
+		}
+		delete(profile, field)
+	}
+
+	if usages, ok := profile["usages"]; ok {
+		migrated, err := migrateUsages(usages)
+		if err != nil {
+			return migrateError(path + ".usages: " + err.Error())
+		}
+		profile["usages"] = migrated
+	}
+
+	if url, ok := profile["issuer_urls"].(string); ok {
+		profile["issuer_urls"] = []interface{}{url}
+	}
+
+	for _, field := range []string{"expiry", "backdate"} {
+		seconds, ok := profile[field].(json.Number)
+		if !ok {
+			continue
+		}
+		n, err := seconds.Int64()
+		if err != nil {
+			return migrateError(fmt.Sprintf("%s.%s: %v", path, field, err))
+		}
+		profile[field] = (time.Duration(n) * time.Second).String()
+	}
+
+	checkFields(path, profile, reflect.TypeOf(SigningProfile{}), unknown)
+	if constraint, ok := profile["ca_constraint"]; ok {
+		checkFields(path+".ca_constraint", constraint, reflect.TypeOf(CAConstraint{}), unknown)
+	}
+	if remote, ok := profile["auth_remote"]; ok {
+		checkFields(path+".auth_remote", remote, reflect.TypeOf(AuthRemote{}), unknown)
+	}
+	return nil
+}
+
+// migrateUsages accepts usages as a list or as a single comma-separated
+// string and rewrites names such as "server_auth" or "Server-Auth" to
+// the spelling expected by KeyUsage and ExtKeyUsage.
+func migrateUsages(value interface{}) ([]interface{}, error) {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		names = strings.Split(v, ",")
+	case []interface{}:
+		for _, name := range v {
+			s, ok := name.(string)
+			if !ok {
+				return nil, errors.New("expected a list of strings")
+			}
+			names = append(names, s)
+		}
+	default:
+		return nil, errors.New("expected a string or a list of strings")
+	}
+
+	var usages []interface{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := KeyUsage[name]; !ok {
+			if _, ok := ExtKeyUsage[name]; !ok {
+				name = strings.NewReplacer("_", " ", "-", " ").Replace(name)
+			}
+		}
+		usages = append(usages, name)
+	}
+	return usages, nil
+}
+
+// checkFields appends to unknown the path of every key of value that
+// doesn't correspond to a field of t, matching names the same way
+// encoding/json does.
+func checkFields(path string, value interface{}, t reflect.Type, unknown *[]string) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for key := range obj {
+		if !hasJSONField(t, key) {
+			*unknown = append(*unknown, path+"."+key)
+		}
+	}
+}
+
+func hasJSONField(t reflect.Type, key string) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const legacyConfig = `{
+	"default": {
+		"usage": "Signing, key_encipherment, Server-Auth",
+		"expiry": 86400
+	},
+	"profiles": {
+		"intermediate": {
+			"key_usages": ["cert sign", "crl_sign"],
+			"is_ca": true,
+			"max_path_len": 0,
+			"max_path_len_zero": true,
+			"issuer_url": "http://ca.example.com/ca.crt",
+			"ocsp": "http://ocsp.example.com",
+			"crl": "http://crl.example.com/ca.crl",
+			"expiry": "43800h"
+		}
+	}
+}`
+
+func TestMigrate(t *testing.T) {
+	migrated, err := Migrate([]byte(legacyConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(migrated)
+	if err != nil {
+		t.Fatalf("migrated configuration failed to load: %v\n%s", err, migrated)
+	}
+
+	def := cfg.Signing.Default
+	if def.Expiry != 24*time.Hour {
+		t.Errorf("expected default expiry of 24h, got %v", def.Expiry)
+	}
+	if strings.Join(def.Usage, ",") != "signing,key encipherment,server auth" {
+		t.Errorf("unexpected default usages %v", def.Usage)
+	}
+
+	intermediate := cfg.Signing.Profiles["intermediate"]
+	if intermediate == nil {
+		t.Fatal("intermediate profile missing after migration")
+	}
+	if !intermediate.CAConstraint.IsCA || !intermediate.CAConstraint.MaxPathLenZero {
+		t.Errorf("CA constraint not migrated: %+v", intermediate.CAConstraint)
+	}
+	if strings.Join(intermediate.Usage, ",") != "cert sign,crl sign" {
+		t.Errorf("unexpected intermediate usages %v", intermediate.Usage)
+	}
+	if len(intermediate.IssuerURL) != 1 || intermediate.IssuerURL[0] != "http://ca.example.com/ca.crt" {
+		t.Errorf("unexpected issuer URLs %v", intermediate.IssuerURL)
+	}
+	if intermediate.OCSP != "http://ocsp.example.com" || intermediate.CRL != "http://crl.example.com/ca.crl" {
+		t.Errorf("OCSP or CRL URL not migrated: %q %q", intermediate.OCSP, intermediate.CRL)
+	}
+
+	// Migrating a current configuration leaves it unchanged.
+	again, err := Migrate(migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(migrated) != string(again) {
+		t.Errorf("migration is not idempotent:\n%s\n%s", migrated, again)
+	}
+}
+
+func TestMigrateUnrecognizedFields(t *testing.T) {
+	old := `{"signing": {"default": {"expiry": "1h", "colour": "blue"},
+		"profiles": {"www": {"usages": ["server auth"], "ca_constraint": {"is_root": true}}}},
+		"extra": 1}`
+
+	_, err := Migrate([]byte(old))
+	if err == nil {
+		t.Fatal("expected unrecognized fields to be reported")
+	}
+	for _, field := range []string{"extra", "signing.default.colour", "signing.profiles.www.ca_constraint.is_root"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected %s to be reported in %v", field, err)
+		}
+	}
+
+	conflict := `{"signing": {"default": {"usage": ["signing"], "usages": ["signing"]}}}`
+	if _, err := Migrate([]byte(conflict)); err == nil {
+		t.Fatal("expected conflicting legacy and current fields to fail")
+	}
+
+	if _, err := Migrate([]byte("not json")); err == nil {
+		t.Fatal("expected invalid JSON to fail")
+	}
+}
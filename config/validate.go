@@ -0,0 +1,294 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// A ValidationError is a problem found in a configuration file by
+// Validate, at the given line and column of the file. Path names the
+// offending entry, such as "signing.profiles.www.expiry".
+type ValidationError struct {
+	Line, Column int
+	Path         string
+	Err          error
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Line == 0:
+		return e.Err.Error()
+	case e.Path == "":
+		return fmt.Sprintf("%d:%d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("%d:%d: %s: %v", e.Line, e.Column, e.Path, e.Err)
+}
+
+// Validate checks the configuration file data more strictly than
+// LoadConfig: keys that aren't configuration fields are rejected instead
+// of being ignored, and so are expiries, usages and references to auth
+// keys and remotes that aren't valid, each located in the file. Once
+// those checks pass, the configuration must also load. Validate returns
+// all the problems found, or nil if there are none.
+func Validate(data []byte) []error {
+	v := &validator{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	v.dec.UseNumber()
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return []error{v.errorAt(syntaxErr.Offset, "", err)}
+		case errors.As(err, &typeErr):
+			// The error is located at the end of the value.
+			v.errs = append(v.errs, v.errorAt(typeErr.Offset, typeErr.Field,
+				fmt.Errorf("cannot be a JSON %s", typeErr.Value)))
+		default:
+			return []error{&ValidationError{Err: err}}
+		}
+	}
+	v.authKeys = cfg.AuthKeys
+	v.remotes = cfg.Remotes
+
+	if _, err := v.value(reflect.TypeOf(cfg), ""); err != nil {
+		return []error{&ValidationError{Err: err}}
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	if _, err := LoadConfig(data); err != nil {
+		return []error{&ValidationError{Err: err}}
+	}
+	return nil
+}
+
+// A validator walks the tokens of a configuration file along with the
+// types they are decoded into.
+type validator struct {
+	data     []byte
+	dec      *json.Decoder
+	errs     []error
+	authKeys map[string]AuthKey
+	remotes  map[string]string
+}
+
+// A node is a value read by a validator: a scalar, an array of them, or
+// nothing for objects.
+type node struct {
+	offset int64
+	scalar interface{}
+	elems  []node
+}
+
+// errorAt returns an error located at offset in the file.
+func (v *validator) errorAt(offset int64, path string, err error) error {
+	if offset > int64(len(v.data)) {
+		offset = int64(len(v.data))
+	}
+	line := 1 + bytes.Count(v.data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(v.data[:offset], '\n')
+	return &ValidationError{Line: line, Column: column, Path: path, Err: err}
+}
+
+func (v *validator) errorf(offset int64, path, format string, args ...interface{}) {
+	v.errs = append(v.errs, v.errorAt(offset, path, fmt.Errorf(format, args...)))
+}
+
+// offset returns the offset of the next token, skipping the whitespace
+// and separators the decoder hasn't consumed yet.
+func (v *validator) offset() int64 {
+	offset := v.dec.InputOffset()
+	for offset < int64(len(v.data)) && strings.IndexByte(" \t\r\n,:", v.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// value reads the next value, to be decoded into a t, and checks the
+// keys of the objects it holds.
+func (v *validator) value(t reflect.Type, path string) (node, error) {
+	n := node{offset: v.offset()}
+	tok, err := v.dec.Token()
+	if err != nil {
+		return n, err
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		switch {
+		case t != nil && t.Kind() == reflect.Map:
+			err = v.object(path, func(key string) (reflect.Type, bool) { return t.Elem(), true }, nil)
+		case t != nil && t.Kind() == reflect.Struct:
+			fields := jsonFields(t)
+			err = v.object(path, func(key string) (reflect.Type, bool) {
+				field, ok := fields.lookup(key)
+				return field.Type, ok
+			}, func(key string, value node, keyPath string) {
+				if field, ok := fields.lookup(key); ok {
+					v.check(t, field.name, value, keyPath)
+				}
+			})
+		default:
+			err = v.object(path, func(string) (reflect.Type, bool) { return nil, true }, nil)
+		}
+	case json.Delim('['):
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := 0; v.dec.More(); i++ {
+			e, err := v.value(elem, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return n, err
+			}
+			n.elems = append(n.elems, e)
+		}
+		_, err = v.dec.Token()
+	default:
+		n.scalar = tok
+	}
+	return n, err
+}
+
+// object reads the members of an object up to its closing brace. The
+// type of each member is given by elem, which reports unknown keys, and
+// each member is handed to check, if set, once read.
+func (v *validator) object(path string, elem func(key string) (reflect.Type, bool), check func(key string, value node, keyPath string)) error {
+	for v.dec.More() {
+		offset := v.offset()
+		tok, err := v.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		t, ok := elem(key)
+		if !ok {
+			v.errorf(offset, keyPath, "unknown field %q", key)
+		}
+		value, err := v.value(t, keyPath)
+		if err != nil {
+			return err
+		}
+		if ok && check != nil {
+			check(key, value, keyPath)
+		}
+	}
+	_, err := v.dec.Token()
+	return err
+}
+
+// check checks the value of the field named name of a t.
+func (v *validator) check(t reflect.Type, name string, value node, path string) {
+	switch t {
+	case reflect.TypeOf(SigningProfile{}):
+		switch name {
+		case "expiry", "backdate":
+			if s, ok := value.scalar.(string); ok {
+				if _, err := time.ParseDuration(s); err != nil {
+					v.errorf(value.offset, path, "invalid duration %q", s)
+				}
+			}
+		case "usages":
+			for i, usage := range value.elems {
+				s, _ := usage.scalar.(string)
+				_, ku := KeyUsage[s]
+				_, eku := ExtKeyUsage[s]
+				if !ku && !eku {
+					v.errorf(usage.offset, fmt.Sprintf("%s[%d]", path, i), "unknown usage %q", s)
+				}
+			}
+		case "auth_key", "prev_auth_key":
+			v.checkAuthKey(value, path)
+		case "remote":
+			v.checkRemote(value, path)
+		}
+	case reflect.TypeOf(Config{}):
+		if name == "events_auth_key" {
+			v.checkAuthKey(value, path)
+		}
+	case reflect.TypeOf(AuthRemote{}):
+		switch name {
+		case "auth_key":
+			v.checkAuthKey(value, path)
+		case "remote":
+			v.checkRemote(value, path)
+		}
+	}
+}
+
+func (v *validator) checkAuthKey(value node, path string) {
+	if s, ok := value.scalar.(string); ok && s != "" {
+		if _, ok = v.authKeys[s]; !ok {
+			v.errorf(value.offset, path, "auth key %q is not in the auth_keys section", s)
+		}
+	}
+}
+
+func (v *validator) checkRemote(value node, path string) {
+	if s, ok := value.scalar.(string); ok && s != "" {
+		if _, ok = v.remotes[s]; !ok {
+			v.errorf(value.offset, path, "remote %q is not in the remotes section", s)
+		}
+	}
+}
+
+// A jsonField is a field of a struct decoded from JSON under name.
+type jsonField struct {
+	name string
+	reflect.StructField
+}
+
+type jsonFieldSet []jsonField
+
+// jsonFields lists the fields encoding/json decodes into a t.
+func jsonFields(t reflect.Type) jsonFieldSet {
+	var fields jsonFieldSet
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name, field})
+	}
+	return fields
+}
+
+// lookup finds the field of key as encoding/json does: by its exact
+// name, or else by a case-insensitive match.
+func (fields jsonFieldSet) lookup(key string) (jsonField, bool) {
+	for _, field := range fields {
+		if field.name == key {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.name, key) {
+			return field, true
+		}
+	}
+	return jsonField{}, false
+}
@@ -3,9 +3,16 @@ package crl
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
 	"math/big"
 	"os"
 	"strconv"
@@ -15,6 +22,7 @@ import (
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/metrics"
 )
 
 // NewCRLFromFile takes in a list of serial numbers, one per line, as well as the issuing certificate
@@ -77,9 +85,30 @@ func NewCRLFromFile(serialList, issuerFile, keyFile []byte, expiryTime string) (
 // NewCRLFromDB takes in a list of CertificateRecords, as well as the issuing certificate
 // of the CRL, and the private key. This function is then used to parse the records and generate a CRL
 func NewCRLFromDB(certs []certdb.CertificateRecord, issuerCert *x509.Certificate, key crypto.Signer, expiryTime time.Duration) ([]byte, error) {
-	var revokedCerts []pkix.RevokedCertificate
+	newExpiryTime := time.Now().Add(expiryTime)
+	return CreateGenericCRL(revokedCertsFromDB(certs), key, issuerCert, newExpiryTime)
+}
 
+// NewDelegatedCRLFromDB is like NewCRLFromDB, but signs the CRL with a
+// delegated CRL signing certificate and key instead of the CA's own key.
+// The issuer of the resulting CRL is still the CA.
+func NewDelegatedCRLFromDB(certs []certdb.CertificateRecord, caCert, delegateCert *x509.Certificate, delegateKey crypto.Signer, expiryTime time.Duration) ([]byte, error) {
 	newExpiryTime := time.Now().Add(expiryTime)
+	return CreateDelegatedCRL(revokedCertsFromDB(certs), delegateKey, delegateCert, caCert, newExpiryTime)
+}
+
+// The OIDs of the CRL entry and CRL extensions of RFC 5280.
+var (
+	reasonCodeOID        = asn1.ObjectIdentifier{2, 5, 29, 21}
+	invalidityDateOID    = asn1.ObjectIdentifier{2, 5, 29, 24}
+	deltaCRLIndicatorOID = asn1.ObjectIdentifier{2, 5, 29, 27}
+)
+
+// revokedCertsFromDB converts a list of CertificateRecords into the
+// revokedCertificate entries of a CRL, with their reason code unless it
+// is unspecified and their invalidity date if they have one.
+func revokedCertsFromDB(certs []certdb.CertificateRecord) []pkix.RevokedCertificate {
+	var revokedCerts []pkix.RevokedCertificate
 
 	// For every record, create a new revokedCertificate and add it to slice
 	for _, certRecord := range certs {
@@ -89,10 +118,104 @@ func NewCRLFromDB(certs []certdb.CertificateRecord, issuerCert *x509.Certificate
 			SerialNumber:   serialInt,
 			RevocationTime: certRecord.RevokedAt,
 		}
+		if certRecord.Reason != 0 {
+			// Marshalling an Enumerated can't fail.
+			value, _ := asn1.Marshal(asn1.Enumerated(certRecord.Reason))
+			tempCert.Extensions = append(tempCert.Extensions, pkix.Extension{Id: reasonCodeOID, Value: value})
+		}
+		if certRecord.InvalidityDate != nil {
+			value, _ := asn1.MarshalWithParams(certRecord.InvalidityDate.UTC(), "generalized")
+			tempCert.Extensions = append(tempCert.Extensions, pkix.Extension{Id: invalidityDateOID, Value: value})
+		}
 		revokedCerts = append(revokedCerts, tempCert)
 	}
 
-	return CreateGenericCRL(revokedCerts, key, issuerCert, newExpiryTime)
+	return revokedCerts
+}
+
+// RevokedSince lists the certificates of certs revoked at or after t, to
+// be listed in a delta CRL based on a full CRL issued at t.
+func RevokedSince(certs []certdb.CertificateRecord, t time.Time) []certdb.CertificateRecord {
+	var revoked []certdb.CertificateRecord
+	for _, certRecord := range certs {
+		if !certRecord.RevokedAt.Before(t) {
+			revoked = append(revoked, certRecord)
+		}
+	}
+	return revoked
+}
+
+// A Template describes a CRL created by NewCRLFromTemplate.
+type Template struct {
+	// Number is the CRL number, or nil for a CRL without one.
+	Number *big.Int
+	// BaseNumber is the number of the full CRL a delta CRL is based
+	// on, or nil for a full CRL.
+	BaseNumber *big.Int
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	// DelegateCert is the delegated CRL signing certificate the CRL is
+	// signed with, or nil if it is signed with the CA key.
+	DelegateCert *x509.Certificate
+}
+
+// NewCRLFromTemplate creates the CRL described by tpl of the revoked
+// certificates in certs, issued by the CA in caCert and signed with key,
+// the key of caCert or of tpl.DelegateCert. Full CRLs signed with the CA
+// key are created as with CreateNumberedCRL, or with CreateGenericCRL if
+// tpl.Number is nil. Delta CRLs must be numbered, and, like delegated
+// CRLs, always follow RFC 5280.
+func NewCRLFromTemplate(certs []certdb.CertificateRecord, caCert *x509.Certificate, key crypto.Signer, tpl Template) ([]byte, error) {
+	certList := revokedCertsFromDB(certs)
+	if tpl.DelegateCert == nil && tpl.BaseNumber == nil {
+		if tpl.Number == nil {
+			return CreateGenericCRL(certList, key, caCert, tpl.NextUpdate)
+		}
+		return CreateNumberedCRL(certList, key, caCert, tpl.Number, tpl.ThisUpdate, tpl.NextUpdate)
+	}
+
+	template := &x509.RevocationList{
+		RevokedCertificates: certList,
+		Number:              tpl.Number,
+		ThisUpdate:          tpl.ThisUpdate,
+		NextUpdate:          tpl.NextUpdate,
+	}
+	if tpl.BaseNumber != nil {
+		if tpl.Number == nil {
+			return nil, errors.New("delta CRLs must be numbered")
+		}
+		value, err := asn1.Marshal(tpl.BaseNumber)
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: deltaCRLIndicatorOID, Critical: true, Value: value}}
+	}
+
+	issuer := caCert
+	if tpl.DelegateCert != nil {
+		if err := ValidateDelegatedSigner(tpl.DelegateCert, caCert); err != nil {
+			log.Debugf("invalid delegated CRL signer: %s", err)
+			return nil, err
+		}
+		// As in CreateDelegatedCRL, sign with a copy of the delegated
+		// certificate carrying the CA's subject.
+		delegate := *tpl.DelegateCert
+		delegate.Subject = caCert.Subject
+		delegate.RawSubject = caCert.RawSubject
+		issuer = &delegate
+		if template.Number == nil {
+			template.Number = big.NewInt(tpl.ThisUpdate.UnixNano())
+		}
+	}
+
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	if err != nil {
+		log.Debugf("error creating CRL: %s", err)
+	} else {
+		metrics.CRLGenerations.Inc()
+	}
+
+	return crlBytes, err
 }
 
 // CreateGenericCRL is a helper function that takes in all of the information above, and then calls the createCRL
@@ -101,8 +224,159 @@ func CreateGenericCRL(certList []pkix.RevokedCertificate, key crypto.Signer, iss
 	crlBytes, err := issuingCert.CreateCRL(rand.Reader, key, certList, time.Now(), expiryTime)
 	if err != nil {
 		log.Debugf("error creating CRL: %s", err)
+	} else {
+		metrics.CRLGenerations.Inc()
 	}
 
 	return crlBytes, err
 
 }
+
+// CreateNumberedCRL is like CreateGenericCRL, but takes the CRL's
+// thisUpdate time and CRL number. The number is only embedded in the CRL
+// when issuingCert may sign RFC 5280 CRLs, that is when it carries the
+// cRLSign key usage and a subject key identifier; otherwise the CRL is
+// created without one, as CreateGenericCRL does.
+func CreateNumberedCRL(certList []pkix.RevokedCertificate, key crypto.Signer, issuingCert *x509.Certificate, number *big.Int, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	var crlBytes []byte
+	var err error
+	if issuingCert.KeyUsage&x509.KeyUsageCRLSign != 0 && len(issuingCert.SubjectKeyId) != 0 {
+		crlBytes, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			RevokedCertificates: certList,
+			Number:              number,
+			ThisUpdate:          thisUpdate,
+			NextUpdate:          nextUpdate,
+		}, issuingCert, key)
+	} else {
+		crlBytes, err = issuingCert.CreateCRL(rand.Reader, key, certList, thisUpdate, nextUpdate)
+	}
+	if err != nil {
+		log.Debugf("error creating CRL: %s", err)
+	} else {
+		metrics.CRLGenerations.Inc()
+	}
+
+	return crlBytes, err
+}
+
+// NewNumberedCRLFromDB is like NewCRLFromDB, but creates the CRL with
+// CreateNumberedCRL.
+func NewNumberedCRLFromDB(certs []certdb.CertificateRecord, issuerCert *x509.Certificate, key crypto.Signer, number *big.Int, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	return CreateNumberedCRL(revokedCertsFromDB(certs), key, issuerCert, number, thisUpdate, nextUpdate)
+}
+
+// ValidateDelegatedSigner checks that delegateCert may sign CRLs on behalf
+// of caCert: it must carry the cRLSign key usage, must not be the CA
+// certificate itself, and must be issued by caCert.
+func ValidateDelegatedSigner(delegateCert, caCert *x509.Certificate) error {
+	if delegateCert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return errors.New("delegated CRL signer is missing the cRLSign key usage")
+	}
+
+	if delegateCert.Equal(caCert) {
+		return errors.New("delegated CRL signer must be distinct from the CA certificate")
+	}
+
+	if err := delegateCert.CheckSignatureFrom(caCert); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateDelegatedCRL creates a CRL for the CA in caCert that is signed by
+// the delegated CRL signing certificate and key. The CRL's issuer is the
+// CA's subject, while its authority key identifier names the delegated
+// key so that relying parties can locate the certificate that verifies it.
+func CreateDelegatedCRL(certList []pkix.RevokedCertificate, key crypto.Signer, delegateCert, caCert *x509.Certificate, expiryTime time.Time) ([]byte, error) {
+	if err := ValidateDelegatedSigner(delegateCert, caCert); err != nil {
+		log.Debugf("invalid delegated CRL signer: %s", err)
+		return nil, err
+	}
+
+	// CreateRevocationList takes the CRL issuer from the subject of the
+	// signing certificate, so sign with a copy of the delegated certificate
+	// that carries the CA's subject instead.
+	issuer := *delegateCert
+	issuer.Subject = caCert.Subject
+	issuer.RawSubject = caCert.RawSubject
+
+	now := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificates: certList,
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now,
+		NextUpdate:          expiryTime,
+	}
+
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, template, &issuer, key)
+	if err != nil {
+		log.Debugf("error creating delegated CRL: %s", err)
+	} else {
+		metrics.CRLGenerations.Inc()
+	}
+
+	return crlBytes, err
+}
+
+// NewDelegatedSigner generates a new ECDSA P-256 key and a certificate for
+// it, issued by caCert and restricted to the cRLSign key usage, that can be
+// used with CreateDelegatedCRL. The certificate and key are returned PEM
+// encoded.
+func NewDelegatedSigner(caCert *x509.Certificate, caKey crypto.Signer, expiry time.Duration) (certPEM, keyPEM []byte, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(pubDER, &spki); err != nil {
+		return nil, nil, err
+	}
+	ski := sha1.Sum(spki.SubjectPublicKey.Bytes)
+
+	serialNumber := make([]byte, 20)
+	if _, err = io.ReadFull(rand.Reader, serialNumber); err != nil {
+		return nil, nil, err
+	}
+	serialNumber[0] &= 0x7F
+
+	subject := caCert.Subject
+	subject.CommonName = strings.TrimSpace(caCert.Subject.CommonName + " CRL Signer")
+	subject.ExtraNames = nil
+
+	notBefore := time.Now().Round(time.Minute).Add(-5 * time.Minute).UTC()
+	template := &x509.Certificate{
+		SerialNumber:          new(big.Int).SetBytes(serialNumber),
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(expiry),
+		KeyUsage:              x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          ski[:],
+	}
+	if template.NotAfter.After(caCert.NotAfter) {
+		template.NotAfter = caCert.NotAfter
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, priv.Public(), caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
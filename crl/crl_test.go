@@ -1,9 +1,17 @@
 package crl
 
 import (
+	"bytes"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"io/ioutil"
+	"math/big"
 	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 const (
@@ -75,3 +83,184 @@ func TestNewCRLFromFileWithoutRevocations(t *testing.T) {
 		t.Fatal("Wrong number of expired certificates")
 	}
 }
+
+func TestCreateDelegatedCRL(t *testing.T) {
+	caBytes, err := ioutil.ReadFile(tryTwoCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKeyBytes, err := ioutil.ReadFile(tryTwoKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := helpers.ParseCertificatePEM(caBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := helpers.ParsePrivateKeyPEM(caKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delegatePEM, delegateKeyPEM, err := NewDelegatedSigner(caCert, caKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegateCert, err := helpers.ParseCertificatePEM(delegatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegateKey, err := helpers.ParsePrivateKeyPEM(delegateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delegateCert.KeyUsage != x509.KeyUsageCRLSign {
+		t.Fatalf("delegated signer should only have the cRLSign key usage, got %v", delegateCert.KeyUsage)
+	}
+
+	revoked := []pkix.RevokedCertificate{
+		{SerialNumber: big.NewInt(1), RevocationTime: time.Now()},
+	}
+	crlBytes, err := CreateDelegatedCRL(revoked, delegateKey, delegateCert, caCert, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crl, err := x509.ParseRevocationList(crlBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(crl.RawIssuer, caCert.RawSubject) {
+		t.Fatal("delegated CRL issuer should be the CA")
+	}
+	if !bytes.Equal(crl.AuthorityKeyId, delegateCert.SubjectKeyId) {
+		t.Fatal("delegated CRL authority key identifier should name the delegated key")
+	}
+	if err := delegateCert.CheckSignature(crl.SignatureAlgorithm, crl.RawTBSRevocationList, crl.Signature); err != nil {
+		t.Fatalf("delegated CRL signature does not verify: %v", err)
+	}
+	if err := delegateCert.CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("delegated signer does not chain to the CA: %v", err)
+	}
+	if err := caCert.CheckSignature(crl.SignatureAlgorithm, crl.RawTBSRevocationList, crl.Signature); err == nil {
+		t.Fatal("delegated CRL should not be signed by the CA key")
+	}
+}
+
+func TestCreateDelegatedCRLWithoutCRLSign(t *testing.T) {
+	caBytes, err := ioutil.ReadFile(tryTwoCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := helpers.ParseCertificatePEM(caBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafBytes, err := ioutil.ReadFile("testdata/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, err := helpers.ParseCertificatePEM(leafBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert.KeyUsage &^= x509.KeyUsageCRLSign
+
+	if err := ValidateDelegatedSigner(leafCert, caCert); err == nil {
+		t.Fatal("expected a delegated signer without cRLSign to be rejected")
+	}
+}
+
+func TestNewCRLFromTemplate(t *testing.T) {
+	cert, key := loadMergeCA(t)
+
+	invalidityDate := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	certs := []certdb.CertificateRecord{
+		{Serial: "1", RevokedAt: revokedAt.Add(-time.Hour)},
+		{Serial: "2", RevokedAt: revokedAt, Reason: 1, InvalidityDate: &invalidityDate},
+	}
+
+	now := time.Now()
+	der, err := NewCRLFromTemplate(certs, cert, key, Template{
+		Number:     big.NewInt(7),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Number.Int64() != 7 || len(list.RevokedCertificateEntries) != 2 {
+		t.Fatalf("unexpected CRL number %v or entries %+v", list.Number, list.RevokedCertificateEntries)
+	}
+	for _, entry := range list.RevokedCertificateEntries {
+		switch entry.SerialNumber.Int64() {
+		case 1:
+			if entry.ReasonCode != 0 || len(entry.Extensions) != 0 {
+				t.Errorf("expected no entry extensions for serial 1, got %+v", entry.Extensions)
+			}
+		case 2:
+			if entry.ReasonCode != 1 {
+				t.Errorf("expected reason code 1 for serial 2, got %d", entry.ReasonCode)
+			}
+			var found bool
+			for _, ext := range entry.Extensions {
+				if ext.Id.Equal(invalidityDateOID) {
+					var got time.Time
+					if _, err := asn1.UnmarshalWithParams(ext.Value, &got, "generalized"); err != nil || !got.Equal(invalidityDate) {
+						t.Errorf("unexpected invalidity date %v (%v)", got, err)
+					}
+					found = true
+				}
+			}
+			if !found {
+				t.Error("expected an invalidity date for serial 2")
+			}
+		}
+	}
+
+	// A delta CRL only lists the certificates revoked since its base.
+	delta := RevokedSince(certs, revokedAt)
+	if len(delta) != 1 || delta[0].Serial != "2" {
+		t.Fatalf("unexpected certificates revoked since the base CRL: %+v", delta)
+	}
+	der, err = NewCRLFromTemplate(delta, cert, key, Template{
+		Number:     big.NewInt(8),
+		BaseNumber: big.NewInt(7),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, err = x509.ParseRevocationList(der); err != nil {
+		t.Fatal(err)
+	}
+	var base *big.Int
+	for _, ext := range list.Extensions {
+		if ext.Id.Equal(deltaCRLIndicatorOID) {
+			if !ext.Critical {
+				t.Error("expected a critical delta CRL indicator")
+			}
+			base = new(big.Int)
+			if _, err = asn1.Unmarshal(ext.Value, &base); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if base == nil || base.Int64() != 7 {
+		t.Fatalf("expected a delta CRL of CRL 7, got %v", base)
+	}
+
+	if _, err = NewCRLFromTemplate(delta, cert, key, Template{BaseNumber: big.NewInt(7), NextUpdate: now.Add(time.Hour)}); err == nil {
+		t.Fatal("expected an unnumbered delta CRL to fail")
+	}
+}
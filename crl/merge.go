@@ -0,0 +1,155 @@
+package crl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/metrics"
+)
+
+// ParseCRL parses a CRL given either as DER or as a PEM "X509 CRL" block.
+func ParseCRL(data []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, errors.New("unexpected PEM block type " + block.Type + ", expected X509 CRL")
+		}
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
+
+// MergeCRLs combines lists into a single CRL. Each list must have been
+// issued and signed by one of the certificates in issuers. If every list
+// has the same issuer, their entries are merged into a new CRL signed by
+// key, which must belong to that issuer. Revocation times, reason codes
+// and other entry extensions are carried over unchanged; a serial number
+// revoked in several lists keeps its earliest revocation. The new CRL's
+// number is greater than that of any of the lists and it is valid until
+// nextUpdate.
+//
+// If the lists have different issuers, MergeCRLs fails unless allowMixed
+// is set, in which case the DER encoded lists are returned unchanged as
+// an ASN.1 SEQUENCE of CertificateList and key is not used.
+func MergeCRLs(lists []*x509.RevocationList, issuers []*x509.Certificate, key crypto.Signer, nextUpdate time.Time, allowMixed bool) ([]byte, error) {
+	if len(lists) == 0 {
+		return nil, errors.New("no CRLs to merge")
+	}
+
+	var issuer *x509.Certificate
+	mixed := false
+	for i, list := range lists {
+		listIssuer, err := findCRLIssuer(list, issuers)
+		if err != nil {
+			log.Debugf("CRL %d failed validation: %v", i, err)
+			return nil, err
+		}
+		if issuer == nil {
+			issuer = listIssuer
+		} else if !issuer.Equal(listIssuer) {
+			mixed = true
+		}
+	}
+
+	if mixed {
+		if !allowMixed {
+			return nil, errors.New("CRLs have different issuers")
+		}
+		return concatenateCRLs(lists)
+	}
+
+	if key == nil {
+		return nil, errors.New("a signing key is required to merge CRLs")
+	}
+	if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(issuer.PublicKey) {
+		return nil, errors.New("signing key does not match the CRL issuer")
+	}
+
+	number := big.NewInt(time.Now().UnixNano())
+	seen := map[string]int{}
+	var entries []x509.RevocationListEntry
+	for _, list := range lists {
+		if list.Number != nil && list.Number.Cmp(number) >= 0 {
+			number = new(big.Int).Add(list.Number, big.NewInt(1))
+		}
+		for _, entry := range list.RevokedCertificateEntries {
+			serial := entry.SerialNumber.String()
+			if i, ok := seen[serial]; ok {
+				if entry.RevocationTime.Before(entries[i].RevocationTime) {
+					entries[i] = mergedEntry(entry)
+				}
+				continue
+			}
+			seen[serial] = len(entries)
+			entries = append(entries, mergedEntry(entry))
+		}
+	}
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    number,
+		ThisUpdate:                time.Now(),
+		NextUpdate:                nextUpdate,
+	}
+
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	if err != nil {
+		log.Debugf("error creating merged CRL: %s", err)
+	} else {
+		metrics.CRLGenerations.Inc()
+	}
+
+	return crlBytes, err
+}
+
+// findCRLIssuer returns the certificate in issuers whose subject matches
+// the issuer of list and whose key verifies its signature.
+func findCRLIssuer(list *x509.RevocationList, issuers []*x509.Certificate) (*x509.Certificate, error) {
+	for _, cert := range issuers {
+		if !bytes.Equal(list.RawIssuer, cert.RawSubject) {
+			continue
+		}
+		if err := list.CheckSignatureFrom(cert); err != nil {
+			return nil, err
+		}
+		return cert, nil
+	}
+	return nil, errors.New("no issuer certificate found for CRL issued by " + list.Issuer.String())
+}
+
+// oidReasonCode is the OID of the CRL entry reasonCode extension, which is
+// encoded from the ReasonCode field of an entry.
+var oidReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// mergedEntry copies a parsed CRL entry so that it is re-encoded with its
+// original reason code and extensions.
+func mergedEntry(entry x509.RevocationListEntry) x509.RevocationListEntry {
+	merged := x509.RevocationListEntry{
+		SerialNumber:   entry.SerialNumber,
+		RevocationTime: entry.RevocationTime,
+		ReasonCode:     entry.ReasonCode,
+	}
+	for _, ext := range entry.Extensions {
+		if !ext.Id.Equal(oidReasonCode) {
+			merged.ExtraExtensions = append(merged.ExtraExtensions, ext)
+		}
+	}
+	return merged
+}
+
+// concatenateCRLs encodes lists as an ASN.1 SEQUENCE of their DER
+// encodings.
+func concatenateCRLs(lists []*x509.RevocationList) ([]byte, error) {
+	raw := make([]asn1.RawValue, len(lists))
+	for i, list := range lists {
+		raw[i] = asn1.RawValue{FullBytes: list.Raw}
+	}
+	return asn1.Marshal(raw)
+}
@@ -0,0 +1,171 @@
+package crl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func loadMergeCA(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	certBytes, err := ioutil.ReadFile(tryTwoCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := ioutil.ReadFile(tryTwoKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func newTestCRL(t *testing.T, issuer *x509.Certificate, key crypto.Signer, number int64, entries []x509.RevocationListEntry) *x509.RevocationList {
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestMergeCRLs(t *testing.T) {
+	caCert, caKey := loadMergeCA(t)
+
+	revokedAt := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	invalidity, err := asn1.Marshal(revokedAt.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidityDate := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 24}, Value: invalidity}
+
+	first := newTestCRL(t, caCert, caKey, 1, []x509.RevocationListEntry{
+		{SerialNumber: big.NewInt(1), RevocationTime: revokedAt, ReasonCode: 1, ExtraExtensions: []pkix.Extension{invalidityDate}},
+		{SerialNumber: big.NewInt(2), RevocationTime: revokedAt.Add(time.Hour)},
+	})
+	second := newTestCRL(t, caCert, caKey, 5, []x509.RevocationListEntry{
+		{SerialNumber: big.NewInt(2), RevocationTime: revokedAt, ReasonCode: 4},
+		{SerialNumber: big.NewInt(3), RevocationTime: revokedAt, ReasonCode: 5},
+	})
+
+	der, err := MergeCRLs([]*x509.RevocationList{first, second}, []*x509.Certificate{caCert}, caKey, time.Now().Add(time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := ParseCRL(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merged.CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("merged CRL does not verify: %v", err)
+	}
+	if merged.Number.Cmp(second.Number) <= 0 {
+		t.Errorf("expected the merged CRL number to exceed %v, got %v", second.Number, merged.Number)
+	}
+
+	entries := map[int64]x509.RevocationListEntry{}
+	for _, entry := range merged.RevokedCertificateEntries {
+		entries[entry.SerialNumber.Int64()] = entry
+	}
+	if len(entries) != 3 || len(merged.RevokedCertificateEntries) != 3 {
+		t.Fatalf("expected 3 distinct revoked serials, got %d entries", len(merged.RevokedCertificateEntries))
+	}
+
+	if e := entries[1]; e.ReasonCode != 1 || !e.RevocationTime.Equal(revokedAt) {
+		t.Errorf("entry 1 not preserved: %+v", e)
+	}
+	var found bool
+	for _, ext := range entries[1].Extensions {
+		if ext.Id.Equal(invalidityDate.Id) && bytes.Equal(ext.Value, invalidityDate.Value) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("invalidity date extension not preserved")
+	}
+	// Serial 2 appears in both lists; the earlier revocation wins.
+	if e := entries[2]; e.ReasonCode != 4 || !e.RevocationTime.Equal(revokedAt) {
+		t.Errorf("expected the earliest revocation of serial 2, got %+v", e)
+	}
+	if e := entries[3]; e.ReasonCode != 5 {
+		t.Errorf("entry 3 reason not preserved: %+v", e)
+	}
+}
+
+func TestMergeCRLsValidation(t *testing.T) {
+	caCert, caKey := loadMergeCA(t)
+	list := newTestCRL(t, caCert, caKey, 1, nil)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Other CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	otherDER, err := x509.CreateCertificate(rand.Reader, template, template, otherKey.Public(), otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, err := x509.ParseCertificate(otherDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestCRL(t, otherCert, otherKey, 1, nil)
+
+	if _, err := MergeCRLs([]*x509.RevocationList{list}, []*x509.Certificate{otherCert}, caKey, time.Now(), false); err == nil {
+		t.Error("expected a CRL without a known issuer to be rejected")
+	}
+	if _, err := MergeCRLs([]*x509.RevocationList{list}, []*x509.Certificate{caCert}, otherKey, time.Now(), false); err == nil {
+		t.Error("expected a key that doesn't match the issuer to be rejected")
+	}
+
+	lists := []*x509.RevocationList{list, other}
+	issuers := []*x509.Certificate{caCert, otherCert}
+	if _, err := MergeCRLs(lists, issuers, caKey, time.Now(), false); err == nil {
+		t.Error("expected CRLs with different issuers to be rejected")
+	}
+
+	der, err := MergeCRLs(lists, issuers, nil, time.Now(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 2 || !bytes.Equal(raw[0].FullBytes, list.Raw) || !bytes.Equal(raw[1].FullBytes, other.Raw) {
+		t.Error("expected mixed issuer CRLs to be concatenated unchanged")
+	}
+}
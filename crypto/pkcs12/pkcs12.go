@@ -0,0 +1,679 @@
+// Package pkcs12 encodes and decodes the PKCS #12 files, or PFX, holding
+// a private key along with its certificate and chain, as defined in
+// RFC 7292.
+//
+// Files are encoded with the algorithms OpenSSL 3 uses by default rather
+// than the legacy ones of earlier versions: the key and certificates are
+// encrypted with AES-256-CBC under a PBKDF2-HMAC-SHA256 key (PBES2, RFC
+// 8018), and the integrity of the file is protected by an HMAC-SHA256.
+// Files encrypted with PBES2 are decoded by this package, and files using
+// the legacy algorithms, such as 40-bit RC2 or 3DES, by
+// golang.org/x/crypto/pkcs12.
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io"
+	"reflect"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+	legacy "golang.org/x/crypto/pkcs12"
+)
+
+// Iterations is the number of iterations of PBKDF2 and of the MAC key
+// derivation in the files encoded by Encode, as in OpenSSL 3.
+const Iterations = 2048
+
+// MaxIterations bounds the iteration counts of PBKDF2 and of the MAC key
+// derivation that Decode accepts, so that a crafted file can't make it
+// spin for hours.
+const MaxIterations = 1 << 20
+
+// ErrIncorrectPassword is returned by Decode when the MAC of the file
+// doesn't match, which is almost always because of a wrong password.
+var ErrIncorrectPassword = errors.New("pkcs12: decryption password incorrect")
+
+// errLegacy is returned while decoding a file using an algorithm other
+// than PBES2, to fall back to golang.org/x/crypto/pkcs12.
+var errLegacy = errors.New("pkcs12: legacy algorithm")
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// Encode encodes key, its certificate cert and the certificates of its
+// chain caCerts into a PKCS #12 file protected by password. The salts
+// and IVs are read from rand.
+func Encode(rand io.Reader, key crypto.Signer, cert *x509.Certificate, caCerts []*x509.Certificate, password string) ([]byte, error) {
+	if !publicKeysEqual(key.Public(), cert.PublicKey) {
+		return nil, errors.New("pkcs12: the private key doesn't match the certificate")
+	}
+	localKeyID := sha1.Sum(cert.Raw)
+	keyIDAttribute, err := localKeyIDAttribute(localKeyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, c := range append([]*x509.Certificate{cert}, caCerts...) {
+		bag, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: c.Raw})
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, safeBag{ID: oidCertBag, Value: explicit(bag)})
+		if i == 0 {
+			certBags[0].Attributes = []pkcs12Attribute{keyIDAttribute}
+		}
+	}
+	certsDER, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	certsAlgorithm, encryptedCerts, err := encrypt(rand, certsDER, password)
+	if err != nil {
+		return nil, err
+	}
+	certsContent, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: certsAlgorithm,
+			EncryptedContent:           encryptedCerts,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyAlgorithm, encryptedKey, err := encrypt(rand, pkcs8, password)
+	if err != nil {
+		return nil, err
+	}
+	shroudedKey, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: keyAlgorithm, EncryptedData: encryptedKey})
+	if err != nil {
+		return nil, err
+	}
+	keyBags, err := asn1.Marshal([]safeBag{{
+		ID:         oidPKCS8ShroudedKeyBag,
+		Value:      explicit(shroudedKey),
+		Attributes: []pkcs12Attribute{keyIDAttribute},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	keyContent, err := asn1.Marshal(keyBags)
+	if err != nil {
+		return nil, err
+	}
+
+	authSafe, err := asn1.Marshal([]contentInfo{
+		{ContentType: oidEncryptedData, Content: explicit(certsContent)},
+		{ContentType: oidData, Content: explicit(keyContent)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	authSafeContent, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := macData{MacSalt: make([]byte, 8), Iterations: Iterations}
+	if _, err = io.ReadFull(rand, mac.MacSalt); err != nil {
+		return nil, err
+	}
+	mac.Mac.Algorithm = pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	if mac.Mac.Digest, err = computeMac(&mac, authSafe, password, false); err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidData, Content: explicit(authSafeContent)},
+		MacData:  mac,
+	})
+}
+
+// Decode decodes the PKCS #12 file pfxData protected by password. It
+// returns the private key it holds, if any, and its certificates: the
+// one of the key, or the first one if there is no key, and the others.
+func Decode(pfxData []byte, password string) (key crypto.Signer, cert *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	var keys []interface{}
+	var certs []*x509.Certificate
+	keys, certs, err = decode(pfxData, password)
+	if err == errLegacy {
+		keys, certs, err = decodeLegacy(pfxData, password)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(keys) > 1 {
+		return nil, nil, nil, errors.New("pkcs12: expected at most one private key")
+	}
+	if len(certs) == 0 {
+		return nil, nil, nil, errors.New("pkcs12: certificate missing")
+	}
+	leaf := 0
+	if len(keys) == 1 {
+		var ok bool
+		if key, ok = keys[0].(crypto.Signer); !ok {
+			return nil, nil, nil, errors.New("pkcs12: unsupported private key type")
+		}
+		leaf = -1
+		for i, c := range certs {
+			if publicKeysEqual(key.Public(), c.PublicKey) {
+				leaf = i
+				break
+			}
+		}
+		if leaf < 0 {
+			return nil, nil, nil, errors.New("pkcs12: no certificate matches the private key")
+		}
+	}
+
+	cert = certs[leaf]
+	caCerts = append(certs[:leaf:leaf], certs[leaf+1:]...)
+	return key, cert, caCerts, nil
+}
+
+// decode decodes the keys and certificates of pfxData, or returns
+// errLegacy if it uses an algorithm other than PBES2 for encryption.
+func decode(pfxData []byte, password string) (keys []interface{}, certs []*x509.Certificate, err error) {
+	var pfx pfxPdu
+	if err = unmarshal(pfxData, &pfx); err != nil {
+		return nil, nil, errors.New("pkcs12: error reading PKCS #12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, nil, errors.New("pkcs12: only version 3 is supported")
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidData) {
+		return nil, nil, errors.New("pkcs12: only password-protected PKCS #12 is supported")
+	}
+	var authSafe []byte
+	if err = unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, nil, err
+	}
+
+	// Without a MAC, nothing binds the contents to the password.
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
+		return nil, nil, errors.New("pkcs12: no MAC in data")
+	}
+	if err = verifyMac(&pfx.MacData, authSafe, password); err != nil {
+		return nil, nil, err
+	}
+
+	var contents []contentInfo
+	if err = unmarshal(authSafe, &contents); err != nil {
+		return nil, nil, err
+	}
+	for _, ci := range contents {
+		var data []byte
+		switch {
+		case ci.ContentType.Equal(oidData):
+			if err = unmarshal(ci.Content.Bytes, &data); err != nil {
+				return nil, nil, err
+			}
+		case ci.ContentType.Equal(oidEncryptedData):
+			var ed encryptedData
+			if err = unmarshal(ci.Content.Bytes, &ed); err != nil {
+				return nil, nil, err
+			}
+			info := ed.EncryptedContentInfo
+			if data, err = decrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, password); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, errors.New("pkcs12: unsupported content type " + ci.ContentType.String())
+		}
+
+		var bags []safeBag
+		if err = unmarshal(data, &bags); err != nil {
+			return nil, nil, err
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cb certBag
+				if err = unmarshal(bag.Value.Bytes, &cb); err != nil {
+					return nil, nil, err
+				}
+				if !cb.ID.Equal(oidX509Certificate) {
+					continue
+				}
+				cert, err := x509.ParseCertificate(cb.Data)
+				if err != nil {
+					return nil, nil, err
+				}
+				certs = append(certs, cert)
+			case bag.ID.Equal(oidKeyBag):
+				key, err := x509.ParsePKCS8PrivateKey(bag.Value.Bytes)
+				if err != nil {
+					return nil, nil, err
+				}
+				keys = append(keys, key)
+			case bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				var info encryptedPrivateKeyInfo
+				if err = unmarshal(bag.Value.Bytes, &info); err != nil {
+					return nil, nil, err
+				}
+				pkcs8, err := decrypt(info.Algorithm, info.EncryptedData, password)
+				if err != nil {
+					return nil, nil, err
+				}
+				key, err := x509.ParsePKCS8PrivateKey(pkcs8)
+				if err != nil {
+					return nil, nil, err
+				}
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, certs, nil
+}
+
+// decodeLegacy decodes the keys and certificates of a pfxData encrypted
+// with legacy algorithms, using golang.org/x/crypto/pkcs12.
+func decodeLegacy(pfxData []byte, password string) (keys []interface{}, certs []*x509.Certificate, err error) {
+	blocks, err := legacy.ToPEM(pfxData, password)
+	if err != nil {
+		if err == legacy.ErrIncorrectPassword {
+			return nil, nil, ErrIncorrectPassword
+		}
+		return nil, nil, err
+	}
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			key, err := parsePrivateKey(block)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, certs, nil
+}
+
+// parsePrivateKey parses a private key block of ToPEM, which converts
+// RSA and ECDSA keys out of PKCS #8.
+func parsePrivateKey(block *pem.Block) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// encrypt encrypts data with PBES2, using AES-256-CBC under a key derived
+// from password with PBKDF2-HMAC-SHA256.
+func encrypt(rand io.Reader, data []byte, password string) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(password), salt, Iterations, 32, sha256.New))
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	out := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}, out, nil
+}
+
+// decrypt decrypts data encrypted with PBES2, or returns errLegacy for
+// other algorithms.
+func decrypt(algorithm pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errLegacy
+	}
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("pkcs12: unsupported key derivation function " + params.KeyDerivationFunc.Algorithm.String())
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, err
+	}
+	if kdfParams.Iterations < 1 || kdfParams.Iterations > MaxIterations {
+		return nil, errors.New("pkcs12: invalid PBKDF2 iteration count")
+	}
+
+	var prf func() hash.Hash
+	switch alg := kdfParams.PRF.Algorithm; {
+	case len(alg) == 0 || alg.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.New("pkcs12: unsupported PBKDF2 function " + alg.String())
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, errors.New("pkcs12: unsupported encryption scheme " + alg.String())
+	}
+	var iv []byte
+	if err := unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("pkcs12: invalid encrypted data")
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(password), kdfParams.Salt, kdfParams.Iterations, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassword
+	}
+	return out[:len(out)-padding], nil
+}
+
+// verifyMac checks the MAC of authSafe. As some implementations derive
+// the MAC key of an empty password from no bytes at all rather than from
+// an empty BMPString, both are tried for an empty password.
+func verifyMac(mac *macData, authSafe []byte, password string) error {
+	if mac.Iterations < 1 || mac.Iterations > MaxIterations {
+		return errors.New("pkcs12: invalid MAC iteration count")
+	}
+	for _, nullEmpty := range []bool{false, true} {
+		if nullEmpty && password != "" {
+			break
+		}
+		expected, err := computeMac(mac, authSafe, password, nullEmpty)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(expected, mac.Mac.Digest) == 1 {
+			return nil
+		}
+	}
+	return ErrIncorrectPassword
+}
+
+// computeMac computes the HMAC of authSafe keyed as in RFC 7292 appendix
+// B: with the PKCS #12 key derivation of password, as a BMPString, or as
+// no bytes at all if nullEmpty is set.
+func computeMac(mac *macData, authSafe []byte, password string, nullEmpty bool) ([]byte, error) {
+	var h func() hash.Hash
+	var v int
+	switch alg := mac.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		h, v = sha1.New, 64
+	case alg.Equal(oidSHA256):
+		h, v = sha256.New, 64
+	case alg.Equal(oidSHA384):
+		h, v = sha512.New384, 128
+	case alg.Equal(oidSHA512):
+		h, v = sha512.New, 128
+	default:
+		return nil, errors.New("pkcs12: unsupported MAC algorithm " + alg.String())
+	}
+
+	var encodedPassword []byte
+	if !nullEmpty {
+		var err error
+		if encodedPassword, err = bmpString(password); err != nil {
+			return nil, err
+		}
+	}
+	key := deriveKey(h, v, mac.MacSalt, encodedPassword, mac.Iterations, 3, h().Size())
+	m := hmac.New(h, key)
+	m.Write(authSafe)
+	return m.Sum(nil), nil
+}
+
+// deriveKey derives a key of size bytes from password, a BMPString, and
+// salt with the key derivation function of RFC 7292 appendix B.2, for
+// the purpose id, using the hash function h of block size v.
+func deriveKey(h func() hash.Hash, v int, salt, password []byte, iterations int, id byte, size int) []byte {
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(fill(salt), fill(password)...)
+
+	var key []byte
+	for len(key) < size {
+		hh := h()
+		hh.Write(d)
+		hh.Write(i)
+		a := hh.Sum(nil)
+		for r := 1; r < iterations; r++ {
+			hh = h()
+			hh.Write(a)
+			a = hh.Sum(a[:0])
+		}
+		key = append(key, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v), with B the v bytes
+		// repeating A.
+		b := fill(a)[:v]
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				x := int(i[j+k]) + int(b[k]) + carry
+				i[j+k] = byte(x)
+				carry = x >> 8
+			}
+		}
+	}
+	return key[:size]
+}
+
+// bmpString returns s encoded as a BMPString with a zero terminator, as
+// passwords are in the key derivation of RFC 7292.
+func bmpString(s string) ([]byte, error) {
+	out := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if r1, _ := utf16.EncodeRune(r); r1 != 0xfffd {
+			return nil, errors.New("pkcs12: password contains characters that cannot be encoded in UCS-2")
+		}
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0), nil
+}
+
+func localKeyIDAttribute(id []byte) (pkcs12Attribute, error) {
+	value, err := asn1.Marshal(id)
+	if err != nil {
+		return pkcs12Attribute{}, err
+	}
+	return pkcs12Attribute{
+		ID:    oidLocalKeyID,
+		Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+	}, nil
+}
+
+// explicit returns der as the content of a [0] EXPLICIT field.
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// unmarshal calls asn1.Unmarshal, but also fails on trailing data.
+func unmarshal(in []byte, out interface{}) error {
+	trailing, err := asn1.Unmarshal(in, out)
+	if err != nil {
+		return err
+	}
+	if len(trailing) != 0 {
+		return errors.New("pkcs12: trailing data found")
+	}
+	return nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	if k, ok := a.(interface{ Equal(crypto.PublicKey) bool }); ok {
+		return k.Equal(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,158 @@
+package pkcs12
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testChain returns a leaf key and certificate issued by a CA.
+func testChain(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert, ca
+}
+
+func TestEncodeDecode(t *testing.T) {
+	key, cert, ca := testChain(t)
+	for _, password := range []string{"correct horse", ""} {
+		pfx, err := Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decodedKey, decodedCert, caCerts, err := Decode(pfx, password)
+		if err != nil {
+			t.Fatalf("password %q: %v", password, err)
+		}
+		if !key.Equal(decodedKey) || !cert.Equal(decodedCert) || len(caCerts) != 1 || !ca.Equal(caCerts[0]) {
+			t.Fatalf("password %q: decoded contents don't match", password)
+		}
+
+		if _, _, _, err = Decode(pfx, "wrong"); err != ErrIncorrectPassword {
+			t.Fatalf("expected ErrIncorrectPassword, got %v", err)
+		}
+	}
+
+	otherKey, _, _ := testChain(t)
+	if _, err := Encode(rand.Reader, otherKey, cert, nil, "pw"); err == nil {
+		t.Fatal("a key not matching the certificate should be rejected")
+	}
+}
+
+func TestDecodeOpenSSL(t *testing.T) {
+	// Encrypted with PBES2 by OpenSSL 3, with a CA certificate and
+	// without, under an empty password.
+	for file, password := range map[string]string{
+		"testdata/openssl3.p12":       "password",
+		"testdata/openssl3_empty.p12": "",
+	} {
+		pfx, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, cert, caCerts, err := Decode(pfx, password)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if key == nil || cert.Subject.CommonName != "leaf" {
+			t.Fatalf("%s: key or certificate not decoded", file)
+		}
+		if file == "testdata/openssl3.p12" && (len(caCerts) != 1 || caCerts[0].Subject.CommonName != "Test CA") {
+			t.Fatalf("%s: CA certificate not decoded", file)
+		}
+	}
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	// Encrypted with 40-bit RC2 and 3DES by OpenSSL 1.
+	pfx, err := ioutil.ReadFile("../../helpers/testdata/passwordpkcs12.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, _, err := Decode(pfx, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil || cert == nil {
+		t.Fatal("legacy PKCS #12 file not decoded")
+	}
+	if _, _, _, err = Decode(pfx, "wrong"); err != ErrIncorrectPassword {
+		t.Fatalf("expected ErrIncorrectPassword, got %v", err)
+	}
+}
+
+func TestDecodeUntrusted(t *testing.T) {
+	key, cert, _ := testChain(t)
+	pfx, err := Encode(rand.Reader, key, cert, nil, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded pfxPdu
+	if err = unmarshal(pfx, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	noMac := decoded
+	noMac.MacData = macData{}
+	der, err := asn1.Marshal(noMac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = Decode(der, "anything"); err == nil {
+		t.Fatal("a file without a MAC should be rejected")
+	}
+
+	slowMac := decoded
+	slowMac.MacData.Iterations = MaxIterations + 1
+	if der, err = asn1.Marshal(slowMac); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = Decode(der, "pw"); err == nil || err == ErrIncorrectPassword {
+		t.Fatalf("an excessive MAC iteration count should be rejected, got %v", err)
+	}
+}
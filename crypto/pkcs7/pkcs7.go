@@ -61,8 +61,8 @@ type signedData struct {
 	Version          int
 	DigestAlgorithms asn1.RawValue
 	ContentInfo      asn1.RawValue
-	Certificates     asn1.RawValue `asn1:"optional" asn1:"tag:0"`
-	Crls             asn1.RawValue `asn1:"optional"`
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	Crls             asn1.RawValue `asn1:"optional,tag:1"`
 	SignerInfos      asn1.RawValue
 }
 
@@ -186,3 +186,59 @@ func ParsePKCS7(raw []byte) (msg *PKCS7, err error) {
 	return msg, nil
 
 }
+
+// Types used for asn1 Marshaling.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type emptyContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type certsOnlySignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      emptyContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      asn1.RawValue
+}
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// MarshalCertificates returns the DER encoding of a degenerate PKCS #7
+// SignedData holding certs and no signature, as produced by openssl
+// crl2pkcs7 -nocrl. This is the .p7b format Windows uses to import
+// certificate chains.
+func MarshalCertificates(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	sd, err := asn1.Marshal(certsOnlySignedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      emptyContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	return der, nil
+}
@@ -0,0 +1,45 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMarshalCertificates(t *testing.T) {
+	certsPEM, err := ioutil.ReadFile("../../testdata/gd_bundle.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(certsPEM); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+
+	der, err := MarshalCertificates(certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParsePKCS7(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ContentInfo != "SignedData" || msg.Content.SignedData.Version != 1 {
+		t.Fatalf("unexpected content %s version %d", msg.ContentInfo, msg.Content.SignedData.Version)
+	}
+	parsed := msg.Content.SignedData.Certificates
+	if len(parsed) != len(certs) {
+		t.Fatalf("expected %d certificates, got %d", len(certs), len(parsed))
+	}
+	for i := range certs {
+		if !bytes.Equal(parsed[i].Raw, certs[i].Raw) {
+			t.Fatalf("certificate %d differs", i)
+		}
+	}
+}
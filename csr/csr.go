@@ -4,6 +4,7 @@ package csr
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -12,11 +13,14 @@ import (
 	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"net"
 	"net/mail"
 	"net/url"
+	"reflect"
 	"strings"
 
+	"github.com/cloudflare/cfssl/config"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
@@ -39,6 +43,7 @@ type Name struct {
 }
 
 // A KeyRequest contains the algorithm and key size for a new private key.
+// Ed25519 keys have a fixed size, so the size is ignored for them.
 type KeyRequest struct {
 	A string `json:"algo" yaml:"algo"`
 	S int    `json:"size" yaml:"size"`
@@ -60,9 +65,11 @@ func (kr *KeyRequest) Size() int {
 }
 
 // Generate generates a key as specified in the request. Currently,
-// only ECDSA and RSA are supported.
+// ECDSA, RSA and Ed25519 are supported. The key is derived from the
+// source set by SetKeyReader, if any.
 func (kr *KeyRequest) Generate() (crypto.PrivateKey, error) {
 	log.Debugf("generate key from request: algo=%s, size=%d", kr.Algo(), kr.Size())
+	r := currentKeyReader()
 	switch kr.Algo() {
 	case "rsa":
 		if kr.Size() < 2048 {
@@ -71,6 +78,9 @@ func (kr *KeyRequest) Generate() (crypto.PrivateKey, error) {
 		if kr.Size() > 8192 {
 			return nil, errors.New("RSA key size too large")
 		}
+		if r != nil {
+			return readRSAKey(r, kr.Size())
+		}
 		return rsa.GenerateKey(rand.Reader, kr.Size())
 	case "ecdsa":
 		var curve elliptic.Curve
@@ -84,7 +94,16 @@ func (kr *KeyRequest) Generate() (crypto.PrivateKey, error) {
 		default:
 			return nil, errors.New("invalid curve")
 		}
+		if r != nil {
+			return readECDSAKey(r, curve)
+		}
 		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "ed25519":
+		if r != nil {
+			return readEd25519Key(r)
+		}
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
 	default:
 		return nil, errors.New("invalid algorithm")
 	}
@@ -116,6 +135,8 @@ func (kr *KeyRequest) SigAlgo() x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case "ed25519":
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
@@ -127,6 +148,9 @@ type CAConfig struct {
 	PathLenZero bool   `json:"pathlenzero" yaml:"pathlenzero"`
 	Expiry      string `json:"expiry" yaml:"expiry"`
 	Backdate    string `json:"backdate" yaml:"backdate"`
+	// NameConstraints are added to the CA certificate generated from
+	// the request.
+	NameConstraints *config.NameConstraints `json:"name_constraints,omitempty" yaml:"name_constraints,omitempty"`
 }
 
 // A CertificateRequest encapsulates the API interface to the
@@ -135,10 +159,18 @@ type CertificateRequest struct {
 	CN           string     `json:"CN" yaml:"CN"`
 	Names        []Name     `json:"names" yaml:"names"`
 	Hosts        []string   `json:"hosts" yaml:"hosts"`
+	// URIs and OtherNames are subject alternative names added besides
+	// those of Hosts.
+	URIs         []string    `json:"uris,omitempty" yaml:"uris,omitempty"`
+	OtherNames   []OtherName `json:"other_names,omitempty" yaml:"other_names,omitempty"`
 	KeyRequest   *KeyRequest `json:"key,omitempty" yaml:"key,omitempty"`
 	CA           *CAConfig  `json:"ca,omitempty" yaml:"ca,omitempty"`
 	SerialNumber string     `json:"serialnumber,omitempty" yaml:"serialnumber,omitempty"`
 	Extensions   []pkix.Extension `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+	// PSS requests a RSASSA-PSS rather than a PKCS #1 v1.5 signature
+	// of the CSR, for an RSA key. It is apart from KeyRequest so as
+	// not to break its unkeyed literals.
+	PSS bool `json:"pss,omitempty" yaml:"pss,omitempty"`
 }
 
 // New returns a new, empty CertificateRequest with a
@@ -216,6 +248,17 @@ func ParseRequest(req *CertificateRequest) (csr, key []byte, err error) {
 			Bytes: key,
 		}
 		key = pem.EncodeToMemory(&block)
+	case ed25519.PrivateKey:
+		key, err = x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			err = cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+			return
+		}
+		block := pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: key,
+		}
+		key = pem.EncodeToMemory(&block)
 	default:
 		panic("Generate should have failed to produce a valid key.")
 	}
@@ -237,6 +280,9 @@ func ExtractCertificateRequest(cert *x509.Certificate) *CertificateRequest {
 	req.CN = cert.Subject.CommonName
 	req.Names = getNames(cert.Subject)
 	req.Hosts = getHosts(cert)
+	if otherNames, err := OtherNames(cert.Extensions); err == nil {
+		req.OtherNames = otherNames
+	}
 	req.SerialNumber = cert.Subject.SerialNumber
 
 	if cert.IsCA {
@@ -246,11 +292,38 @@ func ExtractCertificateRequest(cert *x509.Certificate) *CertificateRequest {
 		req.CA.Expiry = cert.NotAfter.Sub(cert.NotBefore).String()
 		req.CA.PathLength = cert.MaxPathLen
 		req.CA.PathLenZero = cert.MaxPathLenZero
+		req.CA.NameConstraints = getNameConstraints(cert)
 	}
 
 	return req
 }
 
+// getNameConstraints returns the name constraints of cert, or nil if it
+// has none.
+func getNameConstraints(cert *x509.Certificate) *config.NameConstraints {
+	ipRanges := func(nets []*net.IPNet) []string {
+		var ranges []string
+		for _, ipNet := range nets {
+			ranges = append(ranges, ipNet.String())
+		}
+		return ranges
+	}
+	nc := &config.NameConstraints{
+		PermittedDNSDomains:     cert.PermittedDNSDomains,
+		ExcludedDNSDomains:      cert.ExcludedDNSDomains,
+		PermittedIPRanges:       ipRanges(cert.PermittedIPRanges),
+		ExcludedIPRanges:        ipRanges(cert.ExcludedIPRanges),
+		PermittedEmailAddresses: cert.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  cert.ExcludedEmailAddresses,
+		PermittedURIDomains:     cert.PermittedURIDomains,
+		ExcludedURIDomains:      cert.ExcludedURIDomains,
+	}
+	if reflect.DeepEqual(nc, &config.NameConstraints{}) {
+		return nil
+	}
+	return nc
+}
+
 func getHosts(cert *x509.Certificate) []string {
 	var hosts []string
 	for _, ip := range cert.IPAddresses {
@@ -365,6 +438,12 @@ func Generate(priv crypto.Signer, req *CertificateRequest) (csr []byte, err erro
 	if sigAlgo == x509.UnknownSignatureAlgorithm {
 		return nil, cferr.New(cferr.PrivateKeyError, cferr.Unavailable)
 	}
+	if req.PSS {
+		if sigAlgo = helpers.PSSAlgo(sigAlgo); sigAlgo == x509.UnknownSignatureAlgorithm {
+			return nil, cferr.Wrap(cferr.CSRError, cferr.BadRequest,
+				errors.New("RSA-PSS signatures require an RSA key"))
+		}
+	}
 
 	var tpl = x509.CertificateRequest{
 		Subject:            req.Name(),
@@ -383,8 +462,26 @@ func Generate(priv crypto.Signer, req *CertificateRequest) (csr []byte, err erro
 		}
 	}
 
+	for _, u := range req.URIs {
+		uri, err := url.Parse(u)
+		if err != nil || !uri.IsAbs() {
+			return nil, cferr.Wrap(cferr.CSRError, cferr.BadRequest, fmt.Errorf("invalid URI %q", u))
+		}
+		tpl.URIs = append(tpl.URIs, uri)
+	}
+
 	tpl.ExtraExtensions = []pkix.Extension{}
 
+	// crypto/x509 can't encode otherNames, so when there are any the
+	// whole subjectAltName extension is built here instead.
+	if len(req.OtherNames) > 0 {
+		san, err := MarshalGeneralNames(tpl.DNSNames, tpl.EmailAddresses, tpl.IPAddresses, tpl.URIs, req.OtherNames)
+		if err != nil {
+			return nil, cferr.Wrap(cferr.CSRError, cferr.BadRequest, err)
+		}
+		tpl.ExtraExtensions = append(tpl.ExtraExtensions, pkix.Extension{Id: SubjectAltNameOID, Value: san})
+	}
+
 	if req.CA != nil {
 		err = appendCAInfoToCSR(req.CA, &tpl)
 		if err != nil {
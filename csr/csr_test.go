@@ -1,15 +1,19 @@
 package csr
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	"github.com/cloudflare/cfssl/errors"
@@ -657,6 +661,34 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
+func TestGeneratePSS(t *testing.T) {
+	req := &CertificateRequest{
+		CN:         "cloudflare.com",
+		KeyRequest: &KeyRequest{"rsa", 3072},
+		PSS:        true,
+	}
+
+	csrPEM, _, err := ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, _, err := helpers.ParseCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != x509.SHA384WithRSAPSS {
+		t.Fatalf("expected a SHA384WithRSAPSS signature, got %v", csr.SignatureAlgorithm)
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Generate(priv, req); err == nil {
+		t.Fatal("expected RSA-PSS with an ECDSA key to fail")
+	}
+}
+
 // TestReGenerate ensures Regenerate() is abel to use the provided CSR as a template for signing a new
 // CSR using priv.
 func TestReGenerate(t *testing.T) {
@@ -783,3 +815,90 @@ func TestExtractCertificateRequest(t *testing.T) {
 		t.Fatal("Bad Certificate Request!")
 	}
 }
+
+func TestEd25519KeyGeneration(t *testing.T) {
+	kr := &KeyRequest{A: "ed25519"}
+	priv, err := kr.Generate()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, ok := priv.(ed25519.PrivateKey); !ok {
+		t.Fatalf("Generated key has wrong type %T.", priv)
+	}
+	if sa := kr.SigAlgo(); sa != x509.PureEd25519 {
+		t.Fatalf("Invalid signature algorithm %v!", sa)
+	}
+
+	req := &CertificateRequest{
+		CN:         "wireguard.example.com",
+		Hosts:      []string{"wireguard.example.com"},
+		KeyRequest: kr,
+	}
+	csrPEM, keyPEM, err := ParseRequest(req)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	csr, err := helpers.ParseCSRPEM(csrPEM)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if csr.SignatureAlgorithm != x509.PureEd25519 {
+		t.Fatalf("CSR has wrong signature algorithm %v.", csr.SignatureAlgorithm)
+	}
+	if !bytes.Equal(csr.PublicKey.(ed25519.PublicKey), key.Public().(ed25519.PublicKey)) {
+		t.Fatal("CSR public key doesn't match the generated key.")
+	}
+}
+
+func TestGenerateAltNames(t *testing.T) {
+	req := &CertificateRequest{
+		CN:    "Jane Doe",
+		Hosts: []string{"jdoe@example.com", "192.168.0.1"},
+		URIs:  []string{"spiffe://example.com/jdoe"},
+		OtherNames: []OtherName{
+			{Type: "upn", Value: "jdoe@corp.example.com"},
+			{Type: "1.2.3.4", Value: "other"},
+		},
+		KeyRequest: &KeyRequest{"ecdsa", 256},
+	}
+
+	key, err := req.KeyRequest.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, err := Generate(key.(crypto.Signer), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, _, err := helpers.ParseCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(csr.EmailAddresses) != 1 || len(csr.IPAddresses) != 1 {
+		t.Fatalf("unexpected hosts %v %v", csr.EmailAddresses, csr.IPAddresses)
+	}
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != "spiffe://example.com/jdoe" {
+		t.Fatalf("unexpected URIs %v", csr.URIs)
+	}
+	otherNames, err := OtherNames(csr.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(otherNames, req.OtherNames) {
+		t.Fatalf("expected otherNames %v, got %v", req.OtherNames, otherNames)
+	}
+
+	for _, bad := range []*CertificateRequest{
+		{CN: "bad", URIs: []string{"not a URI"}},
+		{CN: "bad", OtherNames: []OtherName{{Type: "principal", Value: "x"}}},
+	} {
+		if _, err := Generate(key.(crypto.Signer), bad); err == nil {
+			t.Fatalf("request %+v should have been rejected", bad)
+		}
+	}
+}
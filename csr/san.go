@@ -0,0 +1,183 @@
+package csr
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SubjectAltNameOID is the OID of the subjectAltName extension (RFC 5280
+// section 4.2.1.6).
+var SubjectAltNameOID = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// UPNOID is the type of the Microsoft user principal name otherName,
+// used for smart card logon.
+var UPNOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+
+// An OtherName is an otherName subject alternative name (RFC 5280
+// section 4.2.1.6). Type is either an OID in dotted form or "upn" for a
+// user principal name. Value is encoded as a UTF8String.
+type OtherName struct {
+	Type  string `json:"type" yaml:"type"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// OID returns the type of the otherName.
+func (on OtherName) OID() (asn1.ObjectIdentifier, error) {
+	if strings.EqualFold(on.Type, "upn") {
+		return UPNOID, nil
+	}
+
+	segments := strings.Split(on.Type, ".")
+	if len(segments) < 2 {
+		return nil, fmt.Errorf("invalid otherName type %q", on.Type)
+	}
+	oid := make(asn1.ObjectIdentifier, len(segments))
+	for i, segment := range segments {
+		n, err := strconv.Atoi(segment)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid otherName type %q", on.Type)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// marshal encodes on as a GeneralName:
+//
+//	OtherName ::= SEQUENCE {
+//	     type-id    OBJECT IDENTIFIER,
+//	     value      [0] EXPLICIT ANY DEFINED BY type-id }
+func (on OtherName) marshal() (asn1.RawValue, error) {
+	oid, err := on.OID()
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	typeID, err := asn1.Marshal(oid)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	value, err := asn1.MarshalWithParams(on.Value, "utf8,explicit,tag:0")
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append(typeID, value...),
+	}, nil
+}
+
+// CheckNameTypes returns an error if a subjectAltName found in
+// extensions holds a directoryName, x400Address, ediPartyName or
+// registeredID. Neither crypto/x509 nor OtherNames parse those, so they
+// can't be checked against a name whitelist.
+func CheckNameTypes(extensions []pkix.Extension) error {
+	for _, ext := range extensions {
+		if !ext.Id.Equal(SubjectAltNameOID) {
+			continue
+		}
+
+		var generalNames []asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &generalNames); err != nil {
+			return err
+		} else if len(rest) != 0 {
+			return errors.New("x509: trailing data after X.509 subjectAltName")
+		}
+
+		for _, gn := range generalNames {
+			if gn.Class != asn1.ClassContextSpecific {
+				return errors.New("malformed subjectAltName")
+			}
+			switch gn.Tag {
+			case 0, 1, 2, 6, 7:
+			default:
+				return fmt.Errorf("unsupported subject alternative name of tag %d", gn.Tag)
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalGeneralNames encodes the given names as GeneralNames, the value
+// of the subjectAltName and issuerAltName extensions.
+func MarshalGeneralNames(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL, otherNames []OtherName) ([]byte, error) {
+	var generalNames []asn1.RawValue
+	for _, on := range otherNames {
+		gn, err := on.marshal()
+		if err != nil {
+			return nil, err
+		}
+		generalNames = append(generalNames, gn)
+	}
+	for _, email := range emailAddresses {
+		generalNames = append(generalNames, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte(email)})
+	}
+	for _, dns := range dnsNames {
+		generalNames = append(generalNames, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(dns)})
+	}
+	for _, uri := range uris {
+		generalNames = append(generalNames, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(uri.String())})
+	}
+	for _, ip := range ipAddresses {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		generalNames = append(generalNames, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: ip})
+	}
+	return asn1.Marshal(generalNames)
+}
+
+// OtherNames returns the otherName subject alternative names found in
+// extensions. crypto/x509 drops them when parsing certificates and
+// certificate requests. Only otherNames holding a string are supported.
+func OtherNames(extensions []pkix.Extension) ([]OtherName, error) {
+	var otherNames []OtherName
+	for _, ext := range extensions {
+		if !ext.Id.Equal(SubjectAltNameOID) {
+			continue
+		}
+
+		var generalNames []asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &generalNames); err != nil {
+			return nil, err
+		} else if len(rest) != 0 {
+			return nil, errors.New("x509: trailing data after X.509 subjectAltName")
+		}
+
+		for _, gn := range generalNames {
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+
+			var oid asn1.ObjectIdentifier
+			rest, err := asn1.Unmarshal(gn.Bytes, &oid)
+			if err != nil {
+				return nil, err
+			}
+			var value asn1.RawValue
+			if rest, err = asn1.Unmarshal(rest, &value); err != nil {
+				return nil, err
+			} else if len(rest) != 0 || value.Class != asn1.ClassContextSpecific || value.Tag != 0 {
+				return nil, errors.New("malformed otherName")
+			}
+			var s string
+			if _, err = asn1.Unmarshal(value.Bytes, &s); err != nil {
+				return nil, fmt.Errorf("unsupported value of otherName %v: %v", oid, err)
+			}
+
+			on := OtherName{Type: oid.String(), Value: s}
+			if oid.Equal(UPNOID) {
+				on.Type = "upn"
+			}
+			otherNames = append(otherNames, on)
+		}
+	}
+	return otherNames, nil
+}
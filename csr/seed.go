@@ -0,0 +1,177 @@
+package csr
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// keyReader, if set, replaces crypto/rand as the source of the private
+// keys generated by KeyRequest.Generate.
+var (
+	keyReaderLock sync.Mutex
+	keyReader     io.Reader
+)
+
+// SetKeyReader makes KeyRequest.Generate, and so the whole key and
+// certificate generation pipeline, derive private keys from r instead
+// of crypto/rand, and returns a function restoring the previous
+// source. Given the same bytes, the same keys are generated, which
+// makes golden tests and simulations without an HSM reproducible; see
+// NewSeededReader.
+//
+// The keys generated this way are only as secret as r. To keep them
+// out of real deployments, SetKeyReader panics unless it is called
+// from a test binary, or from a program built with the
+// cfssl_insecure_keys build tag.
+func SetKeyReader(r io.Reader) (restore func()) {
+	if !insecureKeysAllowed && flag.Lookup("test.v") == nil {
+		panic("csr: SetKeyReader is only available to tests and to programs built with the cfssl_insecure_keys tag")
+	}
+
+	keyReaderLock.Lock()
+	defer keyReaderLock.Unlock()
+	prev := keyReader
+	keyReader = r
+	return func() {
+		keyReaderLock.Lock()
+		defer keyReaderLock.Unlock()
+		keyReader = prev
+	}
+}
+
+// currentKeyReader returns the source set by SetKeyReader, or nil.
+func currentKeyReader() io.Reader {
+	keyReaderLock.Lock()
+	defer keyReaderLock.Unlock()
+	return keyReader
+}
+
+// A seededReader is an endless stream of bytes derived from a seed:
+// the SHA-256 digests of the seed followed by a block counter.
+type seededReader struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+// NewSeededReader returns a reader producing the same stream of bytes
+// for the same seed, to be passed to SetKeyReader.
+func NewSeededReader(seed []byte) io.Reader {
+	return &seededReader{seed: append([]byte{}, seed...)}
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], r.counter)
+			r.counter++
+			block := sha256.Sum256(append(append([]byte{}, r.seed...), counter[:]...))
+			r.buf = block[:]
+		}
+		m := copy(p[n:], r.buf)
+		r.buf = r.buf[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// The key generation functions of the standard library always use
+// crypto/rand since Go 1.26, so keys are derived from a key reader
+// here instead.
+
+var (
+	bigOne = big.NewInt(1)
+	bigTwo = big.NewInt(2)
+)
+
+// readRSAKey derives an RSA key of the given size from r.
+func readRSAKey(r io.Reader, bits int) (*rsa.PrivateKey, error) {
+	e := big.NewInt(65537)
+	for {
+		p, err := readPrime(r, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := readPrime(r, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		n := new(big.Int).Mul(p, q)
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, bigOne), new(big.Int).Sub(q, bigOne))
+		d := new(big.Int).ModInverse(e, phi)
+		if n.BitLen() != bits || d == nil {
+			continue
+		}
+
+		priv := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		priv.Precompute()
+		return priv, priv.Validate()
+	}
+}
+
+// readPrime derives a prime of the given size from r, with its two top
+// bits set so that the product of two such primes has the full size.
+func readPrime(r io.Reader, bits int) (*big.Int, error) {
+	b := make([]byte, (bits+7)/8)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		p := new(big.Int).SetBytes(b)
+		p.Rsh(p, uint(len(b)*8-bits))
+		p.SetBit(p, bits-1, 1)
+		p.SetBit(p, bits-2, 1)
+		p.SetBit(p, 0, 1)
+		for !p.ProbablyPrime(20) {
+			p.Add(p, bigTwo)
+		}
+		if p.BitLen() == bits {
+			return p, nil
+		}
+	}
+}
+
+// readECDSAKey derives an ECDSA key on curve from r, as described in
+// FIPS 186-4, B.4.1.
+func readECDSAKey(r io.Reader, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	params := curve.Params()
+	b := make([]byte, (params.BitSize+7)/8+8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	k := new(big.Int).SetBytes(b)
+	k.Mod(k, new(big.Int).Sub(params.N, bigOne))
+	k.Add(k, bigOne)
+
+	priv := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve}, D: k}
+	priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(k.Bytes())
+	return priv, nil
+}
+
+// readEd25519Key derives an Ed25519 key from r.
+func readEd25519Key(r io.Reader) (ed25519.PrivateKey, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(r, seed); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
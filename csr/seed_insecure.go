@@ -0,0 +1,8 @@
+//go:build cfssl_insecure_keys
+// +build cfssl_insecure_keys
+
+package csr
+
+// insecureKeysAllowed lets programs built with the cfssl_insecure_keys
+// tag call SetKeyReader.
+const insecureKeysAllowed = true
@@ -0,0 +1,8 @@
+//go:build !cfssl_insecure_keys
+// +build !cfssl_insecure_keys
+
+package csr
+
+// insecureKeysAllowed keeps SetKeyReader out of programs built
+// without the cfssl_insecure_keys tag, such as the cfssl commands.
+const insecureKeysAllowed = false
@@ -0,0 +1,118 @@
+package csr
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+)
+
+func TestSeededReader(t *testing.T) {
+	a, b := make([]byte, 100), make([]byte, 100)
+	NewSeededReader([]byte("seed")).Read(a)
+
+	// Reads of any size produce the same stream.
+	r := NewSeededReader([]byte("seed"))
+	for i := 0; i < len(b); i += 7 {
+		end := i + 7
+		if end > len(b) {
+			end = len(b)
+		}
+		r.Read(b[i:end])
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatal("expected the same stream for the same seed")
+	}
+
+	NewSeededReader([]byte("other seed")).Read(b)
+	if bytes.Equal(a, b) {
+		t.Fatal("expected another stream for another seed")
+	}
+}
+
+func TestSetKeyReader(t *testing.T) {
+	requests := []*KeyRequest{
+		{A: "rsa", S: 2048},
+		{A: "ecdsa", S: 256},
+		{A: "ecdsa", S: 384},
+		{A: "ecdsa", S: 521},
+		{A: "ed25519"},
+	}
+
+	generate := func(seed string) [][]byte {
+		restore := SetKeyReader(NewSeededReader([]byte(seed)))
+		defer restore()
+
+		var keys [][]byte
+		for _, kr := range requests {
+			priv, err := kr.Generate()
+			if err != nil {
+				t.Fatalf("%s-%d: %v", kr.Algo(), kr.Size(), err)
+			}
+			switch priv := priv.(type) {
+			case *rsa.PrivateKey:
+				if priv.N.BitLen() != kr.Size() {
+					t.Fatalf("expected a %d-bit RSA key, got %d bits", kr.Size(), priv.N.BitLen())
+				}
+			case *ecdsa.PrivateKey:
+				if !priv.Curve.IsOnCurve(priv.X, priv.Y) {
+					t.Fatal("the public key isn't on the curve")
+				}
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(priv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, der)
+		}
+		return keys
+	}
+
+	first, second, other := generate("golden"), generate("golden"), generate("other")
+	for i, kr := range requests {
+		if !bytes.Equal(first[i], second[i]) {
+			t.Errorf("%s-%d: expected the same key for the same seed", kr.Algo(), kr.Size())
+		}
+		if bytes.Equal(first[i], other[i]) {
+			t.Errorf("%s-%d: expected another key for another seed", kr.Algo(), kr.Size())
+		}
+	}
+
+	// Once restored, keys come from crypto/rand again.
+	priv, err := requests[4].Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(der, first[4]) {
+		t.Fatal("expected a random key once the key reader is restored")
+	}
+}
+
+func TestParseRequestSeeded(t *testing.T) {
+	req := &CertificateRequest{
+		CN:         "golden.example.com",
+		Hosts:      []string{"golden.example.com"},
+		KeyRequest: &KeyRequest{A: "ed25519"},
+	}
+
+	generate := func() ([]byte, []byte) {
+		defer SetKeyReader(NewSeededReader([]byte("golden")))()
+		csrPEM, keyPEM, err := ParseRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return csrPEM, keyPEM
+	}
+
+	// Ed25519 signatures are deterministic, so the whole CSR is.
+	csr1, key1 := generate()
+	csr2, key2 := generate()
+	if !bytes.Equal(key1, key2) || !bytes.Equal(csr1, csr2) {
+		t.Fatal("expected the same key and CSR for the same seed")
+	}
+}
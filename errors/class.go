@@ -0,0 +1,180 @@
+package errors
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Class is the coarse class of a failure, which automation can branch on
+// without parsing error messages. The values are stable: they are the
+// exit status of the cfssl command and the "class" of the errors of API
+// responses.
+type Class int
+
+const (
+	// ClassNone means there was no error.
+	ClassNone Class = 0
+
+	// ClassUnknown is any failure that doesn't fall in another class.
+	ClassUnknown Class = 1
+
+	// ClassInput is a malformed or unreadable input, such as a
+	// certificate, CSR, key, request or configuration file. The status
+	// 2 is left to the usage errors reported by the flag package.
+	ClassInput Class = 3
+
+	// ClassPolicy is a request rejected by the signing policy, or by
+	// the authentication of a remote server.
+	ClassPolicy Class = 4
+
+	// ClassRemote is a remote server that couldn't be reached or
+	// failed to answer.
+	ClassRemote Class = 5
+
+	// ClassHSM is a failure of the hardware security module or key
+	// management service holding a key.
+	ClassHSM Class = 6
+
+	// ClassDB is a failure of the certificate database.
+	ClassDB Class = 7
+)
+
+var classNames = map[Class]string{
+	ClassNone:    "none",
+	ClassUnknown: "unknown",
+	ClassInput:   "input",
+	ClassPolicy:  "policy",
+	ClassRemote:  "remote",
+	ClassHSM:     "hsm",
+	ClassDB:      "db",
+}
+
+// String returns the name of the class.
+func (c Class) String() string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+	return classNames[ClassUnknown]
+}
+
+// classifiedError is an error given an explicit class.
+type classifiedError struct {
+	class Class
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// WithClass returns err with the given class, for the errors whose class
+// can't be told from their type, such as those of a key management
+// service. The class is kept when the error is wrapped by Wrap.
+func WithClass(class Class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// ClassOf returns the class of err: the class given with WithClass, or
+// else the one derived from its category and reason if it is an *Error,
+// or from its type otherwise.
+func ClassOf(err error) Class {
+	if err == nil {
+		return ClassNone
+	}
+
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	var cfErr *Error
+	if errors.As(err, &cfErr) {
+		return cfErr.class()
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if httpErr.StatusCode < http.StatusInternalServerError {
+			return ClassInput
+		}
+		return ClassUnknown
+	}
+
+	// Path errors are checked first since they also have the methods
+	// of net.Error.
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return ClassInput
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ClassRemote
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return ClassDB
+	}
+	return ClassUnknown
+}
+
+// class returns the class of e: the one of the error it wraps, if any,
+// or else the one of its category and reason.
+func (e *Error) class() Class {
+	if e.wrappedClass != ClassNone {
+		return e.wrappedClass
+	}
+
+	category := Category(e.ErrorCode - e.ErrorCode%1000)
+	reason := Reason(e.ErrorCode % 1000)
+	switch category {
+	case CertificateError:
+		if reason == Unknown {
+			return ClassUnknown
+		}
+		return ClassInput
+	case IntermediatesError, RootError, CSRError, OCSPError:
+		return ClassInput
+	case PrivateKeyError:
+		switch reason {
+		case Unavailable:
+			return ClassHSM
+		case GenerationFailed:
+			return ClassUnknown
+		}
+		return ClassInput
+	case PolicyError:
+		// An invalid policy is a malformed configuration, rather than
+		// a request the policy rejects.
+		if reason == InvalidPolicy {
+			return ClassInput
+		}
+		return ClassPolicy
+	case DialError:
+		return ClassRemote
+	case APIClientError:
+		switch reason {
+		case AuthenticationFailure:
+			return ClassPolicy
+		case JSONError:
+			return ClassInput
+		}
+		return ClassRemote
+	case CTError:
+		switch reason {
+		case PrecertSubmissionFailed, CTClientConstructionFailed:
+			return ClassRemote
+		}
+		return ClassInput
+	case CertStoreError:
+		return ClassDB
+	}
+	return ClassUnknown
+}
@@ -0,0 +1,61 @@
+package errors
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestClassOf(t *testing.T) {
+	_, pathErr := os.Open("/nonexistent/cfssl")
+	hsmErr := WithClass(ClassHSM, errors.New("the HSM is offline"))
+	for _, test := range []struct {
+		err   error
+		class Class
+	}{
+		{nil, ClassNone},
+		{errors.New("something failed"), ClassUnknown},
+		{New(CertificateError, Unknown), ClassUnknown},
+		{New(CertificateError, ParseFailed), ClassInput},
+		{New(CSRError, BadRequest), ClassInput},
+		{New(PrivateKeyError, KeyMismatch), ClassInput},
+		{New(PrivateKeyError, Unavailable), ClassHSM},
+		{New(PolicyError, UnmatchedWhitelist), ClassPolicy},
+		{New(PolicyError, InvalidPolicy), ClassInput},
+		{New(DialError, Unknown), ClassRemote},
+		{New(APIClientError, ClientHTTPError), ClassRemote},
+		{New(APIClientError, AuthenticationFailure), ClassPolicy},
+		{New(CertStoreError, Unknown), ClassDB},
+		{Wrap(CertStoreError, InsertionFailed, errors.New("constraint violated")), ClassDB},
+		{NewBadRequestString("bad request"), ClassInput},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ClassRemote},
+		{pathErr, ClassInput},
+		{fmt.Errorf("query: %w", driver.ErrBadConn), ClassDB},
+		{hsmErr, ClassHSM},
+		// The class given to a wrapped error overrides the one of the
+		// category.
+		{Wrap(CertificateError, Unknown, hsmErr), ClassHSM},
+		{fmt.Errorf("signing: %w", hsmErr), ClassHSM},
+	} {
+		if class := ClassOf(test.err); class != test.class {
+			t.Errorf("expected %v to be of class %s, got %s", test.err, test.class, class)
+		}
+	}
+}
+
+func TestWithClass(t *testing.T) {
+	if WithClass(ClassDB, nil) != nil {
+		t.Error("expected no error without an error to classify")
+	}
+	err := errors.New("timeout")
+	classified := WithClass(ClassRemote, err)
+	if classified.Error() != "timeout" || !errors.Is(classified, err) {
+		t.Errorf("expected the classified error to wrap the error, got %v", classified)
+	}
+	if ClassRemote.String() != "remote" || Class(42).String() != "unknown" {
+		t.Error("unexpected class names")
+	}
+}
@@ -3,6 +3,7 @@ package errors
 import (
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
@@ -13,6 +14,10 @@ import (
 type Error struct {
 	ErrorCode int    `json:"code"`
 	Message   string `json:"message"`
+
+	// wrappedClass is the class given with WithClass to the wrapped
+	// error, which overrides the class of the category and reason.
+	wrappedClass Class
 }
 
 // Category is the most significant digit of the error code.
@@ -98,6 +103,10 @@ const (
 	// 'ClientProvidesSerialNumbers', but the SignRequest did not include a serial
 	// number.
 	MissingSerial // Code 14XX
+
+	// DuplicateSerial indicates that the serial number requested for a
+	// certificate has already been used by the CA.
+	DuplicateSerial // Code 15XX
 )
 
 const (
@@ -151,6 +160,10 @@ const (
 	UnknownProfile // 54XX
 
 	UnmatchedWhitelist // 55xx
+
+	// KeyReused indicates that the profile rejects key reuse and the
+	// public key in the request has already been certified.
+	KeyReused // 56XX
 )
 
 // The following are API client related errors, and should be
@@ -172,6 +185,11 @@ const (
 	// ServerRequestFailed covers any other failures from the API
 	// client.
 	ServerRequestFailed
+
+	// ServerUnavailable occurs when the request could not reach a
+	// server able to handle it: the server couldn't be dialed, or a
+	// gateway answered that it was unavailable.
+	ServerUnavailable
 )
 
 // The following are OCSP related errors, and should be
@@ -256,6 +274,8 @@ func New(category Category, reason Reason) *Error {
 			msg = "Invalid certificate request"
 		case MissingSerial:
 			msg = "Missing serial number in request"
+		case DuplicateSerial:
+			msg = "Requested serial number is already in use"
 		default:
 			panic(fmt.Sprintf("Unsupported CFSSL error reason %d under category CertificateError.",
 				reason))
@@ -327,6 +347,8 @@ func New(category Category, reason Reason) *Error {
 			msg = "Unknown policy profile"
 		case UnmatchedWhitelist:
 			msg = "Request does not match policy whitelist"
+		case KeyReused:
+			msg = "Public key has already been used for an issued certificate"
 		default:
 			panic(fmt.Sprintf("Unsupported CFSSL error reason %d under category PolicyError.",
 				reason))
@@ -351,6 +373,8 @@ func New(category Category, reason Reason) *Error {
 			msg = "API client IO error"
 		case ServerRequestFailed:
 			msg = "API client error: Server request failed"
+		case ServerUnavailable:
+			msg = "API client error: Server unavailable"
 		default:
 			panic(fmt.Sprintf("Unsupported CFSSL error reason %d under category APIClientError.",
 				reason))
@@ -433,6 +457,10 @@ func Wrap(category Category, reason Reason, err error) *Error {
 			category))
 	}
 
-	return &Error{ErrorCode: errorCode, Message: err.Error()}
-
+	wrapped := &Error{ErrorCode: errorCode, Message: err.Error()}
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		wrapped.wrappedClass = classified.class
+	}
+	return wrapped
 }
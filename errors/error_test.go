@@ -184,6 +184,10 @@ func TestNew(t *testing.T) {
 	if code != 7500 {
 		t.Fatal("Improper error code")
 	}
+	code = New(APIClientError, ServerUnavailable).ErrorCode
+	if code != 7600 {
+		t.Fatal("Improper error code")
+	}
 
 	code = New(CSRError, Unknown).ErrorCode
 	if code != 9000 {
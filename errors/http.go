@@ -45,3 +45,21 @@ func NewBadRequestMissingParameter(s string) *HTTPError {
 func NewBadRequestUnwantedParameter(s string) *HTTPError {
 	return NewBadRequestString(`Unwanted parameter "` + s + `"`)
 }
+
+// NewNotFoundString returns a HttpError with the supplied message and
+// error code 404.
+func NewNotFoundString(s string) *HTTPError {
+	return &HTTPError{http.StatusNotFound, errors.New(s)}
+}
+
+// NewServiceUnavailableString returns a HttpError with the supplied
+// message and error code 503.
+func NewServiceUnavailableString(s string) *HTTPError {
+	return &HTTPError{http.StatusServiceUnavailable, errors.New(s)}
+}
+
+// NewUnauthorizedString returns a HttpError with the supplied message
+// and error code 401.
+func NewUnauthorizedString(s string) *HTTPError {
+	return &HTTPError{http.StatusUnauthorized, errors.New(s)}
+}
@@ -0,0 +1,103 @@
+// Package events publishes the certificate issuance, revocation and OCSP
+// refresh events of a CFSSL process to its subscribers, such as the
+// clients of the events API endpoint.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// The following constants name the types of events.
+const (
+	// CertificateIssued is published when a certificate is signed.
+	CertificateIssued = "certificate_issued"
+	// CertificateRevoked is published when a certificate is revoked.
+	CertificateRevoked = "certificate_revoked"
+	// OCSPRefreshed is published when a new OCSP response is stored for
+	// a certificate.
+	OCSPRefreshed = "ocsp_refreshed"
+)
+
+// An Event describes something that happened to a certificate. Serial
+// and AKI identify the certificate as in the certdb.
+type Event struct {
+	ID      uint64    `json:"id"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Serial  string    `json:"serial_number"`
+	AKI     string    `json:"authority_key_id"`
+	Subject string    `json:"subject,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+	// NotAfter is the expiry of an issued certificate, and Reason the
+	// RFC 5280 reason code of a revocation.
+	NotAfter *time.Time `json:"not_after,omitempty"`
+	Reason   *int       `json:"reason,omitempty"`
+}
+
+// A Bus delivers the events published on it to all of its subscribers.
+// The zero Bus has no subscribers.
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	subscribers map[chan Event]struct{}
+}
+
+// DefaultBus is the Bus on which the signers and handlers of this
+// module publish their events.
+var DefaultBus = &Bus{}
+
+// Publish sets the ID and, if it is zero, the time of e, and delivers it
+// to every subscriber. Publish never blocks: a subscriber whose buffer is
+// full is unsubscribed, and its channel closed, so that it knows it has
+// missed events.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now
+// on, buffering up to buffer of them, and a function to unsubscribe.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan Event]struct{}{}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish publishes e on DefaultBus.
+func Publish(e Event) {
+	DefaultBus.Publish(e)
+}
+
+// Subscribe subscribes to DefaultBus.
+func Subscribe(buffer int) (<-chan Event, func()) {
+	return DefaultBus.Subscribe(buffer)
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	var b Bus
+	b.Publish(Event{Type: CertificateIssued})
+
+	ch, unsubscribe := b.Subscribe(2)
+	b.Publish(Event{Type: CertificateIssued, Serial: "1"})
+	b.Publish(Event{Type: CertificateRevoked, Serial: "1"})
+
+	e := <-ch
+	if e.ID != 2 || e.Type != CertificateIssued || e.Time.IsZero() {
+		t.Errorf("unexpected first event %+v", e)
+	}
+	e = <-ch
+	if e.ID != 3 || e.Type != CertificateRevoked {
+		t.Errorf("unexpected second event %+v", e)
+	}
+
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Error("expected the channel to be closed once unsubscribed")
+	}
+	// Unsubscribing twice is harmless.
+	unsubscribe()
+	b.Publish(Event{Type: OCSPRefreshed})
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	var b Bus
+	slow, _ := b.Subscribe(1)
+	fast, unsubscribe := b.Subscribe(3)
+	defer unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		b.Publish(Event{Type: CertificateIssued})
+	}
+
+	if e, ok := <-slow; !ok || e.ID != 1 {
+		t.Fatalf("expected the slow subscriber to get the first event, got %+v", e)
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("expected the slow subscriber to be unsubscribed once its buffer was full")
+	}
+	for want := uint64(1); want <= 3; want++ {
+		if e := <-fast; e.ID != want {
+			t.Fatalf("expected event %d, got %+v", want, e)
+		}
+	}
+}
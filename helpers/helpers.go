@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/tls"
@@ -26,11 +27,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cloudflare/cfssl/crypto/pkcs12"
 	"github.com/cloudflare/cfssl/crypto/pkcs7"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers/derhelpers"
 	"github.com/cloudflare/cfssl/log"
-	"golang.org/x/crypto/pkcs12"
 )
 
 // OneYear is a time.Duration representing a year's worth of seconds.
@@ -134,6 +135,12 @@ func SignatureString(alg x509.SignatureAlgorithm) string {
 		return "SHA384WithRSA"
 	case x509.SHA512WithRSA:
 		return "SHA512WithRSA"
+	case x509.SHA256WithRSAPSS:
+		return "SHA256WithRSAPSS"
+	case x509.SHA384WithRSAPSS:
+		return "SHA384WithRSAPSS"
+	case x509.SHA512WithRSAPSS:
+		return "SHA512WithRSAPSS"
 	case x509.DSAWithSHA1:
 		return "DSAWithSHA1"
 	case x509.DSAWithSHA256:
@@ -146,6 +153,8 @@ func SignatureString(alg x509.SignatureAlgorithm) string {
 		return "ECDSAWithSHA384"
 	case x509.ECDSAWithSHA512:
 		return "ECDSAWithSHA512"
+	case x509.PureEd25519:
+		return "Ed25519"
 	default:
 		return "Unknown Signature"
 	}
@@ -167,6 +176,12 @@ func HashAlgoString(alg x509.SignatureAlgorithm) string {
 		return "SHA384"
 	case x509.SHA512WithRSA:
 		return "SHA512"
+	case x509.SHA256WithRSAPSS:
+		return "SHA256"
+	case x509.SHA384WithRSAPSS:
+		return "SHA384"
+	case x509.SHA512WithRSAPSS:
+		return "SHA512"
 	case x509.DSAWithSHA1:
 		return "SHA1"
 	case x509.DSAWithSHA256:
@@ -245,16 +260,16 @@ func ParseCertificatesDER(certsDER []byte, password string) (certs []*x509.Certi
 	certsDER = bytes.TrimSpace(certsDER)
 	pkcs7data, err := pkcs7.ParsePKCS7(certsDER)
 	if err != nil {
-		var pkcs12data interface{}
-		certs = make([]*x509.Certificate, 1)
-		pkcs12data, certs[0], err = pkcs12.Decode(certsDER, password)
+		var cert *x509.Certificate
+		var caCerts []*x509.Certificate
+		key, cert, caCerts, err = pkcs12.Decode(certsDER, password)
 		if err != nil {
 			certs, err = x509.ParseCertificates(certsDER)
 			if err != nil {
 				return nil, nil, cferr.New(cferr.CertificateError, cferr.DecodeFailed)
 			}
 		} else {
-			key = pkcs12data.(crypto.Signer)
+			certs = append([]*x509.Certificate{cert}, caCerts...)
 		}
 	} else {
 		if pkcs7data.ContentInfo != "SignedData" {
@@ -376,6 +391,27 @@ func ParsePrivateKeyPEMWithPassword(keyPEM []byte, password []byte) (key crypto.
 	return derhelpers.ParsePrivateKeyDER(keyDER)
 }
 
+// LoadPrivateKey reads the PEM-encoded private key in keyFile, which may
+// also be given as 'env:varname', and parses it with the password set in
+// the CFSSL_CA_PK_PASSWORD environment variable, if any.
+func LoadPrivateKey(keyFile string) (crypto.Signer, error) {
+	keyPEM, err := ReadBytes(keyFile)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+
+	var password []byte
+	if strPassword := os.Getenv("CFSSL_CA_PK_PASSWORD"); strPassword != "" {
+		password = []byte(strPassword)
+	}
+	key, err := ParsePrivateKeyPEMWithPassword(keyPEM, password)
+	if err != nil {
+		log.Debugf("malformed private key %v", err)
+		return nil, err
+	}
+	return key, nil
+}
+
 // GetKeyDERFromPEM parses a PEM-encoded private key and returns DER-format key bytes.
 func GetKeyDERFromPEM(in []byte, password []byte) ([]byte, error) {
 	// Ignore any EC PARAMETERS blocks when looking for a key (openssl includes
@@ -471,6 +507,25 @@ func SignerAlgo(priv crypto.Signer) x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	default:
+		return x509.UnknownSignatureAlgorithm
+	}
+}
+
+// PSSAlgo returns the RSASSA-PSS signature algorithm using the hash of
+// the RSA signature algorithm alg, or SHA-256 if alg uses SHA-1, which
+// isn't used with PSS. It returns x509.UnknownSignatureAlgorithm if alg
+// isn't an RSA signature algorithm.
+func PSSAlgo(alg x509.SignatureAlgorithm) x509.SignatureAlgorithm {
+	switch alg {
+	case x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA256WithRSAPSS:
+		return x509.SHA256WithRSAPSS
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS:
+		return x509.SHA384WithRSAPSS
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS:
+		return x509.SHA512WithRSAPSS
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
@@ -12,6 +12,7 @@ import (
 	"encoding/pem"
 	"io/ioutil"
 	"math"
+	"os"
 	"testing"
 	"time"
 
@@ -262,11 +263,33 @@ func TestSignatureString(t *testing.T) {
 	if SignatureString(x509.ECDSAWithSHA512) != "ECDSAWithSHA512" {
 		t.Fatal("Signature String functioning improperly")
 	}
+	if SignatureString(x509.PureEd25519) != "Ed25519" {
+		t.Fatal("Signature String functioning improperly")
+	}
+	if SignatureString(x509.SHA256WithRSAPSS) != "SHA256WithRSAPSS" {
+		t.Fatal("Signature String functioning improperly")
+	}
 	if SignatureString(math.MaxInt32) != "Unknown Signature" {
 		t.Fatal("Signature String functioning improperly")
 	}
 }
 
+func TestPSSAlgo(t *testing.T) {
+	for alg, pss := range map[x509.SignatureAlgorithm]x509.SignatureAlgorithm{
+		x509.SHA1WithRSA:      x509.SHA256WithRSAPSS,
+		x509.SHA256WithRSA:    x509.SHA256WithRSAPSS,
+		x509.SHA384WithRSA:    x509.SHA384WithRSAPSS,
+		x509.SHA512WithRSA:    x509.SHA512WithRSAPSS,
+		x509.SHA384WithRSAPSS: x509.SHA384WithRSAPSS,
+		x509.ECDSAWithSHA256:  x509.UnknownSignatureAlgorithm,
+		x509.PureEd25519:      x509.UnknownSignatureAlgorithm,
+	} {
+		if got := PSSAlgo(alg); got != pss {
+			t.Errorf("PSSAlgo(%v) = %v, expected %v", alg, got, pss)
+		}
+	}
+}
+
 func TestParseCertificatePEM(t *testing.T) {
 	for _, testFile := range []string{testCertFile, testExtraWSCertFile, testSinglePKCS7} {
 		certPEM, err := ioutil.ReadFile(testFile)
@@ -409,6 +432,39 @@ func TestParsePrivateKeyPEM(t *testing.T) {
 
 }
 
+func TestLoadPrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CFSSL_TEST_KEY", string(pem.EncodeToMemory(block)))
+	defer os.Unsetenv("CFSSL_TEST_KEY")
+
+	if _, err = LoadPrivateKey("env:CFSSL_TEST_KEY"); err == nil {
+		t.Fatal("expected an encrypted key to need a password")
+	}
+	os.Setenv("CFSSL_CA_PK_PASSWORD", "secret")
+	defer os.Unsetenv("CFSSL_CA_PK_PASSWORD")
+	loaded, err := LoadPrivateKey("env:CFSSL_TEST_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(loaded.Public()) {
+		t.Fatal("loaded key doesn't match")
+	}
+	if _, err = LoadPrivateKey("testdata/missing.pem"); err == nil {
+		t.Fatal("expected a missing key file to fail")
+	}
+}
+
 // Imported from signers/local/testdata/
 const ecdsaTestCSR = "testdata/ecdsa256.csr"
 
@@ -0,0 +1,170 @@
+// Package testca builds an in-memory CA hierarchy, a root CA and one
+// intermediate, for use in tests that need certificates issued by a
+// realistic chain.
+package testca
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/initca"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+)
+
+// Options configures NewHierarchy. The zero value is usable.
+type Options struct {
+	// KeyRequest describes the keys generated for the CAs and for
+	// leaf certificates issued with Issue. It defaults to ECDSA P-256.
+	KeyRequest *csr.KeyRequest
+
+	// RootCN and IntermediateCN are the common names of the CA
+	// certificates. They default to "Test Root CA" and
+	// "Test Intermediate CA".
+	RootCN         string
+	IntermediateCN string
+
+	// Expiry is the validity of the CA certificates. It defaults to
+	// the validity initca gives new CAs.
+	Expiry time.Duration
+
+	// Policy is the signing policy of the intermediate's signer. If
+	// nil, the local signer's default profile is used.
+	Policy *config.Signing
+}
+
+// A Hierarchy is a root CA, an intermediate CA issued by the root, and a
+// signer that issues leaf certificates under the intermediate.
+type Hierarchy struct {
+	RootPEM    []byte
+	RootKeyPEM []byte
+	Root       *x509.Certificate
+
+	IntermediatePEM    []byte
+	IntermediateKeyPEM []byte
+	Intermediate       *x509.Certificate
+
+	// Signer issues certificates with the intermediate's key.
+	Signer *local.Signer
+
+	keyRequest *csr.KeyRequest
+}
+
+// NewHierarchy creates a root CA with initca, and an intermediate CA
+// signed by it whose path length constraint forbids further CAs.
+func NewHierarchy(opts Options) (*Hierarchy, error) {
+	h := &Hierarchy{keyRequest: opts.KeyRequest}
+	if h.keyRequest == nil {
+		h.keyRequest = csr.NewKeyRequest()
+	}
+	rootCN := opts.RootCN
+	if rootCN == "" {
+		rootCN = "Test Root CA"
+	}
+	intermediateCN := opts.IntermediateCN
+	if intermediateCN == "" {
+		intermediateCN = "Test Intermediate CA"
+	}
+
+	rootReq := &csr.CertificateRequest{
+		CN:         rootCN,
+		KeyRequest: h.keyRequest,
+		CA:         &csr.CAConfig{},
+	}
+	if opts.Expiry != 0 {
+		rootReq.CA.Expiry = opts.Expiry.String()
+	}
+
+	var err error
+	h.RootPEM, _, h.RootKeyPEM, err = initca.New(rootReq)
+	if err != nil {
+		return nil, err
+	}
+	var rootSigner *local.Signer
+	rootSigner, h.Root, err = newSigner(h.RootPEM, h.RootKeyPEM, intermediatePolicy(opts.Expiry))
+	if err != nil {
+		return nil, err
+	}
+
+	intermediateCSR, intermediateKeyPEM, err := csr.ParseRequest(&csr.CertificateRequest{
+		CN:         intermediateCN,
+		KeyRequest: h.keyRequest,
+		CA:         &csr.CAConfig{PathLenZero: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.IntermediatePEM, err = rootSigner.Sign(signer.SignRequest{Request: string(intermediateCSR)})
+	if err != nil {
+		return nil, err
+	}
+	h.IntermediateKeyPEM = intermediateKeyPEM
+
+	h.Signer, h.Intermediate, err = newSigner(h.IntermediatePEM, h.IntermediateKeyPEM, opts.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// intermediatePolicy is the policy the root signs the intermediate with.
+func intermediatePolicy(expiry time.Duration) *config.Signing {
+	policy := initca.CAPolicy()
+	if expiry != 0 {
+		policy.Default.Expiry = expiry
+		policy.Default.ExpiryString = expiry.String()
+	}
+	policy.Default.CAConstraint.MaxPathLenZero = true
+	return policy
+}
+
+// newSigner returns a local signer for the CA certificate and key, along
+// with the parsed certificate.
+func newSigner(certPEM, keyPEM []byte, policy *config.Signing) (*local.Signer, *x509.Certificate, error) {
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := local.NewSigner(key, cert, signer.DefaultSigAlgo(key), policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, cert, nil
+}
+
+// Issue generates a key and a certificate for req, signed by the
+// intermediate with the given profile, and returns both PEM encoded. The
+// hierarchy's key request is used if req has none.
+func (h *Hierarchy) Issue(req *csr.CertificateRequest, profile string) (certPEM, keyPEM []byte, err error) {
+	if req.KeyRequest == nil {
+		req.KeyRequest = h.keyRequest
+	}
+	csrPEM, keyPEM, err := csr.ParseRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, err = h.Signer.Sign(signer.SignRequest{
+		Hosts:   req.Hosts,
+		Request: string(csrPEM),
+		Profile: profile,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+// ChainPEM returns the PEM encoded intermediate followed by the root,
+// the chain above a certificate issued with Issue.
+func (h *Hierarchy) ChainPEM() []byte {
+	chain := append([]byte{}, h.IntermediatePEM...)
+	return append(chain, h.RootPEM...)
+}
@@ -0,0 +1,71 @@
+package testca
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func TestNewHierarchy(t *testing.T) {
+	h, err := NewHierarchy(Options{Expiry: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Root.Subject.CommonName != "Test Root CA" || !h.Root.IsCA {
+		t.Errorf("unexpected root %+v", h.Root.Subject)
+	}
+	if h.Intermediate.Subject.CommonName != "Test Intermediate CA" || !h.Intermediate.IsCA {
+		t.Errorf("unexpected intermediate %+v", h.Intermediate.Subject)
+	}
+	if h.Intermediate.MaxPathLen != 0 || !h.Intermediate.MaxPathLenZero {
+		t.Error("expected the intermediate to forbid further CAs")
+	}
+	if err := h.Intermediate.CheckSignatureFrom(h.Root); err != nil {
+		t.Fatalf("intermediate not signed by the root: %v", err)
+	}
+	if validity := h.Intermediate.NotAfter.Sub(h.Intermediate.NotBefore); validity > 49*time.Hour {
+		t.Errorf("expected the intermediate to be valid for about 48h, got %v", validity)
+	}
+
+	certPEM, keyPEM, err := h.Issue(&csr.CertificateRequest{
+		CN:    "leaf.example.com",
+		Hosts: []string{"leaf.example.com"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := helpers.ParsePrivateKeyPEM(keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.IsCA {
+		t.Error("expected a leaf certificate")
+	}
+
+	chain, err := helpers.ParseCertificatesPEM(h.ChainPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("expected a chain of 2 certificates, got %d", len(chain))
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(h.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(h.Intermediate)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       "leaf.example.com",
+		Roots:         roots,
+		Intermediates: intermediates,
+	}); err != nil {
+		t.Fatalf("leaf does not verify up to the root: %v", err)
+	}
+}
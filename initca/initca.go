@@ -3,13 +3,18 @@
 package initca
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"io"
+	"math/big"
 	"time"
 
 	"github.com/cloudflare/cfssl/config"
@@ -67,6 +72,7 @@ func New(req *csr.CertificateRequest) (cert, csrPEM, key []byte, err error) {
 		} else {
 			policy.Default.CAConstraint.MaxPathLenZero = req.CA.PathLenZero
 		}
+		policy.Default.NameConstraints = req.CA.NameConstraints
 	}
 
 	g := &csr.Generator{Validator: validator}
@@ -158,6 +164,7 @@ func NewFromSigner(req *csr.CertificateRequest, priv crypto.Signer) (cert, csrPE
 		} else {
 			policy.Default.CAConstraint.MaxPathLenZero = req.CA.PathLenZero
 		}
+		policy.Default.NameConstraints = req.CA.NameConstraints
 	}
 
 	csrPEM, err = csr.Generate(priv, req)
@@ -206,6 +213,11 @@ func RenewFromSigner(ca *x509.Certificate, priv crypto.Signer) ([]byte, error) {
 		if ca.PublicKey.(*ecdsa.PublicKey).X.Cmp(ecdsaPublicKey.X) != 0 {
 			return nil, cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch)
 		}
+	case ca.PublicKeyAlgorithm == x509.Ed25519:
+		ed25519PublicKey, ok := priv.Public().(ed25519.PublicKey)
+		if !ok || !bytes.Equal(ca.PublicKey.(ed25519.PublicKey), ed25519PublicKey) {
+			return nil, cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch)
+		}
 	default:
 		return nil, cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC)
 	}
@@ -247,3 +259,70 @@ func Update(ca *x509.Certificate, priv crypto.Signer) (cert []byte, err error) {
 	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
 	return
 }
+
+// subjectKeyIDOID is the OID of the subjectKeyIdentifier extension.
+var subjectKeyIDOID = asn1.ObjectIdentifier{2, 5, 29, 14}
+
+// Rekey issues a new certificate for an existing CA certificate, signed
+// by its parent, that binds the CA's subject to a new key. The subject,
+// SANs, key usages, constraints and other extensions of the existing
+// certificate are kept, the validity period has the same length starting
+// from now but doesn't outlive the parent, and the SKI is recomputed
+// from the new key.
+func Rekey(ca *x509.Certificate, newKey crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) (cert []byte, err error) {
+	if !ca.IsCA {
+		return nil, errors.New("input certificate is not a CA cert")
+	}
+
+	if !bytes.Equal(ca.RawIssuer, parent.RawSubject) {
+		return nil, errors.New("input certificate was not issued by the parent certificate")
+	}
+
+	tmpl, err := x509.ParseCertificate(ca.Raw)
+	if err != nil {
+		return
+	}
+
+	serialNumber := make([]byte, 20)
+	_, err = io.ReadFull(rand.Reader, serialNumber)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	serialNumber[0] &= 0x7F
+
+	tmpl.PublicKey = newKey.Public()
+	tmpl.SerialNumber = new(big.Int).SetBytes(serialNumber)
+	tmpl.SignatureAlgorithm = signer.DefaultSigAlgo(parentKey)
+	// The AKI is taken from the parent's SKI by x509.CreateCertificate.
+	tmpl.AuthorityKeyId = nil
+	tmpl.SubjectKeyId, err = signer.ComputeSKI(tmpl)
+	if err != nil {
+		return
+	}
+	// Extensions crypto/x509 doesn't build from the template fields, such
+	// as those added by a signing profile, are carried over as they are.
+	tmpl.ExtraExtensions = nil
+	for _, ext := range ca.Extensions {
+		if ext.Id.Equal(subjectKeyIDOID) || ext.Id.Equal(signer.AuthorityKeyIDOID) {
+			continue
+		}
+		tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, ext)
+	}
+
+	validity := ca.NotAfter.Sub(ca.NotBefore)
+	tmpl.NotBefore = time.Now().Round(time.Minute).Add(-5 * time.Minute)
+	tmpl.NotAfter = tmpl.NotBefore.Add(validity)
+	// Like the certificates the parent signs, the rekeyed certificate
+	// must not outlive it.
+	if tmpl.NotAfter.After(parent.NotAfter) && parent.NotAfter.After(tmpl.NotBefore) {
+		log.Infof("capping the certificate's expiry at the parent's expiry %s", parent.NotAfter)
+		tmpl.NotAfter = parent.NotAfter.UTC()
+	}
+	cert, err = x509.CreateCertificate(rand.Reader, tmpl, parent, tmpl.PublicKey, parentKey)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	return
+}
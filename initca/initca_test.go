@@ -3,7 +3,13 @@ package initca
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -23,6 +29,7 @@ var validKeyParams = []csr.KeyRequest{
 	{A: "ecdsa", S: 256},
 	{A: "ecdsa", S: 384},
 	{A: "ecdsa", S: 521},
+	{A: "ed25519"},
 }
 
 var validCAConfigs = []csr.CAConfig{
@@ -62,6 +69,8 @@ var invalidCryptoParams = []csr.KeyRequest{
 }
 
 func TestInitCA(t *testing.T) {
+	// The CAPolicy replaced below is restored for the other tests.
+	defer func(policy func() *config.Signing) { CAPolicy = policy }(CAPolicy)
 	var req *csr.CertificateRequest
 	hostname := "cloudflare.com"
 	for _, param := range validKeyParams {
@@ -110,6 +119,10 @@ func TestInitCA(t *testing.T) {
 				if key.(*ecdsa.PrivateKey).Curve.Params().BitSize != param.Size() {
 					t.Fatal("Private key length mismatch.")
 				}
+			case "ed25519":
+				if !bytes.Equal(cert.PublicKey.(ed25519.PublicKey), key.Public().(ed25519.PublicKey)) {
+					t.Fatal("Cert key mismatch.")
+				}
 			}
 
 			// Verify CA MaxPathLen
@@ -383,3 +396,199 @@ func TestRenew(t *testing.T) {
 		t.Fatal("Update returned a certificate with different issuer info")
 	}
 }
+
+func TestRekey(t *testing.T) {
+	rootPEM, _, rootKeyPEM, err := New(&csr.CertificateRequest{
+		CN:         "Rekey Test Root",
+		KeyRequest: &csr.KeyRequest{A: "ecdsa", S: 256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := helpers.ParseCertificatePEM(rootPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey, err := helpers.ParsePrivateKeyPEM(rootKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interCSR, err := csr.Generate(interKey, &csr.CertificateRequest{
+		CN:    "Rekey Test Intermediate",
+		Names: []csr.Name{{C: "US", O: "CFSSL Unit Testing"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := CAPolicy()
+	policy.Default.CAConstraint.MaxPathLen = 0
+	policy.Default.CAConstraint.MaxPathLenZero = true
+	custom := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, Value: []byte{0x05, 0x00}}
+	policy.Default.ExtraExtensions = []pkix.Extension{custom}
+	s, err := local.NewSigner(rootKey, root, signer.DefaultSigAlgo(rootKey), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interPEM, err := s.Sign(signer.SignRequest{Request: string(interCSR)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter, err := helpers.ParseCertificatePEM(interPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rekeyedPEM, err := Rekey(inter, newKey, root, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekeyed, err := helpers.ParseCertificatePEM(rekeyedPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(rekeyed.RawSubject, inter.RawSubject) {
+		t.Fatal("rekeyed CA certificate has a different subject")
+	}
+	if bytes.Equal(rekeyed.RawSubjectPublicKeyInfo, inter.RawSubjectPublicKeyInfo) {
+		t.Fatal("rekeyed CA certificate still has the old key")
+	}
+	newPub := &newKey.PublicKey
+	if rekeyedPub, ok := rekeyed.PublicKey.(*ecdsa.PublicKey); !ok || rekeyedPub.X.Cmp(newPub.X) != 0 || rekeyedPub.Y.Cmp(newPub.Y) != 0 {
+		t.Fatal("rekeyed CA certificate doesn't carry the new key")
+	}
+	if bytes.Equal(rekeyed.SubjectKeyId, inter.SubjectKeyId) {
+		t.Fatal("rekeyed CA certificate SKI was not updated")
+	}
+	if !rekeyed.IsCA || rekeyed.MaxPathLen != inter.MaxPathLen || rekeyed.MaxPathLenZero != inter.MaxPathLenZero {
+		t.Fatal("rekeyed CA certificate constraints were not preserved")
+	}
+	if rekeyed.NotAfter.Sub(rekeyed.NotBefore) != inter.NotAfter.Sub(inter.NotBefore) {
+		t.Fatal("rekeyed CA certificate validity length was not preserved")
+	}
+	if err := rekeyed.CheckSignatureFrom(root); err != nil {
+		t.Fatalf("rekeyed CA certificate is not signed by the parent: %v", err)
+	}
+	var carried bool
+	for _, ext := range rekeyed.Extensions {
+		if ext.Id.Equal(custom.Id) {
+			carried = bytes.Equal(ext.Value, custom.Value)
+		}
+	}
+	if !carried {
+		t.Fatal("rekeyed CA certificate lost the custom extension")
+	}
+	if !bytes.Equal(rekeyed.AuthorityKeyId, root.SubjectKeyId) {
+		t.Fatal("rekeyed CA certificate doesn't carry the parent's SKI as its AKI")
+	}
+
+	// The rekeyed certificate doesn't outlive a parent expiring sooner.
+	shortParent := *root
+	shortParent.NotAfter = time.Now().Add(time.Hour).Truncate(time.Second)
+	rekeyedPEM, err = Rekey(inter, newKey, &shortParent, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rekeyed, err = helpers.ParseCertificatePEM(rekeyedPEM); err != nil {
+		t.Fatal(err)
+	}
+	if !rekeyed.NotAfter.Equal(shortParent.NotAfter) {
+		t.Fatalf("expected the expiry to be capped at %s, got %s", shortParent.NotAfter, rekeyed.NotAfter)
+	}
+
+	if _, err := Rekey(inter, newKey, inter, newKey); err == nil {
+		t.Fatal("expected rekeying under a different parent to fail")
+	}
+}
+
+func TestRenewEd25519(t *testing.T) {
+	req := &csr.CertificateRequest{
+		Names:      []csr.Name{{C: "US", O: "CloudFlare, Inc."}},
+		KeyRequest: &csr.KeyRequest{A: "ed25519"},
+	}
+	caPEM, _, keyPEM, err := New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := RenewFromSigner(ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.IsCA || cert.SignatureAlgorithm != x509.PureEd25519 {
+		t.Fatalf("expected an Ed25519 signed CA certificate, got %v", cert.SignatureAlgorithm)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenewFromSigner(ca, otherKey); err == nil {
+		t.Fatal("Fail to detect cert/key mismatch")
+	}
+}
+
+func TestInitCANameConstraints(t *testing.T) {
+	req := &csr.CertificateRequest{
+		CN:         "Team CA",
+		KeyRequest: csr.NewKeyRequest(),
+		CA: &csr.CAConfig{
+			NameConstraints: &config.NameConstraints{
+				PermittedDNSDomains: []string{".team.example.com"},
+				PermittedIPRanges:   []string{"192.0.2.0/24"},
+				ExcludedURIDomains:  []string{"other.example.com"},
+			},
+		},
+	}
+	certPEM, _, _, err := New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.PermittedDNSDomainsCritical || len(cert.PermittedDNSDomains) != 1 || cert.PermittedDNSDomains[0] != ".team.example.com" {
+		t.Fatalf("unexpected permitted DNS domains %v", cert.PermittedDNSDomains)
+	}
+	if len(cert.PermittedIPRanges) != 1 || cert.PermittedIPRanges[0].String() != "192.0.2.0/24" {
+		t.Fatalf("unexpected permitted IP ranges %v", cert.PermittedIPRanges)
+	}
+	if len(cert.ExcludedURIDomains) != 1 || cert.ExcludedURIDomains[0] != "other.example.com" {
+		t.Fatalf("unexpected excluded URI domains %v", cert.ExcludedURIDomains)
+	}
+
+	// Renewing the CA keeps its constraints.
+	renewed := csr.ExtractCertificateRequest(cert)
+	if renewed.CA.NameConstraints == nil || len(renewed.CA.NameConstraints.PermittedIPRanges) != 1 {
+		t.Fatalf("name constraints not extracted from the certificate: %+v", renewed.CA.NameConstraints)
+	}
+
+	req.CA.NameConstraints.PermittedIPRanges = []string{"not a range"}
+	if _, _, _, err = New(req); err == nil {
+		t.Fatal("expected an invalid IP range to be rejected")
+	}
+}
@@ -0,0 +1,241 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The following constants name the output formats of the package.
+const (
+	// FormatText prints each message on a line prefixed by its level,
+	// through the standard library's logging package.
+	FormatText = "text"
+	// FormatJSON prints each message as a JSON object on its own line,
+	// for log aggregation systems.
+	FormatJSON = "json"
+)
+
+// outputFormat is the current output format, set by SetFormat.
+var outputFormat = FormatText
+
+// SetFormat sets the output format to FormatText or FormatJSON. It has no
+// effect on the output of a logger passed to SetLogger.
+func SetFormat(f string) error {
+	switch f {
+	case FormatText, FormatJSON:
+		outputFormat = f
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q", f)
+}
+
+// ParseLevel parses a log level, given either by its number or by its
+// name, such as "debug" or "WARNING".
+func ParseLevel(s string) (int, error) {
+	if l, err := strconv.Atoi(s); err == nil {
+		if l < LevelDebug || l > LevelFatal {
+			return 0, fmt.Errorf("log level %d outside of [%d,%d]", l, LevelDebug, LevelFatal)
+		}
+		return l, nil
+	}
+	for l, prefix := range levelPrefix {
+		if strings.EqualFold(s, prefix) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// A field is a key and value attached to the messages of a Logger.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// A Logger logs messages along with a set of fields, such as the ID of
+// the request being handled. In the text format the fields follow the
+// message as key=value pairs; in the JSON format they are members of the
+// object. The zero Logger has no fields and logs like the package-level
+// functions.
+type Logger struct {
+	fields []field
+}
+
+// With returns a Logger adding the field key to the messages it logs.
+func With(key string, value interface{}) Logger {
+	return Logger{}.With(key, value)
+}
+
+// With returns a copy of l that also adds the field key to the messages
+// it logs.
+func (l Logger) With(key string, value interface{}) Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	return Logger{fields: append(fields, field{key, value})}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l, to be retrieved with
+// FromContext.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger carried by ctx, or the zero Logger if
+// it carries none.
+func FromContext(ctx context.Context) Logger {
+	l, _ := ctx.Value(contextKey{}).(Logger)
+	return l
+}
+
+// RequestIDKey is the field naming the request being handled in the
+// messages of the Logger returned by WithRequestID.
+const RequestIDKey = "request_id"
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID returns a copy of ctx carrying a Logger that adds the
+// request ID id to the messages it logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(RequestIDKey, id))
+}
+
+// RequestID returns the request ID carried by ctx, or "" if it carries
+// none.
+func RequestID(ctx context.Context) string {
+	for _, f := range FromContext(ctx).fields {
+		if f.key == RequestIDKey {
+			id, _ := f.value.(string)
+			return id
+		}
+	}
+	return ""
+}
+
+// jsonMu serializes the writes of JSON messages to the standard logger's
+// output, as the standard logger does for the text format.
+var jsonMu sync.Mutex
+
+func (l Logger) print(level int, msg string) {
+	if level < Level {
+		return
+	}
+	if syslogWriter == nil && outputFormat == FormatJSON {
+		l.printJSON(level, msg)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range l.fields {
+		fmt.Fprintf(&b, " %s=%v", f.key, f.value)
+	}
+	print(level, b.String())
+}
+
+func (l Logger) printJSON(level int, msg string) {
+	entry := map[string]interface{}{}
+	for _, f := range l.fields {
+		value := f.value
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[f.key] = value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = levelPrefix[level]
+	entry["msg"] = msg
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{
+			"time":  entry["time"].(string),
+			"level": levelPrefix[level],
+			"msg":   msg,
+			"error": err.Error(),
+		})
+	}
+
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	log.Writer().Write(append(line, '\n'))
+}
+
+// Fatalf logs a formatted message at the "fatal" level and then exits.
+func (l Logger) Fatalf(format string, v ...interface{}) {
+	l.print(LevelFatal, fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+// Fatal logs its arguments at the "fatal" level and then exits.
+func (l Logger) Fatal(v ...interface{}) {
+	l.print(LevelFatal, fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// Criticalf logs a formatted message at the "critical" level.
+func (l Logger) Criticalf(format string, v ...interface{}) {
+	l.print(LevelCritical, fmt.Sprintf(format, v...))
+}
+
+// Critical logs its arguments at the "critical" level.
+func (l Logger) Critical(v ...interface{}) {
+	l.print(LevelCritical, fmt.Sprint(v...))
+}
+
+// Errorf logs a formatted message at the "error" level.
+func (l Logger) Errorf(format string, v ...interface{}) {
+	l.print(LevelError, fmt.Sprintf(format, v...))
+}
+
+// Error logs its arguments at the "error" level.
+func (l Logger) Error(v ...interface{}) {
+	l.print(LevelError, fmt.Sprint(v...))
+}
+
+// Warningf logs a formatted message at the "warning" level.
+func (l Logger) Warningf(format string, v ...interface{}) {
+	l.print(LevelWarning, fmt.Sprintf(format, v...))
+}
+
+// Warning logs its arguments at the "warning" level.
+func (l Logger) Warning(v ...interface{}) {
+	l.print(LevelWarning, fmt.Sprint(v...))
+}
+
+// Infof logs a formatted message at the "info" level.
+func (l Logger) Infof(format string, v ...interface{}) {
+	l.print(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+// Info logs its arguments at the "info" level.
+func (l Logger) Info(v ...interface{}) {
+	l.print(LevelInfo, fmt.Sprint(v...))
+}
+
+// Debugf logs a formatted message at the "debug" level.
+func (l Logger) Debugf(format string, v ...interface{}) {
+	l.print(LevelDebug, fmt.Sprintf(format, v...))
+}
+
+// Debug logs its arguments at the "debug" level.
+func (l Logger) Debug(v ...interface{}) {
+	l.print(LevelDebug, fmt.Sprint(v...))
+}
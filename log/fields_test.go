@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLoggerFields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	Level = LevelDebug
+
+	With("request_id", "abc").With("serial", 42).Infof("signed %s", teststring)
+	if !strings.Contains(buf.String(), "[INFO] signed "+teststring+" request_id=abc serial=42") {
+		t.Fatalf("unexpected text output %q", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	Level = LevelDebug
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	defer SetFormat(FormatText)
+
+	ctx := WithRequestID(context.Background(), "abc")
+	FromContext(ctx).Warningf("%d failed", 2)
+	Info(teststring)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	var entry map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "WARNING" || entry["msg"] != "2 failed" || entry[RequestIDKey] != "abc" || entry["time"] == "" {
+		t.Fatalf("unexpected JSON entry %v", entry)
+	}
+	entry = nil
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "INFO" || entry["msg"] != teststring {
+		t.Fatalf("unexpected JSON entry %v", entry)
+	}
+
+	if err := SetFormat("xml"); err == nil {
+		t.Fatal("unknown format should be rejected")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if id := RequestID(context.Background()); id != "" {
+		t.Fatalf("unexpected request ID %q", id)
+	}
+	id := NewRequestID()
+	if len(id) != 16 || id == NewRequestID() {
+		t.Fatalf("bad request ID %q", id)
+	}
+	if got := RequestID(WithRequestID(context.Background(), id)); got != id {
+		t.Fatalf("got request ID %q, wanted %q", got, id)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]int{"0": LevelDebug, "2": LevelWarning, "debug": LevelDebug, "WARNING": LevelWarning, "fatal": LevelFatal} {
+		if l, err := ParseLevel(s); err != nil || l != want {
+			t.Errorf("ParseLevel(%q) = %d, %v; wanted %d", s, l, err, want)
+		}
+	}
+	for _, s := range []string{"6", "-1", "verbose"} {
+		if _, err := ParseLevel(s); err == nil {
+			t.Errorf("ParseLevel(%q) should fail", s)
+		}
+	}
+}
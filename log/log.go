@@ -2,7 +2,9 @@
 // logging package. Clients should set the current log level; only
 // messages below that level will actually be logged. For example, if
 // Level is set to LevelWarning, only log messages at the Warning,
-// Error, and Critical levels will be logged.
+// Error, and Critical levels will be logged. Messages are printed as
+// text, or as JSON objects once SetFormat(FormatJSON) is called, and a
+// Logger attaches fields such as request IDs to them.
 package log
 
 import (
@@ -86,11 +88,11 @@ func print(l int, msg string) {
 }
 
 func outputf(l int, format string, v []interface{}) {
-	print(l, fmt.Sprintf(format, v...))
+	Logger{}.print(l, fmt.Sprintf(format, v...))
 }
 
 func output(l int, v []interface{}) {
-	print(l, fmt.Sprint(v...))
+	Logger{}.print(l, fmt.Sprint(v...))
 }
 
 // Fatalf logs a formatted message at the "fatal" level and then exits. The
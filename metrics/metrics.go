@@ -0,0 +1,175 @@
+// Package metrics collects issuance and revocation metrics for CFSSL and
+// exposes them to Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/ocsp"
+)
+
+// DefaultRegistry holds the metrics defined by this package.
+var DefaultRegistry = prometheus.NewRegistry()
+
+var (
+	// CertificatesIssued counts certificates issued by the local signer,
+	// by signing profile.
+	CertificatesIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cfssl_certificates_issued_total",
+		Help: "Number of certificates issued, by signing profile.",
+	}, []string{"profile"})
+
+	// SignErrors counts rejected signing requests, by CFSSL error code.
+	SignErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cfssl_sign_errors_total",
+		Help: "Number of failed signing requests, by error code.",
+	}, []string{"reason"})
+
+	// SignDuration records how long the local signer takes to handle a
+	// signing request.
+	SignDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "cfssl_sign_duration_seconds",
+		Help: "Time taken to handle signing requests, in seconds.",
+	})
+
+	// OCSPRequests counts requests answered by the OCSP responder, by
+	// response status.
+	OCSPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cfssl_ocsp_requests_total",
+		Help: "Number of OCSP requests answered, by response status.",
+	}, []string{"status"})
+
+	// OCSPIssuerRequests counts requests answered by an OCSP responder
+	// serving several issuers, by issuer key hash and response status.
+	OCSPIssuerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cfssl_ocsp_issuer_requests_total",
+		Help: "Number of OCSP requests answered, by issuer key hash and response status.",
+	}, []string{"issuer", "status"})
+
+	// CRLGenerations counts the CRLs generated.
+	CRLGenerations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cfssl_crl_generations_total",
+		Help: "Number of CRLs generated.",
+	})
+
+	// OCSPResponseAge records the age of the OCSP responses served by the
+	// OCSP responder: the time elapsed since their thisUpdate.
+	OCSPResponseAge = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cfssl_ocsp_response_age_seconds",
+		Help:    "Age of the OCSP responses served, in seconds.",
+		Buckets: OCSPAgeBuckets,
+	})
+
+	// HTTPRequests counts the requests handled by the API endpoints, by
+	// endpoint and response status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cfssl_http_requests_total",
+		Help: "Number of HTTP requests handled, by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	// HTTPRequestDuration records how long the API endpoints take to
+	// handle requests.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cfssl_http_request_duration_seconds",
+		Help: "Time taken to handle HTTP requests, by endpoint, in seconds.",
+	}, []string{"endpoint"})
+
+	// CertDBQueryDuration records how long the certificate database takes
+	// to answer the queries of the certdb accessor.
+	CertDBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cfssl_certdb_query_duration_seconds",
+		Help: "Time taken by certificate database queries, by query, in seconds.",
+	}, []string{"query"})
+
+	// SignerUp is 1 when the signer is loaded with a valid signing
+	// policy, and 0 otherwise, as reported by the function given to
+	// SetSignerUp.
+	SignerUp = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cfssl_signer_up",
+		Help: "Whether the signer is loaded with a valid signing policy.",
+	}, func() float64 {
+		if up, ok := signerUp.Load().(func() float64); ok {
+			return up()
+		}
+		return 0
+	})
+)
+
+// signerUp holds the function computing SignerUp.
+var signerUp atomic.Value
+
+// SetSignerUp makes up compute the value of SignerUp each time the
+// metrics are collected.
+func SetSignerUp(up func() float64) {
+	signerUp.Store(up)
+}
+
+func init() {
+	DefaultRegistry.MustRegister(
+		CertificatesIssued,
+		SignErrors,
+		SignDuration,
+		OCSPRequests,
+		OCSPIssuerRequests,
+		CRLGenerations,
+		OCSPResponseAge,
+		HTTPRequests,
+		HTTPRequestDuration,
+		CertDBQueryDuration,
+		SignerUp,
+	)
+}
+
+// OCSPAgeBuckets are the upper bounds, in seconds, of the buckets of
+// OCSPResponseAge: from an hour to a week.
+var OCSPAgeBuckets = []float64{3600, 6 * 3600, 12 * 3600, 24 * 3600, 2 * 24 * 3600, 4 * 24 * 3600, 7 * 24 * 3600}
+
+// Handler returns the handler serving the default registry in the
+// Prometheus exposition formats.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(DefaultRegistry, promhttp.HandlerOpts{})
+}
+
+// ErrorReason returns the label used for err in SignErrors: its CFSSL
+// error code, or "unknown" for other errors.
+func ErrorReason(err error) string {
+	if e, ok := err.(*cferr.Error); ok {
+		return strconv.Itoa(e.ErrorCode)
+	}
+	return "unknown"
+}
+
+// OCSPStats records OCSP response statuses in OCSPRequests, and in
+// OCSPIssuerRequests for responders serving several issuers. It can be
+// passed to ocsp.NewResponder.
+type OCSPStats struct{}
+
+// ResponseStatus counts a response with the given status.
+func (OCSPStats) ResponseStatus(status ocsp.ResponseStatus) {
+	OCSPRequests.WithLabelValues(status.String()).Inc()
+}
+
+// IssuerResponseStatus counts a response to a request about the given
+// issuer in OCSPIssuerRequests.
+func (OCSPStats) IssuerResponseStatus(issuer string, status ocsp.ResponseStatus) {
+	OCSPIssuerRequests.WithLabelValues(issuer, status.String()).Inc()
+}
+
+// ResponseAge records the age of a served response in OCSPResponseAge.
+func (OCSPStats) ResponseAge(age time.Duration) {
+	OCSPResponseAge.Observe(age.Seconds())
+}
+
+// InstrumentHandler records the requests handled by h in HTTPRequests
+// and HTTPRequestDuration, under the given endpoint name.
+func InstrumentHandler(endpoint string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"endpoint": endpoint}
+	return promhttp.InstrumentHandlerDuration(HTTPRequestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(HTTPRequests.MustCurryWith(labels), h))
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/crypto/ocsp"
+)
+
+// sampleCount returns the number of observations of a histogram.
+func sampleCount(t *testing.T, h prometheus.Observer) uint64 {
+	var m dto.Metric
+	if err := h.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestHandler(t *testing.T) {
+	CertificatesIssued.WithLabelValues("www").Inc()
+	CRLGenerations.Inc()
+	SignDuration.Observe(0.05)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE cfssl_certificates_issued_total counter",
+		`cfssl_certificates_issued_total{profile="www"} `,
+		"# TYPE cfssl_crl_generations_total counter",
+		"# TYPE cfssl_sign_duration_seconds histogram",
+		`cfssl_sign_duration_seconds_bucket{le="0.05"} `,
+		`cfssl_sign_duration_seconds_bucket{le="+Inf"} `,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	if reason := ErrorReason(cferr.New(cferr.PolicyError, cferr.InvalidRequest)); reason != "5300" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+	if reason := ErrorReason(http.ErrBodyNotAllowed); reason != "unknown" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+}
+
+func TestOCSPStats(t *testing.T) {
+	before := testutil.ToFloat64(OCSPRequests.WithLabelValues("malformed"))
+	OCSPStats{}.ResponseStatus(ocsp.Malformed)
+	if testutil.ToFloat64(OCSPRequests.WithLabelValues("malformed")) != before+1 {
+		t.Error("OCSP response status not counted")
+	}
+
+	before = testutil.ToFloat64(OCSPIssuerRequests.WithLabelValues("00ff", "success"))
+	OCSPStats{}.IssuerResponseStatus("00ff", ocsp.Success)
+	if testutil.ToFloat64(OCSPIssuerRequests.WithLabelValues("00ff", "success")) != before+1 {
+		t.Error("OCSP issuer response status not counted")
+	}
+}
+
+func TestSignerUp(t *testing.T) {
+	SetSignerUp(func() float64 { return 1 })
+	if testutil.ToFloat64(SignerUp) != 1 {
+		t.Error("signer up not reported")
+	}
+	SetSignerUp(func() float64 { return 0 })
+	if testutil.ToFloat64(SignerUp) != 0 {
+		t.Error("signer down not reported")
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler("test_endpoint", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("instrumented response writer can't flush")
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	before := sampleCount(t, HTTPRequestDuration.WithLabelValues("test_endpoint"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if testutil.ToFloat64(HTTPRequests.WithLabelValues("test_endpoint", "200")) != 1 ||
+		testutil.ToFloat64(HTTPRequests.WithLabelValues("test_endpoint", "405")) != 1 {
+		t.Error("requests not counted by status code")
+	}
+	if sampleCount(t, HTTPRequestDuration.WithLabelValues("test_endpoint")) != before+2 {
+		t.Error("request durations not recorded")
+	}
+}
+
+func TestOCSPResponseAge(t *testing.T) {
+	before := sampleCount(t, OCSPResponseAge)
+	OCSPStats{}.ResponseAge(2 * time.Hour)
+	if sampleCount(t, OCSPResponseAge) != before+1 {
+		t.Error("OCSP response age not recorded")
+	}
+}
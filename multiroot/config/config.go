@@ -8,12 +8,15 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/config"
@@ -105,6 +108,68 @@ type Root struct {
 	Config      *config.Signing
 	ACL         whitelist.NetACL
 	DB          *sqlx.DB
+	Limits      Limits
+	// CRLExpiry is the validity of the CRLs served for a root with a
+	// DB, and CRLRefresh how often they are regenerated; zero means
+	// half of CRLExpiry.
+	CRLExpiry  time.Duration
+	CRLRefresh time.Duration
+}
+
+// DefaultCRLExpiry is the validity of the CRLs of a root that doesn't
+// set crl_expiry.
+const DefaultCRLExpiry = 7 * helpers.OneDay
+
+// parseCRLDurations reads the crl_expiry and crl_refresh entries of a
+// root.
+func parseCRLDurations(cfg map[string]string) (expiry, refresh time.Duration, err error) {
+	expiry = DefaultCRLExpiry
+	if v, ok := cfg["crl_expiry"]; ok {
+		if expiry, err = time.ParseDuration(v); err != nil || expiry <= 0 {
+			return 0, 0, fmt.Errorf("config: invalid crl_expiry %q", v)
+		}
+	}
+	if v, ok := cfg["crl_refresh"]; ok {
+		if refresh, err = time.ParseDuration(v); err != nil || refresh < 0 || refresh > expiry {
+			return 0, 0, fmt.Errorf("config: invalid crl_refresh %q", v)
+		}
+	}
+	return expiry, refresh, nil
+}
+
+// Limits bound the sign requests a root accepts, as a whole and from
+// each of its auth keys: Rate and KeyRate in requests per second, and
+// DailyQuota and KeyDailyQuota in certificates issued per UTC day. Zero
+// means no limit.
+type Limits struct {
+	Rate          float64
+	DailyQuota    int
+	KeyRate       float64
+	KeyDailyQuota int
+}
+
+// parseLimits reads the rate_limit, daily_quota, key_rate_limit and
+// key_daily_quota entries of a root.
+func parseLimits(cfg map[string]string) (limits Limits, err error) {
+	rates := map[string]*float64{"rate_limit": &limits.Rate, "key_rate_limit": &limits.KeyRate}
+	for entry, rate := range rates {
+		if v, ok := cfg[entry]; ok {
+			*rate, err = strconv.ParseFloat(v, 64)
+			if err != nil || *rate < 0 || math.IsNaN(*rate) || math.IsInf(*rate, 0) {
+				return limits, fmt.Errorf("config: invalid %s %q", entry, v)
+			}
+		}
+	}
+
+	quotas := map[string]*int{"daily_quota": &limits.DailyQuota, "key_daily_quota": &limits.KeyDailyQuota}
+	for entry, quota := range quotas {
+		if v, ok := cfg[entry]; ok {
+			if *quota, err = strconv.Atoi(v); err != nil || *quota < 0 {
+				return limits, fmt.Errorf("config: invalid %s %q", entry, v)
+			}
+		}
+	}
+	return limits, nil
 }
 
 // LoadRoot parses a config structure into a Root structure
@@ -155,6 +220,11 @@ func LoadRoot(cfg map[string]string) (*Root, error) {
 		}
 	}
 
+	root.Limits, err = parseLimits(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	dbConfig := cfg["dbconfig"]
 	if dbConfig != "" {
 		db, err := dbconf.DBFromConfig(dbConfig)
@@ -162,6 +232,11 @@ func LoadRoot(cfg map[string]string) (*Root, error) {
 			return nil, err
 		}
 		root.DB = db
+
+		root.CRLExpiry, root.CRLRefresh, err = parseCRLDurations(cfg)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &root, nil
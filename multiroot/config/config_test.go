@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/cloudflare/cfssl/log"
 
@@ -139,6 +140,8 @@ func TestLoadKSMRoot(t *testing.T) {
 func TestLoadBadRootConfs(t *testing.T) {
 	confs := []string{
 		"testdata/roots_bad_db.conf",
+		"testdata/roots_bad_limits.conf",
+		"testdata/roots_bad_crl.conf",
 		"testdata/roots_bad_certificate.conf",
 		"testdata/roots_bad_private_key.conf",
 		"testdata/roots_badconfig.conf",
@@ -271,4 +274,37 @@ func TestLoadDBConfig(t *testing.T) {
 	if roots["primary"].DB == nil {
 		t.Fatal("Expected a non-nil DB for the primary root")
 	}
+	if roots["primary"].CRLExpiry != 48*time.Hour || roots["primary"].CRLRefresh != 0 {
+		t.Fatalf("Unexpected CRL expiry %v and refresh %v for the primary root",
+			roots["primary"].CRLExpiry, roots["primary"].CRLRefresh)
+	}
+}
+
+const confLimits = "testdata/roots_limits.conf"
+
+func TestLoadLimits(t *testing.T) {
+	roots, err := Parse(confLimits)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if roots["backup"].Limits != (Limits{}) {
+		t.Fatalf("Expected no limits for the backup root, got %+v", roots["backup"].Limits)
+	}
+
+	expected := Limits{Rate: 2.5, DailyQuota: 1000, KeyRate: 0.5, KeyDailyQuota: 100}
+	if roots["primary"].Limits != expected {
+		t.Fatalf("Expected limits %+v for the primary root, got %+v", expected, roots["primary"].Limits)
+	}
+}
+
+func TestParseLimitsInvalid(t *testing.T) {
+	for _, v := range []string{"-1", "NaN", "Inf", "-Inf", "fast"} {
+		if _, err := parseLimits(map[string]string{"rate_limit": v}); err == nil {
+			t.Errorf("Expected rate_limit %q to be rejected", v)
+		}
+		if _, err := parseLimits(map[string]string{"key_rate_limit": v}); err == nil {
+			t.Errorf("Expected key_rate_limit %q to be rejected", v)
+		}
+	}
 }
@@ -5,9 +5,27 @@ package config
 import "time"
 
 // Config contains configuration information required to set up an OCSP signer.
+// KeyFile may name a key held in a key management service instead of a file.
+// If Remote is set, the responses are signed by that CFSSL server instead,
+// and only the Remote fields are used.
 type Config struct {
 	CACertFile        string
 	ResponderCertFile string
 	KeyFile           string
 	Interval          time.Duration
+
+	// ResponderLifetime, if set while ResponderCertFile isn't, makes
+	// KeyFile the CA key, from which delegated responder certificates
+	// valid for ResponderLifetime are issued and rotated.
+	ResponderLifetime time.Duration
+
+	// Remote is the address of a CFSSL server signing the responses.
+	Remote string
+	// RemoteCAFile holds the CAs trusted for TLS connections to Remote,
+	// instead of the system trust store.
+	RemoteCAFile string
+	// RemoteCertFile and RemoteKeyFile are the client certificate and
+	// key presented to Remote, if any.
+	RemoteCertFile string
+	RemoteKeyFile  string
 }
@@ -0,0 +1,176 @@
+package ocsp
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrUnknownIssuer is returned by a MultiIssuerSource for requests about
+// certificates of an issuer it has no responses for. The responder
+// answers them like ErrNotFound.
+var ErrUnknownIssuer = errors.New("Request issuer is unknown")
+
+// UnknownIssuer names, in the stats of a Responder, the issuers an
+// IssuerSource doesn't answer for.
+const UnknownIssuer = "unknown"
+
+// An IssuerSource is a Source answering for several issuers, which it
+// tells apart by the issuer key hash of the requests. It returns
+// ErrUnknownIssuer for requests about other issuers.
+type IssuerSource interface {
+	Source
+	// Issuers returns the hex-encoded key hashes of the issuers the
+	// source answers for.
+	Issuers() []string
+}
+
+// An issuerKey identifies an issuer by its key hash, computed with the
+// given hash function, as in the CertID of OCSP requests and responses.
+type issuerKey struct {
+	hash    crypto.Hash
+	keyHash string
+}
+
+// A MultiIssuerSource is an in-memory IssuerSource for the responses of
+// several issuers, such as a whole hierarchy of intermediates. Responses
+// are indexed by the key hash of their issuer, then by serial number, so
+// that certificates of different issuers with the same serial number
+// are told apart. Requests using another hash function than the
+// responses' CertID, which is SHA-1 for the responses signed by CFSSL,
+// can't be matched to an issuer: they are answered by serial number
+// alone, as long as a single issuer has a response for it.
+type MultiIssuerSource struct {
+	responses map[issuerKey]map[string][]byte
+}
+
+// NewMultiIssuerSource returns an empty MultiIssuerSource.
+func NewMultiIssuerSource() *MultiIssuerSource {
+	return &MultiIssuerSource{responses: map[issuerKey]map[string][]byte{}}
+}
+
+// responseCertID, singleResponse and responseData mirror the structures
+// of RFC 6960 enough to extract the CertID of a response, whose issuer
+// key hash golang.org/x/crypto/ocsp does not expose.
+type responseCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type singleResponse struct {
+	CertID responseCertID
+}
+
+type responseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []singleResponse
+}
+
+// Add parses the DER-encoded OCSP response der and indexes it under its
+// issuer and serial number.
+func (src *MultiIssuerSource) Add(der []byte) error {
+	resp, err := ocsp.ParseResponse(der, nil)
+	if err != nil {
+		return err
+	}
+
+	var data responseData
+	if _, err = asn1.Unmarshal(resp.TBSResponseData, &data); err != nil {
+		return err
+	}
+	if len(data.Responses) != 1 {
+		return errors.New("OCSP response must contain exactly one single response")
+	}
+
+	key := issuerKey{hash: resp.IssuerHash, keyHash: hex.EncodeToString(data.Responses[0].CertID.IssuerKeyHash)}
+	serials := src.responses[key]
+	if serials == nil {
+		serials = map[string][]byte{}
+		src.responses[key] = serials
+	}
+	serials[resp.SerialNumber.String()] = der
+	return nil
+}
+
+// Response looks up the response for the issuer and serial number of
+// request.
+func (src *MultiIssuerSource) Response(request *ocsp.Request) ([]byte, http.Header, error) {
+	serials, ok := src.responses[issuerKey{hash: request.HashAlgorithm, keyHash: hex.EncodeToString(request.IssuerKeyHash)}]
+	if !ok {
+		if src.hashes(request.HashAlgorithm) {
+			return nil, nil, ErrUnknownIssuer
+		}
+		return src.responseBySerial(request.SerialNumber)
+	}
+	response, ok := serials[request.SerialNumber.String()]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return response, nil, nil
+}
+
+// hashes returns whether src has responses whose CertID uses the hash
+// function hash.
+func (src *MultiIssuerSource) hashes(hash crypto.Hash) bool {
+	for key := range src.responses {
+		if key.hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// responseBySerial looks up the response for serial when a single
+// issuer has one. The issuer is unknown otherwise.
+func (src *MultiIssuerSource) responseBySerial(serial *big.Int) ([]byte, http.Header, error) {
+	var response []byte
+	for _, serials := range src.responses {
+		if der, ok := serials[serial.String()]; ok {
+			if response != nil {
+				return nil, nil, ErrUnknownIssuer
+			}
+			response = der
+		}
+	}
+	if response == nil {
+		return nil, nil, ErrUnknownIssuer
+	}
+	return response, nil, nil
+}
+
+// Issuers returns the hex-encoded key hashes of the issuers src has
+// responses for, sorted.
+func (src *MultiIssuerSource) Issuers() []string {
+	var issuers []string
+	seen := map[string]bool{}
+	for key := range src.responses {
+		if !seen[key.keyHash] {
+			seen[key.keyHash] = true
+			issuers = append(issuers, key.keyHash)
+		}
+	}
+	sort.Strings(issuers)
+	return issuers
+}
+
+// Len returns the number of responses in src.
+func (src *MultiIssuerSource) Len() int {
+	n := 0
+	for _, serials := range src.responses {
+		n += len(serials)
+	}
+	return n
+}
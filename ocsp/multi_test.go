@@ -0,0 +1,175 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	goocsp "golang.org/x/crypto/ocsp"
+)
+
+// testIssuerResponse creates a CA named name, along with a certificate it issued
+// with the given serial number and its OCSP request and response.
+func testIssuerResponse(t *testing.T, name string, serial int64, status int) (ca *x509.Certificate, request, response []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name + " leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leafTemplate, ca, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request, err = goocsp.CreateRequest(leaf, ca, nil); err != nil {
+		t.Fatal(err)
+	}
+	response, err = goocsp.CreateResponse(ca, ca, goocsp.Response{
+		Status:       status,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, request, response
+}
+
+type issuerStats struct {
+	statuses map[string][]goocsp.ResponseStatus
+}
+
+func (s *issuerStats) ResponseStatus(goocsp.ResponseStatus) {}
+
+func (s *issuerStats) IssuerResponseStatus(issuer string, status goocsp.ResponseStatus) {
+	s.statuses[issuer] = append(s.statuses[issuer], status)
+}
+
+func TestMultiIssuerSource(t *testing.T) {
+	// Both issuers have a certificate with the same serial number.
+	_, goodReq, goodResp := testIssuerResponse(t, "Intermediate A", 42, goocsp.Good)
+	_, revokedReq, revokedResp := testIssuerResponse(t, "Intermediate B", 42, goocsp.Revoked)
+	_, unknownReq, _ := testIssuerResponse(t, "Intermediate C", 42, goocsp.Good)
+
+	src := NewMultiIssuerSource()
+	for _, der := range [][]byte{goodResp, revokedResp} {
+		if err := src.Add(der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.Add([]byte("not a response")); err == nil {
+		t.Fatal("Invalid response should be rejected")
+	}
+	if len(src.Issuers()) != 2 || src.Len() != 2 {
+		t.Fatalf("Expected 2 issuers and 2 responses, got %d and %d", len(src.Issuers()), src.Len())
+	}
+
+	stats := &issuerStats{statuses: map[string][]goocsp.ResponseStatus{}}
+	responder := NewResponder(src, stats)
+	post := func(body []byte) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+		return rw
+	}
+
+	for _, tc := range []struct {
+		request, response []byte
+	}{
+		{goodReq, goodResp},
+		{revokedReq, revokedResp},
+	} {
+		rw := post(tc.request)
+		if rw.Code != http.StatusOK || !bytes.Equal(rw.Body.Bytes(), tc.response) {
+			t.Fatalf("Expected the response of the request's issuer, got status %d", rw.Code)
+		}
+	}
+
+	rw := post(unknownReq)
+	if !bytes.Equal(rw.Body.Bytes(), unauthorizedErrorResponse) {
+		t.Fatalf("Unknown issuer should get an unauthorized response, got %x", rw.Body.Bytes())
+	}
+
+	req, err := goocsp.ParseRequest(goodReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SerialNumber = big.NewInt(43)
+	if _, _, err = src.Response(req); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for an unknown serial, got %v", err)
+	}
+
+	// Requests hashed with SHA-256 are answered by serial number when
+	// a single issuer has a response for it.
+	_, onlyReq, onlyResp := testIssuerResponse(t, "Intermediate D", 44, goocsp.Good)
+	if err = src.Add(onlyResp); err != nil {
+		t.Fatal(err)
+	}
+	if req, err = goocsp.ParseRequest(onlyReq); err != nil {
+		t.Fatal(err)
+	}
+	req.HashAlgorithm = crypto.SHA256
+	req.IssuerKeyHash = make([]byte, 32)
+	if response, _, err := src.Response(req); err != nil || !bytes.Equal(response, onlyResp) {
+		t.Fatalf("Expected the response of the only issuer with the serial number, got %v", err)
+	}
+	req.SerialNumber = big.NewInt(42)
+	if _, _, err = src.Response(req); err != ErrUnknownIssuer {
+		t.Fatalf("Expected ErrUnknownIssuer for a serial number of several issuers, got %v", err)
+	}
+	req.SerialNumber = big.NewInt(45)
+	if _, _, err = src.Response(req); err != ErrUnknownIssuer {
+		t.Fatalf("Expected ErrUnknownIssuer for an unknown serial number, got %v", err)
+	}
+
+	req, err = goocsp.ParseRequest(goodReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := hex.EncodeToString(req.IssuerKeyHash)
+	if s := stats.statuses[issuer]; len(s) != 1 || s[0] != goocsp.Success {
+		t.Errorf("Unexpected statuses for issuer %s: %v", issuer, s)
+	}
+	if s := stats.statuses[UnknownIssuer]; len(s) != 1 || s[0] != goocsp.Unauthorized {
+		t.Errorf("Unexpected statuses for unknown issuers: %v", s)
+	}
+	if len(stats.statuses) != 3 {
+		t.Errorf("Expected statuses for 3 issuers, got %d", len(stats.statuses))
+	}
+}
@@ -20,6 +20,7 @@ import (
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer/kms"
 	"golang.org/x/crypto/ocsp"
 )
 
@@ -105,7 +106,9 @@ func ReasonStringToCode(reason string) (reasonCode int, err error) {
 }
 
 // NewSignerFromFile reads the issuer cert, the responder cert and the responder key
-// from PEM files, and takes an interval in seconds
+// from PEM files, and takes an interval in seconds. The responder key may
+// instead be held in a key management service, with keyFile giving its URI
+// as described in the signer/kms package.
 func NewSignerFromFile(issuerFile, responderFile, keyFile string, interval time.Duration) (Signer, error) {
 	log.Debug("Loading issuer cert: ", issuerFile)
 	issuerBytes, err := helpers.ReadBytes(issuerFile)
@@ -117,11 +120,6 @@ func NewSignerFromFile(issuerFile, responderFile, keyFile string, interval time.
 	if err != nil {
 		return nil, err
 	}
-	log.Debug("Loading responder key: ", keyFile)
-	keyBytes, err := ioutil.ReadFile(keyFile)
-	if err != nil {
-		return nil, cferr.Wrap(cferr.CertificateError, cferr.ReadFailed, err)
-	}
 
 	issuerCert, err := helpers.ParseCertificatePEM(issuerBytes)
 	if err != nil {
@@ -133,15 +131,46 @@ func NewSignerFromFile(issuerFile, responderFile, keyFile string, interval time.
 		return nil, err
 	}
 
-	key, err := helpers.ParsePrivateKeyPEM(keyBytes)
+	key, err := loadResponderKey(keyFile)
 	if err != nil {
-		log.Debugf("Malformed private key %v", err)
 		return nil, err
 	}
+	if kms.IsURI(keyFile) {
+		certKey, err := x509.MarshalPKIXPublicKey(responderCert.PublicKey)
+		if err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+		}
+		pub, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil || !bytes.Equal(certKey, pub) {
+			return nil, cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch)
+		}
+	}
 
 	return NewSigner(issuerCert, responderCert, key, interval)
 }
 
+// loadResponderKey reads the responder key from a PEM file, or opens it
+// in a key management service.
+func loadResponderKey(keyFile string) (crypto.Signer, error) {
+	if kms.IsURI(keyFile) {
+		log.Debug("Using responder key: ", keyFile)
+		return kms.NewSigner(keyFile)
+	}
+
+	log.Debug("Loading responder key: ", keyFile)
+	keyBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+
+	key, err := helpers.ParsePrivateKeyPEM(keyBytes)
+	if err != nil {
+		log.Debugf("Malformed private key %v", err)
+		return nil, err
+	}
+	return key, nil
+}
+
 // NewSigner simply constructs a new StandardSigner object from the inputs,
 // taking the interval in seconds
 func NewSigner(issuer, responder *x509.Certificate, key crypto.Signer, interval time.Duration) (Signer, error) {
@@ -213,3 +242,47 @@ func (s StandardSigner) Sign(req SignRequest) ([]byte, error) {
 
 	return ocsp.CreateResponse(s.issuer, s.responder, template, s.key)
 }
+
+// Resign creates a new OCSP response carrying the same certificate status as
+// resp, which must be a response previously issued for s.issuer, with the
+// given extensions added. Any existing extensions with the same object IDs
+// are replaced. It is used to echo OCSP request nonces.
+func (s StandardSigner) Resign(resp *ocsp.Response, extensions []pkix.Extension) ([]byte, error) {
+	if resp == nil {
+		return nil, cferr.New(cferr.OCSPError, cferr.ReadFailed)
+	}
+
+	var extraExtensions []pkix.Extension
+	for _, ext := range resp.Extensions {
+		replaced := false
+		for _, newExt := range extensions {
+			if ext.Id.Equal(newExt.Id) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			extraExtensions = append(extraExtensions, ext)
+		}
+	}
+	extraExtensions = append(extraExtensions, extensions...)
+
+	certificate := s.responder
+	if s.issuer == s.responder || bytes.Equal(s.issuer.Raw, s.responder.Raw) {
+		certificate = nil
+	}
+
+	template := ocsp.Response{
+		Status:           resp.Status,
+		SerialNumber:     resp.SerialNumber,
+		ThisUpdate:       resp.ThisUpdate,
+		NextUpdate:       resp.NextUpdate,
+		RevokedAt:        resp.RevokedAt,
+		RevocationReason: resp.RevocationReason,
+		Certificate:      certificate,
+		ExtraExtensions:  extraExtensions,
+		IssuerHash:       resp.IssuerHash,
+	}
+
+	return ocsp.CreateResponse(s.issuer, s.responder, template, s.key)
+}
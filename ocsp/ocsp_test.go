@@ -1,13 +1,20 @@
 package ocsp
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
 	"io/ioutil"
 	"testing"
 	"time"
 
 	"golang.org/x/crypto/ocsp"
 
+	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer/kms"
 )
 
 const (
@@ -208,3 +215,73 @@ func TestSignCustomInterval(t *testing.T) {
 		t.Fatalf("Unexpected NextUpdate: wanted %s, got %s", next, resp.NextUpdate)
 	}
 }
+
+// kmsClient is a kms.Client signing with keys held in memory.
+type kmsClient struct {
+	keys map[string]crypto.Signer
+}
+
+func (c *kmsClient) PublicKey(keyID string) (crypto.PublicKey, error) {
+	key, ok := c.keys[keyID]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return key.Public(), nil
+}
+
+func (c *kmsClient) Sign(keyID string, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return c.keys[keyID].Sign(rand.Reader, digest, opts)
+}
+
+func TestNewSignerFromFileWithKMSKey(t *testing.T) {
+	keyPEM, err := ioutil.ReadFile(serverKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kms.Register(kms.SchemeGCP, func(*kms.URI) (kms.Client, error) {
+		return &kmsClient{keys: map[string]crypto.Signer{"responder": key, "other": otherKey}}, nil
+	})
+	defer kms.Register(kms.SchemeGCP, nil)
+
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, "gcpkms:///responder", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := s.Sign(SignRequest{Certificate: cert, Status: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ocsp.ParseResponse(der, issuer); err != nil {
+		t.Fatalf("response isn't signed by the KMS key: %v", err)
+	}
+
+	_, err = NewSignerFromFile(serverCertFile, serverCertFile, "gcpkms:///other", time.Hour)
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PrivateKeyError)+int(cferr.KeyMismatch) {
+		t.Fatalf("expected a key that doesn't match the responder certificate to be rejected, got %v", err)
+	}
+}
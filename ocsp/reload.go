@@ -0,0 +1,118 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"sync"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+// A ReloadableSigner is a Signer and Resigner whose responder certificate
+// and key are read from files and can be reloaded while it is in use, so
+// that a delegated responder certificate can be rotated without
+// restarting the responder. Requests that started before a reload are
+// signed with the previous certificate and key.
+type ReloadableSigner struct {
+	issuerFile    string
+	responderFile string
+	keyFile       string
+	interval      time.Duration
+
+	lock    sync.RWMutex
+	current *StandardSigner
+}
+
+// NewReloadableSignerFromFile reads the issuer cert, the responder cert
+// and the responder key from PEM files, like NewSignerFromFile, and
+// returns a signer whose Reload method reads them again.
+func NewReloadableSignerFromFile(issuerFile, responderFile, keyFile string, interval time.Duration) (*ReloadableSigner, error) {
+	s, err := NewSignerFromFile(issuerFile, responderFile, keyFile, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &ReloadableSigner{
+		issuerFile:    issuerFile,
+		responderFile: responderFile,
+		keyFile:       keyFile,
+		interval:      interval,
+		current:       s.(*StandardSigner),
+	}, nil
+}
+
+func (s *ReloadableSigner) signer() *StandardSigner {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.current
+}
+
+// Reload reads the responder certificate and key again and swaps them in.
+// The new responder certificate must be for the same issuer, matching the
+// new key, currently valid, and either be the issuer itself or be issued
+// by it with the OCSP signing extended key usage. If any of this fails,
+// the signer keeps using the previous certificate and key.
+func (s *ReloadableSigner) Reload() error {
+	loaded, err := NewSignerFromFile(s.issuerFile, s.responderFile, s.keyFile, s.interval)
+	if err != nil {
+		return err
+	}
+	next := loaded.(*StandardSigner)
+	if err = checkResponder(s.signer().issuer, next); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.current = next
+	s.lock.Unlock()
+	log.Infof("reloaded OCSP responder certificate %x", next.responder.SerialNumber)
+	return nil
+}
+
+// checkResponder verifies that next may replace a signer for issuer.
+func checkResponder(issuer *x509.Certificate, next *StandardSigner) error {
+	if !bytes.Equal(issuer.Raw, next.issuer.Raw) {
+		return cferr.Wrap(cferr.OCSPError, cferr.IssuerMismatch,
+			errors.New("the new issuer certificate differs from the current one"))
+	}
+	certKey, err := x509.MarshalPKIXPublicKey(next.responder.PublicKey)
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+	key, err := x509.MarshalPKIXPublicKey(next.key.Public())
+	if err != nil || !bytes.Equal(certKey, key) {
+		return cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch)
+	}
+	now := time.Now()
+	if now.Before(next.responder.NotBefore) || now.After(next.responder.NotAfter) {
+		return cferr.Wrap(cferr.CertificateError, cferr.VerifyFailed,
+			x509.CertificateInvalidError{Cert: next.responder, Reason: x509.Expired})
+	}
+	if bytes.Equal(next.responder.Raw, issuer.Raw) {
+		return nil
+	}
+	if err = next.responder.CheckSignatureFrom(issuer); err != nil {
+		return cferr.Wrap(cferr.OCSPError, cferr.IssuerMismatch, err)
+	}
+	for _, usage := range next.responder.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+	return cferr.Wrap(cferr.OCSPError, cferr.IssuerMismatch,
+		errors.New("the responder certificate lacks the OCSP signing extended key usage"))
+}
+
+// Sign signs req with the current responder certificate and key.
+func (s *ReloadableSigner) Sign(req SignRequest) ([]byte, error) {
+	return s.signer().Sign(req)
+}
+
+// Resign re-signs resp with the current responder certificate and key.
+func (s *ReloadableSigner) Resign(resp *ocsp.Response, extensions []pkix.Extension) ([]byte, error) {
+	return s.signer().Resign(resp, extensions)
+}
@@ -0,0 +1,153 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, serial int64, template *x509.Certificate, issuer *testIssuer) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(serial)
+	if template.NotAfter.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	parent, signer := template, crypto.Signer(key)
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func newTestCA(t *testing.T, serial int64) *testIssuer {
+	cert, key := newTestCert(t, serial, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "OCSP test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	return &testIssuer{cert: cert, key: key}
+}
+
+func newTestResponder(t *testing.T, serial int64, ca *testIssuer, usages ...x509.ExtKeyUsage) *testIssuer {
+	cert, key := newTestCert(t, serial, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP test responder"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: usages,
+	}, ca)
+	return &testIssuer{cert: cert, key: key}
+}
+
+func writeResponder(t *testing.T, dir string, responder *testIssuer) {
+	keyDER, err := x509.MarshalECPrivateKey(responder.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, "responder.pem"), helpers.EncodeCertificatePEM(responder.cert), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "responder-key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadableSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-ocsp-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t, 1)
+	leaf, _ := newTestCert(t, 2, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, ca)
+	oldResponder := newTestResponder(t, 3, ca, x509.ExtKeyUsageOCSPSigning)
+	newResponder := newTestResponder(t, 4, ca, x509.ExtKeyUsageOCSPSigning)
+	expiredCert, expiredKey := newTestCert(t, 8, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP test responder"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		NotBefore:   time.Now().Add(-2 * time.Hour),
+		NotAfter:    time.Now().Add(-time.Hour),
+	}, ca)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, helpers.EncodeCertificatePEM(ca.cert), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeResponder(t, dir, oldResponder)
+	s, err := NewReloadableSignerFromFile(caFile, filepath.Join(dir, "responder.pem"), filepath.Join(dir, "responder-key.pem"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectResponder := func(signer Signer, responder *testIssuer) {
+		t.Helper()
+		der, err := signer.Sign(SignRequest{Certificate: leaf, Status: "good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ocsp.ParseResponse(der, ca.cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Certificate == nil || !bytes.Equal(resp.Certificate.Raw, responder.cert.Raw) {
+			t.Fatalf("response not signed by responder %d", responder.cert.SerialNumber)
+		}
+	}
+	expectResponder(s, oldResponder)
+
+	// Responders that must not be swapped in leave the old one in use.
+	for _, bad := range []*testIssuer{
+		newTestResponder(t, 5, ca),
+		newTestResponder(t, 6, newTestCA(t, 7), x509.ExtKeyUsageOCSPSigning),
+		{cert: newResponder.cert, key: oldResponder.key},
+		{cert: expiredCert, key: expiredKey},
+	} {
+		writeResponder(t, dir, bad)
+		if err := s.Reload(); err == nil {
+			t.Errorf("expected responder %d to be rejected", bad.cert.SerialNumber)
+		}
+		expectResponder(s, oldResponder)
+	}
+
+	inFlight := s.signer()
+	writeResponder(t, dir, newResponder)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	expectResponder(s, newResponder)
+	expectResponder(inFlight, oldResponder)
+}
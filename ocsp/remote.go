@@ -0,0 +1,92 @@
+package ocsp
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cloudflare/cfssl/api/client"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// hashNames are the names of the issuer hash functions in ocspsign
+// requests.
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA1:   "SHA1",
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// remoteSignRequest is the body of an ocspsign request.
+type remoteSignRequest struct {
+	Certificate string `json:"certificate"`
+	Status      string `json:"status"`
+	Reason      int    `json:"reason,omitempty"`
+	RevokedAt   string `json:"revoked_at,omitempty"`
+	IssuerHash  string `json:"issuer_hash,omitempty"`
+	ThisUpdate  string `json:"this_update,omitempty"`
+	NextUpdate  string `json:"next_update,omitempty"`
+}
+
+// A RemoteSigner is a Signer that has the responses signed by a remote
+// CFSSL server, through its ocspsign endpoint. The server holds the
+// responder certificate and key, and sets the update times of the
+// responses unless the request gives them. The remote must be a
+// client.OCSPSigner.
+type RemoteSigner struct {
+	remote client.Remote
+}
+
+// NewRemoteSigner returns a RemoteSigner using remote.
+func NewRemoteSigner(remote client.Remote) *RemoteSigner {
+	return &RemoteSigner{remote: remote}
+}
+
+// Sign sends req to the remote server, and returns the OCSP response
+// it signed.
+func (s *RemoteSigner) Sign(req SignRequest) ([]byte, error) {
+	remote, ok := s.remote.(client.OCSPSigner)
+	if !ok {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.Unknown,
+			errors.New("the remote can't sign OCSP responses"))
+	}
+	if req.Certificate == nil {
+		return nil, cferr.New(cferr.OCSPError, cferr.ReadFailed)
+	}
+	if len(req.Extensions) > 0 {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.Unknown,
+			errors.New("a remote OCSP signer can't add extensions to the response"))
+	}
+
+	remoteReq := remoteSignRequest{
+		Certificate: string(helpers.EncodeCertificatePEM(req.Certificate)),
+		Status:      req.Status,
+	}
+	if req.Status == "revoked" {
+		remoteReq.Reason = req.Reason
+		remoteReq.RevokedAt = req.RevokedAt.Format(time.RFC3339)
+	}
+	if req.IssuerHash != 0 {
+		name, ok := hashNames[req.IssuerHash]
+		if !ok {
+			return nil, cferr.Wrap(cferr.OCSPError, cferr.Unknown,
+				errors.New("unsupported issuer hash algorithm"))
+		}
+		remoteReq.IssuerHash = name
+	}
+	if req.ThisUpdate != nil {
+		remoteReq.ThisUpdate = req.ThisUpdate.Format(time.RFC3339)
+	}
+	if req.NextUpdate != nil {
+		remoteReq.NextUpdate = req.NextUpdate.Format(time.RFC3339)
+	}
+
+	body, err := json.Marshal(remoteReq)
+	if err != nil {
+		return nil, err
+	}
+	return remote.OCSPSign(body)
+}
@@ -0,0 +1,88 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// BuildRequest returns a DER encoded OCSP request for cert, which was
+// issued by issuer. The certificate is identified with SHA-1 hashes, as
+// most responders expect.
+func BuildRequest(cert, issuer *x509.Certificate) ([]byte, error) {
+	if cert == nil || issuer == nil {
+		return nil, errors.New("building an OCSP request needs a certificate and its issuer")
+	}
+	return ocsp.CreateRequest(cert, issuer, nil)
+}
+
+// NewHTTPRequest returns an HTTP request sending the DER encoded OCSP
+// request req to the responder at server, using method GET or POST. A GET
+// request carries req base64 encoded in the URL path, as described in
+// RFC 6960 appendix A.1; a POST request carries it as the body.
+func NewHTTPRequest(method, server string, req []byte) (*http.Request, error) {
+	switch method {
+	case http.MethodGet:
+		encoded := url.PathEscape(base64.StdEncoding.EncodeToString(req))
+		return http.NewRequest(http.MethodGet, strings.TrimSuffix(server, "/")+"/"+encoded, nil)
+	case http.MethodPost:
+		httpReq, err := http.NewRequest(http.MethodPost, server, bytes.NewReader(req))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/ocsp-request")
+		return httpReq, nil
+	default:
+		return nil, fmt.Errorf("unsupported OCSP request method %s", method)
+	}
+}
+
+// VerifyResponse parses a DER encoded OCSP response for cert, issued by
+// issuer, and checks that it is signed by the issuer or by a responder
+// the issuer delegated OCSP signing to, that it is about cert, and that
+// it is current. The parsed response is returned.
+func VerifyResponse(der []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	resp, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.ReadFailed, err)
+	}
+
+	if resp.Certificate != nil && !resp.Certificate.Equal(issuer) {
+		var delegated bool
+		for _, usage := range resp.Certificate.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageOCSPSigning {
+				delegated = true
+			}
+		}
+		if !delegated {
+			return nil, cferr.Wrap(cferr.OCSPError, cferr.IssuerMismatch,
+				errors.New("responder certificate is not authorized to sign OCSP responses"))
+		}
+	}
+
+	if resp.SerialNumber == nil || resp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.InvalidStatus,
+			fmt.Errorf("response is for serial %v, not %v", resp.SerialNumber, cert.SerialNumber))
+	}
+
+	now := time.Now()
+	if resp.ThisUpdate.After(now) {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.InvalidStatus,
+			fmt.Errorf("response is not valid before %v", resp.ThisUpdate))
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now) {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.InvalidStatus,
+			fmt.Errorf("response expired at %v", resp.NextUpdate))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package ocsp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := setup(t)
+	cert := req.Certificate
+
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presigned, err := s.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewResponder(InMemorySource{cert.SerialNumber.String(): presigned}, nil))
+	defer ts.Close()
+
+	der, err := BuildRequest(cert, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildRequest(cert, nil); err == nil {
+		t.Error("expected a request without an issuer to be rejected")
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		httpReq, err := NewHTTPRequest(method, ts.URL, der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", method, httpResp.StatusCode)
+		}
+
+		resp, err := VerifyResponse(body, cert, issuer)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if resp.Status != ocsp.Good {
+			t.Errorf("%s: expected a good status, got %d", method, resp.Status)
+		}
+
+		// The responder's reply doesn't cover the issuer itself.
+		if _, err := VerifyResponse(body, issuer, issuer); err == nil {
+			t.Errorf("%s: expected a response for another certificate to be rejected", method)
+		}
+	}
+
+	if _, err := NewHTTPRequest(http.MethodPut, ts.URL, der); err == nil {
+		t.Error("expected an unsupported method to be rejected")
+	}
+}
+
+func TestVerifyResponseExpired(t *testing.T) {
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := setup(t)
+
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thisUpdate := time.Now().Add(-2 * time.Hour)
+	nextUpdate := time.Now().Add(-time.Hour)
+	req.ThisUpdate = &thisUpdate
+	req.NextUpdate = &nextUpdate
+	der, err := s.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyResponse(der, req.Certificate, issuer); err == nil {
+		t.Fatal("expected an expired response to be rejected")
+	}
+}
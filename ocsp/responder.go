@@ -10,6 +10,8 @@ package ocsp
 import (
 	"crypto"
 	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -19,8 +21,10 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
+	"github.com/cloudflare/cfssl/api"
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/certdb/sql"
@@ -39,8 +43,16 @@ var (
 	// ErrNotFound indicates the request OCSP response was not found. It is used to
 	// indicate that the responder should reply with unauthorizedErrorResponse.
 	ErrNotFound = errors.New("Request OCSP Response not found")
+
+	// NonceOID is the object ID of the OCSP nonce extension
+	// https://tools.ietf.org/html/rfc8954#section-2.1
+	NonceOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
 )
 
+// DefaultMaxNonceLength is the longest nonce, in octets, that a Responder
+// accepts unless configured otherwise. RFC 8954 limits nonces to 32 octets.
+const DefaultMaxNonceLength = 32
+
 // Source represents the logical source of OCSP responses, i.e.,
 // the logic that actually chooses a response based on a request.  In
 // order to create an actual responder, wrap one of these in a Responder
@@ -125,11 +137,13 @@ func (src DBSource) Response(req *ocsp.Request) ([]byte, http.Header, error) {
 	return []byte(cur.Body), nil, nil
 }
 
-// NewSourceFromFile reads the named file into an InMemorySource.
+// NewSourceFromFile reads the named file into a MultiIssuerSource.
 // The file read by this function must contain whitespace-separated OCSP
 // responses. Each OCSP response must be in base64-encoded DER form (i.e.,
 // PEM without headers or whitespace).  Invalid responses are ignored.
-// This function pulls the entire file into an InMemorySource.
+// This function pulls the entire file into memory, indexing the
+// responses by issuer so that a single file may hold the responses of
+// several issuers.
 func NewSourceFromFile(responseFile string) (Source, error) {
 	fileContents, err := ioutil.ReadFile(responseFile)
 	if err != nil {
@@ -137,7 +151,7 @@ func NewSourceFromFile(responseFile string) (Source, error) {
 	}
 
 	responsesB64 := regexp.MustCompile("\\s").Split(string(fileContents), -1)
-	src := InMemorySource{}
+	src := NewMultiIssuerSource()
 	for _, b64 := range responsesB64 {
 		// if the line/space is empty just skip
 		if b64 == "" {
@@ -149,16 +163,13 @@ func NewSourceFromFile(responseFile string) (Source, error) {
 			continue
 		}
 
-		response, tmpErr := ocsp.ParseResponse(der, nil)
-		if tmpErr != nil {
+		if tmpErr = src.Add(der); tmpErr != nil {
 			log.Errorf("OCSP decode error %s on: %s", tmpErr, b64)
 			continue
 		}
-
-		src[response.SerialNumber.String()] = der
 	}
 
-	log.Infof("Read %d OCSP responses", len(src))
+	log.Infof("Read %d OCSP responses for %d issuers", src.Len(), len(src.Issuers()))
 	return src, nil
 }
 
@@ -184,12 +195,43 @@ type Stats interface {
 	ResponseStatus(ocsp.ResponseStatus)
 }
 
+// AgeStats may be implemented by a Stats to also record the age of the
+// responses served: the time elapsed since their thisUpdate.
+type AgeStats interface {
+	ResponseAge(time.Duration)
+}
+
+// IssuerStats may be implemented by a Stats to also record the status
+// of the responses to each issuer of an IssuerSource. Issuers are named
+// by their hex-encoded key hash, or UnknownIssuer for the requests
+// about issuers the source doesn't answer for.
+type IssuerStats interface {
+	IssuerResponseStatus(issuer string, status ocsp.ResponseStatus)
+}
+
+// A Resigner produces a freshly signed copy of a pre-signed OCSP response
+// with additional response extensions. The Responder uses it to echo the
+// nonce of a request in the response. StandardSigner implements Resigner.
+type Resigner interface {
+	Resign(resp *ocsp.Response, extensions []pkix.Extension) ([]byte, error)
+}
+
 // A Responder object provides the HTTP logic to expose a
 // Source of OCSP responses.
 type Responder struct {
 	Source Source
-	stats  Stats
-	clk    clock.Clock
+	// Resigner, if set, is used to echo the nonce extension of a request
+	// in the response, as described in RFC 8954. Without a Resigner the
+	// pre-signed response from the Source is returned unchanged.
+	Resigner Resigner
+	// DisableNonce turns off nonce echoing even if a Resigner is set.
+	DisableNonce bool
+	// MaxNonceLength is the longest nonce, in octets, that is accepted.
+	// Requests with longer nonces are rejected as malformed. If zero,
+	// DefaultMaxNonceLength is used.
+	MaxNonceLength int
+	stats          Stats
+	clk            clock.Clock
 }
 
 // NewResponder instantiates a Responder with the give Source.
@@ -201,6 +243,59 @@ func NewResponder(source Source, stats Stats) *Responder {
 	}
 }
 
+// NewResponderWithResigner instantiates a Responder with the given Source
+// that echoes request nonces by re-signing responses with resigner.
+func NewResponderWithResigner(source Source, resigner Resigner, stats Stats) *Responder {
+	rs := NewResponder(source, stats)
+	rs.Resigner = resigner
+	return rs
+}
+
+// nonceOCSPRequest mirrors the OCSPRequest structure of RFC 6960 closely
+// enough to extract the request extensions, which golang.org/x/crypto/ocsp
+// does not expose.
+type nonceOCSPRequest struct {
+	TBSRequest nonceTBSRequest
+}
+
+type nonceTBSRequest struct {
+	Version           int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName     asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList       []asn1.RawValue
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+// ParseRequestNonce returns the nonce extension of the DER encoded OCSP
+// request, or nil if the request doesn't carry one.
+func ParseRequestNonce(der []byte) (*pkix.Extension, error) {
+	var req nonceOCSPRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		return nil, err
+	}
+
+	for _, ext := range req.TBSRequest.RequestExtensions {
+		if ext.Id.Equal(NonceOID) {
+			nonce := ext
+			return &nonce, nil
+		}
+	}
+	return nil, nil
+}
+
+// nonceLength returns the length of the nonce carried by the extension.
+// Per RFC 8954 the extension value is a DER encoded OCTET STRING.
+func nonceLength(ext *pkix.Extension) (int, error) {
+	var nonce []byte
+	rest, err := asn1.Unmarshal(ext.Value, &nonce)
+	if err != nil {
+		return 0, err
+	}
+	if len(rest) != 0 {
+		return 0, errors.New("trailing data after OCSP nonce")
+	}
+	return len(nonce), nil
+}
+
 func overrideHeaders(response http.ResponseWriter, headers http.Header) {
 	for k, v := range headers {
 		if len(v) == 1 {
@@ -214,6 +309,29 @@ func overrideHeaders(response http.ResponseWriter, headers http.Header) {
 	}
 }
 
+// notModifiedSince reports whether a client holding the response as of
+// its If-Modified-Since date still has a current copy: the response has
+// not been updated since then and has not reached its NextUpdate. Dates
+// are compared to the second, the precision of HTTP dates.
+func notModifiedSince(request *http.Request, resp *ocsp.Response, now time.Time) bool {
+	ims := request.Header.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		// Last-Modified is sent in the RFC 1123 format with a UTC zone,
+		// which clients may echo back as is.
+		if since, err = time.Parse(time.RFC1123, ims); err != nil {
+			return false
+		}
+	}
+	if !now.Before(resp.NextUpdate) {
+		return false
+	}
+	return !resp.ThisUpdate.Truncate(time.Second).After(since)
+}
+
 type logEvent struct {
 	IP       string        `json:"ip,omitempty"`
 	UA       string        `json:"ua,omitempty"`
@@ -224,6 +342,7 @@ type logEvent struct {
 	Took     time.Duration `json:"took,omitempty"`
 	Headers  http.Header   `json:"headers,omitempty"`
 
+	RequestID      string `json:"request_id,omitempty"`
 	Serial         string `json:"serial,omitempty"`
 	IssuerKeyHash  string `json:"issuerKeyHash,omitempty"`
 	IssuerNameHash string `json:"issuerNameHash,omitempty"`
@@ -239,6 +358,37 @@ var hashToString = map[crypto.Hash]string{
 	crypto.SHA512: "SHA512",
 }
 
+// decodeGETRequest returns the DER-encoded OCSP request held in the path
+// of a GET request: its base64 encoding, URL-encoded (RFC 6960 appendix
+// A.1). The unpadded and URL-safe base64 alphabets some clients use are
+// accepted too.
+func decodeGETRequest(path string) ([]byte, error) {
+	base64Request, err := url.QueryUnescape(path)
+	if err != nil {
+		return nil, err
+	}
+	// url.QueryUnescape not only unescapes %2B escaping, but it additionally
+	// turns the resulting '+' into a space, which makes base64 decoding fail.
+	// So we go back afterwards and turn ' ' back into '+'. This means we
+	// accept some malformed input that includes ' ' or %20, but that's fine.
+	base64Request = strings.Replace(base64Request, " ", "+", -1)
+	// In certain situations a UA may construct a request that has a double
+	// slash between the host name and the base64 request body due to naively
+	// constructing the request URL. In that case strip the leading slash
+	// so that we can still decode the request.
+	base64Request = strings.TrimPrefix(base64Request, "/")
+	if base64Request == "" {
+		return nil, errors.New("empty request")
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if der, err := encoding.DecodeString(base64Request); err == nil {
+			return der, nil
+		}
+	}
+	return nil, errors.New("invalid base64 encoding")
+}
+
 // A Responder can process both GET and POST requests.  The mapping
 // from an OCSP request to an OCSP response is done by the Source;
 // the Responder simply decodes the request, and passes back whatever
@@ -250,6 +400,10 @@ var hashToString = map[crypto.Hash]string{
 // strings of repeated '/' into a single '/', which will break the base64
 // encoding.
 func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	// The request ID is only logged: it would be cached along with the
+	// response if it were returned.
+	requestID := api.RequestID(request)
+	logger := log.With(log.RequestIDKey, requestID)
 	le := logEvent{
 		IP:       request.RemoteAddr,
 		UA:       request.UserAgent(),
@@ -257,6 +411,7 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		Path:     request.URL.Path,
 		Received: time.Now(),
 	}
+	le.RequestID = requestID
 	defer func() {
 		le.Headers = response.Header()
 		le.Took = time.Since(le.Received)
@@ -264,10 +419,10 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		if err != nil {
 			// we log this error at the debug level as if we aren't at that level anyway
 			// we shouldn't really care about marshalling the log event object
-			log.Debugf("failed to marshal log event object: %s", err)
+			logger.Debugf("failed to marshal log event object: %s", err)
 			return
 		}
-		log.Debugf("Received request: %s", string(jb))
+		logger.Debugf("Received request: %s", string(jb))
 	}()
 	// By default we set a 'max-age=0, no-cache' Cache-Control header, this
 	// is only returned to the client if a valid authorized OCSP response
@@ -279,39 +434,18 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	var err error
 	switch request.Method {
 	case "GET":
-		base64Request, err := url.QueryUnescape(request.URL.Path)
+		requestBody, err = decodeGETRequest(request.URL.Path)
 		if err != nil {
-			log.Debugf("Error decoding URL: %s", request.URL.Path)
-			response.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		// url.QueryUnescape not only unescapes %2B escaping, but it additionally
-		// turns the resulting '+' into a space, which makes base64 decoding fail.
-		// So we go back afterwards and turn ' ' back into '+'. This means we
-		// accept some malformed input that includes ' ' or %20, but that's fine.
-		base64RequestBytes := []byte(base64Request)
-		for i := range base64RequestBytes {
-			if base64RequestBytes[i] == ' ' {
-				base64RequestBytes[i] = '+'
-			}
-		}
-		// In certain situations a UA may construct a request that has a double
-		// slash between the host name and the base64 request body due to naively
-		// constructing the request URL. In that case strip the leading slash
-		// so that we can still decode the request.
-		if len(base64RequestBytes) > 0 && base64RequestBytes[0] == '/' {
-			base64RequestBytes = base64RequestBytes[1:]
-		}
-		requestBody, err = base64.StdEncoding.DecodeString(string(base64RequestBytes))
-		if err != nil {
-			log.Debugf("Error decoding base64 from URL: %s", string(base64RequestBytes))
-			response.WriteHeader(http.StatusBadRequest)
+			// The path doesn't name an OCSP request, so there is
+			// nothing here: caches may keep the 404 like any other.
+			logger.Debugf("Error decoding GET request %s: %s", request.URL.Path, err)
+			response.WriteHeader(http.StatusNotFound)
 			return
 		}
 	case "POST":
 		requestBody, err = ioutil.ReadAll(request.Body)
 		if err != nil {
-			log.Errorf("Problem reading body of POST: %s", err)
+			logger.Errorf("Problem reading body of POST: %s", err)
 			response.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -320,7 +454,7 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		return
 	}
 	b64Body := base64.StdEncoding.EncodeToString(requestBody)
-	log.Debugf("Received OCSP request: %s", b64Body)
+	logger.Debugf("Received OCSP request: %s", b64Body)
 	if request.Method == http.MethodPost {
 		le.Body = b64Body
 	}
@@ -331,12 +465,9 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	response.Header().Add("Content-Type", "application/ocsp-response")
 
 	// Parse response as an OCSP request
-	// XXX: This fails if the request contains the nonce extension.
-	//      We don't intend to support nonces anyway, but maybe we
-	//      should return unauthorizedRequest instead of malformed.
 	ocspRequest, err := ocsp.ParseRequest(requestBody)
 	if err != nil {
-		log.Debugf("Error decoding request body: %s", b64Body)
+		logger.Debugf("Error decoding request body: %s", b64Body)
 		response.WriteHeader(http.StatusBadRequest)
 		response.Write(malformedRequestErrorResponse)
 		if rs.stats != nil {
@@ -344,6 +475,30 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		}
 		return
 	}
+
+	var nonce *pkix.Extension
+	if rs.Resigner != nil && !rs.DisableNonce {
+		nonce, err = ParseRequestNonce(requestBody)
+		if err == nil && nonce != nil {
+			maxNonceLength := rs.MaxNonceLength
+			if maxNonceLength == 0 {
+				maxNonceLength = DefaultMaxNonceLength
+			}
+			var n int
+			if n, err = nonceLength(nonce); err == nil && (n == 0 || n > maxNonceLength) {
+				err = fmt.Errorf("nonce length %d outside of [1,%d]", n, maxNonceLength)
+			}
+		}
+		if err != nil {
+			logger.Debugf("Error decoding request nonce: %s, request body %s", err, b64Body)
+			response.WriteHeader(http.StatusBadRequest)
+			response.Write(malformedRequestErrorResponse)
+			if rs.stats != nil {
+				rs.stats.ResponseStatus(ocsp.Malformed)
+			}
+			return
+		}
+	}
 	le.Serial = fmt.Sprintf("%x", ocspRequest.SerialNumber.Bytes())
 	le.IssuerKeyHash = fmt.Sprintf("%x", ocspRequest.IssuerKeyHash)
 	le.IssuerNameHash = fmt.Sprintf("%x", ocspRequest.IssuerNameHash)
@@ -352,36 +507,49 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	// Look up OCSP response from source
 	ocspResponse, headers, err := rs.Source.Response(ocspRequest)
 	if err != nil {
-		if err == ErrNotFound {
-			log.Infof("No response found for request: serial %x, request body %s",
+		switch err {
+		case ErrNotFound:
+			logger.Infof("No response found for request: serial %x, request body %s",
 				ocspRequest.SerialNumber, b64Body)
 			response.Write(unauthorizedErrorResponse)
-			if rs.stats != nil {
-				rs.stats.ResponseStatus(ocsp.Unauthorized)
-			}
+			rs.responseStatus(ocspRequest, ocsp.Unauthorized)
+			return
+		case ErrUnknownIssuer:
+			logger.Infof("Unknown issuer for request: issuer key hash %x, serial %x, request body %s",
+				ocspRequest.IssuerKeyHash, ocspRequest.SerialNumber, b64Body)
+			response.Write(unauthorizedErrorResponse)
+			rs.responseStatus(nil, ocsp.Unauthorized)
 			return
 		}
-		log.Infof("Error retrieving response for request: serial %x, request body %s, error: %s",
+		logger.Infof("Error retrieving response for request: serial %x, request body %s, error: %s",
 			ocspRequest.SerialNumber, b64Body, err)
 		response.WriteHeader(http.StatusInternalServerError)
 		response.Write(internalErrorErrorResponse)
-		if rs.stats != nil {
-			rs.stats.ResponseStatus(ocsp.InternalError)
-		}
+		rs.responseStatus(ocspRequest, ocsp.InternalError)
 		return
 	}
 
 	parsedResponse, err := ocsp.ParseResponse(ocspResponse, nil)
 	if err != nil {
-		log.Errorf("Error parsing response for serial %x: %s",
+		logger.Errorf("Error parsing response for serial %x: %s",
 			ocspRequest.SerialNumber, err)
 		response.Write(internalErrorErrorResponse)
-		if rs.stats != nil {
-			rs.stats.ResponseStatus(ocsp.InternalError)
-		}
+		rs.responseStatus(ocspRequest, ocsp.InternalError)
 		return
 	}
 
+	if nonce != nil {
+		ocspResponse, err = rs.Resigner.Resign(parsedResponse, []pkix.Extension{*nonce})
+		if err != nil {
+			logger.Errorf("Error signing response with nonce for serial %x: %s",
+				ocspRequest.SerialNumber, err)
+			response.WriteHeader(http.StatusInternalServerError)
+			response.Write(internalErrorErrorResponse)
+			rs.responseStatus(ocspRequest, ocsp.InternalError)
+			return
+		}
+	}
+
 	// Write OCSP response to response
 	response.Header().Add("Last-Modified", parsedResponse.ThisUpdate.Format(time.RFC1123))
 	response.Header().Add("Expires", parsedResponse.NextUpdate.Format(time.RFC1123))
@@ -408,6 +576,17 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		overrideHeaders(response, headers)
 	}
 
+	// A response echoing a nonce is specific to a single request and
+	// must not be served from a cache.
+	if nonce != nil {
+		response.Header().Set("Cache-Control", "max-age=0, no-cache")
+		response.Header().Del("ETag")
+		response.WriteHeader(http.StatusOK)
+		response.Write(ocspResponse)
+		rs.served(ocspRequest, parsedResponse, now)
+		return
+	}
+
 	// RFC 7232 says that a 304 response must contain the above
 	// headers if they would also be sent for a 200 for the same
 	// request, so we have to wait until here to do this
@@ -416,10 +595,47 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 			response.WriteHeader(http.StatusNotModified)
 			return
 		}
+	} else if request.Method == http.MethodGet && notModifiedSince(request, parsedResponse, now) {
+		response.WriteHeader(http.StatusNotModified)
+		return
 	}
 	response.WriteHeader(http.StatusOK)
 	response.Write(ocspResponse)
-	if rs.stats != nil {
-		rs.stats.ResponseStatus(ocsp.Success)
+	rs.served(ocspRequest, parsedResponse, now)
+}
+
+// responseStatus records the status of the response to req in the stats
+// of the responder. The status is also recorded for the issuer of req if
+// the source answers for several issuers, or for UnknownIssuer if req is
+// nil.
+func (rs *Responder) responseStatus(req *ocsp.Request, status ocsp.ResponseStatus) {
+	if rs.stats == nil {
+		return
+	}
+	rs.stats.ResponseStatus(status)
+	stats, ok := rs.stats.(IssuerStats)
+	if !ok {
+		return
+	}
+	if _, ok = rs.Source.(IssuerSource); !ok {
+		// Only issuer-aware sources bound the set of issuers.
+		return
+	}
+	issuer := UnknownIssuer
+	if req != nil {
+		issuer = hex.EncodeToString(req.IssuerKeyHash)
+	}
+	stats.IssuerResponseStatus(issuer, status)
+}
+
+// served records a successful response to req in the stats of the
+// responder.
+func (rs *Responder) served(req *ocsp.Request, resp *ocsp.Response, now time.Time) {
+	if rs.stats == nil {
+		return
+	}
+	rs.responseStatus(req, ocsp.Success)
+	if stats, ok := rs.stats.(AgeStats); ok {
+		stats.ResponseAge(now.Sub(resp.ThisUpdate))
 	}
 }
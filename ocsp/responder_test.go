@@ -1,6 +1,9 @@
 package ocsp
 
 import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/hex"
 	"io/ioutil"
 	"net/http"
@@ -40,19 +43,23 @@ type testCase struct {
 func TestOCSP(t *testing.T) {
 	cases := []testCase{
 		{"OPTIONS", "/", http.StatusMethodNotAllowed},
-		{"GET", "/", http.StatusBadRequest},
+		{"GET", "/", http.StatusNotFound},
 		// Bad URL encoding
-		{"GET", "%ZZFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusBadRequest},
+		{"GET", "%ZZFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusNotFound},
 		// Bad URL encoding
-		{"GET", "%%FQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusBadRequest},
+		{"GET", "%%FQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusNotFound},
 		// Bad base64 encoding
-		{"GET", "==MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusBadRequest},
+		{"GET", "==MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusNotFound},
 		// Bad OCSP DER encoding
-		{"GET", "AAAMFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusBadRequest},
+		{"GET", "AAAAMFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusBadRequest},
 		// Good encoding all around, including a double slash
 		{"GET", "MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusOK},
 		// Good request, leading slash
 		{"GET", "/MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx%2Fo6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd%2FNBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI%2F%2Fxsd4%3D", http.StatusOK},
+		// Good request, unescaped slashes and no padding
+		{"GET", "MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx/o6OXOHa%2BYfe32YhgQU%2B3hPEvlgFYMsnxd/NBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI//xsd4", http.StatusOK},
+		// Good request, URL-safe base64 encoding
+		{"GET", "MFQwUjBQME4wTDAJBgUrDgMCGgUABBQ55F6w46hhx_o6OXOHa-Yfe32YhgQU-3hPEvlgFYMsnxd_NBmzLjbqQYkCEwD6Wh0MaVKu9gJ3By9DI__xsd4", http.StatusOK},
 	}
 
 	responder := Responder{
@@ -174,6 +181,61 @@ func TestCacheHeaders(t *testing.T) {
 	}
 }
 
+func TestIfModifiedSince(t *testing.T) {
+	source, err := NewSourceFromFile(responseFile)
+	if err != nil {
+		t.Fatalf("Error constructing source: %s", err)
+	}
+
+	fc := clock.NewFake()
+	responder := Responder{
+		Source: source,
+		clk:    fc,
+	}
+
+	// The response was produced on 20 Oct 2015 and is valid until 20 Oct
+	// 2030.
+	testCases := []struct {
+		now             time.Time
+		ifModifiedSince string
+		expected        int
+	}{
+		{time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC), "Tue, 20 Oct 2015 00:00:00 GMT", http.StatusNotModified},
+		{time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC), "Tue, 20 Oct 2015 00:00:00 UTC", http.StatusNotModified},
+		{time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC), "Wed, 11 Nov 2015 00:00:00 GMT", http.StatusNotModified},
+		{time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC), "Mon, 19 Oct 2015 23:59:59 GMT", http.StatusOK},
+		{time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC), "Tue, 20 Oct 2015 00:00:00 GMT", http.StatusOK},
+		{time.Date(2015, 11, 12, 0, 0, 0, 0, time.UTC), "yesterday", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		fc.Set(tc.now)
+		rw := httptest.NewRecorder()
+		headers := http.Header{}
+		headers.Add("If-Modified-Since", tc.ifModifiedSince)
+		responder.ServeHTTP(rw, &http.Request{
+			Method: "GET",
+			URL: &url.URL{
+				Path: "MEMwQTA/MD0wOzAJBgUrDgMCGgUABBSwLsMRhyg1dJUwnXWk++D57lvgagQU6aQ/7p6l5vLV13lgPJOmLiSOl6oCAhJN",
+			},
+			Header: headers,
+		})
+		if rw.Code != tc.expected {
+			t.Errorf("If-Modified-Since %q at %s: expected status %d, got %d",
+				tc.ifModifiedSince, tc.now, tc.expected, rw.Code)
+		}
+		if rw.Code == http.StatusNotModified && rw.Body.Len() != 0 {
+			t.Errorf("If-Modified-Since %q: unexpected body in a 304 response", tc.ifModifiedSince)
+		}
+		if rw.Code == http.StatusOK && rw.Body.Len() == 0 {
+			t.Errorf("If-Modified-Since %q: missing OCSP response", tc.ifModifiedSince)
+		}
+		if rw.Header().Get("Last-Modified") != "Tue, 20 Oct 2015 00:00:00 UTC" {
+			t.Errorf("If-Modified-Since %q: unexpected Last-Modified %q",
+				tc.ifModifiedSince, rw.Header().Get("Last-Modified"))
+		}
+	}
+}
+
 func TestNewSourceFromFile(t *testing.T) {
 	_, err := NewSourceFromFile("")
 	if err == nil {
@@ -361,3 +423,108 @@ func TestNewSqliteSource(t *testing.T) {
 		t.Errorf("Error connecting to Sqlite DB: %v", err)
 	}
 }
+
+// addNonce re-encodes the OCSP request in der with a nonce extension.
+func addNonce(t *testing.T, der, nonce []byte) []byte {
+	var req nonceOCSPRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TBSRequest.RequestExtensions = append(req.TBSRequest.RequestExtensions, pkix.Extension{
+		Id:    NonceOID,
+		Value: value,
+	})
+	out, err := asn1.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestNonce(t *testing.T) {
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presigned, err := s.Sign(SignRequest{Certificate: cert, Status: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqDER, err := goocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responder := NewResponderWithResigner(InMemorySource{cert.SerialNumber.String(): presigned}, s.(Resigner), nil)
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		responder.ServeHTTP(rw, httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+		return rw
+	}
+
+	nonce := []byte("0123456789abcdef")
+	rw := post(addNonce(t, reqDER, nonce))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Unexpected response code: got %d, wanted %d", rw.Code, http.StatusOK)
+	}
+	resp, err := goocsp.ParseResponse(rw.Body.Bytes(), issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var echoed []byte
+	for _, ext := range resp.Extensions {
+		if ext.Id.Equal(NonceOID) {
+			if _, err := asn1.Unmarshal(ext.Value, &echoed); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !bytes.Equal(echoed, nonce) {
+		t.Fatalf("Nonce was not echoed: got %x, wanted %x", echoed, nonce)
+	}
+	if rw.Header().Get("Cache-Control") != "max-age=0, no-cache" {
+		t.Fatalf("Nonce response should not be cacheable, got Cache-Control %q", rw.Header().Get("Cache-Control"))
+	}
+
+	// Requests without a nonce get the pre-signed response.
+	rw = post(reqDER)
+	if rw.Code != http.StatusOK || !bytes.Equal(rw.Body.Bytes(), presigned) {
+		t.Fatal("Request without nonce should get the pre-signed response")
+	}
+
+	// Overlong nonces are rejected.
+	rw = post(addNonce(t, reqDER, make([]byte, DefaultMaxNonceLength+1)))
+	if rw.Code != http.StatusBadRequest || !bytes.Equal(rw.Body.Bytes(), malformedRequestErrorResponse) {
+		t.Fatalf("Overlong nonce should be rejected as malformed, got status %d", rw.Code)
+	}
+
+	// With nonce echoing disabled the pre-signed response is returned.
+	responder.DisableNonce = true
+	rw = post(addNonce(t, reqDER, nonce))
+	if rw.Code != http.StatusOK || !bytes.Equal(rw.Body.Bytes(), presigned) {
+		t.Fatal("Disabled nonce echoing should return the pre-signed response")
+	}
+}
@@ -0,0 +1,284 @@
+package ocsp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer/kms"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspNoCheckOID is the id-pkix-ocsp-nocheck extension (RFC 6960 section
+// 4.2.2.2.1), which tells clients not to check the revocation status of
+// a delegated responder certificate.
+var ocspNoCheckOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// rotateRetry is how long a RotatingSigner waits before trying again
+// to issue a responder certificate after a failure.
+var rotateRetry = time.Minute
+
+// A RotatingSigner is a Signer and Resigner that signs responses with a
+// delegated responder certificate it issues itself from the CA key, with
+// the OCSP signing extended key usage and a fresh key, instead of using
+// the CA key for every response. It issues the next certificate before
+// the current one expires, so that the responses it signs never outlive
+// their responder certificate. The responder keys never leave memory.
+//
+// The responder certificates are recorded in the certificate database
+// given with SetDBAccessor, so that they can be audited and revoked. The
+// certificates are only rotated by Rotate, or by AutoRotate, which the
+// caller runs for as long as it uses the signer.
+type RotatingSigner struct {
+	issuer   *x509.Certificate
+	caKey    crypto.Signer
+	interval time.Duration
+	lifetime time.Duration
+
+	lock       sync.RWMutex
+	current    *StandardSigner
+	dbAccessor certdb.Accessor
+}
+
+// ResponderProfile is the profile under which the responder certificates
+// issued by a RotatingSigner are recorded in the certificate database.
+const ResponderProfile = "ocsp-responder"
+
+// NewRotatingSigner returns a RotatingSigner for issuer, whose responder
+// certificates are signed by caKey and valid for lifetime, and issues its
+// first responder certificate. The lifetime must be at least twice the
+// interval between the thisUpdate and nextUpdate of the responses.
+func NewRotatingSigner(issuer *x509.Certificate, caKey crypto.Signer, interval, lifetime time.Duration) (*RotatingSigner, error) {
+	if lifetime < 2*interval {
+		return nil, cferr.Wrap(cferr.OCSPError, cferr.Unknown,
+			fmt.Errorf("the responder certificate lifetime %s must be at least twice the interval %s", lifetime, interval))
+	}
+	s := &RotatingSigner{
+		issuer:   issuer,
+		caKey:    caKey,
+		interval: interval,
+		lifetime: lifetime,
+	}
+	if err := s.Rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewRotatingSignerFromFile reads the issuer cert and the CA key from PEM
+// files, which may also be given as 'env:varname', and returns a
+// RotatingSigner for them. The CA key may instead be held in a key
+// management service.
+func NewRotatingSignerFromFile(issuerFile, caKeyFile string, interval, lifetime time.Duration) (*RotatingSigner, error) {
+	log.Debug("Loading issuer cert: ", issuerFile)
+	issuerBytes, err := helpers.ReadBytes(issuerFile)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	if kms.IsURI(caKeyFile) {
+		log.Debug("Using CA key: ", caKeyFile)
+		if key, err = kms.NewSigner(caKeyFile); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Debug("Loading CA key: ", caKeyFile)
+		keyBytes, err := helpers.ReadBytes(caKeyFile)
+		if err != nil {
+			return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed, err)
+		}
+		if key, err = helpers.ParsePrivateKeyPEM(keyBytes); err != nil {
+			return nil, err
+		}
+	}
+	return NewRotatingSigner(issuer, key, interval, lifetime)
+}
+
+func (s *RotatingSigner) signer() *StandardSigner {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.current
+}
+
+// Responder returns the current responder certificate.
+func (s *RotatingSigner) Responder() *x509.Certificate {
+	return s.signer().responder
+}
+
+// SetDBAccessor records the current responder certificate in the
+// certificate database, and makes the signer record the ones it issues
+// from then on. A responder certificate that can't be recorded isn't
+// used.
+func (s *RotatingSigner) SetDBAccessor(dbAccessor certdb.Accessor) error {
+	if err := recordResponder(dbAccessor, s.Responder()); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.dbAccessor = dbAccessor
+	s.lock.Unlock()
+	return nil
+}
+
+// recordResponder saves a responder certificate in the certificate
+// database.
+func recordResponder(dbAccessor certdb.Accessor, responder *x509.Certificate) error {
+	return dbAccessor.InsertCertificate(certdb.CertificateRecord{
+		Serial:     responder.SerialNumber.String(),
+		AKI:        hex.EncodeToString(responder.AuthorityKeyId),
+		Status:     "good",
+		Expiry:     responder.NotAfter,
+		PEM:        string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: responder.Raw})),
+		CommonName: responder.Subject.CommonName,
+		Profile:    ResponderProfile,
+	})
+}
+
+// RenewAt returns when the current responder certificate is replaced:
+// once it has less than a third of its lifetime left, and no later than
+// the interval before it expires.
+func (s *RotatingSigner) RenewAt() time.Time {
+	responder := s.Responder()
+	before := responder.NotAfter.Sub(responder.NotBefore) / 3
+	if before < s.interval {
+		before = s.interval
+	}
+	return responder.NotAfter.Add(-before)
+}
+
+// Rotate issues a new responder certificate, with a new key, and swaps it
+// in. Requests that started before are signed with the previous one.
+func (s *RotatingSigner) Rotate() error {
+	now := time.Now()
+	notAfter := now.Add(s.lifetime)
+	if notAfter.After(s.issuer.NotAfter) {
+		notAfter = s.issuer.NotAfter
+	}
+	if notAfter.Sub(now) < 2*s.interval {
+		return cferr.Wrap(cferr.OCSPError, cferr.Unknown,
+			errors.New("the issuer certificate expires too soon to issue a responder certificate"))
+	}
+
+	key, err := newResponderKey(s.caKey.Public())
+	if err != nil {
+		return cferr.Wrap(cferr.PrivateKeyError, cferr.GenerationFailed, err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: s.issuer.Subject.CommonName + " OCSP Responder"},
+		// Allow for some clock skew between the responder and the
+		// clients checking its responses.
+		NotBefore:       now.Add(-5 * time.Minute),
+		NotAfter:        notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		ExtraExtensions: []pkix.Extension{{Id: ocspNoCheckOID, Value: []byte{0x05, 0x00}}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.issuer, key.Public(), s.caKey)
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	responder, err := x509.ParseCertificate(der)
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+
+	next := &StandardSigner{issuer: s.issuer, responder: responder, key: key, interval: s.interval}
+	if err = checkResponder(s.issuer, next); err != nil {
+		return err
+	}
+	s.lock.RLock()
+	dbAccessor := s.dbAccessor
+	s.lock.RUnlock()
+	if dbAccessor != nil {
+		if err = recordResponder(dbAccessor, responder); err != nil {
+			return err
+		}
+	}
+	s.lock.Lock()
+	s.current = next
+	s.lock.Unlock()
+	log.Infof("issued OCSP responder certificate %x, valid until %s", responder.SerialNumber, responder.NotAfter)
+	return nil
+}
+
+// newResponderKey generates a responder key of the same algorithm as the
+// CA key.
+func newResponderKey(caPub crypto.PublicKey) (crypto.Signer, error) {
+	switch pub := caPub.(type) {
+	case *rsa.PublicKey:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case *ecdsa.PublicKey:
+		return ecdsa.GenerateKey(pub.Curve, rand.Reader)
+	case ed25519.PublicKey:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// AutoRotate replaces the responder certificate every time RenewAt is
+// reached, until stop is closed. Failures are logged and retried every
+// minute until the certificate is replaced.
+func (s *RotatingSigner) AutoRotate(stop <-chan struct{}) {
+	for {
+		wait := time.Until(s.RenewAt())
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		for {
+			err := s.Rotate()
+			if err == nil {
+				break
+			}
+			log.Errorf("Unable to rotate the OCSP responder certificate %x, expiring %s, will try again in %s: %v",
+				s.Responder().SerialNumber, s.Responder().NotAfter, rotateRetry, err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(rotateRetry):
+			}
+		}
+	}
+}
+
+// Sign signs req with the current responder certificate and key.
+func (s *RotatingSigner) Sign(req SignRequest) ([]byte, error) {
+	return s.signer().Sign(req)
+}
+
+// Resign re-signs resp with the current responder certificate and key.
+func (s *RotatingSigner) Resign(resp *ocsp.Response, extensions []pkix.Extension) ([]byte, error) {
+	return s.signer().Resign(resp, extensions)
+}
@@ -0,0 +1,149 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRotatingSigner(t *testing.T) {
+	ca := newTestCA(t, 1)
+	leaf, _ := newTestCert(t, 2, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, ca)
+
+	if _, err := NewRotatingSigner(ca.cert, ca.key, 10*time.Minute, 15*time.Minute); err == nil {
+		t.Error("expected a lifetime shorter than twice the interval to be rejected")
+	}
+	// The test CA expires within the hour.
+	if _, err := NewRotatingSigner(ca.cert, ca.key, 40*time.Minute, 2*time.Hour); err == nil {
+		t.Error("expected an issuer expiring within twice the interval to be rejected")
+	}
+
+	s, err := NewRotatingSigner(ca.cert, ca.key, 10*time.Minute, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder := s.Responder()
+	if err = responder.CheckSignatureFrom(ca.cert); err != nil {
+		t.Fatalf("expected the responder certificate to be issued by the CA: %v", err)
+	}
+	if len(responder.ExtKeyUsage) != 1 || responder.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Errorf("unexpected extended key usages %v", responder.ExtKeyUsage)
+	}
+	noCheck := false
+	for _, ext := range responder.Extensions {
+		noCheck = noCheck || ext.Id.Equal(ocspNoCheckOID)
+	}
+	if !noCheck {
+		t.Error("expected the responder certificate to carry id-pkix-ocsp-nocheck")
+	}
+	lifetime := responder.NotAfter.Sub(responder.NotBefore)
+	if renewAt := s.RenewAt(); !renewAt.Equal(responder.NotAfter.Add(-lifetime / 3)) {
+		t.Errorf("unexpected renewal time %s for a certificate expiring %s", renewAt, responder.NotAfter)
+	}
+
+	expectResponder := func(responder *x509.Certificate) {
+		t.Helper()
+		der, err := s.Sign(SignRequest{Certificate: leaf, Status: "good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := ocsp.ParseResponseForCert(der, leaf, ca.cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Certificate == nil || !bytes.Equal(resp.Certificate.Raw, responder.Raw) {
+			t.Fatalf("response not signed by responder %x", responder.SerialNumber)
+		}
+	}
+	expectResponder(responder)
+
+	if err = s.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rotated := s.Responder()
+	if rotated.SerialNumber.Cmp(responder.SerialNumber) == 0 || bytes.Equal(rotated.RawSubjectPublicKeyInfo, responder.RawSubjectPublicKeyInfo) {
+		t.Fatal("expected a new responder certificate and key")
+	}
+	expectResponder(rotated)
+
+	// A responder certificate already due for renewal is replaced as
+	// soon as AutoRotate runs.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "OCSP test responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(5 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.lock.Lock()
+	s.current = &StandardSigner{issuer: ca.cert, responder: expiring, key: key, interval: s.interval}
+	s.lock.Unlock()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.AutoRotate(stop)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Responder() == expiring {
+		if time.Now().After(deadline) {
+			t.Fatal("expected AutoRotate to replace the expiring responder certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+	expectResponder(s.Responder())
+}
+
+func TestRotatingSignerRecords(t *testing.T) {
+	db := testdb.SQLiteDB("../certdb/testdb/certstore_development.db")
+	dbAccessor := sql.NewAccessor(db)
+
+	ca := newTestCA(t, 1)
+	s, err := NewRotatingSigner(ca.cert, ca.key, 10*time.Minute, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SetDBAccessor(dbAccessor); err != nil {
+		t.Fatal(err)
+	}
+	first := s.Responder()
+	if err = s.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	aki := hex.EncodeToString(ca.cert.SubjectKeyId)
+	for _, responder := range []*x509.Certificate{first, s.Responder()} {
+		records, err := dbAccessor.GetCertificate(responder.SerialNumber.String(), aki)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].Profile != ResponderProfile || records[0].Status != "good" {
+			t.Fatalf("expected responder certificate %x to be recorded, got %+v", responder.SerialNumber, records)
+		}
+	}
+}
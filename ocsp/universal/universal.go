@@ -1,12 +1,39 @@
 package universal
 
 import (
+	"github.com/cloudflare/cfssl/api/client"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/ocsp"
 	ocspConfig "github.com/cloudflare/cfssl/ocsp/config"
 )
 
 // NewSignerFromConfig generates a new OCSP signer from a config object.
+// The signer uses the remote CFSSL server of the config if there is one,
+// and the responder key file or key management service key otherwise. With
+// a ResponderLifetime and no responder certificate, the responses are
+// signed by responder certificates issued from the CA key: the signer is
+// then an *ocsp.RotatingSigner, whose AutoRotate the caller runs to
+// rotate them before they expire.
 func NewSignerFromConfig(cfg ocspConfig.Config) (ocsp.Signer, error) {
+	if cfg.Remote != "" {
+		return newRemoteSigner(cfg)
+	}
+	if cfg.ResponderCertFile == "" && cfg.ResponderLifetime != 0 {
+		return ocsp.NewRotatingSignerFromFile(cfg.CACertFile, cfg.KeyFile, cfg.Interval, cfg.ResponderLifetime)
+	}
 	return ocsp.NewSignerFromFile(cfg.CACertFile, cfg.ResponderCertFile,
 		cfg.KeyFile, cfg.Interval)
 }
+
+func newRemoteSigner(cfg ocspConfig.Config) (ocsp.Signer, error) {
+	cert, err := helpers.LoadClientCertificate(cfg.RemoteCertFile, cfg.RemoteKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	remoteCAs, err := helpers.LoadPEMCertPool(cfg.RemoteCAFile)
+	if err != nil {
+		return nil, err
+	}
+	remote := client.NewServerTLS(cfg.Remote, helpers.CreateTLSConfig(remoteCAs, cert))
+	return ocsp.NewRemoteSigner(remote), nil
+}
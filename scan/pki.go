@@ -3,12 +3,17 @@ package scan
 import (
 	"bytes"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
 	"fmt"
 	"time"
 
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/revoke"
 	"github.com/cloudflare/cfssl/scan/crypto/tls"
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	"golang.org/x/crypto/ocsp"
 )
 
 // PKI contains scanners for the Public Key Infrastructure.
@@ -27,11 +32,20 @@ var PKI = &Family{
 			"Host serves same certificate chain across all IPs",
 			multipleCerts,
 		},
+		"CTInclusion": {
+			"Host's certificate comes with SCTs from enough distinct CT logs",
+			ctInclusion,
+		},
 	},
 }
 
-// getChain is a helper function that retreives the host's certificate chain.
-func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err error) {
+// MinSCTs is the number of SCTs from distinct logs that the CTInclusion
+// scanner requires for a host to pass.
+var MinSCTs = 2
+
+// getConnectionState is a helper function that retrieves the state of a
+// completed handshake with the host.
+func getConnectionState(addr string, config *tls.Config) (state tls.ConnectionState, err error) {
 	var conn *tls.Conn
 	conn, err = tls.DialWithDialer(Dialer, Network, addr, config)
 	if err != nil {
@@ -43,13 +57,23 @@ func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err e
 		return
 	}
 
-	chain = conn.ConnectionState().PeerCertificates
-	if len(chain) == 0 {
+	state = conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
 		err = fmt.Errorf("%s returned empty certificate chain", addr)
 	}
 	return
 }
 
+// getChain is a helper function that retreives the host's certificate chain.
+func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err error) {
+	state, err := getConnectionState(addr, config)
+	if err != nil {
+		return
+	}
+	chain = state.PeerCertificates
+	return
+}
+
 type expiration time.Time
 
 func (e expiration) String() string {
@@ -159,3 +183,100 @@ func multipleCerts(addr, hostname string) (grade Grade, output Output, err error
 	})
 	return
 }
+
+// sctListOID is the OID of the embedded SCT list certificate extension
+// defined in RFC 6962 section 3.3.
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// ctResult describes the SCTs that accompanied a host's certificate.
+type ctResult struct {
+	// Count is the total number of SCTs found.
+	Count    int `json:"count"`
+	Embedded int `json:"embedded"`
+	TLS      int `json:"tls_extension"`
+	OCSP     int `json:"ocsp"`
+	// LogIDs lists the base64-encoded IDs of the distinct logs that
+	// issued the SCTs.
+	LogIDs  []string `json:"log_ids"`
+	Minimum int      `json:"minimum"`
+	Pass    bool     `json:"pass"`
+}
+
+// collectSCTs gathers the SCTs embedded in the leaf certificate, sent in
+// the signed_certificate_timestamp TLS extension and stapled in an OCSP
+// response.
+func collectSCTs(state tls.ConnectionState) (result ctResult, err error) {
+	leaf := state.PeerCertificates[0]
+	seen := make(map[string]bool)
+	add := func(scts []ct.SignedCertificateTimestamp) {
+		for _, sct := range scts {
+			id := base64.StdEncoding.EncodeToString(sct.LogID.KeyID[:])
+			if !seen[id] {
+				seen[id] = true
+				result.LogIDs = append(result.LogIDs, id)
+			}
+		}
+		result.Count += len(scts)
+	}
+
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(sctListOID) {
+			continue
+		}
+		var serialized []byte
+		if _, err = asn1.Unmarshal(ext.Value, &serialized); err != nil {
+			return
+		}
+		var scts []ct.SignedCertificateTimestamp
+		if scts, err = helpers.DeserializeSCTList(serialized); err != nil {
+			return
+		}
+		result.Embedded = len(scts)
+		add(scts)
+	}
+
+	var scts []ct.SignedCertificateTimestamp
+	for _, raw := range state.SignedCertificateTimestamps {
+		var sct ct.SignedCertificateTimestamp
+		if _, err = cttls.Unmarshal(raw, &sct); err != nil {
+			return
+		}
+		scts = append(scts, sct)
+	}
+	result.TLS = len(scts)
+	add(scts)
+
+	if len(state.OCSPResponse) > 0 && len(state.PeerCertificates) > 1 {
+		var resp *ocsp.Response
+		if resp, err = ocsp.ParseResponse(state.OCSPResponse, state.PeerCertificates[1]); err != nil {
+			return
+		}
+		if scts, err = helpers.SCTListFromOCSPResponse(resp); err != nil {
+			return
+		}
+		result.OCSP = len(scts)
+		add(scts)
+	}
+
+	result.Minimum = MinSCTs
+	result.Pass = len(result.LogIDs) >= MinSCTs
+	return
+}
+
+func ctInclusion(addr, hostname string) (grade Grade, output Output, err error) {
+	state, err := getConnectionState(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	result, err := collectSCTs(state)
+	if err != nil {
+		return
+	}
+	output = result
+
+	if result.Pass {
+		grade = Good
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+)
+
+func testSCT(logID byte) ct.SignedCertificateTimestamp {
+	sct := ct.SignedCertificateTimestamp{SCTVersion: ct.V1}
+	sct.LogID.KeyID[0] = logID
+	return sct
+}
+
+func TestCollectSCTs(t *testing.T) {
+	serialized, err := helpers.SerializeSCTList([]ct.SignedCertificateTimestamp{testSCT(1), testSCT(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "ct.example.com"},
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: sctListOID, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An SCT from a log that is already represented doesn't count towards
+	// the number of distinct logs.
+	tlsSCT, err := cttls.Marshal(testSCT(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tls.ConnectionState{
+		PeerCertificates:            []*x509.Certificate{leaf},
+		SignedCertificateTimestamps: [][]byte{tlsSCT},
+	}
+
+	MinSCTs = 2
+	result, err := collectSCTs(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 3 || result.Embedded != 2 || result.TLS != 1 {
+		t.Errorf("unexpected SCT counts %+v", result)
+	}
+	if len(result.LogIDs) != 2 || !result.Pass {
+		t.Errorf("expected two distinct logs and a pass, got %+v", result)
+	}
+
+	MinSCTs = 3
+	defer func() { MinSCTs = 2 }()
+	result, err = collectSCTs(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pass || result.Minimum != 3 {
+		t.Errorf("expected a failure against a minimum of 3, got %+v", result)
+	}
+}
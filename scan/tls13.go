@@ -0,0 +1,801 @@
+package scan
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan/crypto/tls"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// The scanner's fork of crypto/tls predates TLS 1.3 (RFC 8446), so the
+// TLS 1.3 scanners build their ClientHellos and read the server's
+// responses themselves.
+
+const versionTLS13 = 0x0304
+
+// TLS extension types.
+const (
+	extensionServerName          uint16 = 0
+	extensionSupportedGroups     uint16 = 10
+	extensionECPointFormats      uint16 = 11
+	extensionSignatureAlgorithms uint16 = 13
+	extensionEarlyData           uint16 = 42
+	extensionSupportedVersions   uint16 = 43
+	extensionPSKModes            uint16 = 45
+	extensionKeyShare            uint16 = 51
+)
+
+// TLS record types.
+const (
+	recordTypeChangeCipherSpec uint8 = 20
+	recordTypeAlert            uint8 = 21
+	recordTypeHandshake        uint8 = 22
+	recordTypeApplicationData  uint8 = 23
+)
+
+// TLS handshake message types.
+const (
+	typeClientHello        uint8 = 1
+	typeServerHello        uint8 = 2
+	typeNewSessionTicket   uint8 = 4
+	typeCertificateRequest uint8 = 13
+	typeFinished           uint8 = 20
+)
+
+// tls13CipherSuites contains the TLS 1.3 cipher suites.
+var tls13CipherSuites = map[uint16]string{
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+	0x1304: "TLS_AES_128_CCM_SHA256",
+	0x1305: "TLS_AES_128_CCM_8_SHA256",
+}
+
+// tls13Groups contains the key exchange groups usable with TLS 1.3.
+var tls13Groups = map[tls.CurveID]string{
+	23:  "secp256r1",
+	24:  "secp384r1",
+	25:  "secp521r1",
+	29:  "x25519",
+	30:  "x448",
+	256: "ffdhe2048",
+	257: "ffdhe3072",
+	258: "ffdhe4096",
+	259: "ffdhe6144",
+	260: "ffdhe8192",
+}
+
+const (
+	tlsAES128GCMSHA256 uint16      = 0x1301
+	curveP256          tls.CurveID = 23
+	curveX25519        tls.CurveID = 29
+)
+
+// tls13SignatureSchemes lists the signature schemes offered in the
+// ClientHellos, so that servers with any kind of certificate answer.
+var tls13SignatureSchemes = []uint16{
+	0x0403, 0x0503, 0x0603, // ecdsa_secp{256r1,384r1,521r1}_sha{256,384,512}
+	0x0804, 0x0805, 0x0806, // rsa_pss_rsae_sha{256,384,512}
+	0x0809, 0x080a, 0x080b, // rsa_pss_pss_sha{256,384,512}
+	0x0807, 0x0808, // ed25519, ed448
+	0x0401, 0x0501, 0x0601, // rsa_pkcs1_sha{256,384,512}
+	0x0201, 0x0203, // rsa_pkcs1_sha1, ecdsa_sha1
+}
+
+// helloRetryRequestRandom is the random of a ServerHello that is a
+// HelloRetryRequest (RFC 8446 4.1.3).
+var helloRetryRequestRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11,
+	0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E,
+	0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// downgradeTLS12 ends the random of a TLS 1.3 server negotiating TLS 1.2
+// (RFC 8446 4.1.3).
+var downgradeTLS12 = []byte("DOWNGRD\x01")
+
+// handshakeTimeout bounds each connection made by the TLS 1.3 scanners.
+const handshakeTimeout = 5 * time.Second
+
+type keyShare struct {
+	group tls.CurveID
+	data  []byte
+}
+
+// A clientHello describes the ClientHello sent by a TLS 1.3 scanner.
+// Without tls13, it is a TLS 1.2 ClientHello.
+type clientHello struct {
+	serverName   string
+	cipherSuites []uint16
+	groups       []tls.CurveID
+	keyShares    []keyShare
+	tls13        bool
+}
+
+func addExtension(b *cryptobyte.Builder, typ uint16, body cryptobyte.BuilderContinuation) {
+	b.AddUint16(typ)
+	b.AddUint16LengthPrefixed(body)
+}
+
+// marshal returns the ClientHello handshake message.
+func (ch *clientHello) marshal() ([]byte, error) {
+	random := make([]byte, 32)
+	sessionID := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(sessionID); err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddUint8(typeClientHello)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(tls.VersionTLS12)
+		b.AddBytes(random)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(sessionID)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, suite := range ch.cipherSuites {
+				b.AddUint16(suite)
+			}
+		})
+		// Only the null compression method
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			if ch.serverName != "" && net.ParseIP(ch.serverName) == nil {
+				addExtension(b, extensionServerName, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(0) // host_name
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddBytes([]byte(ch.serverName))
+						})
+					})
+				})
+			}
+			addExtension(b, extensionSupportedGroups, func(b *cryptobyte.Builder) {
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					for _, group := range ch.groups {
+						b.AddUint16(uint16(group))
+					}
+				})
+			})
+			addExtension(b, extensionSignatureAlgorithms, func(b *cryptobyte.Builder) {
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					for _, scheme := range tls13SignatureSchemes {
+						b.AddUint16(scheme)
+					}
+				})
+			})
+			if !ch.tls13 {
+				addExtension(b, extensionECPointFormats, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(0) // uncompressed
+					})
+				})
+				return
+			}
+			addExtension(b, extensionSupportedVersions, func(b *cryptobyte.Builder) {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint16(versionTLS13)
+				})
+			})
+			// Servers only issue session tickets to clients supporting
+			// (EC)DHE resumption.
+			addExtension(b, extensionPSKModes, func(b *cryptobyte.Builder) {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint8(1) // psk_dhe_ke
+				})
+			})
+			addExtension(b, extensionKeyShare, func(b *cryptobyte.Builder) {
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					for _, share := range ch.keyShares {
+						b.AddUint16(uint16(share.group))
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddBytes(share.data)
+						})
+					}
+				})
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+// A serverHello holds the fields of a ServerHello or HelloRetryRequest
+// the scanners look at.
+type serverHello struct {
+	// version is the negotiated version, from the supported_versions
+	// extension if present.
+	version     uint16
+	random      []byte
+	cipherSuite uint16
+	retry       bool
+	// group is the group of the server's key share, or the group the
+	// client must use in a HelloRetryRequest.
+	group    tls.CurveID
+	keyShare []byte
+}
+
+var errMalformedServerHello = errors.New("malformed ServerHello")
+
+func parseServerHello(msg []byte) (*serverHello, error) {
+	if len(msg) < 4 || msg[0] != typeServerHello {
+		return nil, fmt.Errorf("expected a ServerHello, got handshake message type %d", msg[0])
+	}
+
+	s := cryptobyte.String(msg[4:])
+	sh := new(serverHello)
+	var sessionID, extensions cryptobyte.String
+	var compression uint8
+	if !s.ReadUint16(&sh.version) || !s.ReadBytes(&sh.random, 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) || !s.ReadUint16(&sh.cipherSuite) ||
+		!s.ReadUint8(&compression) {
+		return nil, errMalformedServerHello
+	}
+	sh.retry = bytes.Equal(sh.random, helloRetryRequestRandom)
+	if !s.Empty() && !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errMalformedServerHello
+	}
+
+	for !extensions.Empty() {
+		var typ uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errMalformedServerHello
+		}
+		switch typ {
+		case extensionSupportedVersions:
+			if !data.ReadUint16(&sh.version) {
+				return nil, errMalformedServerHello
+			}
+		case extensionKeyShare:
+			var group uint16
+			if !data.ReadUint16(&group) {
+				return nil, errMalformedServerHello
+			}
+			sh.group = tls.CurveID(group)
+			if !sh.retry {
+				var key cryptobyte.String
+				if !data.ReadUint16LengthPrefixed(&key) {
+					return nil, errMalformedServerHello
+				}
+				sh.keyShare = key
+			}
+		}
+	}
+	return sh, nil
+}
+
+// A recordConn reads and writes TLS records, protected with
+// TLS_AES_128_GCM_SHA256 once traffic keys are set.
+type recordConn struct {
+	conn      net.Conn
+	in, out   cipher.AEAD
+	inIV      []byte
+	outIV     []byte
+	inSeq     uint64
+	outSeq    uint64
+	handshake []byte
+}
+
+// trafficKeys returns the AEAD and IV derived from a traffic secret.
+func trafficKeys(secret []byte) (cipher.AEAD, []byte, error) {
+	block, err := aes.NewCipher(hkdfExpandLabel(secret, "key", nil, 16))
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, hkdfExpandLabel(secret, "iv", nil, 12), nil
+}
+
+func (c *recordConn) setReadSecret(secret []byte) (err error) {
+	c.in, c.inIV, err = trafficKeys(secret)
+	c.inSeq = 0
+	return
+}
+
+func (c *recordConn) setWriteSecret(secret []byte) (err error) {
+	c.out, c.outIV, err = trafficKeys(secret)
+	c.outSeq = 0
+	return
+}
+
+func nonce(iv []byte, seq uint64) []byte {
+	n := make([]byte, len(iv))
+	copy(n, iv)
+	for i := 0; i < 8; i++ {
+		n[len(n)-1-i] ^= byte(seq >> (8 * uint(i)))
+	}
+	return n
+}
+
+func (c *recordConn) writeRecord(typ uint8, payload []byte) error {
+	// The record version is TLS 1.0 for the ClientHello, for
+	// compatibility, and TLS 1.2 for protected records.
+	header := []byte{typ, 3, 1, 0, 0}
+	if c.out != nil {
+		header = []byte{recordTypeApplicationData, 3, 3, 0, 0}
+		inner := append(append([]byte{}, payload...), typ)
+		binary.BigEndian.PutUint16(header[3:], uint16(len(inner)+c.out.Overhead()))
+		payload = c.out.Seal(nil, nonce(c.outIV, c.outSeq), inner, header)
+		c.outSeq++
+	}
+	binary.BigEndian.PutUint16(header[3:], uint16(len(payload)))
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+func (c *recordConn) readRecord() (uint8, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return 0, nil, err
+	}
+	n := int(binary.BigEndian.Uint16(header[3:]))
+	if n > 16384+256 {
+		return 0, nil, errors.New("oversized TLS record")
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return 0, nil, err
+	}
+
+	typ := header[0]
+	if c.in == nil || typ != recordTypeApplicationData {
+		return typ, payload, nil
+	}
+
+	plaintext, err := c.in.Open(nil, nonce(c.inIV, c.inSeq), payload, header)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.inSeq++
+	// Strip the padding and take the inner content type.
+	i := len(plaintext) - 1
+	for i >= 0 && plaintext[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return 0, nil, errors.New("TLS record without content type")
+	}
+	return plaintext[i], plaintext[:i], nil
+}
+
+// readHandshake returns the next handshake message, header included.
+func (c *recordConn) readHandshake() ([]byte, error) {
+	for {
+		if len(c.handshake) >= 4 {
+			n := 4 + (int(c.handshake[1])<<16 | int(c.handshake[2])<<8 | int(c.handshake[3]))
+			if len(c.handshake) >= n {
+				msg := c.handshake[:n:n]
+				c.handshake = c.handshake[n:]
+				return msg, nil
+			}
+		}
+
+		typ, payload, err := c.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case recordTypeHandshake:
+			c.handshake = append(c.handshake, payload...)
+		case recordTypeAlert:
+			if len(payload) == 2 {
+				return nil, fmt.Errorf("server sent alert %d", payload[1])
+			}
+			return nil, errors.New("server sent a malformed alert")
+		case recordTypeChangeCipherSpec:
+			// Sent for middlebox compatibility, ignored.
+		default:
+			return nil, fmt.Errorf("unexpected TLS record type %d", typ)
+		}
+	}
+}
+
+// sayHello13 sends ch to addr and returns the server's answer. If the
+// server refuses the handshake, it returns errHelloFailed.
+func sayHello13(addr string, ch *clientHello) (*serverHello, error) {
+	msg, err := ch.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	c := &recordConn{conn: conn}
+	if err = c.writeRecord(recordTypeHandshake, msg); err != nil {
+		return nil, err
+	}
+	if msg, err = c.readHandshake(); err != nil {
+		return nil, errHelloFailed
+	}
+	return parseServerHello(msg)
+}
+
+// tls13CipherSuiteIDs returns the TLS 1.3 cipher suites in ascending
+// order, so that the probes and their reports are the same every run.
+func tls13CipherSuiteIDs() []uint16 {
+	suites := make([]uint16, 0, len(tls13CipherSuites))
+	for suite := range tls13CipherSuites {
+		suites = append(suites, suite)
+	}
+	sort.Slice(suites, func(i, j int) bool { return suites[i] < suites[j] })
+	return suites
+}
+
+// tls13GroupIDs returns the TLS 1.3 groups in ascending order.
+func tls13GroupIDs() []tls.CurveID {
+	groups := make([]tls.CurveID, 0, len(tls13Groups))
+	for group := range tls13Groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return groups
+}
+
+// sayHelloTLS13 offers TLS 1.3 only, with the given cipher suites and
+// groups but no key share, so that the server answers with a
+// HelloRetryRequest naming its choice of both.
+func sayHelloTLS13(addr, hostname string, suites []uint16, groups []tls.CurveID) (*serverHello, error) {
+	sh, err := sayHello13(addr, &clientHello{
+		serverName:   hostname,
+		cipherSuites: suites,
+		groups:       groups,
+		tls13:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sh.version != versionTLS13 {
+		return nil, fmt.Errorf("server negotiated protocol version we didn't send: %#04x", sh.version)
+	}
+	return sh, nil
+}
+
+var errNoTLS13 = errors.New("server doesn't support TLS 1.3")
+
+// tls13CipherSuiteScan returns the TLS 1.3 cipher suites supported by the
+// host, in its order of preference.
+func tls13CipherSuiteScan(addr, hostname string) (grade Grade, output Output, err error) {
+	suites := tls13CipherSuiteIDs()
+	var supported []string
+	for len(suites) > 0 {
+		var sh *serverHello
+		sh, err = sayHelloTLS13(addr, hostname, suites, tls13GroupIDs())
+		if err != nil {
+			if err == errHelloFailed {
+				err = nil
+				break
+			}
+			return
+		}
+
+		i := indexOf(suites, sh.cipherSuite)
+		if i < 0 {
+			err = fmt.Errorf("server negotiated ciphersuite we didn't send: %#04x", sh.cipherSuite)
+			return
+		}
+		supported = append(supported, tls13CipherSuites[sh.cipherSuite])
+		suites = append(suites[:i], suites[i+1:]...)
+	}
+
+	if len(supported) == 0 {
+		return Warning, nil, errNoTLS13
+	}
+	return Good, supported, nil
+}
+
+// tls13KeyShareScan returns the key exchange groups the host accepts for
+// TLS 1.3 key shares, in its order of preference.
+func tls13KeyShareScan(addr, hostname string) (grade Grade, output Output, err error) {
+	groups := tls13GroupIDs()
+	var supported []string
+	for len(groups) > 0 {
+		var sh *serverHello
+		sh, err = sayHelloTLS13(addr, hostname, tls13CipherSuiteIDs(), groups)
+		if err != nil {
+			if err == errHelloFailed {
+				err = nil
+				break
+			}
+			return
+		}
+
+		i := -1
+		for j, group := range groups {
+			if group == sh.group {
+				i = j
+			}
+		}
+		if i < 0 {
+			err = fmt.Errorf("server selected a group we didn't send: %d", sh.group)
+			return
+		}
+		supported = append(supported, tls13Groups[sh.group])
+		groups = append(groups[:i], groups[i+1:]...)
+	}
+
+	if len(supported) == 0 {
+		return Warning, nil, errNoTLS13
+	}
+	return Good, supported, nil
+}
+
+// downgradeProtectionScan checks that a host supporting TLS 1.3 signals
+// it in the ServerHello random when a client only offers TLS 1.2, so
+// that clients supporting TLS 1.3 detect downgrade attacks.
+func downgradeProtectionScan(addr, hostname string) (grade Grade, output Output, err error) {
+	if _, err = sayHelloTLS13(addr, hostname, tls13CipherSuiteIDs(), tls13GroupIDs()); err != nil {
+		if err == errHelloFailed {
+			return Skipped, "server doesn't support TLS 1.3", nil
+		}
+		return
+	}
+
+	sh, err := sayHello13(addr, &clientHello{
+		serverName:   hostname,
+		cipherSuites: allCiphersIDs(),
+		groups:       append(allCurvesIDs(), curveX25519),
+	})
+	if err != nil {
+		if err == errHelloFailed {
+			return Good, "server doesn't support TLS 1.2", nil
+		}
+		return
+	}
+	if sh.version != tls.VersionTLS12 {
+		err = fmt.Errorf("server negotiated protocol version we didn't send: %#04x", sh.version)
+		return
+	}
+
+	if !bytes.HasSuffix(sh.random, downgradeTLS12) {
+		return Warning, false, nil
+	}
+	return Good, true, nil
+}
+
+// earlyData describes the 0-RTT support of a host.
+type earlyData struct {
+	Supported bool `json:"supported"`
+	// MaxEarlyDataSize is the largest amount of early data the host
+	// accepts when resuming a session.
+	MaxEarlyDataSize uint32 `json:"max_early_data_size,omitempty"`
+}
+
+// earlyDataScan completes a TLS 1.3 handshake with the host and reports
+// whether the session ticket it issues allows sending early (0-RTT)
+// data when resuming the session.
+func earlyDataScan(addr, hostname string) (grade Grade, output Output, err error) {
+	size, err := maxEarlyDataSize(addr, hostname)
+	if err != nil {
+		if err == errHelloFailed {
+			return Skipped, nil, errNoTLS13
+		}
+		return
+	}
+	return Good, earlyData{Supported: size > 0, MaxEarlyDataSize: size}, nil
+}
+
+func indexOf(list []uint16, v uint16) int {
+	for i, u := range list {
+		if u == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// hkdfExtract implements HKDF-Extract with SHA-256. Absent salts and
+// secrets are a string of zeros (RFC 8446 7.1).
+func hkdfExtract(salt, secret []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	if secret == nil {
+		secret = make([]byte, sha256.Size)
+	}
+	h := hmac.New(sha256.New, salt)
+	h.Write(secret)
+	return h.Sum(nil)
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label (RFC 8446 7.1) with SHA-256.
+func hkdfExpandLabel(secret []byte, label string, context []byte, length int) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(uint16(length))
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte("tls13 " + label))
+	})
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(context)
+	})
+	info := b.BytesOrPanic()
+
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		h := hmac.New(sha256.New, secret)
+		h.Write(t)
+		h.Write(info)
+		h.Write([]byte{i})
+		t = h.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+func deriveSecret(secret []byte, label string, transcript hash.Hash) []byte {
+	return hkdfExpandLabel(secret, label, transcript.Sum(nil), sha256.Size)
+}
+
+func finishedMAC(secret []byte, transcript hash.Hash) []byte {
+	h := hmac.New(sha256.New, hkdfExpandLabel(secret, "finished", nil, sha256.Size))
+	h.Write(transcript.Sum(nil))
+	return h.Sum(nil)
+}
+
+// maxEarlyDataSize performs a full TLS 1.3 handshake, with
+// TLS_AES_128_GCM_SHA256 and secp256r1 which all TLS 1.3 servers
+// implement, and returns the max_early_data_size of the first session
+// ticket the server issues, or 0 if it doesn't allow early data. The
+// server's certificate is not verified.
+func maxEarlyDataSize(addr, hostname string) (uint32, error) {
+	p256 := elliptic.P256()
+	priv, x, y, err := elliptic.GenerateKey(p256, rand.Reader)
+	if err != nil {
+		return 0, err
+	}
+	ch, err := (&clientHello{
+		serverName:   hostname,
+		cipherSuites: []uint16{tlsAES128GCMSHA256},
+		groups:       []tls.CurveID{curveP256},
+		keyShares:    []keyShare{{curveP256, elliptic.Marshal(p256, x, y)}},
+		tls13:        true,
+	}).marshal()
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := Dialer.Dial(Network, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	c := &recordConn{conn: conn}
+	if err = c.writeRecord(recordTypeHandshake, ch); err != nil {
+		return 0, err
+	}
+	transcript := sha256.New()
+	transcript.Write(ch)
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return 0, errHelloFailed
+	}
+	sh, err := parseServerHello(msg)
+	if err != nil {
+		return 0, err
+	}
+	if sh.version != versionTLS13 || sh.retry || sh.cipherSuite != tlsAES128GCMSHA256 || sh.group != curveP256 {
+		return 0, errors.New("server didn't accept a TLS 1.3 handshake with TLS_AES_128_GCM_SHA256 and secp256r1")
+	}
+	transcript.Write(msg)
+
+	sx, sy := elliptic.Unmarshal(p256, sh.keyShare)
+	if sx == nil {
+		return 0, errors.New("invalid server key share")
+	}
+	sharedX, _ := p256.ScalarMult(sx, sy, priv)
+	shared := make([]byte, 32)
+	sharedBytes := sharedX.Bytes()
+	copy(shared[len(shared)-len(sharedBytes):], sharedBytes)
+
+	// Key schedule, RFC 8446 7.1
+	emptyHash := sha256.New()
+	earlySecret := hkdfExtract(nil, nil)
+	handshakeSecret := hkdfExtract(deriveSecret(earlySecret, "derived", emptyHash), shared)
+	clientHandshake := deriveSecret(handshakeSecret, "c hs traffic", transcript)
+	serverHandshake := deriveSecret(handshakeSecret, "s hs traffic", transcript)
+	masterSecret := hkdfExtract(deriveSecret(handshakeSecret, "derived", emptyHash), nil)
+
+	if err = c.setReadSecret(serverHandshake); err != nil {
+		return 0, err
+	}
+	for {
+		if msg, err = c.readHandshake(); err != nil {
+			return 0, err
+		}
+		if msg[0] == typeCertificateRequest {
+			return 0, errors.New("server requires a client certificate")
+		}
+		if msg[0] == typeFinished {
+			if !hmac.Equal(msg[4:], finishedMAC(serverHandshake, transcript)) {
+				return 0, errors.New("invalid server Finished")
+			}
+			transcript.Write(msg)
+			break
+		}
+		transcript.Write(msg)
+	}
+
+	serverApplication := deriveSecret(masterSecret, "s ap traffic", transcript)
+	finished := append([]byte{typeFinished, 0, 0, sha256.Size}, finishedMAC(clientHandshake, transcript)...)
+	if err = c.setWriteSecret(clientHandshake); err != nil {
+		return 0, err
+	}
+	if err = c.writeRecord(recordTypeHandshake, finished); err != nil {
+		return 0, err
+	}
+
+	if err = c.setReadSecret(serverApplication); err != nil {
+		return 0, err
+	}
+	for {
+		if msg, err = c.readHandshake(); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return 0, errors.New("server didn't issue a session ticket")
+			}
+			return 0, err
+		}
+		if msg[0] == typeNewSessionTicket {
+			return parseMaxEarlyDataSize(msg)
+		}
+	}
+}
+
+// parseMaxEarlyDataSize returns the max_early_data_size of a
+// NewSessionTicket message, or 0 if the ticket has no early_data
+// extension.
+func parseMaxEarlyDataSize(msg []byte) (uint32, error) {
+	s := cryptobyte.String(msg[4:])
+	var lifetime, ageAdd uint32
+	var ticketNonce, ticket, extensions cryptobyte.String
+	if !s.ReadUint32(&lifetime) || !s.ReadUint32(&ageAdd) || !s.ReadUint8LengthPrefixed(&ticketNonce) ||
+		!s.ReadUint16LengthPrefixed(&ticket) || !s.ReadUint16LengthPrefixed(&extensions) {
+		return 0, errors.New("malformed NewSessionTicket")
+	}
+
+	for !extensions.Empty() {
+		var typ uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return 0, errors.New("malformed NewSessionTicket")
+		}
+		if typ == extensionEarlyData {
+			var size uint32
+			if !data.ReadUint32(&size) {
+				return 0, errors.New("malformed early_data extension")
+			}
+			return size, nil
+		}
+	}
+	return 0, nil
+}
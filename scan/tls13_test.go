@@ -0,0 +1,117 @@
+package scan
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newTLSServer(t *testing.T, maxVersion uint16) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: maxVersion}
+	server.StartTLS()
+	return server
+}
+
+func TestTLS13CipherSuiteScan(t *testing.T) {
+	server := newTLSServer(t, tls.VersionTLS13)
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	grade, output, err := tls13CipherSuiteScan(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suites := output.([]string)
+	if grade != Good || len(suites) != 3 {
+		t.Fatalf("expected the 3 cipher suites of crypto/tls, got %v %v", grade, suites)
+	}
+
+	grade, output, err = tls13KeyShareScan(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := output.([]string)
+	found := map[string]bool{}
+	for _, group := range groups {
+		found[group] = true
+	}
+	if grade != Good || !found["x25519"] || !found["secp256r1"] || found["ffdhe2048"] {
+		t.Fatalf("unexpected TLS 1.3 groups %v %v", grade, groups)
+	}
+
+	// The suites and groups are probed in a fixed order, so scans of the
+	// same host report the same.
+	for i := 0; i < 3; i++ {
+		if _, output, err = tls13KeyShareScan(addr, ""); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(output, groups) {
+			t.Fatalf("expected the same groups on every scan, got %v then %v", groups, output)
+		}
+	}
+}
+
+func TestTLS13Unsupported(t *testing.T) {
+	server := newTLSServer(t, tls.VersionTLS12)
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	if grade, _, err := tls13CipherSuiteScan(addr, ""); err != errNoTLS13 || grade != Warning {
+		t.Fatalf("expected no TLS 1.3 support, got %v %v", grade, err)
+	}
+	if grade, _, err := downgradeProtectionScan(addr, ""); err != nil || grade != Skipped {
+		t.Fatalf("expected the downgrade scan to be skipped, got %v %v", grade, err)
+	}
+}
+
+func TestDowngradeProtectionScan(t *testing.T) {
+	server := newTLSServer(t, tls.VersionTLS13)
+	defer server.Close()
+
+	grade, output, err := downgradeProtectionScan(server.Listener.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grade != Good || output != true {
+		t.Fatalf("expected crypto/tls to signal downgrades, got %v %v", grade, output)
+	}
+}
+
+func TestEarlyDataScan(t *testing.T) {
+	server := newTLSServer(t, tls.VersionTLS13)
+	defer server.Close()
+
+	// crypto/tls issues session tickets without early data.
+	grade, output, err := earlyDataScan(server.Listener.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grade != Good || output.(earlyData).Supported {
+		t.Fatalf("expected no early data support, got %v %v", grade, output)
+	}
+}
+
+func TestParseMaxEarlyDataSize(t *testing.T) {
+	ticket := []byte{
+		typeNewSessionTicket, 0, 0, 22,
+		0, 0, 0x1c, 0x20, // ticket_lifetime
+		1, 2, 3, 4, // ticket_age_add
+		1, 0, // ticket_nonce
+		0, 2, 0xaa, 0xbb, // ticket
+		0, 8, 0, 42, 0, 4, 0, 0, 0x40, 0, // early_data
+	}
+	size, err := parseMaxEarlyDataSize(ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0x4000 {
+		t.Fatalf("expected a max_early_data_size of 16384, got %d", size)
+	}
+
+	if _, err = parseMaxEarlyDataSize(ticket[:10]); err == nil {
+		t.Fatal("expected a truncated ticket to be rejected")
+	}
+}
@@ -38,6 +38,22 @@ var TLSHandshake = &Family{
 			"Determines the host's ec curve support for TLS 1.2",
 			ecCurveScan,
 		},
+		"TLS13CipherSuites": {
+			"Determines host's TLS 1.3 cipher suites accepted and preferred order",
+			tls13CipherSuiteScan,
+		},
+		"TLS13KeyShares": {
+			"Determines host's TLS 1.3 key exchange groups accepted and preferred order",
+			tls13KeyShareScan,
+		},
+		"DowngradeProtection": {
+			"Host supporting TLS 1.3 signals it when negotiating TLS 1.2, so that downgrades are detected",
+			downgradeProtectionScan,
+		},
+		"EarlyData": {
+			"Determines whether host accepts TLS 1.3 early (0-RTT) data on resumption",
+			earlyDataScan,
+		},
 	},
 }
 
@@ -0,0 +1,84 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/cloudflare/cfssl/config"
+)
+
+// AdmissionOID is the OID of the Common PKI admission extension
+// (id-isismtt-at-admission).
+var AdmissionOID = asn1.ObjectIdentifier{1, 3, 36, 8, 3, 3}
+
+// The types below follow the AdmissionSyntax ASN.1 module of Common PKI.
+// DirectoryStrings are encoded as UTF8String.
+
+type admissionSyntax struct {
+	ContentsOfAdmissions []admissions
+}
+
+type admissions struct {
+	NamingAuthority namingAuthority `asn1:"optional,explicit,tag:1"`
+	ProfessionInfos []professionInfo
+}
+
+type namingAuthority struct {
+	ID   asn1.ObjectIdentifier `asn1:"optional"`
+	URL  string                `asn1:"optional,ia5"`
+	Text string                `asn1:"optional,utf8"`
+}
+
+type professionInfo struct {
+	NamingAuthority    namingAuthority `asn1:"optional,explicit,tag:0"`
+	ProfessionItems    []asn1.RawValue
+	ProfessionOIDs     []asn1.ObjectIdentifier `asn1:"optional"`
+	RegistrationNumber string                  `asn1:"optional,printable"`
+}
+
+func toNamingAuthority(na config.NamingAuthority) namingAuthority {
+	return namingAuthority{
+		ID:   asn1.ObjectIdentifier(na.ID),
+		URL:  na.URL,
+		Text: na.Text,
+	}
+}
+
+// marshalAdmissions returns the DER encoding of the admission extension
+// value for the given admissions.
+func marshalAdmissions(entries []config.Admission) ([]byte, error) {
+	var syntax admissionSyntax
+	for _, a := range entries {
+		adm := admissions{NamingAuthority: toNamingAuthority(a.NamingAuthority)}
+		for _, info := range a.ProfessionInfos {
+			pi := professionInfo{
+				NamingAuthority:    toNamingAuthority(info.NamingAuthority),
+				RegistrationNumber: info.RegistrationNumber,
+			}
+			for _, item := range info.ProfessionItems {
+				pi.ProfessionItems = append(pi.ProfessionItems, asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(item)})
+			}
+			for _, oid := range info.ProfessionOIDs {
+				pi.ProfessionOIDs = append(pi.ProfessionOIDs, asn1.ObjectIdentifier(oid))
+			}
+			adm.ProfessionInfos = append(adm.ProfessionInfos, pi)
+		}
+		syntax.ContentsOfAdmissions = append(syntax.ContentsOfAdmissions, adm)
+	}
+	return asn1.Marshal(syntax)
+}
+
+// addAdmissions adds the admission extension describing entries to
+// template.
+func addAdmissions(template *x509.Certificate, entries []config.Admission) error {
+	value, err := marshalAdmissions(entries)
+	if err != nil {
+		return err
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+		Id:    AdmissionOID,
+		Value: value,
+	})
+	return nil
+}
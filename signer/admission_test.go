@@ -0,0 +1,37 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/cloudflare/cfssl/config"
+)
+
+// referenceAdmission is an admission extension value for a practice of a
+// physician, registered by gematik, checked against the Common PKI ASN.1
+// module with openssl asn1parse.
+const referenceAdmission = "305630543052a11a3018161668747470733a2f2f7777772e67656d6174696b2e646530343032" +
+	"30160c1442657472696562737374c3a47474652041727a74300906072a8214004c0432130d312d322d41525a542d31323334"
+
+func TestMarshalAdmissions(t *testing.T) {
+	expected, err := hex.DecodeString(referenceAdmission)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := marshalAdmissions([]config.Admission{{
+		NamingAuthority: config.NamingAuthority{URL: "https://www.gematik.de"},
+		ProfessionInfos: []config.ProfessionInfo{{
+			ProfessionItems:    []string{"Betriebsstätte Arzt"},
+			ProfessionOIDs:     []config.OID{{1, 2, 276, 0, 76, 4, 50}},
+			RegistrationNumber: "1-2-ARZT-1234",
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(value, expected) {
+		t.Fatalf("admission extension doesn't match the reference encoding:\n got %x\nwant %x", value, expected)
+	}
+}
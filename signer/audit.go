@@ -0,0 +1,117 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// An AuditHook is notified of the outcome of every sign request handled
+// by a signer. OnIssue is called after a certificate has been signed and
+// OnReject when the signing policy refuses a request; requests failing for
+// other reasons, such as a malformed CSR or an unavailable certificate
+// database, are not reported. Errors returned by a hook are logged by the
+// signer but never change the outcome of the request.
+type AuditHook interface {
+	OnIssue(req SignRequest, cert *x509.Certificate) error
+	OnReject(req SignRequest, reason error) error
+}
+
+// An Auditor is a Signer notifying an AuditHook of the outcome of its sign
+// requests.
+type Auditor interface {
+	SetAuditHook(hook AuditHook)
+}
+
+// NoopAuditHook is an AuditHook that does nothing.
+type NoopAuditHook struct{}
+
+// OnIssue does nothing.
+func (NoopAuditHook) OnIssue(SignRequest, *x509.Certificate) error { return nil }
+
+// OnReject does nothing.
+func (NoopAuditHook) OnReject(SignRequest, error) error { return nil }
+
+// AuditRecord is a single entry written by a FileAuditHook.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Profile   string    `json:"profile,omitempty"`
+	Label     string    `json:"label,omitempty"`
+	Hosts     []string  `json:"hosts,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	AKI       string    `json:"aki,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	NotBefore time.Time `json:"not_before,omitempty"`
+	NotAfter  time.Time `json:"not_after,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// FileAuditHook is an AuditHook that appends one JSON encoded AuditRecord
+// per line to a file.
+type FileAuditHook struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileAuditHook opens path for appending, creating it if needed, and
+// returns an AuditHook writing to it.
+func NewFileAuditHook(path string) (*FileAuditHook, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditHook{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// OnIssue records a certificate issuance.
+func (h *FileAuditHook) OnIssue(req SignRequest, cert *x509.Certificate) error {
+	rec := AuditRecord{
+		Time:      time.Now().UTC(),
+		Event:     "issue",
+		Profile:   req.Profile,
+		Label:     req.Label,
+		Hosts:     req.Hosts,
+		Serial:    cert.SerialNumber.String(),
+		AKI:       hex.EncodeToString(cert.AuthorityKeyId),
+		Subject:   cert.Subject.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	return h.write(rec)
+}
+
+// OnReject records a rejected sign request.
+func (h *FileAuditHook) OnReject(req SignRequest, reason error) error {
+	rec := AuditRecord{
+		Time:    time.Now().UTC(),
+		Event:   "reject",
+		Profile: req.Profile,
+		Label:   req.Label,
+		Hosts:   req.Hosts,
+	}
+	if reason != nil {
+		rec.Error = reason.Error()
+	}
+	return h.write(rec)
+}
+
+func (h *FileAuditHook) write(rec AuditRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.enc.Encode(rec); err != nil {
+		return err
+	}
+	return h.file.Sync()
+}
+
+// Close closes the underlying file.
+func (h *FileAuditHook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
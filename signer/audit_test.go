@@ -0,0 +1,74 @@
+package signer
+
+import (
+	"bufio"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileAuditHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	hook, err := NewFileAuditHook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := SignRequest{Profile: "server", Label: "primary", Hosts: []string{"example.com"}}
+	cert := &x509.Certificate{
+		SerialNumber:   big.NewInt(1234),
+		Subject:        pkix.Name{CommonName: "example.com"},
+		AuthorityKeyId: []byte{0xde, 0xad, 0xbe, 0xef},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+
+	if err := hook.OnIssue(req, cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.OnReject(req, errors.New("policy violation")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("audit log line is not valid JSON: %v", err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got %d", len(records))
+	}
+	if records[0].Event != "issue" || records[0].Serial != "1234" || records[0].AKI != "deadbeef" || records[0].Profile != "server" {
+		t.Fatalf("unexpected issue record: %+v", records[0])
+	}
+	if records[1].Event != "reject" || records[1].Error != "policy violation" {
+		t.Fatalf("unexpected reject record: %+v", records[1])
+	}
+}
@@ -0,0 +1,174 @@
+// Package kms implements a crypto.Signer backed by a key held in a cloud
+// key management service, such as AWS KMS or Google Cloud KMS. Keys are
+// named by URIs like awskms:///alias/my-ca-key or
+// gcpkms:///projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1.
+//
+// This package doesn't talk to any KMS itself: the calls are made by a
+// Client, which programs embedding CFSSL provide for each scheme with
+// Register.
+package kms
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// The URI schemes of the supported key management services.
+const (
+	SchemeAWS = "awskms"
+	SchemeGCP = "gcpkms"
+)
+
+// A URI names a key held in a key management service.
+type URI struct {
+	// Scheme is SchemeAWS or SchemeGCP.
+	Scheme string
+	// KeyID is the key's identifier in the service: a key ID, ARN or
+	// alias for AWS KMS, a crypto key version resource name for Google
+	// Cloud KMS.
+	KeyID string
+	// Params holds the query parameters of the URI, such as the AWS
+	// region, for the Client to interpret.
+	Params url.Values
+}
+
+func (u *URI) String() string {
+	s := u.Scheme + ":///" + u.KeyID
+	if len(u.Params) > 0 {
+		s += "?" + u.Params.Encode()
+	}
+	return s
+}
+
+// IsURI reports whether s uses the scheme of a supported key management
+// service, so that it should be parsed with ParseURI rather than read as
+// a file name.
+func IsURI(s string) bool {
+	return strings.HasPrefix(s, SchemeAWS+":") || strings.HasPrefix(s, SchemeGCP+":")
+}
+
+// ParseURI parses a key URI of the form scheme:///key-id[?params].
+func ParseURI(s string) (*URI, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != SchemeAWS && u.Scheme != SchemeGCP {
+		return nil, fmt.Errorf("unsupported key management service %q", u.Scheme)
+	}
+	if u.Opaque != "" || u.Host != "" || u.User != nil {
+		return nil, fmt.Errorf("key URI %q must have the form %s:///key-id", s, u.Scheme)
+	}
+	keyID := strings.TrimPrefix(u.Path, "/")
+	if keyID == "" {
+		return nil, fmt.Errorf("key URI %q does not name a key", s)
+	}
+	return &URI{Scheme: u.Scheme, KeyID: keyID, Params: u.Query()}, nil
+}
+
+// A Client makes the calls to a key management service.
+type Client interface {
+	// PublicKey returns the public key of the named key.
+	PublicKey(keyID string) (crypto.PublicKey, error)
+	// Sign signs digest, computed with the hash function of opts, with
+	// the named key. ECDSA signatures are ASN.1 DER encoded, and RSA
+	// signatures use PSS if opts is a *rsa.PSSOptions and PKCS #1 v1.5
+	// otherwise, as crypto.Signer requires.
+	Sign(keyID string, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// An Opener returns a Client for the service and parameters of a URI.
+type Opener func(uri *URI) (Client, error)
+
+var (
+	mu      sync.Mutex
+	openers = map[string]Opener{}
+)
+
+// Register makes open the way to reach the key management service of
+// scheme, replacing any Opener registered before.
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	openers[scheme] = open
+}
+
+// LoadSigner opens the key named by key if it is a key URI, and otherwise
+// loads the PEM encoded key file key with helpers.LoadPrivateKey.
+func LoadSigner(key string) (crypto.Signer, error) {
+	if IsURI(key) {
+		return NewSigner(key)
+	}
+	return helpers.LoadPrivateKey(key)
+}
+
+// A Signer signs with a key held in a key management service.
+type Signer struct {
+	client Client
+	keyID  string
+	pub    crypto.PublicKey
+}
+
+// NewSigner returns a Signer for the key named by uri, using the Client
+// registered for its scheme.
+func NewSigner(uri string) (*Signer, error) {
+	parsed, err := ParseURI(uri)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.ParseFailed, err)
+	}
+
+	mu.Lock()
+	open := openers[parsed.Scheme]
+	mu.Unlock()
+	if open == nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unavailable,
+			fmt.Errorf("no client registered for %s keys", parsed.Scheme))
+	}
+
+	client, err := open(parsed)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unavailable, cferr.WithClass(cferr.ClassHSM, err))
+	}
+	return NewClientSigner(client, parsed.KeyID)
+}
+
+// NewClientSigner returns a Signer for the key keyID, using client.
+func NewClientSigner(client Client, keyID string) (*Signer, error) {
+	pub, err := client.PublicKey(keyID)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed, cferr.WithClass(cferr.ClassHSM, err))
+	}
+	if pub == nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed,
+			errors.New("key management service returned no public key"))
+	}
+	return &Signer{client: client, keyID: keyID, pub: pub}, nil
+}
+
+// Public returns the public key of the signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign has the key management service sign digest. The rand argument is
+// ignored, the service providing its own randomness. Failures of the
+// service are of the errors.ClassHSM class.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if hash == 0 || !hash.Available() || len(digest) != hash.Size() {
+		return nil, fmt.Errorf("kms: digest must be hashed with a supported hash function, got %v", hash)
+	}
+	sig, err := s.client.Sign(s.keyID, digest, opts)
+	if err != nil {
+		return nil, cferr.WithClass(cferr.ClassHSM, err)
+	}
+	return sig, nil
+}
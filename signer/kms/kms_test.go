@@ -0,0 +1,143 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+func TestParseURI(t *testing.T) {
+	valid := map[string]URI{
+		"awskms:///alias/my-ca-key": {Scheme: SchemeAWS, KeyID: "alias/my-ca-key"},
+		"awskms:///arn:aws:kms:us-east-1:111122223333:key/1234abcd?region=us-east-1": {
+			Scheme: SchemeAWS, KeyID: "arn:aws:kms:us-east-1:111122223333:key/1234abcd",
+		},
+		"gcpkms:///projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1": {
+			Scheme: SchemeGCP, KeyID: "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+		},
+	}
+	for s, want := range valid {
+		if !IsURI(s) {
+			t.Errorf("expected %q to be recognized as a key URI", s)
+		}
+		u, err := ParseURI(s)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", s, err)
+			continue
+		}
+		if u.Scheme != want.Scheme || u.KeyID != want.KeyID {
+			t.Errorf("%q parsed as %s %q", s, u.Scheme, u.KeyID)
+		}
+		if u.String() != s {
+			t.Errorf("%q formats back as %q", s, u.String())
+		}
+	}
+
+	u, _ := ParseURI("awskms:///alias/my-ca-key?region=eu-west-1")
+	if region := u.Params.Get("region"); region != "eu-west-1" {
+		t.Errorf("expected the region parameter to be kept, got %q", region)
+	}
+
+	for _, s := range []string{
+		"awskms:///",
+		"awskms://alias/my-ca-key",
+		"awskms:alias/my-ca-key",
+		"azurekms:///my-key",
+		"ca-key.pem",
+	} {
+		if _, err := ParseURI(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+	if IsURI("ca-key.pem") || IsURI("env:CA_KEY") {
+		t.Error("expected file names not to be recognized as key URIs")
+	}
+}
+
+// mockClient holds its keys in memory and records the calls made to it.
+type mockClient struct {
+	keys  map[string]*ecdsa.PrivateKey
+	signs int
+}
+
+func (c *mockClient) PublicKey(keyID string) (crypto.PublicKey, error) {
+	key, ok := c.keys[keyID]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return key.Public(), nil
+}
+
+func (c *mockClient) Sign(keyID string, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	c.signs++
+	return c.keys[keyID].Sign(rand.Reader, digest, opts)
+}
+
+func TestSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &mockClient{keys: map[string]*ecdsa.PrivateKey{"alias/test-ca": key}}
+
+	if _, err := NewSigner("gcpkms:///projects/p/cryptoKeys/k"); !isError(err, cferr.Unavailable) {
+		t.Fatalf("expected an unavailable key error without a registered client, got %v", err)
+	}
+
+	var opened *URI
+	Register(SchemeAWS, func(uri *URI) (Client, error) {
+		opened = uri
+		return client, nil
+	})
+	defer Register(SchemeAWS, nil)
+
+	s, err := NewSigner("awskms:///alias/test-ca?region=us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened == nil || opened.Params.Get("region") != "us-east-1" {
+		t.Fatalf("expected the opener to get the parsed URI, got %+v", opened)
+	}
+	if !key.PublicKey.Equal(s.Public()) {
+		t.Fatal("expected the signer to have the key's public key")
+	}
+
+	digest := sha256.Sum256([]byte("to be signed"))
+	sig, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) || client.signs != 1 {
+		t.Fatal("expected the client to produce a valid signature")
+	}
+
+	if _, err := s.Sign(rand.Reader, digest[:16], crypto.SHA256); err == nil || client.signs != 1 {
+		t.Fatal("expected a digest of the wrong size to be rejected before reaching the client")
+	}
+
+	if _, err := NewSigner("awskms:///alias/missing"); !isError(err, cferr.ReadFailed) {
+		t.Fatalf("expected a missing key to fail, got %v", err)
+	}
+
+	// A client that can't be opened keeps the unavailable key code,
+	// with the class of HSM failures.
+	Register(SchemeGCP, func(uri *URI) (Client, error) {
+		return nil, errors.New("no credentials")
+	})
+	defer Register(SchemeGCP, nil)
+	_, err = NewSigner("gcpkms:///projects/p/cryptoKeys/k")
+	if !isError(err, cferr.Unavailable) || cferr.ClassOf(err) != cferr.ClassHSM {
+		t.Fatalf("expected an unavailable HSM error when the client can't be opened, got %v", err)
+	}
+}
+
+func isError(err error, reason cferr.Reason) bool {
+	cfErr, ok := err.(*cferr.Error)
+	return ok && cfErr.ErrorCode == int(cferr.PrivateKeyError)+int(reason)
+}
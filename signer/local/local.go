@@ -21,13 +21,17 @@ import (
 	"net/mail"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/info"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/metrics"
 	"github.com/cloudflare/cfssl/signer"
 	"github.com/google/certificate-transparency-go"
 	"github.com/google/certificate-transparency-go/client"
@@ -50,6 +54,8 @@ type Signer struct {
 	policy     *config.Signing
 	sigAlgo    x509.SignatureAlgorithm
 	dbAccessor certdb.Accessor
+	auditHook  signer.AuditHook
+	hooks      signer.PolicyHooks
 }
 
 // NewSigner creates a new Signer directly from a
@@ -84,11 +90,12 @@ func NewSigner(priv crypto.Signer, cert *x509.Certificate, sigAlgo x509.Signatur
 	}
 
 	return &Signer{
-		ca:       cert,
-		priv:     priv,
-		lintPriv: lintPriv,
-		sigAlgo:  sigAlgo,
-		policy:   policy,
+		ca:        cert,
+		priv:      priv,
+		lintPriv:  lintPriv,
+		sigAlgo:   sigAlgo,
+		policy:    policy,
+		auditHook: signer.NoopAuditHook{},
 	}, nil
 }
 
@@ -187,7 +194,7 @@ func (s *Signer) lint(template x509.Certificate, errLevel lint.LintStatus, lintR
 	return nil
 }
 
-func (s *Signer) sign(template *x509.Certificate, lintErrLevel lint.LintStatus, lintRegistry lint.Registry) (cert []byte, err error) {
+func (s *Signer) sign(logger log.Logger, template *x509.Certificate, lintErrLevel lint.LintStatus, lintRegistry lint.Registry) (cert []byte, err error) {
 	var initRoot bool
 	if s.ca == nil {
 		if !template.IsCA {
@@ -217,7 +224,7 @@ func (s *Signer) sign(template *x509.Certificate, lintErrLevel lint.LintStatus,
 	}
 
 	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	log.Infof("signed certificate with serial number %d", template.SerialNumber)
+	logger.Infof("signed certificate with serial number %d", template.SerialNumber)
 	return
 }
 
@@ -283,11 +290,65 @@ func OverrideHosts(template *x509.Certificate, hosts []string) {
 // certificate or certificate request with the signing profile,
 // specified by profileName.
 func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
+	start := time.Now()
+	cert, err = s.issue(req)
+	metrics.SignDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.SignErrors.WithLabelValues(metrics.ErrorReason(err)).Inc()
+	} else if req.Profile == "" {
+		metrics.CertificatesIssued.WithLabelValues("default").Inc()
+	} else {
+		metrics.CertificatesIssued.WithLabelValues(req.Profile).Inc()
+	}
+
+	if s.auditHook == nil {
+		return
+	}
+
+	if err != nil {
+		if !isPolicyError(err) {
+			return
+		}
+		if hookErr := s.auditHook.OnReject(req, err); hookErr != nil {
+			req.Logger.Errorf("audit hook failed to record rejected request: %v", hookErr)
+		}
+		return
+	}
+
+	parsedCert, parseErr := helpers.ParseCertificatePEM(cert)
+	if parseErr != nil {
+		req.Logger.Errorf("audit hook could not parse issued certificate: %v", parseErr)
+		return
+	}
+	if hookErr := s.auditHook.OnIssue(req, parsedCert); hookErr != nil {
+		req.Logger.Errorf("audit hook failed to record issued certificate: %v", hookErr)
+	}
+	return
+}
+
+// isPolicyError reports whether err is a refusal of the signing policy.
+func isPolicyError(err error) bool {
+	cfErr, ok := err.(*cferr.Error)
+	return ok && cfErr.ErrorCode/1000*1000 == int(cferr.PolicyError)
+}
+
+// issue performs the actual signing for Sign.
+func (s *Signer) issue(req signer.SignRequest) (cert []byte, err error) {
 	profile, err := signer.Profile(s, req.Profile)
 	if err != nil {
 		return
 	}
 
+	// The policy hook may replace the hosts and subject, so it is
+	// consulted before anything is taken from the request.
+	if err = s.hooks.Check(&req, req.Profile, profile); err != nil {
+		return nil, err
+	}
+
+	if err = certdb.ValidateLabels(req.Labels); err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest, err)
+	}
+
 	block, _ := pem.Decode([]byte(req.Request))
 	if block == nil {
 		return nil, cferr.New(cferr.CSRError, cferr.DecodeFailed)
@@ -303,6 +364,37 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 		return nil, err
 	}
 
+	// If the profile restricts which requester keys may enroll, reject any
+	// CSR whose embedded public key is not on the list.
+	if !profile.RequesterKeyAllowed(csrTemplate.PublicKey) {
+		req.Logger.Error("local signer policy disallows the CSR's requester key")
+		return nil, cferr.New(cferr.PolicyError, cferr.UnmatchedWhitelist)
+	}
+
+	if !profile.KeyAlgorithmAllowed(csrTemplate.PublicKey) {
+		req.Logger.Errorf("local signer policy disallows the CSR's %T public key", csrTemplate.PublicKey)
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.UnmatchedWhitelist,
+			errors.New("the CSR's public key algorithm is not allowed by the profile"))
+	}
+
+	keyFingerprint, err := config.KeyFingerprint(csrTemplate.PublicKey)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CSRError, cferr.ParseFailed, err)
+	}
+	if profile.RejectKeyReuse {
+		if err = s.checkKeyReuse(req.Logger, keyFingerprint); err != nil {
+			return nil, err
+		}
+	}
+
+	// crypto/x509 drops the otherName subject alternative names of
+	// the CSR, so they are carried apart.
+	otherNames, err := csr.OtherNames(csrTemplate.Extensions)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CSRError, cferr.ParseFailed, err)
+	}
+	csrOtherNames := otherNames
+
 	// Copy out only the fields from the CSR authorized by policy.
 	safeTemplate := x509.Certificate{}
 	// If the profile contains no explicit whitelist, assume that all fields
@@ -334,6 +426,9 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 		if profile.CSRWhitelist.URIs {
 			safeTemplate.URIs = csrTemplate.URIs
 		}
+		if !profile.CSRWhitelist.OtherNames {
+			otherNames = nil
+		}
 	}
 
 	if req.CRLOverride != "" {
@@ -341,25 +436,31 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 	}
 
 	if safeTemplate.IsCA {
-		if !profile.CAConstraint.IsCA {
-			log.Error("local signer policy disallows issuing CA certificate")
-			return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest)
-		}
-
-		if s.ca != nil && s.ca.MaxPathLen > 0 {
-			if safeTemplate.MaxPathLen >= s.ca.MaxPathLen {
-				log.Error("local signer certificate disallows CA MaxPathLen extending")
-				// do not sign a cert with pathlen > current
-				return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest)
-			}
-		} else if s.ca != nil && s.ca.MaxPathLen == 0 && s.ca.MaxPathLenZero {
-			log.Error("local signer certificate disallows issuing CA certificate")
-			// signer has pathlen of 0, do not sign more intermediate CAs
-			return nil, cferr.New(cferr.PolicyError, cferr.InvalidRequest)
+		if err = s.checkCA(req.Logger, &safeTemplate, profile); err != nil {
+			return nil, err
 		}
 	}
 
 	OverrideHosts(&safeTemplate, req.Hosts)
+	if req.Hosts != nil {
+		otherNames = nil
+	}
+
+	// A subject alternative name copied as is from the CSR carries the
+	// names of the certificate, unless the request overrides them, and
+	// they must pass the name whitelist like any other. It can't hold
+	// names that can't be checked.
+	copySAN := req.Hosts == nil && profile.CSRExtensionWhitelist[csr.SubjectAltNameOID.String()]
+	if copySAN {
+		if err = csr.CheckNameTypes(csrTemplate.Extensions); err != nil {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest, err)
+		}
+		safeTemplate.DNSNames = csrTemplate.DNSNames
+		safeTemplate.EmailAddresses = csrTemplate.EmailAddresses
+		safeTemplate.IPAddresses = csrTemplate.IPAddresses
+		safeTemplate.URIs = csrTemplate.URIs
+		otherNames = csrOtherNames
+	}
 	safeTemplate.Subject = PopulateSubjectFromCSR(req.Subject, safeTemplate.Subject)
 
 	// If there is a whitelist, ensure that both the Common Name and SAN DNSNames match
@@ -384,33 +485,44 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 				return nil, cferr.New(cferr.PolicyError, cferr.UnmatchedWhitelist)
 			}
 		}
+		for _, name := range otherNames {
+			if profile.NameWhitelist.Find([]byte(name.Value)) == nil {
+				return nil, cferr.New(cferr.PolicyError, cferr.UnmatchedWhitelist)
+			}
+		}
 	}
 
+	// Sequential serial numbers are only drawn once the request has
+	// passed the other checks, so as not to waste them.
+	requestedSerial := false
 	if profile.ClientProvidesSerialNumbers {
 		if req.Serial == nil {
 			return nil, cferr.New(cferr.CertificateError, cferr.MissingSerial)
 		}
+		if profile.SerialStrategy == config.SerialRequested {
+			if err = validRequestedSerial(req.Serial); err != nil {
+				return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest, err)
+			}
+			requestedSerial = true
+		}
 		safeTemplate.SerialNumber = req.Serial
-	} else {
-		// RFC 5280 4.1.2.2:
-		// Certificate users MUST be able to handle serialNumber
-		// values up to 20 octets.  Conforming CAs MUST NOT use
-		// serialNumber values longer than 20 octets.
-		//
-		// If CFSSL is providing the serial numbers, it makes
-		// sense to use the max supported size.
-		serialNumber := make([]byte, 20)
-		_, err = io.ReadFull(rand.Reader, serialNumber)
-		if err != nil {
-			return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	} else if profile.AllowRequestedSerial && req.Serial != nil {
+		if err = validRequestedSerial(req.Serial); err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest, err)
 		}
+		safeTemplate.SerialNumber = req.Serial
+		requestedSerial = true
+	} else if profile.SerialStrategy != config.SerialSequential {
+		if safeTemplate.SerialNumber, err = randomSerial(); err != nil {
+			return nil, err
+		}
+	}
 
-		// SetBytes interprets buf as the bytes of a big-endian
-		// unsigned integer. The leading byte should be masked
-		// off to ensure it isn't negative.
-		serialNumber[0] &= 0x7F
-
-		safeTemplate.SerialNumber = new(big.Int).SetBytes(serialNumber)
+	if len(profile.CSRExtensionWhitelist) > 0 {
+		copyCSRExtensions(&safeTemplate, csrTemplate.Extensions, profile.CSRExtensionWhitelist, copySAN, req.Extensions)
+		if copySAN {
+			otherNames = nil
+		}
 	}
 
 	if len(req.Extensions) > 0 {
@@ -433,6 +545,14 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 		}
 	}
 
+	if profile.RSAPSS {
+		safeTemplate.SignatureAlgorithm = helpers.PSSAlgo(s.sigAlgo)
+		if safeTemplate.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+				errors.New("RSA-PSS signatures require an RSA CA key"))
+		}
+	}
+
 	var distPoints = safeTemplate.CRLDistributionPoints
 	err = signer.FillTemplate(&safeTemplate, s.policy.Default, profile, req.NotBefore, req.NotAfter)
 	if err != nil {
@@ -441,18 +561,90 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 	if distPoints != nil && len(distPoints) > 0 {
 		safeTemplate.CRLDistributionPoints = distPoints
 	}
+	// A certificate must not outlive the CA that issues it, unless the
+	// profile explicitly allows it. A CA that has already expired by
+	// the certificate's NotBefore cannot be capped to meaningfully.
+	if s.ca != nil && !profile.AllowOutlivingCA &&
+		safeTemplate.NotAfter.After(s.ca.NotAfter) && s.ca.NotAfter.After(safeTemplate.NotBefore) {
+		req.Logger.Infof("capping the certificate's expiry at the CA's expiry %s", s.ca.NotAfter)
+		safeTemplate.NotAfter = s.ca.NotAfter.UTC()
+	}
+	if req.MustStaple {
+		signer.AddMustStaple(&safeTemplate)
+	}
+	authorityKeyID := profile.AuthorityKeyID
+	if req.AuthorityKeyID != "" {
+		if !profile.AllowAuthorityKeyIDOverride {
+			req.Logger.Error("local signer policy disallows overriding the authority key identifier")
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+				errors.New("the profile doesn't allow requests to set the authority key identifier"))
+		}
+		authorityKeyID = req.AuthorityKeyID
+	}
+	if authorityKeyID != "" {
+		keyID, err := config.ParseKeyIdentifier(authorityKeyID)
+		if err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest, err)
+		}
+		if err = signer.SetAuthorityKeyID(&safeTemplate, keyID); err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+		}
+	}
+	if ian := profile.IssuerAltName; ian.CopyFromCA || len(ian.Names) != 0 {
+		var names x509.Certificate
+		if ian.CopyFromCA && s.ca != nil {
+			names.DNSNames = append(names.DNSNames, s.ca.DNSNames...)
+			names.EmailAddresses = append(names.EmailAddresses, s.ca.EmailAddresses...)
+			names.URIs = append(names.URIs, s.ca.URIs...)
+			names.IPAddresses = append(names.IPAddresses, s.ca.IPAddresses...)
+		}
+		var explicit x509.Certificate
+		OverrideHosts(&explicit, ian.Names)
+		names.DNSNames = append(names.DNSNames, explicit.DNSNames...)
+		names.EmailAddresses = append(names.EmailAddresses, explicit.EmailAddresses...)
+		names.URIs = append(names.URIs, explicit.URIs...)
+		names.IPAddresses = append(names.IPAddresses, explicit.IPAddresses...)
+
+		if err = signer.AddIssuerAltName(&safeTemplate, &names); err != nil {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
+
+	if len(otherNames) > 0 {
+		if err = signer.AddSubjectAltName(&safeTemplate, otherNames); err != nil {
+			return nil, cferr.Wrap(cferr.CSRError, cferr.BadRequest, err)
+		}
+	}
+
+	if requestedSerial {
+		if err = s.checkSerialUnused(req.Logger, &safeTemplate); err != nil {
+			return nil, err
+		}
+	} else if safeTemplate.SerialNumber == nil {
+		if err = s.nextSerial(&safeTemplate); err != nil {
+			return nil, err
+		}
+	}
 
 	var certTBS = safeTemplate
+	if len(profile.StrippedExtensions) > 0 {
+		stripExtensions(&certTBS, profile.StrippedExtensions)
+	}
 
 	if len(profile.CTLogServers) > 0 || req.ReturnPrecert {
 		// Add a poison extension which prevents validation
 		var poisonExtension = pkix.Extension{Id: signer.CTPoisonOID, Critical: true, Value: []byte{0x05, 0x00}}
 		var poisonedPreCert = certTBS
-		poisonedPreCert.ExtraExtensions = append(safeTemplate.ExtraExtensions, poisonExtension)
-		cert, err = s.sign(&poisonedPreCert, profile.LintErrLevel, profile.LintRegistry)
+		poisonedPreCert.ExtraExtensions = make([]pkix.Extension, 0, len(certTBS.ExtraExtensions)+1)
+		poisonedPreCert.ExtraExtensions = append(poisonedPreCert.ExtraExtensions, certTBS.ExtraExtensions...)
+		poisonedPreCert.ExtraExtensions = append(poisonedPreCert.ExtraExtensions, poisonExtension)
+		cert, err = s.sign(req.Logger, &poisonedPreCert, profile.LintErrLevel, profile.LintRegistry)
 		if err != nil {
 			return
 		}
+		if err = checkStrippedExtensions(req.Logger, cert, profile.StrippedExtensions); err != nil {
+			return nil, err
+		}
 
 		if req.ReturnPrecert {
 			return cert, nil
@@ -463,7 +655,7 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 		var sctList []ct.SignedCertificateTimestamp
 
 		for _, server := range profile.CTLogServers {
-			log.Infof("submitting poisoned precertificate to %s", server)
+			req.Logger.Infof("submitting poisoned precertificate to %s", server)
 			ctclient, err := client.New(server, nil, jsonclient.Options{})
 			if err != nil {
 				return nil, cferr.Wrap(cferr.CTError, cferr.PrecertSubmissionFailed, err)
@@ -494,11 +686,26 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 	}
 
 	var signedCert []byte
-	signedCert, err = s.sign(&certTBS, profile.LintErrLevel, profile.LintRegistry)
+	signedCert, err = s.sign(req.Logger, &certTBS, profile.LintErrLevel, profile.LintRegistry)
 	if err != nil {
 		return nil, err
 	}
+	if err = checkStrippedExtensions(req.Logger, signedCert, profile.StrippedExtensions); err != nil {
+		return nil, err
+	}
 
+	if err = s.record(signedCert, req, keyFingerprint, profile.RejectKeyReuse); err != nil {
+		return nil, err
+	}
+	return signedCert, nil
+}
+
+// record saves a newly signed certificate in the certificate database,
+// if there is one, and publishes its issuance. If uniqueKey is set, the
+// database refuses the certificate when it already holds one from this
+// issuer recorded the same way for the same key: this closes the race
+// between concurrent requests that checkKeyReuse can't see.
+func (s *Signer) record(signedCert []byte, req signer.SignRequest, keyFingerprint string, uniqueKey bool) error {
 	// Get the AKI from signedCert.  This is required to support Go 1.9+.
 	// In prior versions of Go, x509.CreateCertificate updated the
 	// AuthorityKeyId of certTBS.
@@ -506,24 +713,280 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 
 	if s.dbAccessor != nil {
 		var certRecord = certdb.CertificateRecord{
-			Serial: certTBS.SerialNumber.String(),
-			// this relies on the specific behavior of x509.CreateCertificate
-			// which sets the AuthorityKeyId from the signer's SubjectKeyId
-			AKI:     hex.EncodeToString(parsedCert.AuthorityKeyId),
+			Serial: parsedCert.SerialNumber.String(),
+			// Certificates are recorded under the signer's SKI,
+			// whatever AuthorityKeyId they carry, so that the CRL,
+			// OCSP and serial numbers of the CA cover them all.
+			AKI:     s.issuerKeyID(parsedCert),
 			CALabel: req.Label,
 			Status:  "good",
-			Expiry:  certTBS.NotAfter,
+			Expiry:  parsedCert.NotAfter,
 			PEM:     string(signedCert),
+
+			CommonName: parsedCert.Subject.CommonName,
+			SANs:       strings.Join(subjectAltNames(parsedCert), ","),
+			Profile:    req.Profile,
+			Requester:  req.Requester,
+
+			KeyFingerprint: keyFingerprint,
+			Labels:         req.Labels,
+		}
+		if uniqueKey {
+			certRecord.UniqueKeyFingerprint = &keyFingerprint
 		}
 
-		err = s.dbAccessor.InsertCertificate(certRecord)
+		err := s.dbAccessor.InsertCertificate(certRecord)
+		if err == certdb.ErrKeyReused {
+			req.Logger.Errorf("public key %s has already been certified", keyFingerprint)
+			return cferr.New(cferr.PolicyError, cferr.KeyReused)
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		log.Debug("saved certificate with serial number ", certTBS.SerialNumber)
+		req.Logger.Debug("saved certificate with serial number ", parsedCert.SerialNumber)
 	}
+	return nil
+}
 
-	return signedCert, nil
+// checkCA returns an error if the profile or the path length of the CA
+// certificate disallow signing the CA certificate template.
+func (s *Signer) checkCA(logger log.Logger, template *x509.Certificate, profile *config.SigningProfile) error {
+	if !profile.CAConstraint.IsCA {
+		logger.Error("local signer policy disallows issuing CA certificate")
+		return cferr.New(cferr.PolicyError, cferr.InvalidRequest)
+	}
+
+	if s.ca != nil && s.ca.MaxPathLen > 0 {
+		if template.MaxPathLen >= s.ca.MaxPathLen {
+			logger.Error("local signer certificate disallows CA MaxPathLen extending")
+			// do not sign a cert with pathlen > current
+			return cferr.New(cferr.PolicyError, cferr.InvalidRequest)
+		}
+	} else if s.ca != nil && s.ca.MaxPathLen == 0 && s.ca.MaxPathLenZero {
+		logger.Error("local signer certificate disallows issuing CA certificate")
+		// signer has pathlen of 0, do not sign more intermediate CAs
+		return cferr.New(cferr.PolicyError, cferr.InvalidRequest)
+	}
+	return nil
+}
+
+// randomSerial returns a random serial number.
+func randomSerial() (*big.Int, error) {
+	// RFC 5280 4.1.2.2:
+	// Certificate users MUST be able to handle serialNumber
+	// values up to 20 octets.  Conforming CAs MUST NOT use
+	// serialNumber values longer than 20 octets.
+	//
+	// If CFSSL is providing the serial numbers, it makes
+	// sense to use the max supported size.
+	serialNumber := make([]byte, 20)
+	_, err := io.ReadFull(rand.Reader, serialNumber)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+
+	// SetBytes interprets buf as the bytes of a big-endian
+	// unsigned integer. The leading byte should be masked
+	// off to ensure it isn't negative.
+	serialNumber[0] &= 0x7F
+
+	return new(big.Int).SetBytes(serialNumber), nil
+}
+
+// maxSerialBits bounds requested serial numbers so that they encode in at
+// most 20 octets, as RFC 5280 4.1.2.2 requires.
+const maxSerialBits = 20*8 - 1
+
+// validRequestedSerial checks that a serial number requested with a sign
+// request is positive and fits in 20 octets.
+func validRequestedSerial(serial *big.Int) error {
+	if serial.Sign() <= 0 {
+		return errors.New("requested serial number must be positive")
+	}
+	if serial.BitLen() > maxSerialBits {
+		return errors.New("requested serial number is longer than 20 octets")
+	}
+	return nil
+}
+
+// copyCSRExtensions copies the extensions of the CSR whose OIDs are in
+// whitelist into template, replacing any extension of the same OID
+// already there. The subject alternative name is only copied if copySAN
+// is set, and extensions the request sets itself are left to it.
+func copyCSRExtensions(template *x509.Certificate, exts []pkix.Extension, whitelist map[string]bool, copySAN bool, reqExts []signer.Extension) {
+	skipped := map[string]bool{}
+	for _, ext := range reqExts {
+		skipped[asn1.ObjectIdentifier(ext.ID).String()] = true
+	}
+	if !copySAN {
+		skipped[csr.SubjectAltNameOID.String()] = true
+	}
+
+	var copied []pkix.Extension
+	replaced := map[string]bool{}
+	for _, ext := range exts {
+		oid := ext.Id.String()
+		if whitelist[oid] && !skipped[oid] {
+			copied = append(copied, ext)
+			replaced[oid] = true
+		}
+	}
+	var kept []pkix.Extension
+	for _, ext := range template.ExtraExtensions {
+		if !replaced[ext.Id.String()] {
+			kept = append(kept, ext)
+		}
+	}
+	template.ExtraExtensions = append(kept, copied...)
+}
+
+// stripExtensions removes from template every extension whose OID is in
+// strip: extra extensions are dropped, and the fields crypto/x509 turns
+// into extensions are cleared.
+func stripExtensions(template *x509.Certificate, strip map[string]bool) {
+	var kept []pkix.Extension
+	for _, ext := range template.ExtraExtensions {
+		if !strip[ext.Id.String()] {
+			kept = append(kept, ext)
+		}
+	}
+	template.ExtraExtensions = kept
+
+	for oid := range strip {
+		switch oid {
+		case "2.5.29.14":
+			template.SubjectKeyId = nil
+		case "2.5.29.15":
+			template.KeyUsage = 0
+		case "2.5.29.17":
+			template.DNSNames = nil
+			template.EmailAddresses = nil
+			template.IPAddresses = nil
+			template.URIs = nil
+		case "2.5.29.19":
+			template.BasicConstraintsValid = false
+		case "2.5.29.30":
+			template.PermittedDNSDomainsCritical = false
+			template.PermittedDNSDomains = nil
+			template.ExcludedDNSDomains = nil
+			template.PermittedIPRanges = nil
+			template.ExcludedIPRanges = nil
+			template.PermittedEmailAddresses = nil
+			template.ExcludedEmailAddresses = nil
+			template.PermittedURIDomains = nil
+			template.ExcludedURIDomains = nil
+		case "2.5.29.31":
+			template.CRLDistributionPoints = nil
+		case "2.5.29.32":
+			template.PolicyIdentifiers = nil
+			template.Policies = nil
+		case "2.5.29.37":
+			template.ExtKeyUsage = nil
+			template.UnknownExtKeyUsage = nil
+		case "1.3.6.1.5.5.7.1.1":
+			template.OCSPServer = nil
+			template.IssuingCertificateURL = nil
+		}
+	}
+}
+
+// checkStrippedExtensions returns an error if the PEM encoded certificate
+// carries an extension that should have been stripped.
+func checkStrippedExtensions(logger log.Logger, certPEM []byte, strip map[string]bool) error {
+	if len(strip) == 0 {
+		return nil
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+	for _, ext := range cert.Extensions {
+		if strip[ext.Id.String()] {
+			logger.Errorf("signed certificate carries stripped extension %v", ext.Id)
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				fmt.Errorf("extension %v could not be stripped from the certificate", ext.Id))
+		}
+	}
+	return nil
+}
+
+// checkSerialUnused returns an error if the certificate database already
+// holds a certificate with template's serial number from the same
+// authority key. Without a certificate database there is nothing to check.
+func (s *Signer) checkSerialUnused(logger log.Logger, template *x509.Certificate) error {
+	if s.dbAccessor == nil {
+		return nil
+	}
+	records, err := s.dbAccessor.GetCertificate(template.SerialNumber.String(), s.issuerKeyID(template))
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		logger.Errorf("requested serial number %s is already in use", template.SerialNumber)
+		return cferr.New(cferr.CertificateError, cferr.DuplicateSerial)
+	}
+	return nil
+}
+
+// nextSerial gives template the next serial number of the sequence kept
+// in the certificate database for its issuer.
+func (s *Signer) nextSerial(template *x509.Certificate) error {
+	if s.dbAccessor == nil {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("sequential serial numbers require a certificate database"))
+	}
+	serial, err := s.dbAccessor.NextSerialNumber(s.issuerKeyID(template))
+	if err != nil {
+		return err
+	}
+	template.SerialNumber = big.NewInt(serial)
+	return nil
+}
+
+// issuerKeyID returns the hex-encoded authority key identifier under
+// which a certificate signed from template is recorded: the SKI of the
+// CA, or the AuthorityKeyId of template for a CA without one.
+func (s *Signer) issuerKeyID(template *x509.Certificate) string {
+	if s.ca != nil && len(s.ca.SubjectKeyId) > 0 {
+		return hex.EncodeToString(s.ca.SubjectKeyId)
+	}
+	return hex.EncodeToString(template.AuthorityKeyId)
+}
+
+// checkKeyReuse returns an error if the certificate database holds a
+// certificate for the public key with the given fingerprint. Without a
+// certificate database able to look up key fingerprints reuse cannot be
+// detected, so the request is refused.
+func (s *Signer) checkKeyReuse(logger log.Logger, keyFingerprint string) error {
+	accessor, ok := s.dbAccessor.(certdb.KeyFingerprintAccessor)
+	if !ok {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("reject_key_reuse requires a certificate database looking up key fingerprints"))
+	}
+	records, err := accessor.GetCertificatesByKeyFingerprint(keyFingerprint)
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		logger.Errorf("public key %s has already been certified (serial %s)", keyFingerprint, records[0].Serial)
+		return cferr.New(cferr.PolicyError, cferr.KeyReused)
+	}
+	return nil
+}
+
+// subjectAltNames returns every DNS name, IP address, email address and
+// URI in the certificate's subjectAltName extension.
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
 }
 
 // SignFromPrecert creates and signs a certificate from an existing precertificate
@@ -606,7 +1069,115 @@ func (s *Signer) SignFromPrecert(precert *x509.Certificate, scts []ct.SignedCert
 	// Sign the tbsCert. Linting is always disabled because there is no way for
 	// this API to know the correct lint settings to use because there is no
 	// reference to the signing profile of the precert available.
-	return s.sign(&tbsCert, 0, nil)
+	return s.sign(log.Logger{}, &tbsCert, 0, nil)
+}
+
+var (
+	authorityInfoAccessOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	crlDistributionPointsOID = asn1.ObjectIdentifier{2, 5, 29, 31}
+)
+
+// CrossSign issues a cross-signed version of the existing CA certificate
+// ca, chaining to the signer's CA instead of ca's issuer. The subject and
+// the subject key are kept as is, as are the extensions of ca, so that
+// the cross-signed certificate can stand in for ca in any chain. The
+// serial number, issuer, AKI and validity are those of a certificate
+// signed with the profile, and so are the AIA and CRL distribution points,
+// which describe the new issuer. The profile must allow issuing CA
+// certificates.
+func (s *Signer) CrossSign(ca *x509.Certificate, profileName string) ([]byte, error) {
+	if s.ca == nil {
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+			errors.New("cross-signing requires a CA certificate"))
+	}
+	if !ca.IsCA {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest,
+			errors.New("only CA certificates can be cross-signed"))
+	}
+
+	profile, err := signer.Profile(s, profileName)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkCA(log.Logger{}, ca, profile); err != nil {
+		return nil, err
+	}
+	if !profile.KeyAlgorithmAllowed(ca.PublicKey) {
+		log.Errorf("local signer policy disallows the %T public key of the CA", ca.PublicKey)
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.UnmatchedWhitelist,
+			errors.New("the CA's public key algorithm is not allowed by the profile"))
+	}
+	if err = s.hooks.CheckCrossSign(ca, profileName, profile); err != nil {
+		return nil, err
+	}
+	keyFingerprint, err := config.KeyFingerprint(ca.PublicKey)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+
+	// The validity and the URLs describing the issuer are those the
+	// profile gives any certificate.
+	var issued = x509.Certificate{PublicKey: ca.PublicKey}
+	if err = signer.FillTemplate(&issued, s.policy.Default, profile, time.Time{}, time.Time{}); err != nil {
+		return nil, err
+	}
+	if !profile.AllowOutlivingCA &&
+		issued.NotAfter.After(s.ca.NotAfter) && s.ca.NotAfter.After(issued.NotBefore) {
+		log.Infof("capping the certificate's expiry at the CA's expiry %s", s.ca.NotAfter)
+		issued.NotAfter = s.ca.NotAfter.UTC()
+	}
+
+	template, err := x509.ParseCertificate(ca.Raw)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+	template.SignatureAlgorithm = s.sigAlgo
+	if profile.RSAPSS {
+		template.SignatureAlgorithm = helpers.PSSAlgo(s.sigAlgo)
+		if template.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+				errors.New("RSA-PSS signatures require an RSA CA key"))
+		}
+	}
+	template.NotBefore = issued.NotBefore
+	template.NotAfter = issued.NotAfter
+	// The AKI is taken from the signer's SKI by x509.CreateCertificate.
+	template.AuthorityKeyId = nil
+	template.OCSPServer = issued.OCSPServer
+	template.IssuingCertificateURL = issued.IssuingCertificateURL
+	template.CRLDistributionPoints = issued.CRLDistributionPoints
+
+	// The extensions of ca are copied as they are encoded, rather than
+	// encoded again from their parsed fields, so that those the standard
+	// library doesn't know are kept too.
+	template.ExtraExtensions = nil
+	for _, ext := range ca.Extensions {
+		if ext.Id.Equal(signer.AuthorityKeyIDOID) || ext.Id.Equal(authorityInfoAccessOID) ||
+			ext.Id.Equal(crlDistributionPointsOID) {
+			continue
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
+
+	if profile.ClientProvidesSerialNumbers {
+		return nil, cferr.New(cferr.CertificateError, cferr.MissingSerial)
+	} else if profile.SerialStrategy == config.SerialSequential {
+		template.SerialNumber = nil
+		if err = s.nextSerial(template); err != nil {
+			return nil, err
+		}
+	} else if template.SerialNumber, err = randomSerial(); err != nil {
+		return nil, err
+	}
+
+	cert, err := s.sign(log.Logger{}, template, profile.LintErrLevel, profile.LintRegistry)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.record(cert, signer.SignRequest{Profile: profileName}, keyFingerprint, false); err != nil {
+		return nil, err
+	}
+	return cert, nil
 }
 
 // Info return a populated info.Resp struct or an error.
@@ -645,6 +1216,7 @@ func (s *Signer) Certificate(label, profile string) (*x509.Certificate, error) {
 // SetPolicy sets the signer's signature policy.
 func (s *Signer) SetPolicy(policy *config.Signing) {
 	s.policy = policy
+	s.hooks.Reset()
 }
 
 // SetDBAccessor sets the signers' cert db accessor
@@ -652,6 +1224,13 @@ func (s *Signer) SetDBAccessor(dba certdb.Accessor) {
 	s.dbAccessor = dba
 }
 
+// SetAuditHook sets the hook notified of every issued certificate and
+// sign request refused by the signing policy. A nil hook disables
+// auditing.
+func (s *Signer) SetAuditHook(hook signer.AuditHook) {
+	s.auditHook = hook
+}
+
 // GetDBAccessor returns the signers' cert db accessor
 func (s *Signer) GetDBAccessor() certdb.Accessor {
 	return s.dbAccessor
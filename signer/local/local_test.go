@@ -3,6 +3,7 @@ package local
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -10,14 +11,17 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"io/ioutil"
+	stdlog "log"
 	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"regexp"
 	"sort"
@@ -25,13 +29,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/metrics"
 	"github.com/cloudflare/cfssl/signer"
 	"github.com/google/certificate-transparency-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/zmap/zlint/v2/lint"
 )
 
@@ -1390,7 +1400,7 @@ func TestSignFromPrecert(t *testing.T) {
 
 	_uri, _ := url.Parse("https://www.cloudflare.com")
 
-	precertBytes, err := testSigner.sign(&x509.Certificate{
+	precertBytes, err := testSigner.sign(log.Logger{}, &x509.Certificate{
 		SignatureAlgorithm: x509.SHA512WithRSA,
 		PublicKey:          k.Public(),
 		SerialNumber:       big.NewInt(10),
@@ -1636,3 +1646,1428 @@ func TestLint(t *testing.T) {
 		})
 	}
 }
+
+func TestRequesterKeysSign(t *testing.T) {
+	allowedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deniedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCSR := func(priv *ecdsa.PrivateKey) string {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device.example.com"},
+		}, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	}
+
+	fp, err := config.KeyFingerprint(allowedKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{
+		Default: &config.SigningProfile{
+			Usage:                 []string{"signing", "client auth"},
+			ExpiryString:          "1h",
+			Expiry:                1 * time.Hour,
+			RequesterKeyWhitelist: map[string]bool{fp: true},
+		},
+	}
+
+	if _, err := s.Sign(signer.SignRequest{Request: newCSR(allowedKey)}); err != nil {
+		t.Fatalf("expected CSR from an allowed requester key to be signed: %v", err)
+	}
+
+	_, err = s.Sign(signer.SignRequest{Request: newCSR(deniedKey)})
+	if err == nil {
+		t.Fatal("expected CSR from a disallowed requester key to be rejected")
+	}
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PolicyError)+int(cferr.UnmatchedWhitelist) {
+		t.Fatalf("expected an unmatched whitelist policy error, got %v", err)
+	}
+}
+
+type recordingAuditHook struct {
+	issued   []*x509.Certificate
+	rejected []error
+	err      error
+}
+
+func (h *recordingAuditHook) OnIssue(req signer.SignRequest, cert *x509.Certificate) error {
+	h.issued = append(h.issued, cert)
+	return h.err
+}
+
+func (h *recordingAuditHook) OnReject(req signer.SignRequest, reason error) error {
+	h.rejected = append(h.rejected, reason)
+	return h.err
+}
+
+func TestAuditHook(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	hook := &recordingAuditHook{}
+	s.SetAuditHook(hook)
+
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.issued) != 1 || hook.issued[0].SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Fatal("audit hook was not notified of the issued certificate")
+	}
+
+	// Only refusals of the signing policy are reported.
+	if _, err = s.Sign(signer.SignRequest{Request: "not a csr"}); err == nil {
+		t.Fatal("expected an invalid CSR to be rejected")
+	}
+	if len(hook.rejected) != 0 {
+		t.Fatal("audit hook was notified of a request failing outside the signing policy")
+	}
+
+	s.policy.Profiles = map[string]*config.SigningProfile{
+		"restricted": {
+			Usage:                 []string{"signing", "client auth"},
+			ExpiryString:          "1h",
+			Expiry:                1 * time.Hour,
+			RequesterKeyWhitelist: map[string]bool{"no key": true},
+		},
+	}
+	_, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Profile: "restricted"})
+	if err == nil {
+		t.Fatal("expected a request refused by the profile to be rejected")
+	}
+	if len(hook.rejected) != 1 || hook.rejected[0] != err {
+		t.Fatal("audit hook was not notified of the rejected request")
+	}
+
+	// A failing hook must not break issuance.
+	hook.err = errors.New("audit log unavailable")
+	if _, err := s.Sign(signer.SignRequest{Request: string(csrPEM)}); err != nil {
+		t.Fatalf("audit hook error should not fail issuance: %v", err)
+	}
+}
+
+func TestMustStapleSign(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustStapleValue := []byte{0x30, 0x03, 0x02, 0x01, 0x05}
+	countTLSFeature := func(certPEM []byte) int {
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(signer.TLSFeatureOID) {
+				if !bytes.Equal(ext.Value, mustStapleValue) {
+					t.Fatalf("TLS Feature extension has wrong value: %x", ext.Value)
+				}
+				n++
+			}
+		}
+		return n
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	profile := &config.SigningProfile{
+		Usage:        []string{"signing", "server auth"},
+		ExpiryString: "1h",
+		Expiry:       1 * time.Hour,
+	}
+	s.policy = &config.Signing{Default: profile}
+
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countTLSFeature(certPEM); n != 0 {
+		t.Fatal("TLS Feature extension should only be added when requested")
+	}
+
+	certPEM, err = s.Sign(signer.SignRequest{Request: string(csrPEM), MustStaple: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countTLSFeature(certPEM); n != 1 {
+		t.Fatalf("expected one TLS Feature extension when requested, got %d", n)
+	}
+
+	profile.MustStaple = true
+	for _, req := range []signer.SignRequest{
+		{Request: string(csrPEM)},
+		{Request: string(csrPEM), MustStaple: true},
+	} {
+		certPEM, err = s.Sign(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := countTLSFeature(certPEM); n != 1 {
+			t.Fatalf("expected one TLS Feature extension from the profile, got %d", n)
+		}
+	}
+}
+
+func TestEd25519CSRSign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "ed25519.example.com"},
+		DNSNames: []string{"ed25519.example.com"},
+	}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatalf("failed to sign an ed25519 CSR: %v", err)
+	}
+
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.PublicKeyAlgorithm != x509.Ed25519 {
+		t.Fatalf("expected an ed25519 public key, got %v", cert.PublicKeyAlgorithm)
+	}
+	certPub, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok || !bytes.Equal(certPub, pub) {
+		t.Fatal("issued certificate doesn't carry the CSR's ed25519 public key")
+	}
+
+	// A CSR whose signature doesn't verify must still be rejected.
+	tampered := make([]byte, len(der))
+	copy(tampered, der)
+	tampered[len(tampered)-1] ^= 0xff
+	csrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: tampered})
+	if _, err := s.Sign(signer.SignRequest{Request: string(csrPEM)}); err == nil {
+		t.Fatal("expected an ed25519 CSR with a bad signature to be rejected")
+	}
+}
+
+func TestSignDBMetadata(t *testing.T) {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	dbAccessor := sql.NewAccessor(db)
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.SetDBAccessor(dbAccessor)
+
+	csrPEM, err := ioutil.ReadFile(fullSubjectCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := s.Sign(signer.SignRequest{
+		Request:   string(csrPEM),
+		Hosts:     []string{"cloudflare.com", "127.0.0.1", "admin@cloudflare.com"},
+		Requester: "test-key",
+		Labels:    map[string]string{"team": "pki"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := dbAccessor.GetCertificate(cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected one certificate record, got %d", len(records))
+	}
+
+	record := records[0]
+	if record.CommonName != cert.Subject.CommonName {
+		t.Errorf("expected common name %q, got %q", cert.Subject.CommonName, record.CommonName)
+	}
+	if record.SANs != "cloudflare.com,127.0.0.1,admin@cloudflare.com" {
+		t.Errorf("unexpected SANs %q", record.SANs)
+	}
+	if record.Requester != "test-key" {
+		t.Errorf("expected requester test-key, got %q", record.Requester)
+	}
+
+	labels, err := dbAccessor.GetCertificateLabels(cert.SerialNumber.String(), record.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 1 || labels["team"] != "pki" {
+		t.Errorf("expected label team=pki, got %v", labels)
+	}
+
+	_, err = s.Sign(signer.SignRequest{
+		Request: string(csrPEM),
+		Labels:  map[string]string{"": "empty"},
+	})
+	if err == nil {
+		t.Error("expected a sign request with an empty label name to be rejected")
+	}
+}
+
+func TestRejectKeyReuse(t *testing.T) {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCSR := func(commonName string) string {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: commonName},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{
+		Default: &config.SigningProfile{
+			Usage:          []string{"signing", "client auth"},
+			ExpiryString:   "1h",
+			Expiry:         1 * time.Hour,
+			RejectKeyReuse: true,
+		},
+	}
+
+	if _, err := s.Sign(signer.SignRequest{Request: newCSR("first.example.com")}); err == nil {
+		t.Fatal("expected reject_key_reuse without a certificate database to fail")
+	}
+
+	s.SetDBAccessor(sql.NewAccessor(db))
+	if _, err := s.Sign(signer.SignRequest{Request: newCSR("first.example.com")}); err != nil {
+		t.Fatalf("expected the first certificate for a key to be signed: %v", err)
+	}
+
+	_, err = s.Sign(signer.SignRequest{Request: newCSR("second.example.com")})
+	if err == nil {
+		t.Fatal("expected a second certificate for the same key to be rejected")
+	}
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PolicyError)+int(cferr.KeyReused) {
+		t.Fatalf("expected a key reused policy error, got %v", err)
+	}
+
+	// A concurrent request for the same key passes the check before the
+	// first certificate is recorded: the database refuses the second.
+	s.SetDBAccessor(unseenKeys{sql.NewAccessor(db)})
+	_, err = s.Sign(signer.SignRequest{Request: newCSR("third.example.com")})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PolicyError)+int(cferr.KeyReused) {
+		t.Fatalf("expected a key reused policy error, got %v", err)
+	}
+}
+
+// unseenKeys is a certificate database whose key fingerprint lookups
+// never find a certificate.
+type unseenKeys struct {
+	certdb.Accessor
+}
+
+func (unseenKeys) GetCertificatesByKeyFingerprint(string) ([]certdb.CertificateRecord, error) {
+	return nil, nil
+}
+
+func TestAllowRequestedSerial(t *testing.T) {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.SetDBAccessor(sql.NewAccessor(db))
+	profile := &config.SigningProfile{
+		Usage:        []string{"signing", "server auth"},
+		ExpiryString: "1h",
+		Expiry:       1 * time.Hour,
+	}
+	s.policy = &config.Signing{Default: profile}
+
+	serial := big.NewInt(413413)
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM), Serial: serial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Cmp(serial) == 0 {
+		t.Fatal("expected the requested serial to be ignored without allow_requested_serial")
+	}
+
+	profile.AllowRequestedSerial = true
+	certPEM, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Serial: serial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Cmp(serial) != 0 {
+		t.Fatalf("expected serial %v, got %v", serial, cert.SerialNumber)
+	}
+
+	_, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Serial: serial})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.CertificateError)+int(cferr.DuplicateSerial) {
+		t.Fatalf("expected a duplicate serial error, got %v", err)
+	}
+
+	tooLong := new(big.Int).Lsh(big.NewInt(1), 159)
+	for _, bad := range []*big.Int{big.NewInt(0), big.NewInt(-5), tooLong} {
+		if _, err := s.Sign(signer.SignRequest{Request: string(csrPEM), Serial: bad}); err == nil {
+			t.Errorf("expected requested serial %v to be rejected", bad)
+		}
+	}
+}
+
+func TestSerialStrategy(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	profile := &config.SigningProfile{
+		Usage:          []string{"signing", "server auth"},
+		ExpiryString:   "1h",
+		Expiry:         1 * time.Hour,
+		SerialStrategy: config.SerialSequential,
+	}
+	s.policy = &config.Signing{Default: profile}
+
+	if _, err = s.Sign(signer.SignRequest{Request: string(csrPEM)}); err == nil {
+		t.Fatal("expected sequential serials to require a certificate database")
+	}
+
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	s.SetDBAccessor(sql.NewAccessor(db))
+	for want := int64(1); want <= 3; want++ {
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SerialNumber.Int64() != want {
+			t.Fatalf("expected serial %d, got %v", want, cert.SerialNumber)
+		}
+	}
+
+	profile.SerialStrategy = config.SerialRequested
+	profile.ClientProvidesSerialNumbers = true
+	if _, err = s.Sign(signer.SignRequest{Request: string(csrPEM)}); err == nil {
+		t.Fatal("expected a request without a serial to be rejected")
+	}
+	_, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Serial: big.NewInt(2)})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.CertificateError)+int(cferr.DuplicateSerial) {
+		t.Fatalf("expected a duplicate serial error, got %v", err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM), Serial: big.NewInt(1000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Int64() != 1000 {
+		t.Fatalf("expected serial 1000, got %v", cert.SerialNumber)
+	}
+}
+
+func TestSubjectInfoAccessSign(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	descriptions := []config.AccessDescription{
+		{Method: config.OID{1, 3, 6, 1, 5, 5, 7, 48, 5}, Location: "rsync://repo.example.com/ca/"},
+		{Method: config.OID{1, 3, 6, 1, 5, 5, 7, 48, 3}, Location: "http://tsa.example.com/"},
+	}
+	s.policy = &config.Signing{Default: &config.SigningProfile{
+		Usage:             []string{"signing", "timestamping"},
+		ExpiryString:      "1h",
+		Expiry:            1 * time.Hour,
+		SubjectInfoAccess: descriptions,
+	}}
+
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(signer.SubjectInfoAccessOID) {
+			continue
+		}
+		found = true
+		var sia []struct {
+			Method   asn1.ObjectIdentifier
+			Location asn1.RawValue
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &sia); err != nil {
+			t.Fatal(err)
+		}
+		if len(sia) != len(descriptions) {
+			t.Fatalf("expected %d access descriptions, got %d", len(descriptions), len(sia))
+		}
+		for i, ad := range sia {
+			if !ad.Method.Equal(asn1.ObjectIdentifier(descriptions[i].Method)) {
+				t.Errorf("access description %d: expected method %v, got %v", i, descriptions[i].Method, ad.Method)
+			}
+			if ad.Location.Class != asn1.ClassContextSpecific || ad.Location.Tag != 6 ||
+				string(ad.Location.Bytes) != descriptions[i].Location {
+				t.Errorf("access description %d: unexpected location %+v", i, ad.Location)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("subjectInfoAccess extension missing")
+	}
+}
+
+func TestRSAPSSSign(t *testing.T) {
+	req := &csr.CertificateRequest{
+		CN:         "pss.example.com",
+		Hosts:      []string{"pss.example.com"},
+		KeyRequest: &csr.KeyRequest{A: "rsa", S: 2048},
+		PSS:        true,
+	}
+	csrPEM, _, err := csr.ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := &config.SigningProfile{
+		Usage:        []string{"signing", "server auth"},
+		ExpiryString: "1h",
+		Expiry:       1 * time.Hour,
+		RSAPSS:       true,
+	}
+
+	// A PSS-signed CSR is accepted, and signed with PSS when the
+	// profile asks for it.
+	s := newTestSigner(t)
+	s.policy = &config.Signing{Default: profile}
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+		t.Fatalf("expected a SHA256WithRSAPSS signature, got %v", cert.SignatureAlgorithm)
+	}
+	if err = cert.CheckSignatureFrom(s.ca); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{Default: profile}
+	if _, err = s.Sign(signer.SignRequest{Request: string(csrPEM)}); err == nil {
+		t.Fatal("expected rsa_pss with an ECDSA CA to fail")
+	}
+}
+
+func TestOmitSKI(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	for _, omit := range []bool{false, true} {
+		s.policy = &config.Signing{Default: &config.SigningProfile{
+			Usage:        []string{"signing", "server auth"},
+			ExpiryString: "1h",
+			Expiry:       1 * time.Hour,
+			OmitSKI:      omit,
+		}}
+
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found bool
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 14}) {
+				found = true
+			}
+		}
+		if found == omit {
+			t.Errorf("omit_ski %v: expected the subject key identifier to be present: %v, but it was: %v", omit, !omit, found)
+		}
+	}
+}
+
+func TestAnyExtKeyUsage(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{Default: &config.SigningProfile{
+		Usage:        []string{"digital signature", "any"},
+		ExpiryString: "1h",
+		Expiry:       1 * time.Hour,
+	}}
+
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageAny {
+		t.Fatalf("expected only the any extended key usage, got %v", cert.ExtKeyUsage)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 37}) {
+			continue
+		}
+		var oids []asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+			t.Fatal(err)
+		}
+		if len(oids) != 1 || !oids[0].Equal(asn1.ObjectIdentifier{2, 5, 29, 37, 0}) {
+			t.Errorf("expected the extension to hold anyExtendedKeyUsage, got %v", oids)
+		}
+		return
+	}
+	t.Error("expected an extended key usage extension")
+}
+
+func TestAuthorityKeyIDOverride(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profileAKI := "0102030405060708090a0b0c0d0e0f1011121314"
+	requestAKI := "aa:bb:cc:dd:ee:ff:00:11"
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	profile := &config.SigningProfile{
+		Usage:          []string{"signing", "server auth"},
+		ExpiryString:   "1h",
+		Expiry:         1 * time.Hour,
+		AuthorityKeyID: profileAKI,
+	}
+	s.policy = &config.Signing{Default: profile}
+
+	if _, err := s.Sign(signer.SignRequest{Request: string(csrPEM), AuthorityKeyID: requestAKI}); err == nil {
+		t.Fatal("expected a request to be refused an authority key identifier the profile doesn't allow")
+	}
+	profile.AllowAuthorityKeyIDOverride = true
+
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	s.SetDBAccessor(sql.NewAccessor(db))
+	for _, tc := range []struct {
+		requestAKI string
+		want       string
+	}{
+		{"", profileAKI},
+		{requestAKI, "aabbccddeeff0011"},
+	} {
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM), AuthorityKeyID: tc.requestAKI})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(cert.AuthorityKeyId); got != tc.want {
+			t.Errorf("expected authority key identifier %s, got %s", tc.want, got)
+		}
+		if bytes.Equal(cert.AuthorityKeyId, s.ca.SubjectKeyId) {
+			t.Error("expected the authority key identifier not to be derived from the CA")
+		}
+		records, err := s.dbAccessor.GetCertificate(cert.SerialNumber.String(), hex.EncodeToString(s.ca.SubjectKeyId))
+		if err != nil || len(records) != 1 {
+			t.Errorf("expected the certificate to be recorded under the CA's SKI, got %v, %v", records, err)
+		}
+	}
+
+	if _, err := s.Sign(signer.SignRequest{Request: string(csrPEM), AuthorityKeyID: "0102"}); err == nil {
+		t.Error("expected a too short authority key identifier to be rejected")
+	}
+}
+
+func TestIssuerAltName(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caURI, _ := url.Parse("https://ca.example.com")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Cross CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"ca.example.com"},
+		URIs:                  []*url.URL{caURI},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(ian config.IssuerAltName) *x509.Certificate {
+		s, err := NewSigner(caKey, caCert, x509.ECDSAWithSHA256, &config.Signing{Default: &config.SigningProfile{
+			Usage:         []string{"signing", "server auth"},
+			ExpiryString:  "1h",
+			Expiry:        1 * time.Hour,
+			IssuerAltName: ian,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	issuerAltNames := func(cert *x509.Certificate) []asn1.RawValue {
+		for _, ext := range cert.Extensions {
+			if !ext.Id.Equal(signer.IssuerAltNameOID) {
+				continue
+			}
+			var names []asn1.RawValue
+			if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+				t.Fatal(err)
+			}
+			return names
+		}
+		return nil
+	}
+
+	if names := issuerAltNames(sign(config.IssuerAltName{})); names != nil {
+		t.Fatalf("expected no issuerAltName extension by default, got %v", names)
+	}
+
+	names := issuerAltNames(sign(config.IssuerAltName{
+		CopyFromCA: true,
+		Names:      []string{"ca@example.com", "10.0.0.1"},
+	}))
+	expected := []struct {
+		tag   int
+		value string
+	}{
+		{1, "ca@example.com"},
+		{2, "ca.example.com"},
+		{6, "https://ca.example.com"},
+		{7, string(net.IPv4(10, 0, 0, 1).To4())},
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %d issuer alternative names, got %d", len(expected), len(names))
+	}
+	for i, name := range names {
+		if name.Class != asn1.ClassContextSpecific || name.Tag != expected[i].tag || string(name.Bytes) != expected[i].value {
+			t.Errorf("issuer alternative name %d: expected [%d] %q, got [%d] %q",
+				i, expected[i].tag, expected[i].value, name.Tag, name.Bytes)
+		}
+	}
+}
+
+func TestSignMetrics(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{Default: &config.SigningProfile{
+		Usage:        []string{"signing", "server auth"},
+		ExpiryString: "1h",
+		Expiry:       1 * time.Hour,
+	}}
+
+	signCount := func() uint64 {
+		var m dto.Metric
+		if err := metrics.SignDuration.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	issued := testutil.ToFloat64(metrics.CertificatesIssued.WithLabelValues("default"))
+	observed := signCount()
+	if _, err := s.Sign(signer.SignRequest{Request: string(csrPEM)}); err != nil {
+		t.Fatal(err)
+	}
+	if testutil.ToFloat64(metrics.CertificatesIssued.WithLabelValues("default")) != issued+1 {
+		t.Error("issued certificate not counted")
+	}
+
+	_, err = s.Sign(signer.SignRequest{Request: "not a CSR"})
+	if err == nil {
+		t.Fatal("expected signing an invalid CSR to fail")
+	}
+	if testutil.ToFloat64(metrics.SignErrors.WithLabelValues(metrics.ErrorReason(err))) == 0 {
+		t.Error("sign error not counted")
+	}
+	if signCount() != observed+2 {
+		t.Error("sign latency not observed")
+	}
+}
+
+func TestStripExtensions(t *testing.T) {
+	forbidden := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 17}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "strip.example.com"},
+		DNSNames:        []string{"strip.example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: forbidden, Value: []byte{0x05, 0x00}}},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	hasExtension := func(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oid) {
+				return true
+			}
+		}
+		return false
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	for _, strip := range []bool{false, true} {
+		profile := `{"usages": ["signing", "server auth"], "expiry": "1h", "copy_extensions": true`
+		if strip {
+			profile += `, "strip_extensions": ["1.3.6.1.4.1.99999.17", "2.5.29.17"]`
+		}
+		cfg, err := config.LoadConfig([]byte(`{"signing": {"default": ` + profile + `}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.policy = cfg.Signing
+
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasExtension(cert, forbidden) == strip {
+			t.Errorf("strip %v: unexpected presence of the requested extension", strip)
+		}
+		if (len(cert.DNSNames) == 0) != strip {
+			t.Errorf("strip %v: unexpected subject alternative names %v", strip, cert.DNSNames)
+		}
+
+		// The precertificate is stripped as well.
+		precertPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM), ReturnPrecert: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		precert, err := helpers.ParseCertificatePEM(precertPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasExtension(precert, forbidden) == strip {
+			t.Errorf("strip %v: unexpected presence of the requested extension in the precertificate", strip)
+		}
+		if !hasExtension(precert, signer.CTPoisonOID) {
+			t.Errorf("strip %v: the precertificate isn't poisoned", strip)
+		}
+	}
+}
+
+func TestProfileExtensions(t *testing.T) {
+	custom := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 18}
+	cfg, err := config.LoadConfig([]byte(`{"signing": {"default": {"usages": ["signing", "server auth"], "expiry": "1h",
+		"allowed_extensions": ["1.3.6.1.4.1.99999.18"], "must_staple": true,
+		"extensions": [{"id": "1.3.6.1.4.1.99999.18", "critical": true, "value": "AQH/"}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = cfg.Signing
+
+	csrPEM, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The profile's extension replaces the one of the request.
+	certPEM, err := s.Sign(signer.SignRequest{
+		Request:    string(csrPEM),
+		Extensions: []signer.Extension{{ID: config.OID(custom), Value: "0500"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found int
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(custom) {
+			found++
+			if !ext.Critical || !bytes.Equal(ext.Value, []byte{0x01, 0x01, 0xff}) {
+				t.Errorf("unexpected extension %+v", ext)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("expected the certificate to carry the profile's extension once, found it %d times", found)
+	}
+	if !signer.HasMustStaple(cert) {
+		t.Error("expected the certificate to carry the TLS Feature extension")
+	}
+}
+
+func TestCSRExtensionWhitelist(t *testing.T) {
+	allowed := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 19}
+	dropped := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 20}
+	// A subjectAltName with a dNSName and an otherName, which
+	// crypto/x509 can't carry.
+	san, err := csr.MarshalGeneralNames([]string{"device.example.com"}, nil, nil, nil,
+		[]csr.OtherName{{Type: "1.3.6.1.4.1.99999.21", Value: "device.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCSR := func(san []byte) string {
+		csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device.example.com"},
+			ExtraExtensions: []pkix.Extension{
+				{Id: allowed, Critical: true, Value: []byte{0x04, 0x02, 0x12, 0x34}},
+				{Id: dropped, Value: []byte{0x05, 0x00}},
+				{Id: csr.SubjectAltNameOID, Value: san},
+			},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+	}
+	csrPEM := newCSR(san)
+
+	extension := func(cert *x509.Certificate, oid asn1.ObjectIdentifier) *pkix.Extension {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oid) {
+				return &ext
+			}
+		}
+		return nil
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	for _, csrWhitelist := range []string{"", `, "csr_whitelist": {"subject": true, "public_key": true, "public_key_algorithm": true}`} {
+		cfg, err := config.LoadConfig([]byte(`{"signing": {"default": {"usages": ["signing", "server auth"], "expiry": "1h",
+			"name_whitelist": "\\.example\\.com$", "csr_extension_whitelist": ["1.3.6.1.4.1.99999.19", "2.5.29.17"]` + csrWhitelist + `}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.policy = cfg.Signing
+
+		certPEM, err := s.Sign(signer.SignRequest{Request: csrPEM})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ext := extension(cert, allowed); ext == nil || !ext.Critical || !bytes.Equal(ext.Value, []byte{0x04, 0x02, 0x12, 0x34}) {
+			t.Errorf("expected the whitelisted extension to be copied, got %+v", ext)
+		}
+		if extension(cert, dropped) != nil {
+			t.Error("expected the other extension of the CSR to be dropped")
+		}
+		if ext := extension(cert, csr.SubjectAltNameOID); ext == nil || !bytes.Equal(ext.Value, san) {
+			t.Errorf("expected the subject alternative name to be copied as is, got %+v", ext)
+		}
+
+		// The hosts of the request replace the names of the CSR.
+		certPEM, err = s.Sign(signer.SignRequest{Request: csrPEM, Hosts: []string{"www.example.com"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.example.com" {
+			t.Errorf("expected the hosts of the request, got %v", cert.DNSNames)
+		}
+		if extension(cert, allowed) == nil {
+			t.Error("expected the whitelisted extension to be copied")
+		}
+	}
+
+	// A registeredID can't be checked against the name whitelist, so a
+	// subject alternative name holding one isn't copied.
+	registeredID, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("device.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 8, Bytes: []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0x86, 0x8d, 0x1f, 0x15}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Sign(signer.SignRequest{Request: newCSR(registeredID)}); err == nil {
+		t.Error("expected a subject alternative name holding a registeredID to be rejected")
+	}
+	if _, err = s.Sign(signer.SignRequest{Request: newCSR(registeredID), Hosts: []string{"www.example.com"}}); err != nil {
+		t.Errorf("expected the hosts of the request to replace the registeredID: %v", err)
+	}
+
+	// The names of a copied subject alternative name must pass the name
+	// whitelist.
+	cfg, err := config.LoadConfig([]byte(`{"signing": {"default": {"usages": ["signing", "server auth"], "expiry": "1h",
+		"name_whitelist": "^device\\.example\\.org$", "csr_extension_whitelist": ["2.5.29.17"],
+		"csr_whitelist": {"subject": true, "public_key": true, "public_key_algorithm": true}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.policy = cfg.Signing
+	if _, err = s.Sign(signer.SignRequest{Request: csrPEM, Subject: &signer.Subject{CN: "device.example.org"}}); err == nil {
+		t.Error("expected the names of the copied subject alternative name to be checked against the name whitelist")
+	}
+}
+
+func TestSignLogsRequestFields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	stdlog.SetOutput(buf)
+	defer stdlog.SetOutput(os.Stderr)
+	defer func(level int) { log.Level = level }(log.Level)
+	log.Level = log.LevelDebug
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	csrPEM, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := signer.SignRequest{Request: string(csrPEM), Logger: log.With(log.RequestIDKey, "abc")}
+	if _, err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`signed certificate with serial number \d+ request_id=abc`).Match(buf.Bytes()) {
+		t.Fatalf("expected the request ID in the signer's log lines, got %q", buf.String())
+	}
+}
+
+func TestAllowedKeyAlgorithms(t *testing.T) {
+	cfg, err := config.LoadConfig([]byte(`{"signing": {"default": {"usages": ["signing", "server auth"], "expiry": "1h", "allowed_key_algorithms": ["ecdsa"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = cfg.Signing
+
+	ecdsaCSR, err := ioutil.ReadFile("testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(signer.SignRequest{Request: string(ecdsaCSR)}); err != nil {
+		t.Fatalf("expected an ECDSA CSR to be signed: %v", err)
+	}
+
+	rsaCSR, err := ioutil.ReadFile("testdata/rsa2048.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Sign(signer.SignRequest{Request: string(rsaCSR)})
+	if err == nil {
+		t.Fatal("expected an RSA CSR to be rejected by an ECDSA only profile")
+	}
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PolicyError)+int(cferr.UnmatchedWhitelist) {
+		t.Fatalf("expected an unmatched whitelist policy error, got %v", err)
+	}
+}
+
+func TestCapExpiryAtCA(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Short-lived CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour).Truncate(time.Second),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(allowOutlivingCA bool) *x509.Certificate {
+		s, err := NewSigner(caKey, caCert, x509.ECDSAWithSHA256, &config.Signing{Default: &config.SigningProfile{
+			Usage:            []string{"signing", "server auth"},
+			ExpiryString:     "8760h",
+			Expiry:           8760 * time.Hour,
+			AllowOutlivingCA: allowOutlivingCA,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPEM, err := s.Sign(signer.SignRequest{
+			Request:  string(csrPEM),
+			NotAfter: time.Now().Add(48 * time.Hour).Truncate(time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	if cert := sign(false); !cert.NotAfter.Equal(caCert.NotAfter) {
+		t.Fatalf("expected NotAfter to be capped at the CA's %s, got %s", caCert.NotAfter, cert.NotAfter)
+	}
+	if cert := sign(true); !cert.NotAfter.After(caCert.NotAfter) {
+		t.Fatalf("expected NotAfter to outlive the CA's %s, got %s", caCert.NotAfter, cert.NotAfter)
+	}
+}
+
+func TestOtherNamesSign(t *testing.T) {
+	upn := csr.OtherName{Type: "upn", Value: "jdoe@corp.example.com"}
+	req := &csr.CertificateRequest{
+		CN:         "Jane Doe",
+		Hosts:      []string{"jdoe.example.com"},
+		URIs:       []string{"spiffe://example.com/jdoe"},
+		OtherNames: []csr.OtherName{upn},
+		KeyRequest: &csr.KeyRequest{A: "ecdsa", S: 256},
+	}
+	csrPEM, _, err := csr.ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(whitelist *config.CSRWhitelist, hosts []string) *x509.Certificate {
+		s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+		s.policy = &config.Signing{Default: &config.SigningProfile{
+			Usage:        []string{"digital signature", "client auth"},
+			ExpiryString: "1h",
+			Expiry:       1 * time.Hour,
+			CSRWhitelist: whitelist,
+		}}
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM), Hosts: hosts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	cert := sign(nil, nil)
+	otherNames, err := csr.OtherNames(cert.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(otherNames) != 1 || otherNames[0] != upn {
+		t.Fatalf("expected the UPN to be carried through, got %v", otherNames)
+	}
+	if len(cert.DNSNames) != 1 || len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://example.com/jdoe" {
+		t.Fatalf("unexpected SANs %v %v", cert.DNSNames, cert.URIs)
+	}
+
+	whitelist := &config.CSRWhitelist{Subject: true, PublicKey: true, PublicKeyAlgorithm: true, SignatureAlgorithm: true, DNSNames: true}
+	for _, cert := range []*x509.Certificate{sign(whitelist, nil), sign(nil, []string{"other.example.com"})} {
+		if otherNames, _ := csr.OtherNames(cert.Extensions); len(otherNames) != 0 {
+			t.Fatalf("unexpected otherNames %v", otherNames)
+		}
+		if len(cert.DNSNames) != 1 || len(cert.URIs) != 0 {
+			t.Fatalf("unexpected SANs %v %v", cert.DNSNames, cert.URIs)
+		}
+	}
+
+	whitelist.OtherNames = true
+	if otherNames, _ := csr.OtherNames(sign(whitelist, nil).Extensions); len(otherNames) != 1 {
+		t.Fatalf("expected the whitelisted UPN, got %v", otherNames)
+	}
+}
+
+func TestCrossSign(t *testing.T) {
+	newRoot := func(cn string, maxPathLen int, exts []pkix.Extension) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: cn, Organization: []string{"CFSSL"}},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            maxPathLen,
+			PermittedDNSDomains:   []string{"example.com"},
+			ExtraExtensions:       exts,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+
+	private := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 1}, Value: []byte{0x02, 0x01, 0x00}}
+	oldRoot, oldKey := newRoot("Old Root", 1, []pkix.Extension{private})
+	newCA, newKey := newRoot("New Root", -1, nil)
+
+	profile := &config.SigningProfile{
+		Usage:        []string{"cert sign", "crl sign"},
+		ExpiryString: "12h",
+		Expiry:       12 * time.Hour,
+		CAConstraint: config.CAConstraint{IsCA: true},
+		OCSP:         "http://ocsp.example.com",
+	}
+	s, err := NewSigner(newKey, newCA, x509.ECDSAWithSHA256, &config.Signing{Default: profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := s.CrossSign(oldRoot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cross.RawSubject, oldRoot.RawSubject) || !bytes.Equal(cross.RawSubjectPublicKeyInfo, oldRoot.RawSubjectPublicKeyInfo) {
+		t.Fatal("expected the subject and subject key to be kept")
+	}
+	if !bytes.Equal(cross.RawIssuer, newCA.RawSubject) || !bytes.Equal(cross.AuthorityKeyId, newCA.SubjectKeyId) {
+		t.Fatal("expected the new root to be the issuer")
+	}
+	if err = cross.CheckSignatureFrom(newCA); err != nil {
+		t.Fatal(err)
+	}
+	if cross.SerialNumber.Cmp(oldRoot.SerialNumber) == 0 {
+		t.Fatal("expected a new serial number")
+	}
+	if !bytes.Equal(cross.SubjectKeyId, oldRoot.SubjectKeyId) || cross.MaxPathLen != 1 ||
+		!reflect.DeepEqual(cross.PermittedDNSDomains, oldRoot.PermittedDNSDomains) {
+		t.Fatal("expected the SKI and the constraints to be kept")
+	}
+	kept := false
+	for _, ext := range cross.Extensions {
+		kept = kept || (ext.Id.Equal(private.Id) && bytes.Equal(ext.Value, private.Value))
+	}
+	if !kept {
+		t.Fatal("expected unknown extensions to be kept")
+	}
+	if lifetime := cross.NotAfter.Sub(cross.NotBefore); lifetime != 12*time.Hour {
+		t.Fatalf("expected the profile's validity, got %s", lifetime)
+	}
+	if len(cross.OCSPServer) != 1 || cross.OCSPServer[0] != profile.OCSP {
+		t.Fatalf("expected the profile's OCSP server, got %v", cross.OCSPServer)
+	}
+
+	// A certificate issued by the old root chains to the new one through
+	// the cross-signed certificate.
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, oldRoot, leafKey.Public(), oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(newCA)
+	intermediates.AddCert(cross)
+	if _, err = leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Fatalf("expected the leaf to chain to the new root: %v", err)
+	}
+
+	leafTemplate := *leaf
+	if _, err = s.CrossSign(&leafTemplate, ""); err == nil {
+		t.Fatal("expected a certificate that is not a CA to be rejected")
+	}
+	profile.CAConstraint.IsCA = false
+	if _, err = s.CrossSign(oldRoot, ""); err == nil {
+		t.Fatal("expected a profile that disallows CA certificates to be rejected")
+	}
+}
+
+func TestPolicyHook(t *testing.T) {
+	var received []signer.PolicyRequest
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req signer.PolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		received = append(received, req)
+		json.NewEncoder(w).Encode(signer.PolicyDecision{Reason: "refused"})
+	}))
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	hook := &config.PolicyHook{URL: ts.URL, Timeout: time.Second, RootCAs: roots}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Hosts: []string{"www.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A hook added by replacing the policy is consulted from then on.
+	s.SetPolicy(&config.Signing{
+		Default: &config.SigningProfile{
+			Usage:        []string{"cert sign"},
+			Expiry:       time.Hour,
+			ExpiryString: "1h",
+			CAConstraint: config.CAConstraint{IsCA: true},
+			PolicyHook:   hook,
+		},
+	})
+	_, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Hosts: []string{"www.example.com"}})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PolicyError)+int(cferr.InvalidRequest) {
+		t.Fatalf("expected the policy hook to refuse the request, got %v", err)
+	}
+	if len(received) != 1 || received[0].CSR.PEM == "" || received[0].CrossSign != nil {
+		t.Fatalf("unexpected policy requests %+v", received)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Other Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            -1,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.CrossSign(root, ""); err == nil {
+		t.Fatal("expected the policy hook to refuse cross-signing")
+	}
+	if len(received) != 2 || received[1].CrossSign == nil || received[1].CrossSign.CommonName != "Other Root" {
+		t.Fatalf("unexpected cross-sign policy request %+v", received[len(received)-1])
+	}
+}
@@ -0,0 +1,726 @@
+// Package pkcs11 implements a crypto.Signer backed by a key held in a
+// PKCS #11 token, such as a hardware security module, and generates such
+// keys inside the token. The private keys never leave the token: they are
+// generated sensitive and non-extractable, and the token only hands out
+// signatures made with them.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	"github.com/miekg/pkcs11"
+)
+
+// Config names a PKCS #11 token and a key in it.
+type Config struct {
+	// Module is the path of the PKCS #11 module of the token.
+	Module string
+	// Token is the label of the token, or empty for the first token
+	// found.
+	Token string
+	// PIN is the user PIN of the token.
+	PIN string
+	// Label is the label of the key.
+	Label string
+	// MaxOperations is the most operations, such as signatures, in
+	// progress on the token at once, each in its own session. It is
+	// DefaultMaxOperations if not set. Keys opened with the same module,
+	// token and PIN share their sessions, and the limit of the first one.
+	MaxOperations int
+}
+
+// DefaultMaxOperations is the most operations in progress on a token at
+// once, if the Config doesn't set it.
+const DefaultMaxOperations = 8
+
+// module is the part of the PKCS #11 API used by this package, as
+// implemented by *pkcs11.Ctx.
+type module interface {
+	GetSlotList(tokenPresent bool) ([]uint, error)
+	GetTokenInfo(slotID uint) (pkcs11.TokenInfo, error)
+	OpenSession(slotID uint, flags uint) (pkcs11.SessionHandle, error)
+	CloseSession(sh pkcs11.SessionHandle) error
+	GetSessionInfo(sh pkcs11.SessionHandle) (pkcs11.SessionInfo, error)
+	Login(sh pkcs11.SessionHandle, userType uint, pin string) error
+	FindObjectsInit(sh pkcs11.SessionHandle, temp []*pkcs11.Attribute) error
+	FindObjects(sh pkcs11.SessionHandle, max int) ([]pkcs11.ObjectHandle, bool, error)
+	FindObjectsFinal(sh pkcs11.SessionHandle) error
+	GetAttributeValue(sh pkcs11.SessionHandle, o pkcs11.ObjectHandle, a []*pkcs11.Attribute) ([]*pkcs11.Attribute, error)
+	GenerateKeyPair(sh pkcs11.SessionHandle, m []*pkcs11.Mechanism, public, private []*pkcs11.Attribute) (pkcs11.ObjectHandle, pkcs11.ObjectHandle, error)
+	SignInit(sh pkcs11.SessionHandle, m []*pkcs11.Mechanism, o pkcs11.ObjectHandle) error
+	Sign(sh pkcs11.SessionHandle, message []byte) ([]byte, error)
+}
+
+var (
+	modulesMu sync.Mutex
+	modules   = map[string]module{}
+)
+
+// openModule loads and initializes the PKCS #11 module at path. A module
+// can only be initialized once in a process, so it is kept for the keys
+// opened later.
+var openModule = func(path string) (module, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	if m, ok := modules[path]; ok {
+		return m, nil
+	}
+
+	ctx := pkcs11.New(path)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: can't load module %s", path)
+	}
+	if err := ctx.Initialize(); err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, err
+	}
+	modules[path] = ctx
+	return ctx, nil
+}
+
+// openSession opens a read-write session on the token of cfg and logs
+// the user in.
+func openSession(m module, cfg *Config) (pkcs11.SessionHandle, error) {
+	slots, err := m.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+	for _, slot := range slots {
+		if cfg.Token != "" {
+			info, err := m.GetTokenInfo(slot)
+			if err != nil {
+				return 0, err
+			}
+			if info.Label != cfg.Token {
+				continue
+			}
+		}
+
+		session, err := m.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return 0, err
+		}
+		err = m.Login(session, pkcs11.CKU_USER, cfg.PIN)
+		if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			m.CloseSession(session)
+			return 0, err
+		}
+		return session, nil
+	}
+	if cfg.Token != "" {
+		return 0, fmt.Errorf("pkcs11: no token labelled %q", cfg.Token)
+	}
+	return 0, errors.New("pkcs11: no token found")
+}
+
+// A pool holds the sessions opened on a token, logged in with a PIN, and
+// limits the operations in progress on it.
+type pool struct {
+	module module
+	cfg    Config
+	key    poolKey
+	// ops holds a value for each operation in progress.
+	ops chan struct{}
+
+	mu   sync.Mutex
+	idle []pkcs11.SessionHandle
+	refs int
+}
+
+// A poolKey names the token and PIN of a pool.
+type poolKey struct {
+	module, token, pin string
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[poolKey]*pool{}
+)
+
+// getPool returns the pool of the token of cfg, creating it if no key
+// opened on the token uses it. It is released by release.
+func getPool(cfg *Config) (*pool, error) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	key := poolKey{cfg.Module, cfg.Token, cfg.PIN}
+	if p, ok := pools[key]; ok {
+		p.refs++
+		return p, nil
+	}
+
+	m, err := openModule(cfg.Module)
+	if err != nil {
+		return nil, err
+	}
+	max := cfg.MaxOperations
+	if max <= 0 {
+		max = DefaultMaxOperations
+	}
+	p := &pool{module: m, cfg: *cfg, key: key, ops: make(chan struct{}, max), refs: 1}
+	pools[key] = p
+	return p, nil
+}
+
+// release closes the sessions of p once the last key using it releases
+// it.
+func (p *pool) release() {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if p.refs--; p.refs > 0 {
+		return
+	}
+	delete(pools, p.key)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, session := range p.idle {
+		p.module.CloseSession(session)
+	}
+	p.idle = nil
+}
+
+// get returns a session for an operation, waiting while the most
+// operations are in progress. Idle sessions are health checked before
+// being reused, and a new session is opened if none is left. The session
+// is given back with put or discard.
+func (p *pool) get() (pkcs11.SessionHandle, error) {
+	p.ops <- struct{}{}
+	for {
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		session := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if p.healthy(session) {
+			return session, nil
+		}
+		p.module.CloseSession(session)
+	}
+
+	session, err := openSession(p.module, &p.cfg)
+	if err != nil {
+		<-p.ops
+		return 0, err
+	}
+	return session, nil
+}
+
+// healthy reports whether session can still be used, logging the user in
+// again if the session was logged out.
+func (p *pool) healthy(session pkcs11.SessionHandle) bool {
+	info, err := p.module.GetSessionInfo(session)
+	if err != nil {
+		log.Debugf("pkcs11: dropping session: %v", err)
+		return false
+	}
+	if info.State == pkcs11.CKS_RW_USER_FUNCTIONS || info.State == pkcs11.CKS_RO_USER_FUNCTIONS {
+		return true
+	}
+	err = p.module.Login(session, pkcs11.CKU_USER, p.cfg.PIN)
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		log.Debugf("pkcs11: dropping session: %v", err)
+		return false
+	}
+	return true
+}
+
+// put gives back a session that can be reused.
+func (p *pool) put(session pkcs11.SessionHandle) {
+	p.mu.Lock()
+	p.idle = append(p.idle, session)
+	p.mu.Unlock()
+	<-p.ops
+}
+
+// discard gives back a session that can't be reused, closing it.
+func (p *pool) discard(session pkcs11.SessionHandle) {
+	p.module.CloseSession(session)
+	<-p.ops
+}
+
+// isSessionError reports whether err is a failure of the session or of a
+// handle, such as after the token was removed or reinitialized, that a
+// new session may not have.
+func isSessionError(err error) bool {
+	switch err {
+	case pkcs11.Error(pkcs11.CKR_SESSION_HANDLE_INVALID),
+		pkcs11.Error(pkcs11.CKR_SESSION_CLOSED),
+		pkcs11.Error(pkcs11.CKR_USER_NOT_LOGGED_IN),
+		pkcs11.Error(pkcs11.CKR_KEY_HANDLE_INVALID),
+		pkcs11.Error(pkcs11.CKR_OBJECT_HANDLE_INVALID),
+		pkcs11.Error(pkcs11.CKR_DEVICE_REMOVED),
+		pkcs11.Error(pkcs11.CKR_TOKEN_NOT_PRESENT):
+		return true
+	}
+	return false
+}
+
+// findObject returns the object matching template, if there is exactly
+// one.
+func findObject(m module, session pkcs11.SessionHandle, template []*pkcs11.Attribute) (pkcs11.ObjectHandle, bool, error) {
+	if err := m.FindObjectsInit(session, template); err != nil {
+		return 0, false, err
+	}
+	objects, _, err := m.FindObjects(session, 2)
+	if finalErr := m.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	switch {
+	case err != nil:
+		return 0, false, err
+	case len(objects) == 0:
+		return 0, false, nil
+	case len(objects) > 1:
+		return 0, false, errors.New("pkcs11: several keys have the same label")
+	}
+	return objects[0], true, nil
+}
+
+// keyTemplate is the template of the key of the given class, type and
+// label.
+func keyTemplate(class, keyType uint, label string) []*pkcs11.Attribute {
+	return []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+}
+
+// Curves are named in CKA_EC_PARAMS by their OID.
+var curveOIDs = map[elliptic.Curve]asn1.ObjectIdentifier{
+	elliptic.P256(): {1, 2, 840, 10045, 3, 1, 7},
+	elliptic.P384(): {1, 3, 132, 0, 34},
+	elliptic.P521(): {1, 3, 132, 0, 35},
+}
+
+// attributes returns the values of the attributes types of the object o,
+// in the order of types.
+func attributes(m module, session pkcs11.SessionHandle, o pkcs11.ObjectHandle, types ...uint) ([][]byte, error) {
+	template := make([]*pkcs11.Attribute, len(types))
+	for i, typ := range types {
+		template[i] = pkcs11.NewAttribute(typ, nil)
+	}
+	attrs, err := m.GetAttributeValue(session, o, template)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(types))
+	for _, attr := range attrs {
+		for i, typ := range types {
+			if attr.Type == typ {
+				values[i] = attr.Value
+			}
+		}
+	}
+	for i, value := range values {
+		if value == nil {
+			return nil, fmt.Errorf("pkcs11: token returned no attribute %#x", types[i])
+		}
+	}
+	return values, nil
+}
+
+// publicKey reads the public key of the pair labelled label, and returns
+// it along with the key type.
+func publicKey(m module, session pkcs11.SessionHandle, label string) (crypto.PublicKey, uint, error) {
+	o, found, err := findObject(m, session, keyTemplate(pkcs11.CKO_PUBLIC_KEY, pkcs11.CKK_RSA, label))
+	if err != nil {
+		return nil, 0, err
+	}
+	if found {
+		values, err := attributes(m, session, o, pkcs11.CKA_MODULUS, pkcs11.CKA_PUBLIC_EXPONENT)
+		if err != nil {
+			return nil, 0, err
+		}
+		e := new(big.Int).SetBytes(values[1])
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, 0, errors.New("pkcs11: RSA public exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(values[0]), E: int(e.Int64())}, pkcs11.CKK_RSA, nil
+	}
+
+	o, found, err = findObject(m, session, keyTemplate(pkcs11.CKO_PUBLIC_KEY, pkcs11.CKK_EC, label))
+	if err != nil {
+		return nil, 0, err
+	}
+	if !found {
+		return nil, 0, fmt.Errorf("pkcs11: no RSA or EC public key labelled %q", label)
+	}
+	values, err := attributes(m, session, o, pkcs11.CKA_EC_PARAMS, pkcs11.CKA_EC_POINT)
+	if err != nil {
+		return nil, 0, err
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(values[0], &oid); err != nil {
+		return nil, 0, fmt.Errorf("pkcs11: unsupported EC parameters: %v", err)
+	}
+	var curve elliptic.Curve
+	for c, curveOID := range curveOIDs {
+		if oid.Equal(curveOID) {
+			curve = c
+		}
+	}
+	if curve == nil {
+		return nil, 0, fmt.Errorf("pkcs11: unsupported curve %v", oid)
+	}
+	// CKA_EC_POINT holds the point DER encoded in an OCTET STRING,
+	// though some tokens return it bare.
+	point := values[1]
+	var inner []byte
+	if rest, err := asn1.Unmarshal(point, &inner); err == nil && len(rest) == 0 {
+		point = inner
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, 0, errors.New("pkcs11: invalid EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, pkcs11.CKK_EC, nil
+}
+
+// A Key is a private key held in a PKCS #11 token. It implements
+// crypto.Signer, the token computing the signatures. Signatures are made
+// concurrently in the sessions of a pool shared by the keys of the token.
+type Key struct {
+	pool    *pool
+	label   string
+	keyType uint
+	pub     crypto.PublicKey
+
+	mu     sync.Mutex
+	handle pkcs11.ObjectHandle
+}
+
+// New opens the key labelled cfg.Label in the token of cfg.
+func New(cfg *Config) (*Key, error) {
+	p, session, err := openPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := openKey(p, session, cfg.Label)
+	if err != nil {
+		p.discard(session)
+		p.release()
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed, cferr.WithClass(cferr.ClassHSM, err))
+	}
+	p.put(session)
+	return k, nil
+}
+
+// openPool returns the pool of the token of cfg and a session of it.
+func openPool(cfg *Config) (*pool, pkcs11.SessionHandle, error) {
+	p, err := getPool(cfg)
+	if err != nil {
+		return nil, 0, cferr.Wrap(cferr.PrivateKeyError, cferr.Unavailable, cferr.WithClass(cferr.ClassHSM, err))
+	}
+	session, err := p.get()
+	if err != nil {
+		p.release()
+		return nil, 0, cferr.Wrap(cferr.PrivateKeyError, cferr.Unavailable, cferr.WithClass(cferr.ClassHSM, err))
+	}
+	return p, session, nil
+}
+
+// openKey returns the Key labelled label, looking it up in session.
+func openKey(p *pool, session pkcs11.SessionHandle, label string) (*Key, error) {
+	pub, keyType, err := publicKey(p.module, session, label)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{pool: p, label: label, keyType: keyType, pub: pub}
+	if k.handle, err = k.findHandle(session); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// findHandle looks the private key of k up in session.
+func (k *Key) findHandle(session pkcs11.SessionHandle) (pkcs11.ObjectHandle, error) {
+	handle, found, err := findObject(k.pool.module, session, keyTemplate(pkcs11.CKO_PRIVATE_KEY, k.keyType, k.label))
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("pkcs11: no private key labelled %q", k.label)
+	}
+	return handle, nil
+}
+
+// GenerateKey generates a key pair labelled cfg.Label in the token of
+// cfg, as requested by kr, and returns its private key. RSA and ECDSA
+// keys are supported. It fails if the token already holds a key with
+// that label.
+func GenerateKey(cfg *Config, kr *csr.KeyRequest) (*Key, error) {
+	mech, pubTemplate, err := keyPairTemplate(kr)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.GenerationFailed, err)
+	}
+	if cfg.Label == "" {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.GenerationFailed, errors.New("pkcs11: the key needs a label"))
+	}
+
+	p, session, err := openPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+	k, err := generateKey(p, session, cfg.Label, mech, pubTemplate)
+	if err != nil {
+		p.discard(session)
+		p.release()
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.GenerationFailed, cferr.WithClass(cferr.ClassHSM, err))
+	}
+	p.put(session)
+	return k, nil
+}
+
+// keyPairTemplate returns the mechanism generating the key pair of kr,
+// and the attributes of its public key that depend on kr.
+func keyPairTemplate(kr *csr.KeyRequest) (*pkcs11.Mechanism, []*pkcs11.Attribute, error) {
+	switch kr.Algo() {
+	case "rsa":
+		if kr.Size() < 2048 {
+			return nil, nil, errors.New("RSA key is too weak")
+		}
+		if kr.Size() > 8192 {
+			return nil, nil, errors.New("RSA key size too large")
+		}
+		return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil), []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, kr.Size()),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		}, nil
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch kr.Size() {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, nil, errors.New("invalid curve")
+		}
+		params, err := asn1.Marshal(curveOIDs[curve])
+		if err != nil {
+			return nil, nil, err
+		}
+		return pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil), []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("key algorithm %q can't be generated in a PKCS #11 token", kr.Algo())
+	}
+}
+
+// generateKey generates a key pair labelled label with mech and returns
+// the Key of its private key, signing in session.
+func generateKey(p *pool, session pkcs11.SessionHandle, label string, mech *pkcs11.Mechanism, pubTemplate []*pkcs11.Attribute) (*Key, error) {
+	m := p.module
+	for _, class := range []uint{pkcs11.CKO_PUBLIC_KEY, pkcs11.CKO_PRIVATE_KEY} {
+		_, found, err := findObject(m, session, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, fmt.Errorf("pkcs11: the token already holds a key labelled %q", label)
+		}
+	}
+
+	pubTemplate = append(pubTemplate,
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+	)
+	privTemplate := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+	}
+	if _, _, err := m.GenerateKeyPair(session, []*pkcs11.Mechanism{mech}, pubTemplate, privTemplate); err != nil {
+		return nil, err
+	}
+	return openKey(p, session, label)
+}
+
+// Public returns the public key of k.
+func (k *Key) Public() crypto.PublicKey {
+	return k.pub
+}
+
+// DigestInfo prefixes of the digests signed with PKCS #1 v1.5, which the
+// CKM_RSA_PKCS mechanism expects to be given.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// The hash mechanisms and mask generation functions of CKM_RSA_PKCS_PSS.
+var pssHashes = map[crypto.Hash][2]uint{
+	crypto.SHA1:   {pkcs11.CKM_SHA_1, pkcs11.CKG_MGF1_SHA1},
+	crypto.SHA224: {pkcs11.CKM_SHA224, pkcs11.CKG_MGF1_SHA224},
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// mechanism returns the mechanism signing digest with k as opts asks,
+// and the input to give it.
+func (k *Key) mechanism(digest []byte, opts crypto.SignerOpts) (*pkcs11.Mechanism, []byte, error) {
+	hash := opts.HashFunc()
+	if hash == 0 || len(digest) != hash.Size() {
+		return nil, nil, fmt.Errorf("pkcs11: digest must be hashed with a supported hash function, got %v", hash)
+	}
+
+	if _, ok := k.pub.(*ecdsa.PublicKey); ok {
+		return pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest, nil
+	}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		params, ok := pssHashes[hash]
+		if !ok {
+			return nil, nil, fmt.Errorf("pkcs11: unsupported hash function %v", hash)
+		}
+		saltLength := pss.SaltLength
+		if saltLength == rsa.PSSSaltLengthAuto || saltLength == rsa.PSSSaltLengthEqualsHash {
+			saltLength = hash.Size()
+		}
+		return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(params[0], params[1], uint(saltLength))), digest, nil
+	}
+	prefix, ok := hashPrefixes[hash]
+	if !ok {
+		return nil, nil, fmt.Errorf("pkcs11: unsupported hash function %v", hash)
+	}
+	return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil), append(append([]byte{}, prefix...), digest...), nil
+}
+
+// Sign has the token sign digest. The rand argument is ignored, the token
+// providing its own randomness. RSA signatures use PSS if opts is a
+// *rsa.PSSOptions and PKCS #1 v1.5 otherwise, and ECDSA signatures are
+// ASN.1 DER encoded, as crypto.Signer requires. If the session or the key
+// handle is lost, for example because the token was reinitialized, the
+// key is looked up again in a new session, logged in again, and the
+// signature retried once. Failures of the token are of the
+// errors.ClassHSM class.
+func (k *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	mech, input, err := k.mechanism(digest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := k.sign(mech, input, false)
+	if isSessionError(err) {
+		log.Warningf("pkcs11: signing with %q failed: %v, retrying in a new session", k.label, err)
+		sig, err = k.sign(mech, input, true)
+	}
+	if err != nil {
+		return nil, cferr.WithClass(cferr.ClassHSM, err)
+	}
+
+	if _, ok := k.pub.(*ecdsa.PublicKey); ok {
+		// CKM_ECDSA returns r and s concatenated.
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, cferr.WithClass(cferr.ClassHSM, errors.New("pkcs11: malformed ECDSA signature"))
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(sig[:len(sig)/2]),
+			new(big.Int).SetBytes(sig[len(sig)/2:]),
+		})
+	}
+	return sig, nil
+}
+
+// sign signs input with mech in a session of the pool of k. With lookup,
+// the key handle is looked up again first.
+func (k *Key) sign(mech *pkcs11.Mechanism, input []byte, lookup bool) ([]byte, error) {
+	session, err := k.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	handle := k.handle
+	k.mu.Unlock()
+	if lookup {
+		if handle, err = k.findHandle(session); err != nil {
+			k.pool.discard(session)
+			return nil, err
+		}
+		k.mu.Lock()
+		k.handle = handle
+		k.mu.Unlock()
+	}
+
+	m := k.pool.module
+	err = m.SignInit(session, []*pkcs11.Mechanism{mech}, handle)
+	var sig []byte
+	if err == nil {
+		sig, err = m.Sign(session, input)
+	}
+	if isSessionError(err) {
+		k.pool.discard(session)
+	} else {
+		k.pool.put(session)
+	}
+	return sig, err
+}
+
+// Close releases the sessions of k. The key can't be used afterwards.
+func (k *Key) Close() error {
+	k.pool.release()
+	return nil
+}
+
+// NewSigner returns a local signer issuing certificates as the CA
+// certificate of caFile, with its key held in the token of cfg.
+func NewSigner(caFile string, policy *config.Signing, cfg *Config) (signer.Signer, error) {
+	ca, err := helpers.ReadBytes(caFile)
+	if err != nil {
+		return nil, err
+	}
+	parsedCA, err := helpers.ParseCertificatePEM(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := local.NewSigner(key, parsedCA, signer.DefaultSigAlgo(key), policy)
+	if err != nil {
+		key.Close()
+		return nil, err
+	}
+	return s, nil
+}
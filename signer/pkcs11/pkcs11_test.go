@@ -0,0 +1,600 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/miekg/pkcs11"
+)
+
+// fakeObject is an object of a fakeModule: its attributes and, for a
+// private key, the key.
+type fakeObject struct {
+	attrs map[uint][]byte
+	key   crypto.Signer
+}
+
+// fakeSession is the state of a session of a fakeModule.
+type fakeSession struct {
+	loggedIn bool
+	find     []*pkcs11.Attribute
+	mech     *pkcs11.Mechanism
+	signKey  pkcs11.ObjectHandle
+}
+
+// fakeModule is a token holding its keys in memory.
+type fakeModule struct {
+	mu          sync.Mutex
+	label       string
+	pin         string
+	removed     bool
+	objects     map[pkcs11.ObjectHandle]*fakeObject
+	next        pkcs11.ObjectHandle
+	sessions    map[pkcs11.SessionHandle]*fakeSession
+	nextSession pkcs11.SessionHandle
+	// signing is the number of signatures in progress, and maxSigning
+	// the most there were at once.
+	signing, maxSigning int
+}
+
+func newFakeModule() *fakeModule {
+	return &fakeModule{
+		label:    "test",
+		pin:      "1234",
+		objects:  map[pkcs11.ObjectHandle]*fakeObject{},
+		sessions: map[pkcs11.SessionHandle]*fakeSession{},
+	}
+}
+
+// reinit closes all sessions and gives the objects new handles, as
+// reinitializing the token does.
+func (m *fakeModule) reinit() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions = map[pkcs11.SessionHandle]*fakeSession{}
+	objects := map[pkcs11.ObjectHandle]*fakeObject{}
+	for _, o := range m.objects {
+		m.next++
+		objects[m.next] = o
+	}
+	m.objects = objects
+}
+
+// logout logs all sessions out.
+func (m *fakeModule) logout() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, session := range m.sessions {
+		session.loggedIn = false
+	}
+}
+
+// object returns the attributes of the object of the given class and
+// label.
+func (m *fakeModule) object(class uint, label string) map[uint][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.objects {
+		if bytes.Equal(o.attrs[pkcs11.CKA_CLASS], pkcs11.NewAttribute(pkcs11.CKA_CLASS, class).Value) &&
+			string(o.attrs[pkcs11.CKA_LABEL]) == label {
+			return o.attrs
+		}
+	}
+	return nil
+}
+
+// session returns the session sh, which must be open and, with login,
+// logged in.
+func (m *fakeModule) session(sh pkcs11.SessionHandle, login bool) (*fakeSession, error) {
+	session, ok := m.sessions[sh]
+	if !ok {
+		return nil, pkcs11.Error(pkcs11.CKR_SESSION_HANDLE_INVALID)
+	}
+	if login && !session.loggedIn {
+		return nil, pkcs11.Error(pkcs11.CKR_USER_NOT_LOGGED_IN)
+	}
+	return session, nil
+}
+
+func (m *fakeModule) GetSlotList(tokenPresent bool) ([]uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.removed {
+		return nil, nil
+	}
+	return []uint{1}, nil
+}
+
+func (m *fakeModule) GetTokenInfo(slotID uint) (pkcs11.TokenInfo, error) {
+	return pkcs11.TokenInfo{Label: m.label}, nil
+}
+
+func (m *fakeModule) OpenSession(slotID uint, flags uint) (pkcs11.SessionHandle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextSession++
+	m.sessions[m.nextSession] = &fakeSession{}
+	return m.nextSession, nil
+}
+
+func (m *fakeModule) CloseSession(sh pkcs11.SessionHandle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.session(sh, false); err != nil {
+		return err
+	}
+	delete(m.sessions, sh)
+	return nil
+}
+
+func (m *fakeModule) GetSessionInfo(sh pkcs11.SessionHandle) (pkcs11.SessionInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := m.session(sh, false)
+	if err != nil {
+		return pkcs11.SessionInfo{}, err
+	}
+	if session.loggedIn {
+		return pkcs11.SessionInfo{State: pkcs11.CKS_RW_USER_FUNCTIONS}, nil
+	}
+	return pkcs11.SessionInfo{State: pkcs11.CKS_RW_PUBLIC_SESSION}, nil
+}
+
+func (m *fakeModule) Login(sh pkcs11.SessionHandle, userType uint, pin string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := m.session(sh, false)
+	if err != nil {
+		return err
+	}
+	if pin != m.pin {
+		return pkcs11.Error(pkcs11.CKR_PIN_INCORRECT)
+	}
+	session.loggedIn = true
+	return nil
+}
+
+func (m *fakeModule) FindObjectsInit(sh pkcs11.SessionHandle, temp []*pkcs11.Attribute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := m.session(sh, true)
+	if err != nil {
+		return err
+	}
+	session.find = temp
+	return nil
+}
+
+func (m *fakeModule) FindObjects(sh pkcs11.SessionHandle, max int) ([]pkcs11.ObjectHandle, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := m.session(sh, true)
+	if err != nil {
+		return nil, false, err
+	}
+	var found []pkcs11.ObjectHandle
+	for h := pkcs11.ObjectHandle(1); h <= m.next; h++ {
+		o, ok := m.objects[h]
+		if !ok {
+			continue
+		}
+		matches := true
+		for _, attr := range session.find {
+			if !bytes.Equal(o.attrs[attr.Type], attr.Value) {
+				matches = false
+			}
+		}
+		if matches && len(found) < max {
+			found = append(found, h)
+		}
+	}
+	return found, false, nil
+}
+
+func (m *fakeModule) FindObjectsFinal(sh pkcs11.SessionHandle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := m.session(sh, true)
+	if err != nil {
+		return err
+	}
+	session.find = nil
+	return nil
+}
+
+func (m *fakeModule) GetAttributeValue(sh pkcs11.SessionHandle, o pkcs11.ObjectHandle, a []*pkcs11.Attribute) ([]*pkcs11.Attribute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.session(sh, true); err != nil {
+		return nil, err
+	}
+	object, ok := m.objects[o]
+	if !ok {
+		return nil, pkcs11.Error(pkcs11.CKR_OBJECT_HANDLE_INVALID)
+	}
+	var attrs []*pkcs11.Attribute
+	for _, attr := range a {
+		value, ok := object.attrs[attr.Type]
+		if !ok {
+			return nil, pkcs11.Error(pkcs11.CKR_ATTRIBUTE_TYPE_INVALID)
+		}
+		attrs = append(attrs, &pkcs11.Attribute{Type: attr.Type, Value: value})
+	}
+	return attrs, nil
+}
+
+func (m *fakeModule) add(template []*pkcs11.Attribute, key crypto.Signer) pkcs11.ObjectHandle {
+	o := &fakeObject{attrs: map[uint][]byte{}, key: key}
+	for _, attr := range template {
+		o.attrs[attr.Type] = attr.Value
+	}
+	m.next++
+	m.objects[m.next] = o
+	return m.next
+}
+
+func (m *fakeModule) GenerateKeyPair(sh pkcs11.SessionHandle, mechs []*pkcs11.Mechanism, public, private []*pkcs11.Attribute) (pkcs11.ObjectHandle, pkcs11.ObjectHandle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.session(sh, true); err != nil {
+		return 0, 0, err
+	}
+	attrs := map[uint][]byte{}
+	for _, attr := range public {
+		attrs[attr.Type] = attr.Value
+	}
+
+	var key crypto.Signer
+	var keyType uint
+	switch mechs[0].Mechanism {
+	case pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN:
+		bits := new(big.Int).SetBytes(reverse(attrs[pkcs11.CKA_MODULUS_BITS]))
+		rsaKey, err := rsa.GenerateKey(rand.Reader, int(bits.Int64()))
+		if err != nil {
+			return 0, 0, err
+		}
+		key, keyType = rsaKey, pkcs11.CKK_RSA
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, rsaKey.N.Bytes()),
+		)
+	case pkcs11.CKM_EC_KEY_PAIR_GEN:
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attrs[pkcs11.CKA_EC_PARAMS], &oid); err != nil {
+			return 0, 0, err
+		}
+		var curve elliptic.Curve
+		for c, curveOID := range curveOIDs {
+			if oid.Equal(curveOID) {
+				curve = c
+			}
+		}
+		ecKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return 0, 0, err
+		}
+		point, _ := asn1.Marshal(elliptic.Marshal(curve, ecKey.X, ecKey.Y))
+		key, keyType = ecKey, pkcs11.CKK_EC
+		public = append(public, pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, point))
+	default:
+		return 0, 0, pkcs11.Error(pkcs11.CKR_MECHANISM_INVALID)
+	}
+	private = append(private, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, keyType))
+	return m.add(public, nil), m.add(private, key), nil
+}
+
+// reverse returns the big-endian form of a little-endian CK_ULONG.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func (m *fakeModule) SignInit(sh pkcs11.SessionHandle, mechs []*pkcs11.Mechanism, o pkcs11.ObjectHandle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, err := m.session(sh, true)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.objects[o]; !ok {
+		return pkcs11.Error(pkcs11.CKR_KEY_HANDLE_INVALID)
+	}
+	session.mech, session.signKey = mechs[0], o
+	return nil
+}
+
+func (m *fakeModule) Sign(sh pkcs11.SessionHandle, message []byte) ([]byte, error) {
+	m.mu.Lock()
+	session, err := m.session(sh, true)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	key, mech := m.objects[session.signKey].key, session.mech.Mechanism
+	if m.signing++; m.signing > m.maxSigning {
+		m.maxSigning = m.signing
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.signing--
+		m.mu.Unlock()
+	}()
+	// Give the other signatures in progress time to start.
+	time.Sleep(time.Millisecond)
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		switch mech {
+		case pkcs11.CKM_RSA_PKCS:
+			// The DigestInfo is already prefixed to the message.
+			return rsa.SignPKCS1v15(rand.Reader, key, 0, message)
+		case pkcs11.CKM_RSA_PKCS_PSS:
+			return rsa.SignPSS(rand.Reader, key, crypto.SHA256, message, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PrivateKey:
+		if mech == pkcs11.CKM_ECDSA {
+			r, s, err := ecdsa.Sign(rand.Reader, key, message)
+			if err != nil {
+				return nil, err
+			}
+			size := (key.Curve.Params().BitSize + 7) / 8
+			sig := make([]byte, 2*size)
+			rBytes, sBytes := r.Bytes(), s.Bytes()
+			copy(sig[size-len(rBytes):size], rBytes)
+			copy(sig[2*size-len(sBytes):], sBytes)
+			return sig, nil
+		}
+	}
+	return nil, pkcs11.Error(pkcs11.CKR_MECHANISM_INVALID)
+}
+
+// useModule makes the keys opened by the test use m, in pools of their
+// own.
+func useModule(t *testing.T, m module) {
+	open, saved := openModule, pools
+	openModule = func(string) (module, error) { return m, nil }
+	pools = map[poolKey]*pool{}
+	t.Cleanup(func() { openModule, pools = open, saved })
+}
+
+func TestGenerateKey(t *testing.T) {
+	m := newFakeModule()
+	useModule(t, m)
+
+	for _, kr := range []*csr.KeyRequest{{A: "rsa", S: 2048}, {A: "ecdsa", S: 256}, {A: "ecdsa", S: 384}} {
+		label := fmt.Sprintf("%s-%d", kr.A, kr.S)
+		cfg := &Config{Module: "test.so", Token: "test", PIN: "1234", Label: label}
+		key, err := GenerateKey(cfg, kr)
+		if err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+
+		// The private key is kept in the token, and can't be read.
+		attrs := m.object(pkcs11.CKO_PRIVATE_KEY, label)
+		if attrs == nil {
+			t.Fatalf("%s: private key not found", label)
+		}
+		if !bytes.Equal(attrs[pkcs11.CKA_TOKEN], []byte{1}) ||
+			!bytes.Equal(attrs[pkcs11.CKA_SENSITIVE], []byte{1}) ||
+			!bytes.Equal(attrs[pkcs11.CKA_EXTRACTABLE], []byte{0}) {
+			t.Errorf("%s: private key not generated sensitive and non-extractable", label)
+		}
+
+		csrPEM, err := csr.Generate(key, &csr.CertificateRequest{CN: "leaf.example.com"})
+		if err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		req, err := helpers.ParseCSRPEM(csrPEM)
+		if err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		if err = req.CheckSignature(); err != nil {
+			t.Errorf("%s: CSR signed by the token doesn't verify: %v", label, err)
+		}
+		pub, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqPub, _ := x509.MarshalPKIXPublicKey(req.PublicKey)
+		if !bytes.Equal(pub, reqPub) {
+			t.Errorf("%s: CSR doesn't hold the public key of the token", label)
+		}
+
+		if _, err = GenerateKey(cfg, kr); err == nil {
+			t.Errorf("%s: expected a second key with the same label to be refused", label)
+		}
+	}
+}
+
+func TestGenerateKeyInvalid(t *testing.T) {
+	useModule(t, newFakeModule())
+
+	cfg := &Config{Module: "test.so", PIN: "1234", Label: "key"}
+	for _, kr := range []*csr.KeyRequest{{A: "rsa", S: 1024}, {A: "ecdsa", S: 255}, {A: "ed25519"}} {
+		if _, err := GenerateKey(cfg, kr); err == nil {
+			t.Errorf("expected a %s-%d key to be refused", kr.A, kr.S)
+		}
+	}
+
+	cfg.Token = "other"
+	_, err := GenerateKey(cfg, csr.NewKeyRequest())
+	if err == nil {
+		t.Fatal("expected a missing token to be reported")
+	}
+	if cferr.ClassOf(err) != cferr.ClassHSM {
+		t.Errorf("expected a token failure to be of the HSM class, got %v", cferr.ClassOf(err))
+	}
+
+	cfg.Token, cfg.PIN = "test", "0000"
+	if _, err = GenerateKey(cfg, csr.NewKeyRequest()); err == nil || !strings.Contains(err.Error(), "CKR_PIN_INCORRECT") {
+		t.Errorf("expected an incorrect PIN to be reported, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	useModule(t, newFakeModule())
+
+	cfg := &Config{Module: "test.so", PIN: "1234", Label: "rsa-key"}
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected a missing key to be reported")
+	}
+	generated, err := GenerateKey(cfg, &csr.KeyRequest{A: "rsa", S: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	pub := key.Public().(*rsa.PublicKey)
+	if pub.N.Cmp(generated.Public().(*rsa.PublicKey).N) != 0 || pub.E != 65537 {
+		t.Fatal("opened key doesn't match the generated one")
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	sig, err := key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, opts); err != nil {
+		t.Errorf("PSS signature doesn't verify: %v", err)
+	}
+
+	if _, err = key.Sign(rand.Reader, digest[:16], crypto.SHA256); err == nil {
+		t.Error("expected a digest of the wrong size to be refused")
+	}
+}
+
+// signAndVerify signs a message with key and checks the signature.
+func signAndVerify(key *Key) error {
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err = asn1.Unmarshal(sig, &rs); err != nil {
+		return err
+	}
+	if !ecdsa.Verify(key.Public().(*ecdsa.PublicKey), digest[:], rs.R, rs.S) {
+		return errors.New("signature doesn't verify")
+	}
+	return nil
+}
+
+func TestSignConcurrently(t *testing.T) {
+	m := newFakeModule()
+	useModule(t, m)
+
+	cfg := &Config{Module: "test.so", PIN: "1234", Label: "key", MaxOperations: 3}
+	generated, err := GenerateKey(cfg, csr.NewKeyRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer generated.Close()
+	key, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	if key.pool != generated.pool {
+		t.Fatal("expected the keys of a token to share a pool")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key *Key) {
+			defer wg.Done()
+			errs <- signAndVerify(key)
+		}([]*Key{key, generated}[i%2])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m.maxSigning > 3 {
+		t.Errorf("expected at most 3 signatures in progress at once, got %d", m.maxSigning)
+	}
+	if m.maxSigning < 2 {
+		t.Errorf("expected signatures to be made concurrently, got %d at most", m.maxSigning)
+	}
+	if len(m.sessions) > 3 {
+		t.Errorf("expected at most 3 sessions to be opened, got %d", len(m.sessions))
+	}
+
+	key.Close()
+	generated.Close()
+	if len(m.sessions) != 0 {
+		t.Errorf("expected the sessions to be closed with the last key, %d are open", len(m.sessions))
+	}
+}
+
+func TestSignRecovers(t *testing.T) {
+	m := newFakeModule()
+	useModule(t, m)
+
+	key, err := GenerateKey(&Config{Module: "test.so", PIN: "1234", Label: "key"}, csr.NewKeyRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	// An idle session logged out is logged in again.
+	m.logout()
+	if err = signAndVerify(key); err != nil {
+		t.Fatalf("failed to sign after a logout: %v", err)
+	}
+
+	// After the token is reinitialized, the key is looked up again in a
+	// new session.
+	m.reinit()
+	if err = signAndVerify(key); err != nil {
+		t.Fatalf("failed to sign after the token was reinitialized: %v", err)
+	}
+	if len(m.sessions) != 1 {
+		t.Errorf("expected one session to be left open, got %d", len(m.sessions))
+	}
+
+	// While the token is removed, signing fails without the key being
+	// lost.
+	m.reinit()
+	m.removed = true
+	if err = signAndVerify(key); err == nil {
+		t.Fatal("expected signing without the token to fail")
+	} else if cferr.ClassOf(err) != cferr.ClassHSM {
+		t.Errorf("expected a token failure to be of the HSM class, got %v", cferr.ClassOf(err))
+	}
+	m.removed = false
+	if err = signAndVerify(key); err != nil {
+		t.Fatalf("failed to sign once the token is back: %v", err)
+	}
+}
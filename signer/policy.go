@@ -0,0 +1,287 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A PolicyHook decides on sign requests before they are signed. It is
+// handed the request along with its parsed CSR and the profile it names,
+// and returns a PolicyDecision allowing, refusing or amending it.
+type PolicyHook interface {
+	Decide(req *PolicyRequest) (*PolicyDecision, error)
+}
+
+// A PolicyRequest is what a PolicyHook decides on: the profile, label,
+// hosts and subject of a sign request, and its certificate request. When
+// a CA certificate is cross-signed, CSR is empty and CrossSign describes
+// the certificate instead.
+type PolicyRequest struct {
+	Profile   string     `json:"profile"`
+	Label     string     `json:"label,omitempty"`
+	Usages    []string   `json:"usages"`
+	Expiry    string     `json:"expiry,omitempty"`
+	Hosts     []string   `json:"hosts,omitempty"`
+	Subject   *Subject   `json:"subject,omitempty"`
+	CSR       PolicyCSR  `json:"csr"`
+	CrossSign *PolicyCSR `json:"cross_sign,omitempty"`
+}
+
+// A PolicyCSR describes the certificate request of a PolicyRequest, or
+// the certificate it cross-signs, in which case PEM is the certificate.
+type PolicyCSR struct {
+	PEM                string          `json:"pem"`
+	CommonName         string          `json:"common_name"`
+	Subject            string          `json:"subject"`
+	DNSNames           []string        `json:"dns_names,omitempty"`
+	IPAddresses        []string        `json:"ip_addresses,omitempty"`
+	EmailAddresses     []string        `json:"email_addresses,omitempty"`
+	URIs               []string        `json:"uris,omitempty"`
+	OtherNames         []csr.OtherName `json:"other_names,omitempty"`
+	PublicKeyAlgorithm string          `json:"public_key_algorithm"`
+}
+
+// A PolicyDecision is the answer of a PolicyHook. A request is refused
+// unless Allow is set, with Reason as the error message. An allowed
+// request has its hosts replaced by Hosts and its subject by Subject,
+// if they are set.
+type PolicyDecision struct {
+	Allow   bool     `json:"allow"`
+	Reason  string   `json:"reason,omitempty"`
+	Hosts   []string `json:"hosts,omitempty"`
+	Subject *Subject `json:"subject,omitempty"`
+}
+
+// CheckPolicy asks hook to decide on req, a request for profile p named
+// profile, and amends req as decided. An error is returned if the hook
+// refuses the request or can't be consulted, in which case the request
+// must not be signed.
+func CheckPolicy(hook PolicyHook, req *SignRequest, profile string, p *config.SigningProfile) error {
+	block, _ := pem.Decode([]byte(req.Request))
+	if block == nil {
+		return cferr.New(cferr.CSRError, cferr.DecodeFailed)
+	}
+	csrv, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return cferr.Wrap(cferr.CSRError, cferr.ParseFailed, err)
+	}
+	otherNames, err := csr.OtherNames(csrv.Extensions)
+	if err != nil {
+		return cferr.Wrap(cferr.CSRError, cferr.ParseFailed, err)
+	}
+
+	preq := &PolicyRequest{
+		Profile: profile,
+		Label:   req.Label,
+		Usages:  p.Usage,
+		Expiry:  p.ExpiryString,
+		Hosts:   req.Hosts,
+		Subject: req.Subject,
+		CSR: PolicyCSR{
+			PEM:                string(pem.EncodeToMemory(block)),
+			CommonName:         csrv.Subject.CommonName,
+			Subject:            csrv.Subject.String(),
+			DNSNames:           csrv.DNSNames,
+			EmailAddresses:     csrv.EmailAddresses,
+			OtherNames:         otherNames,
+			PublicKeyAlgorithm: csrv.PublicKeyAlgorithm.String(),
+		},
+	}
+	for _, ip := range csrv.IPAddresses {
+		preq.CSR.IPAddresses = append(preq.CSR.IPAddresses, ip.String())
+	}
+	for _, uri := range csrv.URIs {
+		preq.CSR.URIs = append(preq.CSR.URIs, uri.String())
+	}
+
+	decision, err := decide(hook, preq)
+	if err != nil {
+		return err
+	}
+	if decision.Hosts != nil {
+		req.Hosts = decision.Hosts
+	}
+	if decision.Subject != nil {
+		req.Subject = decision.Subject
+	}
+	return nil
+}
+
+// CheckCrossSignPolicy asks hook to decide on cross-signing the CA
+// certificate ca with profile p named profile. A cross-signed certificate
+// keeps the names of ca, so a decision amending them is refused.
+func CheckCrossSignPolicy(hook PolicyHook, ca *x509.Certificate, profile string, p *config.SigningProfile) error {
+	otherNames, err := csr.OtherNames(ca.Extensions)
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+
+	preq := &PolicyRequest{
+		Profile: profile,
+		Usages:  p.Usage,
+		Expiry:  p.ExpiryString,
+		CrossSign: &PolicyCSR{
+			PEM:                string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+			CommonName:         ca.Subject.CommonName,
+			Subject:            ca.Subject.String(),
+			DNSNames:           ca.DNSNames,
+			EmailAddresses:     ca.EmailAddresses,
+			OtherNames:         otherNames,
+			PublicKeyAlgorithm: ca.PublicKeyAlgorithm.String(),
+		},
+	}
+	for _, ip := range ca.IPAddresses {
+		preq.CrossSign.IPAddresses = append(preq.CrossSign.IPAddresses, ip.String())
+	}
+	for _, uri := range ca.URIs {
+		preq.CrossSign.URIs = append(preq.CrossSign.URIs, uri.String())
+	}
+
+	decision, err := decide(hook, preq)
+	if err != nil {
+		return err
+	}
+	if decision.Hosts != nil || decision.Subject != nil {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+			errors.New("the policy hook can't amend the names of a cross-signed certificate"))
+	}
+	return nil
+}
+
+// decide asks hook to decide on req, and returns an error unless the
+// request is allowed.
+func decide(hook PolicyHook, req *PolicyRequest) (*PolicyDecision, error) {
+	decision, err := hook.Decide(req)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.Unknown, fmt.Errorf("policy hook failed: %v", err))
+	}
+	if !decision.Allow {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "the request was refused by the policy hook"
+		}
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest, errors.New(reason))
+	}
+	return decision, nil
+}
+
+// PolicyHooks holds the WebhookPolicy of each policy hook of a signing
+// policy, created when the hook is first consulted, so that its HTTP
+// client is shared between requests. The zero value is ready to use.
+type PolicyHooks struct {
+	mu    sync.Mutex
+	hooks map[*config.PolicyHook]PolicyHook
+}
+
+// hook returns the PolicyHook configured by conf.
+func (h *PolicyHooks) hook(conf *config.PolicyHook) PolicyHook {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hook, ok := h.hooks[conf]
+	if !ok {
+		if h.hooks == nil {
+			h.hooks = map[*config.PolicyHook]PolicyHook{}
+		}
+		hook = NewWebhookPolicy(conf)
+		h.hooks[conf] = hook
+	}
+	return hook
+}
+
+// Reset forgets the hooks consulted so far, for when the signing policy
+// is replaced.
+func (h *PolicyHooks) Reset() {
+	h.mu.Lock()
+	h.hooks = nil
+	h.mu.Unlock()
+}
+
+// Check checks req against the policy hook of p, the profile named
+// profile, if it has one, as CheckPolicy does.
+func (h *PolicyHooks) Check(req *SignRequest, profile string, p *config.SigningProfile) error {
+	if p.PolicyHook == nil {
+		return nil
+	}
+	if err := CheckPolicy(h.hook(p.PolicyHook), req, profile, p); err != nil {
+		log.Warningf("sign request refused by the policy hook of profile %q: %v", profile, err)
+		return err
+	}
+	return nil
+}
+
+// CheckCrossSign checks cross-signing ca against the policy hook of p,
+// the profile named profile, if it has one, as CheckCrossSignPolicy does.
+func (h *PolicyHooks) CheckCrossSign(ca *x509.Certificate, profile string, p *config.SigningProfile) error {
+	if p.PolicyHook == nil {
+		return nil
+	}
+	if err := CheckCrossSignPolicy(h.hook(p.PolicyHook), ca, profile, p); err != nil {
+		log.Warningf("cross-signing refused by the policy hook of profile %q: %v", profile, err)
+		return err
+	}
+	return nil
+}
+
+// maxPolicyDecisionSize bounds the size of the answers of a WebhookPolicy.
+const maxPolicyDecisionSize = 1 << 20
+
+// A WebhookPolicy is a PolicyHook POSTing each PolicyRequest as JSON to
+// an HTTPS endpoint, which must answer with a 200 and a JSON-encoded
+// PolicyDecision.
+type WebhookPolicy struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPolicy returns a WebhookPolicy for the policy hook of a
+// profile.
+func NewWebhookPolicy(hook *config.PolicyHook) *WebhookPolicy {
+	return &WebhookPolicy{
+		url: hook.URL,
+		client: &http.Client{
+			Timeout: hook.Timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: hook.RootCAs},
+			},
+		},
+	}
+}
+
+// Decide asks the endpoint of h to decide on req.
+func (h *WebhookPolicy) Decide(req *PolicyRequest) (*PolicyDecision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxPolicyDecisionSize))
+		return nil, fmt.Errorf("%s answered %s", h.url, resp.Status)
+	}
+
+	var decision PolicyDecision
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxPolicyDecisionSize)).Decode(&decision); err != nil {
+		return nil, fmt.Errorf("malformed answer from %s: %v", h.url, err)
+	}
+	return &decision, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/cloudflare/cfssl/api/client"
 	"github.com/cloudflare/cfssl/certdb"
@@ -12,6 +13,7 @@ import (
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/info"
+	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
 )
 
@@ -20,6 +22,7 @@ import (
 type Signer struct {
 	policy      *config.Signing
 	reqModifier func(*http.Request, []byte)
+	hooks       signer.PolicyHooks
 }
 
 // NewSigner creates a new remote Signer directly from a
@@ -40,8 +43,17 @@ func NewSigner(policy *config.Signing) (*Signer, error) {
 // Sign sends a signature request to the remote CFSSL server,
 // receiving a signed certificate or an error in response. The hostname,
 // csr, and profileName are used as with a local signing operation, and
-// the label is used to select a signing root in a multi-root CA.
+// the label is used to select a signing root in a multi-root CA. The
+// policy hook of the profile, if it has one, is consulted first.
 func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
+	p, err := signer.Profile(s, req.Profile)
+	if err != nil {
+		return
+	}
+	if err = s.hooks.Check(&req, req.Profile, p); err != nil {
+		return
+	}
+
 	resp, err := s.remoteOp(req, req.Profile, "sign")
 	if err != nil {
 		return
@@ -84,21 +96,53 @@ func (s *Signer) remoteOp(req interface{}, profile, target string) (resp interfa
 	}
 
 	server.SetReqModifier(s.reqModifier)
-
-	// There's no auth provider for the "info" method
-	if target == "info" {
-		resp, err = server.Info(jsonData)
-	} else if p.RemoteProvider != nil {
-		resp, err = server.AuthSign(jsonData, nil, p.RemoteProvider)
-	} else {
-		resp, err = server.Sign(jsonData)
+	if p.RemoteTimeout > 0 {
+		server.SetRequestTimeout(p.RemoteTimeout)
 	}
 
-	if err != nil {
-		return nil, err
+	backoff := p.RemoteBackoff
+	for attempt := 0; ; attempt++ {
+		// There's no auth provider for the "info" method
+		if target == "info" {
+			resp, err = server.Info(jsonData)
+		} else if p.RemoteProvider != nil {
+			resp, err = server.AuthSign(jsonData, nil, p.RemoteProvider)
+		} else {
+			resp, err = server.Sign(jsonData)
+		}
+
+		if err == nil {
+			return
+		}
+		if attempt == p.RemoteRetries || !retryable(err) {
+			return nil, err
+		}
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		log.Warningf("%s request to %s failed, retrying in %v: %v", target, p.RemoteServer, backoff, err)
+		sleep(backoff)
+		backoff *= 2
 	}
+}
 
-	return
+// maxBackoff caps the time a request is held back before it is retried.
+const maxBackoff = 30 * time.Second
+
+// sleep waits before a request is retried.
+var sleep = time.Sleep
+
+// retryable reports whether a request that failed with err may succeed
+// if sent again. Only the requests that no server took are: the servers
+// couldn't be dialed, or a gateway answered that they were unavailable.
+// Any other request, such as one that timed out, may have been handled,
+// and sending it again could issue a second certificate.
+func retryable(err error) bool {
+	e, ok := err.(*cferr.Error)
+	if !ok {
+		return false
+	}
+	return e.ErrorCode == int(cferr.APIClientError)+int(cferr.ServerUnavailable)
 }
 
 // SigAlgo returns the RSA signer's signature algorithm.
@@ -110,6 +154,7 @@ func (s *Signer) SigAlgo() x509.SignatureAlgorithm {
 // SetPolicy sets the signer's signature policy.
 func (s *Signer) SetPolicy(policy *config.Signing) {
 	s.policy = policy
+	s.hooks.Reset()
 }
 
 // SetDBAccessor sets the signers' cert db accessor, currently noop.
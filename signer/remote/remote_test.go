@@ -90,6 +90,65 @@ func TestRemoteInfo(t *testing.T) {
 	verifyRemoteInfo(t, remoteConfig)
 }
 
+func TestRemoteRetry(t *testing.T) {
+	var sleeps []time.Duration
+	defer func(f func(time.Duration)) { sleep = f }(sleep)
+	sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	failures, status := 2, http.StatusServiceUnavailable
+	infoHandler := newTestInfoHandler(t)
+	remoteServer := newTestServer(t, "/api/v1/cfssl/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(w, "failed", status)
+			return
+		}
+		infoHandler.ServeHTTP(w, r)
+	}), false, nil)
+	defer closeTestServer(t, remoteServer)
+
+	// The first server is never reached, and the second one fails
+	// twice before answering.
+	remoteConfig := testsuite.NewConfig(t, []byte(fmt.Sprintf(`{
+	"signing": {"default": {"remote": "ca"}},
+	"remotes": {"ca": "http://127.0.0.1:80,%s"},
+	"remote_options": {"ca": {"timeout": "5s", "retries": 2, "backoff": "10ms"}}
+}`, remoteServer.URL)))
+	verifyRemoteInfo(t, remoteConfig)
+	if len(sleeps) != 2 || sleeps[0] != 10*time.Millisecond || sleeps[1] != 20*time.Millisecond {
+		t.Fatalf("expected backoffs of 10ms and 20ms, got %v", sleeps)
+	}
+
+	failures, sleeps = 2, nil
+	remoteConfig.Signing.Default.RemoteRetries = 1
+	s := newRemoteSigner(t, remoteConfig.Signing)
+	if _, err := s.Info(info.Req{}); err == nil {
+		t.Fatal("expected the request to fail once out of retries")
+	}
+	if len(sleeps) != 1 {
+		t.Fatalf("expected a single retry, got %d", len(sleeps))
+	}
+
+	// The backoff is capped.
+	failures, sleeps = 3, nil
+	remoteConfig.Signing.Default.RemoteRetries = 3
+	remoteConfig.Signing.Default.RemoteBackoff = 20 * time.Second
+	verifyRemoteInfo(t, remoteConfig)
+	if len(sleeps) != 3 || sleeps[0] != 20*time.Second || sleeps[1] != maxBackoff || sleeps[2] != maxBackoff {
+		t.Fatalf("expected backoffs of 20s, %v and %v, got %v", maxBackoff, maxBackoff, sleeps)
+	}
+
+	// A server failing otherwise may have handled the request, which
+	// isn't retried.
+	failures, status, sleeps = 1, http.StatusInternalServerError, nil
+	if _, err := s.Info(info.Req{}); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if len(sleeps) != 0 {
+		t.Fatalf("expected no retry, got %d", len(sleeps))
+	}
+}
+
 func TestRemoteTLSInfo(t *testing.T) {
 	remoteTLSInfo(t, false)
 }
@@ -4,6 +4,7 @@ package signer
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -21,6 +22,7 @@ import (
 	"github.com/cloudflare/cfssl/csr"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/info"
+	"github.com/cloudflare/cfssl/log"
 )
 
 // Subject contains the information that should be used to override the
@@ -45,7 +47,8 @@ type Extension struct {
 // Extensions provided in the signRequest are copied into the certificate, as
 // long as they are in the ExtensionWhitelist for the signer's policy.
 // Extensions requested in the CSR are ignored, except for those processed by
-// ParseCertificateRequest (mainly subjectAltName).
+// ParseCertificateRequest (mainly subjectAltName) and those in the
+// CSRExtensionWhitelist of the profile.
 type SignRequest struct {
 	Hosts       []string    `json:"hosts"`
 	Request     string      `json:"certificate_request"`
@@ -70,6 +73,29 @@ type SignRequest struct {
 	// be passed to SignFromPrecert with the SCTs in order to create a
 	// valid certificate.
 	ReturnPrecert bool
+	// If MustStaple is true the certificate will carry the TLS Feature
+	// extension requesting OCSP stapling (RFC 7633), even if the signing
+	// profile doesn't enable must_staple.
+	MustStaple bool `json:"must_staple,omitempty"`
+	// AuthorityKeyID, if set, is the hex-encoded key identifier used as
+	// the certificate's AuthorityKeyId instead of the one derived from
+	// the CA, overriding the signing profile's authority_key_id. The
+	// profile must allow it with allow_authority_key_id_override.
+	AuthorityKeyID string `json:"authority_key_id,omitempty"`
+	// Requester identifies who asked for the certificate, such as the
+	// name of the auth key that authenticated the request. It is set
+	// by the server rather than the client and is recorded alongside
+	// the certificate in the certdb.
+	Requester string `json:"-"`
+	// Labels are names and values, such as the team, service or
+	// environment of the certificate, recorded with it in the certdb
+	// to look it up later.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Logger logs the messages about the request, such as the signing
+	// of the certificate and its recording in the certdb, with the
+	// fields of the request being served, such as its request ID. It is
+	// set by the server rather than the client.
+	Logger log.Logger `json:"-"`
 }
 
 // appendIf appends to a if s is not an empty string.
@@ -164,6 +190,8 @@ func DefaultSigAlgo(priv crypto.Signer) x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
@@ -329,8 +357,15 @@ func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.Si
 		template.DNSNames = nil
 		template.EmailAddresses = nil
 		template.URIs = nil
+		if profile.NameConstraints != nil {
+			if err = profile.NameConstraints.Apply(template); err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+			}
+		}
+	}
+	if !profile.OmitSKI {
+		template.SubjectKeyId = ski
 	}
-	template.SubjectKeyId = ski
 
 	if ocspURL != "" {
 		template.OCSPServer = []string{ocspURL}
@@ -356,10 +391,190 @@ func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.Si
 		}
 		template.ExtraExtensions = append(template.ExtraExtensions, ocspNoCheckExtension)
 	}
+	if profile.MustStaple {
+		AddMustStaple(template)
+	}
+	if len(profile.ExtraExtensions) != 0 {
+		addProfileExtensions(template, profile.ExtraExtensions)
+	}
+	if len(profile.SubjectInfoAccess) != 0 {
+		err = addSubjectInfoAccess(template, profile.SubjectInfoAccess)
+		if err != nil {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
+	if len(profile.Admissions) != 0 {
+		err = addAdmissions(template, profile.Admissions)
+		if err != nil {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
 
 	return nil
 }
 
+// SubjectInfoAccessOID is the OID of the subjectInfoAccess extension
+// (RFC 5280 section 4.2.2.2).
+var SubjectInfoAccessOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 11}
+
+type accessDescription struct {
+	Method   asn1.ObjectIdentifier
+	Location asn1.RawValue
+}
+
+// addSubjectInfoAccess adds a subjectInfoAccess extension listing the
+// access descriptions to template. Each location is encoded as a
+// uniformResourceIdentifier GeneralName.
+func addSubjectInfoAccess(template *x509.Certificate, descriptions []config.AccessDescription) error {
+	var sia []accessDescription
+	for _, ad := range descriptions {
+		sia = append(sia, accessDescription{
+			Method:   asn1.ObjectIdentifier(ad.Method),
+			Location: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(ad.Location)},
+		})
+	}
+	value, err := asn1.Marshal(sia)
+	if err != nil {
+		return err
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+		Id:    SubjectInfoAccessOID,
+		Value: value,
+	})
+	return nil
+}
+
+// IssuerAltNameOID is the OID of the issuerAltName extension (RFC 5280
+// section 4.2.1.7).
+var IssuerAltNameOID = asn1.ObjectIdentifier{2, 5, 29, 18}
+
+// AddIssuerAltName adds an issuerAltName extension to template listing the
+// email addresses, DNS names, URIs and IP addresses held by names, encoded
+// as GeneralNames. Nothing is added if names holds none of them.
+func AddIssuerAltName(template *x509.Certificate, names *x509.Certificate) error {
+	if len(names.EmailAddresses) == 0 && len(names.DNSNames) == 0 && len(names.URIs) == 0 && len(names.IPAddresses) == 0 {
+		return nil
+	}
+
+	value, err := csr.MarshalGeneralNames(names.DNSNames, names.EmailAddresses, names.IPAddresses, names.URIs, nil)
+	if err != nil {
+		return err
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+		Id:    IssuerAltNameOID,
+		Value: value,
+	})
+	return nil
+}
+
+// AddSubjectAltName makes template carry otherNames besides its DNS
+// names, email addresses, URIs and IP addresses. crypto/x509 can't
+// encode otherNames, so the whole subjectAltName extension is added as
+// an extra extension, replacing any already present.
+func AddSubjectAltName(template *x509.Certificate, otherNames []csr.OtherName) error {
+	value, err := csr.MarshalGeneralNames(template.DNSNames, template.EmailAddresses, template.IPAddresses, template.URIs, otherNames)
+	if err != nil {
+		return err
+	}
+
+	var extensions []pkix.Extension
+	for _, ext := range template.ExtraExtensions {
+		if !ext.Id.Equal(csr.SubjectAltNameOID) {
+			extensions = append(extensions, ext)
+		}
+	}
+	template.ExtraExtensions = append(extensions, pkix.Extension{
+		Id:    csr.SubjectAltNameOID,
+		Value: value,
+	})
+	return nil
+}
+
+// AuthorityKeyIDOID is the OID of the authorityKeyIdentifier extension
+// (RFC 5280 section 4.2.1.1).
+var AuthorityKeyIDOID = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+// SetAuthorityKeyID makes template carry keyID as its authority key
+// identifier. crypto/x509 always derives the identifier from the issuer's
+// SubjectKeyId unless the template supplies the extension itself, so it
+// is added as an extra extension, replacing any already present.
+func SetAuthorityKeyID(template *x509.Certificate, keyID []byte) error {
+	value, err := asn1.Marshal(struct {
+		KeyIdentifier []byte `asn1:"optional,tag:0"`
+	}{keyID})
+	if err != nil {
+		return err
+	}
+
+	var extensions []pkix.Extension
+	for _, ext := range template.ExtraExtensions {
+		if !ext.Id.Equal(AuthorityKeyIDOID) {
+			extensions = append(extensions, ext)
+		}
+	}
+	template.ExtraExtensions = append(extensions, pkix.Extension{
+		Id:    AuthorityKeyIDOID,
+		Value: value,
+	})
+	template.AuthorityKeyId = keyID
+	return nil
+}
+
+// addProfileExtensions adds the extensions of a profile to template,
+// replacing any extension of the same OID already there.
+func addProfileExtensions(template *x509.Certificate, exts []pkix.Extension) {
+	replaced := map[string]bool{}
+	for _, ext := range exts {
+		replaced[ext.Id.String()] = true
+	}
+	var kept []pkix.Extension
+	for _, ext := range template.ExtraExtensions {
+		if !replaced[ext.Id.String()] {
+			kept = append(kept, ext)
+		}
+	}
+	template.ExtraExtensions = append(kept, exts...)
+}
+
+// AddMustStaple adds the TLS Feature extension with the status_request
+// feature (OCSP Must-Staple, RFC 7633) to template, unless the template
+// already carries a TLS Feature extension.
+func AddMustStaple(template *x509.Certificate) {
+	for _, ext := range template.ExtraExtensions {
+		if ext.Id.Equal(TLSFeatureOID) {
+			return
+		}
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+		Id:       TLSFeatureOID,
+		Critical: false,
+		// DER encoding of the SEQUENCE OF INTEGER { 5 }, where 5 is the
+		// status_request TLS extension.
+		Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+	})
+}
+
+// HasMustStaple reports whether cert carries a TLS Feature extension
+// with the status_request feature, requiring TLS servers to staple an
+// OCSP response.
+func HasMustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(TLSFeatureOID) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == 5 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type policyInformation struct {
 	PolicyIdentifier asn1.ObjectIdentifier
 	Qualifiers       []interface{} `asn1:"tag:optional,omitempty"`
@@ -394,6 +609,10 @@ var (
 	// SCTListOID is the object ID for the Signed Certificate Timestamp certificate extension
 	// https://tools.ietf.org/html/rfc6962#page-14
 	SCTListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+	// TLSFeatureOID is the object ID of the TLS Feature extension
+	// https://tools.ietf.org/html/rfc7633#section-6
+	TLSFeatureOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
 )
 
 // addPolicies adds Certificate Policies and optional Policy Qualifiers to a
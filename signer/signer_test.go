@@ -2,10 +2,13 @@ package signer
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -148,3 +151,37 @@ func TestName(t *testing.T) {
 	}
 
 }
+
+func TestDefaultSigAlgoEd25519(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algo := DefaultSigAlgo(priv); algo != x509.PureEd25519 {
+		t.Fatalf("expected PureEd25519, got %v", algo)
+	}
+}
+
+func TestHasMustStaple(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	for _, mustStaple := range []bool{false, true} {
+		if mustStaple {
+			AddMustStaple(template)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if HasMustStaple(cert) != mustStaple {
+			t.Errorf("expected HasMustStaple to be %v", mustStaple)
+		}
+	}
+}
@@ -2,14 +2,18 @@
 package universal
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/x509"
 	"net/http"
 
 	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/config"
 	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/info"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/kms"
 	"github.com/cloudflare/cfssl/signer/local"
 	"github.com/cloudflare/cfssl/signer/remote"
 )
@@ -46,7 +50,52 @@ func fileBackedSigner(root *Root, policy *config.Signing) (signer.Signer, bool,
 	return signer, true, err
 }
 
+// kmsBackedSigner determines whether the key-file names a key held in a
+// key management service rather than a file, and if so produces a local
+// signer using it.
+func kmsBackedSigner(root *Root, policy *config.Signing) (signer.Signer, bool, error) {
+	keyURI := root.Config["key-file"]
+	if !kms.IsURI(keyURI) {
+		return nil, false, nil
+	}
+
+	certPEM, err := helpers.ReadBytes(root.Config["cert-file"])
+	if err != nil {
+		return nil, true, cferr.Wrap(cferr.CertificateError, cferr.ReadFailed, err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, true, err
+	}
+
+	priv, err := kms.NewSigner(keyURI)
+	if err != nil {
+		return nil, true, err
+	}
+	if !publicKeysEqual(priv.Public(), cert.PublicKey) {
+		return nil, true, cferr.New(cferr.PrivateKeyError, cferr.KeyMismatch)
+	}
+
+	s, err := local.NewSigner(priv, cert, signer.DefaultSigAlgo(priv), policy)
+	return s, true, err
+}
+
+// publicKeysEqual reports whether a and b encode to the same
+// SubjectPublicKeyInfo.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	derA, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	derB, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(derA, derB)
+}
+
 var localSignerList = []localSignerCheck{
+	kmsBackedSigner,
 	fileBackedSigner,
 }
 
@@ -74,7 +123,7 @@ func newLocalSigner(root Root, policy *config.Signing) (s signer.Signer, err err
 		}
 	}
 
-	if s == nil {
+	if s == nil && err == nil {
 		err = cferr.New(cferr.PrivateKeyError, cferr.Unknown)
 	}
 
@@ -189,6 +238,14 @@ func (s *Signer) SetDBAccessor(dba certdb.Accessor) {
 	s.local.SetDBAccessor(dba)
 }
 
+// SetAuditHook sets the hook notified of the sign requests handled by the
+// local signer. Requests sent to a remote CFSSL server are audited there.
+func (s *Signer) SetAuditHook(hook signer.AuditHook) {
+	if auditor, ok := s.local.(signer.Auditor); ok {
+		auditor.SetAuditHook(hook)
+	}
+}
+
 // GetDBAccessor returns the signer's cert db accessor.
 func (s *Signer) GetDBAccessor() certdb.Accessor {
 	return s.local.GetDBAccessor()
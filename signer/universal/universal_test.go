@@ -2,6 +2,13 @@ package universal
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"math/big"
 	"net/http"
@@ -13,10 +20,12 @@ import (
 	apiinfo "github.com/cloudflare/cfssl/api/info"
 	apisign "github.com/cloudflare/cfssl/api/signhandler"
 	"github.com/cloudflare/cfssl/config"
+	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/helpers/testsuite"
 	"github.com/cloudflare/cfssl/info"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/kms"
 )
 
 const (
@@ -470,3 +479,154 @@ func closeTestServer(t *testing.T, ts *httptest.Server) {
 	t.Log("Finalizing test server.")
 	ts.Close()
 }
+
+// kmsClient is a kms.Client signing with keys held in memory.
+type kmsClient struct {
+	keys map[string]crypto.Signer
+}
+
+func (c *kmsClient) PublicKey(keyID string) (crypto.PublicKey, error) {
+	key, ok := c.keys[keyID]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return key.Public(), nil
+}
+
+func (c *kmsClient) Sign(keyID string, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return c.keys[keyID].Sign(rand.Reader, digest, opts)
+}
+
+func TestNewSignerWithKMSKey(t *testing.T) {
+	keyPEM, err := ioutil.ReadFile(testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kms.Register(kms.SchemeAWS, func(*kms.URI) (kms.Client, error) {
+		return &kmsClient{keys: map[string]crypto.Signer{"alias/ca": caKey, "alias/other": otherKey}}, nil
+	})
+	defer kms.Register(kms.SchemeAWS, nil)
+
+	root := Root{Config: map[string]string{
+		"key-file":  "awskms:///alias/ca",
+		"cert-file": testCaFile,
+	}}
+	s, err := NewSigner(root, validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrPEM, err := ioutil.ReadFile("../local/testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := ioutil.ReadFile(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("certificate isn't signed by the KMS key: %v", err)
+	}
+
+	root.Config["key-file"] = "awskms:///alias/other"
+	_, err = NewSigner(root, validLocalConfig.Signing)
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != int(cferr.PrivateKeyError)+int(cferr.KeyMismatch) {
+		t.Fatalf("expected a key that doesn't match the CA certificate to be rejected, got %v", err)
+	}
+}
+
+func TestPolicyHook(t *testing.T) {
+	var received signer.PolicyRequest
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		var decision signer.PolicyDecision
+		switch received.Label {
+		case "deny":
+			decision.Reason = "hosts must be under example.com"
+		case "mutate":
+			decision.Allow = true
+			decision.Hosts = []string{"mutated.example.com"}
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		default:
+			decision.Allow = true
+		}
+		json.NewEncoder(w).Encode(decision)
+	}))
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	s := newTestUniversalSigner(t, &config.Signing{
+		Default: &config.SigningProfile{
+			Usage:        []string{"digital signature"},
+			Expiry:       expiry,
+			ExpiryString: "1m",
+			PolicyHook:   &config.PolicyHook{URL: ts.URL, Timeout: time.Second, RootCAs: roots},
+		},
+	})
+
+	csrPEM, err := ioutil.ReadFile("../local/testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(label string) (*x509.Certificate, error) {
+		certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM), Hosts: []string{"www.example.com"}, Label: label})
+		if err != nil {
+			return nil, err
+		}
+		return helpers.ParseCertificatePEM(certPEM)
+	}
+
+	cert, err := sign("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.example.com" {
+		t.Fatalf("unexpected hosts %v", cert.DNSNames)
+	}
+	if received.CSR.PublicKeyAlgorithm != "ECDSA" || received.Expiry != "1m" || len(received.Hosts) != 1 {
+		t.Fatalf("unexpected policy request %+v", received)
+	}
+
+	if cert, err = sign("mutate"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "mutated.example.com" {
+		t.Fatalf("the policy hook should have replaced the hosts, got %v", cert.DNSNames)
+	}
+
+	for _, label := range []string{"deny", "broken"} {
+		_, err = sign(label)
+		cfErr, ok := err.(*cferr.Error)
+		if !ok || cfErr.ErrorCode/1000 != int(cferr.PolicyError)/1000 {
+			t.Fatalf("expected a policy error for %q, got %v", label, err)
+		}
+	}
+	if !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected the status of the hook in the error, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package ca
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -30,6 +31,10 @@ func (err *authError) Error() string {
 // as the TPM.
 var authTypes = map[string]func(config.AuthKey, []byte) (auth.Provider, error){
 	"standard": newStandardProvider,
+	"api_key":  newAuthProvider,
+	"mtls":     newAuthProvider,
+	"spiffe":   newAuthProvider,
+	"jwt":      newAuthProvider,
 }
 
 // Create a standard provider without providing any additional data.
@@ -37,6 +42,12 @@ func newStandardProvider(ak config.AuthKey, ad []byte) (auth.Provider, error) {
 	return auth.New(ak.Key, ad)
 }
 
+// Create one of the other providers of the auth package, which take
+// no additional data.
+func newAuthProvider(ak config.AuthKey, ad []byte) (auth.Provider, error) {
+	return auth.NewProvider(ak.Type, ak.Key, nil)
+}
+
 // Create a new provider from an authentication key and possibly
 // additional data.
 func newProvider(ak config.AuthKey, ad []byte) (auth.Provider, error) {
@@ -206,13 +217,19 @@ func (cap *CFSSL) SignCSR(csrPEM []byte) (cert []byte, err error) {
 		return nil, err
 	}
 
-	hosts := make([]string, len(csr.DNSNames), len(csr.DNSNames)+len(csr.IPAddresses))
+	hosts := make([]string, len(csr.DNSNames), len(csr.DNSNames)+len(csr.IPAddresses)+len(csr.URIs))
 	copy(hosts, csr.DNSNames)
 
 	for i := range csr.IPAddresses {
 		hosts = append(hosts, csr.IPAddresses[i].String())
 	}
 
+	// The hosts replace all the subject alternative names of the
+	// CSR, so its URIs, such as a SPIFFE ID, must be kept.
+	for i := range csr.URIs {
+		hosts = append(hosts, csr.URIs[i].String())
+	}
+
 	sreq := &signer.SignRequest{
 		Hosts:   hosts,
 		Request: string(csrPEM),
@@ -251,10 +268,41 @@ func (cap *CFSSL) CACertificate() ([]byte, error) {
 	return []byte(resp.Certificate), nil
 }
 
+// svid locates the files in which a SPIRE agent keeps the X.509-SVID
+// of a workload: its certificate chain, private key and trust bundle.
+type svid struct {
+	cert, key, bundle string
+}
+
+// svidFiles returns the SVID files set in the "spiffe" profile of id,
+// or nil if there are none.
+func svidFiles(id *core.Identity) *svid {
+	spiffe := id.Profiles["spiffe"]
+	if spiffe["svid-cert"] == "" || spiffe["svid-key"] == "" {
+		return nil
+	}
+	return &svid{cert: spiffe["svid-cert"], key: spiffe["svid-key"], bundle: spiffe["svid-bundle"]}
+}
+
+// clientCertificate loads the SVID for each connection to the CFSSL
+// remote, as the SPIRE agent rotates it well before its certificate
+// expires.
+func (s *svid) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(s.cert, s.key)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
 // NewCFSSLProvider takes the configuration information from an
 // Identity (and an optional default remote), returning a CFSSL
 // instance. There should be a profile in id called "cfssl", which
-// should contain label and profile fields as needed.
+// should contain label and profile fields as needed. If the "spiffe"
+// profile of id names the files of an SVID issued by SPIRE, and the
+// "cfssl" profile sets no client certificate and no authentication,
+// the SVID is presented to the remote, which authenticates it with the
+// "spiffe" authentication type, to obtain a certificate from CFSSL.
 func NewCFSSLProvider(id *core.Identity, defaultRemote client.Remote) (*CFSSL, error) {
 	if id == nil {
 		return nil, errors.New("transport: the identity hasn't been initialised. Has it been loaded from disk?")
@@ -269,6 +317,7 @@ func NewCFSSLProvider(id *core.Identity, defaultRemote client.Remote) (*CFSSL, e
 		cap.Label = cfssl["label"]
 		cap.Profile = cfssl["profile"]
 
+		svid := svidFiles(id)
 		if cap.DefaultRemote == nil {
 			cert, err := helpers.LoadClientCertificate(cfssl["mutual-tls-cert"], cfssl["mutual-tls-key"])
 			if err != nil {
@@ -278,11 +327,19 @@ func NewCFSSLProvider(id *core.Identity, defaultRemote client.Remote) (*CFSSL, e
 			if err != nil {
 				return nil, err
 			}
-			cap.DefaultRemote = client.NewServerTLS(cfssl["remote"], helpers.CreateTLSConfig(remoteCAs, cert))
+			tlsConfig := helpers.CreateTLSConfig(remoteCAs, cert)
+			if cert == nil && svid != nil {
+				tlsConfig.GetClientCertificate = svid.clientCertificate
+			}
+			cap.DefaultRemote = client.NewServerTLS(cfssl["remote"], tlsConfig)
 		}
 
 		cap.DefaultAuth.Type = cfssl["auth-type"]
 		cap.DefaultAuth.Key = cfssl["auth-key"]
+		if cap.DefaultAuth.Type == "" && cap.DefaultAuth.Key == "" && svid != nil && svid.bundle != "" {
+			cap.DefaultAuth.Type = "spiffe"
+			cap.DefaultAuth.Key = "file:" + svid.bundle
+		}
 	}
 
 	err := cap.setRemoteAndAuth()
@@ -77,6 +77,14 @@ type Transport struct {
 	// certificate cannot be checked) to not be treated as an
 	// error.
 	RevokeSoftFail bool
+
+	// Rekey, if true, will cause a new key to be generated every
+	// time the certificate is replaced, instead of requesting a
+	// certificate for the current key. With a provider that is a
+	// kp.KeyStager, the previous key and certificate are served
+	// until the certificate for the new key has been issued, and
+	// kept if it can't be.
+	Rekey bool
 }
 
 // TLSClientAuthClientConfig returns a new client authentication TLS
@@ -145,6 +153,10 @@ func New(before time.Duration, identity *core.Identity) (*Transport, error) {
 		Backoff:  &backoff.Backoff{},
 	}
 
+	if _, err := identity.SPIFFEID(); err != nil {
+		return nil, err
+	}
+
 	store, err := roots.New(identity.Roots)
 	if err != nil {
 		return nil, err
@@ -205,14 +217,7 @@ func (tr *Transport) RefreshKeys() (err error) {
 		err = tr.Provider.Load()
 		if err != nil && err != kp.ErrCertificateUnavailable {
 			log.Debugf("failed to load keypair: %v", err)
-			kr := tr.Identity.Request.KeyRequest
-			if kr == nil {
-				kr = csr.NewKeyRequest()
-			}
-
-			err = tr.Provider.Generate(kr.Algo(), kr.Size())
-			if err != nil {
-				log.Debugf("failed to generate key: %v", err)
+			if err = tr.generateKey(); err != nil {
 				return err
 			}
 		}
@@ -221,7 +226,31 @@ func (tr *Transport) RefreshKeys() (err error) {
 	lifespan := tr.Lifespan()
 	if lifespan < tr.Before {
 		log.Debugf("transport's certificate is out of date (lifespan %s)", lifespan)
-		req, err := tr.Provider.CertificateRequest(tr.Identity.Request)
+		if tr.Rekey && tr.Provider.Certificate() != nil {
+			if stager, ok := tr.Provider.(kp.KeyStager); ok {
+				log.Debug("staging a new key for the certificate")
+				if err = tr.stageKey(stager); err != nil {
+					return err
+				}
+				defer func() {
+					if err != nil {
+						stager.DiscardStagedKey()
+					}
+				}()
+			} else {
+				log.Debug("generating a new key for the certificate")
+				if err = tr.generateKey(); err != nil {
+					return err
+				}
+			}
+		}
+
+		creq, err := tr.Identity.CertificateRequest()
+		if err != nil {
+			return err
+		}
+
+		req, err := tr.Provider.CertificateRequest(creq)
 		if err != nil {
 			log.Debugf("couldn't get a CSR: %v", err)
 			if tr.Provider.SignalFailure(err) {
@@ -266,6 +295,35 @@ func (tr *Transport) RefreshKeys() (err error) {
 	return nil
 }
 
+// generateKey generates a new key as described by the identity's
+// certificate request.
+func (tr *Transport) generateKey() error {
+	kr := tr.keyRequest()
+	err := tr.Provider.Generate(kr.Algo(), kr.Size())
+	if err != nil {
+		log.Debugf("failed to generate key: %v", err)
+	}
+	return err
+}
+
+// stageKey stages a new key as described by the identity's
+// certificate request, keeping the current key and certificate in use.
+func (tr *Transport) stageKey(stager kp.KeyStager) error {
+	kr := tr.keyRequest()
+	err := stager.StageKey(kr.Algo(), kr.Size())
+	if err != nil {
+		log.Debugf("failed to stage key: %v", err)
+	}
+	return err
+}
+
+func (tr *Transport) keyRequest() *csr.KeyRequest {
+	if kr := tr.Identity.Request.KeyRequest; kr != nil {
+		return kr
+	}
+	return csr.NewKeyRequest()
+}
+
 func (tr *Transport) getCertificate() (cert tls.Certificate, err error) {
 	if !tr.Provider.Ready() {
 		log.Debug("transport isn't ready; attempting to refresh keypair")
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/cloudflare/cfssl/csr"
+)
+
+// SPIFFEID returns the SPIFFE ID of the workload at path in
+// trustDomain, such as "spiffe://example.org/ns/prod/sa/web" for the
+// path "/ns/prod/sa/web" in the trust domain "example.org".
+func SPIFFEID(trustDomain, path string) (*url.URL, error) {
+	if trustDomain == "" {
+		return nil, errors.New("transport: the SPIFFE trust domain is empty")
+	}
+	for _, c := range trustDomain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return nil, errors.New("transport: invalid SPIFFE trust domain " + trustDomain)
+		}
+	}
+
+	if path != "" {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		for _, segment := range strings.Split(path[1:], "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return nil, errors.New("transport: invalid SPIFFE workload path " + path)
+			}
+			for _, c := range segment {
+				if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+					return nil, errors.New("transport: invalid SPIFFE workload path " + path)
+				}
+			}
+		}
+	}
+
+	return &url.URL{Scheme: "spiffe", Host: trustDomain, Path: path}, nil
+}
+
+// SPIFFEID returns the SPIFFE ID of the identity, built from the
+// "trust-domain" and "workload-path" keys of its "spiffe" profile, or
+// nil if it has no such profile.
+func (id *Identity) SPIFFEID() (*url.URL, error) {
+	spiffe := id.Profiles["spiffe"]
+	if spiffe == nil {
+		return nil, nil
+	}
+	return SPIFFEID(spiffe["trust-domain"], spiffe["workload-path"])
+}
+
+// CertificateRequest returns the identity's certificate request, with
+// the SPIFFE ID of the identity added to its URIs if it has one.
+func (id *Identity) CertificateRequest() (*csr.CertificateRequest, error) {
+	spiffeID, err := id.SPIFFEID()
+	if err != nil || spiffeID == nil || id.Request == nil {
+		return id.Request, err
+	}
+
+	uri := spiffeID.String()
+	for _, u := range id.Request.URIs {
+		if u == uri {
+			return id.Request, nil
+		}
+	}
+	req := *id.Request
+	req.URIs = append(append([]string{}, id.Request.URIs...), uri)
+	return &req, nil
+}
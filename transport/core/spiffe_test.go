@@ -0,0 +1,67 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/csr"
+)
+
+func TestSPIFFEID(t *testing.T) {
+	for _, tc := range []struct {
+		trustDomain, path, id string
+	}{
+		{"example.org", "/ns/prod/sa/web", "spiffe://example.org/ns/prod/sa/web"},
+		{"example.org", "web", "spiffe://example.org/web"},
+		{"example.org", "", "spiffe://example.org"},
+	} {
+		id, err := SPIFFEID(tc.trustDomain, tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.String() != tc.id {
+			t.Fatalf("expected %s, got %s", tc.id, id)
+		}
+	}
+
+	for _, tc := range []struct{ trustDomain, path string }{
+		{"", "/web"},
+		{"Example.org", "/web"},
+		{"example.org:8443", "/web"},
+		{"example.org", "/web/"},
+		{"example.org", "/ns/../web"},
+		{"example.org", "/web?x=1"},
+	} {
+		if _, err := SPIFFEID(tc.trustDomain, tc.path); err == nil {
+			t.Fatalf("expected %q and %q to be rejected", tc.trustDomain, tc.path)
+		}
+	}
+}
+
+func TestIdentityCertificateRequest(t *testing.T) {
+	id := &Identity{
+		Request: &csr.CertificateRequest{CN: "web", URIs: []string{"https://web.example.org"}},
+	}
+	req, err := id.CertificateRequest()
+	if err != nil || req != id.Request {
+		t.Fatalf("expected the request of an identity without a SPIFFE ID to be unchanged (%v)", err)
+	}
+
+	id.Profiles = map[string]map[string]string{
+		"spiffe": {"trust-domain": "example.org", "workload-path": "/web"},
+	}
+	req, err = id.CertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.URIs) != 2 || req.URIs[1] != "spiffe://example.org/web" {
+		t.Fatalf("expected the SPIFFE ID to be added, got %v", req.URIs)
+	}
+	if len(id.Request.URIs) != 1 {
+		t.Fatal("the identity's request shouldn't be modified")
+	}
+
+	id.Profiles["spiffe"]["trust-domain"] = ""
+	if _, err = id.CertificateRequest(); err == nil {
+		t.Fatal("expected an empty trust domain to be rejected")
+	}
+}
@@ -40,4 +40,9 @@
 // any existing connections. Clients should run AutoUpdate if they
 // plan on making multiple connections or will be reconnecting; for a
 // one-off connection, it isn't necessary.
+//
+// Programs that don't use the transport package themselves can have
+// their key and certificate renewed by "cfssl transport-refresh
+// -daemon", which runs AutoUpdate on their behalf and can signal them
+// once the files are replaced.
 package transport
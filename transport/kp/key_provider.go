@@ -13,6 +13,7 @@
 package kp
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -22,7 +23,10 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/cloudflare/cfssl/csr"
@@ -91,6 +95,18 @@ type KeyProvider interface {
 	X509KeyPair() (tls.Certificate, error)
 }
 
+// A KeyStager is a KeyProvider that can generate a new key without
+// giving up the current one. StageKey generates a key, which
+// CertificateRequest and SignCSR then use, while Certificate and
+// X509KeyPair keep returning the current key and certificate.
+// SetCertificatePEM swaps the staged key in along with its certificate,
+// and DiscardStagedKey drops it.
+type KeyStager interface {
+	KeyProvider
+	StageKey(algo string, size int) error
+	DiscardStagedKey()
+}
+
 // StandardPaths contains a path to a key file and certificate file.
 type StandardPaths struct {
 	KeyFile  string `json:"private_key"`
@@ -112,6 +128,13 @@ type StandardProvider struct {
 		// calling tls.X509KeyPair directly.
 		keyPEM  []byte
 		certPEM []byte
+
+		// A key generated by StageKey, which replaces the
+		// current one once a certificate is set for it.
+		staged struct {
+			priv   crypto.Signer
+			keyPEM []byte
+		}
 	}
 }
 
@@ -189,29 +212,57 @@ func (sp *StandardProvider) Persistent() bool {
 func (sp *StandardProvider) Generate(algo string, size int) (err error) {
 	sp.resetKey()
 	sp.resetCert()
+	sp.DiscardStagedKey()
+
+	sp.internal.priv, sp.internal.keyPEM, err = generateKey(algo, size)
+	return err
+}
+
+// StageKey generates a new private key, which is used for the
+// certificate requests made from then on, while the current key and
+// certificate are kept until a certificate for the new key is set.
+func (sp *StandardProvider) StageKey(algo string, size int) (err error) {
+	sp.DiscardStagedKey()
+	sp.internal.staged.priv, sp.internal.staged.keyPEM, err = generateKey(algo, size)
+	return err
+}
+
+// DiscardStagedKey drops the key generated by StageKey, if any.
+func (sp *StandardProvider) DiscardStagedKey() {
+	sp.internal.staged.priv = nil
+	sp.internal.staged.keyPEM = nil
+}
 
+// requestKey returns the key certificates are requested for: the staged
+// key if there is one, or the current key.
+func (sp *StandardProvider) requestKey() crypto.Signer {
+	if sp.internal.staged.priv != nil {
+		return sp.internal.staged.priv
+	}
+	return sp.internal.priv
+}
+
+// generateKey generates a private key, returning it along with its PEM
+// encoding.
+func generateKey(algo string, size int) (crypto.Signer, []byte, error) {
 	algo = strings.ToLower(algo)
 	switch algo {
 	case "rsa":
-		var priv *rsa.PrivateKey
 		if size < 2048 {
-			return errors.New("transport: RSA keys must be at least 2048 bits")
+			return nil, nil, errors.New("transport: RSA keys must be at least 2048 bits")
 		}
 
-		priv, err = rsa.GenerateKey(rand.Reader, size)
+		priv, err := rsa.GenerateKey(rand.Reader, size)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
-		keyPEM := x509.MarshalPKCS1PrivateKey(priv)
 		p := &pem.Block{
 			Type:  "RSA PRIVATE KEY",
-			Bytes: keyPEM,
+			Bytes: x509.MarshalPKCS1PrivateKey(priv),
 		}
-		sp.internal.keyPEM = pem.EncodeToMemory(p)
-		sp.internal.priv = priv
+		return priv, pem.EncodeToMemory(p), nil
 	case "ecdsa":
-		var priv *ecdsa.PrivateKey
 		var curve elliptic.Curve
 		switch size {
 		case curveP256:
@@ -221,32 +272,27 @@ func (sp *StandardProvider) Generate(algo string, size int) (err error) {
 		case curveP521:
 			curve = elliptic.P521()
 		default:
-			return errors.New("transport: invalid elliptic curve key size; only 256-, 384-, and 521-bit keys are accepted")
+			return nil, nil, errors.New("transport: invalid elliptic curve key size; only 256-, 384-, and 521-bit keys are accepted")
 		}
 
-		priv, err = ecdsa.GenerateKey(curve, rand.Reader)
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
-		var keyPEM []byte
-		keyPEM, err = x509.MarshalECPrivateKey(priv)
+		keyDER, err := x509.MarshalECPrivateKey(priv)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		p := &pem.Block{
 			Type:  "EC PRIVATE KEY",
-			Bytes: keyPEM,
+			Bytes: keyDER,
 		}
-		sp.internal.keyPEM = pem.EncodeToMemory(p)
-
-		sp.internal.priv = priv
+		return priv, pem.EncodeToMemory(p), nil
 	default:
-		return errors.New("transport: invalid key algorithm; only RSA and ECDSA are supported")
+		return nil, nil, errors.New("transport: invalid key algorithm; only RSA and ECDSA are supported")
 	}
-
-	return nil
 }
 
 // Certificate returns the associated certificate, or nil if
@@ -259,13 +305,13 @@ func (sp *StandardProvider) Certificate() *x509.Certificate {
 // and attempts to produce a certificate signing request suitable for
 // sending to a certificate authority.
 func (sp *StandardProvider) CertificateRequest(req *csr.CertificateRequest) ([]byte, error) {
-	if sp.internal.priv == nil {
+	if sp.requestKey() == nil {
 		if req.KeyRequest == nil {
 			return nil, errors.New("transport: invalid key request in csr.CertificateRequest")
 		}
 		sp.Generate(req.KeyRequest.Algo(), req.KeyRequest.Size())
 	}
-	return csr.Generate(sp.internal.priv, req)
+	return csr.Generate(sp.requestKey(), req)
 }
 
 // ErrCertificateUnavailable is returned when a key is available, but
@@ -355,13 +401,27 @@ func (sp *StandardProvider) Ready() bool {
 }
 
 // SetCertificatePEM receives a PEM-encoded certificate and loads it
-// into the provider.
+// into the provider. If a key has been staged, the certificate must be
+// for that key, which then replaces the current one.
 func (sp *StandardProvider) SetCertificatePEM(certPEM []byte) error {
 	cert, err := helpers.ParseCertificatePEM(certPEM)
 	if err != nil {
 		return errors.New("transport: invalid certificate")
 	}
 
+	if staged := sp.internal.staged.priv; staged != nil {
+		pub, err := x509.MarshalPKIXPublicKey(staged.Public())
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(pub, cert.RawSubjectPublicKeyInfo) {
+			return errors.New("transport: certificate isn't for the staged key")
+		}
+		sp.internal.priv = staged
+		sp.internal.keyPEM = sp.internal.staged.keyPEM
+		sp.DiscardStagedKey()
+	}
+
 	sp.internal.certPEM = certPEM
 	sp.internal.cert = cert
 	return nil
@@ -375,21 +435,103 @@ func (sp *StandardProvider) SignalFailure(err error) bool {
 
 // SignCSR takes a template certificate request and signs it.
 func (sp *StandardProvider) SignCSR(tpl *x509.CertificateRequest) ([]byte, error) {
-	return x509.CreateCertificateRequest(rand.Reader, tpl, sp.internal.priv)
+	return x509.CreateCertificateRequest(rand.Reader, tpl, sp.requestKey())
 }
 
-// Store writes the key and certificate to disk, if necessary.
+// Store writes the key and certificate to disk, if necessary. The
+// files are replaced together: if either can't be written, both keep
+// their previous content.
 func (sp *StandardProvider) Store() error {
 	if !sp.Ready() {
 		return errors.New("transport: provider does not have a key and certificate")
 	}
 
-	err := ioutil.WriteFile(sp.Paths.CertFile, sp.internal.certPEM, 0644)
+	return writeFilesAtomic(
+		pendingFile{sp.Paths.KeyFile, sp.internal.keyPEM, 0600},
+		pendingFile{sp.Paths.CertFile, sp.internal.certPEM, 0644},
+	)
+}
+
+// A pendingFile is the content writeFilesAtomic writes to a file.
+type pendingFile struct {
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// writeFileAtomic writes data to a temporary file next to path and
+// renames it over path, so that readers never see a partially written
+// file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFilesAtomic(pendingFile{path, data, perm})
+}
+
+// writeFilesAtomic writes each file to a temporary file next to it, and
+// only once all of them are written renames them over the files. Should
+// a rename fail, the files already renamed are given back their previous
+// content, or removed if they didn't exist.
+func writeFilesAtomic(files ...pendingFile) error {
+	tmps := make([]string, len(files))
+	defer func() {
+		for _, tmp := range tmps {
+			if tmp != "" {
+				os.Remove(tmp)
+			}
+		}
+	}()
+
+	previous := make([][]byte, len(files))
+	for i, f := range files {
+		tmp, err := writeTemp(f)
+		if err != nil {
+			return err
+		}
+		tmps[i] = tmp
+
+		previous[i], err = ioutil.ReadFile(f.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for i, f := range files {
+		if err := os.Rename(tmps[i], f.path); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if previous[j] == nil {
+					os.Remove(files[j].path)
+				} else if restoreErr := writeFileAtomic(files[j].path, previous[j], files[j].perm); restoreErr != nil {
+					return fmt.Errorf("%v; restoring %s also failed: %v", err, files[j].path, restoreErr)
+				}
+			}
+			return err
+		}
+		tmps[i] = ""
+	}
+	return nil
+}
+
+// writeTemp writes the content of f to a temporary file next to it, and
+// returns the name of the temporary file.
+func writeTemp(f pendingFile) (string, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path)+".tmp")
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return ioutil.WriteFile(sp.Paths.KeyFile, sp.internal.keyPEM, 0600)
+	if _, err = tmp.Write(f.data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), f.perm)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
 }
 
 // X509KeyPair returns a tls.Certificate for the provider.
@@ -1,8 +1,16 @@
 package kp
 
 import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/transport/core"
@@ -87,3 +95,122 @@ func TestGenerate(t *testing.T) {
 		t.Fatalf("key provider couldn't generate key: %v", err)
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "atomic.pem")
+
+	for _, data := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		written, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != data {
+			t.Fatalf("expected %q, got %q", data, written)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".atomic.pem.tmp*")); len(leftovers) != 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestWriteFilesAtomicRestores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	first := filepath.Join(dir, "first.pem")
+	if err = ioutil.WriteFile(first, []byte("previous"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file can't be renamed over a directory, so the second file
+	// can't be replaced.
+	second := filepath.Join(dir, "second")
+	if err = os.Mkdir(second, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFilesAtomic(pendingFile{first, []byte("next"), 0600}, pendingFile{second, []byte("next"), 0600})
+	if err == nil {
+		t.Fatal("expected the second file not to be written")
+	}
+	written, err := ioutil.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "previous" {
+		t.Fatalf("expected the first file to be restored, got %q", written)
+	}
+}
+
+// selfSign returns a PEM-encoded certificate for the key certificates
+// are requested for.
+func selfSign(t *testing.T, sp *StandardProvider) []byte {
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "stage test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	key := sp.requestKey()
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestStageKey(t *testing.T) {
+	var sp StandardProvider
+	if err := sp.Generate("ecdsa", 256); err != nil {
+		t.Fatal(err)
+	}
+	oldCert := selfSign(t, &sp)
+	if err := sp.SetCertificatePEM(oldCert); err != nil {
+		t.Fatal(err)
+	}
+	oldKey := sp.internal.keyPEM
+
+	if err := sp.StageKey("ecdsa", 256); err != nil {
+		t.Fatal(err)
+	}
+	if !sp.Ready() || string(sp.internal.keyPEM) != string(oldKey) {
+		t.Fatal("expected the current key and certificate to be kept while a key is staged")
+	}
+	if _, err := sp.X509KeyPair(); err != nil {
+		t.Fatalf("expected the current key pair to stay usable: %v", err)
+	}
+	if err := sp.SetCertificatePEM(oldCert); err == nil {
+		t.Fatal("expected a certificate for the current key to be refused while a key is staged")
+	}
+
+	if err := sp.SetCertificatePEM(selfSign(t, &sp)); err != nil {
+		t.Fatal(err)
+	}
+	if sp.internal.staged.priv != nil {
+		t.Fatal("expected the staged key to be swapped in")
+	}
+	if string(sp.internal.keyPEM) == string(oldKey) {
+		t.Fatal("expected the key to be replaced")
+	}
+	if _, err := sp.X509KeyPair(); err != nil {
+		t.Fatalf("expected the new key pair to be usable: %v", err)
+	}
+}
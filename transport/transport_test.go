@@ -1,7 +1,9 @@
 package transport
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -170,6 +172,58 @@ func TestAutoUpdate(t *testing.T) {
 	}
 }
 
+func TestRefreshKeysRekey(t *testing.T) {
+	cert := tr.Provider.Certificate()
+	if cert == nil {
+		t.Fatal("no certificate from provider")
+	}
+
+	oldBefore := tr.Before
+	defer func() {
+		tr.Before = oldBefore
+		tr.Rekey = false
+	}()
+
+	// Make the current certificate out of date.
+	tr.Before = 2 * cert.NotAfter.Sub(time.Now())
+	tr.Rekey = true
+
+	// The current key and certificate are kept if the CA can't
+	// issue a certificate for the new key.
+	ca := tr.CA
+	tr.CA = failingCA{}
+	err := tr.RefreshKeys()
+	tr.CA = ca
+	if err == nil {
+		t.Fatal("expected the refresh to fail without a CA")
+	}
+	if kept := tr.Provider.Certificate(); kept == nil || !bytes.Equal(kept.Raw, cert.Raw) {
+		t.Fatal("expected the current certificate to be kept")
+	}
+	if _, err = tr.Provider.X509KeyPair(); err != nil {
+		t.Fatalf("expected the current key pair to stay usable: %v", err)
+	}
+
+	if err := tr.RefreshKeys(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	renewed := tr.Provider.Certificate()
+	if renewed == nil {
+		t.Fatal("no certificate from provider after rekeying")
+	}
+	if bytes.Equal(renewed.RawSubjectPublicKeyInfo, cert.RawSubjectPublicKeyInfo) {
+		t.Fatal("expected the renewed certificate to have a new key")
+	}
+}
+
+// failingCA is a certificate authority that can't sign anything.
+type failingCA struct{}
+
+func (failingCA) SignCSR([]byte) ([]byte, error) { return nil, errors.New("no CA") }
+
+func (failingCA) CACertificate() ([]byte, error) { return nil, errors.New("no CA") }
+
 var (
 	l             *Listener
 	testLKey      = "testdata/server.key"
@@ -0,0 +1,421 @@
+// Package tsa implements an RFC 3161 time-stamp authority. A Signer
+// answers DER-encoded TimeStampReq messages with TimeStampResp messages
+// carrying a CMS SignedData time-stamp token.
+package tsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// Object identifiers used in time-stamp requests, responses and tokens.
+var (
+	OIDSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	OIDContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidExtKeyUsage     = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// hashOIDs maps the hash algorithms that may be used in a message
+// imprint to their object identifiers.
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   oidSHA1,
+	crypto.SHA256: oidSHA256,
+	crypto.SHA384: oidSHA384,
+	crypto.SHA512: oidSHA512,
+}
+
+// PKIStatus values from RFC 3161 section 2.4.2.
+const (
+	StatusGranted  = 0
+	StatusRejected = 2
+)
+
+// PKIFailureInfo bits from RFC 3161 section 2.4.2.
+const (
+	FailBadAlg              = 0
+	FailBadRequest          = 2
+	FailBadDataFormat       = 5
+	FailUnacceptedPolicy    = 15
+	FailUnacceptedExtension = 16
+	FailSystemFailure       = 25
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        []attribute `asn1:"set,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	SignerInfos      []signerInfo    `asn1:"set"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// A Signer issues RFC 3161 time-stamp tokens.
+type Signer struct {
+	cert   *x509.Certificate
+	key    crypto.Signer
+	policy asn1.ObjectIdentifier
+
+	// AllowedHashes lists the hash algorithms accepted in message
+	// imprints. It defaults to SHA-256, SHA-384 and SHA-512.
+	AllowedHashes []crypto.Hash
+	// Accuracy is the accuracy of the time source claimed in every
+	// token. It defaults to one second.
+	Accuracy time.Duration
+
+	// now returns the current time; it is replaced in tests.
+	now func() time.Time
+}
+
+// NewSigner returns a Signer that issues tokens under the given policy
+// with the TSA certificate and its key. The certificate must carry the
+// id-kp-timeStamping extended key usage and no other.
+func NewSigner(cert *x509.Certificate, key crypto.Signer, policy asn1.ObjectIdentifier) (*Signer, error) {
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping || len(cert.UnknownExtKeyUsage) != 0 {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest,
+			errors.New("TSA certificate must have the timeStamping extended key usage only"))
+	}
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) && !ext.Critical {
+			log.Warning("TSA certificate's extended key usage is not critical; RFC 3161 clients may reject its tokens")
+		}
+	}
+
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.Unknown)
+	}
+
+	if len(policy) == 0 {
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("a TSA policy is required"))
+	}
+
+	return &Signer{
+		cert:          cert,
+		key:           key,
+		policy:        policy,
+		AllowedHashes: []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512},
+		Accuracy:      time.Second,
+		now:           time.Now,
+	}, nil
+}
+
+// NewSignerFromFile reads the TSA certificate and key from PEM files and
+// parses the dotted policy OID before calling NewSigner.
+func NewSignerFromFile(certFile, keyFile, policy string) (*Signer, error) {
+	log.Debug("Loading TSA certificate: ", certFile)
+	certPEM, err := helpers.ReadBytes(certFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Loading TSA key: ", keyFile)
+	keyPEM, err := helpers.ReadBytes(keyFile)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.ReadFailed, err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := parseOID(policy)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(cert, key, oid)
+}
+
+// Respond answers a DER-encoded TimeStampReq with a DER-encoded
+// TimeStampResp. Malformed or unacceptable requests are answered with a
+// rejection status rather than an error; an error is returned only if
+// the response can't be produced.
+func (s *Signer) Respond(der []byte) ([]byte, error) {
+	var req timeStampReq
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil || len(rest) != 0 || req.Version != 1 {
+		return rejection(FailBadDataFormat, "malformed time-stamp request")
+	}
+
+	hash, ok := s.allowedHash(req.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return rejection(FailBadAlg, "hash algorithm not allowed")
+	}
+	if len(req.MessageImprint.HashedMessage) != hash.Size() {
+		return rejection(FailBadDataFormat, "message imprint has the wrong length")
+	}
+	if len(req.ReqPolicy) > 0 && !req.ReqPolicy.Equal(s.policy) {
+		return rejection(FailUnacceptedPolicy, "requested policy not supported")
+	}
+	if len(req.Extensions) > 0 {
+		return rejection(FailUnacceptedExtension, "request extensions are not supported")
+	}
+
+	token, err := s.token(&req)
+	if err != nil {
+		log.Errorf("failed to create time-stamp token: %v", err)
+		return rejection(FailSystemFailure, "failed to create time-stamp token")
+	}
+
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: StatusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+func (s *Signer) allowedHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	for _, hash := range s.AllowedHashes {
+		if hashOIDs[hash].Equal(oid) {
+			return hash, true
+		}
+	}
+	return 0, false
+}
+
+// token builds the CMS SignedData time-stamp token for req.
+func (s *Signer) token(req *timeStampReq) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	info := tstInfo{
+		Version:        1,
+		Policy:         s.policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   serial,
+		GenTime:        s.now().UTC().Truncate(time.Second),
+		Accuracy:       accuracyOf(s.Accuracy),
+		Nonce:          req.Nonce,
+	}
+	eContent, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, err := asn1.Marshal(OIDTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(eContent)
+	messageDigest, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	certHash := sha256.Sum256(s.cert.Raw)
+	signingCert, err := asn1.Marshal(signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute{
+		{Type: OIDContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: OIDMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+		{Type: OIDSigningCertificateV2, Values: []asn1.RawValue{{FullBytes: signingCert}}},
+	}
+	// The signature covers the DER encoding of the signed attributes
+	// with an explicit SET OF tag (RFC 5652 section 5.4).
+	signedAttrs, err := asn1.MarshalWithParams(attrs, "set")
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := s.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	if _, ok := s.key.Public().(*rsa.PublicKey); ok {
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	}
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: OIDTSTInfo, EContent: eContent},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: s.cert.RawIssuer},
+				SerialNumber: s.cert.SerialNumber,
+			},
+			DigestAlgorithm:    sha256Alg,
+			SignedAttrs:        attrs,
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	}
+	if req.CertReq {
+		sd.Certificates = []asn1.RawValue{{FullBytes: s.cert.Raw}}
+	}
+
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	// encoding/asn1 ignores the explicit tag of a RawValue when
+	// marshalling, so the [0] wrapper is built by hand.
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      content,
+		},
+	})
+}
+
+// accuracyOf splits d into the seconds, millis and micros of an
+// Accuracy, rounding up so that the claimed accuracy is never better
+// than d. A zero duration is reported as one second since RFC 3161
+// requires the accuracy to be meaningful.
+func accuracyOf(d time.Duration) accuracy {
+	if d <= 0 {
+		d = time.Second
+	}
+	micros := (d + time.Microsecond - 1) / time.Microsecond
+	return accuracy{
+		Seconds: int(micros / 1000000),
+		Millis:  int(micros / 1000 % 1000),
+		Micros:  int(micros % 1000),
+	}
+}
+
+func rejection(failure int, reason string) ([]byte, error) {
+	info := asn1.BitString{Bytes: make([]byte, failure/8+1), BitLength: failure + 1}
+	info.Bytes[failure/8] |= 0x80 >> uint(failure%8)
+	return asn1.Marshal(timeStampResp{
+		Status: pkiStatusInfo{
+			Status:       StatusRejected,
+			StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(reason)}},
+			FailInfo:     info,
+		},
+	})
+}
+
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("invalid TSA policy OID "+s))
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("invalid TSA policy OID "+s))
+	}
+	return oid, nil
+}
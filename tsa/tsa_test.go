@@ -0,0 +1,202 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var testPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+func newTestSigner(t *testing.T, eku []x509.ExtKeyUsage) (*Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  eku,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(cert, key, testPolicy)
+}
+
+func testRequest(t *testing.T, hashOID asn1.ObjectIdentifier, digest []byte, nonce *big.Int) []byte {
+	der, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hashOID},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func parseResponse(t *testing.T, der []byte) timeStampResp {
+	var resp timeStampResp
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestNewSignerRequiresTimeStampingEKU(t *testing.T) {
+	if _, err := newTestSigner(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}); err == nil {
+		t.Fatal("expected a certificate without timeStamping EKU to be rejected")
+	}
+	if _, err := newTestSigner(t, nil); err == nil {
+		t.Fatal("expected a certificate without EKU to be rejected")
+	}
+}
+
+func TestRespond(t *testing.T) {
+	s, err := newTestSigner(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genTime := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return genTime }
+
+	digest := sha256.Sum256([]byte("document"))
+	nonce := big.NewInt(0x1234567890)
+	der, err := s.Respond(testRequest(t, oidSHA256, digest[:], nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := parseResponse(t, der)
+	if resp.Status.Status != StatusGranted {
+		t.Fatalf("expected granted status, got %+v", resp.Status)
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(resp.TimeStampToken.FullBytes, &ci); err != nil {
+		t.Fatal(err)
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		t.Fatalf("unexpected token content type %v", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.Certificates) != 1 || !bytes.Equal(sd.Certificates[0].FullBytes, s.cert.Raw) {
+		t.Error("expected the TSA certificate in the token")
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		t.Errorf("nonce not echoed: got %v", info.Nonce)
+	}
+	if info.Accuracy.Seconds != 1 {
+		t.Errorf("expected an accuracy of one second, got %+v", info.Accuracy)
+	}
+	if !info.Policy.Equal(testPolicy) {
+		t.Errorf("unexpected policy %v", info.Policy)
+	}
+	if !info.GenTime.Equal(genTime) {
+		t.Errorf("unexpected genTime %v", info.GenTime)
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest[:]) {
+		t.Error("message imprint not copied from the request")
+	}
+
+	si := sd.SignerInfos[0]
+	signedAttrs, err := asn1.MarshalWithParams(si.SignedAttrs, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	if !ecdsa.VerifyASN1(s.cert.PublicKey.(*ecdsa.PublicKey), attrsDigest[:], si.Signature) {
+		t.Fatal("token signature does not verify")
+	}
+
+	contentDigest := sha256.Sum256(sd.EncapContentInfo.EContent)
+	var found bool
+	for _, attr := range si.SignedAttrs {
+		if attr.Type.Equal(OIDMessageDigest) {
+			var got []byte
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &got); err != nil {
+				t.Fatal(err)
+			}
+			found = bytes.Equal(got, contentDigest[:])
+		}
+	}
+	if !found {
+		t.Error("message digest attribute doesn't match the TSTInfo")
+	}
+}
+
+func TestRespondRejections(t *testing.T) {
+	s, err := newTestSigner(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha1Digest := sha1.Sum([]byte("document"))
+	sha256Digest := sha256.Sum256([]byte("document"))
+	tests := []struct {
+		name    string
+		req     []byte
+		failure int
+	}{
+		{"disallowed hash", testRequest(t, oidSHA1, sha1Digest[:], nil), FailBadAlg},
+		{"short imprint", testRequest(t, oidSHA256, sha256Digest[:16], nil), FailBadDataFormat},
+		{"garbage", []byte("not a request"), FailBadDataFormat},
+	}
+
+	for _, test := range tests {
+		der, err := s.Respond(test.req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resp := parseResponse(t, der)
+		if resp.Status.Status != StatusRejected {
+			t.Errorf("%s: expected rejection, got %+v", test.name, resp.Status)
+		}
+		if resp.Status.FailInfo.At(test.failure) != 1 {
+			t.Errorf("%s: expected failure bit %d, got %+v", test.name, test.failure, resp.Status.FailInfo)
+		}
+		if len(resp.TimeStampToken.FullBytes) != 0 {
+			t.Errorf("%s: rejection carried a token", test.name)
+		}
+	}
+
+	s.AllowedHashes = append(s.AllowedHashes, crypto.SHA1)
+	der, err := s.Respond(testRequest(t, oidSHA1, sha1Digest[:], nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := parseResponse(t, der); resp.Status.Status != StatusGranted {
+		t.Errorf("expected SHA-1 to be accepted once allowed, got %+v", resp.Status)
+	}
+}